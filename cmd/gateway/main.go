@@ -13,10 +13,17 @@ import (
 
 	// 导入所有内置连接器以触发注册
 	_ "github.com/y001j/iot-gateway/internal/northbound/console"
+	_ "github.com/y001j/iot-gateway/internal/northbound/file"
+	_ "github.com/y001j/iot-gateway/internal/northbound/http"
 	_ "github.com/y001j/iot-gateway/internal/northbound/influxdb"
 	_ "github.com/y001j/iot-gateway/internal/northbound/jetstream"
+	_ "github.com/y001j/iot-gateway/internal/northbound/kafka"
+	_ "github.com/y001j/iot-gateway/internal/northbound/modbus_server"
 	_ "github.com/y001j/iot-gateway/internal/northbound/mqtt"
+	_ "github.com/y001j/iot-gateway/internal/northbound/opcua_server"
+	_ "github.com/y001j/iot-gateway/internal/northbound/postgres"
 	_ "github.com/y001j/iot-gateway/internal/northbound/redis"
+	_ "github.com/y001j/iot-gateway/internal/northbound/tsdb"
 	_ "github.com/y001j/iot-gateway/internal/northbound/websocket"
 
 	// 导入所有内置适配器以触发注册
@@ -25,6 +32,7 @@ import (
 	_ "github.com/y001j/iot-gateway/internal/southbound/mock"
 	_ "github.com/y001j/iot-gateway/internal/southbound/modbus"
 	_ "github.com/y001j/iot-gateway/internal/southbound/mqtt_sub"
+	_ "github.com/y001j/iot-gateway/internal/southbound/replay"
 )
 
 func main() {
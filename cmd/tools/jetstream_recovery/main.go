@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
@@ -14,6 +13,7 @@ import (
 	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/codec"
 	"github.com/y001j/iot-gateway/internal/model"
 	"github.com/y001j/iot-gateway/internal/northbound"
 )
@@ -185,7 +185,7 @@ func main() {
 		batch = batch[:0] // 清空批处理
 		for _, msg := range msgs {
 			var point model.Point
-			if err := json.Unmarshal(msg.Data, &point); err != nil {
+			if err := codec.DecodeMsg(msg, &point); err != nil {
 				log.Error().Err(err).Msg("解析数据点失败")
 				msg.Ack() // 确认消息以避免无限重试
 				mu.Lock()
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/codec"
+	"github.com/y001j/iot-gateway/internal/model"
+)
+
+var (
+	natsURL  = flag.String("nats", "nats://localhost:4222", "NATS服务器URL")
+	subject  = flag.String("subject", "iot.data.>", "订阅主题")
+	output   = flag.String("out", "capture.jsonl", "输出文件路径，- 表示标准输出")
+	appendTo = flag.Bool("append", false, "追加到已有文件而不是覆盖")
+	duration = flag.Duration("duration", 0, "捕获时长，0表示直到收到终止信号")
+	maxCount = flag.Int64("max", 0, "最多捕获的数据点数量，0表示不限制")
+	logLevel = flag.String("log", "info", "日志级别 (debug, info, warn, error)")
+)
+
+func main() {
+	flag.Parse()
+
+	// 设置日志
+	level, err := zerolog.ParseLevel(*logLevel)
+	if err != nil {
+		fmt.Printf("无效的日志级别: %s\n", *logLevel)
+		os.Exit(1)
+	}
+	zerolog.SetGlobalLevel(level)
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
+
+	// 打开输出文件
+	var out io.WriteCloser = os.Stdout
+	if *output != "-" {
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if *appendTo {
+			flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+		f, err := os.OpenFile(*output, flags, 0644)
+		if err != nil {
+			log.Fatal().Err(err).Str("path", *output).Msg("打开输出文件失败")
+		}
+		out = f
+	}
+	writer := bufio.NewWriterSize(out, 64*1024)
+
+	// 连接NATS
+	nc, err := nats.Connect(*natsURL,
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(10),
+		nats.ReconnectWait(5*time.Second),
+	)
+	if err != nil {
+		log.Fatal().Err(err).Str("url", *natsURL).Msg("连接NATS失败")
+	}
+	defer nc.Close()
+
+	var (
+		mu       sync.Mutex
+		captured int64
+		invalid  int64
+		line     bytes.Buffer
+		doneCh   = make(chan struct{})
+		doneOnce sync.Once
+	)
+
+	sub, err := nc.Subscribe(*subject, func(msg *nats.Msg) {
+		// 校验消息是有效的数据点，保证回放时可以还原；二进制总线编码按Content-Type头解码
+		var point model.Point
+		c, err := codec.ForMsg(msg)
+		if err == nil {
+			err = c.Unmarshal(msg.Data, &point)
+		}
+		if err != nil {
+			mu.Lock()
+			invalid++
+			mu.Unlock()
+			log.Debug().Err(err).Str("subject", msg.Subject).Msg("跳过无法解析的消息")
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if *maxCount > 0 && captured >= *maxCount {
+			return
+		}
+
+		// 原样保留发布端的JSON（包含复合数据和标签），仅压缩为单行；二进制编码转换为JSON
+		line.Reset()
+		if c.Name() == codec.JSON {
+			if err := json.Compact(&line, msg.Data); err != nil {
+				invalid++
+				return
+			}
+		} else {
+			data, err := json.Marshal(point)
+			if err != nil {
+				invalid++
+				return
+			}
+			line.Write(data)
+		}
+		line.WriteByte('\n')
+		if _, err := writer.Write(line.Bytes()); err != nil {
+			log.Error().Err(err).Msg("写入捕获文件失败")
+			return
+		}
+		captured++
+
+		if *maxCount > 0 && captured >= *maxCount {
+			doneOnce.Do(func() { close(doneCh) })
+		}
+	})
+	if err != nil {
+		log.Fatal().Err(err).Str("subject", *subject).Msg("订阅失败")
+	}
+
+	log.Info().
+		Str("nats_url", *natsURL).
+		Str("subject", *subject).
+		Str("output", *output).
+		Dur("duration", *duration).
+		Int64("max", *maxCount).
+		Msg("开始捕获数据点")
+
+	// 处理信号
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	var timeout <-chan time.Time
+	if *duration > 0 {
+		timeout = time.After(*duration)
+	}
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for running := true; running; {
+		select {
+		case <-sigCh:
+			log.Info().Msg("接收到终止信号，正在结束捕获...")
+			running = false
+		case <-timeout:
+			log.Info().Msg("已达到捕获时长")
+			running = false
+		case <-doneCh:
+			log.Info().Msg("已达到最大捕获数量")
+			running = false
+		case <-ticker.C:
+			mu.Lock()
+			if err := writer.Flush(); err != nil {
+				log.Error().Err(err).Msg("刷新捕获文件失败")
+			}
+			log.Info().Int64("captured", captured).Int64("invalid", invalid).Msg("捕获进度")
+			mu.Unlock()
+		}
+	}
+
+	if err := sub.Unsubscribe(); err != nil {
+		log.Warn().Err(err).Msg("取消订阅失败")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err := writer.Flush(); err != nil {
+		log.Error().Err(err).Msg("刷新捕获文件失败")
+	}
+	if out != os.Stdout {
+		out.Close()
+	}
+
+	log.Info().Int64("captured", captured).Int64("invalid", invalid).Str("output", *output).Msg("捕获完成")
+}
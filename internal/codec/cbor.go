@@ -0,0 +1,75 @@
+package codec
+
+import (
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/y001j/iot-gateway/internal/model"
+)
+
+// cborCodec CBOR编码（RFC 8949），与msgpack使用相同的wirePoint结构
+type cborCodec struct {
+	enc cbor.EncMode
+	dec cbor.DecMode
+}
+
+func newCBORCodec() Codec {
+	enc, err := cbor.EncOptions{
+		Time: cbor.TimeRFC3339Nano,
+	}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+	dec, err := cbor.DecOptions{
+		DefaultMapType: reflect.TypeOf(map[string]interface{}(nil)),
+	}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+	return &cborCodec{enc: enc, dec: dec}
+}
+
+func (*cborCodec) Name() string        { return CBOR }
+func (*cborCodec) ContentType() string { return "application/cbor; version=1" }
+
+func (c *cborCodec) Marshal(point *model.Point) ([]byte, error) {
+	w, err := newWirePoint(point)
+	if err != nil {
+		return nil, err
+	}
+	return c.enc.Marshal(&w)
+}
+
+func (c *cborCodec) Unmarshal(data []byte, point *model.Point) error {
+	var w wirePoint
+	if err := c.dec.Unmarshal(data, &w); err != nil {
+		return err
+	}
+	return w.toPoint(point)
+}
+
+func (c *cborCodec) MarshalBatch(points []model.Point) ([]byte, error) {
+	batch := make([]wirePoint, len(points))
+	for i := range points {
+		w, err := newWirePoint(&points[i])
+		if err != nil {
+			return nil, err
+		}
+		batch[i] = w
+	}
+	return c.enc.Marshal(batch)
+}
+
+func (c *cborCodec) UnmarshalBatch(data []byte) ([]model.Point, error) {
+	var batch []wirePoint
+	if err := c.dec.Unmarshal(data, &batch); err != nil {
+		return nil, err
+	}
+	points := make([]model.Point, len(batch))
+	for i := range batch {
+		if err := batch[i].toPoint(&points[i]); err != nil {
+			return nil, err
+		}
+	}
+	return points, nil
+}
@@ -0,0 +1,208 @@
+// Package codec 数据点的编解码，用于内部NATS总线和连接器输出
+//
+// 支持 json（默认）、protobuf（iot.point.v1，见point.proto）、msgpack、cbor 四种编码。
+// 二进制编码的NATS消息带有Content-Type头，没有该头的消息按JSON解码，因此新旧版本的
+// 发布端和订阅端可以混合部署；只有在所有订阅端都能识别消息头之后才应切换总线编码。
+//
+// 无论使用哪种编码，解码得到的数据点与JSON解码的结果一致：数值为float64，复合数据为
+// map[string]interface{}（字段名与JSON相同），二进制数据为base64字符串，
+// 因此规则引擎和连接器的行为不受总线编码影响。
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/nats-io/nats.go"
+	"github.com/y001j/iot-gateway/internal/model"
+)
+
+// 编码名称
+const (
+	JSON     = "json"
+	Protobuf = "protobuf"
+	MsgPack  = "msgpack"
+	CBOR     = "cbor"
+)
+
+// SchemaVersion 二进制编码的数据点结构版本，不兼容的修改时递增
+const SchemaVersion = 1
+
+// HeaderContentType NATS消息中标识编码的消息头
+const HeaderContentType = "Content-Type"
+
+// Codec 数据点编解码器
+type Codec interface {
+	// Name 编码名称
+	Name() string
+	// ContentType 对应的MIME类型，用于NATS、Kafka、HTTP等的消息头
+	ContentType() string
+	Marshal(point *model.Point) ([]byte, error)
+	Unmarshal(data []byte, point *model.Point) error
+	MarshalBatch(points []model.Point) ([]byte, error)
+	UnmarshalBatch(data []byte) ([]model.Point, error)
+}
+
+var codecs = map[string]Codec{
+	JSON:     jsonCodec{},
+	Protobuf: protobufCodec{},
+	MsgPack:  newMsgPackCodec(),
+	CBOR:     newCBORCodec(),
+}
+
+// 编码名称的别名
+var aliases = map[string]string{
+	"":            JSON,
+	"proto":       Protobuf,
+	"pb":          Protobuf,
+	"messagepack": MsgPack,
+}
+
+// Get 按名称获取编解码器，空名称返回JSON
+func Get(name string) (Codec, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := aliases[name]; ok {
+		name = alias
+	}
+	if c, ok := codecs[name]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("不支持的编码: %s，可选 json protobuf msgpack cbor", name)
+}
+
+// Names 返回所有支持的编码名称
+func Names() []string {
+	return []string{JSON, Protobuf, MsgPack, CBOR}
+}
+
+// ForContentType 按MIME类型获取编解码器，空类型返回JSON；
+// version参数高于当前SchemaVersion时返回错误
+func ForContentType(contentType string) (Codec, error) {
+	if contentType == "" {
+		return codecs[JSON], nil
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("无效的Content-Type %q: %w", contentType, err)
+	}
+	if v, ok := params["version"]; ok {
+		version, err := strconv.Atoi(v)
+		if err != nil || version > SchemaVersion {
+			return nil, fmt.Errorf("不支持的数据点结构版本: %s", v)
+		}
+	}
+	switch mediaType {
+	case "application/json":
+		return codecs[JSON], nil
+	case "application/x-protobuf", "application/protobuf":
+		if proto, ok := params["proto"]; ok && proto != protoMessageName {
+			return nil, fmt.Errorf("不支持的Protobuf消息类型: %s", proto)
+		}
+		return codecs[Protobuf], nil
+	case "application/msgpack", "application/x-msgpack":
+		return codecs[MsgPack], nil
+	case "application/cbor":
+		return codecs[CBOR], nil
+	}
+	return nil, fmt.Errorf("不支持的Content-Type: %s", contentType)
+}
+
+// 总线编码，由网关启动时根据 gateway.bus_encoding 设置
+var bus atomic.Value
+
+func init() {
+	bus.Store(codecHolder{codecs[JSON]})
+}
+
+type codecHolder struct{ Codec }
+
+// SetBus 设置内部NATS总线上数据点消息的编码
+func SetBus(c Codec) {
+	bus.Store(codecHolder{c})
+}
+
+// Bus 返回当前的总线编码
+func Bus() Codec {
+	return bus.Load().(codecHolder).Codec
+}
+
+// 每种编码共享的只读消息头，避免每条消息分配
+var headers = func() map[string]nats.Header {
+	h := make(map[string]nats.Header, len(codecs))
+	for name, c := range codecs {
+		h[name] = nats.Header{HeaderContentType: []string{c.ContentType()}}
+	}
+	return h
+}()
+
+// NewMsg 使用总线编码创建数据点消息
+func NewMsg(subject string, point *model.Point) (*nats.Msg, error) {
+	return NewMsgWith(Bus(), subject, point)
+}
+
+// NewMsgWith 使用指定编码创建数据点消息，JSON消息不带消息头以兼容不支持消息头的NATS服务器
+func NewMsgWith(c Codec, subject string, point *model.Point) (*nats.Msg, error) {
+	data, err := c.Marshal(point)
+	if err != nil {
+		return nil, err
+	}
+	return &nats.Msg{Subject: subject, Data: data, Header: Header(c)}, nil
+}
+
+// Header 返回编码对应的NATS消息头，JSON返回nil；返回值被多条消息共享，不能修改
+func Header(c Codec) nats.Header {
+	if c.Name() == JSON {
+		return nil
+	}
+	if h, ok := headers[c.Name()]; ok {
+		return h
+	}
+	return nats.Header{HeaderContentType: []string{c.ContentType()}}
+}
+
+// ForMsg 根据消息的Content-Type头选择编解码器，没有消息头时为JSON
+func ForMsg(msg *nats.Msg) (Codec, error) {
+	if msg.Header == nil {
+		return codecs[JSON], nil
+	}
+	return ForContentType(msg.Header.Get(HeaderContentType))
+}
+
+// DecodeMsg 根据消息的Content-Type头解码数据点
+func DecodeMsg(msg *nats.Msg, point *model.Point) error {
+	c, err := ForMsg(msg)
+	if err != nil {
+		return err
+	}
+	return c.Unmarshal(msg.Data, point)
+}
+
+// jsonCodec 与 model.Point 的 MarshalJSON/UnmarshalJSON 相同
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string        { return JSON }
+func (jsonCodec) ContentType() string { return "application/json" }
+
+func (jsonCodec) Marshal(point *model.Point) ([]byte, error) {
+	return json.Marshal(point)
+}
+
+func (jsonCodec) Unmarshal(data []byte, point *model.Point) error {
+	return json.Unmarshal(data, point)
+}
+
+func (jsonCodec) MarshalBatch(points []model.Point) ([]byte, error) {
+	return json.Marshal(points)
+}
+
+func (jsonCodec) UnmarshalBatch(data []byte) ([]model.Point, error) {
+	var points []model.Point
+	if err := json.Unmarshal(data, &points); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
@@ -0,0 +1,380 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/y001j/iot-gateway/internal/codec/pointpb"
+	"github.com/y001j/iot-gateway/internal/model"
+	"google.golang.org/protobuf/proto"
+)
+
+// schemaPoints 覆盖oneof value每个分支的数据点
+func schemaPoints() []model.Point {
+	ts := time.Unix(1700000000, 123456789)
+	point := func(key string, value interface{}, typ model.DataType) model.Point {
+		p := model.NewPoint(key, "dev-1", value, typ)
+		p.Timestamp = ts
+		return p
+	}
+	composite := func(key string, data model.CompositeData) model.Point {
+		p := model.NewCompositePoint(key, "dev-1", data)
+		p.Timestamp = ts
+		return p
+	}
+
+	tagged := point("tagged", 21.5, model.TypeFloat)
+	tagged.Quality = -3
+	tagged.AddTag("site", "plant-1")
+	tagged.AddTag("line", "")
+	untimed := point("untimed", int64(7), model.TypeInt)
+	untimed.Timestamp = time.Time{}
+
+	return []model.Point{
+		point("double", 21.5, model.TypeFloat),
+		point("negative_zero", math.Copysign(0, -1), model.TypeFloat),
+		point("int", int64(-42), model.TypeInt),
+		point("uint_overflow", uint64(math.MaxUint64), model.TypeInt),
+		point("bool", true, model.TypeBool),
+		point("string", "running", model.TypeString),
+		point("bytes", []byte{0, 1, 0xff}, model.TypeBinary),
+		point("nil", nil, model.TypeString),
+		point("json", map[string]interface{}{"a": 1.0, "b": []interface{}{"x"}}, model.TypeString),
+		tagged,
+		untimed,
+		composite("location", &model.LocationData{Latitude: 31.2304, Longitude: 121.4737, Altitude: -2, Speed: 42, Heading: 180}),
+		composite("vector3d", &model.Vector3D{X: 1, Y: -2, Z: 0.5}),
+		composite("color", &model.ColorData{R: 255, G: 128, B: 0, A: 255}),
+		composite("vector", &model.VectorData{Values: []float64{1, 2, 3}, Dimension: 3, Labels: []string{"x", "y", "z"}, Unit: "g"}),
+		composite("array", &model.ArrayData{Values: []interface{}{1.5, int64(-2), true, "s", nil, []interface{}{1.0}}, DataType: "mixed", Size: 6, Unit: "m", Labels: []string{"a"}}),
+		composite("matrix", &model.MatrixData{Values: [][]float64{{1, 2}, {3, 4}}, Rows: 2, Cols: 2, Unit: "mm"}),
+		composite("timeseries", &model.TimeSeriesData{Timestamps: []time.Time{ts, ts.Add(time.Second)}, Values: []float64{1, 2}, Unit: "C", Interval: time.Second}),
+	}
+}
+
+// toPB 用point.proto生成的代码构造与数据点对应的消息，作为手写编解码的参照
+func toPB(t testing.TB, point *model.Point) *pointpb.Point {
+	msg := &pointpb.Point{
+		SchemaVersion: SchemaVersion,
+		Key:           point.Key,
+		DeviceId:      point.DeviceID,
+		Timestamp:     unixNano(point.Timestamp),
+		Type:          string(point.Type),
+		Quality:       int32(point.Quality),
+		Tags:          point.GetTagsCopy(),
+	}
+	if len(msg.Tags) == 0 {
+		msg.Tags = nil
+	}
+
+	switch v := point.Value.(type) {
+	case nil:
+	case float64:
+		msg.Value = &pointpb.Point_DoubleValue{DoubleValue: v}
+	case int64:
+		msg.Value = &pointpb.Point_IntValue{IntValue: v}
+	case uint64:
+		if v > math.MaxInt64 {
+			msg.Value = &pointpb.Point_DoubleValue{DoubleValue: float64(v)}
+		} else {
+			msg.Value = &pointpb.Point_IntValue{IntValue: int64(v)}
+		}
+	case bool:
+		msg.Value = &pointpb.Point_BoolValue{BoolValue: v}
+	case string:
+		msg.Value = &pointpb.Point_StringValue{StringValue: v}
+	case []byte:
+		msg.Value = &pointpb.Point_BytesValue{BytesValue: v}
+	case *model.LocationData:
+		msg.Value = &pointpb.Point_Location{Location: &pointpb.Location{
+			Latitude: v.Latitude, Longitude: v.Longitude, Altitude: v.Altitude,
+			Accuracy: v.Accuracy, Speed: v.Speed, Heading: v.Heading,
+		}}
+	case *model.Vector3D:
+		msg.Value = &pointpb.Point_Vector3D{Vector3D: &pointpb.Vector3D{X: v.X, Y: v.Y, Z: v.Z}}
+	case *model.ColorData:
+		msg.Value = &pointpb.Point_Color{Color: &pointpb.Color{
+			R: uint32(v.R), G: uint32(v.G), B: uint32(v.B), A: uint32(v.A),
+		}}
+	case *model.VectorData:
+		msg.Value = &pointpb.Point_Vector{Vector: &pointpb.Vector{
+			Values: v.Values, Dimension: int32(v.Dimension), Labels: v.Labels, Unit: v.Unit,
+		}}
+	case *model.ArrayData:
+		array := &pointpb.Array{DataType: v.DataType, Size: int32(v.Size), Unit: v.Unit, Labels: v.Labels}
+		for _, item := range v.Values {
+			array.Values = append(array.Values, toPBScalar(t, item))
+		}
+		msg.Value = &pointpb.Point_Array{Array: array}
+	case *model.MatrixData:
+		matrix := &pointpb.Matrix{Rows: int32(v.Rows), Cols: int32(v.Cols), Unit: v.Unit}
+		for _, row := range v.Values {
+			matrix.Values = append(matrix.Values, &pointpb.MatrixRow{Values: row})
+		}
+		msg.Value = &pointpb.Point_Matrix{Matrix: matrix}
+	case *model.TimeSeriesData:
+		series := &pointpb.TimeSeries{Values: v.Values, Unit: v.Unit, Interval: int64(v.Interval)}
+		for _, ts := range v.Timestamps {
+			series.Timestamps = append(series.Timestamps, unixNano(ts))
+		}
+		msg.Value = &pointpb.Point_Timeseries{Timeseries: series}
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg.Value = &pointpb.Point_JsonValue{JsonValue: data}
+	}
+	return msg
+}
+
+func toPBScalar(t testing.TB, item interface{}) *pointpb.Scalar {
+	switch v := item.(type) {
+	case nil:
+		return &pointpb.Scalar{Kind: &pointpb.Scalar_NullValue{NullValue: true}}
+	case float64:
+		return &pointpb.Scalar{Kind: &pointpb.Scalar_DoubleValue{DoubleValue: v}}
+	case int64:
+		return &pointpb.Scalar{Kind: &pointpb.Scalar_IntValue{IntValue: v}}
+	case bool:
+		return &pointpb.Scalar{Kind: &pointpb.Scalar_BoolValue{BoolValue: v}}
+	case string:
+		return &pointpb.Scalar{Kind: &pointpb.Scalar_StringValue{StringValue: v}}
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &pointpb.Scalar{Kind: &pointpb.Scalar_JsonValue{JsonValue: data}}
+}
+
+// TestProtobufMatchesSchema 手写的protobuf编解码与point.proto生成的代码互相解码结果一致
+func TestProtobufMatchesSchema(t *testing.T) {
+	c := protobufCodec{}
+	for _, point := range schemaPoints() {
+		t.Run(point.Key, func(t *testing.T) {
+			want := toPB(t, &point)
+
+			// 手写编码 -> 生成代码解码，没有未知字段
+			data, err := c.Marshal(&point)
+			if err != nil {
+				t.Fatalf("编码失败: %v", err)
+			}
+			var got pointpb.Point
+			if err := proto.Unmarshal(data, &got); err != nil {
+				t.Fatalf("生成代码解码失败: %v", err)
+			}
+			if !proto.Equal(&got, want) {
+				t.Fatalf("生成代码解码结果\n%v\n期望\n%v", &got, want)
+			}
+
+			// 生成代码编码 -> 手写解码，与手写编码的往返结果一致
+			generated, err := proto.Marshal(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fromGenerated, fromHandWritten model.Point
+			if err := c.Unmarshal(generated, &fromGenerated); err != nil {
+				t.Fatalf("手写解码失败: %v", err)
+			}
+			if err := c.Unmarshal(data, &fromHandWritten); err != nil {
+				t.Fatal(err)
+			}
+			assertSamePoint(t, &fromGenerated, &fromHandWritten)
+		})
+	}
+}
+
+// TestProtobufBatchMatchesSchema 批量消息与PointBatch一致
+func TestProtobufBatchMatchesSchema(t *testing.T) {
+	c := protobufCodec{}
+	points := schemaPoints()
+	want := &pointpb.PointBatch{}
+	for i := range points {
+		want.Points = append(want.Points, toPB(t, &points[i]))
+	}
+
+	data, err := c.MarshalBatch(points)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got pointpb.PointBatch
+	if err := proto.Unmarshal(data, &got); err != nil {
+		t.Fatalf("生成代码解码失败: %v", err)
+	}
+	if !proto.Equal(&got, want) {
+		t.Fatalf("批量消息与PointBatch不一致")
+	}
+
+	generated, err := proto.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := c.UnmarshalBatch(generated)
+	if err != nil {
+		t.Fatalf("手写解码失败: %v", err)
+	}
+	if len(decoded) != len(points) {
+		t.Fatalf("解码得到 %d 个数据点，期望 %d", len(decoded), len(points))
+	}
+}
+
+func assertSamePoint(t *testing.T, got, want *model.Point) {
+	t.Helper()
+	if got.Key != want.Key || got.DeviceID != want.DeviceID || got.Type != want.Type ||
+		got.Quality != want.Quality || !got.Timestamp.Equal(want.Timestamp) {
+		t.Fatalf("数据点 %+v，期望 %+v", got, want)
+	}
+	if !reflect.DeepEqual(got.GetTagsCopy(), want.GetTagsCopy()) {
+		t.Fatalf("标签 %v，期望 %v", got.GetTagsCopy(), want.GetTagsCopy())
+	}
+	if !reflect.DeepEqual(got.Value, want.Value) {
+		t.Fatalf("值 %#v，期望 %#v", got.Value, want.Value)
+	}
+}
+
+// benchCases 性能对比的测试数据，ARM网关上建议直接在目标设备上运行:
+//
+//	go test ./internal/codec -run '^$' -bench . -benchmem
+func benchCases() []struct {
+	name   string
+	points []model.Point
+} {
+	return []struct {
+		name   string
+		points []model.Point
+	}{
+		{"scalar", []model.Point{scalarPoint(0)}},
+		{"tagged", []model.Point{taggedPoint(0)}},
+		{"location", []model.Point{model.NewCompositePoint("gps", "truck-01", &model.LocationData{Latitude: 31.2304, Longitude: 121.4737, Altitude: 12.5, Speed: 42})}},
+		{"vector", []model.Point{model.NewCompositePoint("spectrum", "vib-01", &model.VectorData{Values: make([]float64, 64), Dimension: 64, Unit: "g"})}},
+		{"batch", mixedBatch(100)},
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	for _, bc := range benchCases() {
+		for _, name := range Names() {
+			c, _ := Get(name)
+			b.Run(bc.name+"/"+name, func(b *testing.B) {
+				b.ReportAllocs()
+				size := 0
+				for i := 0; i < b.N; i++ {
+					size = 0
+					for j := range bc.points {
+						data, err := c.Marshal(&bc.points[j])
+						if err != nil {
+							b.Fatal(err)
+						}
+						size += len(data)
+					}
+				}
+				b.ReportMetric(float64(size)/float64(len(bc.points)), "bytes/msg")
+			})
+		}
+		// point.proto生成的代码，包括从model.Point构造消息
+		b.Run(bc.name+"/protobuf-generated", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for j := range bc.points {
+					if _, err := proto.Marshal(toPB(b, &bc.points[j])); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	for _, bc := range benchCases() {
+		for _, name := range Names() {
+			c, _ := Get(name)
+			msgs := encodeAll(b, c, bc.points)
+			b.Run(bc.name+"/"+name, func(b *testing.B) {
+				b.ReportAllocs()
+				var point model.Point
+				for i := 0; i < b.N; i++ {
+					for _, data := range msgs {
+						if err := c.Unmarshal(data, &point); err != nil {
+							b.Fatal(err)
+						}
+					}
+				}
+			})
+		}
+		// point.proto生成的代码，只解码为生成的消息，不转换为model.Point
+		msgs := encodeAll(b, protobufCodec{}, bc.points)
+		b.Run(bc.name+"/protobuf-generated", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, data := range msgs {
+					var msg pointpb.Point
+					if err := proto.Unmarshal(data, &msg); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// encodeAll 预先编码测试数据，并校验往返后关键字段不变
+func encodeAll(b *testing.B, c Codec, points []model.Point) [][]byte {
+	b.Helper()
+	msgs := make([][]byte, len(points))
+	for i := range points {
+		data, err := c.Marshal(&points[i])
+		if err != nil {
+			b.Fatalf("%s编码失败: %v", c.Name(), err)
+		}
+		var point model.Point
+		if err := c.Unmarshal(data, &point); err != nil {
+			b.Fatalf("%s解码失败: %v", c.Name(), err)
+		}
+		if point.Key != points[i].Key || point.DeviceID != points[i].DeviceID || !point.Timestamp.Equal(points[i].Timestamp) {
+			b.Fatalf("%s: 数据点 %s 往返后不一致", c.Name(), points[i].Key)
+		}
+		msgs[i] = data
+	}
+	return msgs
+}
+
+func scalarPoint(i int) model.Point {
+	p := model.NewPoint(fmt.Sprintf("temperature_%d", i%8), fmt.Sprintf("sensor-%03d", i%20), 20+float64(i%100)/10, model.TypeFloat)
+	p.SafeTags = nil
+	return p
+}
+
+func taggedPoint(i int) model.Point {
+	p := model.NewPoint(fmt.Sprintf("pressure_%d", i%8), fmt.Sprintf("plc-%03d", i%20), int64(1000+i), model.TypeInt)
+	p.AddTag("line", "line-2")
+	p.AddTag("site", "plant-1")
+	p.AddTag("unit", "kPa")
+	return p
+}
+
+// mixedBatch 一个采集周期的典型数据: 以数值为主，少量带标签和复合数据
+func mixedBatch(n int) []model.Point {
+	points := make([]model.Point, 0, n)
+	for i := 0; i < n; i++ {
+		switch {
+		case i%20 == 19:
+			points = append(points, model.NewCompositePoint("gps", fmt.Sprintf("truck-%02d", i%10),
+				&model.LocationData{Latitude: 31.23 + float64(i)/1e4, Longitude: 121.47, Speed: float64(i % 80)}))
+		case i%5 == 4:
+			points = append(points, taggedPoint(i))
+		case i%7 == 6:
+			p := model.NewPoint("running", fmt.Sprintf("motor-%02d", i%10), i%2 == 0, model.TypeBool)
+			p.SafeTags = nil
+			points = append(points, p)
+		default:
+			points = append(points, scalarPoint(i))
+		}
+	}
+	return points
+}
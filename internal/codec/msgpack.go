@@ -0,0 +1,128 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/y001j/iot-gateway/internal/model"
+)
+
+// wirePoint msgpack和cbor编码的数据点，使用短字段名以减小消息体积:
+//
+//	v 结构版本  k 点位  d 设备ID  ts Unix纳秒  t 数据类型  val 值  q 质量码  tg 标签
+//
+// 复合数据按结构体的json标签编码为映射
+type wirePoint struct {
+	Version   int               `msgpack:"v" cbor:"v"`
+	Key       string            `msgpack:"k" cbor:"k"`
+	DeviceID  string            `msgpack:"d" cbor:"d"`
+	Timestamp int64             `msgpack:"ts,omitempty" cbor:"ts,omitempty"`
+	Type      string            `msgpack:"t" cbor:"t"`
+	Value     interface{}       `msgpack:"val" cbor:"val"`
+	Quality   int               `msgpack:"q,omitempty" cbor:"q,omitempty"`
+	Tags      map[string]string `msgpack:"tg,omitempty" cbor:"tg,omitempty"`
+}
+
+func newWirePoint(point *model.Point) (wirePoint, error) {
+	value, err := wireValue(point)
+	if err != nil {
+		return wirePoint{}, fmt.Errorf("编码数据点的值失败: %w", err)
+	}
+	return wirePoint{
+		Version:   SchemaVersion,
+		Key:       point.Key,
+		DeviceID:  point.DeviceID,
+		Timestamp: unixNano(point.Timestamp),
+		Type:      string(point.Type),
+		Value:     value,
+		Quality:   point.Quality,
+		Tags:      pointTags(point),
+	}, nil
+}
+
+func (w *wirePoint) toPoint(point *model.Point) error {
+	if w.Version > SchemaVersion {
+		return fmt.Errorf("不支持的数据点结构版本: %d", w.Version)
+	}
+	*point = model.Point{
+		Key:       w.Key,
+		DeviceID:  w.DeviceID,
+		Timestamp: fromUnixNano(w.Timestamp),
+		Type:      model.DataType(w.Type),
+		Value:     jsonShape(w.Value),
+		Quality:   w.Quality,
+	}
+	setTags(point, w.Tags)
+	return nil
+}
+
+// msgPackCodec MessagePack编码
+type msgPackCodec struct{}
+
+func newMsgPackCodec() Codec { return msgPackCodec{} }
+
+func (msgPackCodec) Name() string        { return MsgPack }
+func (msgPackCodec) ContentType() string { return "application/msgpack; version=1" }
+
+func (c msgPackCodec) Marshal(point *model.Point) ([]byte, error) {
+	w, err := newWirePoint(point)
+	if err != nil {
+		return nil, err
+	}
+	return c.encode(&w)
+}
+
+func (c msgPackCodec) Unmarshal(data []byte, point *model.Point) error {
+	var w wirePoint
+	if err := c.decode(data, &w); err != nil {
+		return err
+	}
+	return w.toPoint(point)
+}
+
+func (c msgPackCodec) MarshalBatch(points []model.Point) ([]byte, error) {
+	batch := make([]wirePoint, len(points))
+	for i := range points {
+		w, err := newWirePoint(&points[i])
+		if err != nil {
+			return nil, err
+		}
+		batch[i] = w
+	}
+	return c.encode(batch)
+}
+
+func (c msgPackCodec) UnmarshalBatch(data []byte) ([]model.Point, error) {
+	var batch []wirePoint
+	if err := c.decode(data, &batch); err != nil {
+		return nil, err
+	}
+	points := make([]model.Point, len(batch))
+	for i := range batch {
+		if err := batch[i].toPoint(&points[i]); err != nil {
+			return nil, err
+		}
+	}
+	return points, nil
+}
+
+func (msgPackCodec) encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.GetEncoder()
+	defer msgpack.PutEncoder(enc)
+	enc.Reset(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgPackCodec) decode(data []byte, v interface{}) error {
+	dec := msgpack.GetDecoder()
+	defer msgpack.PutDecoder(dec)
+	dec.Reset(bytes.NewReader(data))
+	return dec.Decode(v)
+}
@@ -0,0 +1,736 @@
+package codec
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/y001j/iot-gateway/internal/model"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+//go:generate protoc --go_out=. --go_opt=module=github.com/y001j/iot-gateway/internal/codec point.proto
+
+// protoMessageName Content-Type中的消息类型，与point.proto的包名一致
+const protoMessageName = "iot.point.v1.Point"
+
+// Point 的字段号（见point.proto）
+const (
+	pbSchemaVersion protowire.Number = 1
+	pbKey           protowire.Number = 2
+	pbDeviceID      protowire.Number = 3
+	pbTimestamp     protowire.Number = 4
+	pbType          protowire.Number = 5
+	pbQuality       protowire.Number = 6
+	pbTags          protowire.Number = 7
+
+	pbDoubleValue protowire.Number = 10
+	pbIntValue    protowire.Number = 11
+	pbBoolValue   protowire.Number = 12
+	pbStringValue protowire.Number = 13
+	pbBytesValue  protowire.Number = 14
+	pbLocation    protowire.Number = 15
+	pbVector3D    protowire.Number = 16
+	pbColor       protowire.Number = 17
+	pbVector      protowire.Number = 18
+	pbArray       protowire.Number = 19
+	pbMatrix      protowire.Number = 20
+	pbTimeSeries  protowire.Number = 21
+	pbJSONValue   protowire.Number = 22
+
+	pbBatchPoints protowire.Number = 1
+)
+
+// Scalar 的字段号
+const (
+	pbScalarDouble protowire.Number = 1
+	pbScalarInt    protowire.Number = 2
+	pbScalarBool   protowire.Number = 3
+	pbScalarString protowire.Number = 4
+	pbScalarNull   protowire.Number = 5
+	pbScalarJSON   protowire.Number = 6
+)
+
+// protobufCodec iot.point.v1 的手写编解码，直接在model.Point上编解码，不经过生成代码的消息和反射；
+// 与point.proto的一致性由测试对照pointpb中的生成代码校验
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string { return Protobuf }
+
+func (protobufCodec) ContentType() string {
+	return "application/x-protobuf; proto=" + protoMessageName
+}
+
+func (protobufCodec) Marshal(point *model.Point) ([]byte, error) {
+	return appendPoint(make([]byte, 0, 128), point)
+}
+
+func (protobufCodec) Unmarshal(data []byte, point *model.Point) error {
+	return unmarshalPoint(data, point)
+}
+
+func (protobufCodec) MarshalBatch(points []model.Point) ([]byte, error) {
+	b := make([]byte, 0, 96*len(points))
+	var err error
+	for i := range points {
+		b = protowire.AppendTag(b, pbBatchPoints, protowire.BytesType)
+		b, err = appendLengthPrefixed(b, func(b []byte) ([]byte, error) {
+			return appendPoint(b, &points[i])
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (protobufCodec) UnmarshalBatch(data []byte) ([]model.Point, error) {
+	var points []model.Point
+	r := fieldReader{b: data}
+	for r.next() {
+		if r.num != pbBatchPoints {
+			r.skip()
+			continue
+		}
+		var point model.Point
+		if err := unmarshalPoint(r.bytes(), &point); err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return points, nil
+}
+
+// appendLengthPrefixed 追加长度前缀的嵌套消息，先预留1字节长度，超过127字节时再后移内容
+func appendLengthPrefixed(b []byte, fn func([]byte) ([]byte, error)) ([]byte, error) {
+	pos := len(b)
+	b = append(b, 0)
+	b, err := fn(b)
+	if err != nil {
+		return nil, err
+	}
+	n := len(b) - pos - 1
+	if n < 0x80 {
+		b[pos] = byte(n)
+		return b, nil
+	}
+	size := protowire.SizeVarint(uint64(n))
+	b = append(b, make([]byte, size-1)...)
+	copy(b[pos+size:], b[pos+1:pos+1+n])
+	protowire.AppendVarint(b[:pos], uint64(n))
+	return b, nil
+}
+
+func appendMessage(b []byte, num protowire.Number, fn func([]byte) []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	b, _ = appendLengthPrefixed(b, func(b []byte) ([]byte, error) { return fn(b), nil })
+	return b
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendDouble(b []byte, num protowire.Number, v float64) []byte {
+	if v == 0 && !math.Signbit(v) {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendPackedDoubles(b []byte, num protowire.Number, values []float64) []byte {
+	if len(values) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	b = protowire.AppendVarint(b, uint64(8*len(values)))
+	for _, v := range values {
+		b = protowire.AppendFixed64(b, math.Float64bits(v))
+	}
+	return b
+}
+
+func appendPoint(b []byte, point *model.Point) ([]byte, error) {
+	b = appendVarint(b, pbSchemaVersion, SchemaVersion)
+	b = appendString(b, pbKey, point.Key)
+	b = appendString(b, pbDeviceID, point.DeviceID)
+	if ts := unixNano(point.Timestamp); ts != 0 {
+		b = protowire.AppendTag(b, pbTimestamp, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, uint64(ts))
+	}
+	b = appendString(b, pbType, string(point.Type))
+	b = appendVarint(b, pbQuality, uint64(int64(int32(point.Quality))))
+	for k, v := range pointTags(point) {
+		b = appendMessage(b, pbTags, func(b []byte) []byte {
+			b = protowire.AppendTag(b, 1, protowire.BytesType)
+			b = protowire.AppendString(b, k)
+			b = protowire.AppendTag(b, 2, protowire.BytesType)
+			return protowire.AppendString(b, v)
+		})
+	}
+	return appendValue(b, point.Value)
+}
+
+// appendValue 编码oneof value，复合数据结构使用对应的消息类型，映射、切片等其他值使用json_value
+func appendValue(b []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return b, nil
+	case float64:
+		b = protowire.AppendTag(b, pbDoubleValue, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, math.Float64bits(v)), nil
+	case float32:
+		return appendValue(b, float64(v))
+	case int:
+		return appendInt(b, pbIntValue, int64(v)), nil
+	case int8:
+		return appendInt(b, pbIntValue, int64(v)), nil
+	case int16:
+		return appendInt(b, pbIntValue, int64(v)), nil
+	case int32:
+		return appendInt(b, pbIntValue, int64(v)), nil
+	case int64:
+		return appendInt(b, pbIntValue, v), nil
+	case uint:
+		return appendUint(b, uint64(v)), nil
+	case uint8:
+		return appendUint(b, uint64(v)), nil
+	case uint16:
+		return appendUint(b, uint64(v)), nil
+	case uint32:
+		return appendUint(b, uint64(v)), nil
+	case uint64:
+		return appendUint(b, v), nil
+	case bool:
+		b = protowire.AppendTag(b, pbBoolValue, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeBool(v)), nil
+	case string:
+		b = protowire.AppendTag(b, pbStringValue, protowire.BytesType)
+		return protowire.AppendString(b, v), nil
+	case []byte:
+		b = protowire.AppendTag(b, pbBytesValue, protowire.BytesType)
+		return protowire.AppendBytes(b, v), nil
+	case *model.LocationData:
+		return appendMessage(b, pbLocation, func(b []byte) []byte {
+			b = appendDouble(b, 1, v.Latitude)
+			b = appendDouble(b, 2, v.Longitude)
+			b = appendDouble(b, 3, v.Altitude)
+			b = appendDouble(b, 4, v.Accuracy)
+			b = appendDouble(b, 5, v.Speed)
+			return appendDouble(b, 6, v.Heading)
+		}), nil
+	case *model.Vector3D:
+		return appendMessage(b, pbVector3D, func(b []byte) []byte {
+			b = appendDouble(b, 1, v.X)
+			b = appendDouble(b, 2, v.Y)
+			return appendDouble(b, 3, v.Z)
+		}), nil
+	case *model.ColorData:
+		return appendMessage(b, pbColor, func(b []byte) []byte {
+			b = appendVarint(b, 1, uint64(v.R))
+			b = appendVarint(b, 2, uint64(v.G))
+			b = appendVarint(b, 3, uint64(v.B))
+			return appendVarint(b, 4, uint64(v.A))
+		}), nil
+	case *model.VectorData:
+		return appendMessage(b, pbVector, func(b []byte) []byte {
+			b = appendPackedDoubles(b, 1, v.Values)
+			b = appendVarint(b, 2, uint64(int64(int32(v.Dimension))))
+			for _, label := range v.Labels {
+				b = protowire.AppendTag(b, 3, protowire.BytesType)
+				b = protowire.AppendString(b, label)
+			}
+			return appendString(b, 4, v.Unit)
+		}), nil
+	case *model.ArrayData:
+		var err error
+		b = protowire.AppendTag(b, pbArray, protowire.BytesType)
+		b, err = appendLengthPrefixed(b, func(b []byte) ([]byte, error) {
+			for _, item := range v.Values {
+				var err error
+				b = protowire.AppendTag(b, 1, protowire.BytesType)
+				if b, err = appendLengthPrefixed(b, func(b []byte) ([]byte, error) {
+					return appendScalar(b, item)
+				}); err != nil {
+					return nil, err
+				}
+			}
+			b = appendString(b, 2, v.DataType)
+			b = appendVarint(b, 3, uint64(int64(int32(v.Size))))
+			b = appendString(b, 4, v.Unit)
+			for _, label := range v.Labels {
+				b = protowire.AppendTag(b, 5, protowire.BytesType)
+				b = protowire.AppendString(b, label)
+			}
+			return b, nil
+		})
+		return b, err
+	case *model.MatrixData:
+		return appendMessage(b, pbMatrix, func(b []byte) []byte {
+			for _, row := range v.Values {
+				b = appendMessage(b, 1, func(b []byte) []byte {
+					return appendPackedDoubles(b, 1, row)
+				})
+			}
+			b = appendVarint(b, 2, uint64(int64(int32(v.Rows))))
+			b = appendVarint(b, 3, uint64(int64(int32(v.Cols))))
+			return appendString(b, 4, v.Unit)
+		}), nil
+	case *model.TimeSeriesData:
+		return appendMessage(b, pbTimeSeries, func(b []byte) []byte {
+			if len(v.Timestamps) > 0 {
+				b = protowire.AppendTag(b, 1, protowire.BytesType)
+				b = protowire.AppendVarint(b, uint64(8*len(v.Timestamps)))
+				for _, ts := range v.Timestamps {
+					b = protowire.AppendFixed64(b, uint64(unixNano(ts)))
+				}
+			}
+			b = appendPackedDoubles(b, 2, v.Values)
+			b = appendString(b, 3, v.Unit)
+			return appendVarint(b, 4, uint64(int64(v.Interval)))
+		}), nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("编码数据点的值失败: %w", err)
+	}
+	b = protowire.AppendTag(b, pbJSONValue, protowire.BytesType)
+	return protowire.AppendBytes(b, data), nil
+}
+
+func appendInt(b []byte, num protowire.Number, v int64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, protowire.EncodeZigZag(v))
+}
+
+func appendUint(b []byte, v uint64) []byte {
+	if v > math.MaxInt64 {
+		b = protowire.AppendTag(b, pbDoubleValue, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, math.Float64bits(float64(v)))
+	}
+	return appendInt(b, pbIntValue, int64(v))
+}
+
+// appendScalar 编码ArrayData的元素
+func appendScalar(b []byte, item interface{}) ([]byte, error) {
+	switch v := item.(type) {
+	case nil:
+		b = protowire.AppendTag(b, pbScalarNull, protowire.VarintType)
+		return protowire.AppendVarint(b, 1), nil
+	case float64:
+		b = protowire.AppendTag(b, pbScalarDouble, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, math.Float64bits(v)), nil
+	case float32:
+		return appendScalar(b, float64(v))
+	case int:
+		return appendInt(b, pbScalarInt, int64(v)), nil
+	case int32:
+		return appendInt(b, pbScalarInt, int64(v)), nil
+	case int64:
+		return appendInt(b, pbScalarInt, v), nil
+	case bool:
+		b = protowire.AppendTag(b, pbScalarBool, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeBool(v)), nil
+	case string:
+		b = protowire.AppendTag(b, pbScalarString, protowire.BytesType)
+		return protowire.AppendString(b, v), nil
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, fmt.Errorf("编码数组元素失败: %w", err)
+	}
+	b = protowire.AppendTag(b, pbScalarJSON, protowire.BytesType)
+	return protowire.AppendBytes(b, data), nil
+}
+
+// fieldReader 顺序读取protobuf字段，出错后next返回false，错误保存在err中
+type fieldReader struct {
+	b   []byte
+	num protowire.Number
+	typ protowire.Type
+	err error
+}
+
+func (r *fieldReader) next() bool {
+	if r.err != nil || len(r.b) == 0 {
+		return false
+	}
+	num, typ, n := protowire.ConsumeTag(r.b)
+	if n < 0 {
+		r.err = protowire.ParseError(n)
+		return false
+	}
+	r.num, r.typ, r.b = num, typ, r.b[n:]
+	return true
+}
+
+func (r *fieldReader) fail(n int) {
+	if n < 0 {
+		r.err = protowire.ParseError(n)
+	} else {
+		r.err = fmt.Errorf("字段%d的线路类型%d不正确", r.num, r.typ)
+	}
+	r.b = nil
+}
+
+func (r *fieldReader) varint() uint64 {
+	if r.typ != protowire.VarintType {
+		r.fail(0)
+		return 0
+	}
+	v, n := protowire.ConsumeVarint(r.b)
+	if n < 0 {
+		r.fail(n)
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *fieldReader) fixed64() uint64 {
+	if r.typ != protowire.Fixed64Type {
+		r.fail(0)
+		return 0
+	}
+	v, n := protowire.ConsumeFixed64(r.b)
+	if n < 0 {
+		r.fail(n)
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *fieldReader) double() float64 {
+	return math.Float64frombits(r.fixed64())
+}
+
+func (r *fieldReader) bytes() []byte {
+	if r.typ != protowire.BytesType {
+		r.fail(0)
+		return nil
+	}
+	v, n := protowire.ConsumeBytes(r.b)
+	if n < 0 {
+		r.fail(n)
+		return nil
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *fieldReader) string() string {
+	return string(r.bytes())
+}
+
+// fixed64s 读取repeated double/sfixed64，同时支持packed和非packed编码
+func (r *fieldReader) fixed64s(dst []uint64) []uint64 {
+	if r.typ == protowire.Fixed64Type {
+		return append(dst, r.fixed64())
+	}
+	packed := r.bytes()
+	if len(packed)%8 != 0 {
+		r.err = fmt.Errorf("字段%d的packed长度不正确", r.num)
+		r.b = nil
+		return dst
+	}
+	for len(packed) > 0 {
+		v, _ := protowire.ConsumeFixed64(packed)
+		dst = append(dst, v)
+		packed = packed[8:]
+	}
+	return dst
+}
+
+func (r *fieldReader) doubles(dst []float64) []float64 {
+	for _, v := range r.fixed64s(nil) {
+		dst = append(dst, math.Float64frombits(v))
+	}
+	return dst
+}
+
+func (r *fieldReader) skip() {
+	n := protowire.ConsumeFieldValue(r.num, r.typ, r.b)
+	if n < 0 {
+		r.fail(n)
+		return
+	}
+	r.b = r.b[n:]
+}
+
+func unmarshalPoint(b []byte, point *model.Point) error {
+	*point = model.Point{}
+	var tags map[string]string
+	r := fieldReader{b: b}
+	for r.next() {
+		switch r.num {
+		case pbSchemaVersion:
+			if v := r.varint(); v > SchemaVersion {
+				return fmt.Errorf("不支持的数据点结构版本: %d", v)
+			}
+		case pbKey:
+			point.Key = r.string()
+		case pbDeviceID:
+			point.DeviceID = r.string()
+		case pbTimestamp:
+			point.Timestamp = fromUnixNano(int64(r.fixed64()))
+		case pbType:
+			point.Type = model.DataType(r.string())
+		case pbQuality:
+			point.Quality = int(int32(r.varint()))
+		case pbTags:
+			k, v, err := unmarshalTag(r.bytes())
+			if err != nil {
+				return err
+			}
+			if tags == nil {
+				tags = make(map[string]string)
+			}
+			tags[k] = v
+		case pbDoubleValue:
+			point.Value = r.double()
+		case pbIntValue:
+			point.Value = float64(protowire.DecodeZigZag(r.varint()))
+		case pbBoolValue:
+			point.Value = protowire.DecodeBool(r.varint())
+		case pbStringValue:
+			point.Value = r.string()
+		case pbBytesValue:
+			point.Value = base64.StdEncoding.EncodeToString(r.bytes())
+		case pbLocation, pbVector3D, pbColor, pbVector, pbArray, pbMatrix, pbTimeSeries:
+			data, err := unmarshalComposite(r.num, r.bytes())
+			if err != nil {
+				return err
+			}
+			point.Value = compositeMap(data)
+		case pbJSONValue:
+			var v interface{}
+			if err := json.Unmarshal(r.bytes(), &v); err != nil {
+				return fmt.Errorf("解码json_value失败: %w", err)
+			}
+			point.Value = v
+		default:
+			r.skip()
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+	setTags(point, tags)
+	return nil
+}
+
+func unmarshalTag(b []byte) (string, string, error) {
+	var k, v string
+	r := fieldReader{b: b}
+	for r.next() {
+		switch r.num {
+		case 1:
+			k = r.string()
+		case 2:
+			v = r.string()
+		default:
+			r.skip()
+		}
+	}
+	return k, v, r.err
+}
+
+// unmarshalComposite 解码复合数据消息
+func unmarshalComposite(num protowire.Number, b []byte) (model.CompositeData, error) {
+	r := fieldReader{b: b}
+	var data model.CompositeData
+	switch num {
+	case pbLocation:
+		v := &model.LocationData{}
+		for r.next() {
+			switch r.num {
+			case 1:
+				v.Latitude = r.double()
+			case 2:
+				v.Longitude = r.double()
+			case 3:
+				v.Altitude = r.double()
+			case 4:
+				v.Accuracy = r.double()
+			case 5:
+				v.Speed = r.double()
+			case 6:
+				v.Heading = r.double()
+			default:
+				r.skip()
+			}
+		}
+		data = v
+	case pbVector3D:
+		v := &model.Vector3D{}
+		for r.next() {
+			switch r.num {
+			case 1:
+				v.X = r.double()
+			case 2:
+				v.Y = r.double()
+			case 3:
+				v.Z = r.double()
+			default:
+				r.skip()
+			}
+		}
+		data = v
+	case pbColor:
+		v := &model.ColorData{}
+		for r.next() {
+			switch r.num {
+			case 1:
+				v.R = uint8(r.varint())
+			case 2:
+				v.G = uint8(r.varint())
+			case 3:
+				v.B = uint8(r.varint())
+			case 4:
+				v.A = uint8(r.varint())
+			default:
+				r.skip()
+			}
+		}
+		data = v
+	case pbVector:
+		v := &model.VectorData{}
+		for r.next() {
+			switch r.num {
+			case 1:
+				v.Values = r.doubles(v.Values)
+			case 2:
+				v.Dimension = int(int32(r.varint()))
+			case 3:
+				v.Labels = append(v.Labels, r.string())
+			case 4:
+				v.Unit = r.string()
+			default:
+				r.skip()
+			}
+		}
+		data = v
+	case pbArray:
+		v := &model.ArrayData{}
+		for r.next() {
+			switch r.num {
+			case 1:
+				item, err := unmarshalScalar(r.bytes())
+				if err != nil {
+					return nil, err
+				}
+				v.Values = append(v.Values, item)
+			case 2:
+				v.DataType = r.string()
+			case 3:
+				v.Size = int(int32(r.varint()))
+			case 4:
+				v.Unit = r.string()
+			case 5:
+				v.Labels = append(v.Labels, r.string())
+			default:
+				r.skip()
+			}
+		}
+		data = v
+	case pbMatrix:
+		v := &model.MatrixData{}
+		for r.next() {
+			switch r.num {
+			case 1:
+				var row []float64
+				rr := fieldReader{b: r.bytes()}
+				for rr.next() {
+					if rr.num == 1 {
+						row = rr.doubles(row)
+					} else {
+						rr.skip()
+					}
+				}
+				if rr.err != nil {
+					return nil, rr.err
+				}
+				v.Values = append(v.Values, row)
+			case 2:
+				v.Rows = int(int32(r.varint()))
+			case 3:
+				v.Cols = int(int32(r.varint()))
+			case 4:
+				v.Unit = r.string()
+			default:
+				r.skip()
+			}
+		}
+		data = v
+	case pbTimeSeries:
+		v := &model.TimeSeriesData{}
+		for r.next() {
+			switch r.num {
+			case 1:
+				for _, ns := range r.fixed64s(nil) {
+					v.Timestamps = append(v.Timestamps, fromUnixNano(int64(ns)))
+				}
+			case 2:
+				v.Values = r.doubles(v.Values)
+			case 3:
+				v.Unit = r.string()
+			case 4:
+				v.Interval = time.Duration(int64(r.varint()))
+			default:
+				r.skip()
+			}
+		}
+		data = v
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return data, nil
+}
+
+func unmarshalScalar(b []byte) (interface{}, error) {
+	var item interface{}
+	r := fieldReader{b: b}
+	for r.next() {
+		switch r.num {
+		case pbScalarDouble:
+			item = r.double()
+		case pbScalarInt:
+			item = float64(protowire.DecodeZigZag(r.varint()))
+		case pbScalarBool:
+			item = protowire.DecodeBool(r.varint())
+		case pbScalarString:
+			item = r.string()
+		case pbScalarNull:
+			r.varint()
+			item = nil
+		case pbScalarJSON:
+			if err := json.Unmarshal(r.bytes(), &item); err != nil {
+				return nil, fmt.Errorf("解码数组元素失败: %w", err)
+			}
+		default:
+			r.skip()
+		}
+	}
+	return item, r.err
+}
@@ -0,0 +1,211 @@
+package codec
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/y001j/iot-gateway/internal/model"
+	"github.com/y001j/iot-gateway/internal/utils"
+)
+
+// unixNano 时间戳转换为Unix纳秒，零值时间为0
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano Unix纳秒转换为时间，0为零值时间
+func fromUnixNano(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// setTags 设置数据点标签，与UnmarshalJSON一致，没有标签时SafeTags为nil
+func setTags(point *model.Point, tags map[string]string) {
+	point.SafeTags = nil
+	if len(tags) == 0 {
+		return
+	}
+	point.SafeTags = utils.NewShardedTagsFromMap(tags)
+}
+
+// pointTags 读取数据点标签，没有标签时返回nil
+func pointTags(point *model.Point) map[string]string {
+	if point.SafeTags == nil {
+		return nil
+	}
+	tags := point.SafeTags.GetAll()
+	if len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
+
+// viaJSON 通过JSON往返得到与JSON解码相同形状的值，用于编解码器不能直接表示的类型
+func viaJSON(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// jsonShape 将msgpack/cbor解码得到的值转换为JSON解码的形状:
+// 所有数值为float64，映射为map[string]interface{}，字节为base64字符串，时间为RFC3339Nano字符串
+func jsonShape(v interface{}) interface{} {
+	switch val := v.(type) {
+	case nil, bool, string, float64:
+		return val
+	case int:
+		return float64(val)
+	case int8:
+		return float64(val)
+	case int16:
+		return float64(val)
+	case int32:
+		return float64(val)
+	case int64:
+		return float64(val)
+	case uint:
+		return float64(val)
+	case uint8:
+		return float64(val)
+	case uint16:
+		return float64(val)
+	case uint32:
+		return float64(val)
+	case uint64:
+		return float64(val)
+	case float32:
+		return float64(val)
+	case []byte:
+		return base64.StdEncoding.EncodeToString(val)
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	case []interface{}:
+		for i := range val {
+			val[i] = jsonShape(val[i])
+		}
+		return val
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = jsonShape(item)
+		}
+		return val
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[fmt.Sprint(k)] = jsonShape(item)
+		}
+		return out
+	}
+	if out, err := viaJSON(v); err == nil {
+		return out
+	}
+	return v
+}
+
+// wireValue 准备msgpack/cbor编码的值：标量、切片、映射和复合数据结构直接编码（复合数据使用json标签），
+// 其他类型先转换为JSON形状
+func wireValue(point *model.Point) (interface{}, error) {
+	switch v := point.Value.(type) {
+	case nil, bool, string, []byte,
+		int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64,
+		map[string]interface{}, []interface{}:
+		return v, nil
+	case *model.LocationData, *model.Vector3D, *model.ColorData, *model.VectorData,
+		*model.ArrayData, *model.MatrixData, *model.TimeSeriesData:
+		return v, nil
+	}
+	return viaJSON(point.Value)
+}
+
+// compositeMap 复合数据结构转换为JSON解码的形状（遵循结构体的json标签和omitempty）
+func compositeMap(data model.CompositeData) map[string]interface{} {
+	switch v := data.(type) {
+	case *model.LocationData:
+		m := map[string]interface{}{"latitude": v.Latitude, "longitude": v.Longitude}
+		putNonZero(m, "altitude", v.Altitude)
+		putNonZero(m, "accuracy", v.Accuracy)
+		putNonZero(m, "speed", v.Speed)
+		putNonZero(m, "heading", v.Heading)
+		return m
+	case *model.Vector3D:
+		return map[string]interface{}{"x": v.X, "y": v.Y, "z": v.Z}
+	case *model.ColorData:
+		return map[string]interface{}{"r": float64(v.R), "g": float64(v.G), "b": float64(v.B), "a": float64(v.A)}
+	case *model.VectorData:
+		m := map[string]interface{}{"values": floatList(v.Values), "dimension": float64(v.Dimension)}
+		putStrings(m, "labels", v.Labels)
+		putString(m, "unit", v.Unit)
+		return m
+	case *model.ArrayData:
+		values := make([]interface{}, len(v.Values))
+		for i, item := range v.Values {
+			values[i] = jsonShape(item)
+		}
+		m := map[string]interface{}{"values": values, "data_type": v.DataType, "size": float64(v.Size)}
+		putString(m, "unit", v.Unit)
+		putStrings(m, "labels", v.Labels)
+		return m
+	case *model.MatrixData:
+		rows := make([]interface{}, len(v.Values))
+		for i, row := range v.Values {
+			rows[i] = floatList(row)
+		}
+		m := map[string]interface{}{"values": rows, "rows": float64(v.Rows), "cols": float64(v.Cols)}
+		putString(m, "unit", v.Unit)
+		return m
+	case *model.TimeSeriesData:
+		timestamps := make([]interface{}, len(v.Timestamps))
+		for i, ts := range v.Timestamps {
+			timestamps[i] = ts.Format(time.RFC3339Nano)
+		}
+		m := map[string]interface{}{"timestamps": timestamps, "values": floatList(v.Values)}
+		putString(m, "unit", v.Unit)
+		putNonZero(m, "interval", float64(v.Interval))
+		return m
+	}
+	return nil
+}
+
+func floatList(values []float64) []interface{} {
+	out := make([]interface{}, len(values))
+	for i, v := range values {
+		out[i] = v
+	}
+	return out
+}
+
+func putNonZero(m map[string]interface{}, key string, v float64) {
+	if v != 0 {
+		m[key] = v
+	}
+}
+
+func putString(m map[string]interface{}, key, v string) {
+	if v != "" {
+		m[key] = v
+	}
+}
+
+func putStrings(m map[string]interface{}, key string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	out := make([]interface{}, len(values))
+	for i, v := range values {
+		out[i] = v
+	}
+	m[key] = out
+}
@@ -251,6 +251,37 @@ type MockConfig struct {
 	DeviceCount   int                    `json:"device_count,omitempty" yaml:"device_count,omitempty" validate:"min=1,max=1000"`
 	DataPoints    []MockDataPoint        `json:"data_points" yaml:"data_points" validate:"required,min=1"`
 	Pattern       string                 `json:"pattern,omitempty" yaml:"pattern,omitempty" validate:"oneof=sequential random sine"`
+	Seed          int64                  `json:"seed,omitempty" yaml:"seed,omitempty"`           // 随机种子，非0时数据可重复
+	Scenarios     []MockScenarioConfig   `json:"scenarios,omitempty" yaml:"scenarios,omitempty"` // 场景脚本
+}
+
+// MockScenarioConfig 模拟场景配置，由一组按时间线排列的阶段组成
+type MockScenarioConfig struct {
+	Name      string              `json:"name" yaml:"name" validate:"required"`
+	File      string              `json:"file,omitempty" yaml:"file,omitempty"`             // 从YAML/JSON文件加载阶段
+	Seed      int64               `json:"seed,omitempty" yaml:"seed,omitempty"`             // 场景随机种子，为0时使用适配器种子
+	AutoStart bool                `json:"auto_start,omitempty" yaml:"auto_start,omitempty"` // 适配器启动时自动运行
+	Repeat    bool                `json:"repeat,omitempty" yaml:"repeat,omitempty"`         // 时间线结束后重新开始
+	Phases    []MockScenarioPhase `json:"phases,omitempty" yaml:"phases,omitempty"`
+}
+
+// MockScenarioPhase 场景中的单个阶段
+type MockScenarioPhase struct {
+	Name        string    `json:"name,omitempty" yaml:"name,omitempty"`
+	Type        string    `json:"type" yaml:"type"`                                     // ramp step hold noise drift stuck spike dropout bad_quality out_of_order disconnect
+	DeviceID    string    `json:"device_id,omitempty" yaml:"device_id,omitempty"`       // 目标设备，支持通配符，空表示全部
+	Key         string    `json:"key,omitempty" yaml:"key,omitempty"`                   // 目标数据点，支持通配符，空表示全部
+	Start       *Duration `json:"start,omitempty" yaml:"start,omitempty"`               // 相对场景开始的偏移，未设置时紧接上一阶段
+	Duration    Duration  `json:"duration" yaml:"duration"`                             // 阶段持续时间
+	Value       *float64  `json:"value,omitempty" yaml:"value,omitempty"`               // step/hold目标值，ramp终值
+	From        *float64  `json:"from,omitempty" yaml:"from,omitempty"`                 // ramp起始值，未设置时使用阶段开始时的值
+	Delta       float64   `json:"delta,omitempty" yaml:"delta,omitempty"`               // step/ramp相对变化量（未设置value时使用）
+	Amplitude   float64   `json:"amplitude,omitempty" yaml:"amplitude,omitempty"`       // noise标准差/spike幅度
+	Profile     string    `json:"profile,omitempty" yaml:"profile,omitempty"`           // noise分布: gaussian uniform
+	Rate        float64   `json:"rate,omitempty" yaml:"rate,omitempty"`                 // drift每秒漂移量
+	Probability float64   `json:"probability,omitempty" yaml:"probability,omitempty"`   // spike/dropout/out_of_order触发概率
+	Quality     int       `json:"quality,omitempty" yaml:"quality,omitempty"`           // bad_quality使用的质量码
+	MaxSkew     Duration  `json:"max_skew,omitempty" yaml:"max_skew,omitempty"`         // out_of_order最大时间戳回退
 }
 
 // MockDataPoint represents a mock data point configuration
@@ -377,6 +408,35 @@ type AnomaliesConfig struct {
 	Duration    int     `json:"duration,omitempty" yaml:"duration,omitempty"`                 // 异常持续的数据点数
 }
 
+// ReplayConfig represents replay adapter configuration
+type ReplayConfig struct {
+	AdapterConfig    `json:",inline" yaml:",inline"`
+	Files            []string          `json:"files" yaml:"files" validate:"required,min=1"`
+	Format           string            `json:"format,omitempty" yaml:"format,omitempty" validate:"oneof=auto jsonl csv"`
+	Speed            float64           `json:"speed" yaml:"speed" validate:"min=0"`                                 // 时间缩放倍数，0表示尽可能快
+	Loop             bool              `json:"loop,omitempty" yaml:"loop,omitempty"`                               // 是否循环回放
+	RebaseTimestamps bool              `json:"rebase_timestamps,omitempty" yaml:"rebase_timestamps,omitempty"`     // 是否将时间戳平移到当前时间
+	DeviceIDMap      map[string]string `json:"device_id_map,omitempty" yaml:"device_id_map,omitempty"`             // 设备ID精确改写
+	DeviceIDTemplate string            `json:"device_id_template,omitempty" yaml:"device_id_template,omitempty"`   // 设备ID模板，支持 {device_id} 占位符
+	CSV              ReplayCSVConfig   `json:"csv,omitempty" yaml:"csv,omitempty"`
+}
+
+// ReplayCSVConfig CSV回放文件的列映射配置
+type ReplayCSVConfig struct {
+	Delimiter       string            `json:"delimiter,omitempty" yaml:"delimiter,omitempty"`
+	TimestampColumn string            `json:"timestamp_column,omitempty" yaml:"timestamp_column,omitempty"`
+	TimestampFormat string            `json:"timestamp_format,omitempty" yaml:"timestamp_format,omitempty"` // rfc3339, unix, unix_ms, unix_us 或Go时间布局
+	DeviceIDColumn  string            `json:"device_id_column,omitempty" yaml:"device_id_column,omitempty"`
+	KeyColumn       string            `json:"key_column,omitempty" yaml:"key_column,omitempty"`
+	ValueColumn     string            `json:"value_column,omitempty" yaml:"value_column,omitempty"`
+	TypeColumn      string            `json:"type_column,omitempty" yaml:"type_column,omitempty"`
+	QualityColumn   string            `json:"quality_column,omitempty" yaml:"quality_column,omitempty"`
+	ValueColumns    map[string]string `json:"value_columns,omitempty" yaml:"value_columns,omitempty"` // 宽表格式：列名 -> 数据点key
+	TagColumns      map[string]string `json:"tag_columns,omitempty" yaml:"tag_columns,omitempty"`     // 列名 -> 标签名
+	DeviceID        string            `json:"device_id,omitempty" yaml:"device_id,omitempty"`         // 无设备列时使用的设备ID
+	DataType        string            `json:"data_type,omitempty" yaml:"data_type,omitempty"`         // 无类型列时使用的数据类型，为空则自动推断
+}
+
 // MQTTSinkConfig represents MQTT sink configuration
 type MQTTSinkConfig struct {
 	SinkConfig `json:",inline" yaml:",inline"`
@@ -498,6 +558,28 @@ func GetDefaultMockConfig() MockConfig {
 	}
 }
 
+func GetDefaultReplayConfig() ReplayConfig {
+	return ReplayConfig{
+		AdapterConfig: AdapterConfig{
+			BaseConfig: BaseConfig{
+				Enabled: true,
+			},
+		},
+		Format: "auto",
+		Speed:  1,
+		CSV: ReplayCSVConfig{
+			Delimiter:       ",",
+			TimestampColumn: "timestamp",
+			TimestampFormat: "rfc3339",
+			DeviceIDColumn:  "device_id",
+			KeyColumn:       "key",
+			ValueColumn:     "value",
+			TypeColumn:      "type",
+			QualityColumn:   "quality",
+		},
+	}
+}
+
 func GetDefaultMQTTSinkConfig() MQTTSinkConfig {
 	return MQTTSinkConfig{
 		SinkConfig: SinkConfig{
@@ -16,6 +16,7 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
+	"github.com/y001j/iot-gateway/internal/codec"
 	"github.com/y001j/iot-gateway/internal/metrics"
 	"github.com/y001j/iot-gateway/internal/plugin"
 	"github.com/y001j/iot-gateway/internal/rules"
@@ -67,12 +68,19 @@ func NewRuntime(cfgPath string) (*Runtime, error) {
 	level, _ := zerolog.ParseLevel(v.GetString("gateway.log_level"))
 	zerolog.SetGlobalLevel(level)
 
+	// 内部总线上数据点消息的编码，默认json
+	busCodec, err := codec.Get(v.GetString("gateway.bus_encoding"))
+	if err != nil {
+		return nil, fmt.Errorf("gateway.bus_encoding配置错误: %w", err)
+	}
+	codec.SetBus(busCodec)
+	log.Info().Str("encoding", busCodec.Name()).Msg("总线数据点编码")
+
 	// nats embedded or external
 	natsURL := v.GetString("gateway.nats_url")
 	var nc *nats.Conn
 	var js nats.JetStreamContext
 	var natsServer *server.Server
-	var err error
 
 	if natsURL == "embedded" {
 		// 使用更可靠的方法启动嵌入式 NATS
@@ -484,6 +492,11 @@ func (r *Runtime) updateRuleEngineMetrics() {
 						engineMetrics.ActionsSucceeded,      // 动作成功次数
 						engineMetrics.ActionsFailed,         // 动作失败次数
 					)
+					r.metrics.UpdateRuleCheckpointMetrics(
+						engineMetrics.CheckpointLag,
+						engineMetrics.LastCheckpointAt,
+						engineMetrics.CheckpointStates,
+					)
 					
 					log.Info().
 						Int("synced_total_rules", int(engineMetrics.RulesTotal)).
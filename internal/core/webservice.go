@@ -116,7 +116,7 @@ func (ws *WebService) Start(ctx context.Context) error {
 		if ruleManager != nil {
 			ws.services.RuleManager = ruleManager
 			// 重新创建规则服务以使用新的规则管理器
-			if newRuleService, err := services.NewRuleService(ruleManager); err == nil {
+			if newRuleService, err := services.NewRuleServiceWithEngine(ruleManager, ws.ruleEngineService); err == nil {
 				ws.services.Rule = newRuleService
 				log.Info().Msg("Web服务规则管理器集成成功")
 			} else {
@@ -178,6 +178,10 @@ type RuleMetrics struct {
 	AverageExecutionTimeMS float64 `json:"average_execution_time_ms"`
 	RuleEngineStatus     string    `json:"rule_engine_status"`
 	LastRuleExecution    time.Time `json:"last_rule_execution"`
+	// 聚合状态检查点
+	CheckpointLagSeconds float64   `json:"checkpoint_lag_seconds"`
+	LastCheckpoint       time.Time `json:"last_checkpoint"`
+	CheckpointStates     int64     `json:"checkpoint_states"`
 }
 
 // PerformanceMetrics 性能指标
@@ -450,6 +454,16 @@ func (m *LightweightMetrics) UpdateRuleMetrics(totalRules, enabledRules int, mat
 	m.LastUpdated = time.Now()
 }
 
+// UpdateRuleCheckpointMetrics 更新聚合状态检查点指标
+func (m *LightweightMetrics) UpdateRuleCheckpointMetrics(lag time.Duration, lastCheckpoint time.Time, states int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	
+	m.RuleMetrics.CheckpointLagSeconds = lag.Seconds()
+	m.RuleMetrics.LastCheckpoint = lastCheckpoint
+	m.RuleMetrics.CheckpointStates = states
+}
+
 // UpdateErrorMetrics 更新错误指标
 func (m *LightweightMetrics) UpdateErrorMetrics(totalErrors int64, errorType, errorLevel, lastError string) {
 	m.mu.Lock()
@@ -600,6 +614,8 @@ func (m *LightweightMetrics) ToPlainText() string {
 	result += fmt.Sprintf("iot_gateway_actions_failed %d\n", m.RuleMetrics.ActionsFailed)
 	result += fmt.Sprintf("iot_gateway_average_execution_time_ms %.2f\n", m.RuleMetrics.AverageExecutionTimeMS)
 	result += fmt.Sprintf("iot_gateway_rule_engine_status{status=\"%s\"} 1\n", m.RuleMetrics.RuleEngineStatus)
+	result += fmt.Sprintf("iot_gateway_rule_checkpoint_lag_seconds %.2f\n", m.RuleMetrics.CheckpointLagSeconds)
+	result += fmt.Sprintf("iot_gateway_rule_checkpoint_states %d\n", m.RuleMetrics.CheckpointStates)
 	result += fmt.Sprintf("\n")
 	
 	// 错误指标
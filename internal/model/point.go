@@ -802,6 +802,52 @@ func (p *Point) GetCompositeData() (CompositeData, error) {
 	return compositeData, nil
 }
 
+// DecodeCompositeValue 将JSON反序列化得到的通用值（通常为map[string]interface{}）还原为对应的复合数据结构
+// 已经是CompositeData的值直接返回
+func DecodeCompositeValue(dataType DataType, value interface{}) (CompositeData, error) {
+	if compositeData, ok := value.(CompositeData); ok {
+		return compositeData, nil
+	}
+
+	var target CompositeData
+	switch dataType {
+	case TypeLocation:
+		target = &LocationData{}
+	case TypeVector3D:
+		target = &Vector3D{}
+	case TypeColor:
+		target = &ColorData{}
+	case TypeVector:
+		target = &VectorData{}
+	case TypeArray:
+		target = &ArrayData{}
+	case TypeMatrix:
+		target = &MatrixData{}
+	case TypeTimeSeries:
+		target = &TimeSeriesData{}
+	default:
+		return nil, fmt.Errorf("not a composite data type: %s", dataType)
+	}
+
+	var raw []byte
+	switch v := value.(type) {
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		var err error
+		if raw, err = json.Marshal(v); err != nil {
+			return nil, fmt.Errorf("marshal composite value: %w", err)
+		}
+	}
+
+	if err := json.Unmarshal(raw, target); err != nil {
+		return nil, fmt.Errorf("decode %s value: %w", dataType, err)
+	}
+	return target, nil
+}
+
 // GetLocationData 获取地理位置数据
 func (p *Point) GetLocationData() (*LocationData, error) {
 	if p.Type != TypeLocation {
@@ -11,6 +11,7 @@ import (
 
 	//"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/codec"
 	"github.com/y001j/iot-gateway/internal/model"
 )
 
@@ -54,6 +55,7 @@ type StandardConfig struct {
 	BatchSize  int               `json:"batch_size,omitempty"`
 	BufferSize int               `json:"buffer_size,omitempty"`
 	Tags       map[string]string `json:"tags,omitempty"`
+	Encoding   string            `json:"encoding,omitempty"` // 输出数据点的编码: json protobuf msgpack cbor，默认json
 	Params     json.RawMessage   `json:"params"` // 连接器特定的参数
 }
 
@@ -67,6 +69,7 @@ type BaseSink struct {
 	tags       map[string]string
 	batchSize  int
 	bufferSize int
+	codec      codec.Codec
 }
 
 // NewBaseSink 创建一个新的基础连接器
@@ -166,6 +169,12 @@ func (b *BaseSink) ParseStandardConfig(cfg json.RawMessage) (*StandardConfig, er
 	b.name = config.Name
 	b.tags = config.Tags
 
+	c, err := codec.Get(config.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	b.codec = c
+
 	if config.BatchSize > 0 {
 		b.batchSize = config.BatchSize
 	}
@@ -192,6 +201,15 @@ func (b *BaseSink) GetBufferSize() int {
 	return b.bufferSize
 }
 
+// Codec 获取输出数据点的编解码器，未配置encoding时为JSON
+func (b *BaseSink) Codec() codec.Codec {
+	if b.codec == nil {
+		c, _ := codec.Get(codec.JSON)
+		return c
+	}
+	return b.codec
+}
+
 // GetTags 获取标签
 func (b *BaseSink) GetTags() map[string]string {
 	return b.tags
@@ -0,0 +1,48 @@
+package northbound
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultCommandSubject 北向写入命令的默认NATS主题模板
+const DefaultCommandSubject = "iot.commands.{device_id}.{key}"
+
+// Command 北向系统（Modbus主站、OPC UA客户端等）写入的控制命令
+type Command struct {
+	DeviceID  string            `json:"device_id"`
+	Key       string            `json:"key"`
+	Value     interface{}       `json:"value"`
+	Type      string            `json:"type,omitempty"`
+	Source    string            `json:"source"` // 发起写入的连接器名称
+	Timestamp time.Time         `json:"timestamp"`
+	Tags      map[string]string `json:"tags,omitempty"`
+}
+
+// FormatCommandSubject 使用设备ID和数据点键填充主题模板
+func FormatCommandSubject(tpl, deviceID, key string) string {
+	if tpl == "" {
+		tpl = DefaultCommandSubject
+	}
+	return strings.NewReplacer("{device_id}", deviceID, "{key}", key).Replace(tpl)
+}
+
+// PublishCommand 将命令序列化后发布到NATS
+func PublishCommand(conn *nats.Conn, subjectTpl string, cmd Command) error {
+	if conn == nil {
+		return fmt.Errorf("NATS连接未设置")
+	}
+	if cmd.Timestamp.IsZero() {
+		cmd.Timestamp = time.Now()
+	}
+
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return fmt.Errorf("序列化命令失败: %w", err)
+	}
+	return conn.Publish(FormatCommandSubject(subjectTpl, cmd.DeviceID, cmd.Key), data)
+}
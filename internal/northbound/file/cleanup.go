@@ -0,0 +1,232 @@
+package file
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// retentionPolicy 解析后的清理策略
+type retentionPolicy struct {
+	maxAge         time.Duration
+	maxTotal       int64
+	minFreeBytes   uint64
+	minFreePercent float64
+	interval       time.Duration
+}
+
+func newRetentionPolicy(cfg *RetentionConfig) (retentionPolicy, error) {
+	p := retentionPolicy{
+		maxTotal:       int64(cfg.MaxTotalSizeMB * 1024 * 1024),
+		minFreeBytes:   uint64(cfg.MinFreeMB * 1024 * 1024),
+		minFreePercent: cfg.MinFreePercent,
+	}
+	var err error
+	if p.maxAge, err = parseDuration("retention.max_age", cfg.MaxAge); err != nil {
+		return p, err
+	}
+	if p.interval, err = parseDuration("retention.interval", cfg.Interval); err != nil {
+		return p, err
+	}
+	if p.interval <= 0 {
+		p.interval = time.Minute
+	}
+	return p, nil
+}
+
+func (p *retentionPolicy) enabled() bool {
+	return p.maxAge > 0 || p.maxTotal > 0 || p.hasWatermark()
+}
+
+func (p *retentionPolicy) hasWatermark() bool {
+	return p.minFreeBytes > 0 || p.minFreePercent > 0
+}
+
+// belowWatermark 判断磁盘可用空间是否低于水位
+func (p *retentionPolicy) belowWatermark(usage *disk.UsageStat) bool {
+	if p.minFreeBytes > 0 && usage.Free < p.minFreeBytes {
+		return true
+	}
+	if p.minFreePercent > 0 && usage.Total > 0 && float64(usage.Free)*100/float64(usage.Total) < p.minFreePercent {
+		return true
+	}
+	return false
+}
+
+func (s *FileSink) cleanupLoop(ctx context.Context) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.retention.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.cleanup(now)
+		}
+	}
+}
+
+// finishedFile 输出目录中已完成的文件
+type finishedFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// listFinished 列出已完成的文件，按修改时间从旧到新排序；正在写入的隐藏文件和其他文件不参与清理
+func (s *FileSink) listFinished() ([]finishedFile, error) {
+	var files []finishedFile
+	err := filepath.WalkDir(s.config.Path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() || strings.HasPrefix(name, ".") {
+			return nil
+		}
+		if _, _, _, _, ok := splitExt(name); !ok && !strings.HasSuffix(name, partialExt) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, finishedFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	return files, err
+}
+
+// cleanup 按保留时长、总大小和磁盘水位删除最旧的文件
+// 磁盘可用空间低于水位且没有可删除的文件时暂停写入，直到空间恢复
+func (s *FileSink) cleanup(now time.Time) {
+	files, err := s.listFinished()
+	if err != nil {
+		log.Warn().Err(err).Str("path", s.config.Path).Msg("扫描输出目录失败")
+		return
+	}
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+
+	removed := 0
+	i := 0
+	remove := func(reason string) {
+		f := files[i]
+		i++
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			log.Warn().Err(err).Str("path", f.path).Msg("删除文件失败")
+			return
+		}
+		total -= f.size
+		removed++
+		log.Debug().Str("path", f.path).Str("reason", reason).Msg("已删除文件")
+		s.removeEmptyDirs(filepath.Dir(f.path))
+	}
+
+	if s.retention.maxAge > 0 {
+		for i < len(files) && now.Sub(files[i].modTime) > s.retention.maxAge {
+			remove("max_age")
+		}
+	}
+	if s.retention.maxTotal > 0 {
+		for i < len(files) && total > s.retention.maxTotal {
+			remove("max_total_size")
+		}
+	}
+	if s.retention.hasWatermark() {
+		for {
+			usage, err := disk.Usage(s.config.Path)
+			if err != nil {
+				log.Warn().Err(err).Str("path", s.config.Path).Msg("获取磁盘使用情况失败")
+				break
+			}
+			if !s.retention.belowWatermark(usage) {
+				if s.diskFull.Swap(false) {
+					log.Info().Str("name", s.Name()).Uint64("free", usage.Free).Msg("磁盘可用空间恢复，继续写入")
+				}
+				break
+			}
+			if i >= len(files) {
+				if !s.diskFull.Swap(true) {
+					log.Warn().Str("name", s.Name()).Uint64("free", usage.Free).Msg("磁盘可用空间低于水位且没有可删除的文件，暂停写入")
+				}
+				break
+			}
+			remove("disk_free")
+		}
+	}
+
+	if removed > 0 {
+		log.Info().Str("name", s.Name()).Int("removed", removed).Int64("total_bytes", total).Msg("文件清理完成")
+	}
+}
+
+// removeEmptyDirs 删除清理后留下的空分区目录，不删除输出目录本身
+func (s *FileSink) removeEmptyDirs(dir string) {
+	root := filepath.Clean(s.config.Path)
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+	}
+}
+
+// recoverInProgress 处理上次异常退出留下的临时文件
+// CSV和JSON Lines的已写入部分可以读取，重命名为正式文件；Parquet缺少文件尾，标记为.partial
+func (s *FileSink) recoverInProgress() {
+	var tmpFiles []string
+	filepath.WalkDir(s.config.Path, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && strings.HasSuffix(d.Name(), inProgressExt) {
+			tmpFiles = append(tmpFiles, path)
+		}
+		return nil
+	})
+
+	for _, tmp := range tmpFiles {
+		final, ok := finalFromInProgress(tmp)
+		if !ok {
+			continue
+		}
+		info, err := os.Stat(tmp)
+		if err != nil {
+			continue
+		}
+		_, ext, format, compression, known := splitExt(filepath.Base(final))
+		if !known || format == formatParquet || info.Size() == 0 {
+			if info.Size() == 0 {
+				os.Remove(tmp)
+				continue
+			}
+			os.Rename(tmp, partialPath(tmp))
+			log.Warn().Str("path", tmp).Msg("上次未完成的文件无法恢复，已标记为.partial")
+			continue
+		}
+		final = uniquePath(final, ext)
+		if err := os.Rename(tmp, final); err != nil {
+			log.Warn().Err(err).Str("path", tmp).Msg("恢复未完成的文件失败")
+			continue
+		}
+		log.Warn().Str("path", final).Msg("已恢复上次未完成的文件，文件末尾可能不完整")
+		s.publishClosed(&FileClosedEvent{
+			Path:        final,
+			Format:      format,
+			Compression: compression,
+			Bytes:       info.Size(),
+			Reason:      "recovered",
+		})
+	}
+}
@@ -0,0 +1,603 @@
+package file
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/model"
+	"github.com/y001j/iot-gateway/internal/northbound"
+)
+
+func init() {
+	// 注册连接器工厂
+	northbound.Register("file", func() northbound.Sink {
+		return NewFileSink()
+	})
+}
+
+// NewFileSink 创建一个新的文件连接器
+func NewFileSink() *FileSink {
+	return &FileSink{
+		BaseSink: northbound.NewBaseSink("file"),
+		files:    make(map[string]*openFile),
+	}
+}
+
+// FileSink 将数据点写入本地CSV、JSON Lines或Parquet文件，按路径模板分区，
+// 按大小/时间轮转，完成的文件通过重命名原子地出现在输出目录中
+type FileSink struct {
+	*northbound.BaseSink
+	config         FileConfig
+	location       *time.Location
+	ext            string // 格式扩展名加压缩扩展名
+	maxSize        int64
+	rotateInterval time.Duration
+	idleTimeout    time.Duration
+	flushInterval  time.Duration
+	retention      retentionPolicy
+
+	mu       sync.Mutex
+	files    map[string]*openFile // 分区路径 -> 正在写入的文件
+	diskFull atomic.Bool
+	natsConn *nats.Conn
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// FileConfig 是文件连接器的特定参数配置，时长使用Go duration格式
+type FileConfig struct {
+	Path           string          `json:"path"`             // 输出目录，默认 data/files
+	PathTemplate   string          `json:"path_template"`    // 分区路径模板，默认 {date}/{device_id}，未带格式扩展名时自动添加
+	Format         string          `json:"format"`           // csv jsonl parquet，默认jsonl
+	Compression    string          `json:"compression"`      // none gzip zstd，parquet为列压缩并额外支持snappy
+	Timezone       string          `json:"timezone"`         // 路径中时间占位符使用的时区，默认UTC
+	TimeFormat     string          `json:"time_format"`      // csv/jsonl的时间格式: rfc3339（默认）或 unix_ms
+	MaxFileSizeMB  float64         `json:"max_file_size_mb"` // 单个文件达到该大小后轮转，默认64，0表示不限制
+	RotateInterval string          `json:"rotate_interval"`  // 文件打开超过该时长后轮转，默认1h
+	IdleTimeout    string          `json:"idle_timeout"`     // 文件超过该时长没有新数据时完成，默认15m
+	FlushInterval  string          `json:"flush_interval"`   // 缓冲数据写盘间隔，默认5s
+	MaxOpenFiles   int             `json:"max_open_files"`   // 同时写入的文件数上限，默认256
+	RowGroupRows   int             `json:"row_group_rows"`   // Parquet每个行组的行数，默认50000
+	Retention      RetentionConfig `json:"retention"`        // 清理策略
+	OnCloseSubject string          `json:"on_close_subject"` // 文件完成后发布事件的NATS主题，为空不发布
+}
+
+// RetentionConfig 已完成文件的清理策略，按文件修改时间从旧到新删除
+type RetentionConfig struct {
+	MaxAge         string  `json:"max_age"`           // 超过该时长的文件被删除
+	MaxTotalSizeMB float64 `json:"max_total_size_mb"` // 输出目录中文件总大小上限
+	MinFreeMB      float64 `json:"min_free_mb"`       // 磁盘可用空间水位（MB）
+	MinFreePercent float64 `json:"min_free_percent"`  // 磁盘可用空间水位（百分比）
+	Interval       string  `json:"interval"`          // 检查间隔，默认1m
+}
+
+// FileClosedEvent 文件完成后发布到 on_close_subject 的事件
+type FileClosedEvent struct {
+	Sink           string     `json:"sink"`
+	Path           string     `json:"path"`      // 相对输出目录的路径，使用 / 分隔
+	FullPath       string     `json:"full_path"` // 绝对路径
+	Format         string     `json:"format"`
+	Compression    string     `json:"compression"`
+	Rows           int64      `json:"rows"`
+	Bytes          int64      `json:"bytes"`
+	FirstTimestamp *time.Time `json:"first_timestamp,omitempty"` // 文件中最早的数据点时间
+	LastTimestamp  *time.Time `json:"last_timestamp,omitempty"`  // 文件中最晚的数据点时间
+	OpenedAt       *time.Time `json:"opened_at,omitempty"`
+	ClosedAt       time.Time  `json:"closed_at"`
+	Reason         string     `json:"reason"` // size interval idle schema max_open_files stop error recovered
+}
+
+// Init 初始化连接器
+func (s *FileSink) Init(cfg json.RawMessage) error {
+	// 使用标准化配置解析
+	standardConfig, err := s.ParseStandardConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("解析文件sink配置失败: %w", err)
+	}
+
+	config := FileConfig{
+		Path:           "data/files",
+		PathTemplate:   "{date}/{device_id}",
+		Format:         formatJSONL,
+		Compression:    "none",
+		Timezone:       "UTC",
+		TimeFormat:     "rfc3339",
+		MaxFileSizeMB:  64,
+		RotateInterval: "1h",
+		IdleTimeout:    "15m",
+		FlushInterval:  "5s",
+		MaxOpenFiles:   256,
+		RowGroupRows:   50000,
+		Retention:      RetentionConfig{Interval: "1m"},
+	}
+	if len(standardConfig.Params) > 0 {
+		if err := json.Unmarshal(standardConfig.Params, &config); err != nil {
+			return fmt.Errorf("解析文件特定参数失败: %w", err)
+		}
+	}
+
+	switch config.Format {
+	case formatCSV, formatJSONL, formatParquet:
+	default:
+		return fmt.Errorf("不支持的文件格式: %s，可选 csv jsonl parquet", config.Format)
+	}
+	if config.Compression == "" {
+		config.Compression = "none"
+	}
+	s.ext = formatExt(config.Format)
+	switch config.Compression {
+	case "none":
+	case "gzip", "zstd":
+		if config.Format != formatParquet {
+			s.ext += compressionSuffix[config.Compression]
+		}
+	case "snappy":
+		if config.Format != formatParquet {
+			return fmt.Errorf("snappy压缩仅支持parquet格式")
+		}
+	default:
+		return fmt.Errorf("不支持的压缩方式: %s", config.Compression)
+	}
+	if config.TimeFormat != "rfc3339" && config.TimeFormat != "unix_ms" {
+		return fmt.Errorf("不支持的时间格式: %s，可选 rfc3339 unix_ms", config.TimeFormat)
+	}
+	if config.PathTemplate == "" {
+		return fmt.Errorf("path_template不能为空")
+	}
+	if s.location, err = time.LoadLocation(config.Timezone); err != nil {
+		return fmt.Errorf("无效的时区 %s: %w", config.Timezone, err)
+	}
+	if config.MaxOpenFiles <= 0 {
+		config.MaxOpenFiles = 256
+	}
+	if config.RowGroupRows <= 0 {
+		config.RowGroupRows = 50000
+	}
+	s.maxSize = int64(config.MaxFileSizeMB * 1024 * 1024)
+
+	if s.rotateInterval, err = parseDuration("rotate_interval", config.RotateInterval); err != nil {
+		return err
+	}
+	if s.idleTimeout, err = parseDuration("idle_timeout", config.IdleTimeout); err != nil {
+		return err
+	}
+	if s.flushInterval, err = parseDuration("flush_interval", config.FlushInterval); err != nil {
+		return err
+	}
+	if s.flushInterval <= 0 {
+		s.flushInterval = 5 * time.Second
+	}
+	if s.retention, err = newRetentionPolicy(&config.Retention); err != nil {
+		return err
+	}
+
+	s.config = config
+	log.Info().
+		Str("name", s.Name()).
+		Str("path", config.Path).
+		Str("path_template", config.PathTemplate).
+		Str("format", config.Format).
+		Str("compression", config.Compression).
+		Msg("文件连接器初始化完成")
+	return nil
+}
+
+func parseDuration(name, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("无效的%s: %s", name, value)
+	}
+	return d, nil
+}
+
+// SetNATSConnection 设置NATS连接，用于发布文件完成事件
+func (s *FileSink) SetNATSConnection(conn *nats.Conn) {
+	s.natsConn = conn
+}
+
+// Start 恢复上次未完成的文件并启动定期写盘和清理
+func (s *FileSink) Start(ctx context.Context) error {
+	if err := os.MkdirAll(s.config.Path, 0755); err != nil {
+		return fmt.Errorf("创建输出目录失败: %w", err)
+	}
+	s.recoverInProgress()
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.wg.Add(1)
+	go s.maintainLoop(ctx)
+	if s.retention.enabled() {
+		// 启动时先清理一次，避免磁盘已满时继续写入
+		s.cleanup(time.Now())
+		s.wg.Add(1)
+		go s.cleanupLoop(ctx)
+	}
+
+	s.SetRunning(true)
+	log.Info().Str("name", s.Name()).Str("path", s.config.Path).Msg("文件连接器启动")
+	return nil
+}
+
+func (s *FileSink) maintainLoop(ctx context.Context) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.maintain(now)
+		}
+	}
+}
+
+// maintain 完成空闲和到期的文件，其余文件写盘
+func (s *FileSink) maintain(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, of := range s.files {
+		switch {
+		case s.idleTimeout > 0 && now.Sub(of.lastWrite) >= s.idleTimeout:
+			s.closeFile(of, "idle")
+		case s.rotateInterval > 0 && now.Sub(of.openedAt) >= s.rotateInterval:
+			s.closeFile(of, "interval")
+		default:
+			if err := of.flush(); err != nil {
+				s.HandleError(err, "文件写盘")
+			}
+		}
+	}
+}
+
+// Publish 按分区写入数据点
+func (s *FileSink) Publish(batch []model.Point) error {
+	if !s.IsRunning() {
+		return fmt.Errorf("文件连接器未启动")
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	// 记录发布操作开始时间
+	publishStart := time.Now()
+
+	return s.SafePublishBatch(batch, func(batch []model.Point) error {
+		if s.diskFull.Load() {
+			return fmt.Errorf("磁盘可用空间低于水位，暂停写入")
+		}
+
+		// 使用基础方法添加标签
+		s.AddTags(batch)
+
+		// 按分区分组，保持分区内数据点的顺序
+		groups := make(map[string][]*record)
+		var order []string
+		for i := range batch {
+			rec := newRecord(&batch[i])
+			rel := s.partitionPath(rec)
+			if _, ok := groups[rel]; !ok {
+				order = append(order, rel)
+			}
+			groups[rel] = append(groups[rel], rec)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		now := time.Now()
+		var firstErr error
+		for _, rel := range order {
+			if err := s.writePartition(rel, groups[rel], now); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		s.enforceOpenLimit()
+		return firstErr
+	}, publishStart)
+}
+
+// partitionPath 数据点所在文件相对输出目录的路径
+func (s *FileSink) partitionPath(rec *record) string {
+	rel := formatPath(s.config.PathTemplate, rec, s.location)
+	switch {
+	case strings.HasSuffix(rel, s.ext):
+	case strings.HasSuffix(rel, formatExt(s.config.Format)):
+		rel += strings.TrimPrefix(s.ext, formatExt(s.config.Format))
+	default:
+		rel += s.ext
+	}
+	return filepath.Clean(filepath.FromSlash(rel))
+}
+
+func (s *FileSink) writePartition(rel string, records []*record, now time.Time) error {
+	of := s.files[rel]
+	for i, rec := range records {
+		if of != nil {
+			if reason := s.rotateReason(of, rec, now); reason != "" {
+				s.closeFile(of, reason)
+				of = nil
+			}
+		}
+		if of == nil {
+			var err error
+			// 新文件的列结构覆盖本批次该分区剩余的所有数据点
+			if of, err = s.openFile(rel, records[i:], now); err != nil {
+				return fmt.Errorf("创建文件失败: %w", err)
+			}
+			s.files[rel] = of
+		}
+		if err := of.write(rec, now); err != nil {
+			s.closeFile(of, "error")
+			return fmt.Errorf("写入文件失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// rotateReason 写入前检查是否需要轮转，返回轮转原因
+func (s *FileSink) rotateReason(of *openFile, rec *record, now time.Time) string {
+	switch {
+	case s.config.Format != formatJSONL && !of.schema.covers(rec):
+		return "schema"
+	case s.maxSize > 0 && of.counter.n >= s.maxSize:
+		return "size"
+	case s.rotateInterval > 0 && now.Sub(of.openedAt) >= s.rotateInterval:
+		return "interval"
+	}
+	return ""
+}
+
+// enforceOpenLimit 打开的文件超过上限时完成最久没有写入的文件
+func (s *FileSink) enforceOpenLimit() {
+	for len(s.files) > s.config.MaxOpenFiles {
+		var oldest *openFile
+		for _, of := range s.files {
+			if oldest == nil || of.lastWrite.Before(oldest.lastWrite) {
+				oldest = of
+			}
+		}
+		s.closeFile(oldest, "max_open_files")
+	}
+}
+
+// openFile 正在写入的文件，数据链路: 编码器 -> 压缩 -> 计数 -> 缓冲 -> 临时文件
+type openFile struct {
+	rel       string
+	tmpPath   string
+	file      *os.File
+	buf       *bufio.Writer
+	counter   *countingWriter
+	comp      compressor
+	fw        formatWriter
+	schema    *rowSchema
+	rows      int64
+	firstTs   time.Time
+	lastTs    time.Time
+	openedAt  time.Time
+	lastWrite time.Time
+}
+
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// countingWriter 统计写入文件的字节数，用于按大小轮转
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (s *FileSink) openFile(rel string, records []*record, now time.Time) (*openFile, error) {
+	final := filepath.Join(s.config.Path, rel)
+	if err := os.MkdirAll(filepath.Dir(final), 0755); err != nil {
+		return nil, err
+	}
+	of := &openFile{
+		rel:       rel,
+		tmpPath:   inProgressPath(final, now),
+		schema:    newRowSchema(records),
+		openedAt:  now,
+		lastWrite: now,
+	}
+	f, err := os.OpenFile(of.tmpPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	of.file = f
+	of.buf = bufio.NewWriterSize(f, 64*1024)
+	of.counter = &countingWriter{w: of.buf}
+
+	var w io.Writer = of.counter
+	if s.config.Format != formatParquet {
+		switch s.config.Compression {
+		case "gzip":
+			of.comp = gzip.NewWriter(of.counter)
+		case "zstd":
+			if of.comp, err = zstd.NewWriter(of.counter); err != nil {
+				f.Close()
+				os.Remove(of.tmpPath)
+				return nil, err
+			}
+		}
+		if of.comp != nil {
+			w = of.comp
+		}
+	}
+	if of.fw, err = newFormatWriter(s.config.Format, w, of.schema, &s.config); err != nil {
+		f.Close()
+		os.Remove(of.tmpPath)
+		return nil, err
+	}
+	return of, nil
+}
+
+func (of *openFile) write(rec *record, now time.Time) error {
+	if err := of.fw.write(rec); err != nil {
+		return err
+	}
+	of.rows++
+	if of.firstTs.IsZero() || rec.ts.Before(of.firstTs) {
+		of.firstTs = rec.ts
+	}
+	if rec.ts.After(of.lastTs) {
+		of.lastTs = rec.ts
+	}
+	of.lastWrite = now
+	return nil
+}
+
+func (of *openFile) flush() error {
+	if err := of.fw.flush(); err != nil {
+		return err
+	}
+	if of.comp != nil {
+		if err := of.comp.Flush(); err != nil {
+			return err
+		}
+	}
+	return of.buf.Flush()
+}
+
+// finish 写入文件尾并关闭临时文件
+func (of *openFile) finish() error {
+	err := of.fw.close()
+	if of.comp != nil {
+		if cerr := of.comp.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if ferr := of.buf.Flush(); err == nil {
+		err = ferr
+	}
+	if serr := of.file.Sync(); err == nil {
+		err = serr
+	}
+	if cerr := of.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// closeFile 完成文件：写入文件尾后重命名为正式文件名，并发布完成事件
+func (s *FileSink) closeFile(of *openFile, reason string) {
+	delete(s.files, of.rel)
+	if err := of.finish(); err != nil {
+		s.HandleError(err, "关闭文件")
+		if of.rows == 0 || s.config.Format == formatParquet {
+			// 文件不完整，保留以便排查
+			os.Rename(of.tmpPath, partialPath(of.tmpPath))
+			return
+		}
+	}
+	if of.rows == 0 {
+		os.Remove(of.tmpPath)
+		return
+	}
+
+	final := uniquePath(filepath.Join(s.config.Path, of.rel), s.ext)
+	if err := os.Rename(of.tmpPath, final); err != nil {
+		s.HandleError(err, "重命名文件")
+		return
+	}
+	var size int64
+	if info, err := os.Stat(final); err == nil {
+		size = info.Size()
+	}
+	log.Debug().
+		Str("name", s.Name()).
+		Str("path", final).
+		Int64("rows", of.rows).
+		Int64("bytes", size).
+		Str("reason", reason).
+		Msg("文件已完成")
+
+	openedAt := of.openedAt
+	firstTs, lastTs := of.firstTs, of.lastTs
+	s.publishClosed(&FileClosedEvent{
+		Path:           final,
+		Format:         s.config.Format,
+		Compression:    s.config.Compression,
+		Rows:           of.rows,
+		Bytes:          size,
+		FirstTimestamp: &firstTs,
+		LastTimestamp:  &lastTs,
+		OpenedAt:       &openedAt,
+		Reason:         reason,
+	})
+}
+
+// publishClosed 发布文件完成事件，event.Path为完整路径，发布前转换为相对路径
+func (s *FileSink) publishClosed(event *FileClosedEvent) {
+	if s.natsConn == nil || s.config.OnCloseSubject == "" {
+		return
+	}
+	event.Sink = s.Name()
+	event.ClosedAt = time.Now()
+	event.FullPath, _ = filepath.Abs(event.Path)
+	if rel, err := filepath.Rel(s.config.Path, event.Path); err == nil {
+		event.Path = filepath.ToSlash(rel)
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	if err := s.natsConn.Publish(s.config.OnCloseSubject, data); err != nil {
+		log.Warn().Err(err).Str("subject", s.config.OnCloseSubject).Msg("发布文件完成事件失败")
+	}
+}
+
+// Stop 完成所有正在写入的文件并停止连接器
+func (s *FileSink) Stop() error {
+	if !s.IsRunning() {
+		return nil
+	}
+	s.SetRunning(false)
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+
+	s.mu.Lock()
+	count := len(s.files)
+	for _, of := range s.files {
+		s.closeFile(of, "stop")
+	}
+	s.mu.Unlock()
+
+	log.Info().Str("name", s.Name()).Int("closed_files", count).Msg("文件连接器停止")
+	return nil
+}
+
+// Healthy 检查连接器健康状态
+func (s *FileSink) Healthy() error {
+	if !s.IsRunning() {
+		return fmt.Errorf("文件连接器未运行")
+	}
+	if s.diskFull.Load() {
+		return fmt.Errorf("磁盘可用空间低于水位，已暂停写入")
+	}
+	return nil
+}
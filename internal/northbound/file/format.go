@@ -0,0 +1,388 @@
+package file
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/y001j/iot-gateway/internal/model"
+	"github.com/y001j/iot-gateway/internal/northbound"
+)
+
+// record 写入文件的一行，复合数据展开为 value_<字段> 列
+type record struct {
+	ts       time.Time
+	deviceID string
+	key      string
+	typ      string
+	quality  int
+	value    interface{}            // 标量值，复合数据为nil
+	fields   map[string]interface{} // 复合数据展开后的字段（float64/bool/string）
+	tags     map[string]string
+}
+
+func newRecord(point *model.Point) *record {
+	rec := &record{
+		ts:       point.Timestamp,
+		deviceID: point.DeviceID,
+		key:      point.Key,
+		typ:      string(point.Type),
+		quality:  point.Quality,
+		tags:     point.GetTagsCopy(),
+	}
+	if rec.ts.IsZero() {
+		rec.ts = time.Now()
+	}
+	if fields, ok := northbound.FlattenComposite(point); ok {
+		rec.fields = fields
+	} else {
+		rec.value = point.Value
+	}
+	return rec
+}
+
+// fieldKind 展开字段的类型，决定Parquet列类型
+type fieldKind int
+
+const (
+	kindNumber fieldKind = iota
+	kindBool
+	kindString
+)
+
+func kindOf(v interface{}) fieldKind {
+	switch v.(type) {
+	case bool:
+		return kindBool
+	case string:
+		return kindString
+	default:
+		return kindNumber
+	}
+}
+
+// fieldColumn 复合数据展开的列
+type fieldColumn struct {
+	name string
+	kind fieldKind
+}
+
+// rowSchema 文件的列结构，文件打开时根据首批数据确定
+type rowSchema struct {
+	fields []fieldColumn
+	index  map[string]fieldKind
+}
+
+// newRowSchema 合并多行的展开字段，同名字段类型冲突时以第一个为准
+func newRowSchema(records []*record) *rowSchema {
+	schema := &rowSchema{index: make(map[string]fieldKind)}
+	for _, rec := range records {
+		for name, v := range rec.fields {
+			if _, ok := schema.index[name]; !ok {
+				schema.index[name] = kindOf(v)
+				schema.fields = append(schema.fields, fieldColumn{name: name, kind: kindOf(v)})
+			}
+		}
+	}
+	sort.Slice(schema.fields, func(i, j int) bool { return schema.fields[i].name < schema.fields[j].name })
+	return schema
+}
+
+// covers 判断该行的展开字段是否都能写入当前列结构
+func (s *rowSchema) covers(rec *record) bool {
+	for name, v := range rec.fields {
+		kind, ok := s.index[name]
+		if !ok || kind != kindOf(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldColumnName 展开字段的列名，与固定列 value_text 重名时加下划线区分
+func fieldColumnName(name string) string {
+	if name == "text" {
+		return "value_text_"
+	}
+	return "value_" + name
+}
+
+// formatWriter 文件格式编码器
+type formatWriter interface {
+	write(rec *record) error
+	// flush 将编码器缓冲的数据写入下层
+	flush() error
+	// close 写入文件尾，不关闭下层
+	close() error
+}
+
+const (
+	formatCSV     = "csv"
+	formatJSONL   = "jsonl"
+	formatParquet = "parquet"
+)
+
+func formatExt(format string) string {
+	return "." + format
+}
+
+func newFormatWriter(format string, w io.Writer, schema *rowSchema, cfg *FileConfig) (formatWriter, error) {
+	switch format {
+	case formatCSV:
+		return newCSVWriter(w, schema, cfg.TimeFormat)
+	case formatJSONL:
+		return &jsonlWriter{w: bufio.NewWriter(w), timeFormat: cfg.TimeFormat}, nil
+	case formatParquet:
+		return newParquetWriter(w, schema, cfg)
+	default:
+		return nil, fmt.Errorf("不支持的文件格式: %s", format)
+	}
+}
+
+func formatTime(t time.Time, timeFormat string) interface{} {
+	if timeFormat == "unix_ms" {
+		return t.UnixMilli()
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// formatScalar 将值转换为文本
+func formatScalar(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case bool:
+		return strconv.FormatBool(val)
+	}
+	if f, ok := northbound.ToFloat64(v); ok {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+func tagsJSON(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(tags)
+	return string(data)
+}
+
+// csvWriter CSV格式，表头为固定列加展开字段列
+type csvWriter struct {
+	w          *csv.Writer
+	schema     *rowSchema
+	timeFormat string
+	row        []string
+}
+
+var baseColumns = []string{"timestamp", "device_id", "key", "type", "quality", "value", "tags"}
+
+func newCSVWriter(w io.Writer, schema *rowSchema, timeFormat string) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w), schema: schema, timeFormat: timeFormat}
+	header := append([]string(nil), baseColumns...)
+	for _, f := range schema.fields {
+		header = append(header, fieldColumnName(f.name))
+	}
+	cw.row = make([]string, len(header))
+	return cw, cw.w.Write(header)
+}
+
+func (w *csvWriter) write(rec *record) error {
+	row := w.row
+	row[0] = formatScalar(formatTime(rec.ts, w.timeFormat))
+	row[1] = rec.deviceID
+	row[2] = rec.key
+	row[3] = rec.typ
+	row[4] = strconv.Itoa(rec.quality)
+	row[5] = formatScalar(rec.value)
+	row[6] = tagsJSON(rec.tags)
+	for i, f := range w.schema.fields {
+		row[len(baseColumns)+i] = formatScalar(rec.fields[f.name])
+	}
+	return w.w.Write(row)
+}
+
+func (w *csvWriter) flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (w *csvWriter) close() error {
+	return w.flush()
+}
+
+// jsonlWriter JSON Lines格式，每行一个对象
+type jsonlWriter struct {
+	w          *bufio.Writer
+	timeFormat string
+}
+
+func (w *jsonlWriter) write(rec *record) error {
+	obj := make(map[string]interface{}, 6+len(rec.fields))
+	obj["timestamp"] = formatTime(rec.ts, w.timeFormat)
+	obj["device_id"] = rec.deviceID
+	obj["key"] = rec.key
+	obj["type"] = rec.typ
+	obj["quality"] = rec.quality
+	if rec.fields == nil {
+		obj["value"] = rec.value
+	}
+	if len(rec.tags) > 0 {
+		obj["tags"] = rec.tags
+	}
+	for name, v := range rec.fields {
+		obj[fieldColumnName(name)] = v
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	w.w.Write(data)
+	return w.w.WriteByte('\n')
+}
+
+func (w *jsonlWriter) flush() error {
+	return w.w.Flush()
+}
+
+func (w *jsonlWriter) close() error {
+	return w.w.Flush()
+}
+
+// parquetWriter Parquet格式
+// 数值和布尔写入value（布尔为0/1），字符串及其他值写入value_text，时间戳为毫秒精度UTC
+type parquetWriter struct {
+	w       *parquet.Writer
+	columns map[string]int
+	row     parquet.Row
+}
+
+func newParquetWriter(w io.Writer, schema *rowSchema, cfg *FileConfig) (*parquetWriter, error) {
+	group := parquet.Group{
+		"timestamp":  parquet.Timestamp(parquet.Millisecond),
+		"device_id":  parquet.String(),
+		"key":        parquet.String(),
+		"type":       parquet.String(),
+		"quality":    parquet.Int(32),
+		"value":      parquet.Optional(parquet.Leaf(parquet.DoubleType)),
+		"value_text": parquet.Optional(parquet.String()),
+		"tags":       parquet.Optional(parquet.String()),
+	}
+	for _, f := range schema.fields {
+		name := fieldColumnName(f.name)
+		switch f.kind {
+		case kindBool:
+			group[name] = parquet.Optional(parquet.Leaf(parquet.BooleanType))
+		case kindString:
+			group[name] = parquet.Optional(parquet.String())
+		default:
+			group[name] = parquet.Optional(parquet.Leaf(parquet.DoubleType))
+		}
+	}
+
+	var codec parquet.WriterOption
+	switch cfg.Compression {
+	case "gzip":
+		codec = parquet.Compression(&parquet.Gzip)
+	case "zstd":
+		codec = parquet.Compression(&parquet.Zstd)
+	case "snappy":
+		codec = parquet.Compression(&parquet.Snappy)
+	default:
+		codec = parquet.Compression(&parquet.Uncompressed)
+	}
+
+	ps := parquet.NewSchema("point", group)
+	pw := &parquetWriter{
+		w: parquet.NewWriter(w, ps, codec,
+			parquet.MaxRowsPerRowGroup(int64(cfg.RowGroupRows)),
+			parquet.CreatedBy("iot-gateway", "", "")),
+		columns: make(map[string]int),
+	}
+	for i, path := range ps.Columns() {
+		pw.columns[path[0]] = i
+	}
+	pw.row = make(parquet.Row, len(pw.columns))
+	return pw, nil
+}
+
+func (w *parquetWriter) set(name string, v parquet.Value, optional bool) {
+	i, ok := w.columns[name]
+	if !ok {
+		return
+	}
+	def := 0
+	if optional {
+		def = 1
+	}
+	w.row[i] = v.Level(0, def, i)
+}
+
+func (w *parquetWriter) write(rec *record) error {
+	for i := range w.row {
+		w.row[i] = parquet.Value{}.Level(0, 0, i)
+	}
+	w.set("timestamp", parquet.Int64Value(rec.ts.UnixMilli()), false)
+	w.set("device_id", parquet.ByteArrayValue([]byte(rec.deviceID)), false)
+	w.set("key", parquet.ByteArrayValue([]byte(rec.key)), false)
+	w.set("type", parquet.ByteArrayValue([]byte(rec.typ)), false)
+	w.set("quality", parquet.Int32Value(int32(rec.quality)), false)
+	if rec.fields == nil && rec.value != nil {
+		switch val := rec.value.(type) {
+		case bool:
+			f := 0.0
+			if val {
+				f = 1
+			}
+			w.set("value", parquet.DoubleValue(f), true)
+		case string:
+			w.set("value_text", parquet.ByteArrayValue([]byte(val)), true)
+		default:
+			if f, ok := northbound.ToFloat64(val); ok {
+				w.set("value", parquet.DoubleValue(f), true)
+			} else {
+				w.set("value_text", parquet.ByteArrayValue([]byte(formatScalar(val))), true)
+			}
+		}
+	}
+	if len(rec.tags) > 0 {
+		w.set("tags", parquet.ByteArrayValue([]byte(tagsJSON(rec.tags))), true)
+	}
+	for name, v := range rec.fields {
+		col := fieldColumnName(name)
+		switch val := v.(type) {
+		case bool:
+			w.set(col, parquet.BooleanValue(val), true)
+		case string:
+			w.set(col, parquet.ByteArrayValue([]byte(val)), true)
+		default:
+			if f, ok := northbound.ToFloat64(val); ok {
+				w.set(col, parquet.DoubleValue(f), true)
+			}
+		}
+	}
+	_, err := w.w.WriteRows([]parquet.Row{w.row})
+	return err
+}
+
+// flush Parquet按行组写入，行组未满时数据保留在内存中
+func (w *parquetWriter) flush() error {
+	return nil
+}
+
+func (w *parquetWriter) close() error {
+	return w.w.Close()
+}
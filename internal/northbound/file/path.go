@@ -0,0 +1,138 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// inProgressExt 正在写入的文件后缀，文件名以点开头，完成后重命名为正式文件名
+const inProgressExt = ".inprogress"
+
+// partialExt 异常退出后无法恢复的Parquet文件（缺少文件尾）
+const partialExt = ".partial"
+
+var (
+	knownFormats      = []string{formatCSV, formatJSONL, formatParquet}
+	compressionSuffix = map[string]string{"gzip": ".gz", "zstd": ".zst"}
+)
+
+// splitExt 识别文件名的格式和压缩扩展名，如 dev1.csv.gz -> (dev1, .csv.gz, csv, gzip)
+func splitExt(name string) (base, ext, format, compression string, ok bool) {
+	for _, f := range knownFormats {
+		if strings.HasSuffix(name, formatExt(f)) {
+			return strings.TrimSuffix(name, formatExt(f)), formatExt(f), f, "none", true
+		}
+		for c, suffix := range compressionSuffix {
+			if e := formatExt(f) + suffix; strings.HasSuffix(name, e) {
+				return strings.TrimSuffix(name, e), e, f, c, true
+			}
+		}
+	}
+	return "", "", "", "", false
+}
+
+// formatPath 填充路径模板，时间占位符使用数据点时间戳
+// 支持 {date} {year} {month} {day} {hour} {device_id} {key} {type} {tag:名称}
+// 替换的值中的路径分隔符和 .. 会被替换为下划线，避免写到输出目录之外
+func formatPath(tpl string, rec *record, loc *time.Location) string {
+	ts := rec.ts.In(loc)
+	var b strings.Builder
+	b.Grow(len(tpl) + 32)
+	for {
+		start := strings.IndexByte(tpl, '{')
+		if start < 0 {
+			b.WriteString(tpl)
+			break
+		}
+		end := strings.IndexByte(tpl[start:], '}')
+		if end < 0 {
+			b.WriteString(tpl)
+			break
+		}
+		end += start
+
+		b.WriteString(tpl[:start])
+		name := tpl[start+1 : end]
+		switch {
+		case name == "date":
+			b.WriteString(ts.Format("2006-01-02"))
+		case name == "year":
+			b.WriteString(ts.Format("2006"))
+		case name == "month":
+			b.WriteString(ts.Format("01"))
+		case name == "day":
+			b.WriteString(ts.Format("02"))
+		case name == "hour":
+			b.WriteString(ts.Format("15"))
+		case name == "device_id":
+			b.WriteString(sanitize(rec.deviceID))
+		case name == "key":
+			b.WriteString(sanitize(rec.key))
+		case name == "type":
+			b.WriteString(sanitize(rec.typ))
+		case strings.HasPrefix(name, "tag:"):
+			b.WriteString(sanitize(rec.tags[name[4:]]))
+		default:
+			// 未知占位符原样保留
+			b.WriteString(tpl[start : end+1])
+		}
+		tpl = tpl[end+1:]
+	}
+	return b.String()
+}
+
+var pathReplacer = strings.NewReplacer("/", "_", "\\", "_", ":", "_", "\x00", "_")
+
+func sanitize(s string) string {
+	// 去掉开头的点，避免 .. 以及与隐藏的临时文件混淆
+	s = strings.TrimLeft(pathReplacer.Replace(s), ".")
+	if s == "" {
+		return "_"
+	}
+	return s
+}
+
+// uniquePath 返回不存在的文件路径，已存在时在扩展名前加 -1、-2 ...
+func uniquePath(path, ext string) string {
+	base := strings.TrimSuffix(path, ext)
+	for n := 0; ; n++ {
+		p := path
+		if n > 0 {
+			p = base + "-" + strconv.Itoa(n) + ext
+		}
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			return p
+		}
+	}
+}
+
+// inProgressPath 正在写入的临时文件路径
+func inProgressPath(final string, now time.Time) string {
+	return filepath.Join(filepath.Dir(final), "."+filepath.Base(final)+"."+strconv.FormatInt(now.UnixNano(), 10)+inProgressExt)
+}
+
+// finalFromInProgress 从临时文件名恢复正式文件名
+func finalFromInProgress(path string) (string, bool) {
+	name := filepath.Base(path)
+	if !strings.HasPrefix(name, ".") || !strings.HasSuffix(name, inProgressExt) {
+		return "", false
+	}
+	name = strings.TrimSuffix(strings.TrimPrefix(name, "."), inProgressExt)
+	dot := strings.LastIndexByte(name, '.')
+	if dot <= 0 {
+		return "", false
+	}
+	if _, err := strconv.ParseInt(name[dot+1:], 10, 64); err != nil {
+		return "", false
+	}
+	return filepath.Join(filepath.Dir(path), name[:dot]), true
+}
+
+// partialPath 不完整文件的路径，去掉开头的点使其参与清理
+func partialPath(tmpPath string) string {
+	name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(tmpPath), "."), inProgressExt)
+	return filepath.Join(filepath.Dir(tmpPath), name+partialExt)
+}
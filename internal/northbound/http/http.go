@@ -0,0 +1,486 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/config"
+	"github.com/y001j/iot-gateway/internal/model"
+	"github.com/y001j/iot-gateway/internal/northbound"
+)
+
+func init() {
+	// 注册连接器工厂
+	northbound.Register("http", func() northbound.Sink {
+		return NewHTTPSink()
+	})
+}
+
+// NewHTTPSink 创建一个新的HTTP连接器
+func NewHTTPSink() *HTTPSink {
+	return &HTTPSink{
+		BaseSink: northbound.NewBaseSink("http"),
+	}
+}
+
+// HTTPSink 将数据点通过HTTP POST/PUT发送到REST接口或webhook
+type HTTPSink struct {
+	*northbound.BaseSink
+	config   HTTPConfig
+	client   *http.Client
+	urlTpl   *template.Template
+	headers  map[string]*template.Template
+	renderer renderer
+	signer   *signer
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	requests atomic.Int64
+	retries  atomic.Int64
+	failures atomic.Int64
+}
+
+// HTTPConfig 是HTTP连接器的特定参数配置
+type HTTPConfig struct {
+	URL              string            `json:"url"`                // 目标地址，支持text/template
+	Method           string            `json:"method"`             // POST PUT，默认POST
+	Mode             string            `json:"mode"`               // batch point，默认batch
+	ContentType      string            `json:"content_type"`       // 默认application/json，使用encoding时为对应编码的类型
+	Headers          map[string]string `json:"headers"`            // 请求头，值支持text/template
+	BodyTemplate     string            `json:"body_template"`      // text/template请求体
+	BodyTemplateFile string            `json:"body_template_file"` // text/template模板文件
+	JSONTemplate     json.RawMessage   `json:"json_template"`      // 单个数据点的JSON模板
+	BatchTemplate    json.RawMessage   `json:"batch_template"`     // 批量模式的JSON外层模板，默认为 "$points"
+	Gzip             bool              `json:"gzip"`               // 压缩请求体
+	MaxBodyBytes     int               `json:"max_body_bytes"`     // 批量请求体上限（压缩前），超过时拆分
+	TimeoutMs        int               `json:"timeout_ms"`         // 单次请求超时
+	Auth             *AuthConfig       `json:"auth"`
+	Retry            RetryConfig       `json:"retry"`
+	TLS              *config.TLSConfig `json:"tls"`
+}
+
+// AuthConfig 认证配置
+type AuthConfig struct {
+	Type            string `json:"type"`             // bearer basic hmac
+	Token           string `json:"token"`            // bearer
+	Username        string `json:"username"`         // basic
+	Password        string `json:"password"`         // basic
+	Secret          string `json:"secret"`           // hmac密钥
+	Algorithm       string `json:"algorithm"`        // hmac算法 sha256 sha1 sha512，默认sha256
+	Header          string `json:"header"`           // 签名头，默认X-Signature
+	Prefix          string `json:"prefix"`           // 签名前缀，如 "sha256="
+	TimestampHeader string `json:"timestamp_header"` // 配置时签名内容为 "时间戳.请求体"
+}
+
+// RetryConfig 重试配置，网络错误、5xx和429时按指数退避重试
+type RetryConfig struct {
+	MaxAttempts      int `json:"max_attempts"`       // 最大尝试次数（含首次）
+	InitialBackoffMs int `json:"initial_backoff_ms"` // 首次退避时间
+	MaxBackoffMs     int `json:"max_backoff_ms"`     // 最大退避时间，Retry-After超过该值时放弃重试
+}
+
+// RequestStats HTTP请求统计
+type RequestStats struct {
+	Requests int64 `json:"requests"`
+	Retries  int64 `json:"retries"`
+	Failures int64 `json:"failures"`
+}
+
+// statusError 非2xx响应
+type statusError struct {
+	code       int
+	body       string
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("HTTP状态码 %d: %s", e.code, e.body)
+}
+
+func (e *statusError) retryable() bool {
+	return e.code == http.StatusTooManyRequests || e.code >= 500
+}
+
+// errBodyTooLarge 单个数据点的请求体超过max_body_bytes
+var errBodyTooLarge = errors.New("请求体超过max_body_bytes")
+
+// Init 初始化连接器
+func (s *HTTPSink) Init(cfg json.RawMessage) error {
+	// 使用标准化配置解析
+	standardConfig, err := s.ParseStandardConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("解析HTTP sink配置失败: %w", err)
+	}
+
+	// 解析HTTP特定参数
+	config := HTTPConfig{
+		Method:    http.MethodPost,
+		Mode:      "batch",
+		TimeoutMs: 10000,
+		Retry: RetryConfig{
+			MaxAttempts:      3,
+			InitialBackoffMs: 500,
+			MaxBackoffMs:     30000,
+		},
+	}
+	if err := json.Unmarshal(standardConfig.Params, &config); err != nil {
+		return fmt.Errorf("解析HTTP特定参数失败: %w", err)
+	}
+	if config.URL == "" {
+		return fmt.Errorf("HTTP连接器需要配置url")
+	}
+	config.Method = strings.ToUpper(config.Method)
+	if config.Method != http.MethodPost && config.Method != http.MethodPut {
+		return fmt.Errorf("不支持的HTTP方法: %s", config.Method)
+	}
+	if config.Mode != "batch" && config.Mode != "point" {
+		return fmt.Errorf("不支持的发送模式: %s", config.Mode)
+	}
+	if config.Retry.MaxAttempts < 1 {
+		config.Retry.MaxAttempts = 1
+	}
+
+	if s.urlTpl, err = parseTemplate("url", config.URL); err != nil {
+		return err
+	}
+	s.headers = make(map[string]*template.Template, len(config.Headers))
+	for name, text := range config.Headers {
+		tpl, err := parseTemplate("header "+name, text)
+		if err != nil {
+			return err
+		}
+		s.headers[name] = tpl
+	}
+	if s.renderer, err = newRenderer(&config, s.Codec()); err != nil {
+		return err
+	}
+	if config.ContentType == "" {
+		config.ContentType = "application/json"
+		if r, ok := s.renderer.(codecRenderer); ok {
+			config.ContentType = r.c.ContentType()
+		}
+	}
+
+	s.signer = nil
+	if config.Auth != nil {
+		switch config.Auth.Type {
+		case "bearer":
+			if config.Auth.Token == "" {
+				return fmt.Errorf("bearer认证需要配置token")
+			}
+		case "basic":
+			if config.Auth.Username == "" {
+				return fmt.Errorf("basic认证需要配置username")
+			}
+		case "hmac":
+			if s.signer, err = newSigner(config.Auth); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("不支持的认证方式: %s", config.Auth.Type)
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.TLS != nil {
+		tlsConfig, err := northbound.BuildTLSConfig(config.TLS)
+		if err != nil {
+			return fmt.Errorf("配置HTTP TLS失败: %w", err)
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	s.client = &http.Client{
+		Timeout:   time.Duration(config.TimeoutMs) * time.Millisecond,
+		Transport: transport,
+	}
+	s.config = config
+
+	authType := ""
+	if config.Auth != nil {
+		authType = config.Auth.Type
+	}
+	log.Info().
+		Str("name", s.Name()).
+		Str("url", config.URL).
+		Str("method", config.Method).
+		Str("mode", config.Mode).
+		Str("auth", authType).
+		Bool("gzip", config.Gzip).
+		Int("max_body_bytes", config.MaxBodyBytes).
+		Int("max_attempts", config.Retry.MaxAttempts).
+		Msg("HTTP连接器初始化完成")
+
+	return nil
+}
+
+// Start 启动连接器
+func (s *HTTPSink) Start(ctx context.Context) error {
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	s.SetRunning(true)
+
+	log.Info().Str("name", s.Name()).Str("url", s.config.URL).Msg("HTTP连接器启动")
+	return nil
+}
+
+// Publish 发送数据点，批量模式按max_body_bytes拆分，单点模式每个数据点一个请求
+func (s *HTTPSink) Publish(batch []model.Point) error {
+	if !s.IsRunning() {
+		return fmt.Errorf("HTTP连接器未启动")
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	// 记录发布操作开始时间
+	publishStart := time.Now()
+
+	// 使用BaseSink的SafePublishBatch方法，自动处理统计
+	return s.SafePublishBatch(batch, func(batch []model.Point) error {
+		// 使用基础方法添加标签
+		s.AddTags(batch)
+
+		if s.config.Mode == "batch" {
+			return s.sendBatch(batch)
+		}
+
+		var failed int
+		var lastErr error
+		for i := range batch {
+			if err := s.sendPoint(&batch[i]); err != nil {
+				failed++
+				lastErr = err
+				s.HandleError(err, fmt.Sprintf("发送数据点 %s.%s", batch[i].DeviceID, batch[i].Key))
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d/%d 个数据点发送失败: %w", failed, len(batch), lastErr)
+		}
+		return nil
+	}, publishStart)
+}
+
+// sendBatch 发送一批数据点，请求体超过上限时对半拆分
+func (s *HTTPSink) sendBatch(points []model.Point) error {
+	body, err := s.renderer.renderBatch(points)
+	if err != nil {
+		s.HandleError(err, "生成请求体")
+		return err
+	}
+	if s.config.MaxBodyBytes > 0 && len(body) > s.config.MaxBodyBytes {
+		if len(points) == 1 {
+			err := fmt.Errorf("%w: 数据点 %s.%s 为 %d 字节", errBodyTooLarge, points[0].DeviceID, points[0].Key, len(body))
+			s.HandleError(err, "拆分请求体")
+			return err
+		}
+		mid := len(points) / 2
+		err1 := s.sendBatch(points[:mid])
+		err2 := s.sendBatch(points[mid:])
+		if err1 != nil {
+			return err1
+		}
+		return err2
+	}
+
+	view := newBatchView(points)
+	if err := s.send(view, body); err != nil {
+		s.HandleError(err, fmt.Sprintf("发送 %d 个数据点", len(points)))
+		return err
+	}
+	return nil
+}
+
+func (s *HTTPSink) sendPoint(point *model.Point) error {
+	body, err := s.renderer.renderPoint(point)
+	if err != nil {
+		return err
+	}
+	if s.config.MaxBodyBytes > 0 && len(body) > s.config.MaxBodyBytes {
+		return fmt.Errorf("%w: %d 字节", errBodyTooLarge, len(body))
+	}
+	return s.send(newPointView(point), body)
+}
+
+// send 生成URL和请求头后发送，失败时按配置重试
+func (s *HTTPSink) send(view interface{}, body []byte) error {
+	target, err := executeTemplate(s.urlTpl, view)
+	if err != nil {
+		return fmt.Errorf("生成URL失败: %w", err)
+	}
+	headers := make(map[string]string, len(s.headers)+4)
+	for name, tpl := range s.headers {
+		value, err := executeTemplate(tpl, view)
+		if err != nil {
+			return fmt.Errorf("生成请求头 %s 失败: %w", name, err)
+		}
+		headers[name] = string(value)
+	}
+	headers["Content-Type"] = s.config.ContentType
+
+	if s.config.Gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(body)
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("压缩请求体失败: %w", err)
+		}
+		body = buf.Bytes()
+		headers["Content-Encoding"] = "gzip"
+	}
+	if s.signer != nil {
+		s.signer.sign(headers, body)
+	}
+
+	backoff := time.Duration(s.config.Retry.InitialBackoffMs) * time.Millisecond
+	maxBackoff := time.Duration(s.config.Retry.MaxBackoffMs) * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err = s.do(string(target), headers, body)
+		if err == nil {
+			return nil
+		}
+
+		var wait time.Duration
+		var se *statusError
+		switch {
+		case errors.As(err, &se) && !se.retryable():
+			s.failures.Add(1)
+			return err
+		case errors.As(err, &se) && se.retryAfter > 0:
+			if maxBackoff > 0 && se.retryAfter > maxBackoff {
+				s.failures.Add(1)
+				return fmt.Errorf("%w（Retry-After %s 超过最大退避时间）", err, se.retryAfter)
+			}
+			wait = se.retryAfter
+		default:
+			wait = backoff
+		}
+		if attempt >= s.config.Retry.MaxAttempts {
+			s.failures.Add(1)
+			return err
+		}
+
+		log.Warn().
+			Err(err).
+			Str("name", s.Name()).
+			Int("attempt", attempt).
+			Dur("wait", wait).
+			Msg("HTTP请求失败，等待重试")
+		s.retries.Add(1)
+		select {
+		case <-time.After(wait):
+		case <-s.ctx.Done():
+			s.failures.Add(1)
+			return fmt.Errorf("连接器停止，放弃重试: %w", err)
+		}
+
+		backoff *= 2
+		if maxBackoff > 0 && backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// do 执行一次请求
+func (s *HTTPSink) do(target string, headers map[string]string, body []byte) error {
+	s.requests.Add(1)
+	req, err := http.NewRequestWithContext(s.ctx, s.config.Method, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	if auth := s.config.Auth; auth != nil {
+		switch auth.Type {
+		case "bearer":
+			req.Header.Set("Authorization", "Bearer "+auth.Token)
+		case "basic":
+			req.SetBasicAuth(auth.Username, auth.Password)
+		}
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return &statusError{
+		code:       resp.StatusCode,
+		body:       strings.TrimSpace(string(data)),
+		retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// parseRetryAfter 解析Retry-After，支持秒数和HTTP日期
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// RequestStats 返回请求统计
+func (s *HTTPSink) RequestStats() RequestStats {
+	return RequestStats{
+		Requests: s.requests.Load(),
+		Retries:  s.retries.Load(),
+		Failures: s.failures.Load(),
+	}
+}
+
+// Stop 停止连接器
+func (s *HTTPSink) Stop() error {
+	if !s.IsRunning() {
+		return nil
+	}
+	s.SetRunning(false)
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if s.client != nil {
+		s.client.CloseIdleConnections()
+	}
+
+	stats := s.RequestStats()
+	log.Info().
+		Str("name", s.Name()).
+		Int64("requests", stats.Requests).
+		Int64("retries", stats.Retries).
+		Int64("failures", stats.Failures).
+		Msg("HTTP连接器停止")
+	return nil
+}
+
+// Healthy 检查连接器健康状态
+func (s *HTTPSink) Healthy() error {
+	if !s.IsRunning() {
+		return fmt.Errorf("HTTP连接器未运行")
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package http
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/y001j/iot-gateway/internal/codec"
+	"github.com/y001j/iot-gateway/internal/model"
+	"github.com/y001j/iot-gateway/internal/northbound"
+)
+
+// pointView 模板中可用的数据点字段
+type pointView struct {
+	DeviceID  string
+	Key       string
+	Type      string
+	Value     interface{}
+	Quality   int
+	Timestamp time.Time
+	Tags      map[string]string
+	Fields    map[string]interface{} // 复合数据展开后的字段
+}
+
+// batchView 批量模式下模板的数据
+type batchView struct {
+	Points    []pointView
+	Count     int
+	Timestamp time.Time // 发送时间
+}
+
+func newPointView(point *model.Point) pointView {
+	view := pointView{
+		DeviceID:  point.DeviceID,
+		Key:       point.Key,
+		Type:      string(point.Type),
+		Value:     point.Value,
+		Quality:   point.Quality,
+		Timestamp: point.Timestamp,
+		Tags:      point.GetTagsCopy(),
+	}
+	if fields, ok := northbound.FlattenComposite(point); ok {
+		view.Fields = fields
+	}
+	return view
+}
+
+func newBatchView(points []model.Point) batchView {
+	view := batchView{
+		Points:    make([]pointView, len(points)),
+		Count:     len(points),
+		Timestamp: time.Now(),
+	}
+	for i := range points {
+		view.Points[i] = newPointView(&points[i])
+	}
+	return view
+}
+
+// templateFuncs 模板函数
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"unix":      func(t time.Time) int64 { return t.Unix() },
+	"unixMilli": func(t time.Time) int64 { return t.UnixMilli() },
+	"rfc3339":   func(t time.Time) string { return t.Format(time.RFC3339Nano) },
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	tpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("解析模板 %s 失败: %w", name, err)
+	}
+	return tpl, nil
+}
+
+func executeTemplate(tpl *template.Template, data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderer 生成请求体
+type renderer interface {
+	renderPoint(point *model.Point) ([]byte, error)
+	renderBatch(points []model.Point) ([]byte, error)
+}
+
+func newRenderer(cfg *HTTPConfig, c codec.Codec) (renderer, error) {
+	switch {
+	case cfg.BodyTemplate != "" || cfg.BodyTemplateFile != "":
+		text := cfg.BodyTemplate
+		if cfg.BodyTemplateFile != "" {
+			data, err := os.ReadFile(cfg.BodyTemplateFile)
+			if err != nil {
+				return nil, fmt.Errorf("读取模板文件失败: %w", err)
+			}
+			text = string(data)
+		}
+		tpl, err := parseTemplate("body", text)
+		if err != nil {
+			return nil, err
+		}
+		return &textRenderer{tpl: tpl}, nil
+	case len(cfg.JSONTemplate) > 0:
+		r := &jsonRenderer{}
+		if err := json.Unmarshal(cfg.JSONTemplate, &r.point); err != nil {
+			return nil, fmt.Errorf("解析json_template失败: %w", err)
+		}
+		r.batch = "$points"
+		if len(cfg.BatchTemplate) > 0 {
+			if err := json.Unmarshal(cfg.BatchTemplate, &r.batch); err != nil {
+				return nil, fmt.Errorf("解析batch_template失败: %w", err)
+			}
+		}
+		return r, nil
+	default:
+		return codecRenderer{c: c}, nil
+	}
+}
+
+// codecRenderer 按连接器的encoding编码数据点，默认为标准JSON，批量模式为JSON数组
+// （protobuf为PointBatch，msgpack/cbor为数组）
+type codecRenderer struct {
+	c codec.Codec
+}
+
+func (r codecRenderer) renderPoint(point *model.Point) ([]byte, error) {
+	return r.c.Marshal(point)
+}
+
+func (r codecRenderer) renderBatch(points []model.Point) ([]byte, error) {
+	return r.c.MarshalBatch(points)
+}
+
+// textRenderer text/template，单点模式的数据为pointView，批量模式为batchView
+type textRenderer struct {
+	tpl *template.Template
+}
+
+func (r *textRenderer) renderPoint(point *model.Point) ([]byte, error) {
+	return executeTemplate(r.tpl, newPointView(point))
+}
+
+func (r *textRenderer) renderBatch(points []model.Point) ([]byte, error) {
+	return executeTemplate(r.tpl, newBatchView(points))
+}
+
+// jsonRenderer JSON模板，字符串叶子节点为以下占位符时替换为对应类型的值:
+//
+//	$device_id $key $type $value $quality $timestamp $timestamp_ms $tags $fields $tag:名称
+//
+// 其他字符串按 {device_id} {key} {tag:名称} 格式替换。
+// 批量模板额外支持 $points（单点模板生成的数组）、$count、$sent_at、$sent_at_ms
+type jsonRenderer struct {
+	point interface{}
+	batch interface{}
+}
+
+func (r *jsonRenderer) renderPoint(point *model.Point) ([]byte, error) {
+	return json.Marshal(expandPoint(r.point, point))
+}
+
+func (r *jsonRenderer) renderBatch(points []model.Point) ([]byte, error) {
+	items := make([]interface{}, len(points))
+	for i := range points {
+		items[i] = expandPoint(r.point, &points[i])
+	}
+	now := time.Now()
+	return json.Marshal(expandJSON(r.batch, func(token string) (interface{}, bool) {
+		switch token {
+		case "$points":
+			return items, true
+		case "$count":
+			return len(points), true
+		case "$sent_at":
+			return now.Format(time.RFC3339Nano), true
+		case "$sent_at_ms":
+			return now.UnixMilli(), true
+		}
+		return nil, false
+	}, nil))
+}
+
+func expandPoint(tpl interface{}, point *model.Point) interface{} {
+	return expandJSON(tpl, func(token string) (interface{}, bool) {
+		switch token {
+		case "$device_id":
+			return point.DeviceID, true
+		case "$key":
+			return point.Key, true
+		case "$type":
+			return string(point.Type), true
+		case "$value":
+			return point.Value, true
+		case "$quality":
+			return point.Quality, true
+		case "$timestamp":
+			return point.Timestamp.Format(time.RFC3339Nano), true
+		case "$timestamp_ms":
+			return point.Timestamp.UnixMilli(), true
+		case "$tags":
+			return point.GetTagsCopy(), true
+		case "$fields":
+			fields, _ := northbound.FlattenComposite(point)
+			return fields, true
+		}
+		if strings.HasPrefix(token, "$tag:") {
+			v, _ := point.GetTag(token[5:])
+			return v, true
+		}
+		return nil, false
+	}, point)
+}
+
+// expandJSON 递归替换JSON模板中的占位符
+func expandJSON(v interface{}, lookup func(string) (interface{}, bool), point *model.Point) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[k] = expandJSON(item, lookup, point)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = expandJSON(item, lookup, point)
+		}
+		return out
+	case string:
+		if strings.HasPrefix(val, "$") {
+			if replaced, ok := lookup(val); ok {
+				return replaced
+			}
+		}
+		if point != nil {
+			return northbound.FormatPointTemplate(val, point)
+		}
+		return val
+	default:
+		return val
+	}
+}
+
+// signer HMAC签名
+type signer struct {
+	newHash         func() hash.Hash
+	secret          []byte
+	header          string
+	prefix          string
+	timestampHeader string
+}
+
+func newSigner(auth *AuthConfig) (*signer, error) {
+	s := &signer{
+		secret:          []byte(auth.Secret),
+		header:          auth.Header,
+		prefix:          auth.Prefix,
+		timestampHeader: auth.TimestampHeader,
+	}
+	if s.header == "" {
+		s.header = "X-Signature"
+	}
+	switch strings.ToLower(auth.Algorithm) {
+	case "", "sha256":
+		s.newHash = sha256.New
+	case "sha1":
+		s.newHash = sha1.New
+	case "sha512":
+		s.newHash = sha512.New
+	default:
+		return nil, fmt.Errorf("不支持的HMAC算法: %s", auth.Algorithm)
+	}
+	if len(s.secret) == 0 {
+		return nil, fmt.Errorf("HMAC认证需要配置secret")
+	}
+	return s, nil
+}
+
+// sign 对实际发送的请求体签名；配置了时间戳头时签名内容为 "时间戳.请求体"
+func (s *signer) sign(headers map[string]string, body []byte) {
+	mac := hmac.New(s.newHash, s.secret)
+	if s.timestampHeader != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		headers[s.timestampHeader] = ts
+		mac.Write([]byte(ts))
+		mac.Write([]byte("."))
+	}
+	mac.Write(body)
+	headers[s.header] = s.prefix + hex.EncodeToString(mac.Sum(nil))
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -30,10 +33,19 @@ func NewInfluxDBSink() *InfluxDBSink {
 }
 
 // InfluxDBSink 是一个InfluxDB连接器，用于将数据点存储到InfluxDB时序数据库
+// 支持四种写入模式:
+//   - v2: InfluxDB 2.x客户端API（默认）
+//   - v1: InfluxDB 1.x的/write接口（database/retention_policy）
+//   - line_http: 将行协议POST到任意HTTP端点（Telegraf、VictoriaMetrics等）
+//   - line_udp: 通过UDP发送行协议
 type InfluxDBSink struct {
 	*northbound.BaseSink
 	client         influxdb2.Client
 	writeAPI       api.WriteAPI
+	lineWriter     lineWriter
+	config         InfluxDBConfig
+	precision      time.Duration
+	tagKeys        map[string]bool
 	pointsConfig   map[string]PointConfig
 	defaultBucket  string
 	defaultOrg     string
@@ -53,12 +65,36 @@ type PointConfig struct {
 
 // InfluxDBConfig 是InfluxDB连接器的特定参数配置
 type InfluxDBConfig struct {
-	URL           string                 `json:"url"`          // InfluxDB服务器URL
+	Mode          string                 `json:"mode"`         // v2 v1 line_http line_udp，默认v2
+	URL           string                 `json:"url"`          // InfluxDB服务器URL；line_http模式为完整的写入地址
 	Token         string                 `json:"token"`        // InfluxDB认证令牌
 	Org           string                 `json:"org"`          // 默认组织
 	Bucket        string                 `json:"bucket"`       // 默认桶
 	FlushInterval int                    `json:"flush_interval_ms"` // 刷新间隔(ms)
 	Points        map[string]PointConfig `json:"points"`       // 数据点配置
+
+	Precision       string            `json:"precision"`        // 时间戳精度 ns us ms s，默认ns
+	Quality         string            `json:"quality"`          // 质量码写入方式 tag field none，默认none
+	TagKeys         []string          `json:"tag_keys"`         // 作为标签写入的数据点标签，为空时全部写入
+	Database        string            `json:"database"`         // v1: 数据库
+	RetentionPolicy string            `json:"retention_policy"` // v1: 保留策略
+	Username        string            `json:"username"`         // v1/line_http: 用户名（Basic认证）
+	Password        string            `json:"password"`         // v1/line_http: 密码
+	Headers         map[string]string `json:"headers"`          // line_http: 附加请求头
+	Address         string            `json:"address"`          // line_udp: 目标地址 host:port
+	MaxPacketSize   int               `json:"max_packet_size"`  // line_udp: 单个UDP包的最大字节数
+	TimeoutMs       int               `json:"timeout_ms"`       // v1/line_http: 请求超时(ms)
+}
+
+// precisions 精度配置与时间单位、v1接口参数的对应关系
+var precisions = map[string]struct {
+	unit time.Duration
+	v1   string
+}{
+	"ns": {time.Nanosecond, "n"},
+	"us": {time.Microsecond, "u"},
+	"ms": {time.Millisecond, "ms"},
+	"s":  {time.Second, "s"},
 }
 
 // Init 初始化连接器
@@ -70,42 +106,88 @@ func (s *InfluxDBSink) Init(cfg json.RawMessage) error {
 	}
 
 	// 解析InfluxDB特定参数
-	var influxConfig InfluxDBConfig
+	influxConfig := InfluxDBConfig{
+		Mode:          "v2",
+		Precision:     "ns",
+		Quality:       "none",
+		MaxPacketSize: 1400,
+		TimeoutMs:     10000,
+	}
 	if err := json.Unmarshal(standardConfig.Params, &influxConfig); err != nil {
 		return fmt.Errorf("解析InfluxDB特定参数失败: %w", err)
 	}
 
+	precision, ok := precisions[influxConfig.Precision]
+	if !ok {
+		return fmt.Errorf("不支持的时间戳精度: %s", influxConfig.Precision)
+	}
+	switch influxConfig.Quality {
+	case "tag", "field", "none":
+	default:
+		return fmt.Errorf("不支持的quality配置: %s", influxConfig.Quality)
+	}
+
+	s.config = influxConfig
+	s.precision = precision.unit
 	s.defaultOrg = influxConfig.Org
 	s.defaultBucket = influxConfig.Bucket
 	s.pointsConfig = influxConfig.Points
-
-	// 创建InfluxDB客户端
-	options := influxdb2.DefaultOptions()
-	if s.GetBatchSize() > 0 {
-		options.SetBatchSize(uint(s.GetBatchSize()))
-	}
-	if influxConfig.FlushInterval > 0 {
-		options.SetFlushInterval(uint(influxConfig.FlushInterval))
+	s.tagKeys = nil
+	if len(influxConfig.TagKeys) > 0 {
+		s.tagKeys = make(map[string]bool, len(influxConfig.TagKeys))
+		for _, k := range influxConfig.TagKeys {
+			s.tagKeys[k] = true
+		}
 	}
 
-	s.client = influxdb2.NewClientWithOptions(influxConfig.URL, influxConfig.Token, options)
-	
-	// 创建写入API（非阻塞）
-	s.writeAPI = s.client.WriteAPI(influxConfig.Org, influxConfig.Bucket)
-	
-	// 设置错误处理
-	errorsCh := s.writeAPI.Errors()
-	go func() {
-		for err := range errorsCh {
-			s.HandleError(err, "InfluxDB写入")
+	switch influxConfig.Mode {
+	case "v2":
+		// 创建InfluxDB客户端
+		options := influxdb2.DefaultOptions()
+		if s.GetBatchSize() > 0 {
+			options.SetBatchSize(uint(s.GetBatchSize()))
 		}
-	}()
+		if influxConfig.FlushInterval > 0 {
+			options.SetFlushInterval(uint(influxConfig.FlushInterval))
+		}
+		options.SetPrecision(precision.unit)
+
+		s.client = influxdb2.NewClientWithOptions(influxConfig.URL, influxConfig.Token, options)
+
+		// 创建写入API（非阻塞）
+		s.writeAPI = s.client.WriteAPI(influxConfig.Org, influxConfig.Bucket)
+
+		// 设置错误处理
+		errorsCh := s.writeAPI.Errors()
+		go func() {
+			for err := range errorsCh {
+				s.HandleError(err, "InfluxDB写入")
+			}
+		}()
+	case "v1", "line_http":
+		writer, err := newHTTPLineWriter(&influxConfig, precision.v1)
+		if err != nil {
+			return err
+		}
+		s.lineWriter = writer
+	case "line_udp":
+		writer, err := newUDPLineWriter(influxConfig.Address, influxConfig.MaxPacketSize)
+		if err != nil {
+			return err
+		}
+		s.lineWriter = writer
+	default:
+		return fmt.Errorf("不支持的InfluxDB写入模式: %s", influxConfig.Mode)
+	}
 
 	log.Info().
 		Str("name", s.Name()).
+		Str("mode", influxConfig.Mode).
 		Str("url", influxConfig.URL).
 		Str("org", influxConfig.Org).
 		Str("bucket", influxConfig.Bucket).
+		Str("database", influxConfig.Database).
+		Str("precision", influxConfig.Precision).
 		Int("points_config", len(s.pointsConfig)).
 		Int("batch_size", s.GetBatchSize()).
 		Int("buffer_size", s.GetBufferSize()).
@@ -126,8 +208,10 @@ func (s *InfluxDBSink) Start(ctx context.Context) error {
 		<-s.ctx.Done()
 
 		// 刷新所有待处理的写入并关闭客户端
-		s.writeAPI.Flush()
-		s.client.Close()
+		if s.writeAPI != nil {
+			s.writeAPI.Flush()
+			s.client.Close()
+		}
 
 		log.Info().Str("name", s.Name()).Msg("InfluxDB连接器上下文取消")
 	}()
@@ -157,111 +241,23 @@ func (s *InfluxDBSink) Publish(batch []model.Point) error {
 		// 创建上下文
 		ctx := context.Background()
 
-		// 处理每个数据点
-		for _, point := range batch {
-			// 查找数据点配置
-			config, found := s.pointsConfig[point.Key]
-			if !found {
-				// 如果没有特定配置，使用默认值
-				config = PointConfig{
-					Measurement: point.Key,
-					Bucket:      s.defaultBucket,
-					Org:         s.defaultOrg,
-				}
-			}
-
-			// 确定测量名称
-			measurement := config.Measurement
-			if measurement == "" {
-				measurement = point.Key
-			}
-
-			// 确定桶和组织
-			bucket := config.Bucket
-			if bucket == "" {
-				bucket = s.defaultBucket
-			}
-
-			org := config.Org
-			if org == "" {
-				org = s.defaultOrg
-			}
+		var lines strings.Builder
 
-			// 创建InfluxDB数据点
-			p := write.NewPoint(
-				measurement,
-				make(map[string]string),
-				make(map[string]interface{}),
-				time.Now(),
-			)
-
-			// 添加设备ID作为标签
-			p.AddTag("device_id", point.DeviceID)
-
-			// Go 1.24安全：添加所有原始标签
-			pointTags := point.GetTagsSafe()
-			for k, v := range pointTags {
-				// 检查是否应该作为字段而不是标签
-				if contains(config.Fields, k) {
-					p.AddField(k, v)
-				} else {
-					p.AddTag(k, v)
-				}
-			}
-
-			// 添加自定义标签
-			for k, v := range config.Tags {
-				p.AddTag(k, v)
+		// 处理每个数据点
+		for i := range batch {
+			point := &batch[i]
+			p, org, bucket, err := s.buildPoint(point)
+			if err != nil {
+				s.HandleError(err, fmt.Sprintf("转换数据点 %s.%s", point.DeviceID, point.Key))
+				continue
 			}
 
-			// 根据数据类型添加值字段
-			switch point.Type {
-			case model.TypeInt:
-				// 确保整数类型正确
-				var intValue int
-				switch v := point.Value.(type) {
-				case int:
-					intValue = v
-				case float64:
-					intValue = int(v)
-				default:
-					return fmt.Errorf("无法将值转换为整数: %v", point.Value)
-				}
-				p.AddField("value", intValue)
-			case model.TypeFloat:
-				// 确保浮点类型正确
-				var floatValue float64
-				switch v := point.Value.(type) {
-				case float64:
-					floatValue = v
-				case int:
-					floatValue = float64(v)
-				default:
-					return fmt.Errorf("无法将值转换为浮点数: %v", point.Value)
-				}
-				p.AddField("value", floatValue)
-			case model.TypeBool:
-				// 确保布尔类型正确
-				boolValue, ok := point.Value.(bool)
-				if !ok {
-					return fmt.Errorf("无法将值转换为布尔值: %v", point.Value)
-				}
-				p.AddField("value", boolValue)
-			case model.TypeString:
-				// 确保字符串类型正确
-				strValue, ok := point.Value.(string)
-				if !ok {
-					strValue = fmt.Sprintf("%v", point.Value)
-				}
-				p.AddField("value", strValue)
-			default:
-				// 默认作为字符串处理
-				p.AddField("value", fmt.Sprintf("%v", point.Value))
+			// 行协议模式整批发送
+			if s.lineWriter != nil {
+				write.PointToLineProtocolBuffer(p, &lines, s.precision)
+				continue
 			}
 
-			// 添加数据类型作为标签
-			p.AddTag("value_type", string(point.Type))
-
 			// 写入数据点
 			if org != s.defaultOrg || bucket != s.defaultBucket {
 				// 如果桶或组织与默认值不同，使用阻塞写入API
@@ -280,16 +276,161 @@ func (s *InfluxDBSink) Publish(batch []model.Point) error {
 				Str("device_id", point.DeviceID).
 				Interface("value", point.Value).
 				Str("type", string(point.Type)).
-				Str("measurement", measurement).
+				Str("measurement", p.Name()).
 				Str("org", org).
 				Str("bucket", bucket).
 				Msg("发布数据点到InfluxDB")
 		}
 
+		if s.lineWriter != nil && lines.Len() > 0 {
+			if err := s.lineWriter.write(ctx, []byte(lines.String())); err != nil {
+				s.HandleError(err, "InfluxDB行协议写入")
+				return err
+			}
+		}
+
 		return nil
 	}, publishStart)
 }
 
+// buildPoint 将数据点转换为InfluxDB数据点，使用数据点的采集时间
+// 复合数据展开为多个字段（如latitude、longitude、x、y、z、values_0...），标量数据写入value字段
+func (s *InfluxDBSink) buildPoint(point *model.Point) (*write.Point, string, string, error) {
+	// 查找数据点配置
+	config, found := s.pointsConfig[point.Key]
+	if !found {
+		// 如果没有特定配置，使用默认值
+		config = PointConfig{
+			Measurement: point.Key,
+			Bucket:      s.defaultBucket,
+			Org:         s.defaultOrg,
+		}
+	}
+
+	// 确定测量名称
+	measurement := config.Measurement
+	if measurement == "" {
+		measurement = point.Key
+	}
+
+	// 确定桶和组织
+	bucket := config.Bucket
+	if bucket == "" {
+		bucket = s.defaultBucket
+	}
+
+	org := config.Org
+	if org == "" {
+		org = s.defaultOrg
+	}
+
+	ts := point.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	// 创建InfluxDB数据点
+	p := write.NewPoint(
+		measurement,
+		make(map[string]string),
+		make(map[string]interface{}),
+		ts,
+	)
+
+	// 添加设备ID作为标签
+	p.AddTag("device_id", point.DeviceID)
+
+	// Go 1.24安全：添加原始标签，配置了tag_keys时只保留选中的标签
+	pointTags := point.GetTagsSafe()
+	for k, v := range pointTags {
+		// 检查是否应该作为字段而不是标签
+		if contains(config.Fields, k) {
+			p.AddField(k, v)
+		} else if s.tagKeys == nil || s.tagKeys[k] {
+			p.AddTag(k, v)
+		}
+	}
+
+	// 添加自定义标签
+	for k, v := range config.Tags {
+		p.AddTag(k, v)
+	}
+
+	// 质量码
+	switch s.config.Quality {
+	case "tag":
+		p.AddTag("quality", strconv.Itoa(point.Quality))
+	case "field":
+		p.AddField("quality", point.Quality)
+	}
+
+	// 根据数据类型添加值字段
+	if fields, ok := northbound.FlattenComposite(point); ok {
+		for name, v := range fields {
+			if f, ok := v.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+				continue
+			}
+			p.AddField(name, v)
+		}
+	} else {
+		value, err := scalarField(point)
+		if err != nil {
+			return nil, "", "", err
+		}
+		p.AddField("value", value)
+	}
+
+	// 添加数据类型作为标签
+	p.AddTag("value_type", string(point.Type))
+
+	if len(p.FieldList()) == 0 {
+		return nil, "", "", fmt.Errorf("数据点没有可写入的字段")
+	}
+	// 标签排序后写入效率更高，输出也稳定
+	p.SortTags().SortFields()
+	return p, org, bucket, nil
+}
+
+// scalarField 将标量值转换为InfluxDB字段值
+func scalarField(point *model.Point) (interface{}, error) {
+	switch point.Type {
+	case model.TypeInt:
+		// 确保整数类型正确
+		f, ok := northbound.ToFloat64(point.Value)
+		if !ok {
+			return nil, fmt.Errorf("无法将值转换为整数: %v", point.Value)
+		}
+		return int64(f), nil
+	case model.TypeFloat:
+		// 确保浮点类型正确
+		f, ok := northbound.ToFloat64(point.Value)
+		if !ok {
+			return nil, fmt.Errorf("无法将值转换为浮点数: %v", point.Value)
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("InfluxDB不支持的浮点数: %v", f)
+		}
+		return f, nil
+	case model.TypeBool:
+		// 确保布尔类型正确
+		boolValue, ok := point.Value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("无法将值转换为布尔值: %v", point.Value)
+		}
+		return boolValue, nil
+	case model.TypeString:
+		// 确保字符串类型正确
+		strValue, ok := point.Value.(string)
+		if !ok {
+			strValue = fmt.Sprintf("%v", point.Value)
+		}
+		return strValue, nil
+	default:
+		// 默认作为字符串处理
+		return fmt.Sprintf("%v", point.Value), nil
+	}
+}
+
 // Stop 停止连接器
 func (s *InfluxDBSink) Stop() error {
 	s.SetRunning(false)
@@ -308,6 +449,9 @@ func (s *InfluxDBSink) Stop() error {
 	if s.client != nil {
 		s.client.Close()
 	}
+	if s.lineWriter != nil {
+		s.lineWriter.close()
+	}
 
 	log.Info().Str("name", s.Name()).Msg("InfluxDB连接器停止")
 	return nil
@@ -318,6 +462,9 @@ func (s *InfluxDBSink) Healthy() error {
 	if !s.IsRunning() {
 		return fmt.Errorf("InfluxDB连接器未运行")
 	}
+	if s.lineWriter != nil {
+		return s.lineWriter.ping(context.Background())
+	}
 	if s.client == nil {
 		return fmt.Errorf("InfluxDB客户端未初始化")
 	}
@@ -0,0 +1,184 @@
+package influxdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lineWriter 行协议写入器，用于v1、line_http和line_udp模式
+type lineWriter interface {
+	write(ctx context.Context, lines []byte) error
+	ping(ctx context.Context) error
+	close()
+}
+
+// httpLineWriter 通过HTTP POST写入行协议
+type httpLineWriter struct {
+	client   *http.Client
+	writeURL string
+	pingURL  string // 仅v1模式
+	username string
+	password string
+	headers  map[string]string
+}
+
+func newHTTPLineWriter(cfg *InfluxDBConfig, v1Precision string) (*httpLineWriter, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("InfluxDB %s模式需要配置url", cfg.Mode)
+	}
+	w := &httpLineWriter{
+		client:   &http.Client{Timeout: time.Duration(cfg.TimeoutMs) * time.Millisecond},
+		username: cfg.Username,
+		password: cfg.Password,
+		headers:  make(map[string]string, len(cfg.Headers)+1),
+	}
+	for k, v := range cfg.Headers {
+		w.headers[k] = v
+	}
+
+	if cfg.Mode == "v1" {
+		if cfg.Database == "" {
+			return nil, fmt.Errorf("InfluxDB v1模式需要配置database")
+		}
+		base := strings.TrimRight(cfg.URL, "/")
+		query := url.Values{}
+		query.Set("db", cfg.Database)
+		if cfg.RetentionPolicy != "" {
+			query.Set("rp", cfg.RetentionPolicy)
+		}
+		query.Set("precision", v1Precision)
+		w.writeURL = base + "/write?" + query.Encode()
+		w.pingURL = base + "/ping"
+		return w, nil
+	}
+
+	if _, err := url.Parse(cfg.URL); err != nil {
+		return nil, fmt.Errorf("无效的写入地址: %w", err)
+	}
+	w.writeURL = cfg.URL
+	if cfg.Token != "" {
+		if _, ok := w.headers["Authorization"]; !ok {
+			w.headers["Authorization"] = "Token " + cfg.Token
+		}
+	}
+	return w, nil
+}
+
+func (w *httpLineWriter) write(ctx context.Context, lines []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.writeURL, bytes.NewReader(lines))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+	if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("发送行协议失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("写入失败，状态码 %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (w *httpLineWriter) ping(ctx context.Context) error {
+	if w.pingURL == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, w.pingURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("InfluxDB服务器健康检查失败: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("InfluxDB服务器健康检查失败，状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (w *httpLineWriter) close() {
+	w.client.CloseIdleConnections()
+}
+
+// udpLineWriter 通过UDP发送行协议，按行拼包，单包不超过maxPacket字节
+type udpLineWriter struct {
+	mu        sync.Mutex
+	conn      net.Conn
+	maxPacket int
+}
+
+func newUDPLineWriter(address string, maxPacket int) (*udpLineWriter, error) {
+	if address == "" {
+		return nil, fmt.Errorf("InfluxDB line_udp模式需要配置address")
+	}
+	if maxPacket <= 0 {
+		maxPacket = 1400
+	}
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("创建UDP连接失败: %w", err)
+	}
+	return &udpLineWriter{conn: conn, maxPacket: maxPacket}, nil
+}
+
+func (w *udpLineWriter) write(ctx context.Context, lines []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// 按行切分，超过单包大小的行单独发送
+	start := 0
+	end := 0
+	for end < len(lines) {
+		next := bytes.IndexByte(lines[end:], '\n')
+		if next < 0 {
+			next = len(lines)
+		} else {
+			next += end + 1
+		}
+		if next-start > w.maxPacket && end > start {
+			if _, err := w.conn.Write(lines[start:end]); err != nil {
+				return fmt.Errorf("发送UDP数据包失败: %w", err)
+			}
+			start = end
+		}
+		end = next
+	}
+	if end > start {
+		if _, err := w.conn.Write(lines[start:end]); err != nil {
+			return fmt.Errorf("发送UDP数据包失败: %w", err)
+		}
+	}
+	return nil
+}
+
+func (w *udpLineWriter) ping(ctx context.Context) error {
+	return nil
+}
+
+func (w *udpLineWriter) close() {
+	w.conn.Close()
+}
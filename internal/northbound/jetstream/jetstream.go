@@ -9,6 +9,7 @@ import (
 
 	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/codec"
 	"github.com/y001j/iot-gateway/internal/model"
 	"github.com/y001j/iot-gateway/internal/northbound"
 )
@@ -276,16 +277,17 @@ func (s *JetStreamSink) flushLocked() error {
 		return nil
 	}
 
-	// 发布所有数据点到JetStream
+	// 发布所有数据点到JetStream，编码由encoding配置决定，非JSON编码带Content-Type头
+	c := s.Codec()
 	for _, point := range s.buffer {
-		data, err := json.Marshal(point)
+		msg, err := codec.NewMsgWith(c, s.subject, &point)
 		if err != nil {
 			s.HandleError(err, "序列化数据点")
 			continue
 		}
 
 		// 使用JetStream发布
-		_, err = s.js.Publish(s.subject, data)
+		_, err = s.js.PublishMsg(msg)
 		if err != nil {
 			s.HandleError(err, "发布数据点到JetStream")
 			continue
@@ -340,7 +342,7 @@ func (s *JetStreamSink) SubscribeConsumer(consumerName string, deliverSubject st
 	// 订阅消费者的投递主题
 	sub, err := s.conn.Subscribe(deliverSubject, func(msg *nats.Msg) {
 		var point model.Point
-		if err := json.Unmarshal(msg.Data, &point); err != nil {
+		if err := codec.DecodeMsg(msg, &point); err != nil {
 			s.HandleError(err, "解析数据点")
 			// 即使解析失败，也确认消息以避免无限重试
 			msg.Ack()
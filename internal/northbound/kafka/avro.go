@@ -0,0 +1,261 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"github.com/y001j/iot-gateway/internal/model"
+	"github.com/y001j/iot-gateway/internal/northbound"
+)
+
+// avroEncoder 按本地schema文件将数据点编码为Avro
+// schema必须是record，字段按名称从数据点取值:
+//
+//	device_id、key、type: string
+//	timestamp: long（毫秒）或 timestamp-millis/timestamp-micros 逻辑类型
+//	quality: int/long
+//	value: 标量值，复合数据编码为JSON字符串，可以是union
+//	fields: map，复合数据展开后的字段
+//	tags: map<string>
+//
+// 其他字段必须有默认值
+type avroEncoder struct {
+	schema   avro.Schema
+	record   *avro.RecordSchema
+	schemaID int // 大于0时使用Confluent线格式（魔数0 + 4字节schema ID）
+}
+
+// pointFields avro记录可以引用的数据点字段
+var pointFields = map[string]bool{
+	"device_id": true, "key": true, "type": true, "timestamp": true,
+	"quality": true, "value": true, "fields": true, "tags": true,
+}
+
+func newAvroEncoder(schemaFile string, schemaID int) (*avroEncoder, error) {
+	if schemaFile == "" {
+		return nil, fmt.Errorf("avro格式需要配置schema_file")
+	}
+	schema, err := avro.ParseFiles(schemaFile)
+	if err != nil {
+		return nil, fmt.Errorf("解析avro schema失败: %w", err)
+	}
+	record, ok := schema.(*avro.RecordSchema)
+	if !ok {
+		return nil, fmt.Errorf("avro schema必须是record类型，实际为 %s", schema.Type())
+	}
+	for _, f := range record.Fields() {
+		if !pointFields[f.Name()] && !f.HasDefault() {
+			return nil, fmt.Errorf("avro schema字段 %s 无法映射到数据点且没有默认值", f.Name())
+		}
+	}
+	return &avroEncoder{schema: schema, record: record, schemaID: schemaID}, nil
+}
+
+// encode 编码单个数据点
+func (e *avroEncoder) encode(point *model.Point) ([]byte, error) {
+	rec := make(map[string]interface{}, len(e.record.Fields()))
+	for _, f := range e.record.Fields() {
+		src, ok := pointField(point, f.Name())
+		if !ok {
+			continue
+		}
+		v, err := convertAvro(f.Type(), src)
+		if err != nil {
+			return nil, fmt.Errorf("字段 %s: %w", f.Name(), err)
+		}
+		rec[f.Name()] = v
+	}
+
+	data, err := avro.Marshal(e.schema, rec)
+	if err != nil {
+		return nil, err
+	}
+	if e.schemaID <= 0 {
+		return data, nil
+	}
+	out := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(out[1:], uint32(e.schemaID))
+	return append(out, data...), nil
+}
+
+// pointField 取数据点的字段值
+func pointField(point *model.Point, name string) (interface{}, bool) {
+	switch name {
+	case "device_id":
+		return point.DeviceID, true
+	case "key":
+		return point.Key, true
+	case "type":
+		return string(point.Type), true
+	case "timestamp":
+		return point.Timestamp, true
+	case "quality":
+		return point.Quality, true
+	case "tags":
+		return point.GetTagsCopy(), true
+	case "fields":
+		fields, ok := northbound.FlattenComposite(point)
+		if !ok {
+			return map[string]interface{}{}, true
+		}
+		return fields, true
+	case "value":
+		if point.IsComposite() {
+			data, err := json.Marshal(point.Value)
+			if err != nil {
+				return nil, true
+			}
+			return string(data), true
+		}
+		return point.Value, true
+	}
+	return nil, false
+}
+
+// convertAvro 将Go值转换为schema要求的类型
+func convertAvro(schema avro.Schema, v interface{}) (interface{}, error) {
+	switch s := schema.(type) {
+	case *avro.UnionSchema:
+		if v == nil && s.Nullable() {
+			return nil, nil
+		}
+		// 按union中声明的顺序选择第一个能精确表示的类型
+		for _, candidate := range s.Types() {
+			if candidate.Type() == avro.Null {
+				continue
+			}
+			if matchesAvro(candidate, v) {
+				return convertAvro(candidate, v)
+			}
+		}
+		for _, candidate := range s.Types() {
+			if candidate.Type() == avro.Null {
+				continue
+			}
+			if out, err := convertAvro(candidate, v); err == nil {
+				return out, nil
+			}
+		}
+		return nil, fmt.Errorf("值 %v (%T) 不匹配union中的任何类型", v, v)
+	case *avro.MapSchema:
+		out := make(map[string]interface{})
+		switch m := v.(type) {
+		case map[string]string:
+			for k, item := range m {
+				conv, err := convertAvro(s.Values(), item)
+				if err != nil {
+					return nil, err
+				}
+				out[k] = conv
+			}
+		case map[string]interface{}:
+			for k, item := range m {
+				conv, err := convertAvro(s.Values(), item)
+				if err != nil {
+					// 无法表示的字段跳过，如数值map中的字符串字段
+					continue
+				}
+				out[k] = conv
+			}
+		default:
+			return nil, fmt.Errorf("无法将 %T 转换为map", v)
+		}
+		return out, nil
+	case *avro.PrimitiveSchema:
+		return convertPrimitive(s, v)
+	}
+	return nil, fmt.Errorf("不支持的avro类型: %s", schema.Type())
+}
+
+// matchesAvro 判断Go值的类型是否天然对应schema类型
+func matchesAvro(schema avro.Schema, v interface{}) bool {
+	switch schema.Type() {
+	case avro.Boolean:
+		_, ok := v.(bool)
+		return ok
+	case avro.Int, avro.Long:
+		switch v.(type) {
+		case int, int8, int16, int32, int64, uint8, uint16, uint32, time.Time:
+			return true
+		}
+	case avro.Float, avro.Double:
+		switch v.(type) {
+		case float32, float64:
+			return true
+		}
+	case avro.String:
+		_, ok := v.(string)
+		return ok
+	case avro.Map:
+		switch v.(type) {
+		case map[string]string, map[string]interface{}:
+			return true
+		}
+	}
+	return false
+}
+
+func convertPrimitive(s *avro.PrimitiveSchema, v interface{}) (interface{}, error) {
+	var logical avro.LogicalType
+	if s.Logical() != nil {
+		logical = s.Logical().Type()
+	}
+
+	switch s.Type() {
+	case avro.String:
+		switch val := v.(type) {
+		case string:
+			return val, nil
+		case time.Time:
+			return val.Format(time.RFC3339Nano), nil
+		case nil:
+			return "", nil
+		default:
+			return fmt.Sprint(val), nil
+		}
+	case avro.Boolean:
+		switch val := v.(type) {
+		case bool:
+			return val, nil
+		case string:
+			return strconv.ParseBool(val)
+		}
+		if f, ok := northbound.ToFloat64(v); ok {
+			return f != 0, nil
+		}
+	case avro.Int, avro.Long:
+		if t, ok := v.(time.Time); ok {
+			switch logical {
+			case avro.TimestampMillis, avro.TimestampMicros:
+				return t, nil
+			}
+			return t.UnixMilli(), nil
+		}
+		if f, ok := northbound.ToFloat64(v); ok {
+			if s.Type() == avro.Int {
+				return int32(f), nil
+			}
+			return int64(f), nil
+		}
+	case avro.Float:
+		if f, ok := northbound.ToFloat64(v); ok {
+			return float32(f), nil
+		}
+	case avro.Double:
+		if f, ok := northbound.ToFloat64(v); ok {
+			return f, nil
+		}
+	case avro.Bytes:
+		switch val := v.(type) {
+		case []byte:
+			return val, nil
+		case string:
+			return []byte(val), nil
+		}
+	}
+	return nil, fmt.Errorf("无法将 %v (%T) 转换为 %s", v, v, s.Type())
+}
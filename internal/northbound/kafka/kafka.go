@@ -0,0 +1,441 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+	"github.com/y001j/iot-gateway/internal/codec"
+	"github.com/y001j/iot-gateway/internal/config"
+	"github.com/y001j/iot-gateway/internal/model"
+	"github.com/y001j/iot-gateway/internal/northbound"
+)
+
+func init() {
+	// 注册连接器工厂
+	northbound.Register("kafka", func() northbound.Sink {
+		return NewKafkaSink()
+	})
+}
+
+// NewKafkaSink 创建一个新的Kafka连接器
+func NewKafkaSink() *KafkaSink {
+	return &KafkaSink{
+		BaseSink: northbound.NewBaseSink("kafka"),
+	}
+}
+
+// KafkaSink 将数据点发布到Kafka，默认使用幂等生产者和acks=all
+type KafkaSink struct {
+	*northbound.BaseSink
+	config      KafkaConfig
+	opts        []kgo.Opt
+	client      *kgo.Client
+	avro        *avroEncoder
+	enc         codec.Codec
+	contentType string
+	ctx         context.Context
+	cancel      context.CancelFunc
+
+	// 投递报告统计
+	delivered atomic.Int64
+	failed    atomic.Int64
+	inflight  atomic.Int64
+}
+
+// KafkaConfig 是Kafka连接器的特定参数配置
+type KafkaConfig struct {
+	Brokers            []string          `json:"brokers"`              // broker地址列表
+	ClientID           string            `json:"client_id"`            // 客户端ID
+	Topic              string            `json:"topic"`                // topic模板，支持 {device_id} {key} {type} {tag:名称}
+	PartitionKey       string            `json:"partition_key"`        // 分区键模板，默认 {device_id}，同一设备的数据保持顺序
+	Acks               string            `json:"acks"`                 // all leader none，默认all
+	Idempotent         *bool             `json:"idempotent"`           // 幂等生产者，默认开启（要求acks=all）
+	Compression        string            `json:"compression"`          // none gzip snappy lz4 zstd
+	LingerMs           int               `json:"linger_ms"`            // 批次等待时间（毫秒）
+	BatchMaxBytes      int               `json:"batch_max_bytes"`      // 单个分区批次最大字节数
+	MaxBufferedRecords int               `json:"max_buffered_records"` // 最大缓冲记录数，超过时Publish阻塞
+	DeliveryTimeoutMs  int               `json:"delivery_timeout_ms"`  // 投递超时（毫秒），超时记为失败
+	WaitForDelivery    bool              `json:"wait_for_delivery"`    // Publish等待本批次全部确认后返回
+	AutoCreateTopics   bool              `json:"auto_create_topics"`   // 允许broker自动创建topic
+	Format             string            `json:"format"`               // json avro protobuf msgpack cbor，未配置时使用连接器的encoding
+	SchemaFile         string            `json:"schema_file"`          // avro schema文件
+	SchemaID           int               `json:"schema_id"`            // 大于0时使用Confluent线格式
+	Headers            map[string]string `json:"headers"`              // 附加消息头，值支持模板
+	SASL               *SASLConfig       `json:"sasl"`
+	TLS                *config.TLSConfig `json:"tls"`
+}
+
+// SASLConfig SASL认证配置
+type SASLConfig struct {
+	Mechanism string `json:"mechanism"` // PLAIN SCRAM-SHA-256 SCRAM-SHA-512
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+}
+
+// DeliveryStats Kafka投递统计
+type DeliveryStats struct {
+	Delivered int64 `json:"delivered"`
+	Failed    int64 `json:"failed"`
+	Inflight  int64 `json:"inflight"`
+}
+
+// Init 初始化连接器
+func (s *KafkaSink) Init(cfg json.RawMessage) error {
+	// 使用标准化配置解析
+	standardConfig, err := s.ParseStandardConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("解析Kafka sink配置失败: %w", err)
+	}
+
+	// 解析Kafka特定参数
+	config := KafkaConfig{
+		ClientID:           "iot-gateway",
+		Topic:              "iot.data",
+		PartitionKey:       "{device_id}",
+		Acks:               "all",
+		Compression:        "snappy",
+		LingerMs:           10,
+		BatchMaxBytes:      1024 * 1024,
+		MaxBufferedRecords: 10000,
+		DeliveryTimeoutMs:  30000,
+	}
+	if err := json.Unmarshal(standardConfig.Params, &config); err != nil {
+		return fmt.Errorf("解析Kafka特定参数失败: %w", err)
+	}
+	if len(config.Brokers) == 0 {
+		return fmt.Errorf("Kafka连接器需要配置brokers")
+	}
+	if config.Topic == "" {
+		return fmt.Errorf("Kafka连接器需要配置topic")
+	}
+
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(config.Brokers...),
+		kgo.ClientID(config.ClientID),
+		kgo.ProducerLinger(time.Duration(config.LingerMs) * time.Millisecond),
+		// 不使用RecordDeliveryTimeout：它从记录时间戳起算，回放和补发的历史数据会立即超时
+		// 投递超时改由Publish为每条记录设置的上下文控制
+		// 按分区键哈希，与Java客户端的默认分区器兼容
+		kgo.RecordPartitioner(kgo.StickyKeyPartitioner(nil)),
+	}
+	if config.BatchMaxBytes > 0 {
+		opts = append(opts, kgo.ProducerBatchMaxBytes(int32(config.BatchMaxBytes)))
+	}
+	if config.MaxBufferedRecords > 0 {
+		opts = append(opts, kgo.MaxBufferedRecords(config.MaxBufferedRecords))
+	}
+	if config.AutoCreateTopics {
+		opts = append(opts, kgo.AllowAutoTopicCreation())
+	}
+
+	// 幂等生产者要求acks=all，其他确认级别下自动关闭
+	idempotent := config.Idempotent == nil || *config.Idempotent
+	switch strings.ToLower(config.Acks) {
+	case "all", "-1", "":
+		opts = append(opts, kgo.RequiredAcks(kgo.AllISRAcks()))
+	case "leader", "1":
+		if config.Idempotent != nil && *config.Idempotent {
+			return fmt.Errorf("幂等生产者要求acks=all")
+		}
+		idempotent = false
+		opts = append(opts, kgo.RequiredAcks(kgo.LeaderAck()))
+	case "none", "0":
+		if config.Idempotent != nil && *config.Idempotent {
+			return fmt.Errorf("幂等生产者要求acks=all")
+		}
+		idempotent = false
+		opts = append(opts, kgo.RequiredAcks(kgo.NoAck()))
+	default:
+		return fmt.Errorf("不支持的acks配置: %s", config.Acks)
+	}
+	if !idempotent {
+		opts = append(opts, kgo.DisableIdempotentWrite())
+	}
+
+	compression, err := compressionCodec(config.Compression)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, kgo.ProducerBatchCompression(compression))
+
+	if config.SASL != nil {
+		mechanism, err := saslMechanism(config.SASL)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, kgo.SASL(mechanism))
+	}
+	if config.TLS != nil {
+		tlsConfig, err := northbound.BuildTLSConfig(config.TLS)
+		if err != nil {
+			return fmt.Errorf("配置Kafka TLS失败: %w", err)
+		}
+		opts = append(opts, kgo.DialTLSConfig(tlsConfig))
+	}
+
+	switch config.Format {
+	case "avro":
+		if s.avro, err = newAvroEncoder(config.SchemaFile, config.SchemaID); err != nil {
+			return err
+		}
+		s.contentType = "application/avro"
+	case "":
+		s.enc = s.Codec()
+		config.Format = s.enc.Name()
+		s.contentType = s.enc.ContentType()
+	default:
+		if s.enc, err = codec.Get(config.Format); err != nil {
+			return fmt.Errorf("不支持的Kafka消息格式: %s", config.Format)
+		}
+		s.contentType = s.enc.ContentType()
+	}
+
+	s.config = config
+	s.opts = opts
+
+	log.Info().
+		Str("name", s.Name()).
+		Strs("brokers", config.Brokers).
+		Str("topic", config.Topic).
+		Str("partition_key", config.PartitionKey).
+		Str("acks", config.Acks).
+		Bool("idempotent", idempotent).
+		Str("compression", config.Compression).
+		Str("format", config.Format).
+		Bool("sasl", config.SASL != nil).
+		Bool("tls", config.TLS != nil).
+		Msg("Kafka连接器初始化完成")
+
+	return nil
+}
+
+// compressionCodec 解析压缩算法
+func compressionCodec(name string) (kgo.CompressionCodec, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return kgo.NoCompression(), nil
+	case "gzip":
+		return kgo.GzipCompression(), nil
+	case "snappy":
+		return kgo.SnappyCompression(), nil
+	case "lz4":
+		return kgo.Lz4Compression(), nil
+	case "zstd":
+		return kgo.ZstdCompression(), nil
+	default:
+		return kgo.CompressionCodec{}, fmt.Errorf("不支持的压缩算法: %s", name)
+	}
+}
+
+// saslMechanism 创建SASL认证机制
+func saslMechanism(cfg *SASLConfig) (sasl.Mechanism, error) {
+	switch strings.ToUpper(cfg.Mechanism) {
+	case "", "PLAIN":
+		return plain.Auth{User: cfg.Username, Pass: cfg.Password}.AsMechanism(), nil
+	case "SCRAM-SHA-256":
+		return scram.Auth{User: cfg.Username, Pass: cfg.Password}.AsSha256Mechanism(), nil
+	case "SCRAM-SHA-512":
+		return scram.Auth{User: cfg.Username, Pass: cfg.Password}.AsSha512Mechanism(), nil
+	default:
+		return nil, fmt.Errorf("不支持的SASL机制: %s", cfg.Mechanism)
+	}
+}
+
+// Start 启动连接器
+func (s *KafkaSink) Start(ctx context.Context) error {
+	client, err := kgo.NewClient(s.opts...)
+	if err != nil {
+		s.HandleError(err, "创建Kafka客户端")
+		return fmt.Errorf("创建Kafka客户端失败: %w", err)
+	}
+	s.client = client
+	// 记录的生命周期不跟随外部上下文，停止时先刷新缓冲再取消
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.SetRunning(true)
+
+	// broker不可达时客户端会自动重试，这里只记录警告
+	pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx); err != nil {
+		log.Warn().Err(err).Str("name", s.Name()).Msg("Kafka broker暂不可达，将在发布时重试")
+	}
+
+	// 监听上下文取消
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Stop()
+		case <-s.ctx.Done():
+		}
+	}()
+
+	log.Info().Str("name", s.Name()).Strs("brokers", s.config.Brokers).Msg("Kafka连接器启动")
+	return nil
+}
+
+// Publish 将数据点编码为Kafka记录并异步发送，投递结果通过回调计入统计
+func (s *KafkaSink) Publish(batch []model.Point) error {
+	if !s.IsRunning() {
+		return fmt.Errorf("Kafka连接器未启动")
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	// 记录发布操作开始时间
+	publishStart := time.Now()
+
+	// 使用BaseSink的SafePublishBatch方法，自动处理统计
+	return s.SafePublishBatch(batch, func(batch []model.Point) error {
+		// 使用基础方法添加标签
+		s.AddTags(batch)
+
+		var wg sync.WaitGroup
+		var firstErr error
+		var errMu sync.Mutex
+
+		for i := range batch {
+			record, err := s.buildRecord(&batch[i])
+			if err != nil {
+				s.HandleError(err, fmt.Sprintf("编码数据点 %s.%s", batch[i].DeviceID, batch[i].Key))
+				continue
+			}
+
+			s.inflight.Add(1)
+			if s.config.WaitForDelivery {
+				wg.Add(1)
+			}
+			ctx, cancel := s.ctx, context.CancelFunc(func() {})
+			if s.config.DeliveryTimeoutMs > 0 {
+				ctx, cancel = context.WithTimeout(s.ctx, time.Duration(s.config.DeliveryTimeoutMs)*time.Millisecond)
+			}
+			s.client.Produce(ctx, record, func(r *kgo.Record, err error) {
+				cancel()
+				s.onDelivery(r, err)
+				if s.config.WaitForDelivery {
+					if err != nil {
+						errMu.Lock()
+						if firstErr == nil {
+							firstErr = err
+						}
+						errMu.Unlock()
+					}
+					wg.Done()
+				}
+			})
+		}
+
+		if s.config.WaitForDelivery {
+			wg.Wait()
+			return firstErr
+		}
+		return nil
+	}, publishStart)
+}
+
+// buildRecord 根据模板生成topic、分区键和消息头，并编码消息体
+func (s *KafkaSink) buildRecord(point *model.Point) (*kgo.Record, error) {
+	var value []byte
+	var err error
+	if s.avro != nil {
+		value, err = s.avro.encode(point)
+	} else {
+		value, err = s.enc.Marshal(point)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	record := &kgo.Record{
+		Topic:     northbound.FormatPointTemplate(s.config.Topic, point),
+		Value:     value,
+		Timestamp: point.Timestamp,
+		Headers: []kgo.RecordHeader{
+			{Key: "content-type", Value: []byte(s.contentType)},
+			{Key: "device_id", Value: []byte(point.DeviceID)},
+			{Key: "key", Value: []byte(point.Key)},
+		},
+	}
+	if s.config.PartitionKey != "" {
+		record.Key = []byte(northbound.FormatPointTemplate(s.config.PartitionKey, point))
+	}
+	for name, tpl := range s.config.Headers {
+		record.Headers = append(record.Headers, kgo.RecordHeader{
+			Key:   name,
+			Value: []byte(northbound.FormatPointTemplate(tpl, point)),
+		})
+	}
+	return record, nil
+}
+
+// onDelivery 投递报告回调，失败计入BaseSink错误统计
+func (s *KafkaSink) onDelivery(r *kgo.Record, err error) {
+	s.inflight.Add(-1)
+	if err != nil {
+		s.failed.Add(1)
+		s.HandleError(err, fmt.Sprintf("投递到topic %s", r.Topic))
+		return
+	}
+	s.delivered.Add(1)
+}
+
+// DeliveryStats 返回投递统计
+func (s *KafkaSink) DeliveryStats() DeliveryStats {
+	return DeliveryStats{
+		Delivered: s.delivered.Load(),
+		Failed:    s.failed.Load(),
+		Inflight:  s.inflight.Load(),
+	}
+}
+
+// Stop 停止连接器，等待缓冲中的记录投递完成
+func (s *KafkaSink) Stop() error {
+	if !s.IsRunning() {
+		return nil
+	}
+	s.SetRunning(false)
+
+	if s.client != nil {
+		flushCtx, cancel := context.WithTimeout(context.Background(), time.Duration(s.config.DeliveryTimeoutMs)*time.Millisecond)
+		if err := s.client.Flush(flushCtx); err != nil {
+			s.HandleError(err, "停止时刷新Kafka缓冲")
+		}
+		cancel()
+		s.client.Close()
+	}
+	if s.cancel != nil {
+		s.cancel()
+	}
+
+	stats := s.DeliveryStats()
+	log.Info().
+		Str("name", s.Name()).
+		Int64("delivered", stats.Delivered).
+		Int64("failed", stats.Failed).
+		Msg("Kafka连接器停止")
+	return nil
+}
+
+// Healthy 检查连接器健康状态
+func (s *KafkaSink) Healthy() error {
+	if !s.IsRunning() {
+		return fmt.Errorf("Kafka连接器未运行")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := s.client.Ping(ctx); err != nil {
+		return fmt.Errorf("Kafka broker不可达: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/y001j/iot-gateway/internal/model"
+)
+
+const testPartitions = 4
+
+// newTestCluster 启动进程内的Kafka协议实现，预建指定topic
+func newTestCluster(t *testing.T, topics ...string) *kfake.Cluster {
+	t.Helper()
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(testPartitions, topics...))
+	if err != nil {
+		t.Fatalf("启动kfake失败: %v", err)
+	}
+	t.Cleanup(cluster.Close)
+	return cluster
+}
+
+// startTestSink 按params初始化并启动Kafka连接器
+func startTestSink(t *testing.T, cluster *kfake.Cluster, params map[string]interface{}) *KafkaSink {
+	t.Helper()
+	params["brokers"] = cluster.ListenAddrs()
+	params["wait_for_delivery"] = true
+	cfg, _ := json.Marshal(map[string]interface{}{"name": "kafka_test", "type": "kafka", "params": params})
+
+	sink := NewKafkaSink()
+	if err := sink.Init(cfg); err != nil {
+		t.Fatalf("初始化失败: %v", err)
+	}
+	if err := sink.Start(context.Background()); err != nil {
+		t.Fatalf("启动失败: %v", err)
+	}
+	t.Cleanup(func() { sink.Stop() })
+	return sink
+}
+
+// consumeAll 从头消费topic，直到收到n条记录
+func consumeAll(t *testing.T, cluster *kfake.Cluster, topic string, n int) []*kgo.Record {
+	t.Helper()
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(cluster.ListenAddrs()...),
+		kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var records []*kgo.Record
+	for len(records) < n {
+		fetches := client.PollFetches(ctx)
+		if err := ctx.Err(); err != nil {
+			t.Fatalf("只收到 %d/%d 条记录", len(records), n)
+		}
+		fetches.EachError(func(topic string, partition int32, err error) {
+			t.Fatalf("消费 %s/%d 失败: %v", topic, partition, err)
+		})
+		records = append(records, fetches.Records()...)
+	}
+	return records
+}
+
+func header(r *kgo.Record, key string) string {
+	for _, h := range r.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func TestProduceKeyPartitioning(t *testing.T) {
+	cluster := newTestCluster(t, "iot.data")
+	sink := startTestSink(t, cluster, map[string]interface{}{
+		"topic":   "iot.data",
+		"headers": map[string]string{"site": "{tag:site}"},
+	})
+
+	const devices, perDevice = 8, 5
+	var batch []model.Point
+	for i := 0; i < perDevice; i++ {
+		for d := 0; d < devices; d++ {
+			p := model.NewPoint("temperature", fmt.Sprintf("sensor-%02d", d), float64(i), model.TypeFloat)
+			p.AddTag("site", "plant-1")
+			batch = append(batch, p)
+		}
+	}
+	if err := sink.Publish(batch); err != nil {
+		t.Fatalf("发布失败: %v", err)
+	}
+	if stats := sink.DeliveryStats(); stats.Delivered != int64(len(batch)) || stats.Failed != 0 {
+		t.Fatalf("投递统计 %+v，期望 %d 条成功", stats, len(batch))
+	}
+
+	records := consumeAll(t, cluster, "iot.data", len(batch))
+
+	// 同一设备落在同一分区且保持顺序，分区与Java客户端默认分区器的murmur2哈希一致
+	partitioner := kgo.StickyKeyPartitioner(nil).ForTopic("iot.data")
+	partitionOf := make(map[string]int32)
+	next := make(map[string]float64)
+	used := make(map[int32]bool)
+	for _, r := range records {
+		device := string(r.Key)
+		if got := header(r, "device_id"); got != device {
+			t.Fatalf("分区键 %q 与device_id消息头 %q 不一致", device, got)
+		}
+		if want := int32(partitioner.Partition(r, testPartitions)); r.Partition != want {
+			t.Fatalf("设备 %s 写入分区 %d，期望 %d", device, r.Partition, want)
+		}
+		if p, ok := partitionOf[device]; ok && p != r.Partition {
+			t.Fatalf("设备 %s 分布在分区 %d 和 %d", device, p, r.Partition)
+		}
+		partitionOf[device] = r.Partition
+		used[r.Partition] = true
+
+		if ct := header(r, "content-type"); ct != "application/json" {
+			t.Fatalf("content-type = %q", ct)
+		}
+		if site := header(r, "site"); site != "plant-1" {
+			t.Fatalf("模板消息头 site = %q", site)
+		}
+		var decoded struct {
+			DeviceID string  `json:"device_id"`
+			Value    float64 `json:"value"`
+		}
+		if err := json.Unmarshal(r.Value, &decoded); err != nil {
+			t.Fatalf("解码JSON消息失败: %v", err)
+		}
+		if decoded.DeviceID != device || decoded.Value != next[device] {
+			t.Fatalf("设备 %s 收到值 %v，期望 %v（顺序错乱）", device, decoded.Value, next[device])
+		}
+		next[device]++
+	}
+	if len(partitionOf) != devices {
+		t.Fatalf("收到 %d 个设备的数据，期望 %d", len(partitionOf), devices)
+	}
+	if len(used) < 2 {
+		t.Fatalf("%d 个设备全部写入同一个分区", devices)
+	}
+}
+
+func TestProduceAvro(t *testing.T) {
+	const schemaFile = "../../../configs/examples/kafka_point.avsc"
+	cluster := newTestCluster(t, "iot.avro")
+	sink := startTestSink(t, cluster, map[string]interface{}{
+		"topic":       "iot.avro",
+		"format":      "avro",
+		"schema_file": schemaFile,
+		"schema_id":   42,
+	})
+
+	ts := time.UnixMilli(1700000000123)
+	p := model.NewPoint("pressure", "boiler-1", 1.25, model.TypeFloat)
+	p.Timestamp = ts
+	p.AddTag("line", "A")
+	if err := sink.Publish([]model.Point{p}); err != nil {
+		t.Fatalf("发布失败: %v", err)
+	}
+
+	records := consumeAll(t, cluster, "iot.avro", 1)
+	r := records[0]
+	if ct := header(r, "content-type"); ct != "application/avro" {
+		t.Fatalf("content-type = %q", ct)
+	}
+
+	// Confluent线格式：魔数0 + 大端schema ID
+	if len(r.Value) < 5 || r.Value[0] != 0 || binary.BigEndian.Uint32(r.Value[1:5]) != 42 {
+		t.Fatalf("消息不是schema ID为42的Confluent线格式: % x", r.Value[:min(5, len(r.Value))])
+	}
+	schema, err := avro.ParseFiles(schemaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := avro.Unmarshal(schema, r.Value[5:], &decoded); err != nil {
+		t.Fatalf("按schema解码失败: %v", err)
+	}
+	if decoded["device_id"] != "boiler-1" || decoded["key"] != "pressure" {
+		t.Fatalf("device_id/key = %v/%v", decoded["device_id"], decoded["key"])
+	}
+	if got, ok := decoded["timestamp"].(time.Time); !ok || !got.Equal(ts) {
+		t.Fatalf("timestamp = %v，期望 %v", decoded["timestamp"], ts)
+	}
+	if decoded["value"] != 1.25 {
+		t.Fatalf("value = %#v", decoded["value"])
+	}
+	if tags, _ := decoded["tags"].(map[string]interface{}); tags["line"] != "A" {
+		t.Fatalf("tags = %v", decoded["tags"])
+	}
+}
@@ -0,0 +1,263 @@
+package modbus_server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/y001j/iot-gateway/internal/model"
+	"github.com/y001j/iot-gateway/internal/northbound"
+)
+
+// math.MaxInt64和math.MaxUint64转换为float64时舍入为2^63和2^64，再转回整数会溢出，
+// 限幅使用小于上限的最大float64
+const (
+	maxInt64Float  = 1<<63 - 1024
+	maxUint64Float = 1<<64 - 2048
+)
+
+// 寄存器表
+const (
+	tableCoil     = "coil"
+	tableDiscrete = "discrete_input"
+	tableHolding  = "holding"
+	tableInput    = "input"
+)
+
+// mapping 已校验的寄存器映射
+type mapping struct {
+	RegisterMapping
+	quantity  uint16 // 占用的寄存器数（线圈表为位数）
+	swapBytes bool   // 字内字节交换
+	swapWords bool   // 字交换
+}
+
+// newMapping 校验映射并计算寄存器占用
+func newMapping(cfg RegisterMapping, defaultOrder string) (*mapping, error) {
+	if cfg.DeviceID == "" || cfg.Key == "" {
+		return nil, fmt.Errorf("映射必须指定device_id和key")
+	}
+
+	m := &mapping{RegisterMapping: cfg}
+	if m.Table == "" {
+		m.Table = tableHolding
+	}
+	if m.Scale == 0 {
+		m.Scale = 1
+	}
+
+	switch m.Table {
+	case tableCoil, tableDiscrete:
+		if m.DataType != "" && m.DataType != "bool" {
+			return nil, fmt.Errorf("%s表只支持bool类型: %s.%s", m.Table, m.DeviceID, m.Key)
+		}
+		m.DataType = "bool"
+		m.quantity = 1
+		return m, nil
+	case tableHolding, tableInput:
+	default:
+		return nil, fmt.Errorf("不支持的寄存器表: %s", m.Table)
+	}
+
+	if m.DataType == "" {
+		m.DataType = "float32"
+	}
+	switch m.DataType {
+	case "bool", "int16", "uint16":
+		m.quantity = 1
+	case "int32", "uint32", "float32":
+		m.quantity = 2
+	case "int64", "uint64", "float64":
+		m.quantity = 4
+	case "string":
+		if m.Length <= 0 {
+			return nil, fmt.Errorf("string类型必须指定length: %s.%s", m.DeviceID, m.Key)
+		}
+		m.quantity = uint16(m.Length)
+	default:
+		return nil, fmt.Errorf("不支持的数据类型: %s", m.DataType)
+	}
+
+	order := strings.ToUpper(m.ByteOrder)
+	if order == "" {
+		order = strings.ToUpper(defaultOrder)
+	}
+	switch order {
+	case "", "ABCD":
+	case "CDAB":
+		m.swapWords = true
+	case "BADC":
+		m.swapBytes = true
+	case "DCBA":
+		m.swapWords, m.swapBytes = true, true
+	default:
+		return nil, fmt.Errorf("不支持的字节序: %s", m.ByteOrder)
+	}
+	// 字符串按字符顺序占用寄存器，字序只用于多寄存器数值
+	if m.DataType == "string" {
+		m.swapWords = false
+	}
+
+	return m, nil
+}
+
+// end 映射占用的最后一个地址之后的地址
+func (m *mapping) end() int {
+	return int(m.Address) + int(m.quantity)
+}
+
+// overlaps 判断映射是否与区间[start, start+count)重叠
+func (m *mapping) overlaps(start, count int) bool {
+	return int(m.Address) < start+count && start < m.end()
+}
+
+// extractValue 获取数据点中映射对应的值，复合数据通过field选择字段
+func (m *mapping) extractValue(point model.Point) (interface{}, error) {
+	if m.Field == "" {
+		return point.Value, nil
+	}
+
+	data, err := json.Marshal(point.Value)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("数据点不是复合类型，无法选择字段 %s", m.Field)
+	}
+	value, ok := fields[m.Field]
+	if !ok {
+		return nil, fmt.Errorf("复合数据中不存在字段 %s", m.Field)
+	}
+	return value, nil
+}
+
+// encodeRegisters 将值编码为寄存器
+func (m *mapping) encodeRegisters(value interface{}) ([]uint16, error) {
+	if m.DataType == "string" {
+		raw := make([]byte, int(m.quantity)*2)
+		copy(raw, fmt.Sprintf("%v", value))
+		return m.bytesToRegisters(raw), nil
+	}
+
+	f, ok := northbound.ToFloat64(value)
+	if !ok {
+		return nil, fmt.Errorf("无法将 %T 转换为数值", value)
+	}
+	raw := (f - m.Offset) / m.Scale
+
+	buf := make([]byte, int(m.quantity)*2)
+	switch m.DataType {
+	case "bool":
+		if raw != 0 {
+			binary.BigEndian.PutUint16(buf, 1)
+		}
+	case "int16":
+		binary.BigEndian.PutUint16(buf, uint16(int16(clamp(math.Round(raw), math.MinInt16, math.MaxInt16))))
+	case "uint16":
+		binary.BigEndian.PutUint16(buf, uint16(clamp(math.Round(raw), 0, math.MaxUint16)))
+	case "int32":
+		binary.BigEndian.PutUint32(buf, uint32(int32(clamp(math.Round(raw), math.MinInt32, math.MaxInt32))))
+	case "uint32":
+		binary.BigEndian.PutUint32(buf, uint32(clamp(math.Round(raw), 0, math.MaxUint32)))
+	case "float32":
+		binary.BigEndian.PutUint32(buf, math.Float32bits(float32(raw)))
+	case "int64":
+		binary.BigEndian.PutUint64(buf, uint64(int64(clamp(math.Round(raw), math.MinInt64, maxInt64Float))))
+	case "uint64":
+		binary.BigEndian.PutUint64(buf, uint64(clamp(math.Round(raw), 0, maxUint64Float)))
+	case "float64":
+		binary.BigEndian.PutUint64(buf, math.Float64bits(raw))
+	}
+	return m.bytesToRegisters(buf), nil
+}
+
+// decodeRegisters 将寄存器解码为工程值
+func (m *mapping) decodeRegisters(regs []uint16) (interface{}, model.DataType) {
+	buf := m.registersToBytes(regs)
+
+	var raw float64
+	switch m.DataType {
+	case "string":
+		return strings.TrimRight(string(buf), "\x00 "), model.TypeString
+	case "bool":
+		return binary.BigEndian.Uint16(buf) != 0, model.TypeBool
+	case "int16":
+		raw = float64(int16(binary.BigEndian.Uint16(buf)))
+	case "uint16":
+		raw = float64(binary.BigEndian.Uint16(buf))
+	case "int32":
+		raw = float64(int32(binary.BigEndian.Uint32(buf)))
+	case "uint32":
+		raw = float64(binary.BigEndian.Uint32(buf))
+	case "float32":
+		raw = float64(math.Float32frombits(binary.BigEndian.Uint32(buf)))
+	case "int64":
+		raw = float64(int64(binary.BigEndian.Uint64(buf)))
+	case "uint64":
+		raw = float64(binary.BigEndian.Uint64(buf))
+	case "float64":
+		raw = math.Float64frombits(binary.BigEndian.Uint64(buf))
+	}
+
+	value := raw*m.Scale + m.Offset
+	if m.Scale == 1 && m.Offset == 0 && m.DataType != "float32" && m.DataType != "float64" {
+		return int64(value), model.TypeInt
+	}
+	return value, model.TypeFloat
+}
+
+// bytesToRegisters 按配置的字节序将大端字节转换为寄存器
+func (m *mapping) bytesToRegisters(buf []byte) []uint16 {
+	regs := make([]uint16, len(buf)/2)
+	for i := range regs {
+		hi, lo := buf[2*i], buf[2*i+1]
+		if m.swapBytes {
+			hi, lo = lo, hi
+		}
+		regs[i] = uint16(hi)<<8 | uint16(lo)
+	}
+	if m.swapWords {
+		reverseWords(regs)
+	}
+	return regs
+}
+
+// registersToBytes bytesToRegisters的逆操作
+func (m *mapping) registersToBytes(regs []uint16) []byte {
+	words := append([]uint16(nil), regs...)
+	if m.swapWords {
+		reverseWords(words)
+	}
+	buf := make([]byte, len(words)*2)
+	for i, w := range words {
+		hi, lo := byte(w>>8), byte(w)
+		if m.swapBytes {
+			hi, lo = lo, hi
+		}
+		buf[2*i], buf[2*i+1] = hi, lo
+	}
+	return buf
+}
+
+func reverseWords(words []uint16) {
+	for i, j := 0, len(words)-1; i < j; i, j = i+1, j-1 {
+		words[i], words[j] = words[j], words[i]
+	}
+}
+
+// clamp 把v限制在[min, max]内，NaN视为0
+func clamp(v, min, max float64) float64 {
+	if math.IsNaN(v) {
+		return 0
+	}
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
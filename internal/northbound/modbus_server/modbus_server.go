@@ -0,0 +1,370 @@
+package modbus_server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/model"
+	"github.com/y001j/iot-gateway/internal/northbound"
+)
+
+func init() {
+	// 注册连接器工厂
+	northbound.Register("modbus_server", func() northbound.Sink {
+		return NewModbusServerSink()
+	})
+}
+
+// NewModbusServerSink 创建一个新的Modbus TCP服务端连接器
+func NewModbusServerSink() *ModbusServerSink {
+	return &ModbusServerSink{
+		BaseSink: northbound.NewBaseSink("modbus_server"),
+		conns:    make(map[net.Conn]struct{}),
+	}
+}
+
+// ModbusServerSink 以Modbus TCP从站的形式向SCADA等主站暴露网关数据
+type ModbusServerSink struct {
+	*northbound.BaseSink
+	config      ModbusServerConfig
+	store       *registerStore
+	mappings    map[string][]*mapping // device_id|key -> 映射
+	tables      map[string][]*mapping // 寄存器表 -> 按地址排序的映射
+	idleTimeout time.Duration
+	natsConn    *nats.Conn
+	listener    net.Listener
+	conns       map[net.Conn]struct{}
+	connMu      sync.Mutex
+	wg          sync.WaitGroup
+}
+
+// ModbusServerConfig 是Modbus TCP服务端连接器的特定参数配置
+type ModbusServerConfig struct {
+	Listen         string            `json:"listen"`           // 监听地址，默认 :5020
+	UnitID         uint8             `json:"unit_id"`          // 从站地址，0表示响应任意地址
+	MaxConnections int               `json:"max_connections"`  // 最大主站连接数
+	IdleTimeout    int               `json:"idle_timeout_sec"` // 空闲超时（秒），0表示不超时
+	ByteOrder      string            `json:"byte_order"`       // 默认字节序: ABCD CDAB BADC DCBA
+	Coils          int               `json:"coils"`            // 线圈数量
+	DiscreteInputs int               `json:"discrete_inputs"`  // 离散输入数量
+	Holding        int               `json:"holding_registers"`
+	Input          int               `json:"input_registers"`
+	Mappings       []RegisterMapping `json:"mappings"`
+	ForwardWrites  bool              `json:"forward_writes"`  // 主站写入时转发为NATS命令
+	CommandSubject string            `json:"command_subject"` // 命令主题模板，支持 {device_id} 和 {key}
+	AllowUnmapped  bool              `json:"allow_unmapped_writes"`
+}
+
+// RegisterMapping 定义数据点到寄存器的映射
+type RegisterMapping struct {
+	DeviceID  string  `json:"device_id"`
+	Key       string  `json:"key"`
+	Field     string  `json:"field,omitempty"`      // 复合数据字段，如 latitude、x
+	Table     string  `json:"table"`                // coil discrete_input holding input
+	Address   uint16  `json:"address"`              // 起始地址（从0开始）
+	DataType  string  `json:"data_type"`            // bool int16 uint16 int32 uint32 float32 int64 uint64 float64 string
+	Length    int     `json:"length,omitempty"`     // string类型占用的寄存器数
+	ByteOrder string  `json:"byte_order,omitempty"` // 覆盖默认字节序
+	Scale     float64 `json:"scale,omitempty"`      // 工程值 = 原始值*scale + offset
+	Offset    float64 `json:"offset,omitempty"`
+	Writable  bool    `json:"writable,omitempty"` // 是否允许主站写入
+}
+
+// Init 初始化连接器
+func (s *ModbusServerSink) Init(cfg json.RawMessage) error {
+	// 使用标准化配置解析
+	standardConfig, err := s.ParseStandardConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("解析Modbus服务端sink配置失败: %w", err)
+	}
+
+	// 解析Modbus服务端特定参数
+	config := ModbusServerConfig{
+		Listen:         ":5020",
+		MaxConnections: 16,
+		IdleTimeout:    300,
+		Coils:          10000,
+		DiscreteInputs: 10000,
+		Holding:        10000,
+		Input:          10000,
+		CommandSubject: northbound.DefaultCommandSubject,
+	}
+	if err := json.Unmarshal(standardConfig.Params, &config); err != nil {
+		return fmt.Errorf("解析Modbus服务端特定参数失败: %w", err)
+	}
+	if config.MaxConnections <= 0 {
+		config.MaxConnections = 16
+	}
+	for _, size := range []int{config.Coils, config.DiscreteInputs, config.Holding, config.Input} {
+		if size < 0 || size > 65536 {
+			return fmt.Errorf("寄存器表大小必须在0到65536之间: %d", size)
+		}
+	}
+
+	s.config = config
+	s.idleTimeout = time.Duration(config.IdleTimeout) * time.Second
+	s.store = newRegisterStore(config.Coils, config.DiscreteInputs, config.Holding, config.Input)
+	s.mappings = make(map[string][]*mapping)
+	s.tables = make(map[string][]*mapping)
+
+	for _, mc := range config.Mappings {
+		m, err := newMapping(mc, config.ByteOrder)
+		if err != nil {
+			return err
+		}
+		if m.end() > s.store.size(m.Table) {
+			return fmt.Errorf("映射 %s.%s 超出%s表范围", m.DeviceID, m.Key, m.Table)
+		}
+		for _, other := range s.tables[m.Table] {
+			if other.overlaps(int(m.Address), int(m.quantity)) {
+				return fmt.Errorf("映射 %s.%s 与 %s.%s 地址重叠", m.DeviceID, m.Key, other.DeviceID, other.Key)
+			}
+		}
+		if m.Writable && (m.Table == tableInput || m.Table == tableDiscrete) {
+			return fmt.Errorf("映射 %s.%s 位于只读的%s表，不能设置writable", m.DeviceID, m.Key, m.Table)
+		}
+
+		id := m.DeviceID + "|" + m.Key
+		s.mappings[id] = append(s.mappings[id], m)
+		s.tables[m.Table] = append(s.tables[m.Table], m)
+	}
+	for _, list := range s.tables {
+		sort.Slice(list, func(i, j int) bool { return list[i].Address < list[j].Address })
+	}
+
+	log.Info().
+		Str("name", s.Name()).
+		Str("listen", config.Listen).
+		Uint8("unit_id", config.UnitID).
+		Int("mappings", len(config.Mappings)).
+		Bool("forward_writes", config.ForwardWrites).
+		Msg("Modbus服务端连接器初始化完成")
+
+	return nil
+}
+
+// SetNATSConnection 设置NATS连接，用于转发主站写入命令
+func (s *ModbusServerSink) SetNATSConnection(conn *nats.Conn) {
+	s.natsConn = conn
+}
+
+// Start 启动连接器
+func (s *ModbusServerSink) Start(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.config.Listen)
+	if err != nil {
+		s.HandleError(err, "启动Modbus TCP服务端")
+		return fmt.Errorf("监听 %s 失败: %w", s.config.Listen, err)
+	}
+	s.listener = ln
+	s.SetRunning(true)
+
+	s.wg.Add(1)
+	go s.serve(ln)
+
+	// 监听上下文取消
+	go func() {
+		<-ctx.Done()
+		s.Stop()
+	}()
+
+	log.Info().Str("name", s.Name()).Str("listen", ln.Addr().String()).Msg("Modbus服务端连接器启动")
+	return nil
+}
+
+// Publish 将数据点写入寄存器表，主站读取时获得最新值
+func (s *ModbusServerSink) Publish(batch []model.Point) error {
+	if !s.IsRunning() {
+		return fmt.Errorf("Modbus服务端连接器未启动")
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	// 记录发布操作开始时间
+	publishStart := time.Now()
+
+	// 使用BaseSink的SafePublishBatch方法，自动处理统计
+	return s.SafePublishBatch(batch, func(batch []model.Point) error {
+		for _, point := range batch {
+			for _, m := range s.mappings[point.DeviceID+"|"+point.Key] {
+				if err := s.updateMapping(m, point); err != nil {
+					s.HandleError(err, fmt.Sprintf("更新寄存器 %s.%s", point.DeviceID, point.Key))
+				}
+			}
+		}
+		return nil
+	}, publishStart)
+}
+
+// updateMapping 将数据点值编码到映射的寄存器
+func (s *ModbusServerSink) updateMapping(m *mapping, point model.Point) error {
+	value, err := m.extractValue(point)
+	if err != nil {
+		return err
+	}
+
+	if m.Table == tableCoil || m.Table == tableDiscrete {
+		f, ok := northbound.ToFloat64(value)
+		if !ok {
+			return fmt.Errorf("无法将 %T 转换为开关量", value)
+		}
+		err = s.store.setBits(m.Table, int(m.Address), []bool{f != 0})
+	} else {
+		var regs []uint16
+		if regs, err = m.encodeRegisters(value); err == nil {
+			err = s.store.setRegisters(m.Table, int(m.Address), regs)
+		}
+	}
+	return err
+}
+
+// writeBits 处理主站对线圈的写入
+func (s *ModbusServerSink) writeBits(start int, values []bool) error {
+	affected, err := s.checkWritable(tableCoil, start, len(values))
+	if err != nil {
+		return err
+	}
+	if err := s.store.setBits(tableCoil, start, values); err != nil {
+		return err
+	}
+	s.forwardWrites(affected)
+	return nil
+}
+
+// writeRegisters 处理主站对保持寄存器的写入
+func (s *ModbusServerSink) writeRegisters(start int, values []uint16) error {
+	affected, err := s.checkWritable(tableHolding, start, len(values))
+	if err != nil {
+		return err
+	}
+	if err := s.store.setRegisters(tableHolding, start, values); err != nil {
+		return err
+	}
+	s.forwardWrites(affected)
+	return nil
+}
+
+// checkWritable 检查写入区间，返回受影响的映射；写入必须完整覆盖每个重叠的映射
+func (s *ModbusServerSink) checkWritable(table string, start, count int) ([]*mapping, error) {
+	if start+count > s.store.size(table) {
+		return nil, modbusError(exIllegalDataAddress)
+	}
+
+	var affected []*mapping
+	covered := 0
+	for _, m := range s.tables[table] {
+		if !m.overlaps(start, count) {
+			continue
+		}
+		if !m.Writable {
+			return nil, modbusError(exIllegalDataAddress)
+		}
+		// 多寄存器映射只写入一部分时，解码结果混合新旧寄存器，拒绝写入
+		if int(m.Address) < start || m.end() > start+count {
+			return nil, modbusError(exIllegalDataAddress)
+		}
+		affected = append(affected, m)
+		covered += int(m.quantity)
+	}
+
+	if covered < count && !s.config.AllowUnmapped {
+		return nil, modbusError(exIllegalDataAddress)
+	}
+	return affected, nil
+}
+
+// forwardWrites 将主站写入的映射值转发为NATS命令
+func (s *ModbusServerSink) forwardWrites(affected []*mapping) {
+	if !s.config.ForwardWrites || len(affected) == 0 {
+		return
+	}
+
+	for _, m := range affected {
+		var value interface{}
+		var dataType model.DataType
+		if m.Table == tableCoil {
+			bits, err := s.store.readBits(m.Table, int(m.Address), 1)
+			if err != nil {
+				continue
+			}
+			value, dataType = bits[0], model.TypeBool
+		} else {
+			regs, err := s.store.readRegisters(m.Table, int(m.Address), int(m.quantity))
+			if err != nil {
+				continue
+			}
+			value, dataType = m.decodeRegisters(regs)
+		}
+
+		cmd := northbound.Command{
+			DeviceID: m.DeviceID,
+			Key:      m.Key,
+			Value:    value,
+			Type:     string(dataType),
+			Source:   s.Name(),
+			Tags: map[string]string{
+				"protocol": "modbus",
+				"table":    m.Table,
+				"address":  fmt.Sprintf("%d", m.Address),
+			},
+		}
+		if m.Field != "" {
+			cmd.Tags["field"] = m.Field
+		}
+
+		if err := northbound.PublishCommand(s.natsConn, s.config.CommandSubject, cmd); err != nil {
+			s.HandleError(err, "转发Modbus写入命令")
+			continue
+		}
+
+		log.Info().
+			Str("name", s.Name()).
+			Str("device_id", m.DeviceID).
+			Str("key", m.Key).
+			Interface("value", value).
+			Msg("已转发Modbus主站写入命令")
+	}
+}
+
+// Stop 停止连接器
+func (s *ModbusServerSink) Stop() error {
+	if !s.IsRunning() {
+		return nil
+	}
+	s.SetRunning(false)
+
+	if s.listener != nil {
+		s.listener.Close()
+	}
+
+	// 关闭所有主站连接
+	s.connMu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.connMu.Unlock()
+
+	s.wg.Wait()
+
+	log.Info().Str("name", s.Name()).Msg("Modbus服务端连接器停止")
+	return nil
+}
+
+// Healthy 检查连接器健康状态
+func (s *ModbusServerSink) Healthy() error {
+	if !s.IsRunning() {
+		return fmt.Errorf("Modbus服务端连接器未运行")
+	}
+	if s.config.ForwardWrites && s.natsConn == nil {
+		return fmt.Errorf("未设置NATS连接，无法转发写入命令")
+	}
+	return nil
+}
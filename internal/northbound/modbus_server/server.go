@@ -0,0 +1,312 @@
+package modbus_server
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Modbus功能码
+const (
+	fcReadCoils              = 0x01
+	fcReadDiscreteInputs     = 0x02
+	fcReadHoldingRegisters   = 0x03
+	fcReadInputRegisters     = 0x04
+	fcWriteSingleCoil        = 0x05
+	fcWriteSingleRegister    = 0x06
+	fcWriteMultipleCoils     = 0x0F
+	fcWriteMultipleRegisters = 0x10
+)
+
+// Modbus异常码
+const (
+	exIllegalFunction    = 0x01
+	exIllegalDataAddress = 0x02
+	exIllegalDataValue   = 0x03
+	exServerDeviceFail   = 0x04
+	exGatewayTargetFail  = 0x0B
+)
+
+const (
+	mbapHeaderLen = 7
+	maxPDULen     = 253
+	maxReadBits   = 2000
+	maxReadRegs   = 125
+	maxWriteBits  = 1968
+	maxWriteRegs  = 123
+)
+
+// modbusError 携带异常码的处理错误
+type modbusError byte
+
+func (e modbusError) Error() string {
+	return "modbus exception"
+}
+
+// serve 接受连接直到监听器关闭
+func (s *ModbusServerSink) serve(ln net.Listener) {
+	defer s.wg.Done()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.HandleError(err, "接受Modbus连接")
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		if !s.trackConn(conn) {
+			log.Warn().Str("name", s.Name()).Str("remote", conn.RemoteAddr().String()).Msg("Modbus连接数已达上限，拒绝连接")
+			conn.Close()
+			continue
+		}
+
+		s.wg.Add(1)
+		go s.handleConn(conn)
+	}
+}
+
+// trackConn 记录连接，超过最大连接数时返回false
+func (s *ModbusServerSink) trackConn(conn net.Conn) bool {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+
+	if len(s.conns) >= s.config.MaxConnections {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+// handleConn 处理单个主站连接的请求
+func (s *ModbusServerSink) handleConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.connMu.Lock()
+		delete(s.conns, conn)
+		s.connMu.Unlock()
+		conn.Close()
+	}()
+
+	remote := conn.RemoteAddr().String()
+	log.Info().Str("name", s.Name()).Str("remote", remote).Msg("Modbus主站已连接")
+
+	header := make([]byte, mbapHeaderLen)
+	pdu := make([]byte, maxPDULen)
+	for {
+		if s.idleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+		}
+
+		if _, err := io.ReadFull(conn, header); err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Debug().Err(err).Str("name", s.Name()).Str("remote", remote).Msg("Modbus连接关闭")
+			}
+			return
+		}
+
+		txID := binary.BigEndian.Uint16(header[0:2])
+		protocolID := binary.BigEndian.Uint16(header[2:4])
+		length := int(binary.BigEndian.Uint16(header[4:6]))
+		unitID := header[6]
+
+		if protocolID != 0 || length < 2 || length-1 > maxPDULen {
+			log.Warn().Str("name", s.Name()).Str("remote", remote).Int("length", length).Msg("无效的Modbus帧，关闭连接")
+			return
+		}
+		req := pdu[:length-1]
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+
+		var resp []byte
+		if s.config.UnitID != 0 && unitID != s.config.UnitID {
+			resp = exceptionPDU(req[0], exGatewayTargetFail)
+		} else {
+			resp = s.handlePDU(req)
+		}
+
+		frame := make([]byte, mbapHeaderLen+len(resp))
+		binary.BigEndian.PutUint16(frame[0:2], txID)
+		binary.BigEndian.PutUint16(frame[4:6], uint16(len(resp)+1))
+		frame[6] = unitID
+		copy(frame[mbapHeaderLen:], resp)
+
+		if _, err := conn.Write(frame); err != nil {
+			return
+		}
+	}
+}
+
+// handlePDU 处理请求PDU并返回响应PDU
+func (s *ModbusServerSink) handlePDU(req []byte) []byte {
+	fc := req[0]
+	data := req[1:]
+
+	var resp []byte
+	var err error
+	switch fc {
+	case fcReadCoils, fcReadDiscreteInputs:
+		resp, err = s.readBits(fc, data)
+	case fcReadHoldingRegisters, fcReadInputRegisters:
+		resp, err = s.readRegisters(fc, data)
+	case fcWriteSingleCoil:
+		resp, err = s.writeSingleCoil(data)
+	case fcWriteSingleRegister:
+		resp, err = s.writeSingleRegister(data)
+	case fcWriteMultipleCoils:
+		resp, err = s.writeMultipleCoils(data)
+	case fcWriteMultipleRegisters:
+		resp, err = s.writeMultipleRegisters(data)
+	default:
+		err = modbusError(exIllegalFunction)
+	}
+
+	if err != nil {
+		var code modbusError
+		if !errors.As(err, &code) {
+			code = exServerDeviceFail
+		}
+		return exceptionPDU(fc, byte(code))
+	}
+	return append([]byte{fc}, resp...)
+}
+
+func (s *ModbusServerSink) readBits(fc byte, data []byte) ([]byte, error) {
+	if len(data) != 4 {
+		return nil, modbusError(exIllegalDataValue)
+	}
+	start := int(binary.BigEndian.Uint16(data[0:2]))
+	count := int(binary.BigEndian.Uint16(data[2:4]))
+	if count < 1 || count > maxReadBits {
+		return nil, modbusError(exIllegalDataValue)
+	}
+
+	table := tableCoil
+	if fc == fcReadDiscreteInputs {
+		table = tableDiscrete
+	}
+	bits, err := s.store.readBits(table, start, count)
+	if err != nil {
+		return nil, err
+	}
+
+	packed := make([]byte, (count+7)/8)
+	for i, bit := range bits {
+		if bit {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return append([]byte{byte(len(packed))}, packed...), nil
+}
+
+func (s *ModbusServerSink) readRegisters(fc byte, data []byte) ([]byte, error) {
+	if len(data) != 4 {
+		return nil, modbusError(exIllegalDataValue)
+	}
+	start := int(binary.BigEndian.Uint16(data[0:2]))
+	count := int(binary.BigEndian.Uint16(data[2:4]))
+	if count < 1 || count > maxReadRegs {
+		return nil, modbusError(exIllegalDataValue)
+	}
+
+	table := tableHolding
+	if fc == fcReadInputRegisters {
+		table = tableInput
+	}
+	regs, err := s.store.readRegisters(table, start, count)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]byte, 1+2*count)
+	resp[0] = byte(2 * count)
+	for i, r := range regs {
+		binary.BigEndian.PutUint16(resp[1+2*i:], r)
+	}
+	return resp, nil
+}
+
+func (s *ModbusServerSink) writeSingleCoil(data []byte) ([]byte, error) {
+	if len(data) != 4 {
+		return nil, modbusError(exIllegalDataValue)
+	}
+	addr := int(binary.BigEndian.Uint16(data[0:2]))
+	var value bool
+	switch binary.BigEndian.Uint16(data[2:4]) {
+	case 0xFF00:
+		value = true
+	case 0x0000:
+	default:
+		return nil, modbusError(exIllegalDataValue)
+	}
+
+	if err := s.writeBits(addr, []bool{value}); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *ModbusServerSink) writeSingleRegister(data []byte) ([]byte, error) {
+	if len(data) != 4 {
+		return nil, modbusError(exIllegalDataValue)
+	}
+	addr := int(binary.BigEndian.Uint16(data[0:2]))
+	if err := s.writeRegisters(addr, []uint16{binary.BigEndian.Uint16(data[2:4])}); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *ModbusServerSink) writeMultipleCoils(data []byte) ([]byte, error) {
+	if len(data) < 5 {
+		return nil, modbusError(exIllegalDataValue)
+	}
+	start := int(binary.BigEndian.Uint16(data[0:2]))
+	count := int(binary.BigEndian.Uint16(data[2:4]))
+	byteCount := int(data[4])
+	if count < 1 || count > maxWriteBits || byteCount != (count+7)/8 || len(data) != 5+byteCount {
+		return nil, modbusError(exIllegalDataValue)
+	}
+
+	bits := make([]bool, count)
+	for i := range bits {
+		bits[i] = data[5+i/8]&(1<<(i%8)) != 0
+	}
+	if err := s.writeBits(start, bits); err != nil {
+		return nil, err
+	}
+	return data[0:4], nil
+}
+
+func (s *ModbusServerSink) writeMultipleRegisters(data []byte) ([]byte, error) {
+	if len(data) < 5 {
+		return nil, modbusError(exIllegalDataValue)
+	}
+	start := int(binary.BigEndian.Uint16(data[0:2]))
+	count := int(binary.BigEndian.Uint16(data[2:4]))
+	byteCount := int(data[4])
+	if count < 1 || count > maxWriteRegs || byteCount != 2*count || len(data) != 5+byteCount {
+		return nil, modbusError(exIllegalDataValue)
+	}
+
+	regs := make([]uint16, count)
+	for i := range regs {
+		regs[i] = binary.BigEndian.Uint16(data[5+2*i:])
+	}
+	if err := s.writeRegisters(start, regs); err != nil {
+		return nil, err
+	}
+	return data[0:4], nil
+}
+
+func exceptionPDU(fc byte, code byte) []byte {
+	return []byte{fc | 0x80, code}
+}
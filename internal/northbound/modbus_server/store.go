@@ -0,0 +1,98 @@
+package modbus_server
+
+import (
+	"sync"
+)
+
+// registerStore 保存四张寄存器表的当前值
+type registerStore struct {
+	mu       sync.RWMutex
+	coils    []bool
+	discrete []bool
+	holding  []uint16
+	input    []uint16
+}
+
+func newRegisterStore(coils, discrete, holding, input int) *registerStore {
+	return &registerStore{
+		coils:    make([]bool, coils),
+		discrete: make([]bool, discrete),
+		holding:  make([]uint16, holding),
+		input:    make([]uint16, input),
+	}
+}
+
+// size 返回寄存器表大小
+func (st *registerStore) size(table string) int {
+	switch table {
+	case tableCoil:
+		return len(st.coils)
+	case tableDiscrete:
+		return len(st.discrete)
+	case tableHolding:
+		return len(st.holding)
+	case tableInput:
+		return len(st.input)
+	}
+	return 0
+}
+
+func (st *registerStore) bitTable(table string) []bool {
+	if table == tableDiscrete {
+		return st.discrete
+	}
+	return st.coils
+}
+
+func (st *registerStore) registerTable(table string) []uint16 {
+	if table == tableInput {
+		return st.input
+	}
+	return st.holding
+}
+
+func (st *registerStore) readBits(table string, start, count int) ([]bool, error) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	bits := st.bitTable(table)
+	if start+count > len(bits) {
+		return nil, modbusError(exIllegalDataAddress)
+	}
+	return append([]bool(nil), bits[start:start+count]...), nil
+}
+
+func (st *registerStore) readRegisters(table string, start, count int) ([]uint16, error) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	regs := st.registerTable(table)
+	if start+count > len(regs) {
+		return nil, modbusError(exIllegalDataAddress)
+	}
+	return append([]uint16(nil), regs[start:start+count]...), nil
+}
+
+func (st *registerStore) setBits(table string, start int, values []bool) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	bits := st.bitTable(table)
+	if start+len(values) > len(bits) {
+		return modbusError(exIllegalDataAddress)
+	}
+	copy(bits[start:], values)
+	return nil
+}
+
+func (st *registerStore) setRegisters(table string, start int, values []uint16) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	regs := st.registerTable(table)
+	if start+len(values) > len(regs) {
+		return modbusError(exIllegalDataAddress)
+	}
+	copy(regs[start:], values)
+	return nil
+}
@@ -8,7 +8,9 @@ import (
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/codec"
 	"github.com/y001j/iot-gateway/internal/model"
 	"github.com/y001j/iot-gateway/internal/northbound"
 )
@@ -35,6 +37,9 @@ type MQTTSink struct {
 	topicTpl string
 	qos      byte
 	retained bool
+	natsConn *nats.Conn
+	// Sparkplug B模式下的边缘节点，JSON模式为nil
+	sparkplug *sparkplugNode
 	pointCh  chan model.Point
 	stopCh   chan struct{}
 	ctx      context.Context
@@ -53,6 +58,9 @@ type MQTTConfig struct {
 	QoS      byte       `json:"qos"`
 	Retained bool       `json:"retained"`
 	TLS      *TLSConfig `json:"tls,omitempty"`
+	// Mode 发布格式: json（默认，每个数据点发布到TopicTpl）或 sparkplug（Sparkplug B边缘节点）
+	Mode      string           `json:"mode,omitempty"`
+	Sparkplug *SparkplugConfig `json:"sparkplug,omitempty"`
 }
 
 // TLSConfig 是TLS配置
@@ -86,6 +94,10 @@ func (s *MQTTSink) Init(cfg json.RawMessage) error {
 	var tempConfig struct {
 		Params MQTTConfig `json:"params"`
 	}
+	tempConfig.Params.Sparkplug = &SparkplugConfig{
+		ReportByException: true,
+		AllowWrites:       true,
+	}
 	if err := json.Unmarshal(cfg, &tempConfig); err != nil {
 		fmt.Printf("!!!! MQTT DEBUG: JSON解析失败, 错误=%v !!!!\n", err)
 		return fmt.Errorf("解析MQTT配置失败: %w", err)
@@ -101,6 +113,18 @@ func (s *MQTTSink) Init(cfg json.RawMessage) error {
 	s.qos = mqttConfig.QoS
 	s.retained = mqttConfig.Retained
 
+	switch mqttConfig.Mode {
+	case "", "json":
+	case "sparkplug":
+		node, err := newSparkplugNode(s, *mqttConfig.Sparkplug)
+		if err != nil {
+			return err
+		}
+		s.sparkplug = node
+	default:
+		return fmt.Errorf("不支持的MQTT发布模式: %s", mqttConfig.Mode)
+	}
+
 	// 创建MQTT客户端选项
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(mqttConfig.Broker)
@@ -115,12 +139,23 @@ func (s *MQTTSink) Init(cfg json.RawMessage) error {
 	
 	// 保存名称到本地变量，避免闭包问题
 	name := s.Name()
+	node := s.sparkplug
 	opts.SetOnConnectHandler(func(client mqtt.Client) {
 		log.Info().Str("name", name).Msg("MQTT连接成功")
+		if node != nil {
+			node.onConnect(client)
+		}
 	})
 	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
 		s.HandleError(err, "MQTT连接断开")
+		if node != nil {
+			node.onConnectionLost()
+		}
 	})
+	if node != nil {
+		// NDEATH作为遗嘱消息，重连时更新bdSeq
+		node.configureClient(opts)
+	}
 
 	// 配置TLS（如果有）
 	if mqttConfig.TLS != nil {
@@ -178,6 +213,14 @@ func (s *MQTTSink) Publish(batch []model.Point) error {
 	// 记录发布操作开始时间
 	publishStart := time.Now()
 
+	// Sparkplug模式按设备合并为DBIRTH/DDATA同步发送
+	if s.sparkplug != nil {
+		return s.SafePublishBatch(batch, func(batch []model.Point) error {
+			s.AddTags(batch)
+			return s.sparkplug.publish(batch)
+		}, publishStart)
+	}
+
 	// 使用BaseSink的SafePublishBatch方法，自动处理统计
 	return s.SafePublishBatch(batch, func(batch []model.Point) error {
 		// 使用基础方法添加标签
@@ -212,6 +255,11 @@ func (s *MQTTSink) Stop() error {
 	// 关闭通道
 	close(s.stopCh)
 
+	// Sparkplug模式主动发送NDEATH
+	if s.sparkplug != nil && s.client != nil {
+		s.sparkplug.close()
+	}
+
 	// 断开MQTT连接
 	if s.client != nil && s.client.IsConnected() {
 		s.client.Disconnect(250) // 等待250ms完成断开
@@ -281,8 +329,15 @@ func (s *MQTTSink) publishLoop() {
 				"tags":      point.GetTagsCopy(), // 保留tags信息
 			}
 			
-			// 序列化完整数据结构
-			payload, err := json.Marshal(fullData)
+			// 序列化完整数据结构，配置了二进制encoding时按对应编码序列化数据点
+			var payload []byte
+			var err error
+			if c := s.Codec(); c.Name() != codec.JSON {
+				point.Value = finalValue
+				payload, err = c.Marshal(&point)
+			} else {
+				payload, err = json.Marshal(fullData)
+			}
 			if err != nil {
 				s.HandleError(err, "序列化数据点值")
 				continue
@@ -320,5 +375,13 @@ func (s *MQTTSink) Healthy() error {
 	if s.client == nil || !s.client.IsConnected() {
 		return fmt.Errorf("MQTT客户端未连接")
 	}
+	if s.sparkplug != nil && !s.sparkplug.isOnline() {
+		return fmt.Errorf("Sparkplug边缘节点未上线")
+	}
 	return nil
+}
+
+// SetNATSConnection 设置NATS连接，用于转发Sparkplug DCMD写入命令
+func (s *MQTTSink) SetNATSConnection(conn *nats.Conn) {
+	s.natsConn = conn
 }
\ No newline at end of file
@@ -0,0 +1,589 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/model"
+	"github.com/y001j/iot-gateway/internal/northbound"
+)
+
+const (
+	spNamespace     = "spBv1.0"
+	spMetricBdSeq   = "bdSeq"
+	spMetricRebirth = "Node Control/Rebirth"
+	spPublishWait   = 5 * time.Second
+)
+
+// SparkplugConfig Sparkplug B边缘节点配置
+type SparkplugConfig struct {
+	GroupID           string  `json:"group_id"`
+	EdgeNodeID        string  `json:"edge_node_id"`
+	ReportByException bool    `json:"report_by_exception"` // 只发送变化的指标，默认true
+	Deadband          float64 `json:"deadband"`            // 数值指标的变化死区（绝对值）
+	AllowWrites       bool    `json:"allow_writes"`        // 是否将DCMD转发为NATS命令，默认true
+	CommandSubject    string  `json:"command_subject"`     // 命令主题模板，支持 {device_id} 和 {key}
+}
+
+// sparkplugNode Sparkplug B边缘节点，网关中的每个设备对应一个Sparkplug设备，
+// 每个数据点key对应一个指标，复合数据按字段展开为 key/字段 指标
+type sparkplugNode struct {
+	sink   *MQTTSink
+	config SparkplugConfig
+
+	mu          sync.Mutex
+	bdSeq       uint64
+	sessionUsed bool // 当前bdSeq对应的遗嘱是否已用于一次成功连接
+	seq         uint64
+	online      bool // NBIRTH已发送
+	nextAlias   uint64
+	devices     map[string]*spDevice // Sparkplug设备ID -> 设备
+	order       []*spDevice
+}
+
+type spDevice struct {
+	id       string // Sparkplug设备ID
+	deviceID string // 网关设备ID
+	born     bool   // 当前会话已发送DBIRTH
+	metrics  map[string]*spDeviceMetric
+	byAlias  map[uint64]*spDeviceMetric
+	order    []*spDeviceMetric
+}
+
+type spDeviceMetric struct {
+	name      string
+	key       string // 网关数据点key
+	field     string // 复合数据的字段名
+	alias     uint64
+	datatype  uint32
+	value     interface{}
+	timestamp uint64
+
+	published    interface{} // 最近一次发送的值，用于按变化上报
+	hasPublished bool
+}
+
+// spValue 数据点展开后的单个指标值
+type spValue struct {
+	name     string
+	field    string
+	datatype uint32
+	value    interface{}
+}
+
+func newSparkplugNode(sink *MQTTSink, cfg SparkplugConfig) (*sparkplugNode, error) {
+	if cfg.GroupID == "" || cfg.EdgeNodeID == "" {
+		return nil, fmt.Errorf("Sparkplug模式需要配置group_id和edge_node_id")
+	}
+	if cfg.GroupID != spSanitizeID(cfg.GroupID) || cfg.EdgeNodeID != spSanitizeID(cfg.EdgeNodeID) {
+		return nil, fmt.Errorf("group_id和edge_node_id不能包含 / + #")
+	}
+	if cfg.CommandSubject == "" {
+		cfg.CommandSubject = northbound.DefaultCommandSubject
+	}
+	return &sparkplugNode{
+		sink:      sink,
+		config:    cfg,
+		nextAlias: 1,
+		devices:   make(map[string]*spDevice),
+	}, nil
+}
+
+// spSanitizeID Sparkplug的group、节点和设备ID不能包含主题分隔符和通配符
+func spSanitizeID(id string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(id)
+}
+
+func (n *sparkplugNode) topic(msgType string) string {
+	return spNamespace + "/" + n.config.GroupID + "/" + msgType + "/" + n.config.EdgeNodeID
+}
+
+func (n *sparkplugNode) deviceTopic(msgType string, dev *spDevice) string {
+	return n.topic(msgType) + "/" + dev.id
+}
+
+// deathPayload NDEATH消息，只包含bdSeq
+func (n *sparkplugNode) deathPayload() []byte {
+	p := spPayload{
+		timestamp: spNow(),
+		metrics: []spMetric{{
+			name:     spMetricBdSeq,
+			datatype: spTypeInt64,
+			value:    int64(n.bdSeq),
+		}},
+	}
+	return p.marshal()
+}
+
+// configureClient 设置遗嘱和重连回调，必须在创建客户端之前调用
+func (n *sparkplugNode) configureClient(opts *mqtt.ClientOptions) {
+	opts.SetCleanSession(true)
+	opts.SetBinaryWill(n.topic("NDEATH"), n.deathPayload(), 1, false)
+	opts.SetReconnectingHandler(func(client mqtt.Client, opts *mqtt.ClientOptions) {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		// 上一个会话已经使用了当前bdSeq，新会话递增并更新遗嘱
+		if n.sessionUsed {
+			n.bdSeq = (n.bdSeq + 1) % 256
+			n.sessionUsed = false
+		}
+		opts.SetBinaryWill(n.topic("NDEATH"), n.deathPayload(), 1, false)
+	})
+}
+
+// onConnect 连接建立后订阅命令主题并发送NBIRTH和所有设备的DBIRTH
+func (n *sparkplugNode) onConnect(client mqtt.Client) {
+	n.mu.Lock()
+	n.sessionUsed = true
+	n.online = false
+	n.mu.Unlock()
+
+	filters := map[string]byte{
+		n.topic("NCMD"):        1,
+		n.topic("DCMD") + "/+": 1,
+	}
+	token := client.SubscribeMultiple(filters, n.handleCommand)
+	if token.WaitTimeout(spPublishWait) && token.Error() != nil {
+		n.sink.HandleError(token.Error(), "订阅Sparkplug命令主题")
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.birthLocked(); err != nil {
+		n.sink.HandleError(err, "发送Sparkplug出生消息")
+	}
+}
+
+// onConnectionLost 连接断开后，所有设备需要在下次连接时重新发送DBIRTH
+func (n *sparkplugNode) onConnectionLost() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.online = false
+	for _, dev := range n.order {
+		dev.born = false
+	}
+}
+
+// birthLocked 发送NBIRTH并为所有已知设备发送DBIRTH，调用方需持有锁
+func (n *sparkplugNode) birthLocked() error {
+	n.seq = 0
+	for _, dev := range n.order {
+		dev.born = false
+	}
+	p := spPayload{
+		timestamp: spNow(),
+		seq:       n.nextSeq(),
+		hasSeq:    true,
+		metrics: []spMetric{
+			{name: spMetricBdSeq, datatype: spTypeInt64, value: int64(n.bdSeq)},
+			{name: spMetricRebirth, datatype: spTypeBoolean, value: false},
+		},
+	}
+	if err := n.send(n.topic("NBIRTH"), 0, p.marshal()); err != nil {
+		return err
+	}
+	n.online = true
+	log.Info().
+		Str("name", n.sink.Name()).
+		Str("group_id", n.config.GroupID).
+		Str("edge_node_id", n.config.EdgeNodeID).
+		Uint64("bd_seq", n.bdSeq).
+		Int("devices", len(n.order)).
+		Msg("Sparkplug边缘节点上线")
+
+	for _, dev := range n.order {
+		if err := n.deviceBirthLocked(dev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deviceBirthLocked 发送包含全部指标名称、别名、类型和当前值的DBIRTH
+func (n *sparkplugNode) deviceBirthLocked(dev *spDevice) error {
+	p := spPayload{timestamp: spNow(), seq: n.nextSeq(), hasSeq: true}
+	for _, m := range dev.order {
+		p.metrics = append(p.metrics, spMetric{
+			name:      m.name,
+			alias:     m.alias,
+			hasAlias:  true,
+			timestamp: m.timestamp,
+			datatype:  m.datatype,
+			value:     m.value,
+		})
+	}
+	if err := n.send(n.deviceTopic("DBIRTH", dev), 0, p.marshal()); err != nil {
+		return err
+	}
+	dev.born = true
+	for _, m := range dev.order {
+		m.published, m.hasPublished = m.value, true
+	}
+	return nil
+}
+
+func (n *sparkplugNode) nextSeq() uint64 {
+	seq := n.seq
+	n.seq = (n.seq + 1) % 256
+	return seq
+}
+
+func (n *sparkplugNode) send(topic string, qos byte, payload []byte) error {
+	token := n.sink.client.Publish(topic, qos, false, payload)
+	if !token.WaitTimeout(spPublishWait) {
+		return fmt.Errorf("发布 %s 超时", topic)
+	}
+	return token.Error()
+}
+
+// publish 更新指标值，新设备或新指标触发DBIRTH，其余变化的指标以DDATA发送
+func (n *sparkplugNode) publish(batch []model.Point) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	rebirth := make(map[*spDevice]bool)
+	changed := make(map[*spDevice][]*spDeviceMetric)
+	var devices []*spDevice
+
+	for i := range batch {
+		point := &batch[i]
+		dev := n.deviceLocked(point.DeviceID)
+		if _, seen := changed[dev]; !seen {
+			devices = append(devices, dev)
+			changed[dev] = nil
+		}
+		ts := uint64(point.Timestamp.UnixMilli())
+		if point.Timestamp.IsZero() {
+			ts = spNow()
+		}
+
+		for _, v := range spPointValues(point) {
+			m, ok := dev.metrics[v.name]
+			if !ok {
+				m = &spDeviceMetric{name: v.name, key: point.Key, field: v.field, alias: n.nextAlias, datatype: v.datatype}
+				n.nextAlias++
+				dev.metrics[v.name] = m
+				dev.byAlias[m.alias] = m
+				dev.order = append(dev.order, m)
+				rebirth[dev] = true
+			} else if m.datatype != v.datatype {
+				// 类型变化需要重新声明指标
+				m.datatype = v.datatype
+				rebirth[dev] = true
+			}
+			m.value = v.value
+			m.timestamp = ts
+			if !n.config.ReportByException || !m.hasPublished || spChanged(m.published, v.value, n.config.Deadband) {
+				changed[dev] = spAppendMetric(changed[dev], m)
+			}
+		}
+	}
+
+	// 离线时只更新指标值，重新上线后DBIRTH会带上最新值
+	if !n.online || !n.sink.client.IsConnected() {
+		return nil
+	}
+
+	for _, dev := range devices {
+		if rebirth[dev] || !dev.born {
+			if err := n.deviceBirthLocked(dev); err != nil {
+				return fmt.Errorf("发送DBIRTH失败: %w", err)
+			}
+			continue
+		}
+		metrics := changed[dev]
+		if len(metrics) == 0 {
+			continue
+		}
+		p := spPayload{timestamp: spNow(), seq: n.nextSeq(), hasSeq: true}
+		for _, m := range metrics {
+			p.metrics = append(p.metrics, spMetric{
+				alias:     m.alias,
+				hasAlias:  true,
+				timestamp: m.timestamp,
+				datatype:  m.datatype,
+				value:     m.value,
+			})
+		}
+		if err := n.send(n.deviceTopic("DDATA", dev), 0, p.marshal()); err != nil {
+			return fmt.Errorf("发送DDATA失败: %w", err)
+		}
+		for _, m := range metrics {
+			m.published, m.hasPublished = m.value, true
+		}
+	}
+	return nil
+}
+
+func (n *sparkplugNode) deviceLocked(deviceID string) *spDevice {
+	id := spSanitizeID(deviceID)
+	dev, ok := n.devices[id]
+	if !ok {
+		dev = &spDevice{
+			id:       id,
+			deviceID: deviceID,
+			metrics:  make(map[string]*spDeviceMetric),
+			byAlias:  make(map[uint64]*spDeviceMetric),
+		}
+		n.devices[id] = dev
+		n.order = append(n.order, dev)
+	}
+	return dev
+}
+
+func spAppendMetric(list []*spDeviceMetric, m *spDeviceMetric) []*spDeviceMetric {
+	for _, item := range list {
+		if item == m {
+			return list
+		}
+	}
+	return append(list, m)
+}
+
+// spChanged 判断指标值是否需要上报，数值类型使用死区
+func spChanged(prev, next interface{}, deadband float64) bool {
+	switch p := prev.(type) {
+	case int64:
+		if n, ok := next.(int64); ok {
+			return math.Abs(float64(n-p)) > deadband || (deadband == 0 && n != p)
+		}
+	case float64:
+		if n, ok := next.(float64); ok {
+			return math.Abs(n-p) > deadband || (deadband == 0 && n != p)
+		}
+	case []byte:
+		if n, ok := next.([]byte); ok {
+			return !bytes.Equal(p, n)
+		}
+		return true
+	}
+	if _, ok := next.([]byte); ok {
+		return true
+	}
+	return prev != next
+}
+
+// spPointValues 将数据点转换为Sparkplug指标值
+func spPointValues(point *model.Point) []spValue {
+	if fields, ok := northbound.FlattenComposite(point); ok {
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		values := make([]spValue, 0, len(names))
+		for _, name := range names {
+			datatype, value := spScalar(fields[name])
+			values = append(values, spValue{name: point.Key + "/" + name, field: name, datatype: datatype, value: value})
+		}
+		return values
+	}
+
+	var datatype uint32
+	var value interface{}
+	switch point.Type {
+	case model.TypeInt:
+		datatype = spTypeInt64
+		switch v := point.Value.(type) {
+		case int:
+			value = int64(v)
+		case int64:
+			value = v
+		default:
+			if f, ok := northbound.ToFloat64(point.Value); ok {
+				value = int64(f)
+			}
+		}
+	case model.TypeFloat:
+		datatype = spTypeDouble
+		if f, ok := northbound.ToFloat64(point.Value); ok {
+			value = f
+		}
+	case model.TypeBool:
+		datatype = spTypeBoolean
+		if b, ok := point.Value.(bool); ok {
+			value = b
+		} else if f, ok := northbound.ToFloat64(point.Value); ok {
+			value = f != 0
+		}
+	case model.TypeString:
+		datatype = spTypeString
+		if point.Value != nil {
+			value = fmt.Sprint(point.Value)
+		}
+	default:
+		datatype, value = spScalar(point.Value)
+	}
+	return []spValue{{name: point.Key, datatype: datatype, value: value}}
+}
+
+// spScalar 根据Go值推断Sparkplug数据类型，无法直接表示的值编码为JSON字符串
+func spScalar(v interface{}) (uint32, interface{}) {
+	switch val := v.(type) {
+	case nil:
+		return spTypeString, nil
+	case bool:
+		return spTypeBoolean, val
+	case string:
+		return spTypeString, val
+	case []byte:
+		return spTypeBytes, val
+	case float32, float64:
+		f, _ := northbound.ToFloat64(val)
+		return spTypeDouble, f
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32:
+		f, _ := northbound.ToFloat64(val)
+		return spTypeInt64, int64(f)
+	case uint64:
+		return spTypeUInt64, val
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return spTypeString, fmt.Sprint(v)
+	}
+	return spTypeString, string(data)
+}
+
+// handleCommand 处理NCMD（重新出生）和DCMD（转发为NATS命令）
+func (n *sparkplugNode) handleCommand(client mqtt.Client, msg mqtt.Message) {
+	parts := strings.Split(msg.Topic(), "/")
+	if len(parts) < 4 {
+		return
+	}
+	payload, err := unmarshalSpPayload(msg.Payload())
+	if err != nil {
+		n.sink.HandleError(err, "解析Sparkplug命令")
+		return
+	}
+
+	switch parts[2] {
+	case "NCMD":
+		for _, m := range payload.metrics {
+			if m.name == spMetricRebirth && m.value == true {
+				log.Info().Str("name", n.sink.Name()).Msg("收到Sparkplug重新出生请求")
+				n.mu.Lock()
+				if err := n.birthLocked(); err != nil {
+					n.sink.HandleError(err, "发送Sparkplug出生消息")
+				}
+				n.mu.Unlock()
+			}
+		}
+	case "DCMD":
+		if len(parts) < 5 {
+			return
+		}
+		n.forwardDeviceCommand(parts[4], payload)
+	}
+}
+
+func (n *sparkplugNode) forwardDeviceCommand(id string, payload *spPayload) {
+	if !n.config.AllowWrites {
+		log.Warn().Str("name", n.sink.Name()).Str("device", id).Msg("Sparkplug写入未启用，忽略DCMD")
+		return
+	}
+
+	type target struct {
+		metric *spDeviceMetric
+		value  interface{}
+	}
+	var deviceID string
+	var targets []target
+
+	n.mu.Lock()
+	dev, ok := n.devices[id]
+	if ok {
+		deviceID = dev.deviceID
+		for _, m := range payload.metrics {
+			var metric *spDeviceMetric
+			if m.hasAlias {
+				metric = dev.byAlias[m.alias]
+			}
+			if metric == nil && m.name != "" {
+				metric = dev.metrics[m.name]
+			}
+			if metric == nil {
+				log.Warn().Str("name", n.sink.Name()).Str("device", id).Str("metric", m.name).Uint64("alias", m.alias).Msg("DCMD中的指标不存在")
+				continue
+			}
+			targets = append(targets, target{metric: metric, value: m.value})
+		}
+	}
+	n.mu.Unlock()
+
+	if !ok {
+		log.Warn().Str("name", n.sink.Name()).Str("device", id).Msg("DCMD中的设备不存在")
+		return
+	}
+
+	for _, t := range targets {
+		cmd := northbound.Command{
+			DeviceID: deviceID,
+			Key:      t.metric.key,
+			Value:    t.value,
+			Type:     spGatewayType(t.metric.datatype),
+			Source:   n.sink.Name(),
+			Tags: map[string]string{
+				"protocol": "sparkplug",
+			},
+		}
+		if t.metric.field != "" {
+			cmd.Tags["field"] = t.metric.field
+		}
+		if err := northbound.PublishCommand(n.sink.natsConn, n.config.CommandSubject, cmd); err != nil {
+			n.sink.HandleError(err, "转发Sparkplug写入命令")
+			continue
+		}
+		log.Info().
+			Str("name", n.sink.Name()).
+			Str("device_id", deviceID).
+			Str("key", t.metric.key).
+			Interface("value", t.value).
+			Msg("Sparkplug写入命令已转发")
+	}
+}
+
+// spGatewayType Sparkplug数据类型对应的网关数据类型
+func spGatewayType(datatype uint32) string {
+	switch datatype {
+	case spTypeInt8, spTypeInt16, spTypeInt32, spTypeInt64, spTypeUInt8, spTypeUInt16, spTypeUInt32, spTypeUInt64:
+		return string(model.TypeInt)
+	case spTypeFloat, spTypeDouble:
+		return string(model.TypeFloat)
+	case spTypeBoolean:
+		return string(model.TypeBool)
+	default:
+		return string(model.TypeString)
+	}
+}
+
+// close 正常停止时主动发送NDEATH（断开连接不会触发遗嘱）
+func (n *sparkplugNode) close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.online || !n.sink.client.IsConnected() {
+		return
+	}
+	if err := n.send(n.topic("NDEATH"), 1, n.deathPayload()); err != nil {
+		n.sink.HandleError(err, "发送NDEATH")
+	}
+	n.online = false
+}
+
+// isOnline 节点是否已发送NBIRTH
+func (n *sparkplugNode) isOnline() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.online
+}
+
+func spNow() uint64 {
+	return uint64(time.Now().UnixMilli())
+}
@@ -0,0 +1,293 @@
+package mqtt
+
+import (
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Sparkplug B 数据类型（org.eclipse.tahu.protobuf.DataType）
+const (
+	spTypeInt8     uint32 = 1
+	spTypeInt16    uint32 = 2
+	spTypeInt32    uint32 = 3
+	spTypeInt64    uint32 = 4
+	spTypeUInt8    uint32 = 5
+	spTypeUInt16   uint32 = 6
+	spTypeUInt32   uint32 = 7
+	spTypeUInt64   uint32 = 8
+	spTypeFloat    uint32 = 9
+	spTypeDouble   uint32 = 10
+	spTypeBoolean  uint32 = 11
+	spTypeString   uint32 = 12
+	spTypeDateTime uint32 = 13
+	spTypeText     uint32 = 14
+	spTypeUUID     uint32 = 15
+	spTypeBytes    uint32 = 17
+)
+
+// Payload 与 Metric 的字段号
+const (
+	spPayloadTimestamp protowire.Number = 1
+	spPayloadMetrics   protowire.Number = 2
+	spPayloadSeq       protowire.Number = 3
+
+	spMetricName      protowire.Number = 1
+	spMetricAlias     protowire.Number = 2
+	spMetricTimestamp protowire.Number = 3
+	spMetricDatatype  protowire.Number = 4
+	spMetricIsNull    protowire.Number = 7
+	spMetricInt       protowire.Number = 10
+	spMetricLong      protowire.Number = 11
+	spMetricFloat     protowire.Number = 12
+	spMetricDouble    protowire.Number = 13
+	spMetricBoolean   protowire.Number = 14
+	spMetricString    protowire.Number = 15
+	spMetricBytes     protowire.Number = 16
+)
+
+// spMetric Sparkplug B 指标，value的Go类型由datatype决定:
+// 整数类型为int64/uint64，Float/Double为float64，Boolean为bool，字符串类型为string，Bytes为[]byte
+type spMetric struct {
+	name      string // 为空时只发送别名
+	alias     uint64
+	hasAlias  bool
+	timestamp uint64
+	datatype  uint32
+	value     interface{}
+}
+
+// spPayload Sparkplug B 消息体
+type spPayload struct {
+	timestamp uint64
+	seq       uint64
+	hasSeq    bool
+	metrics   []spMetric
+}
+
+func (p *spPayload) marshal() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, spPayloadTimestamp, protowire.VarintType)
+	b = protowire.AppendVarint(b, p.timestamp)
+	for i := range p.metrics {
+		b = protowire.AppendTag(b, spPayloadMetrics, protowire.BytesType)
+		b = protowire.AppendBytes(b, p.metrics[i].marshal())
+	}
+	if p.hasSeq {
+		b = protowire.AppendTag(b, spPayloadSeq, protowire.VarintType)
+		b = protowire.AppendVarint(b, p.seq)
+	}
+	return b
+}
+
+func (m *spMetric) marshal() []byte {
+	var b []byte
+	if m.name != "" {
+		b = protowire.AppendTag(b, spMetricName, protowire.BytesType)
+		b = protowire.AppendString(b, m.name)
+	}
+	if m.hasAlias {
+		b = protowire.AppendTag(b, spMetricAlias, protowire.VarintType)
+		b = protowire.AppendVarint(b, m.alias)
+	}
+	if m.timestamp != 0 {
+		b = protowire.AppendTag(b, spMetricTimestamp, protowire.VarintType)
+		b = protowire.AppendVarint(b, m.timestamp)
+	}
+	b = protowire.AppendTag(b, spMetricDatatype, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(m.datatype))
+
+	if m.value == nil {
+		b = protowire.AppendTag(b, spMetricIsNull, protowire.VarintType)
+		return protowire.AppendVarint(b, 1)
+	}
+	switch m.datatype {
+	case spTypeInt8, spTypeInt16, spTypeInt32, spTypeUInt8, spTypeUInt16, spTypeUInt32:
+		// 有符号整数按补码存入uint32
+		b = protowire.AppendTag(b, spMetricInt, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(uint32(spInt64(m.value))))
+	case spTypeInt64, spTypeUInt64, spTypeDateTime:
+		b = protowire.AppendTag(b, spMetricLong, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(spInt64(m.value)))
+	case spTypeFloat:
+		b = protowire.AppendTag(b, spMetricFloat, protowire.Fixed32Type)
+		b = protowire.AppendFixed32(b, math.Float32bits(float32(m.value.(float64))))
+	case spTypeDouble:
+		b = protowire.AppendTag(b, spMetricDouble, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(m.value.(float64)))
+	case spTypeBoolean:
+		b = protowire.AppendTag(b, spMetricBoolean, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(m.value.(bool)))
+	case spTypeBytes:
+		b = protowire.AppendTag(b, spMetricBytes, protowire.BytesType)
+		b = protowire.AppendBytes(b, m.value.([]byte))
+	default:
+		b = protowire.AppendTag(b, spMetricString, protowire.BytesType)
+		b = protowire.AppendString(b, fmt.Sprint(m.value))
+	}
+	return b
+}
+
+func spInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case uint64:
+		return int64(n)
+	}
+	return 0
+}
+
+// unmarshalSpPayload 解析NCMD/DCMD消息，忽略不支持的字段
+func unmarshalSpPayload(b []byte) (*spPayload, error) {
+	p := &spPayload{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch {
+		case num == spPayloadTimestamp && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			p.timestamp = v
+			b = b[n:]
+		case num == spPayloadSeq && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			p.seq, p.hasSeq = v, true
+			b = b[n:]
+		case num == spPayloadMetrics && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			m, err := unmarshalSpMetric(v)
+			if err != nil {
+				return nil, err
+			}
+			p.metrics = append(p.metrics, *m)
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return p, nil
+}
+
+func unmarshalSpMetric(b []byte) (*spMetric, error) {
+	m := &spMetric{}
+	var isNull bool
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var varint uint64
+		switch typ {
+		case protowire.VarintType:
+			varint, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(b)
+			varint = uint64(v)
+		case protowire.Fixed64Type:
+			varint, n = protowire.ConsumeFixed64(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		field := b[:n]
+		b = b[n:]
+
+		switch num {
+		case spMetricName:
+			name, n := protowire.ConsumeString(field)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			m.name = name
+		case spMetricAlias:
+			m.alias, m.hasAlias = varint, true
+		case spMetricTimestamp:
+			m.timestamp = varint
+		case spMetricDatatype:
+			m.datatype = uint32(varint)
+		case spMetricIsNull:
+			isNull = varint != 0
+		case spMetricInt:
+			m.value = uint32(varint)
+		case spMetricLong:
+			m.value = varint
+		case spMetricFloat:
+			m.value = float64(math.Float32frombits(uint32(varint)))
+		case spMetricDouble:
+			m.value = math.Float64frombits(varint)
+		case spMetricBoolean:
+			m.value = protowire.DecodeBool(varint)
+		case spMetricString:
+			s, n := protowire.ConsumeString(field)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			m.value = s
+		case spMetricBytes:
+			v, n := protowire.ConsumeBytes(field)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			m.value = append([]byte(nil), v...)
+		}
+	}
+	if isNull {
+		m.value = nil
+		return m, nil
+	}
+	m.value = spDecodeValue(m.datatype, m.value)
+	return m, nil
+}
+
+// spDecodeValue 按数据类型将线上的值还原为Go值
+func spDecodeValue(datatype uint32, v interface{}) interface{} {
+	switch datatype {
+	case spTypeInt8:
+		if n, ok := v.(uint32); ok {
+			return int64(int8(n))
+		}
+	case spTypeInt16:
+		if n, ok := v.(uint32); ok {
+			return int64(int16(n))
+		}
+	case spTypeInt32:
+		if n, ok := v.(uint32); ok {
+			return int64(int32(n))
+		}
+	case spTypeUInt8, spTypeUInt16, spTypeUInt32:
+		if n, ok := v.(uint32); ok {
+			return int64(n)
+		}
+	case spTypeInt64:
+		if n, ok := v.(uint64); ok {
+			return int64(n)
+		}
+	case spTypeUInt64, spTypeDateTime:
+		if n, ok := v.(uint64); ok {
+			return n
+		}
+	}
+	return v
+}
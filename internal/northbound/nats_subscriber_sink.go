@@ -9,6 +9,7 @@ import (
 
 	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/codec"
 	"github.com/y001j/iot-gateway/internal/model"
 )
 
@@ -243,7 +244,7 @@ func (s *NATSSubscriberSink) createMessageHandler(subConfig SubscriptionConfig)
 			Msg("🔍 NATS订阅器接收到原始消息")
 		
 		// 根据数据类型解析消息
-		point, err := s.parseMessage(msg.Data, subConfig)
+		point, err := s.parseMessage(msg, subConfig)
 		if err != nil {
 			s.HandleError(err, fmt.Sprintf("解析%s消息", subConfig.DataType))
 			return
@@ -270,13 +271,14 @@ func (s *NATSSubscriberSink) createMessageHandler(subConfig SubscriptionConfig)
 }
 
 // parseMessage 解析消息
-func (s *NATSSubscriberSink) parseMessage(data []byte, subConfig SubscriptionConfig) (model.Point, error) {
+func (s *NATSSubscriberSink) parseMessage(msg *nats.Msg, subConfig SubscriptionConfig) (model.Point, error) {
 	var point model.Point
+	data := msg.Data
 
 	switch subConfig.DataType {
 	case "raw":
-		// 原始数据点格式
-		if err := json.Unmarshal(data, &point); err != nil {
+		// 原始数据点格式，编码由消息的Content-Type头决定
+		if err := codec.DecodeMsg(msg, &point); err != nil {
 			return point, fmt.Errorf("解析原始数据失败: %w", err)
 		}
 
@@ -0,0 +1,596 @@
+package opcua_server
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// gatewayNamespace 网关节点所在的命名空间索引
+const gatewayNamespace = 1
+
+// reference 节点引用
+type reference struct {
+	typeID  nodeID
+	target  nodeID
+	forward bool
+}
+
+// node 地址空间中的节点
+type node struct {
+	id          nodeID
+	class       uint32
+	browseName  qualifiedName
+	displayName string
+	description string
+	refs        []reference
+
+	// 变量节点
+	value     dataValue
+	dataType  nodeID
+	valueRank int32
+	writable  bool
+	dynamic   func() dataValue // 动态值（如服务器当前时间）
+
+	// 类型节点
+	isAbstract  bool
+	symmetric   bool
+	inverseName string
+
+	// 网关数据点绑定
+	deviceID string
+	key      string
+	field    string
+}
+
+// addressSpace 地址空间，读写均加锁
+type addressSpace struct {
+	mu       sync.RWMutex
+	nodes    map[nodeID]*node
+	root     nodeID
+	onChange func(id nodeID, dv dataValue) // 变量值变化回调，用于订阅
+}
+
+// newAddressSpace 创建包含标准节点的地址空间
+func newAddressSpace(rootName string, status func() serverStatus) *addressSpace {
+	as := &addressSpace{nodes: make(map[nodeID]*node)}
+	as.buildStandardNodes(status)
+
+	as.root = stringID(gatewayNamespace, rootName)
+	as.addNode(&node{
+		id:          as.root,
+		class:       nodeClassObject,
+		browseName:  qualifiedName{ns: gatewayNamespace, name: rootName},
+		displayName: rootName,
+		description: "IoT网关设备数据",
+	}, numericID(0, idObjectsFolder), numericID(0, idOrganizes), numericID(0, idFolderType))
+
+	return as
+}
+
+// addNode 添加节点并建立父子引用和类型定义引用
+func (as *addressSpace) addNode(n *node, parent, refType, typeDef nodeID) {
+	if n.displayName == "" {
+		n.displayName = n.browseName.name
+	}
+	as.nodes[n.id] = n
+	if !parent.isNull() {
+		as.addReference(parent, refType, n.id)
+	}
+	if !typeDef.isNull() {
+		n.refs = append(n.refs, reference{typeID: numericID(0, idHasTypeDefinition), target: typeDef, forward: true})
+	}
+}
+
+// addReference 添加正向引用及对应的反向引用
+func (as *addressSpace) addReference(source, refType, target nodeID) {
+	if src, ok := as.nodes[source]; ok {
+		src.refs = append(src.refs, reference{typeID: refType, target: target, forward: true})
+	}
+	if dst, ok := as.nodes[target]; ok {
+		dst.refs = append(dst.refs, reference{typeID: refType, target: source, forward: false})
+	}
+}
+
+func (as *addressSpace) get(id nodeID) (*node, bool) {
+	n, ok := as.nodes[id]
+	return n, ok
+}
+
+// isSubtype 判断引用类型是否为base或其子类型
+func (as *addressSpace) isSubtype(refType, base nodeID) bool {
+	for depth := 0; depth < 10; depth++ {
+		if refType == base {
+			return true
+		}
+		n, ok := as.nodes[refType]
+		if !ok {
+			return false
+		}
+		parent := nodeID{}
+		for _, ref := range n.refs {
+			if !ref.forward && ref.typeID == numericID(0, idHasSubtype) {
+				parent = ref.target
+				break
+			}
+		}
+		if parent.isNull() {
+			return false
+		}
+		refType = parent
+	}
+	return false
+}
+
+// typeDefinition 节点的类型定义
+func (as *addressSpace) typeDefinition(n *node) nodeID {
+	for _, ref := range n.refs {
+		if ref.forward && ref.typeID == numericID(0, idHasTypeDefinition) {
+			return ref.target
+		}
+	}
+	return nodeID{}
+}
+
+// child 按浏览名称查找层级子节点
+func (as *addressSpace) child(parent nodeID, name qualifiedName) (nodeID, bool) {
+	n, ok := as.nodes[parent]
+	if !ok {
+		return nodeID{}, false
+	}
+	for _, ref := range n.refs {
+		if !ref.forward || !as.isSubtype(ref.typeID, numericID(0, idHierarchicalRefs)) {
+			continue
+		}
+		if target, ok := as.nodes[ref.target]; ok && target.browseName == name {
+			return ref.target, true
+		}
+	}
+	return nodeID{}, false
+}
+
+// updatePoint 写入数据点值，节点不存在时自动创建设备文件夹和变量
+func (as *addressSpace) updatePoint(deviceID, key string, value interface{}, status uint32, sourceTime, serverTime time.Time, writable bool) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	deviceNode := as.ensureDevice(deviceID)
+	varID := stringID(gatewayNamespace, deviceID+"."+key)
+
+	fields, composite := compositeFields(value)
+	mainValue := value
+	if composite {
+		data, _ := json.Marshal(value)
+		mainValue = string(data)
+	}
+
+	as.setVariable(varID, deviceNode, numericID(0, idOrganizes), key, deviceID, key, "", mainValue, status, sourceTime, serverTime, writable && !composite)
+
+	// 复合数据展开为结构化子节点
+	if composite {
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fieldID := stringID(gatewayNamespace, deviceID+"."+key+"."+name)
+			as.setVariable(fieldID, varID, numericID(0, idHasComponent), name, deviceID, key, name, fields[name], status, sourceTime, serverTime, false)
+		}
+	}
+}
+
+// ensureDevice 获取或创建设备文件夹
+func (as *addressSpace) ensureDevice(deviceID string) nodeID {
+	id := stringID(gatewayNamespace, deviceID)
+	if _, ok := as.nodes[id]; !ok {
+		as.addNode(&node{
+			id:         id,
+			class:      nodeClassObject,
+			browseName: qualifiedName{ns: gatewayNamespace, name: deviceID},
+		}, as.root, numericID(0, idOrganizes), numericID(0, idFolderType))
+	}
+	return id
+}
+
+// setVariable 更新变量值，必要时创建变量节点
+func (as *addressSpace) setVariable(id, parent, refType nodeID, name, deviceID, key, field string, value interface{}, status uint32, sourceTime, serverTime time.Time, writable bool) {
+	v := variantOf(value)
+	n, ok := as.nodes[id]
+	if !ok {
+		n = &node{
+			id:         id,
+			class:      nodeClassVariable,
+			browseName: qualifiedName{ns: gatewayNamespace, name: name},
+			deviceID:   deviceID,
+			key:        key,
+			field:      field,
+		}
+		as.addNode(n, parent, refType, numericID(0, idBaseDataVariableType))
+	}
+
+	n.writable = writable
+	n.dataType = dataTypeOf(v)
+	n.valueRank = -1
+	if v.array {
+		n.valueRank = 1
+	}
+	n.value = dataValue{hasValue: true, value: v, status: status, sourceTime: sourceTime, serverTime: serverTime}
+
+	if as.onChange != nil {
+		as.onChange(id, n.value)
+	}
+}
+
+// compositeFields 将复合数据展开为字段，非复合值返回false
+func compositeFields(value interface{}) (map[string]interface{}, bool) {
+	switch value.(type) {
+	case nil, bool, string, int, int32, int64, uint32, uint64, float32, float64:
+		return nil, false
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, false
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, false
+	}
+
+	fields := make(map[string]interface{}, len(raw))
+	for name, v := range raw {
+		fields[name] = fieldValue(v)
+	}
+	return fields, true
+}
+
+// fieldValue 将JSON字段转换为可编码的变体值
+func fieldValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case float64, string, bool:
+		return val
+	case []interface{}:
+		numbers := make([]float64, 0, len(val))
+		for _, item := range val {
+			f, ok := item.(float64)
+			if !ok {
+				data, _ := json.Marshal(val)
+				return string(data)
+			}
+			numbers = append(numbers, f)
+		}
+		return numbers
+	case nil:
+		return nil
+	default:
+		data, _ := json.Marshal(val)
+		return string(data)
+	}
+}
+
+// serverStatus 服务器状态
+type serverStatus struct {
+	startTime    time.Time
+	productName  string
+	productURI   string
+	manufacturer string
+	version      string
+}
+
+// buildStandardNodes 创建命名空间0中客户端浏览所需的标准节点
+func (as *addressSpace) buildStandardNodes(status func() serverStatus) {
+	ns0 := func(id uint32) nodeID { return numericID(0, id) }
+	organizes, hasComponent, hasProperty, hasSubtype := ns0(idOrganizes), ns0(idHasComponent), ns0(idHasProperty), ns0(idHasSubtype)
+	folderType := ns0(idFolderType)
+
+	object := func(id uint32, name string, parent uint32, ref nodeID, typeDef uint32) {
+		as.addNode(&node{id: ns0(id), class: nodeClassObject, browseName: qualifiedName{name: name}}, ns0(parent), ref, ns0(typeDef))
+	}
+
+	// 文件夹
+	as.addNode(&node{id: ns0(idRootFolder), class: nodeClassObject, browseName: qualifiedName{name: "Root"}}, nodeID{}, nodeID{}, folderType)
+	object(idObjectsFolder, "Objects", idRootFolder, organizes, idFolderType)
+	object(idTypesFolder, "Types", idRootFolder, organizes, idFolderType)
+	object(idViewsFolder, "Views", idRootFolder, organizes, idFolderType)
+	object(idObjectTypesFolder, "ObjectTypes", idTypesFolder, organizes, idFolderType)
+	object(idVariableTypesFolder, "VariableTypes", idTypesFolder, organizes, idFolderType)
+	object(idDataTypesFolder, "DataTypes", idTypesFolder, organizes, idFolderType)
+	object(idReferenceTypesFolder, "ReferenceTypes", idTypesFolder, organizes, idFolderType)
+
+	// 引用类型
+	refType := func(id uint32, name, inverse string, parent uint32, abstract, symmetric bool) {
+		ref := hasSubtype
+		if parent == idReferenceTypesFolder {
+			ref = organizes
+		}
+		as.addNode(&node{
+			id: ns0(id), class: nodeClassRefType, browseName: qualifiedName{name: name},
+			isAbstract: abstract, symmetric: symmetric, inverseName: inverse,
+		}, ns0(parent), ref, nodeID{})
+	}
+	refType(idReferences, "References", "", idReferenceTypesFolder, true, true)
+	refType(idHierarchicalRefs, "HierarchicalReferences", "", idReferences, true, false)
+	refType(idNonHierarchicalRefs, "NonHierarchicalReferences", "", idReferences, true, false)
+	refType(idHasChild, "HasChild", "", idHierarchicalRefs, true, false)
+	refType(idOrganizes, "Organizes", "OrganizedBy", idHierarchicalRefs, false, false)
+	refType(idAggregates, "Aggregates", "", idHasChild, true, false)
+	refType(idHasSubtype, "HasSubtype", "SubtypeOf", idHasChild, false, false)
+	refType(idHasComponent, "HasComponent", "ComponentOf", idAggregates, false, false)
+	refType(idHasProperty, "HasProperty", "PropertyOf", idAggregates, false, false)
+	refType(idHasTypeDefinition, "HasTypeDefinition", "TypeDefinitionOf", idNonHierarchicalRefs, false, false)
+
+	// 对象类型和变量类型
+	typeNode := func(id uint32, class uint32, name string, parent uint32, abstract bool) {
+		ref := hasSubtype
+		if parent == idObjectTypesFolder || parent == idVariableTypesFolder || parent == idDataTypesFolder {
+			ref = organizes
+		}
+		as.addNode(&node{id: ns0(id), class: class, browseName: qualifiedName{name: name}, isAbstract: abstract}, ns0(parent), ref, nodeID{})
+	}
+	typeNode(idBaseObjectType, nodeClassObjectType, "BaseObjectType", idObjectTypesFolder, false)
+	typeNode(idFolderType, nodeClassObjectType, "FolderType", idBaseObjectType, false)
+	typeNode(idServerType, nodeClassObjectType, "ServerType", idBaseObjectType, false)
+	typeNode(idBaseVariableType, nodeClassVarType, "BaseVariableType", idVariableTypesFolder, true)
+	typeNode(idBaseDataVariableType, nodeClassVarType, "BaseDataVariableType", idBaseVariableType, false)
+	typeNode(idPropertyType, nodeClassVarType, "PropertyType", idBaseVariableType, false)
+	typeNode(idServerStatusType, nodeClassVarType, "ServerStatusType", idBaseDataVariableType, false)
+
+	// 数据类型
+	typeNode(idBaseDataType, nodeClassDataType, "BaseDataType", idDataTypesFolder, true)
+	for _, dt := range []struct {
+		id   uint32
+		name string
+	}{
+		{idBoolean, "Boolean"}, {idInt32, "Int32"}, {idInt64, "Int64"}, {idDouble, "Double"},
+		{idString, "String"}, {idDateTime, "DateTime"}, {idLocalizedText, "LocalizedText"},
+		{uint32(typeFloat), "Float"}, {uint32(typeUInt32), "UInt32"},
+	} {
+		typeNode(dt.id, nodeClassDataType, dt.name, idBaseDataType, false)
+	}
+	typeNode(idStructure, nodeClassDataType, "Structure", idBaseDataType, true)
+	typeNode(idServerStatusDataType, nodeClassDataType, "ServerStatusDataType", idStructure, false)
+	typeNode(idBuildInfo, nodeClassDataType, "BuildInfo", idStructure, false)
+	typeNode(idServerState, nodeClassDataType, "ServerState", idBaseDataType, false)
+
+	// Server对象
+	object(idServer, "Server", idObjectsFolder, organizes, idServerType)
+	as.nodes[ns0(idServer)].displayName = "Server"
+
+	variable := func(id uint32, name string, parent uint32, ref nodeID, typeDef uint32, dataType uint32, rank int32, fn func() dataValue) {
+		as.addNode(&node{
+			id: ns0(id), class: nodeClassVariable, browseName: qualifiedName{name: name},
+			dataType: ns0(dataType), valueRank: rank, dynamic: fn,
+		}, ns0(parent), ref, ns0(typeDef))
+	}
+	static := func(v interface{}) func() dataValue {
+		return func() dataValue {
+			return dataValue{hasValue: true, value: variantOf(v), serverTime: time.Now()}
+		}
+	}
+
+	variable(idServerArray, "ServerArray", idServer, hasProperty, idPropertyType, idString, 1, func() dataValue {
+		return dataValue{hasValue: true, value: variantOf([]string{status().productURI}), serverTime: time.Now()}
+	})
+	variable(idNamespaceArray, "NamespaceArray", idServer, hasProperty, idPropertyType, idString, 1, func() dataValue {
+		return dataValue{hasValue: true, value: variantOf([]string{"http://opcfoundation.org/UA/", status().productURI}), serverTime: time.Now()}
+	})
+	variable(idServiceLevel, "ServiceLevel", idServer, hasProperty, idPropertyType, uint32(typeByte), -1, static(variant{typeID: typeByte, value: byte(255)}))
+	variable(idServerStatus, "ServerStatus", idServer, hasComponent, idServerStatusType, idServerStatusDataType, -1, func() dataValue {
+		return dataValue{hasValue: true, value: variant{typeID: typeExtensionObject, value: extensionObject{
+			typeID: idServerStatusDataTypeEncoding, body: encodeServerStatus(status()),
+		}}, serverTime: time.Now()}
+	})
+	variable(idServerStatusStartTime, "StartTime", idServerStatus, hasComponent, idBaseDataVariableType, idDateTime, -1, func() dataValue {
+		return dataValue{hasValue: true, value: variantOf(status().startTime), serverTime: time.Now()}
+	})
+	variable(idServerStatusCurrentTime, "CurrentTime", idServerStatus, hasComponent, idBaseDataVariableType, idDateTime, -1, func() dataValue {
+		return dataValue{hasValue: true, value: variantOf(time.Now()), serverTime: time.Now()}
+	})
+	variable(idServerStatusState, "State", idServerStatus, hasComponent, idBaseDataVariableType, idServerState, -1, static(int32(0)))
+}
+
+// encodeServerStatus 编码ServerStatusDataType结构
+func encodeServerStatus(st serverStatus) []byte {
+	e := &encoder{}
+	e.dateTime(st.startTime)
+	e.dateTime(time.Now())
+	e.int32(0) // Running
+	// BuildInfo
+	e.string(st.productURI)
+	e.string(st.manufacturer)
+	e.string(st.productName)
+	e.string(st.version)
+	e.string(st.version)
+	e.dateTime(st.startTime)
+	e.uint32(0)
+	e.localizedText("")
+	return e.bytes()
+}
+
+// readAttribute 读取节点属性
+func (as *addressSpace) readAttribute(id nodeID, attr uint32) dataValue {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	n, ok := as.nodes[id]
+	if !ok {
+		return dataValue{status: statusBadNodeIDUnknown}
+	}
+
+	val := func(v interface{}) dataValue { return dataValue{hasValue: true, value: variantOf(v)} }
+	switch attr {
+	case attrNodeID:
+		return val(variant{typeID: typeNodeID, value: n.id})
+	case attrNodeClass:
+		return val(int32(n.class))
+	case attrBrowseName:
+		return val(variant{typeID: typeQualifiedName, value: n.browseName})
+	case attrDisplayName:
+		return val(variant{typeID: typeLocalizedText, value: n.displayName})
+	case attrDescription:
+		return val(variant{typeID: typeLocalizedText, value: n.description})
+	case attrWriteMask, attrUserWriteMask:
+		return val(uint32(0))
+	}
+
+	switch n.class {
+	case nodeClassObject:
+		if attr == attrEventNotifier {
+			return val(variant{typeID: typeByte, value: byte(0)})
+		}
+	case nodeClassObjectType, nodeClassVarType, nodeClassDataType:
+		if attr == attrIsAbstract {
+			return val(n.isAbstract)
+		}
+		if n.class == nodeClassVarType {
+			switch attr {
+			case attrDataType:
+				return val(variant{typeID: typeNodeID, value: numericID(0, idBaseDataType)})
+			case attrValueRank:
+				return val(int32(-2))
+			}
+		}
+	case nodeClassRefType:
+		switch attr {
+		case attrIsAbstract:
+			return val(n.isAbstract)
+		case attrSymmetric:
+			return val(n.symmetric)
+		case attrInverseName:
+			return val(variant{typeID: typeLocalizedText, value: n.inverseName})
+		}
+	case nodeClassVariable:
+		switch attr {
+		case attrValue:
+			if n.dynamic != nil {
+				return n.dynamic()
+			}
+			return n.value
+		case attrDataType:
+			return val(variant{typeID: typeNodeID, value: n.dataType})
+		case attrValueRank:
+			return val(n.valueRank)
+		case attrArrayDimensions:
+			if n.valueRank == 1 {
+				return val(variant{typeID: typeUInt32, array: true, value: []interface{}{uint32(0)}})
+			}
+			return dataValue{}
+		case attrAccessLevel, attrUserAccessLevel:
+			level := byte(0x01)
+			if n.writable {
+				level |= 0x02
+			}
+			return val(variant{typeID: typeByte, value: level})
+		case attrMinimumSamplingInterval:
+			return val(float64(0))
+		case attrHistorizing:
+			return val(false)
+		}
+	}
+
+	return dataValue{status: statusBadAttributeIDInvalid}
+}
+
+// browse 返回满足条件的引用描述
+func (as *addressSpace) browse(bd browseDescription) ([]referenceDescription, uint32) {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	n, ok := as.nodes[bd.nodeID]
+	if !ok {
+		return nil, statusBadNodeIDUnknown
+	}
+
+	var results []referenceDescription
+	for _, ref := range n.refs {
+		switch bd.direction {
+		case 0:
+			if !ref.forward {
+				continue
+			}
+		case 1:
+			if ref.forward {
+				continue
+			}
+		}
+		if !bd.refType.isNull() {
+			if bd.includeSubtypes {
+				if !as.isSubtype(ref.typeID, bd.refType) {
+					continue
+				}
+			} else if ref.typeID != bd.refType {
+				continue
+			}
+		}
+
+		target, ok := as.nodes[ref.target]
+		if !ok {
+			continue
+		}
+		if bd.nodeClassMask != 0 && bd.nodeClassMask&target.class == 0 {
+			continue
+		}
+
+		results = append(results, referenceDescription{
+			refType:     ref.typeID,
+			forward:     ref.forward,
+			target:      target.id,
+			browseName:  target.browseName,
+			displayName: target.displayName,
+			nodeClass:   target.class,
+			typeDef:     as.typeDefinition(target),
+		})
+	}
+	return results, statusGood
+}
+
+// translatePath 沿相对路径查找目标节点
+func (as *addressSpace) translatePath(start nodeID, names []qualifiedName) (nodeID, uint32) {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	if _, ok := as.nodes[start]; !ok {
+		return nodeID{}, statusBadNodeIDUnknown
+	}
+	current := start
+	for _, name := range names {
+		next, ok := as.child(current, name)
+		if !ok {
+			return nodeID{}, statusBadNoMatch
+		}
+		current = next
+	}
+	return current, statusGood
+}
+
+// pointBinding 返回变量节点绑定的数据点
+func (as *addressSpace) pointBinding(id nodeID) (deviceID, key string, writable, found bool) {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	n, ok := as.nodes[id]
+	if !ok {
+		return "", "", false, false
+	}
+	return n.deviceID, n.key, n.writable, true
+}
+
+// countVariables 统计网关变量节点数
+func (as *addressSpace) countVariables() (devices, variables int) {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	for id, n := range as.nodes {
+		if id.ns != gatewayNamespace || n.id == as.root {
+			continue
+		}
+		if n.class == nodeClassVariable {
+			variables++
+		} else if n.class == nodeClassObject {
+			devices++
+		}
+	}
+	return devices, variables
+}
@@ -0,0 +1,528 @@
+package opcua_server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// 传输层参数
+const (
+	protocolVersion   = 0
+	serverBufferSize  = 65536
+	maxMessageSize    = 16 * 1024 * 1024
+	minBufferSize     = 8192
+	symmetricOverhead = 24 // 消息头(8) + 通道ID(4) + TokenID(4) + 序列号头(8)
+)
+
+// secureChannel 一个TCP连接上的安全通道
+type secureChannel struct {
+	srv       *uaServer
+	conn      net.Conn
+	writeMu   sync.Mutex
+	channelID uint32
+	tokenID   uint32
+	seq       atomic.Uint32
+	chunkSize int               // 发送分片大小，取客户端接收缓冲区
+	partial   map[uint32][]byte // requestId -> 未完成的分片
+	closed    atomic.Bool
+
+	// 以下字段在OPN时由serve协程在writeMu内修改
+	policy        string                  // 安全策略URI
+	mode          uint32                  // 消息安全模式
+	clientCert    *x509.Certificate       // 客户端应用实例证书，None策略下为空
+	clientCertDER []byte                  // 客户端证书原始DER，用于会话签名校验
+	tokens        map[uint32]channelToken // TokenID -> 对称密钥，续期期间新旧令牌并存
+	sendToken     uint32                  // 发送消息使用的令牌，客户端开始使用新令牌后切换
+}
+
+// channelToken 一个安全令牌的对称密钥
+type channelToken struct {
+	remote symmetricKeys // 客户端发送消息使用的密钥
+	local  symmetricKeys // 服务端发送消息使用的密钥
+}
+
+// secured 通道是否对消息签名
+func (ch *secureChannel) secured() bool {
+	return ch.mode == securityModeSign || ch.mode == securityModeSignAndEncrypt
+}
+
+// serve 处理连接直到关闭
+func (ch *secureChannel) serve() {
+	defer ch.close()
+
+	remote := ch.conn.RemoteAddr().String()
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(ch.conn, header); err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Debug().Err(err).Str("remote", remote).Msg("OPC UA连接关闭")
+			}
+			return
+		}
+
+		msgType := string(header[0:3])
+		size := int(binary.LittleEndian.Uint32(header[4:8]))
+		if size < 8 || size > maxMessageSize {
+			ch.sendError(statusBadTCPMessageTypeInvalid, "invalid message size")
+			return
+		}
+		body := make([]byte, size-8)
+		if _, err := io.ReadFull(ch.conn, body); err != nil {
+			return
+		}
+
+		var err error
+		switch msgType {
+		case "HEL":
+			err = ch.handleHello(body)
+		case "OPN":
+			err = ch.handleOpen(header, body)
+		case "MSG":
+			err = ch.handleMessage(header, body)
+		case "CLO":
+			return
+		default:
+			ch.sendError(statusBadTCPMessageTypeInvalid, "unsupported message type "+msgType)
+			return
+		}
+		if err != nil {
+			log.Warn().Err(err).Str("remote", remote).Str("type", msgType).Msg("处理OPC UA消息失败，关闭连接")
+			return
+		}
+	}
+}
+
+func (ch *secureChannel) handleHello(body []byte) error {
+	d := newDecoder(body)
+	d.uint32() // ProtocolVersion
+	receiveBuffer := d.uint32()
+	sendBuffer := d.uint32()
+	d.uint32() // MaxMessageSize
+	d.uint32() // MaxChunkCount
+	endpoint := d.string()
+	if d.err != nil {
+		return d.err
+	}
+
+	ch.chunkSize = int(receiveBuffer)
+	if ch.chunkSize > serverBufferSize || ch.chunkSize == 0 {
+		ch.chunkSize = serverBufferSize
+	}
+	if ch.chunkSize < minBufferSize {
+		ch.chunkSize = minBufferSize
+	}
+	recv := sendBuffer
+	if recv > serverBufferSize || recv == 0 {
+		recv = serverBufferSize
+	}
+
+	e := &encoder{}
+	e.uint32(protocolVersion)
+	e.uint32(recv)
+	e.uint32(uint32(ch.chunkSize))
+	e.uint32(maxMessageSize)
+	e.uint32(0)
+
+	log.Debug().Str("endpoint", endpoint).Int("chunk_size", ch.chunkSize).Msg("OPC UA握手")
+	return ch.writeFrame("ACK", 'F', e.bytes())
+}
+
+func (ch *secureChannel) handleOpen(header, body []byte) error {
+	d := newDecoder(body)
+	d.uint32() // SecureChannelId
+	policy := d.string()
+	senderCert := d.byteString()
+	receiverThumbprint := d.byteString()
+	if d.err != nil {
+		return d.err
+	}
+	securityHeader := body[:len(body)-len(d.remaining())]
+
+	if !ch.srv.acceptsPolicy(policy) {
+		ch.sendError(statusBadSecurityPolicyRejected, "security policy not supported: "+policy)
+		return fmt.Errorf("不支持的安全策略: %s", policy)
+	}
+	if ch.channelID != 0 && policy != ch.policy {
+		ch.sendError(statusBadSecurityPolicyRejected, "security policy cannot change on renew")
+		return fmt.Errorf("续期时安全策略不能改变: %s", policy)
+	}
+
+	plain := d.remaining()
+	var clientCert *x509.Certificate
+	if policy != securityPolicyNone {
+		sec := ch.srv.opts.security
+		cert, status := sec.verifyClient(senderCert)
+		if status != statusGood {
+			ch.sendError(status, "client certificate rejected")
+			return fmt.Errorf("客户端证书校验失败: 0x%08X", status)
+		}
+		if !bytes.Equal(receiverThumbprint, sec.thumbprint) {
+			ch.sendError(statusBadCertificateInvalid, "receiver certificate thumbprint mismatch")
+			return fmt.Errorf("接收方证书指纹与服务端证书不一致")
+		}
+		var err error
+		if plain, err = ch.openAsymmetric(header, securityHeader, plain, cert); err != nil {
+			ch.sendError(statusBadSecurityChecksFailed, "security checks failed")
+			return err
+		}
+		clientCert = cert
+	}
+
+	d = newDecoder(plain)
+	d.uint32() // SequenceNumber
+	requestID := d.uint32()
+	typeID := d.nodeID()
+	if d.err != nil {
+		return d.err
+	}
+	if typeID.num != idOpenSecureChannelRequest {
+		return fmt.Errorf("期望OpenSecureChannelRequest，收到 %d", typeID.num)
+	}
+
+	hdr := decodeRequestHeader(d)
+	d.uint32() // ClientProtocolVersion
+	requestType := d.uint32()
+	securityMode := d.uint32()
+	clientNonce := d.byteString()
+	lifetime := d.uint32()
+	if d.err != nil {
+		return d.err
+	}
+	if !ch.srv.acceptsMode(policy, securityMode) || (ch.channelID != 0 && securityMode != ch.mode) {
+		ch.sendError(statusBadSecurityPolicyRejected, "security mode not supported")
+		return fmt.Errorf("安全策略%s不支持安全模式: %d", policy, securityMode)
+	}
+	var serverNonce []byte
+	if policy != securityPolicyNone {
+		if len(clientNonce) != nonceLength {
+			ch.sendError(statusBadNonceInvalid, "invalid client nonce")
+			return fmt.Errorf("客户端Nonce长度无效: %d", len(clientNonce))
+		}
+		serverNonce = randomBytes(nonceLength)
+	}
+	if lifetime == 0 || lifetime > 3600000 {
+		lifetime = 3600000
+	}
+
+	ch.writeMu.Lock()
+	defer ch.writeMu.Unlock()
+
+	if requestType == 0 || ch.channelID == 0 {
+		ch.channelID = ch.srv.nextChannelID.Add(1)
+	}
+	ch.tokenID++
+	ch.policy, ch.mode = policy, securityMode
+	if clientCert != nil {
+		ch.clientCert, ch.clientCertDER = clientCert, senderCert
+	}
+	if ch.secured() {
+		if ch.tokens == nil {
+			ch.tokens = make(map[uint32]channelToken)
+		}
+		ch.tokens[ch.tokenID] = channelToken{
+			remote: deriveKeys(serverNonce, clientNonce),
+			local:  deriveKeys(clientNonce, serverNonce),
+		}
+	}
+	if ch.sendToken == 0 {
+		ch.sendToken = ch.tokenID
+	}
+
+	h := &encoder{}
+	h.uint32(ch.channelID)
+	h.string(policy)
+	if policy == securityPolicyNone {
+		h.byteString(nil)
+		h.byteString(nil)
+	} else {
+		thumbprint := sha1.Sum(ch.clientCertDER)
+		h.byteString(ch.srv.opts.security.certificate)
+		h.byteString(thumbprint[:])
+	}
+
+	e := &encoder{}
+	e.uint32(ch.nextSeq())
+	e.uint32(requestID)
+	e.nodeID(numericID(0, idOpenSecureChannelResponse))
+	encodeResponseHeader(e, hdr.handle, statusGood)
+	e.uint32(protocolVersion)
+	e.uint32(ch.channelID)
+	e.uint32(ch.tokenID)
+	e.dateTime(time.Now())
+	e.uint32(lifetime)
+	e.byteString(serverNonce)
+
+	if policy == securityPolicyNone {
+		return ch.writeFrameLocked("OPN", 'F', append(h.bytes(), e.bytes()...))
+	}
+	frame, err := ch.sealAsymmetric(h.bytes(), e.bytes())
+	if err != nil {
+		return err
+	}
+	return ch.writeRawLocked(frame)
+}
+
+// openAsymmetric 解密并校验OPN消息，返回去掉填充和签名后的明文（从序列号头开始）
+func (ch *secureChannel) openAsymmetric(header, securityHeader, data []byte, cert *x509.Certificate) ([]byte, error) {
+	sec := ch.srv.opts.security
+	plain, err := sec.decrypt(data)
+	if err != nil {
+		return nil, fmt.Errorf("解密OPN消息失败: %w", err)
+	}
+	pub := cert.PublicKey.(*rsa.PublicKey)
+	sigLen := pub.Size()
+	if len(plain) < sigLen {
+		return nil, fmt.Errorf("OPN消息缺少签名")
+	}
+	content, signature := plain[:len(plain)-sigLen], plain[len(plain)-sigLen:]
+	signed := make([]byte, 0, len(header)+len(securityHeader)+len(content))
+	signed = append(append(append(signed, header...), securityHeader...), content...)
+	if err := rsaVerify(pub, signed, signature); err != nil {
+		return nil, fmt.Errorf("OPN消息签名无效: %w", err)
+	}
+	return stripPadding(content, sec.key.Size() > 256)
+}
+
+// sealAsymmetric 填充、签名并用客户端公钥加密OPN响应，返回完整消息
+func (ch *secureChannel) sealAsymmetric(securityHeader, plain []byte) ([]byte, error) {
+	sec := ch.srv.opts.security
+	pub := ch.clientCert.PublicKey.(*rsa.PublicKey)
+	cipherBlock := pub.Size()
+	plainBlock := cipherBlock - oaepSHA1Overhead
+	sigLen := sec.key.Size()
+
+	plain = appendPadding(plain, plainBlock, sigLen, cipherBlock > 256)
+	size := 8 + len(securityHeader) + (len(plain)+sigLen)/plainBlock*cipherBlock
+	frame := frameHeader("OPN", 'F', size)
+	frame = append(frame, securityHeader...)
+
+	signature, err := sec.sign(append(append([]byte(nil), frame...), plain...))
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := rsaEncrypt(pub, append(plain, signature...))
+	if err != nil {
+		return nil, err
+	}
+	return append(frame, encrypted...), nil
+}
+
+func (ch *secureChannel) handleMessage(header, body []byte) error {
+	chunkType := header[3]
+	d := newDecoder(body)
+	channelID := d.uint32()
+	tokenID := d.uint32()
+	if d.err != nil {
+		return d.err
+	}
+	if channelID != ch.channelID || ch.channelID == 0 {
+		ch.sendError(statusBadSecureChannelIDInvalid, "invalid secure channel")
+		return fmt.Errorf("无效的安全通道ID: %d", channelID)
+	}
+	if ch.secured() {
+		plain, err := ch.openSymmetric(header, body[:8], d.remaining(), tokenID)
+		if err != nil {
+			ch.sendError(statusBadSecurityChecksFailed, "security checks failed")
+			return err
+		}
+		d = newDecoder(plain)
+	}
+	d.uint32() // SequenceNumber
+	requestID := d.uint32()
+	if d.err != nil {
+		return d.err
+	}
+
+	switch chunkType {
+	case 'C':
+		ch.partial[requestID] = append(ch.partial[requestID], d.remaining()...)
+		if len(ch.partial[requestID]) > maxMessageSize {
+			return fmt.Errorf("消息超过最大长度")
+		}
+		return nil
+	case 'A':
+		delete(ch.partial, requestID)
+		return nil
+	}
+
+	payload := d.remaining()
+	if prev, ok := ch.partial[requestID]; ok {
+		payload = append(prev, payload...)
+		delete(ch.partial, requestID)
+	}
+
+	ch.srv.dispatch(ch, requestID, payload)
+	return nil
+}
+
+// openSymmetric 校验签名并在SignAndEncrypt模式下解密，返回序列号头开始的明文
+// 客户端首次使用续期后的新令牌时，服务端随之切换并丢弃旧令牌
+func (ch *secureChannel) openSymmetric(header, prefix, data []byte, tokenID uint32) ([]byte, error) {
+	token, ok := ch.tokens[tokenID]
+	if !ok {
+		return nil, fmt.Errorf("未知的安全令牌: %d", tokenID)
+	}
+	keys := token.remote
+	if ch.mode == securityModeSignAndEncrypt {
+		if err := keys.crypt(data, false); err != nil {
+			return nil, err
+		}
+	}
+	if len(data) < symmetricSignatureSize {
+		return nil, fmt.Errorf("消息缺少签名")
+	}
+	content, signature := data[:len(data)-symmetricSignatureSize], data[len(data)-symmetricSignatureSize:]
+	if !hmac.Equal(keys.mac(header, prefix, content), signature) {
+		return nil, fmt.Errorf("消息签名无效")
+	}
+	if ch.mode == securityModeSignAndEncrypt {
+		var err error
+		if content, err = stripPadding(content, false); err != nil {
+			return nil, err
+		}
+	}
+
+	if tokenID != ch.sendToken {
+		ch.writeMu.Lock()
+		ch.sendToken = tokenID
+		for id := range ch.tokens {
+			if id < tokenID {
+				delete(ch.tokens, id)
+			}
+		}
+		ch.writeMu.Unlock()
+	}
+	return content, nil
+}
+
+// maxChunkBody 一个MSG分片可容纳的消息体长度
+func (ch *secureChannel) maxChunkBody() int {
+	switch ch.mode {
+	case securityModeSign:
+		return ch.chunkSize - symmetricOverhead - symmetricSignatureSize
+	case securityModeSignAndEncrypt:
+		// 序列号头起的部分加密，长度须为分组整数倍，并留出填充长度字节和签名
+		encrypted := (ch.chunkSize - 16) / symmetricBlockSize * symmetricBlockSize
+		return encrypted - 8 - 1 - symmetricSignatureSize
+	}
+	return ch.chunkSize - symmetricOverhead
+}
+
+// sendResponse 发送服务响应，超过分片大小时拆分为多个分片
+func (ch *secureChannel) sendResponse(requestID uint32, typeID uint32, body []byte) error {
+	e := &encoder{}
+	e.nodeID(numericID(0, typeID))
+	payload := append(e.bytes(), body...)
+
+	ch.writeMu.Lock()
+	defer ch.writeMu.Unlock()
+
+	maxBody := ch.maxChunkBody()
+	for {
+		chunk := payload
+		chunkType := byte('F')
+		if len(chunk) > maxBody {
+			chunk, chunkType = payload[:maxBody], 'C'
+		}
+		payload = payload[len(chunk):]
+
+		h := &encoder{}
+		h.uint32(ch.channelID)
+		h.uint32(ch.sendToken)
+		b := &encoder{}
+		b.uint32(ch.nextSeq())
+		b.uint32(requestID)
+		if err := ch.writeSymmetricLocked("MSG", chunkType, h.bytes(), append(b.bytes(), chunk...)); err != nil {
+			return err
+		}
+		if chunkType == 'F' {
+			return nil
+		}
+	}
+}
+
+// writeSymmetricLocked 按通道安全模式签名或加密后发送一个分片
+func (ch *secureChannel) writeSymmetricLocked(msgType string, chunkType byte, prefix, plain []byte) error {
+	if !ch.secured() {
+		return ch.writeFrameLocked(msgType, chunkType, append(prefix, plain...))
+	}
+	keys := ch.tokens[ch.sendToken].local
+	encrypt := ch.mode == securityModeSignAndEncrypt
+	if encrypt {
+		plain = appendPadding(plain, symmetricBlockSize, symmetricSignatureSize, false)
+	}
+	frame := frameHeader(msgType, chunkType, 8+len(prefix)+len(plain)+symmetricSignatureSize)
+	signature := keys.mac(frame, prefix, plain)
+	plain = append(plain, signature...)
+	if encrypt {
+		if err := keys.crypt(plain, true); err != nil {
+			return err
+		}
+	}
+	frame = append(append(frame, prefix...), plain...)
+	return ch.writeRawLocked(frame)
+}
+
+func (ch *secureChannel) sendError(code uint32, reason string) {
+	e := &encoder{}
+	e.uint32(code)
+	e.string(reason)
+	ch.writeFrame("ERR", 'F', e.bytes())
+}
+
+func (ch *secureChannel) writeFrame(msgType string, chunkType byte, body []byte) error {
+	ch.writeMu.Lock()
+	defer ch.writeMu.Unlock()
+	return ch.writeFrameLocked(msgType, chunkType, body)
+}
+
+func (ch *secureChannel) writeFrameLocked(msgType string, chunkType byte, body []byte) error {
+	if ch.closed.Load() {
+		return net.ErrClosed
+	}
+	return ch.writeRawLocked(append(frameHeader(msgType, chunkType, 8+len(body)), body...))
+}
+
+// writeRawLocked 发送已包含消息头的完整消息
+func (ch *secureChannel) writeRawLocked(frame []byte) error {
+	if ch.closed.Load() {
+		return net.ErrClosed
+	}
+	ch.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := ch.conn.Write(frame)
+	return err
+}
+
+// frameHeader 消息头：类型(3) + 分片类型(1) + 消息总长(4)
+func frameHeader(msgType string, chunkType byte, size int) []byte {
+	frame := make([]byte, 8, size)
+	copy(frame, msgType)
+	frame[3] = chunkType
+	binary.LittleEndian.PutUint32(frame[4:], uint32(size))
+	return frame
+}
+
+func (ch *secureChannel) nextSeq() uint32 {
+	return ch.seq.Add(1)
+}
+
+func (ch *secureChannel) close() {
+	if ch.closed.Swap(true) {
+		return
+	}
+	ch.conn.Close()
+	ch.srv.channelClosed(ch)
+}
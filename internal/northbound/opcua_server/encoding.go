@@ -0,0 +1,547 @@
+package opcua_server
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// OPC UA二进制编码（Part 6）的最小实现，仅覆盖本服务端用到的内置类型
+
+var errShortBuffer = errors.New("opcua: 数据长度不足")
+
+// 1601-01-01 到 1970-01-01 的100纳秒间隔数
+const epochDelta = 116444736000000000
+
+// encoder 按OPC UA二进制规则写入
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) bytes() []byte { return e.buf }
+
+func (e *encoder) boolean(v bool) {
+	if v {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) byte(v byte)     { e.buf = append(e.buf, v) }
+func (e *encoder) uint16(v uint16) { e.buf = binary.LittleEndian.AppendUint16(e.buf, v) }
+func (e *encoder) uint32(v uint32) { e.buf = binary.LittleEndian.AppendUint32(e.buf, v) }
+func (e *encoder) int32(v int32)   { e.uint32(uint32(v)) }
+func (e *encoder) uint64(v uint64) { e.buf = binary.LittleEndian.AppendUint64(e.buf, v) }
+func (e *encoder) int64(v int64)   { e.uint64(uint64(v)) }
+func (e *encoder) float(v float32) { e.uint32(math.Float32bits(v)) }
+func (e *encoder) double(v float64) {
+	e.uint64(math.Float64bits(v))
+}
+
+func (e *encoder) string(v string) {
+	e.int32(int32(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+// nullString 编码长度为-1的空字符串
+func (e *encoder) nullString() { e.int32(-1) }
+
+func (e *encoder) byteString(v []byte) {
+	if v == nil {
+		e.int32(-1)
+		return
+	}
+	e.int32(int32(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *encoder) dateTime(t time.Time) {
+	if t.IsZero() {
+		e.int64(0)
+		return
+	}
+	e.int64(t.UnixNano()/100 + epochDelta)
+}
+
+func (e *encoder) statusCode(v uint32) { e.uint32(v) }
+
+func (e *encoder) nodeID(id nodeID) {
+	switch {
+	case id.isString:
+		e.byte(0x03)
+		e.uint16(id.ns)
+		e.string(id.str)
+	case id.ns == 0 && id.num <= 0xFF:
+		e.byte(0x00)
+		e.byte(byte(id.num))
+	case id.ns <= 0xFF && id.num <= 0xFFFF:
+		e.byte(0x01)
+		e.byte(byte(id.ns))
+		e.uint16(uint16(id.num))
+	default:
+		e.byte(0x02)
+		e.uint16(id.ns)
+		e.uint32(id.num)
+	}
+}
+
+func (e *encoder) expandedNodeID(id nodeID) { e.nodeID(id) }
+
+func (e *encoder) qualifiedName(ns uint16, name string) {
+	e.uint16(ns)
+	e.string(name)
+}
+
+func (e *encoder) localizedText(text string) {
+	if text == "" {
+		e.byte(0)
+		return
+	}
+	e.byte(0x02)
+	e.string(text)
+}
+
+// nullExtensionObject 编码空的扩展对象
+func (e *encoder) nullExtensionObject() {
+	e.nodeID(nodeID{})
+	e.byte(0)
+}
+
+// extensionObject 编码以二进制编码的扩展对象
+func (e *encoder) extensionObject(typeID uint32, body []byte) {
+	e.nodeID(numericID(0, typeID))
+	e.byte(0x01)
+	e.byteString(body)
+}
+
+func (e *encoder) diagnosticInfo() { e.byte(0) }
+
+// emptyArray 编码长度为0的数组
+func (e *encoder) emptyArray() { e.int32(0) }
+
+func (e *encoder) stringArray(values []string) {
+	e.int32(int32(len(values)))
+	for _, v := range values {
+		e.string(v)
+	}
+}
+
+func (e *encoder) statusCodeArray(values []uint32) {
+	e.int32(int32(len(values)))
+	for _, v := range values {
+		e.statusCode(v)
+	}
+}
+
+func (e *encoder) variant(v variant) {
+	if v.typeID == 0 {
+		e.byte(0)
+		return
+	}
+	if v.array {
+		e.byte(v.typeID | 0x80)
+		values := v.value.([]interface{})
+		e.int32(int32(len(values)))
+		for _, item := range values {
+			e.scalar(v.typeID, item)
+		}
+		return
+	}
+	e.byte(v.typeID)
+	e.scalar(v.typeID, v.value)
+}
+
+func (e *encoder) scalar(typeID byte, value interface{}) {
+	switch typeID {
+	case typeBoolean:
+		e.boolean(value.(bool))
+	case typeByte:
+		e.byte(value.(byte))
+	case typeInt32:
+		e.int32(value.(int32))
+	case typeUInt32:
+		e.uint32(value.(uint32))
+	case typeInt64:
+		e.int64(value.(int64))
+	case typeFloat:
+		e.float(value.(float32))
+	case typeDouble:
+		e.double(value.(float64))
+	case typeString:
+		e.string(value.(string))
+	case typeDateTime:
+		e.dateTime(value.(time.Time))
+	case typeByteString:
+		e.byteString(value.([]byte))
+	case typeNodeID:
+		e.nodeID(value.(nodeID))
+	case typeStatusCode:
+		e.statusCode(value.(uint32))
+	case typeQualifiedName:
+		qn := value.(qualifiedName)
+		e.qualifiedName(qn.ns, qn.name)
+	case typeLocalizedText:
+		e.localizedText(value.(string))
+	case typeExtensionObject:
+		eo := value.(extensionObject)
+		e.extensionObject(eo.typeID, eo.body)
+	}
+}
+
+// dataValue 编码数据值
+func (e *encoder) dataValue(dv dataValue) {
+	var mask byte
+	if dv.hasValue {
+		mask |= 0x01
+	}
+	if dv.status != 0 {
+		mask |= 0x02
+	}
+	if !dv.sourceTime.IsZero() {
+		mask |= 0x04
+	}
+	if !dv.serverTime.IsZero() {
+		mask |= 0x08
+	}
+	e.byte(mask)
+	if dv.hasValue {
+		e.variant(dv.value)
+	}
+	if dv.status != 0 {
+		e.statusCode(dv.status)
+	}
+	if !dv.sourceTime.IsZero() {
+		e.dateTime(dv.sourceTime)
+	}
+	if !dv.serverTime.IsZero() {
+		e.dateTime(dv.serverTime)
+	}
+}
+
+// decoder 按OPC UA二进制规则读取，出错后后续读取均返回零值
+type decoder struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func newDecoder(buf []byte) *decoder { return &decoder{buf: buf} }
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || d.pos+n > len(d.buf) {
+		d.err = errShortBuffer
+		return nil
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+func (d *decoder) remaining() []byte {
+	if d.err != nil {
+		return nil
+	}
+	return d.buf[d.pos:]
+}
+
+func (d *decoder) boolean() bool { return d.byte() != 0 }
+
+func (d *decoder) byte() byte {
+	b := d.take(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) uint16() uint16 {
+	b := d.take(2)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(b)
+}
+
+func (d *decoder) uint32() uint32 {
+	b := d.take(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (d *decoder) int32() int32 { return int32(d.uint32()) }
+
+func (d *decoder) uint64() uint64 {
+	b := d.take(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+func (d *decoder) int64() int64       { return int64(d.uint64()) }
+func (d *decoder) float() float32     { return math.Float32frombits(d.uint32()) }
+func (d *decoder) double() float64    { return math.Float64frombits(d.uint64()) }
+func (d *decoder) statusCode() uint32 { return d.uint32() }
+
+func (d *decoder) string() string {
+	n := d.int32()
+	if n <= 0 {
+		return ""
+	}
+	return string(d.take(int(n)))
+}
+
+func (d *decoder) byteString() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return append([]byte(nil), d.take(int(n))...)
+}
+
+func (d *decoder) dateTime() time.Time {
+	v := d.int64()
+	if v <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, (v-epochDelta)*100)
+}
+
+func (d *decoder) guid() []byte { return d.take(16) }
+
+func (d *decoder) nodeID() nodeID {
+	encoding := d.byte()
+	var id nodeID
+	switch encoding & 0x0F {
+	case 0x00:
+		id = numericID(0, uint32(d.byte()))
+	case 0x01:
+		ns := uint16(d.byte())
+		id = numericID(ns, uint32(d.uint16()))
+	case 0x02:
+		ns := d.uint16()
+		id = numericID(ns, d.uint32())
+	case 0x03:
+		ns := d.uint16()
+		id = stringID(ns, d.string())
+	case 0x04:
+		// GUID节点ID，本服务端不使用，保留原始字节便于返回BadNodeIdUnknown
+		ns := d.uint16()
+		id = stringID(ns, "guid:"+string(d.guid()))
+	case 0x05:
+		ns := d.uint16()
+		id = stringID(ns, "opaque:"+string(d.byteString()))
+	default:
+		d.fail()
+	}
+	// ExpandedNodeId的附加字段
+	if encoding&0x80 != 0 {
+		d.string()
+	}
+	if encoding&0x40 != 0 {
+		d.uint32()
+	}
+	return id
+}
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = errors.New("opcua: 无效的编码")
+	}
+}
+
+func (d *decoder) qualifiedName() qualifiedName {
+	ns := d.uint16()
+	return qualifiedName{ns: ns, name: d.string()}
+}
+
+func (d *decoder) localizedText() string {
+	mask := d.byte()
+	if mask&0x01 != 0 {
+		d.string()
+	}
+	if mask&0x02 != 0 {
+		return d.string()
+	}
+	return ""
+}
+
+// extensionObject 解码扩展对象，返回类型ID和二进制内容
+func (d *decoder) extensionObject() extensionObject {
+	id := d.nodeID()
+	encoding := d.byte()
+	eo := extensionObject{typeID: id.num}
+	switch encoding {
+	case 0x00:
+	case 0x01, 0x02:
+		eo.body = d.byteString()
+	default:
+		d.fail()
+	}
+	return eo
+}
+
+func (d *decoder) diagnosticInfo() {
+	mask := d.byte()
+	if mask&0x01 != 0 {
+		d.int32()
+	}
+	if mask&0x02 != 0 {
+		d.int32()
+	}
+	if mask&0x04 != 0 {
+		d.int32()
+	}
+	if mask&0x08 != 0 {
+		d.int32()
+	}
+	if mask&0x10 != 0 {
+		d.string()
+	}
+	if mask&0x20 != 0 {
+		d.statusCode()
+	}
+	if mask&0x40 != 0 {
+		d.diagnosticInfo()
+	}
+}
+
+func (d *decoder) arrayLen() int {
+	n := d.int32()
+	if n < 0 {
+		return 0
+	}
+	if int(n) > len(d.buf)-d.pos {
+		d.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) stringArray() []string {
+	n := d.arrayLen()
+	values := make([]string, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		values = append(values, d.string())
+	}
+	return values
+}
+
+func (d *decoder) uint32Array() []uint32 {
+	n := d.arrayLen()
+	values := make([]uint32, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		values = append(values, d.uint32())
+	}
+	return values
+}
+
+func (d *decoder) variant() variant {
+	mask := d.byte()
+	typeID := mask & 0x3F
+	if typeID == 0 {
+		return variant{}
+	}
+	v := variant{typeID: typeID}
+	if mask&0x80 != 0 {
+		n := d.arrayLen()
+		values := make([]interface{}, 0, n)
+		for i := 0; i < n && d.err == nil; i++ {
+			values = append(values, d.scalar(typeID))
+		}
+		v.array, v.value = true, values
+		if mask&0x40 != 0 {
+			d.uint32Array()
+		}
+		return v
+	}
+	v.value = d.scalar(typeID)
+	return v
+}
+
+func (d *decoder) scalar(typeID byte) interface{} {
+	switch typeID {
+	case typeBoolean:
+		return d.boolean()
+	case typeSByte:
+		return int8(d.byte())
+	case typeByte:
+		return d.byte()
+	case typeInt16:
+		return int16(d.uint16())
+	case typeUInt16:
+		return d.uint16()
+	case typeInt32:
+		return d.int32()
+	case typeUInt32:
+		return d.uint32()
+	case typeInt64:
+		return d.int64()
+	case typeUInt64:
+		return d.uint64()
+	case typeFloat:
+		return d.float()
+	case typeDouble:
+		return d.double()
+	case typeString:
+		return d.string()
+	case typeDateTime:
+		return d.dateTime()
+	case typeGUID:
+		return d.guid()
+	case typeByteString, typeXMLElement:
+		return d.byteString()
+	case typeNodeID, typeExpandedNodeID:
+		return d.nodeID()
+	case typeStatusCode:
+		return d.statusCode()
+	case typeQualifiedName:
+		return d.qualifiedName()
+	case typeLocalizedText:
+		return d.localizedText()
+	case typeExtensionObject:
+		return d.extensionObject()
+	case typeDataValue:
+		return d.dataValue()
+	case typeVariant:
+		return d.variant()
+	case typeDiagnosticInfo:
+		d.diagnosticInfo()
+		return nil
+	default:
+		d.fail()
+		return nil
+	}
+}
+
+func (d *decoder) dataValue() dataValue {
+	mask := d.byte()
+	var dv dataValue
+	if mask&0x01 != 0 {
+		dv.hasValue = true
+		dv.value = d.variant()
+	}
+	if mask&0x02 != 0 {
+		dv.status = d.statusCode()
+	}
+	if mask&0x04 != 0 {
+		dv.sourceTime = d.dateTime()
+	}
+	if mask&0x10 != 0 {
+		d.uint16()
+	}
+	if mask&0x08 != 0 {
+		dv.serverTime = d.dateTime()
+	}
+	if mask&0x20 != 0 {
+		d.uint16()
+	}
+	return dv
+}
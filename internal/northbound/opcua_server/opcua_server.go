@@ -0,0 +1,385 @@
+package opcua_server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/model"
+	"github.com/y001j/iot-gateway/internal/northbound"
+	"github.com/y001j/iot-gateway/internal/utils"
+)
+
+func init() {
+	// 注册连接器工厂
+	northbound.Register("opcua_server", func() northbound.Sink {
+		return NewOPCUAServerSink()
+	})
+}
+
+// NewOPCUAServerSink 创建一个新的OPC UA服务端连接器
+func NewOPCUAServerSink() *OPCUAServerSink {
+	return &OPCUAServerSink{
+		BaseSink: northbound.NewBaseSink("opcua_server"),
+	}
+}
+
+// OPCUAServerSink 以OPC UA服务端的形式向MES/SCADA客户端暴露网关数据
+// 每个设备对应一个文件夹，每个数据点对应一个变量，复合数据展开为结构化子变量
+type OPCUAServerSink struct {
+	*northbound.BaseSink
+	config    OPCUAServerConfig
+	space     *addressSpace
+	server    *uaServer
+	natsConn  *nats.Conn
+	startTime time.Time
+}
+
+// OPCUAServerConfig 是OPC UA服务端连接器的特定参数配置
+type OPCUAServerConfig struct {
+	Listen           string       `json:"listen"`            // 监听地址，默认 :4840
+	EndpointURL      string       `json:"endpoint_url"`      // 对外公布的端点地址，默认 opc.tcp://<主机名>:<端口>
+	ApplicationURI   string       `json:"application_uri"`   // 应用URI
+	ProductURI       string       `json:"product_uri"`       // 产品URI
+	ApplicationName  string       `json:"application_name"`  // 应用名称
+	RootFolder       string       `json:"root_folder"`       // Objects下的根文件夹名称
+	SecurityPolicies []string     `json:"security_policies"` // 安全策略：None、Basic256Sha256
+	SecurityModes    []string     `json:"security_modes"`    // 非None策略的消息安全模式：Sign、SignAndEncrypt，默认两者
+	CertificateFile  string       `json:"certificate_file"`  // 服务端证书（DER或PEM），与私钥都不存在时生成自签名证书
+	PrivateKeyFile   string       `json:"private_key_file"`  // 服务端RSA私钥（PEM）
+	TrustedCertsDir  string       `json:"trusted_certs_dir"` // 受信任的客户端证书或CA证书目录
+	TrustAllClients  bool         `json:"trust_all_clients"` // 信任所有客户端证书，仅用于调试
+	AllowAnonymous   *bool        `json:"allow_anonymous"`   // 是否允许匿名登录，默认允许
+	Users            []UserConfig `json:"users"`             // 用户名密码登录
+	AllowWrites      bool         `json:"allow_writes"`      // 允许客户端写入变量并转发为NATS命令
+	Writable         []string     `json:"writable"`          // 可写数据点，格式 device_id.key，支持通配符
+	CommandSubject   string       `json:"command_subject"`   // 命令主题模板，支持 {device_id} 和 {key}
+	MaxSessions      int          `json:"max_sessions"`      // 最大会话数
+	MaxSubscriptions int          `json:"max_subscriptions_per_session"`
+	MinPublishingMs  int          `json:"min_publishing_interval_ms"` // 最小发布周期（毫秒）
+}
+
+// UserConfig OPC UA用户
+type UserConfig struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Write    bool   `json:"write"` // 是否允许写入变量
+}
+
+// Init 初始化连接器
+func (s *OPCUAServerSink) Init(cfg json.RawMessage) error {
+	// 使用标准化配置解析
+	standardConfig, err := s.ParseStandardConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("解析OPC UA服务端sink配置失败: %w", err)
+	}
+
+	// 解析OPC UA服务端特定参数
+	config := OPCUAServerConfig{
+		Listen:           ":4840",
+		ApplicationURI:   "urn:iot-gateway:opcua-server",
+		ProductURI:       "https://github.com/y001j/iot-gateway",
+		ApplicationName:  "IoT Gateway OPC UA Server",
+		RootFolder:       "IoTGateway",
+		SecurityPolicies: []string{"None"},
+		SecurityModes:    []string{"Sign", "SignAndEncrypt"},
+		CertificateFile:  "./data/opcua_server/server_cert.der",
+		PrivateKeyFile:   "./data/opcua_server/server_key.pem",
+		TrustedCertsDir:  "./data/opcua_server/trusted",
+		CommandSubject:   northbound.DefaultCommandSubject,
+		MaxSessions:      32,
+		MaxSubscriptions: 16,
+		MinPublishingMs:  100,
+	}
+	if err := json.Unmarshal(standardConfig.Params, &config); err != nil {
+		return fmt.Errorf("解析OPC UA服务端特定参数失败: %w", err)
+	}
+
+	endpoints, err := parseEndpoints(config.SecurityPolicies, config.SecurityModes)
+	if err != nil {
+		return err
+	}
+
+	allowAnonymous := config.AllowAnonymous == nil || *config.AllowAnonymous
+	users := make(map[string]UserConfig, len(config.Users))
+	for _, u := range config.Users {
+		if u.Username == "" {
+			return fmt.Errorf("OPC UA用户名不能为空")
+		}
+		if _, dup := users[u.Username]; dup {
+			return fmt.Errorf("OPC UA用户重复: %s", u.Username)
+		}
+		users[u.Username] = u
+	}
+	if !allowAnonymous && len(users) == 0 {
+		return fmt.Errorf("禁用匿名登录时必须配置至少一个用户")
+	}
+	if config.RootFolder == "" {
+		config.RootFolder = "IoTGateway"
+	}
+	if config.MinPublishingMs <= 0 {
+		config.MinPublishingMs = 100
+	}
+	if config.EndpointURL == "" {
+		config.EndpointURL = defaultEndpointURL(config.Listen)
+	}
+
+	// 安全端点需要证书；配置了用户时密码也用服务端证书加密，不在None通道上明文传输
+	var security *serverSecurity
+	secured := false
+	for _, ep := range endpoints {
+		secured = secured || ep.policy != securityPolicyNone
+	}
+	if secured || len(users) > 0 {
+		security, err = loadServerSecurity(config.CertificateFile, config.PrivateKeyFile, config.ApplicationURI, config.EndpointURL)
+		if err != nil {
+			return err
+		}
+		security.trustedDir = config.TrustedCertsDir
+		security.trustAll = config.TrustAllClients
+		if secured && config.TrustAllClients {
+			log.Warn().Str("name", s.Name()).Msg("OPC UA服务端信任所有客户端证书，仅应用于调试")
+		}
+	}
+
+	s.config = config
+	s.startTime = time.Now()
+	s.space = newAddressSpace(config.RootFolder, s.serverStatus)
+	s.server = newUAServer(serverOptions{
+		endpointURL:     config.EndpointURL,
+		applicationURI:  config.ApplicationURI,
+		productURI:      config.ProductURI,
+		applicationName: config.ApplicationName,
+		allowAnonymous:  allowAnonymous,
+		users:           users,
+		maxSessions:     config.MaxSessions,
+		maxSubsPerSess:  config.MaxSubscriptions,
+		minPublishing:   time.Duration(config.MinPublishingMs) * time.Millisecond,
+		endpoints:       endpoints,
+		security:        security,
+	}, s.space, s.handleWrite)
+
+	log.Info().
+		Str("name", s.Name()).
+		Str("listen", config.Listen).
+		Str("endpoint", config.EndpointURL).
+		Strs("security_policies", config.SecurityPolicies).
+		Bool("allow_anonymous", allowAnonymous).
+		Int("users", len(users)).
+		Bool("allow_writes", config.AllowWrites).
+		Msg("OPC UA服务端连接器初始化完成")
+
+	return nil
+}
+
+// parseEndpoints 由安全策略和安全模式组合出端点列表，None策略只对应None模式
+func parseEndpoints(policies, modes []string) ([]endpointSecurity, error) {
+	if len(policies) == 0 {
+		policies = []string{"None"}
+	}
+	var endpoints []endpointSecurity
+	for _, name := range policies {
+		policy, err := parseSecurityPolicy(name)
+		if err != nil {
+			return nil, err
+		}
+		if policy == securityPolicyNone {
+			endpoints = append(endpoints, endpointSecurity{policy, securityModeNone})
+			continue
+		}
+		if len(modes) == 0 {
+			return nil, fmt.Errorf("安全策略%s需要至少一种安全模式", name)
+		}
+		for _, m := range modes {
+			mode, err := parseSecurityMode(m)
+			if err != nil {
+				return nil, err
+			}
+			endpoints = append(endpoints, endpointSecurity{policy, mode})
+		}
+	}
+	return endpoints, nil
+}
+
+// defaultEndpointURL 根据监听地址生成端点URL
+func defaultEndpointURL(listen string) string {
+	host, port := "localhost", "4840"
+	if i := strings.LastIndex(listen, ":"); i >= 0 {
+		if listen[:i] != "" && listen[:i] != "0.0.0.0" {
+			host = listen[:i]
+		} else if name, err := os.Hostname(); err == nil {
+			host = name
+		}
+		port = listen[i+1:]
+	}
+	return fmt.Sprintf("opc.tcp://%s:%s", host, port)
+}
+
+func (s *OPCUAServerSink) serverStatus() serverStatus {
+	return serverStatus{
+		startTime:    s.startTime,
+		productName:  s.config.ApplicationName,
+		productURI:   s.config.ProductURI,
+		manufacturer: "IoT Gateway",
+		version:      "1.0",
+	}
+}
+
+// SetNATSConnection 设置NATS连接，用于转发客户端写入命令
+func (s *OPCUAServerSink) SetNATSConnection(conn *nats.Conn) {
+	s.natsConn = conn
+}
+
+// Start 启动连接器
+func (s *OPCUAServerSink) Start(ctx context.Context) error {
+	if err := s.server.start(s.config.Listen); err != nil {
+		s.HandleError(err, "启动OPC UA服务端")
+		return fmt.Errorf("监听 %s 失败: %w", s.config.Listen, err)
+	}
+	s.SetRunning(true)
+
+	// 监听上下文取消
+	go func() {
+		<-ctx.Done()
+		s.Stop()
+	}()
+
+	log.Info().
+		Str("name", s.Name()).
+		Str("listen", s.server.listener.Addr().String()).
+		Str("endpoint", s.config.EndpointURL).
+		Msg("OPC UA服务端连接器启动")
+	return nil
+}
+
+// Publish 更新地址空间中的变量值，订阅了该变量的客户端会收到数据变化通知
+func (s *OPCUAServerSink) Publish(batch []model.Point) error {
+	if !s.IsRunning() {
+		return fmt.Errorf("OPC UA服务端连接器未启动")
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	// 记录发布操作开始时间
+	publishStart := time.Now()
+
+	// 使用BaseSink的SafePublishBatch方法，自动处理统计
+	return s.SafePublishBatch(batch, func(batch []model.Point) error {
+		now := time.Now()
+		for _, point := range batch {
+			sourceTime := point.Timestamp
+			if sourceTime.IsZero() {
+				sourceTime = now
+			}
+			s.space.updatePoint(point.DeviceID, point.Key, point.Value, qualityStatus(point.Quality), sourceTime, now, s.isWritable(point.DeviceID, point.Key))
+		}
+		return nil
+	}, publishStart)
+}
+
+// qualityStatus 将网关质量码映射为OPC UA状态码: 0为Good，1为Uncertain，其余为Bad
+func qualityStatus(quality int) uint32 {
+	switch {
+	case quality == 0:
+		return statusGood
+	case quality == 1:
+		return statusUncertain
+	default:
+		return statusBad
+	}
+}
+
+// isWritable 判断数据点是否允许客户端写入
+func (s *OPCUAServerSink) isWritable(deviceID, key string) bool {
+	if !s.config.AllowWrites {
+		return false
+	}
+	if len(s.config.Writable) == 0 {
+		return true
+	}
+	id := deviceID + "." + key
+	for _, pattern := range s.config.Writable {
+		if utils.MatchGlob(pattern, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleWrite 将客户端写入转发为NATS命令，设备上报新值后变量才会更新
+func (s *OPCUAServerSink) handleWrite(deviceID, key string, value interface{}, user string) uint32 {
+	cmd := northbound.Command{
+		DeviceID: deviceID,
+		Key:      key,
+		Value:    value,
+		Source:   s.Name(),
+		Tags: map[string]string{
+			"protocol": "opcua",
+			"user":     user,
+		},
+	}
+	if err := northbound.PublishCommand(s.natsConn, s.config.CommandSubject, cmd); err != nil {
+		s.HandleError(err, "转发OPC UA写入命令")
+		return statusBadUnexpectedError
+	}
+
+	log.Info().
+		Str("name", s.Name()).
+		Str("device_id", deviceID).
+		Str("key", key).
+		Str("user", user).
+		Interface("value", value).
+		Msg("已转发OPC UA客户端写入命令")
+	return statusGood
+}
+
+// ServerStatus OPC UA服务端运行状态
+type ServerStatus struct {
+	Endpoint      string `json:"endpoint"`
+	Channels      int    `json:"channels"`
+	Sessions      int    `json:"sessions"`
+	Subscriptions int    `json:"subscriptions"`
+	Devices       int    `json:"devices"`
+	Variables     int    `json:"variables"`
+}
+
+// Status 返回连接、会话和地址空间统计
+func (s *OPCUAServerSink) Status() ServerStatus {
+	status := ServerStatus{Endpoint: s.config.EndpointURL}
+	if s.server != nil {
+		status.Channels, status.Sessions, status.Subscriptions = s.server.stats()
+		status.Devices, status.Variables = s.space.countVariables()
+	}
+	return status
+}
+
+// Stop 停止连接器
+func (s *OPCUAServerSink) Stop() error {
+	if !s.IsRunning() {
+		return nil
+	}
+	s.SetRunning(false)
+
+	s.server.stop()
+
+	log.Info().Str("name", s.Name()).Msg("OPC UA服务端连接器停止")
+	return nil
+}
+
+// Healthy 检查连接器健康状态
+func (s *OPCUAServerSink) Healthy() error {
+	if !s.IsRunning() {
+		return fmt.Errorf("OPC UA服务端连接器未运行")
+	}
+	if s.config.AllowWrites && s.natsConn == nil {
+		return fmt.Errorf("未设置NATS连接，无法转发写入命令")
+	}
+	return nil
+}
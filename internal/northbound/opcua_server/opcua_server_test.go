@@ -0,0 +1,579 @@
+package opcua_server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/y001j/iot-gateway/internal/model"
+	"github.com/y001j/iot-gateway/internal/northbound"
+)
+
+const testTimeout = 10 * time.Second
+
+// testServer 运行中的OPC UA服务端连接器及其NATS连接
+type testServer struct {
+	sink      *OPCUAServerSink
+	endpoint  string
+	nc        *nats.Conn
+	clientDER []byte
+	clientKey *rsa.PrivateKey
+}
+
+// startTestServer 启动嵌入式NATS和OPC UA服务端连接器，客户端证书放入信任目录
+func startTestServer(t *testing.T, params map[string]interface{}) *testServer {
+	t.Helper()
+	ns, err := natsserver.NewServer(&natsserver.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatalf("创建嵌入式NATS失败: %v", err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(testTimeout) {
+		t.Fatal("嵌入式NATS未就绪")
+	}
+	t.Cleanup(ns.Shutdown)
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatalf("连接NATS失败: %v", err)
+	}
+	t.Cleanup(nc.Close)
+
+	dir := t.TempDir()
+	trusted := filepath.Join(dir, "trusted")
+	if err := os.MkdirAll(trusted, 0755); err != nil {
+		t.Fatal(err)
+	}
+	clientDER, clientKey := newClientCertificate(t)
+	if err := os.WriteFile(filepath.Join(trusted, "client.der"), clientDER, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	addr := freeAddr(t)
+	params["listen"] = addr
+	params["endpoint_url"] = "opc.tcp://" + addr
+	params["certificate_file"] = filepath.Join(dir, "server_cert.der")
+	params["private_key_file"] = filepath.Join(dir, "server_key.pem")
+	params["trusted_certs_dir"] = trusted
+	params["users"] = []map[string]interface{}{
+		{"username": "operator", "password": "op-secret", "write": true},
+		{"username": "viewer", "password": "view-secret"},
+	}
+	cfg, _ := json.Marshal(map[string]interface{}{"name": "opcua_test", "type": "opcua_server", "params": params})
+
+	sink := NewOPCUAServerSink()
+	if err := sink.Init(cfg); err != nil {
+		t.Fatalf("初始化失败: %v", err)
+	}
+	sink.SetNATSConnection(nc)
+	if err := sink.Start(context.Background()); err != nil {
+		t.Fatalf("启动失败: %v", err)
+	}
+	t.Cleanup(func() { sink.Stop() })
+
+	return &testServer{sink: sink, endpoint: "opc.tcp://" + addr, nc: nc, clientDER: clientDER, clientKey: clientKey}
+}
+
+// freeAddr 返回本机一个空闲的TCP地址，端点URL需要在启动前确定端口
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// newClientCertificate 生成客户端应用实例证书
+func newClientCertificate(t *testing.T) ([]byte, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, minAsymmetricKeyBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, _ := url.Parse("urn:iot-gateway:test-client")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gopcua test client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment |
+			x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		URIs:        []*url.URL{uri},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der, key
+}
+
+// clientOptions 按安全策略、模式和用户令牌类型选择服务端端点
+func (ts *testServer) clientOptions(t *testing.T, policy string, mode ua.MessageSecurityMode, auth ua.UserTokenType, extra ...opcua.Option) []opcua.Option {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	endpoints, err := opcua.GetEndpoints(ctx, ts.endpoint)
+	if err != nil {
+		t.Fatalf("获取端点失败: %v", err)
+	}
+	ep, err := opcua.SelectEndpoint(endpoints, policy, mode)
+	if err != nil {
+		t.Fatalf("选择端点 %s/%s 失败: %v", policy, mode, err)
+	}
+	opts := []opcua.Option{
+		opcua.SecurityFromEndpoint(ep, auth),
+		opcua.AutoReconnect(false),
+		opcua.RequestTimeout(testTimeout),
+	}
+	if mode != ua.MessageSecurityModeNone {
+		opts = append(opts, opcua.Certificate(ts.clientDER), opcua.PrivateKey(ts.clientKey))
+	}
+	return append(opts, extra...)
+}
+
+// connect 建立安全通道并激活会话
+func (ts *testServer) connect(t *testing.T, opts []opcua.Option) (*opcua.Client, error) {
+	t.Helper()
+	c, err := opcua.NewClient(ts.endpoint, opts...)
+	if err != nil {
+		t.Fatalf("创建客户端失败: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	if err := c.Connect(ctx); err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() { c.Close(context.Background()) })
+	return c, nil
+}
+
+func (ts *testServer) mustConnect(t *testing.T, opts []opcua.Option) *opcua.Client {
+	t.Helper()
+	c, err := ts.connect(t, opts)
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	return c
+}
+
+// publish 以指定质量码和采集时间发布一个数据点
+func (ts *testServer) publish(t *testing.T, deviceID, key string, value float64, quality int, at time.Time) {
+	t.Helper()
+	p := model.NewPoint(key, deviceID, value, model.TypeFloat)
+	p.Quality = quality
+	p.Timestamp = at
+	if err := ts.sink.Publish([]model.Point{p}); err != nil {
+		t.Fatalf("发布失败: %v", err)
+	}
+}
+
+func pointNode(deviceID, key string) *ua.NodeID {
+	return ua.NewStringNodeID(gatewayNamespace, deviceID+"."+key)
+}
+
+func readValue(t *testing.T, c *opcua.Client, nodeID *ua.NodeID) *ua.DataValue {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	resp, err := c.Read(ctx, &ua.ReadRequest{
+		NodesToRead:        []*ua.ReadValueID{{NodeID: nodeID, AttributeID: ua.AttributeIDValue}},
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+	})
+	if err != nil {
+		t.Fatalf("读取 %s 失败: %v", nodeID, err)
+	}
+	if len(resp.Results) != 1 {
+		t.Fatalf("读取返回 %d 个结果", len(resp.Results))
+	}
+	return resp.Results[0]
+}
+
+func browseNames(t *testing.T, c *opcua.Client, nodeID *ua.NodeID) map[string]*ua.ReferenceDescription {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	resp, err := c.Browse(ctx, &ua.BrowseRequest{
+		NodesToBrowse: []*ua.BrowseDescription{{
+			NodeID:          nodeID,
+			BrowseDirection: ua.BrowseDirectionForward,
+			ReferenceTypeID: ua.NewNumericNodeID(0, id.HierarchicalReferences),
+			IncludeSubtypes: true,
+			ResultMask:      uint32(ua.BrowseResultMaskAll),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("浏览 %s 失败: %v", nodeID, err)
+	}
+	if len(resp.Results) != 1 || resp.Results[0].StatusCode != ua.StatusOK {
+		t.Fatalf("浏览 %s 结果异常: %+v", nodeID, resp.Results)
+	}
+	refs := make(map[string]*ua.ReferenceDescription)
+	for _, ref := range resp.Results[0].References {
+		refs[ref.BrowseName.Name] = ref
+	}
+	return refs
+}
+
+// serverTokens 返回服务端各安全通道当前的TokenID
+func (ts *testServer) serverTokens() []uint32 {
+	srv := ts.sink.server
+	srv.mu.Lock()
+	channels := make([]*secureChannel, 0, len(srv.channels))
+	for ch := range srv.channels {
+		channels = append(channels, ch)
+	}
+	srv.mu.Unlock()
+
+	tokens := make([]uint32, 0, len(channels))
+	for _, ch := range channels {
+		ch.writeMu.Lock()
+		if ch.channelID != 0 {
+			tokens = append(tokens, ch.tokenID)
+		}
+		ch.writeMu.Unlock()
+	}
+	return tokens
+}
+
+func TestSecureChannelOpenRenew(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy string
+		mode   ua.MessageSecurityMode
+		auth   ua.UserTokenType
+		opts   []opcua.Option
+	}{
+		{"None", ua.SecurityPolicyURINone, ua.MessageSecurityModeNone, ua.UserTokenTypeAnonymous, []opcua.Option{opcua.AuthAnonymous()}},
+		{"Basic256Sha256_SignAndEncrypt", ua.SecurityPolicyURIBasic256Sha256, ua.MessageSecurityModeSignAndEncrypt, ua.UserTokenTypeUserName, []opcua.Option{opcua.AuthUsername("viewer", "view-secret")}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := startTestServer(t, map[string]interface{}{
+				"security_policies": []string{"None", "Basic256Sha256"},
+				"security_modes":    []string{"SignAndEncrypt"},
+			})
+			at := time.UnixMilli(1700000000123)
+			ts.publish(t, "boiler_1", "pressure", 1.25, 0, at)
+
+			c := ts.mustConnect(t, ts.clientOptions(t, tc.policy, tc.mode, tc.auth, tc.opts...))
+			if dv := readValue(t, c, pointNode("boiler_1", "pressure")); dv.Status != ua.StatusOK || dv.Value.Value() != 1.25 {
+				t.Fatalf("续期前读取 status=%v value=%v", dv.Status, dv.Value.Value())
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+			defer cancel()
+			if err := c.SecureChannel().Renew(ctx); err != nil {
+				t.Fatalf("续期安全通道失败: %v", err)
+			}
+			// 续期后客户端切换到新令牌，服务端须用新令牌的密钥解密和响应
+			if dv := readValue(t, c, pointNode("boiler_1", "pressure")); dv.Status != ua.StatusOK || dv.Value.Value() != 1.25 {
+				t.Fatalf("续期后读取 status=%v value=%v", dv.Status, dv.Value.Value())
+			}
+			if tokens := ts.serverTokens(); len(tokens) != 1 || tokens[0] != 2 {
+				t.Fatalf("服务端令牌 %v，期望续期后的令牌2", tokens)
+			}
+		})
+	}
+}
+
+func TestUserNameTokenActivation(t *testing.T) {
+	ts := startTestServer(t, map[string]interface{}{
+		"security_policies": []string{"None"},
+		"allow_anonymous":   false,
+	})
+	none := func(auth ...opcua.Option) []opcua.Option {
+		return ts.clientOptions(t, ua.SecurityPolicyURINone, ua.MessageSecurityModeNone, ua.UserTokenTypeUserName, auth...)
+	}
+
+	// None通道上密码按用户令牌策略用服务端证书加密，服务端解密后认证通过
+	ts.mustConnect(t, none(opcua.AuthUsername("operator", "op-secret")))
+
+	if _, err := ts.connect(t, none(opcua.AuthUsername("operator", "wrong"))); !errors.Is(err, ua.StatusBadUserAccessDenied) {
+		t.Fatalf("错误密码: %v，期望BadUserAccessDenied", err)
+	}
+
+	// 令牌策略为None时客户端发送明文密码，未加密通道上必须拒绝
+	plain := []opcua.Option{
+		opcua.SecurityPolicy(ua.SecurityPolicyURINone),
+		opcua.SecurityModeString("None"),
+		opcua.AuthUsername("operator", "op-secret"),
+		opcua.AuthPolicyID("username"),
+		opcua.AutoReconnect(false),
+	}
+	if _, err := ts.connect(t, plain); !errors.Is(err, ua.StatusBadIdentityTokenRejected) {
+		t.Fatalf("明文密码: %v，期望BadIdentityTokenRejected", err)
+	}
+
+	anonymous := ts.clientOptions(t, ua.SecurityPolicyURINone, ua.MessageSecurityModeNone, ua.UserTokenTypeAnonymous, opcua.AuthAnonymous())
+	if _, err := ts.connect(t, anonymous); !errors.Is(err, ua.StatusBadIdentityTokenRejected) {
+		t.Fatalf("禁用匿名时匿名登录: %v，期望BadIdentityTokenRejected", err)
+	}
+}
+
+func TestSessionTransfer(t *testing.T) {
+	ts := startTestServer(t, map[string]interface{}{
+		"security_policies": []string{"Basic256Sha256"},
+		"security_modes":    []string{"SignAndEncrypt"},
+	})
+	ts.publish(t, "boiler_1", "pressure", 2.5, 0, time.Now())
+	opts := ts.clientOptions(t, ua.SecurityPolicyURIBasic256Sha256, ua.MessageSecurityModeSignAndEncrypt, ua.UserTokenTypeUserName,
+		opcua.AuthUsername("operator", "op-secret"))
+
+	first := ts.mustConnect(t, opts)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	sess, err := first.DetachSession(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 在新的安全通道上激活原会话，会话转移到新通道
+	second, err := opcua.NewClient(ts.endpoint, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Dial(ctx); err != nil {
+		t.Fatalf("建立新安全通道失败: %v", err)
+	}
+	t.Cleanup(func() { second.Close(context.Background()) })
+	if err := second.ActivateSession(ctx, sess); err != nil {
+		t.Fatalf("在新通道上激活会话失败: %v", err)
+	}
+	first.Close(ctx)
+
+	if dv := readValue(t, second, pointNode("boiler_1", "pressure")); dv.Status != ua.StatusOK || dv.Value.Value() != 2.5 {
+		t.Fatalf("转移后读取 status=%v value=%v", dv.Status, dv.Value.Value())
+	}
+
+	// 服务端只有一个会话，绑定到仍然打开的新通道，用户不变
+	srv := ts.sink.server
+	srv.mu.Lock()
+	var sessions []*session
+	for _, s := range srv.sessions {
+		sessions = append(sessions, s)
+	}
+	srv.mu.Unlock()
+	if len(sessions) != 1 {
+		t.Fatalf("服务端会话数 %d，期望1", len(sessions))
+	}
+	s := sessions[0]
+	s.mu.Lock()
+	user, ch := s.user, s.channel
+	s.mu.Unlock()
+	if user != "operator" || ch.closed.Load() {
+		t.Fatalf("转移后会话用户 %q，通道已关闭: %v", user, ch.closed.Load())
+	}
+}
+
+func TestBrowseRead(t *testing.T) {
+	ts := startTestServer(t, map[string]interface{}{"security_policies": []string{"None"}})
+	at := time.UnixMilli(1700000000456)
+	ts.publish(t, "boiler_1", "pressure", 3.5, 0, at)
+	ts.publish(t, "boiler_1", "temperature", 81, 2, at)
+
+	c := ts.mustConnect(t, ts.clientOptions(t, ua.SecurityPolicyURINone, ua.MessageSecurityModeNone, ua.UserTokenTypeAnonymous, opcua.AuthAnonymous()))
+
+	objects := browseNames(t, c, ua.NewNumericNodeID(0, id.ObjectsFolder))
+	root, ok := objects["IoTGateway"]
+	if !ok {
+		t.Fatalf("Objects下没有IoTGateway文件夹: %v", objects)
+	}
+	devices := browseNames(t, c, root.NodeID.NodeID)
+	device, ok := devices["boiler_1"]
+	if !ok {
+		t.Fatalf("IoTGateway下没有设备boiler_1: %v", devices)
+	}
+	points := browseNames(t, c, device.NodeID.NodeID)
+	for _, key := range []string{"pressure", "temperature"} {
+		ref, ok := points[key]
+		if !ok {
+			t.Fatalf("设备下没有变量 %s", key)
+		}
+		if ref.NodeClass != ua.NodeClassVariable || !ref.NodeID.NodeID.Equal(pointNode("boiler_1", key)) {
+			t.Fatalf("变量 %s: class=%v id=%v", key, ref.NodeClass, ref.NodeID.NodeID)
+		}
+	}
+
+	dv := readValue(t, c, pointNode("boiler_1", "pressure"))
+	if dv.Status != ua.StatusOK || dv.Value.Value() != 3.5 || !dv.SourceTimestamp.Equal(at) {
+		t.Fatalf("pressure status=%v value=%v source=%v", dv.Status, dv.Value.Value(), dv.SourceTimestamp)
+	}
+	if dv := readValue(t, c, pointNode("boiler_1", "temperature")); dv.Status != ua.StatusCode(statusBad) {
+		t.Fatalf("质量码2的状态 %v，期望Bad", dv.Status)
+	}
+	if dv := readValue(t, c, pointNode("boiler_1", "missing")); dv.Status != ua.StatusBadNodeIDUnknown {
+		t.Fatalf("不存在的节点状态 %v", dv.Status)
+	}
+}
+
+func TestSubscriptionPublish(t *testing.T) {
+	ts := startTestServer(t, map[string]interface{}{"security_policies": []string{"None"}})
+	ts.publish(t, "boiler_1", "pressure", 1, 0, time.UnixMilli(1700000000000))
+
+	c := ts.mustConnect(t, ts.clientOptions(t, ua.SecurityPolicyURINone, ua.MessageSecurityModeNone, ua.UserTokenTypeAnonymous, opcua.AuthAnonymous()))
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	notifications := make(chan *opcua.PublishNotificationData, 16)
+	sub, err := c.Subscribe(ctx, &opcua.SubscriptionParameters{Interval: 100 * time.Millisecond}, notifications)
+	if err != nil {
+		t.Fatalf("创建订阅失败: %v", err)
+	}
+	defer sub.Cancel(context.Background())
+	resp, err := sub.Monitor(ctx, ua.TimestampsToReturnBoth, opcua.NewMonitoredItemCreateRequestWithDefaults(pointNode("boiler_1", "pressure"), ua.AttributeIDValue, 7))
+	if err != nil || resp.Results[0].StatusCode != ua.StatusOK {
+		t.Fatalf("创建监视项失败: %v %+v", err, resp)
+	}
+
+	// next 等待下一个数据变化通知
+	next := func() *ua.DataValue {
+		t.Helper()
+		for {
+			select {
+			case n := <-notifications:
+				if n.Error != nil {
+					t.Fatalf("订阅通知错误: %v", n.Error)
+				}
+				change, ok := n.Value.(*ua.DataChangeNotification)
+				if !ok {
+					continue
+				}
+				for _, item := range change.MonitoredItems {
+					if item.ClientHandle != 7 {
+						t.Fatalf("监视项句柄 %d", item.ClientHandle)
+					}
+					return item.Value
+				}
+			case <-ctx.Done():
+				t.Fatal("等待订阅通知超时")
+			}
+		}
+	}
+
+	if dv := next(); dv.Value.Value() != 1.0 || dv.Status != ua.StatusOK {
+		t.Fatalf("初始通知 value=%v status=%v", dv.Value.Value(), dv.Status)
+	}
+
+	steps := []struct {
+		value   float64
+		quality int
+		status  ua.StatusCode
+	}{
+		{2, 0, ua.StatusOK},
+		{3, 1, ua.StatusCode(statusUncertain)},
+		{4, 5, ua.StatusCode(statusBad)},
+	}
+	for i, step := range steps {
+		at := time.UnixMilli(1700000001000 + int64(i)*1000)
+		ts.publish(t, "boiler_1", "pressure", step.value, step.quality, at)
+		dv := next()
+		if dv.Value.Value() != step.value || dv.Status != step.status {
+			t.Fatalf("第%d次通知 value=%v status=%v，期望 %v/%v", i+1, dv.Value.Value(), dv.Status, step.value, step.status)
+		}
+		// SourceTimestamp取数据点采集时间，ServerTimestamp取写入地址空间的时间
+		if !dv.SourceTimestamp.Equal(at) {
+			t.Fatalf("第%d次通知SourceTimestamp %v，期望 %v", i+1, dv.SourceTimestamp, at)
+		}
+		if dv.ServerTimestamp.Before(at) || time.Since(dv.ServerTimestamp) > time.Minute {
+			t.Fatalf("第%d次通知ServerTimestamp %v", i+1, dv.ServerTimestamp)
+		}
+	}
+}
+
+func TestWriteForwardsCommand(t *testing.T) {
+	ts := startTestServer(t, map[string]interface{}{
+		"security_policies": []string{"None"},
+		"allow_writes":      true,
+		"writable":          []string{"boiler_*.setpoint"},
+	})
+	ts.publish(t, "boiler_1", "setpoint", 50, 0, time.Now())
+	ts.publish(t, "boiler_1", "pressure", 1, 0, time.Now())
+
+	commands, err := ts.nc.SubscribeSync("iot.commands.>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(c *opcua.Client, nodeID *ua.NodeID, value float64) ua.StatusCode {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+		resp, err := c.Write(ctx, &ua.WriteRequest{NodesToWrite: []*ua.WriteValue{{
+			NodeID:      nodeID,
+			AttributeID: ua.AttributeIDValue,
+			Value:       &ua.DataValue{EncodingMask: ua.DataValueValue, Value: ua.MustVariant(value)},
+		}}})
+		if err != nil {
+			t.Fatalf("写入 %s 失败: %v", nodeID, err)
+		}
+		return resp.Results[0]
+	}
+	login := func(auth ua.UserTokenType, opts ...opcua.Option) *opcua.Client {
+		return ts.mustConnect(t, ts.clientOptions(t, ua.SecurityPolicyURINone, ua.MessageSecurityModeNone, auth, opts...))
+	}
+
+	operator := login(ua.UserTokenTypeUserName, opcua.AuthUsername("operator", "op-secret"))
+	if status := write(operator, pointNode("boiler_1", "setpoint"), 62.5); status != ua.StatusOK {
+		t.Fatalf("有写权限的用户写入状态 %v", status)
+	}
+	msg, err := commands.NextMsg(testTimeout)
+	if err != nil {
+		t.Fatalf("未收到转发的命令: %v", err)
+	}
+	if msg.Subject != "iot.commands.boiler_1.setpoint" {
+		t.Fatalf("命令主题 %s", msg.Subject)
+	}
+	var cmd northbound.Command
+	if err := json.Unmarshal(msg.Data, &cmd); err != nil {
+		t.Fatalf("解码命令失败: %v", err)
+	}
+	if cmd.DeviceID != "boiler_1" || cmd.Key != "setpoint" || cmd.Value != 62.5 || cmd.Source != "opcua_test" ||
+		cmd.Tags["protocol"] != "opcua" || cmd.Tags["user"] != "operator" {
+		t.Fatalf("命令内容 %+v", cmd)
+	}
+
+	// 写入不直接修改地址空间，设备上报新值后变量才更新
+	if dv := readValue(t, operator, pointNode("boiler_1", "setpoint")); dv.Value.Value() != 50.0 {
+		t.Fatalf("写入后变量值 %v，期望仍为设备上报的50", dv.Value.Value())
+	}
+
+	denied := []struct {
+		name   string
+		client *opcua.Client
+		node   *ua.NodeID
+		status ua.StatusCode
+	}{
+		{"viewer", login(ua.UserTokenTypeUserName, opcua.AuthUsername("viewer", "view-secret")), pointNode("boiler_1", "setpoint"), ua.StatusBadUserAccessDenied},
+		{"anonymous", login(ua.UserTokenTypeAnonymous, opcua.AuthAnonymous()), pointNode("boiler_1", "setpoint"), ua.StatusBadUserAccessDenied},
+		{"not writable", operator, pointNode("boiler_1", "pressure"), ua.StatusBadNotWritable},
+	}
+	for _, tc := range denied {
+		if status := write(tc.client, tc.node, 70); status != tc.status {
+			t.Fatalf("%s写入状态 %v，期望 %v", tc.name, status, tc.status)
+		}
+	}
+	if msg, err := commands.NextMsg(200 * time.Millisecond); err == nil {
+		t.Fatalf("被拒绝的写入不应转发命令，收到 %s: %s", msg.Subject, msg.Data)
+	}
+}
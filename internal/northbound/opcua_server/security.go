@@ -0,0 +1,456 @@
+package opcua_server
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Basic256Sha256 安全策略参数
+const (
+	algorithmRSASHA256     = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algorithmRSAOAEP       = "http://www.w3.org/2001/04/xmlenc#rsa-oaep"
+	nonceLength            = 32
+	symmetricSignatureSize = 32 // HMAC-SHA256
+	symmetricKeySize       = 32 // AES-256
+	symmetricBlockSize     = aes.BlockSize
+	oaepSHA1Overhead       = 2*sha1.Size + 2
+	minAsymmetricKeyBits   = 2048
+	maxAsymmetricKeyBits   = 4096
+)
+
+// endpointSecurity 一个端点提供的安全策略和消息安全模式
+type endpointSecurity struct {
+	policy string
+	mode   uint32
+}
+
+// securityLevel 端点的相对安全等级，客户端据此选择端点
+func (es endpointSecurity) securityLevel() byte {
+	switch es.mode {
+	case securityModeSignAndEncrypt:
+		return 3
+	case securityModeSign:
+		return 2
+	}
+	return 0
+}
+
+// parseSecurityPolicy 解析配置中的安全策略名称或URI
+func parseSecurityPolicy(name string) (string, error) {
+	switch {
+	case strings.EqualFold(name, "None") || name == securityPolicyNone:
+		return securityPolicyNone, nil
+	case strings.EqualFold(name, "Basic256Sha256") || name == securityPolicyBasic256Sha256:
+		return securityPolicyBasic256Sha256, nil
+	}
+	return "", fmt.Errorf("不支持的OPC UA安全策略: %s（支持None和Basic256Sha256）", name)
+}
+
+// parseSecurityMode 解析配置中的消息安全模式
+func parseSecurityMode(name string) (uint32, error) {
+	switch {
+	case strings.EqualFold(name, "Sign"):
+		return securityModeSign, nil
+	case strings.EqualFold(name, "SignAndEncrypt"):
+		return securityModeSignAndEncrypt, nil
+	}
+	return 0, fmt.Errorf("不支持的OPC UA安全模式: %s（支持Sign和SignAndEncrypt）", name)
+}
+
+// serverSecurity 服务端证书、私钥和客户端证书信任列表
+type serverSecurity struct {
+	certificate []byte // DER编码的服务端证书
+	key         *rsa.PrivateKey
+	thumbprint  []byte // 服务端证书的SHA1指纹
+	trustedDir  string // 受信任的客户端证书或CA证书目录，每次校验时重新读取
+	trustAll    bool
+}
+
+// loadServerSecurity 加载服务端证书和私钥，证书文件不存在时生成自签名证书
+func loadServerSecurity(certFile, keyFile, applicationURI, endpointURL string) (*serverSecurity, error) {
+	certPEM, certErr := os.ReadFile(certFile)
+	keyPEM, keyErr := os.ReadFile(keyFile)
+	if errors.Is(certErr, os.ErrNotExist) && errors.Is(keyErr, os.ErrNotExist) {
+		if err := generateServerCertificate(certFile, keyFile, applicationURI, endpointURL); err != nil {
+			return nil, fmt.Errorf("生成OPC UA服务端证书失败: %w", err)
+		}
+		log.Info().Str("certificate", certFile).Str("private_key", keyFile).Msg("已生成OPC UA服务端自签名证书")
+		certPEM, certErr = os.ReadFile(certFile)
+		keyPEM, keyErr = os.ReadFile(keyFile)
+	}
+	if certErr != nil {
+		return nil, fmt.Errorf("读取OPC UA服务端证书失败: %w", certErr)
+	}
+	if keyErr != nil {
+		return nil, fmt.Errorf("读取OPC UA服务端私钥失败: %w", keyErr)
+	}
+
+	der := certPEM
+	if block, _ := pem.Decode(certPEM); block != nil {
+		der = block.Bytes
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("解析OPC UA服务端证书失败: %w", err)
+	}
+	key, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("解析OPC UA服务端私钥失败: %w", err)
+	}
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok || pub.N.Cmp(key.N) != 0 {
+		return nil, fmt.Errorf("OPC UA服务端证书与私钥不匹配")
+	}
+	if bits := key.N.BitLen(); bits < minAsymmetricKeyBits || bits > maxAsymmetricKeyBits {
+		return nil, fmt.Errorf("Basic256Sha256要求%d~%d位RSA密钥，当前为%d位", minAsymmetricKeyBits, maxAsymmetricKeyBits, bits)
+	}
+	if !certificateHasURI(cert, applicationURI) {
+		log.Warn().Str("application_uri", applicationURI).Msg("OPC UA服务端证书的URI与application_uri不一致，部分客户端会拒绝连接")
+	}
+
+	sum := sha1.Sum(der)
+	return &serverSecurity{certificate: der, key: key, thumbprint: sum[:]}, nil
+}
+
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	der := data
+	if block, _ := pem.Decode(data); block != nil {
+		der = block.Bytes
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("私钥不是RSA密钥")
+	}
+	return key, nil
+}
+
+func certificateHasURI(cert *x509.Certificate, uri string) bool {
+	for _, u := range cert.URIs {
+		if u.String() == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// generateServerCertificate 生成包含应用URI和主机名的自签名应用实例证书
+func generateServerCertificate(certFile, keyFile, applicationURI, endpointURL string) error {
+	key, err := rsa.GenerateKey(rand.Reader, minAsymmetricKeyBits)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   "IoT Gateway OPC UA Server",
+			Organization: []string{"IoT Gateway"},
+		},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  time.Now().AddDate(10, 0, 0),
+		KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment |
+			x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+	}
+	if u, err := url.Parse(applicationURI); err == nil {
+		template.URIs = []*url.URL{u}
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "localhost" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	if u, err := url.Parse(endpointURL); err == nil && u.Hostname() != "" {
+		if ip := net.ParseIP(u.Hostname()); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if u.Hostname() != "localhost" {
+			template.DNSNames = append(template.DNSNames, u.Hostname())
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(certFile, der, 0644); err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return os.WriteFile(keyFile, keyPEM, 0600)
+}
+
+// verifyClient 校验客户端应用实例证书：证书在有效期内，且本身或签发CA在信任目录中
+func (sec *serverSecurity) verifyClient(der []byte) (*x509.Certificate, uint32) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, statusBadCertificateInvalid
+	}
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok || pub.N.BitLen() < minAsymmetricKeyBits || pub.N.BitLen() > maxAsymmetricKeyBits {
+		return nil, statusBadCertificateInvalid
+	}
+	now := time.Now()
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return nil, statusBadCertificateTimeInvalid
+	}
+	if sec.trustAll {
+		return cert, statusGood
+	}
+
+	sum := sha1.Sum(der)
+	thumbprint := hex.EncodeToString(sum[:])
+	roots := x509.NewCertPool()
+	hasCA := false
+	for _, trusted := range sec.loadTrusted() {
+		if bytes.Equal(trusted.Raw, der) {
+			return cert, statusGood
+		}
+		if trusted.IsCA {
+			roots.AddCert(trusted)
+			hasCA = true
+		}
+	}
+	if hasCA {
+		opts := x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}
+		if _, err := cert.Verify(opts); err == nil {
+			return cert, statusGood
+		}
+	}
+
+	log.Warn().
+		Str("subject", cert.Subject.String()).
+		Str("thumbprint", thumbprint).
+		Str("trusted_dir", sec.trustedDir).
+		Msg("OPC UA客户端证书不受信任，将证书放入信任目录后重新连接")
+	return nil, statusBadCertificateUntrusted
+}
+
+// loadTrusted 读取信任目录中的证书（DER或PEM）
+func (sec *serverSecurity) loadTrusted() []*x509.Certificate {
+	if sec.trustedDir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(sec.trustedDir)
+	if err != nil {
+		return nil
+	}
+	var certs []*x509.Certificate
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(sec.trustedDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		for len(data) > 0 {
+			block, rest := pem.Decode(data)
+			if block == nil {
+				// 非PEM文件按单个DER证书处理
+				if cert, err := x509.ParseCertificate(data); err == nil {
+					certs = append(certs, cert)
+				}
+				break
+			}
+			if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+				certs = append(certs, cert)
+			}
+			data = rest
+		}
+	}
+	return certs
+}
+
+// sign 使用服务端私钥签名（RSA-PKCS1-v1_5-SHA256）
+func (sec *serverSecurity) sign(data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	return rsa.SignPKCS1v15(rand.Reader, sec.key, crypto.SHA256, digest[:])
+}
+
+// decrypt 使用服务端私钥按块解密（RSA-OAEP-SHA1）
+func (sec *serverSecurity) decrypt(data []byte) ([]byte, error) {
+	size := sec.key.Size()
+	if len(data) == 0 || len(data)%size != 0 {
+		return nil, fmt.Errorf("密文长度%d不是密钥长度%d的整数倍", len(data), size)
+	}
+	plain := make([]byte, 0, len(data))
+	for off := 0; off < len(data); off += size {
+		block, err := rsa.DecryptOAEP(sha1.New(), nil, sec.key, data[off:off+size], nil)
+		if err != nil {
+			return nil, err
+		}
+		plain = append(plain, block...)
+	}
+	return plain, nil
+}
+
+// decryptPassword 解密UserNameIdentityToken中的密码，明文格式为 长度(4) + 密码 + 服务端Nonce
+func (sec *serverSecurity) decryptPassword(data, serverNonce []byte) ([]byte, error) {
+	plain, err := sec.decrypt(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(plain) < 4 {
+		return nil, fmt.Errorf("密码令牌过短")
+	}
+	n := int(binary.LittleEndian.Uint32(plain))
+	if n < len(serverNonce) || n > len(plain)-4 {
+		return nil, fmt.Errorf("密码令牌长度无效")
+	}
+	secret := plain[4 : 4+n]
+	password, nonce := secret[:n-len(serverNonce)], secret[n-len(serverNonce):]
+	if !hmac.Equal(nonce, serverNonce) {
+		return nil, fmt.Errorf("密码令牌中的Nonce不匹配")
+	}
+	return password, nil
+}
+
+// rsaVerify 校验对端的RSA-PKCS1-v1_5-SHA256签名
+func rsaVerify(pub *rsa.PublicKey, data, signature []byte) error {
+	digest := sha256.Sum256(data)
+	return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature)
+}
+
+// rsaEncrypt 使用对端公钥按块加密（RSA-OAEP-SHA1）
+func rsaEncrypt(pub *rsa.PublicKey, data []byte) ([]byte, error) {
+	plainBlock := pub.Size() - oaepSHA1Overhead
+	out := make([]byte, 0, (len(data)/plainBlock+1)*pub.Size())
+	for off := 0; off < len(data); off += plainBlock {
+		end := min(off+plainBlock, len(data))
+		block, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, pub, data[off:end], nil)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, block...)
+	}
+	return out, nil
+}
+
+// symmetricKeys 从双方Nonce派生的一组对称密钥
+type symmetricKeys struct {
+	signing    []byte
+	encrypting []byte
+	iv         []byte
+}
+
+// deriveKeys 按P_SHA256派生签名密钥、加密密钥和初始向量
+// 客户端密钥以ServerNonce为secret、ClientNonce为seed，服务端密钥相反
+func deriveKeys(secret, seed []byte) symmetricKeys {
+	length := symmetricSignatureSize + symmetricKeySize + symmetricBlockSize
+	out := make([]byte, 0, length+sha256.Size)
+	a := seed
+	for len(out) < length {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(a)
+		a = mac.Sum(nil)
+
+		mac = hmac.New(sha256.New, secret)
+		mac.Write(a)
+		mac.Write(seed)
+		out = mac.Sum(out)
+	}
+	return symmetricKeys{
+		signing:    out[:symmetricSignatureSize],
+		encrypting: out[symmetricSignatureSize : symmetricSignatureSize+symmetricKeySize],
+		iv:         out[symmetricSignatureSize+symmetricKeySize : length],
+	}
+}
+
+func (k symmetricKeys) mac(parts ...[]byte) []byte {
+	mac := hmac.New(sha256.New, k.signing)
+	for _, p := range parts {
+		mac.Write(p)
+	}
+	return mac.Sum(nil)
+}
+
+// crypt 以AES-256-CBC原地加密或解密
+func (k symmetricKeys) crypt(data []byte, encrypt bool) error {
+	if len(data)%symmetricBlockSize != 0 {
+		return fmt.Errorf("密文长度%d不是分组长度的整数倍", len(data))
+	}
+	block, err := aes.NewCipher(k.encrypting)
+	if err != nil {
+		return err
+	}
+	if encrypt {
+		cipher.NewCBCEncrypter(block, k.iv).CryptBlocks(data, data)
+	} else {
+		cipher.NewCBCDecrypter(block, k.iv).CryptBlocks(data, data)
+	}
+	return nil
+}
+
+// appendPadding 追加填充，使 len(data)+填充+extra+签名 为分组长度的整数倍
+// 填充由PaddingSize字节和PaddingSize个同值字节组成，密钥超过2048位时再追加ExtraPaddingSize
+func appendPadding(data []byte, blockSize, signatureSize int, extra bool) []byte {
+	overhead := 1
+	if extra {
+		overhead = 2
+	}
+	padding := (blockSize - (len(data)+overhead+signatureSize)%blockSize) % blockSize
+	for i := 0; i <= padding; i++ {
+		data = append(data, byte(padding))
+	}
+	if extra {
+		data = append(data, byte(padding>>8))
+	}
+	return data
+}
+
+// stripPadding 去掉解密后消息末尾（签名之前）的填充
+func stripPadding(data []byte, extra bool) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("消息缺少填充")
+	}
+	padding, overhead := int(data[len(data)-1]), 1
+	if extra {
+		if len(data) < 2 {
+			return nil, fmt.Errorf("消息缺少填充")
+		}
+		padding, overhead = padding<<8|int(data[len(data)-2]), 2
+	}
+	if padding+overhead > len(data) {
+		return nil, fmt.Errorf("填充长度%d无效", padding)
+	}
+	return data[:len(data)-padding-overhead], nil
+}
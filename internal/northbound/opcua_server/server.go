@@ -0,0 +1,324 @@
+package opcua_server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// writeHandler 客户端写入变量时的回调，返回OPC UA状态码
+type writeHandler func(deviceID, key string, value interface{}, user string) uint32
+
+// serverOptions 服务端协议层参数
+type serverOptions struct {
+	endpointURL     string
+	applicationURI  string
+	productURI      string
+	applicationName string
+	allowAnonymous  bool
+	users           map[string]UserConfig
+	maxSessions     int
+	maxSubsPerSess  int
+	minPublishing   time.Duration
+	endpoints       []endpointSecurity
+	security        *serverSecurity // 服务端证书，仅None策略且无用户时为空
+}
+
+// uaServer OPC UA二进制协议服务端
+type uaServer struct {
+	opts    serverOptions
+	space   *addressSpace
+	onWrite writeHandler
+
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	channels map[*secureChannel]struct{}
+	sessions map[nodeID]*session // authenticationToken -> 会话
+	monitors map[nodeID]map[*monitoredItem]struct{}
+
+	nextChannelID atomic.Uint32
+	nextSessionID atomic.Uint32
+	nextSubID     atomic.Uint32
+	nextItemID    atomic.Uint32
+	stopCh        chan struct{}
+}
+
+func newUAServer(opts serverOptions, space *addressSpace, onWrite writeHandler) *uaServer {
+	srv := &uaServer{
+		opts:     opts,
+		space:    space,
+		onWrite:  onWrite,
+		channels: make(map[*secureChannel]struct{}),
+		sessions: make(map[nodeID]*session),
+		monitors: make(map[nodeID]map[*monitoredItem]struct{}),
+		stopCh:   make(chan struct{}),
+	}
+	space.onChange = srv.valueChanged
+	return srv
+}
+
+// start 开始监听
+func (srv *uaServer) start(listen string) error {
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+	srv.listener = ln
+
+	srv.wg.Add(2)
+	go srv.acceptLoop()
+	go srv.sessionJanitor()
+	return nil
+}
+
+func (srv *uaServer) acceptLoop() {
+	defer srv.wg.Done()
+	for {
+		conn, err := srv.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		ch := &secureChannel{
+			srv:       srv,
+			conn:      conn,
+			chunkSize: serverBufferSize,
+			partial:   make(map[uint32][]byte),
+		}
+		srv.mu.Lock()
+		srv.channels[ch] = struct{}{}
+		srv.mu.Unlock()
+
+		srv.wg.Add(1)
+		go func() {
+			defer srv.wg.Done()
+			ch.serve()
+		}()
+	}
+}
+
+// sessionJanitor 清理超时会话
+func (srv *uaServer) sessionJanitor() {
+	defer srv.wg.Done()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			var expired []*session
+			srv.mu.Lock()
+			for _, s := range srv.sessions {
+				if now.Sub(s.lastActivity()) > s.timeout {
+					expired = append(expired, s)
+				}
+			}
+			srv.mu.Unlock()
+			for _, s := range expired {
+				log.Info().Str("session", s.name).Msg("OPC UA会话超时")
+				srv.closeSession(s)
+			}
+		case <-srv.stopCh:
+			return
+		}
+	}
+}
+
+// stop 关闭监听、连接和会话
+func (srv *uaServer) stop() {
+	close(srv.stopCh)
+	if srv.listener != nil {
+		srv.listener.Close()
+	}
+
+	srv.mu.Lock()
+	channels := make([]*secureChannel, 0, len(srv.channels))
+	for ch := range srv.channels {
+		channels = append(channels, ch)
+	}
+	sessions := make([]*session, 0, len(srv.sessions))
+	for _, s := range srv.sessions {
+		sessions = append(sessions, s)
+	}
+	srv.mu.Unlock()
+
+	for _, s := range sessions {
+		srv.closeSession(s)
+	}
+	for _, ch := range channels {
+		ch.close()
+	}
+	srv.wg.Wait()
+}
+
+// channelClosed 连接关闭时回收状态，会话保留到超时以便客户端重连
+func (srv *uaServer) channelClosed(ch *secureChannel) {
+	srv.mu.Lock()
+	delete(srv.channels, ch)
+	srv.mu.Unlock()
+}
+
+// stats 返回当前连接和会话数
+func (srv *uaServer) stats() (channels, sessions, subscriptions int) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for _, s := range srv.sessions {
+		subscriptions += s.subscriptionCount()
+	}
+	return len(srv.channels), len(srv.sessions), subscriptions
+}
+
+// acceptsPolicy 通道可以使用的安全策略，None总是接受以便客户端发现端点
+func (srv *uaServer) acceptsPolicy(policy string) bool {
+	if policy == securityPolicyNone {
+		return true
+	}
+	for _, ep := range srv.opts.endpoints {
+		if ep.policy == policy {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsMode 安全策略下可以使用的消息安全模式
+func (srv *uaServer) acceptsMode(policy string, mode uint32) bool {
+	if policy == securityPolicyNone {
+		return mode == securityModeNone
+	}
+	return srv.offersEndpoint(policy, mode)
+}
+
+// offersEndpoint 是否提供该安全配置的端点，会话只能建立在提供的端点上
+func (srv *uaServer) offersEndpoint(policy string, mode uint32) bool {
+	for _, ep := range srv.opts.endpoints {
+		if ep.policy == policy && ep.mode == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate 校验用户令牌，返回用户名（匿名为空）
+// 密码须用服务端证书加密；明文密码只在SignAndEncrypt通道上接受
+func (srv *uaServer) authenticate(ch *secureChannel, token extensionObject, serverNonce []byte) (string, uint32) {
+	switch token.typeID {
+	case 0, idAnonymousIdentityToken:
+		if !srv.opts.allowAnonymous {
+			return "", statusBadIdentityTokenRejected
+		}
+		return "", statusGood
+	case idUserNameIdentityToken:
+		d := newDecoder(token.body)
+		d.string() // PolicyId
+		username := d.string()
+		password := d.byteString()
+		algorithm := d.string()
+		if d.err != nil {
+			return "", statusBadIdentityTokenInvalid
+		}
+		switch algorithm {
+		case "":
+			if ch.mode != securityModeSignAndEncrypt {
+				log.Warn().Str("user", username).Msg("拒绝未加密通道上的明文密码")
+				return "", statusBadIdentityTokenRejected
+			}
+		case algorithmRSAOAEP:
+			if srv.opts.security == nil {
+				return "", statusBadIdentityTokenInvalid
+			}
+			var err error
+			if password, err = srv.opts.security.decryptPassword(password, serverNonce); err != nil {
+				log.Debug().Err(err).Str("user", username).Msg("解密OPC UA用户密码失败")
+				return "", statusBadIdentityTokenInvalid
+			}
+		default:
+			return "", statusBadIdentityTokenInvalid
+		}
+		user, ok := srv.opts.users[username]
+		if !ok || subtle.ConstantTimeCompare([]byte(user.Password), password) != 1 {
+			return "", statusBadUserAccessDenied
+		}
+		return username, statusGood
+	default:
+		return "", statusBadIdentityTokenInvalid
+	}
+}
+
+// canWrite 判断用户是否有写权限
+func (srv *uaServer) canWrite(user string) bool {
+	if user == "" {
+		return false
+	}
+	return srv.opts.users[user].Write
+}
+
+// valueChanged 地址空间变量值变化时通知监视项（在地址空间锁内调用，只做入队）
+func (srv *uaServer) valueChanged(id nodeID, dv dataValue) {
+	srv.mu.Lock()
+	items := srv.monitors[id]
+	for item := range items {
+		item.enqueue(dv)
+	}
+	srv.mu.Unlock()
+}
+
+// registerItem 建立节点到监视项的索引
+func (srv *uaServer) registerItem(item *monitoredItem) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.monitors[item.nodeID] == nil {
+		srv.monitors[item.nodeID] = make(map[*monitoredItem]struct{})
+	}
+	srv.monitors[item.nodeID][item] = struct{}{}
+}
+
+func (srv *uaServer) unregisterItem(item *monitoredItem) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if items, ok := srv.monitors[item.nodeID]; ok {
+		delete(items, item)
+		if len(items) == 0 {
+			delete(srv.monitors, item.nodeID)
+		}
+	}
+}
+
+// lookupSession 根据认证令牌查找会话
+func (srv *uaServer) lookupSession(token nodeID) *session {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.sessions[token]
+}
+
+// closeSession 删除会话及其订阅
+func (srv *uaServer) closeSession(s *session) {
+	srv.mu.Lock()
+	delete(srv.sessions, s.authToken)
+	srv.mu.Unlock()
+	s.close()
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
+
+func randomToken() string {
+	return hex.EncodeToString(randomBytes(16))
+}
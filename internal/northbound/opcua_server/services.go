@@ -0,0 +1,1138 @@
+package opcua_server
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"math"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// 服务参数限制
+const (
+	maxOperationsPerRequest = 1000
+	maxContinuationPoints   = 16
+	defaultSessionTimeout   = 60 * time.Second
+	minSessionTimeout       = 10 * time.Second
+	maxSessionTimeout       = time.Hour
+	defaultKeepAliveCount   = 10
+)
+
+// 扩展状态码
+const (
+	statusBadTooManySessions           uint32 = 0x80560000
+	statusBadTooManySubscriptions      uint32 = 0x80770000
+	statusBadNoContinuationPoints      uint32 = 0x804B0000
+	statusBadTimestampsToReturnInvalid uint32 = 0x802B0000
+	statusBadMonitoringModeInvalid     uint32 = 0x80410000
+)
+
+// requestHeader 请求头
+type requestHeader struct {
+	authToken nodeID
+	handle    uint32
+	timeout   uint32
+}
+
+func decodeRequestHeader(d *decoder) requestHeader {
+	var h requestHeader
+	h.authToken = d.nodeID()
+	d.dateTime() // Timestamp
+	h.handle = d.uint32()
+	d.uint32() // ReturnDiagnostics
+	d.string() // AuditEntryId
+	h.timeout = d.uint32()
+	d.extensionObject() // AdditionalHeader
+	return h
+}
+
+func encodeResponseHeader(e *encoder, handle, status uint32) {
+	e.dateTime(time.Now())
+	e.uint32(handle)
+	e.statusCode(status)
+	e.diagnosticInfo()
+	e.emptyArray() // StringTable
+	e.nullExtensionObject()
+}
+
+// browseDescription 浏览条件
+type browseDescription struct {
+	nodeID          nodeID
+	direction       uint32 // 0正向 1反向 2双向
+	refType         nodeID
+	includeSubtypes bool
+	nodeClassMask   uint32
+	resultMask      uint32
+}
+
+// referenceDescription 浏览结果中的引用
+type referenceDescription struct {
+	refType     nodeID
+	forward     bool
+	target      nodeID
+	browseName  qualifiedName
+	displayName string
+	nodeClass   uint32
+	typeDef     nodeID
+}
+
+// applyResultMask 按ResultMask清空未请求的字段
+func (rd referenceDescription) applyResultMask(mask uint32) referenceDescription {
+	if mask&0x01 == 0 {
+		rd.refType = nodeID{}
+	}
+	if mask&0x02 == 0 {
+		rd.forward = false
+	}
+	if mask&0x04 == 0 {
+		rd.nodeClass = 0
+	}
+	if mask&0x08 == 0 {
+		rd.browseName = qualifiedName{}
+	}
+	if mask&0x10 == 0 {
+		rd.displayName = ""
+	}
+	if mask&0x20 == 0 {
+		rd.typeDef = nodeID{}
+	}
+	return rd
+}
+
+func (rd referenceDescription) encode(e *encoder) {
+	e.nodeID(rd.refType)
+	e.boolean(rd.forward)
+	e.expandedNodeID(rd.target)
+	e.qualifiedName(rd.browseName.ns, rd.browseName.name)
+	e.localizedText(rd.displayName)
+	e.uint32(rd.nodeClass)
+	e.expandedNodeID(rd.typeDef)
+}
+
+// serviceHandler 服务处理函数，返回响应类型ID、响应体（不含响应头）和服务结果
+type serviceHandler func(ch *secureChannel, s *session, hdr requestHeader, d *decoder) (uint32, []byte, uint32)
+
+// dispatch 解码服务请求并发送响应
+func (srv *uaServer) dispatch(ch *secureChannel, requestID uint32, payload []byte) {
+	d := newDecoder(payload)
+	typeID := d.nodeID()
+	hdr := decodeRequestHeader(d)
+	if d.err != nil {
+		srv.serviceFault(ch, requestID, hdr.handle, statusBadDecodingError)
+		return
+	}
+
+	var handler serviceHandler
+	needSession := true
+	switch typeID.num {
+	case idCloseSecureChannelRequest:
+		ch.close()
+		return
+	case idGetEndpointsRequest:
+		handler, needSession = srv.handleGetEndpoints, false
+	case idFindServersRequest:
+		handler, needSession = srv.handleFindServers, false
+	case idCreateSessionRequest:
+		handler, needSession = srv.handleCreateSession, false
+	case idActivateSessionRequest:
+		handler, needSession = srv.handleActivateSession, false
+	case idCloseSessionRequest:
+		handler = srv.handleCloseSession
+	case idBrowseRequest:
+		handler = srv.handleBrowse
+	case idBrowseNextRequest:
+		handler = srv.handleBrowseNext
+	case idTranslateBrowsePathsRequest:
+		handler = srv.handleTranslateBrowsePaths
+	case idRegisterNodesRequest:
+		handler = srv.handleRegisterNodes
+	case idUnregisterNodesRequest:
+		handler = srv.handleUnregisterNodes
+	case idReadRequest:
+		handler = srv.handleRead
+	case idWriteRequest:
+		handler = srv.handleWrite
+	case idCreateSubscriptionRequest:
+		handler = srv.handleCreateSubscription
+	case idModifySubscriptionRequest:
+		handler = srv.handleModifySubscription
+	case idSetPublishingModeRequest:
+		handler = srv.handleSetPublishingMode
+	case idDeleteSubscriptionsRequest:
+		handler = srv.handleDeleteSubscriptions
+	case idPublishRequest:
+		srv.handlePublish(ch, requestID, hdr, d)
+		return
+	case idRepublishRequest:
+		srv.serviceFault(ch, requestID, hdr.handle, statusBadMessageNotAvailable)
+		return
+	case idCreateMonitoredItemsRequest:
+		handler = srv.handleCreateMonitoredItems
+	case idModifyMonitoredItemsRequest:
+		handler = srv.handleModifyMonitoredItems
+	case idSetMonitoringModeRequest:
+		handler = srv.handleSetMonitoringMode
+	case idDeleteMonitoredItemsRequest:
+		handler = srv.handleDeleteMonitoredItems
+	default:
+		log.Debug().Uint32("type_id", typeID.num).Msg("不支持的OPC UA服务")
+		srv.serviceFault(ch, requestID, hdr.handle, statusBadServiceUnsupported)
+		return
+	}
+
+	var s *session
+	if needSession {
+		var status uint32
+		if s, status = srv.checkSession(ch, hdr); status != statusGood {
+			srv.serviceFault(ch, requestID, hdr.handle, status)
+			return
+		}
+	}
+
+	respType, body, status := handler(ch, s, hdr, d)
+	if status == statusGood && d.err != nil {
+		status = statusBadDecodingError
+	}
+	if status != statusGood {
+		srv.serviceFault(ch, requestID, hdr.handle, status)
+		return
+	}
+
+	e := &encoder{}
+	encodeResponseHeader(e, hdr.handle, statusGood)
+	if err := ch.sendResponse(requestID, respType, append(e.bytes(), body...)); err != nil {
+		log.Debug().Err(err).Msg("发送OPC UA响应失败")
+	}
+}
+
+// checkSession 校验请求所属会话已激活且绑定在当前通道
+func (srv *uaServer) checkSession(ch *secureChannel, hdr requestHeader) (*session, uint32) {
+	s := srv.lookupSession(hdr.authToken)
+	if s == nil {
+		return nil, statusBadSessionIDInvalid
+	}
+	s.mu.Lock()
+	activated, bound := s.activated, s.channel == ch
+	s.mu.Unlock()
+	if !activated {
+		return nil, statusBadSessionNotActivated
+	}
+	if !bound {
+		return nil, statusBadSecureChannelIDInvalid
+	}
+	s.touch(nil)
+	return s, statusGood
+}
+
+func (srv *uaServer) serviceFault(ch *secureChannel, requestID, handle, status uint32) {
+	e := &encoder{}
+	encodeResponseHeader(e, handle, status)
+	if err := ch.sendResponse(requestID, idServiceFault, e.bytes()); err != nil {
+		log.Debug().Err(err).Msg("发送OPC UA服务错误失败")
+	}
+}
+
+// ---- 发现服务 ----
+
+func (srv *uaServer) encodeApplicationDescription(e *encoder) {
+	e.string(srv.opts.applicationURI)
+	e.string(srv.opts.productURI)
+	e.localizedText(srv.opts.applicationName)
+	e.uint32(0) // ApplicationType: Server
+	e.nullString()
+	e.nullString()
+	e.stringArray([]string{srv.opts.endpointURL})
+}
+
+func (srv *uaServer) encodeEndpoints(e *encoder) {
+	type tokenPolicy struct {
+		id        string
+		tokenType uint32
+		policy    string
+	}
+	var policies []tokenPolicy
+	if srv.opts.allowAnonymous {
+		policies = append(policies, tokenPolicy{"anonymous", 0, securityPolicyNone})
+	}
+	// 密码总是用服务端证书加密传输，None端点上也是如此
+	if len(srv.opts.users) > 0 && srv.opts.security != nil {
+		policies = append(policies, tokenPolicy{"username", 1, securityPolicyBasic256Sha256})
+	}
+
+	var certificate []byte
+	if srv.opts.security != nil {
+		certificate = srv.opts.security.certificate
+	}
+
+	e.int32(int32(len(srv.opts.endpoints)))
+	for _, ep := range srv.opts.endpoints {
+		e.string(srv.opts.endpointURL)
+		srv.encodeApplicationDescription(e)
+		e.byteString(certificate)
+		e.uint32(ep.mode)
+		e.string(ep.policy)
+
+		e.int32(int32(len(policies)))
+		for _, p := range policies {
+			e.string(p.id)
+			e.uint32(p.tokenType)
+			e.nullString()
+			e.nullString()
+			e.string(p.policy)
+		}
+
+		e.string(transportProfile)
+		e.byte(ep.securityLevel())
+	}
+}
+
+func (srv *uaServer) handleGetEndpoints(ch *secureChannel, s *session, hdr requestHeader, d *decoder) (uint32, []byte, uint32) {
+	d.string()      // EndpointUrl
+	d.stringArray() // LocaleIds
+	d.stringArray() // ProfileUris
+
+	e := &encoder{}
+	srv.encodeEndpoints(e)
+	return idGetEndpointsResponse, e.bytes(), statusGood
+}
+
+func (srv *uaServer) handleFindServers(ch *secureChannel, s *session, hdr requestHeader, d *decoder) (uint32, []byte, uint32) {
+	d.string()      // EndpointUrl
+	d.stringArray() // LocaleIds
+	d.stringArray() // ServerUris
+
+	e := &encoder{}
+	e.int32(1)
+	srv.encodeApplicationDescription(e)
+	return idFindServersResponse, e.bytes(), statusGood
+}
+
+// ---- 会话服务 ----
+
+// skipApplicationDescription 跳过客户端应用描述
+func skipApplicationDescription(d *decoder) {
+	d.string()
+	d.string()
+	d.localizedText()
+	d.uint32()
+	d.string()
+	d.string()
+	d.stringArray()
+}
+
+func (srv *uaServer) handleCreateSession(ch *secureChannel, _ *session, hdr requestHeader, d *decoder) (uint32, []byte, uint32) {
+	skipApplicationDescription(d)
+	d.string() // ServerUri
+	d.string() // EndpointUrl
+	name := d.string()
+	clientNonce := d.byteString()
+	clientCert := d.byteString()
+	requested := d.double()
+	d.uint32() // MaxResponseMessageSize
+	if d.err != nil {
+		return 0, nil, statusBadDecodingError
+	}
+	// None通道只用于发现端点，除非配置提供了None端点
+	if !srv.offersEndpoint(ch.policy, ch.mode) {
+		return 0, nil, statusBadSecurityPolicyRejected
+	}
+
+	// 安全通道上用服务端私钥对客户端证书和Nonce签名，证明服务端持有证书私钥
+	var signature []byte
+	if ch.secured() {
+		if len(clientNonce) < nonceLength {
+			return 0, nil, statusBadNonceInvalid
+		}
+		if !bytes.Equal(clientCert, ch.clientCertDER) {
+			return 0, nil, statusBadCertificateInvalid
+		}
+		var err error
+		if signature, err = srv.opts.security.sign(append(append([]byte(nil), clientCert...), clientNonce...)); err != nil {
+			log.Error().Err(err).Msg("OPC UA会话签名失败")
+			return 0, nil, statusBadUnexpectedError
+		}
+	}
+
+	timeout := defaultSessionTimeout
+	if requested > 0 && !math.IsInf(requested, 0) && !math.IsNaN(requested) {
+		timeout = time.Duration(requested * float64(time.Millisecond))
+	}
+	if timeout < minSessionTimeout {
+		timeout = minSessionTimeout
+	}
+	if timeout > maxSessionTimeout {
+		timeout = maxSessionTimeout
+	}
+
+	s := &session{
+		srv:           srv,
+		id:            numericID(gatewayNamespace, srv.nextSessionID.Add(1)),
+		authToken:     stringID(gatewayNamespace, randomToken()),
+		name:          name,
+		timeout:       timeout,
+		channel:       ch,
+		serverNonce:   randomBytes(nonceLength),
+		lastSeen:      time.Now(),
+		subscriptions: make(map[uint32]*subscription),
+		continuations: make(map[string]continuation),
+	}
+
+	srv.mu.Lock()
+	if srv.opts.maxSessions > 0 && len(srv.sessions) >= srv.opts.maxSessions {
+		srv.mu.Unlock()
+		return 0, nil, statusBadTooManySessions
+	}
+	srv.sessions[s.authToken] = s
+	srv.mu.Unlock()
+
+	log.Info().Str("session", name).Str("remote", ch.conn.RemoteAddr().String()).Msg("OPC UA会话已创建")
+
+	e := &encoder{}
+	e.nodeID(s.id)
+	e.nodeID(s.authToken)
+	e.double(float64(timeout / time.Millisecond))
+	e.byteString(s.serverNonce)
+	if srv.opts.security != nil {
+		e.byteString(srv.opts.security.certificate)
+	} else {
+		e.byteString(nil)
+	}
+	srv.encodeEndpoints(e)
+	e.emptyArray() // ServerSoftwareCertificates
+	if signature != nil {
+		e.string(algorithmRSASHA256)
+	} else {
+		e.nullString()
+	}
+	e.byteString(signature)
+	e.uint32(maxMessageSize)
+	return idCreateSessionResponse, e.bytes(), statusGood
+}
+
+func (srv *uaServer) handleActivateSession(ch *secureChannel, _ *session, hdr requestHeader, d *decoder) (uint32, []byte, uint32) {
+	s := srv.lookupSession(hdr.authToken)
+	if s == nil {
+		return 0, nil, statusBadSessionIDInvalid
+	}
+
+	signatureAlgorithm := d.string()
+	signature := d.byteString()
+	n := d.arrayLen() // ClientSoftwareCertificates
+	for i := 0; i < n && d.err == nil; i++ {
+		d.byteString()
+		d.byteString()
+	}
+	d.stringArray() // LocaleIds
+	token := d.extensionObject()
+	d.string() // UserTokenSignature
+	d.byteString()
+	if d.err != nil {
+		return 0, nil, statusBadDecodingError
+	}
+	if !srv.offersEndpoint(ch.policy, ch.mode) {
+		return 0, nil, statusBadSecurityPolicyRejected
+	}
+
+	s.mu.Lock()
+	serverNonce := s.serverNonce
+	s.mu.Unlock()
+
+	// 客户端对服务端证书和最近的服务端Nonce签名，证明持有通道所用证书的私钥
+	if ch.secured() {
+		pub := ch.clientCert.PublicKey.(*rsa.PublicKey)
+		data := append(append([]byte(nil), srv.opts.security.certificate...), serverNonce...)
+		if signatureAlgorithm != algorithmRSASHA256 || rsaVerify(pub, data, signature) != nil {
+			log.Warn().Str("session", s.name).Msg("OPC UA客户端签名无效")
+			return 0, nil, statusBadApplicationSignatureInvalid
+		}
+	}
+
+	user, status := srv.authenticate(ch, token, serverNonce)
+	if status != statusGood {
+		log.Warn().Str("session", s.name).Str("user", user).Msg("OPC UA会话认证失败")
+		return 0, nil, status
+	}
+
+	s.mu.Lock()
+	// 已激活的会话只能由同一用户转移到新通道
+	if s.activated && s.user != user {
+		s.mu.Unlock()
+		return 0, nil, statusBadUserAccessDenied
+	}
+	s.activated = true
+	s.user = user
+	s.channel = ch
+	s.lastSeen = time.Now()
+	s.serverNonce = randomBytes(nonceLength)
+	nonce := s.serverNonce
+	s.mu.Unlock()
+
+	e := &encoder{}
+	e.byteString(nonce)
+	e.emptyArray()
+	e.emptyArray()
+	return idActivateSessionResponse, e.bytes(), statusGood
+}
+
+func (srv *uaServer) handleCloseSession(ch *secureChannel, s *session, hdr requestHeader, d *decoder) (uint32, []byte, uint32) {
+	d.boolean() // DeleteSubscriptions，会话关闭时订阅总是删除
+	srv.closeSession(s)
+	log.Info().Str("session", s.name).Msg("OPC UA会话已关闭")
+	return idCloseSessionResponse, nil, statusGood
+}
+
+// ---- 浏览服务 ----
+
+// continuation 浏览续传点保存的剩余引用
+type continuation struct {
+	refs    []referenceDescription
+	maxRefs uint32
+}
+
+// storeContinuation 保存剩余引用，返回续传点
+func (s *session) storeContinuation(c continuation) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.continuations) >= maxContinuationPoints {
+		return nil, false
+	}
+	token := randomToken()
+	s.continuations[token] = c
+	return []byte(token), true
+}
+
+func (s *session) takeContinuation(cp []byte) (continuation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.continuations[string(cp)]
+	delete(s.continuations, string(cp))
+	return c, ok
+}
+
+// encodeBrowseResult 编码浏览结果，超过maxRefs时保存续传点
+func encodeBrowseResult(e *encoder, s *session, status uint32, refs []referenceDescription, maxRefs uint32) {
+	var cp []byte
+	if status == statusGood && maxRefs > 0 && uint32(len(refs)) > maxRefs {
+		var ok bool
+		if cp, ok = s.storeContinuation(continuation{refs: refs[maxRefs:], maxRefs: maxRefs}); ok {
+			refs = refs[:maxRefs]
+		} else {
+			status, refs = statusBadNoContinuationPoints, nil
+		}
+	}
+	e.statusCode(status)
+	e.byteString(cp)
+	e.int32(int32(len(refs)))
+	for _, rd := range refs {
+		rd.encode(e)
+	}
+}
+
+func (srv *uaServer) handleBrowse(ch *secureChannel, s *session, hdr requestHeader, d *decoder) (uint32, []byte, uint32) {
+	d.nodeID()   // View.ViewId
+	d.dateTime() // View.Timestamp
+	d.uint32()   // View.ViewVersion
+	maxRefs := d.uint32()
+	n := d.arrayLen()
+	if n == 0 {
+		return 0, nil, statusBadNothingToDo
+	}
+	if n > maxOperationsPerRequest {
+		return 0, nil, statusBadTooManyOperations
+	}
+
+	e := &encoder{}
+	e.int32(int32(n))
+	for i := 0; i < n && d.err == nil; i++ {
+		bd := browseDescription{
+			nodeID:          d.nodeID(),
+			direction:       d.uint32(),
+			refType:         d.nodeID(),
+			includeSubtypes: d.boolean(),
+			nodeClassMask:   d.uint32(),
+			resultMask:      d.uint32(),
+		}
+		refs, status := srv.space.browse(bd)
+		for j := range refs {
+			refs[j] = refs[j].applyResultMask(bd.resultMask)
+		}
+		encodeBrowseResult(e, s, status, refs, maxRefs)
+	}
+	e.emptyArray()
+	return idBrowseResponse, e.bytes(), statusGood
+}
+
+func (srv *uaServer) handleBrowseNext(ch *secureChannel, s *session, hdr requestHeader, d *decoder) (uint32, []byte, uint32) {
+	release := d.boolean()
+	n := d.arrayLen()
+	if n == 0 {
+		return 0, nil, statusBadNothingToDo
+	}
+
+	e := &encoder{}
+	e.int32(int32(n))
+	for i := 0; i < n && d.err == nil; i++ {
+		c, ok := s.takeContinuation(d.byteString())
+		switch {
+		case !ok:
+			encodeBrowseResult(e, s, statusBadContinuationPointInvalid, nil, 0)
+		case release:
+			encodeBrowseResult(e, s, statusGood, nil, 0)
+		default:
+			// 续传时沿用首次浏览的每节点上限
+			encodeBrowseResult(e, s, statusGood, c.refs, c.maxRefs)
+		}
+	}
+	e.emptyArray()
+	return idBrowseNextResponse, e.bytes(), statusGood
+}
+
+func (srv *uaServer) handleTranslateBrowsePaths(ch *secureChannel, s *session, hdr requestHeader, d *decoder) (uint32, []byte, uint32) {
+	n := d.arrayLen()
+	if n == 0 {
+		return 0, nil, statusBadNothingToDo
+	}
+	if n > maxOperationsPerRequest {
+		return 0, nil, statusBadTooManyOperations
+	}
+
+	e := &encoder{}
+	e.int32(int32(n))
+	for i := 0; i < n && d.err == nil; i++ {
+		start := d.nodeID()
+		m := d.arrayLen()
+		names := make([]qualifiedName, 0, m)
+		for j := 0; j < m && d.err == nil; j++ {
+			d.nodeID()  // ReferenceTypeId
+			d.boolean() // IsInverse
+			d.boolean() // IncludeSubtypes
+			names = append(names, d.qualifiedName())
+		}
+
+		if len(names) == 0 {
+			e.statusCode(statusBadNothingToDo)
+			e.emptyArray()
+			continue
+		}
+		target, status := srv.space.translatePath(start, names)
+		e.statusCode(status)
+		if status != statusGood {
+			e.emptyArray()
+			continue
+		}
+		e.int32(1)
+		e.expandedNodeID(target)
+		e.uint32(math.MaxUint32) // RemainingPathIndex
+	}
+	e.emptyArray()
+	return idTranslateBrowsePathsResponse, e.bytes(), statusGood
+}
+
+func (srv *uaServer) handleRegisterNodes(ch *secureChannel, s *session, hdr requestHeader, d *decoder) (uint32, []byte, uint32) {
+	n := d.arrayLen()
+	if n == 0 {
+		return 0, nil, statusBadNothingToDo
+	}
+	e := &encoder{}
+	e.int32(int32(n))
+	for i := 0; i < n && d.err == nil; i++ {
+		e.nodeID(d.nodeID())
+	}
+	return idRegisterNodesResponse, e.bytes(), statusGood
+}
+
+func (srv *uaServer) handleUnregisterNodes(ch *secureChannel, s *session, hdr requestHeader, d *decoder) (uint32, []byte, uint32) {
+	n := d.arrayLen()
+	for i := 0; i < n && d.err == nil; i++ {
+		d.nodeID()
+	}
+	return idUnregisterNodesResponse, nil, statusGood
+}
+
+// ---- 读写服务 ----
+
+func (srv *uaServer) handleRead(ch *secureChannel, s *session, hdr requestHeader, d *decoder) (uint32, []byte, uint32) {
+	d.double() // MaxAge，总是返回最新值
+	timestamps := d.uint32()
+	if timestamps > 3 {
+		return 0, nil, statusBadTimestampsToReturnInvalid
+	}
+	n := d.arrayLen()
+	if n == 0 {
+		return 0, nil, statusBadNothingToDo
+	}
+	if n > maxOperationsPerRequest {
+		return 0, nil, statusBadTooManyOperations
+	}
+
+	e := &encoder{}
+	e.int32(int32(n))
+	for i := 0; i < n && d.err == nil; i++ {
+		id := d.nodeID()
+		attr := d.uint32()
+		d.string()        // IndexRange
+		d.qualifiedName() // DataEncoding
+
+		dv := srv.space.readAttribute(id, attr)
+		if attr == attrValue && dv.hasValue {
+			dv = filterTimestamps(dv, timestamps)
+		}
+		e.dataValue(dv)
+	}
+	e.emptyArray()
+	return idReadResponse, e.bytes(), statusGood
+}
+
+func (srv *uaServer) handleWrite(ch *secureChannel, s *session, hdr requestHeader, d *decoder) (uint32, []byte, uint32) {
+	n := d.arrayLen()
+	if n == 0 {
+		return 0, nil, statusBadNothingToDo
+	}
+	if n > maxOperationsPerRequest {
+		return 0, nil, statusBadTooManyOperations
+	}
+
+	s.mu.Lock()
+	user := s.user
+	s.mu.Unlock()
+
+	results := make([]uint32, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		id := d.nodeID()
+		attr := d.uint32()
+		d.string() // IndexRange
+		dv := d.dataValue()
+		results = append(results, srv.writeValue(id, attr, dv, user))
+	}
+
+	e := &encoder{}
+	e.statusCodeArray(results)
+	e.emptyArray()
+	return idWriteResponse, e.bytes(), statusGood
+}
+
+// writeValue 处理单个变量写入，写入值作为命令转发，不直接修改地址空间
+func (srv *uaServer) writeValue(id nodeID, attr uint32, dv dataValue, user string) uint32 {
+	deviceID, key, writable, found := srv.space.pointBinding(id)
+	switch {
+	case !found:
+		return statusBadNodeIDUnknown
+	case attr != attrValue || !writable || srv.onWrite == nil:
+		return statusBadNotWritable
+	case !srv.canWrite(user):
+		return statusBadUserAccessDenied
+	case !dv.hasValue || dv.value.typeID == 0:
+		return statusBadTypeMismatch
+	}
+	return srv.onWrite(deviceID, key, goValue(dv.value), user)
+}
+
+// ---- 订阅服务 ----
+
+// reviseSubscription 修正订阅参数
+func (srv *uaServer) reviseSubscription(interval float64, lifetime, keepAlive uint32) (time.Duration, uint32, uint32) {
+	revised := srv.opts.minPublishing
+	if interval > 0 && !math.IsNaN(interval) && !math.IsInf(interval, 0) {
+		if d := time.Duration(interval * float64(time.Millisecond)); d > revised {
+			revised = d
+		}
+	}
+	if revised > time.Hour {
+		revised = time.Hour
+	}
+	if keepAlive == 0 {
+		keepAlive = defaultKeepAliveCount
+	}
+	if lifetime < keepAlive*3 {
+		lifetime = keepAlive * 3
+	}
+	return revised, lifetime, keepAlive
+}
+
+func (srv *uaServer) handleCreateSubscription(ch *secureChannel, s *session, hdr requestHeader, d *decoder) (uint32, []byte, uint32) {
+	interval := d.double()
+	lifetime := d.uint32()
+	keepAlive := d.uint32()
+	maxNotifs := d.uint32()
+	enabled := d.boolean()
+	d.byte() // Priority
+	if d.err != nil {
+		return 0, nil, statusBadDecodingError
+	}
+
+	revised, lifetime, keepAlive := srv.reviseSubscription(interval, lifetime, keepAlive)
+	sub := newSubscription(s, srv.nextSubID.Add(1), revised, lifetime, keepAlive, maxNotifs, enabled)
+
+	s.mu.Lock()
+	if srv.opts.maxSubsPerSess > 0 && len(s.subscriptions) >= srv.opts.maxSubsPerSess {
+		s.mu.Unlock()
+		return 0, nil, statusBadTooManySubscriptions
+	}
+	s.subscriptions[sub.id] = sub
+	s.mu.Unlock()
+	go sub.run()
+
+	e := &encoder{}
+	e.uint32(sub.id)
+	e.double(float64(revised) / float64(time.Millisecond))
+	e.uint32(lifetime)
+	e.uint32(keepAlive)
+	return idCreateSubscriptionResponse, e.bytes(), statusGood
+}
+
+func (srv *uaServer) handleModifySubscription(ch *secureChannel, s *session, hdr requestHeader, d *decoder) (uint32, []byte, uint32) {
+	sub := s.subscription(d.uint32())
+	interval := d.double()
+	lifetime := d.uint32()
+	keepAlive := d.uint32()
+	maxNotifs := d.uint32()
+	d.byte() // Priority
+	if d.err != nil {
+		return 0, nil, statusBadDecodingError
+	}
+	if sub == nil {
+		return 0, nil, statusBadSubscriptionIDInvalid
+	}
+
+	revised, lifetime, keepAlive := srv.reviseSubscription(interval, lifetime, keepAlive)
+	sub.mu.Lock()
+	sub.interval, sub.lifetime, sub.maxKeepAlive, sub.maxNotifs = revised, lifetime, keepAlive, maxNotifs
+	sub.mu.Unlock()
+	sub.reschedule()
+
+	e := &encoder{}
+	e.double(float64(revised) / float64(time.Millisecond))
+	e.uint32(lifetime)
+	e.uint32(keepAlive)
+	return idModifySubscriptionResponse, e.bytes(), statusGood
+}
+
+func (srv *uaServer) handleSetPublishingMode(ch *secureChannel, s *session, hdr requestHeader, d *decoder) (uint32, []byte, uint32) {
+	enabled := d.boolean()
+	ids := d.uint32Array()
+	if len(ids) == 0 {
+		return 0, nil, statusBadNothingToDo
+	}
+
+	results := make([]uint32, len(ids))
+	for i, id := range ids {
+		sub := s.subscription(id)
+		if sub == nil {
+			results[i] = statusBadSubscriptionIDInvalid
+			continue
+		}
+		sub.mu.Lock()
+		sub.enabled = enabled
+		sub.mu.Unlock()
+	}
+
+	e := &encoder{}
+	e.statusCodeArray(results)
+	e.emptyArray()
+	return idSetPublishingModeResponse, e.bytes(), statusGood
+}
+
+func (srv *uaServer) handleDeleteSubscriptions(ch *secureChannel, s *session, hdr requestHeader, d *decoder) (uint32, []byte, uint32) {
+	ids := d.uint32Array()
+	if len(ids) == 0 {
+		return 0, nil, statusBadNothingToDo
+	}
+
+	results := make([]uint32, len(ids))
+	for i, id := range ids {
+		if !s.removeSubscription(id) {
+			results[i] = statusBadSubscriptionIDInvalid
+		}
+	}
+
+	e := &encoder{}
+	e.statusCodeArray(results)
+	e.emptyArray()
+	return idDeleteSubscriptionsResponse, e.bytes(), statusGood
+}
+
+// handlePublish 保存发布请求，由订阅的发布循环在有通知或保活到期时响应
+func (srv *uaServer) handlePublish(ch *secureChannel, requestID uint32, hdr requestHeader, d *decoder) {
+	s, status := srv.checkSession(ch, hdr)
+	if status != statusGood {
+		srv.serviceFault(ch, requestID, hdr.handle, status)
+		return
+	}
+
+	n := d.arrayLen()
+	acks := make([]uint32, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		subID := d.uint32()
+		d.uint32() // SequenceNumber，不保留重传队列
+		if s.subscription(subID) == nil {
+			acks = append(acks, statusBadSubscriptionIDInvalid)
+		} else {
+			acks = append(acks, statusGood)
+		}
+	}
+	if d.err != nil {
+		srv.serviceFault(ch, requestID, hdr.handle, statusBadDecodingError)
+		return
+	}
+
+	if s.subscriptionCount() == 0 {
+		srv.serviceFault(ch, requestID, hdr.handle, statusBadNoSubscription)
+		return
+	}
+	if !s.queuePublish(publishRequest{channel: ch, requestID: requestID, handle: hdr.handle, acks: acks}) {
+		srv.serviceFault(ch, requestID, hdr.handle, statusBadTooManyPublishRequests)
+	}
+}
+
+// encodePublishResponse 编码发布响应（含响应头）
+func encodePublishResponse(pr publishRequest, subID, seq uint32, notifications []itemNotification, more bool) []byte {
+	e := &encoder{}
+	encodeResponseHeader(e, pr.handle, statusGood)
+	e.uint32(subID)
+	e.emptyArray() // AvailableSequenceNumbers
+	e.boolean(more)
+
+	e.uint32(seq)
+	e.dateTime(time.Now())
+	if len(notifications) == 0 {
+		e.emptyArray()
+	} else {
+		body := &encoder{}
+		body.int32(int32(len(notifications)))
+		for _, n := range notifications {
+			body.uint32(n.clientHandle)
+			body.dataValue(n.value)
+		}
+		body.emptyArray()
+		e.int32(1)
+		e.extensionObject(idDataChangeNotification, body.bytes())
+	}
+
+	e.statusCodeArray(pr.acks)
+	e.emptyArray()
+	return e.bytes()
+}
+
+// monitoringParameters 监视参数
+type monitoringParameters struct {
+	clientHandle uint32
+	queueSize    uint32
+	discardOld   bool
+}
+
+func decodeMonitoringParameters(d *decoder) monitoringParameters {
+	var p monitoringParameters
+	p.clientHandle = d.uint32()
+	d.double()          // SamplingInterval，数据变化时立即入队
+	d.extensionObject() // Filter，不支持死区过滤
+	p.queueSize = d.uint32()
+	p.discardOld = d.boolean()
+	if p.queueSize == 0 {
+		p.queueSize = 1
+	}
+	if p.queueSize > maxItemQueue {
+		p.queueSize = maxItemQueue
+	}
+	return p
+}
+
+func (srv *uaServer) handleCreateMonitoredItems(ch *secureChannel, s *session, hdr requestHeader, d *decoder) (uint32, []byte, uint32) {
+	sub := s.subscription(d.uint32())
+	timestamps := d.uint32()
+	n := d.arrayLen()
+	if sub == nil {
+		return 0, nil, statusBadSubscriptionIDInvalid
+	}
+	if timestamps > 3 {
+		return 0, nil, statusBadTimestampsToReturnInvalid
+	}
+	if n == 0 {
+		return 0, nil, statusBadNothingToDo
+	}
+	if n > maxOperationsPerRequest {
+		return 0, nil, statusBadTooManyOperations
+	}
+
+	e := &encoder{}
+	e.int32(int32(n))
+	for i := 0; i < n && d.err == nil; i++ {
+		id := d.nodeID()
+		attr := d.uint32()
+		d.string()        // IndexRange
+		d.qualifiedName() // DataEncoding
+		mode := d.uint32()
+		params := decodeMonitoringParameters(d)
+
+		status := statusGood
+		current := srv.space.readAttribute(id, attr)
+		switch {
+		case mode > 2:
+			status = statusBadMonitoringModeInvalid
+		case current.status == statusBadNodeIDUnknown || current.status == statusBadAttributeIDInvalid:
+			status = current.status
+		}
+		if status != statusGood {
+			e.statusCode(status)
+			e.uint32(0)
+			e.double(0)
+			e.uint32(0)
+			e.nullExtensionObject()
+			continue
+		}
+
+		item := &monitoredItem{
+			id:           srv.nextItemID.Add(1),
+			sub:          sub,
+			nodeID:       id,
+			attributeID:  attr,
+			clientHandle: params.clientHandle,
+			mode:         mode,
+			queueSize:    params.queueSize,
+			discardOld:   params.discardOld,
+			timestamps:   timestamps,
+		}
+		sub.mu.Lock()
+		sub.items[item.id] = item
+		sub.mu.Unlock()
+		// 只有Value属性会随数据点变化，其他属性仅上报初始值
+		if attr == attrValue {
+			srv.registerItem(item)
+		}
+		item.enqueue(current)
+
+		e.statusCode(statusGood)
+		e.uint32(item.id)
+		e.double(0)
+		e.uint32(item.queueSize)
+		e.nullExtensionObject()
+	}
+	e.emptyArray()
+	return idCreateMonitoredItemsResponse, e.bytes(), statusGood
+}
+
+func (srv *uaServer) handleModifyMonitoredItems(ch *secureChannel, s *session, hdr requestHeader, d *decoder) (uint32, []byte, uint32) {
+	sub := s.subscription(d.uint32())
+	timestamps := d.uint32()
+	n := d.arrayLen()
+	if sub == nil {
+		return 0, nil, statusBadSubscriptionIDInvalid
+	}
+	if timestamps > 3 {
+		return 0, nil, statusBadTimestampsToReturnInvalid
+	}
+	if n == 0 {
+		return 0, nil, statusBadNothingToDo
+	}
+
+	e := &encoder{}
+	e.int32(int32(n))
+	for i := 0; i < n && d.err == nil; i++ {
+		itemID := d.uint32()
+		params := decodeMonitoringParameters(d)
+
+		sub.mu.Lock()
+		item, ok := sub.items[itemID]
+		if ok {
+			item.clientHandle = params.clientHandle
+			item.queueSize = params.queueSize
+			item.discardOld = params.discardOld
+			item.timestamps = timestamps
+			if uint32(len(item.queue)) > item.queueSize {
+				item.queue = item.queue[uint32(len(item.queue))-item.queueSize:]
+			}
+		}
+		sub.mu.Unlock()
+
+		if !ok {
+			e.statusCode(statusBadMonitoredItemIDInvalid)
+			e.double(0)
+			e.uint32(0)
+		} else {
+			e.statusCode(statusGood)
+			e.double(0)
+			e.uint32(params.queueSize)
+		}
+		e.nullExtensionObject()
+	}
+	e.emptyArray()
+	return idModifyMonitoredItemsResponse, e.bytes(), statusGood
+}
+
+func (srv *uaServer) handleSetMonitoringMode(ch *secureChannel, s *session, hdr requestHeader, d *decoder) (uint32, []byte, uint32) {
+	sub := s.subscription(d.uint32())
+	mode := d.uint32()
+	ids := d.uint32Array()
+	if sub == nil {
+		return 0, nil, statusBadSubscriptionIDInvalid
+	}
+	if mode > 2 {
+		return 0, nil, statusBadMonitoringModeInvalid
+	}
+	if len(ids) == 0 {
+		return 0, nil, statusBadNothingToDo
+	}
+
+	results := make([]uint32, len(ids))
+	var resumed []*monitoredItem
+	sub.mu.Lock()
+	for i, id := range ids {
+		item, ok := sub.items[id]
+		if !ok {
+			results[i] = statusBadMonitoredItemIDInvalid
+			continue
+		}
+		if mode == 2 && item.mode != 2 {
+			resumed = append(resumed, item)
+		}
+		item.mode = mode
+		if mode == 0 {
+			item.queue = nil
+		}
+	}
+	sub.mu.Unlock()
+
+	// 恢复报告时上报当前值
+	for _, item := range resumed {
+		item.enqueue(srv.space.readAttribute(item.nodeID, item.attributeID))
+	}
+
+	e := &encoder{}
+	e.statusCodeArray(results)
+	e.emptyArray()
+	return idSetMonitoringModeResponse, e.bytes(), statusGood
+}
+
+func (srv *uaServer) handleDeleteMonitoredItems(ch *secureChannel, s *session, hdr requestHeader, d *decoder) (uint32, []byte, uint32) {
+	sub := s.subscription(d.uint32())
+	ids := d.uint32Array()
+	if sub == nil {
+		return 0, nil, statusBadSubscriptionIDInvalid
+	}
+	if len(ids) == 0 {
+		return 0, nil, statusBadNothingToDo
+	}
+
+	results := make([]uint32, len(ids))
+	var removed []*monitoredItem
+	sub.mu.Lock()
+	for i, id := range ids {
+		item, ok := sub.items[id]
+		if !ok {
+			results[i] = statusBadMonitoredItemIDInvalid
+			continue
+		}
+		delete(sub.items, id)
+		removed = append(removed, item)
+	}
+	sub.mu.Unlock()
+
+	for _, item := range removed {
+		srv.unregisterItem(item)
+	}
+
+	e := &encoder{}
+	e.statusCodeArray(results)
+	e.emptyArray()
+	return idDeleteMonitoredItemsResponse, e.bytes(), statusGood
+}
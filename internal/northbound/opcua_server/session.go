@@ -0,0 +1,357 @@
+package opcua_server
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// 发布队列上限
+const (
+	maxPendingPublish = 16
+	maxItemQueue      = 100
+)
+
+// session 客户端会话
+type session struct {
+	srv       *uaServer
+	id        nodeID
+	authToken nodeID
+	name      string
+	timeout   time.Duration
+
+	mu            sync.Mutex
+	channel       *secureChannel
+	activated     bool
+	user          string
+	serverNonce   []byte // 最近下发的服务端Nonce，用于校验客户端签名和解密密码
+	lastSeen      time.Time
+	subscriptions map[uint32]*subscription
+	publishQueue  []publishRequest
+	continuations map[string]continuation
+}
+
+// publishRequest 等待通知的发布请求
+type publishRequest struct {
+	channel   *secureChannel
+	requestID uint32
+	handle    uint32
+	acks      []uint32 // 对应SubscriptionAcknowledgements的结果
+}
+
+func (s *session) touch(ch *secureChannel) {
+	s.mu.Lock()
+	s.lastSeen = time.Now()
+	if ch != nil {
+		s.channel = ch
+	}
+	s.mu.Unlock()
+}
+
+func (s *session) lastActivity() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 有订阅在等待发布请求时也视为活跃
+	return s.lastSeen
+}
+
+func (s *session) subscriptionCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subscriptions)
+}
+
+// queuePublish 保存发布请求，返回false表示队列已满
+func (s *session) queuePublish(pr publishRequest) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.publishQueue) >= maxPendingPublish {
+		return false
+	}
+	s.publishQueue = append(s.publishQueue, pr)
+	return true
+}
+
+// popPublish 取出最早的发布请求
+func (s *session) popPublish() (publishRequest, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.publishQueue) > 0 {
+		pr := s.publishQueue[0]
+		s.publishQueue = s.publishQueue[1:]
+		if !pr.channel.closed.Load() {
+			return pr, true
+		}
+	}
+	return publishRequest{}, false
+}
+
+func (s *session) subscription(id uint32) *subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subscriptions[id]
+}
+
+// close 停止所有订阅
+func (s *session) close() {
+	s.mu.Lock()
+	subs := make([]*subscription, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		subs = append(subs, sub)
+	}
+	s.subscriptions = make(map[uint32]*subscription)
+	s.publishQueue = nil
+	s.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.stop()
+	}
+}
+
+// removeSubscription 删除订阅
+func (s *session) removeSubscription(id uint32) bool {
+	s.mu.Lock()
+	sub, ok := s.subscriptions[id]
+	delete(s.subscriptions, id)
+	s.mu.Unlock()
+
+	if ok {
+		sub.stop()
+	}
+	return ok
+}
+
+// subscription 订阅，按发布周期把监视项通知发送给客户端
+type subscription struct {
+	id      uint32
+	session *session
+
+	mu           sync.Mutex
+	interval     time.Duration
+	lifetime     uint32
+	maxKeepAlive uint32
+	maxNotifs    uint32
+	enabled      bool
+	items        map[uint32]*monitoredItem
+	seq          uint32
+	keepAlive    uint32 // 距上次发送的周期数
+	idle         uint32 // 没有可用发布请求的周期数
+	changed      chan struct{}
+	stopCh       chan struct{}
+	stopOnce     sync.Once
+}
+
+// monitoredItem 监视项
+type monitoredItem struct {
+	id           uint32
+	sub          *subscription
+	nodeID       nodeID
+	attributeID  uint32
+	clientHandle uint32
+	mode         uint32 // 0禁用 1采样 2报告
+	queueSize    uint32
+	discardOld   bool
+	timestamps   uint32
+	queue        []dataValue
+}
+
+// enqueue 加入变化通知，队列满时按discardOldest丢弃
+func (item *monitoredItem) enqueue(dv dataValue) {
+	sub := item.sub
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if item.mode != 2 {
+		return
+	}
+	dv = filterTimestamps(dv, item.timestamps)
+	if len(item.queue) > 0 && uint32(len(item.queue)) >= item.queueSize {
+		if !item.discardOld {
+			item.queue[len(item.queue)-1] = dv
+			return
+		}
+		item.queue = item.queue[1:]
+	}
+	item.queue = append(item.queue, dv)
+}
+
+func newSubscription(s *session, id uint32, interval time.Duration, lifetime, keepAlive, maxNotifs uint32, enabled bool) *subscription {
+	return &subscription{
+		id:           id,
+		session:      s,
+		interval:     interval,
+		lifetime:     lifetime,
+		maxKeepAlive: keepAlive,
+		maxNotifs:    maxNotifs,
+		enabled:      enabled,
+		items:        make(map[uint32]*monitoredItem),
+		changed:      make(chan struct{}, 1),
+		stopCh:       make(chan struct{}),
+	}
+}
+
+func (sub *subscription) stop() {
+	sub.stopOnce.Do(func() {
+		close(sub.stopCh)
+		sub.mu.Lock()
+		items := make([]*monitoredItem, 0, len(sub.items))
+		for _, item := range sub.items {
+			items = append(items, item)
+		}
+		sub.items = make(map[uint32]*monitoredItem)
+		sub.mu.Unlock()
+
+		for _, item := range items {
+			sub.session.srv.unregisterItem(item)
+		}
+	})
+}
+
+// reschedule 通知发布循环参数已修改
+func (sub *subscription) reschedule() {
+	select {
+	case sub.changed <- struct{}{}:
+	default:
+	}
+}
+
+// run 发布循环
+func (sub *subscription) run() {
+	sub.mu.Lock()
+	interval := sub.interval
+	sub.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !sub.tick() {
+				log.Info().Uint32("subscription_id", sub.id).Msg("OPC UA订阅生命周期到期")
+				sub.session.removeSubscription(sub.id)
+				return
+			}
+		case <-sub.changed:
+			sub.mu.Lock()
+			ticker.Reset(sub.interval)
+			sub.mu.Unlock()
+		case <-sub.stopCh:
+			return
+		}
+	}
+}
+
+// tick 每个发布周期执行一次，返回false表示订阅已过期
+func (sub *subscription) tick() bool {
+	sub.mu.Lock()
+	notifications := sub.collectLocked()
+	keepAliveDue := sub.keepAlive+1 >= sub.maxKeepAlive
+	if len(notifications) == 0 && !keepAliveDue {
+		sub.keepAlive++
+		sub.mu.Unlock()
+		return true
+	}
+	sub.mu.Unlock()
+
+	pr, ok := sub.session.popPublish()
+	if !ok {
+		// 没有发布请求，通知放回队列等待下个周期
+		sub.mu.Lock()
+		defer sub.mu.Unlock()
+		sub.requeueLocked(notifications)
+		sub.keepAlive++
+		sub.idle++
+		return sub.lifetime == 0 || sub.idle < sub.lifetime
+	}
+
+	sub.mu.Lock()
+	sub.idle = 0
+	sub.keepAlive = 0
+	more := false
+	if sub.maxNotifs > 0 && uint32(len(notifications)) > sub.maxNotifs {
+		sub.requeueLocked(notifications[sub.maxNotifs:])
+		notifications = notifications[:sub.maxNotifs]
+		more = true
+	}
+	seq := sub.seq + 1
+	if len(notifications) > 0 {
+		sub.seq = seq
+	}
+	sub.mu.Unlock()
+
+	body := encodePublishResponse(pr, sub.id, seq, notifications, more)
+	if err := pr.channel.sendResponse(pr.requestID, idPublishResponse, body); err != nil {
+		log.Debug().Err(err).Uint32("subscription_id", sub.id).Msg("发送OPC UA发布响应失败")
+		if len(notifications) > 0 {
+			sub.mu.Lock()
+			sub.requeueLocked(notifications)
+			sub.mu.Unlock()
+		}
+	}
+	return true
+}
+
+// itemNotification 监视项通知
+type itemNotification struct {
+	itemID       uint32
+	clientHandle uint32
+	value        dataValue
+}
+
+// collectLocked 取出所有监视项中排队的通知
+func (sub *subscription) collectLocked() []itemNotification {
+	if !sub.enabled {
+		return nil
+	}
+	ids := make([]uint32, 0, len(sub.items))
+	for id := range sub.items {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var out []itemNotification
+	for _, id := range ids {
+		item := sub.items[id]
+		for _, dv := range item.queue {
+			out = append(out, itemNotification{itemID: id, clientHandle: item.clientHandle, value: dv})
+		}
+		item.queue = nil
+	}
+	return out
+}
+
+// requeueLocked 把未发送的通知放回对应监视项队列头部
+func (sub *subscription) requeueLocked(notifications []itemNotification) {
+	for i := len(notifications) - 1; i >= 0; i-- {
+		n := notifications[i]
+		if item, ok := sub.items[n.itemID]; ok {
+			item.queue = append([]dataValue{n.value}, item.queue...)
+			if len(item.queue) > maxItemQueue {
+				item.queue = item.queue[:maxItemQueue]
+			}
+		}
+	}
+}
+
+// filterTimestamps 按TimestampsToReturn过滤时间戳: 0源 1服务器 2两者 3都不
+func filterTimestamps(dv dataValue, mode uint32) dataValue {
+	switch mode {
+	case 0:
+		dv.serverTime = time.Time{}
+	case 1:
+		dv.sourceTime = time.Time{}
+		if dv.serverTime.IsZero() {
+			dv.serverTime = time.Now()
+		}
+	case 2:
+		if dv.serverTime.IsZero() {
+			dv.serverTime = time.Now()
+		}
+	case 3:
+		dv.sourceTime, dv.serverTime = time.Time{}, time.Time{}
+	}
+	return dv
+}
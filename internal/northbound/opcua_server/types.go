@@ -0,0 +1,361 @@
+package opcua_server
+
+import (
+	"fmt"
+	"time"
+)
+
+// 内置数据类型ID
+const (
+	typeBoolean         byte = 1
+	typeSByte           byte = 2
+	typeByte            byte = 3
+	typeInt16           byte = 4
+	typeUInt16          byte = 5
+	typeInt32           byte = 6
+	typeUInt32          byte = 7
+	typeInt64           byte = 8
+	typeUInt64          byte = 9
+	typeFloat           byte = 10
+	typeDouble          byte = 11
+	typeString          byte = 12
+	typeDateTime        byte = 13
+	typeGUID            byte = 14
+	typeByteString      byte = 15
+	typeXMLElement      byte = 16
+	typeNodeID          byte = 17
+	typeExpandedNodeID  byte = 18
+	typeStatusCode      byte = 19
+	typeQualifiedName   byte = 20
+	typeLocalizedText   byte = 21
+	typeExtensionObject byte = 22
+	typeDataValue       byte = 23
+	typeVariant         byte = 24
+	typeDiagnosticInfo  byte = 25
+)
+
+// 状态码
+const (
+	statusGood                           uint32 = 0x00000000
+	statusUncertain                      uint32 = 0x40000000
+	statusBad                            uint32 = 0x80000000
+	statusBadUnexpectedError             uint32 = 0x80010000
+	statusBadDecodingError               uint32 = 0x80070000
+	statusBadTimeout                     uint32 = 0x800A0000
+	statusBadServiceUnsupported          uint32 = 0x800B0000
+	statusBadNothingToDo                 uint32 = 0x800F0000
+	statusBadTooManyOperations           uint32 = 0x80100000
+	statusBadSecurityChecksFailed        uint32 = 0x80130000
+	statusBadIdentityTokenInvalid        uint32 = 0x80200000
+	statusBadIdentityTokenRejected       uint32 = 0x80210000
+	statusBadSecureChannelIDInvalid      uint32 = 0x80220000
+	statusBadUserAccessDenied            uint32 = 0x801F0000
+	statusBadSessionIDInvalid            uint32 = 0x80250000
+	statusBadSessionNotActivated         uint32 = 0x80270000
+	statusBadSubscriptionIDInvalid       uint32 = 0x80280000
+	statusBadNodeIDUnknown               uint32 = 0x80340000
+	statusBadAttributeIDInvalid          uint32 = 0x80350000
+	statusBadNotWritable                 uint32 = 0x803B0000
+	statusBadTypeMismatch                uint32 = 0x80740000
+	statusBadMonitoredItemIDInvalid      uint32 = 0x80420000
+	statusBadNoSubscription              uint32 = 0x80790000
+	statusBadMessageNotAvailable         uint32 = 0x807B0000
+	statusBadTooManyPublishRequests      uint32 = 0x80780000
+	statusBadContinuationPointInvalid    uint32 = 0x804A0000
+	statusBadNoMatch                     uint32 = 0x806F0000
+	statusBadSecurityPolicyRejected      uint32 = 0x80550000
+	statusBadTCPMessageTypeInvalid       uint32 = 0x807E0000
+	statusBadCertificateInvalid          uint32 = 0x80120000
+	statusBadCertificateTimeInvalid      uint32 = 0x80140000
+	statusBadCertificateUntrusted        uint32 = 0x801A0000
+	statusBadNonceInvalid                uint32 = 0x80240000
+	statusBadApplicationSignatureInvalid uint32 = 0x80580000
+)
+
+// 节点类别
+const (
+	nodeClassObject     uint32 = 1
+	nodeClassVariable   uint32 = 2
+	nodeClassObjectType uint32 = 8
+	nodeClassVarType    uint32 = 16
+	nodeClassRefType    uint32 = 32
+	nodeClassDataType   uint32 = 64
+)
+
+// 属性ID
+const (
+	attrNodeID                  uint32 = 1
+	attrNodeClass               uint32 = 2
+	attrBrowseName              uint32 = 3
+	attrDisplayName             uint32 = 4
+	attrDescription             uint32 = 5
+	attrWriteMask               uint32 = 6
+	attrUserWriteMask           uint32 = 7
+	attrIsAbstract              uint32 = 8
+	attrSymmetric               uint32 = 9
+	attrInverseName             uint32 = 10
+	attrEventNotifier           uint32 = 12
+	attrValue                   uint32 = 13
+	attrDataType                uint32 = 14
+	attrValueRank               uint32 = 15
+	attrArrayDimensions         uint32 = 16
+	attrAccessLevel             uint32 = 17
+	attrUserAccessLevel         uint32 = 18
+	attrMinimumSamplingInterval uint32 = 19
+	attrHistorizing             uint32 = 20
+)
+
+// 标准节点ID（命名空间0）
+const (
+	idBoolean                 = 1
+	idInt32                   = 6
+	idInt64                   = 8
+	idDouble                  = 11
+	idString                  = 12
+	idDateTime                = 13
+	idLocalizedText           = 21
+	idStructure               = 22
+	idBaseDataType            = 24
+	idReferences              = 31
+	idNonHierarchicalRefs     = 32
+	idHierarchicalRefs        = 33
+	idHasChild                = 34
+	idOrganizes               = 35
+	idHasTypeDefinition       = 40
+	idAggregates              = 44
+	idHasSubtype              = 45
+	idHasProperty             = 46
+	idHasComponent            = 47
+	idBaseObjectType          = 58
+	idFolderType              = 61
+	idBaseVariableType        = 62
+	idBaseDataVariableType    = 63
+	idPropertyType            = 68
+	idRootFolder              = 84
+	idObjectsFolder           = 85
+	idTypesFolder             = 86
+	idViewsFolder             = 87
+	idObjectTypesFolder       = 88
+	idVariableTypesFolder     = 89
+	idDataTypesFolder         = 90
+	idReferenceTypesFolder    = 91
+	idServerState             = 852
+	idServerStatusDataType    = 862
+	idServerStatusType        = 2138
+	idServerType              = 2004
+	idServer                  = 2253
+	idServerArray             = 2254
+	idNamespaceArray          = 2255
+	idServerStatus            = 2256
+	idServerStatusStartTime   = 2257
+	idServerStatusCurrentTime = 2258
+	idServerStatusState       = 2259
+	idServerStatusBuildInfo   = 2260
+	idServiceLevel            = 2267
+	idBuildInfo               = 338
+)
+
+// 服务请求/响应及结构的二进制编码ID
+const (
+	idServiceFault                 = 397
+	idFindServersRequest           = 422
+	idFindServersResponse          = 425
+	idGetEndpointsRequest          = 428
+	idGetEndpointsResponse         = 431
+	idOpenSecureChannelRequest     = 446
+	idOpenSecureChannelResponse    = 449
+	idCloseSecureChannelRequest    = 452
+	idCreateSessionRequest         = 461
+	idCreateSessionResponse        = 464
+	idActivateSessionRequest       = 467
+	idActivateSessionResponse      = 470
+	idCloseSessionRequest          = 473
+	idCloseSessionResponse         = 476
+	idBrowseRequest                = 527
+	idBrowseResponse               = 530
+	idBrowseNextRequest            = 533
+	idBrowseNextResponse           = 536
+	idTranslateBrowsePathsRequest  = 554
+	idTranslateBrowsePathsResponse = 557
+	idRegisterNodesRequest         = 560
+	idRegisterNodesResponse        = 563
+	idUnregisterNodesRequest       = 566
+	idUnregisterNodesResponse      = 569
+	idReadRequest                  = 631
+	idReadResponse                 = 634
+	idWriteRequest                 = 673
+	idWriteResponse                = 676
+	idCreateMonitoredItemsRequest  = 751
+	idCreateMonitoredItemsResponse = 754
+	idModifyMonitoredItemsRequest  = 763
+	idModifyMonitoredItemsResponse = 766
+	idSetMonitoringModeRequest     = 769
+	idSetMonitoringModeResponse    = 772
+	idDeleteMonitoredItemsRequest  = 781
+	idDeleteMonitoredItemsResponse = 784
+	idCreateSubscriptionRequest    = 787
+	idCreateSubscriptionResponse   = 790
+	idModifySubscriptionRequest    = 793
+	idModifySubscriptionResponse   = 796
+	idSetPublishingModeRequest     = 799
+	idSetPublishingModeResponse    = 802
+	idDataChangeNotification       = 811
+	idPublishRequest               = 826
+	idPublishResponse              = 829
+	idRepublishRequest             = 832
+	idRepublishResponse            = 835
+	idDeleteSubscriptionsRequest   = 847
+	idDeleteSubscriptionsResponse  = 850
+	idAnonymousIdentityToken       = 321
+	idUserNameIdentityToken        = 324
+	idServerStatusDataTypeEncoding = 864
+)
+
+// 安全策略URI
+const (
+	securityPolicyNone           = "http://opcfoundation.org/UA/SecurityPolicy#None"
+	securityPolicyBasic256Sha256 = "http://opcfoundation.org/UA/SecurityPolicy#Basic256Sha256"
+	transportProfile             = "http://opcfoundation.org/UA-Profile/Transport/uatcp-uasc-uabinary"
+)
+
+// 消息安全模式
+const (
+	securityModeNone           uint32 = 1
+	securityModeSign           uint32 = 2
+	securityModeSignAndEncrypt uint32 = 3
+)
+
+// nodeID 节点标识，只使用数值和字符串两种形式
+type nodeID struct {
+	ns       uint16
+	num      uint32
+	str      string
+	isString bool
+}
+
+func numericID(ns uint16, num uint32) nodeID { return nodeID{ns: ns, num: num} }
+func stringID(ns uint16, s string) nodeID    { return nodeID{ns: ns, str: s, isString: true} }
+
+func (id nodeID) isNull() bool { return !id.isString && id.ns == 0 && id.num == 0 }
+
+func (id nodeID) String() string {
+	if id.isString {
+		return fmt.Sprintf("ns=%d;s=%s", id.ns, id.str)
+	}
+	return fmt.Sprintf("ns=%d;i=%d", id.ns, id.num)
+}
+
+type qualifiedName struct {
+	ns   uint16
+	name string
+}
+
+type extensionObject struct {
+	typeID uint32
+	body   []byte
+}
+
+// variant 变体值，array为true时value为[]interface{}
+type variant struct {
+	typeID byte
+	array  bool
+	value  interface{}
+}
+
+// dataValue 带状态码和时间戳的值
+type dataValue struct {
+	hasValue   bool
+	value      variant
+	status     uint32
+	sourceTime time.Time
+	serverTime time.Time
+}
+
+// variantOf 将Go值转换为变体
+func variantOf(v interface{}) variant {
+	switch val := v.(type) {
+	case nil:
+		return variant{}
+	case variant:
+		return val
+	case bool:
+		return variant{typeID: typeBoolean, value: val}
+	case int:
+		return variant{typeID: typeInt64, value: int64(val)}
+	case int32:
+		return variant{typeID: typeInt32, value: val}
+	case int64:
+		return variant{typeID: typeInt64, value: val}
+	case uint32:
+		return variant{typeID: typeUInt32, value: val}
+	case float32:
+		return variant{typeID: typeFloat, value: val}
+	case float64:
+		return variant{typeID: typeDouble, value: val}
+	case string:
+		return variant{typeID: typeString, value: val}
+	case time.Time:
+		return variant{typeID: typeDateTime, value: val}
+	case []string:
+		items := make([]interface{}, len(val))
+		for i, s := range val {
+			items[i] = s
+		}
+		return variant{typeID: typeString, array: true, value: items}
+	case []float64:
+		items := make([]interface{}, len(val))
+		for i, f := range val {
+			items[i] = f
+		}
+		return variant{typeID: typeDouble, array: true, value: items}
+	default:
+		return variant{typeID: typeString, value: fmt.Sprint(val)}
+	}
+}
+
+// dataTypeOf 变体对应的DataType节点ID
+func dataTypeOf(v variant) nodeID {
+	switch v.typeID {
+	case 0:
+		return numericID(0, idBaseDataType)
+	case typeLocalizedText:
+		return numericID(0, idLocalizedText)
+	case typeExtensionObject:
+		return numericID(0, idStructure)
+	default:
+		// 内置类型的DataType节点ID与类型ID相同
+		return numericID(0, uint32(v.typeID))
+	}
+}
+
+// goValue 将变体转换为Go值，用于写入命令
+func goValue(v variant) interface{} {
+	if v.array {
+		items := v.value.([]interface{})
+		out := make([]interface{}, len(items))
+		for i, item := range items {
+			out[i] = goValue(variant{typeID: v.typeID, value: item})
+		}
+		return out
+	}
+	switch val := v.value.(type) {
+	case int8:
+		return int64(val)
+	case byte:
+		return int64(val)
+	case int16:
+		return int64(val)
+	case uint16:
+		return int64(val)
+	case int32:
+		return int64(val)
+	case uint32:
+		return int64(val)
+	case uint64:
+		return float64(val)
+	case float32:
+		return float64(val)
+	default:
+		return val
+	}
+}
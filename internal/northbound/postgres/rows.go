@@ -0,0 +1,273 @@
+package postgres
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/model"
+	"github.com/y001j/iot-gateway/internal/northbound"
+	"github.com/y001j/iot-gateway/internal/utils"
+)
+
+// rowKey 一批数据内的去重键，重复的行会让ON CONFLICT DO UPDATE报错
+type rowKey struct {
+	deviceID string
+	key      string
+	ts       int64
+}
+
+// rowSet 写入同一张表的行
+type rowSet struct {
+	table *tableSpec
+	index map[rowKey]int
+	rows  [][]interface{}
+}
+
+func newRowSet(t *tableSpec) *rowSet {
+	return &rowSet{table: t, index: make(map[rowKey]int)}
+}
+
+// wideTarget 宽表配置与对应的表结构
+type wideTarget struct {
+	config  *WideTableConfig
+	table   *tableSpec
+	columns map[string]int // 数据点key -> 列下标
+}
+
+// pointTime 数据点时间截断到微秒（PostgreSQL的精度），保证批内去重与主键一致
+func pointTime(point *model.Point) time.Time {
+	if point.Timestamp.IsZero() {
+		return time.Now().Truncate(time.Microsecond)
+	}
+	return point.Timestamp.Truncate(time.Microsecond)
+}
+
+// matchWide 查找设备和数据点对应的宽表，未配置的数据写入窄表
+func (s *PostgresSink) matchWide(point *model.Point) (*wideTarget, int) {
+	for _, w := range s.wide {
+		col, ok := w.columns[point.Key]
+		if !ok {
+			continue
+		}
+		for _, pattern := range w.config.Devices {
+			if utils.MatchGlob(pattern, point.DeviceID) {
+				return w, col
+			}
+		}
+	}
+	return nil, 0
+}
+
+// buildRows 按目标表分组，批内同一主键只保留最后一个值（宽表按列合并）
+func (s *PostgresSink) buildRows(batch []model.Point) []*rowSet {
+	sets := make(map[*tableSpec]*rowSet)
+	var order []*rowSet
+	get := func(t *tableSpec) *rowSet {
+		set, ok := sets[t]
+		if !ok {
+			set = newRowSet(t)
+			sets[t] = set
+			order = append(order, set)
+		}
+		return set
+	}
+
+	for i := range batch {
+		point := &batch[i]
+		if w, col := s.matchWide(point); w != nil {
+			s.addWideRow(get(w.table), w, col, point)
+			continue
+		}
+		s.addNarrowRow(get(s.narrow), point)
+	}
+	return order
+}
+
+func (s *PostgresSink) addNarrowRow(set *rowSet, point *model.Point) {
+	ts := pointTime(point)
+	row := make([]interface{}, len(set.table.columns))
+	row[0] = ts
+	row[1] = point.DeviceID
+	row[2] = point.Key
+	row[6] = int32(point.Quality)
+	row[7] = tagsJSON(point)
+
+	if point.IsComposite() {
+		if data, ok := compositeJSON(point); ok {
+			row[5] = data
+		}
+		if s.config.CompositeStorage == "postgis" && point.Type == model.TypeLocation {
+			if wkt, ok := locationEWKT(point); ok {
+				row[8] = wkt
+			}
+		}
+	} else {
+		switch v := point.Value.(type) {
+		case nil:
+		case string:
+			row[4] = v
+		case []byte:
+			row[4] = base64.StdEncoding.EncodeToString(v)
+		default:
+			if f, ok := northbound.ToFloat64(v); ok {
+				row[3] = f
+			} else if data, err := json.Marshal(v); err == nil {
+				row[5] = json.RawMessage(data)
+			}
+		}
+	}
+
+	key := rowKey{deviceID: point.DeviceID, key: point.Key, ts: ts.UnixNano()}
+	if idx, ok := set.index[key]; ok {
+		set.rows[idx] = row
+		return
+	}
+	set.index[key] = len(set.rows)
+	set.rows = append(set.rows, row)
+}
+
+func (s *PostgresSink) addWideRow(set *rowSet, w *wideTarget, col int, point *model.Point) {
+	ts := pointTime(point)
+	if w.config.AlignMs > 0 {
+		ts = ts.Truncate(time.Duration(w.config.AlignMs) * time.Millisecond)
+	}
+
+	key := rowKey{deviceID: point.DeviceID, ts: ts.UnixNano()}
+	idx, ok := set.index[key]
+	if !ok {
+		row := make([]interface{}, len(set.table.columns))
+		row[0] = ts
+		row[1] = point.DeviceID
+		row[2] = int32(0)
+		set.index[key] = len(set.rows)
+		set.rows = append(set.rows, row)
+		idx = len(set.rows) - 1
+	}
+	row := set.rows[idx]
+
+	// 合并同一行的质量码（取最差）和标签
+	if q := int32(point.Quality); q > row[2].(int32) {
+		row[2] = q
+	}
+	if tags := point.GetTagsCopy(); len(tags) > 0 {
+		merged := make(map[string]string)
+		if prev, ok := row[3].(json.RawMessage); ok {
+			json.Unmarshal(prev, &merged)
+		}
+		for k, v := range tags {
+			merged[k] = v
+		}
+		data, _ := json.Marshal(merged)
+		row[3] = json.RawMessage(data)
+	}
+
+	colCfg := w.config.Columns[col]
+	value, err := wideValue(colCfg.Type, point)
+	if err != nil {
+		log.Debug().
+			Err(err).
+			Str("name", s.Name()).
+			Str("device_id", point.DeviceID).
+			Str("key", point.Key).
+			Str("column", colCfg.Column).
+			Msg("数据点无法转换为宽表列类型，已跳过")
+		return
+	}
+	row[4+col] = value
+}
+
+// wideValue 将数据点转换为宽表列的值
+func wideValue(colType string, point *model.Point) (interface{}, error) {
+	switch colType {
+	case "double":
+		if f, ok := northbound.ToFloat64(point.Value); ok {
+			return f, nil
+		}
+	case "bigint":
+		if f, ok := northbound.ToFloat64(point.Value); ok {
+			return int64(f), nil
+		}
+	case "boolean":
+		if b, ok := point.Value.(bool); ok {
+			return b, nil
+		}
+		if f, ok := northbound.ToFloat64(point.Value); ok {
+			return f != 0, nil
+		}
+	case "text":
+		switch v := point.Value.(type) {
+		case string:
+			return v, nil
+		case nil:
+			return nil, nil
+		}
+		if point.IsComposite() {
+			if data, ok := compositeJSON(point); ok {
+				return string(data), nil
+			}
+		}
+		return fmt.Sprint(point.Value), nil
+	case "jsonb":
+		if point.IsComposite() {
+			if data, ok := compositeJSON(point); ok {
+				return data, nil
+			}
+		}
+		data, err := json.Marshal(point.Value)
+		if err != nil {
+			return nil, err
+		}
+		return json.RawMessage(data), nil
+	case "geography":
+		if wkt, ok := locationEWKT(point); ok {
+			return wkt, nil
+		}
+	}
+	return nil, fmt.Errorf("无法将 %s 类型的值转换为 %s", point.Type, colType)
+}
+
+func tagsJSON(point *model.Point) interface{} {
+	tags := point.GetTagsCopy()
+	if len(tags) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(tags)
+	if err != nil {
+		return nil
+	}
+	return json.RawMessage(data)
+}
+
+// compositeJSON 复合数据统一解码为结构体后再编码，保证JSONB字段名一致
+func compositeJSON(point *model.Point) (json.RawMessage, bool) {
+	composite, err := model.DecodeCompositeValue(point.Type, point.Value)
+	if err != nil {
+		return nil, false
+	}
+	data, err := json.Marshal(composite)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// locationEWKT 将GPS数据转换为PostGIS可直接转换为geography的EWKT文本
+func locationEWKT(point *model.Point) (string, bool) {
+	if point.Type != model.TypeLocation {
+		return "", false
+	}
+	composite, err := model.DecodeCompositeValue(point.Type, point.Value)
+	if err != nil {
+		return "", false
+	}
+	loc, ok := composite.(*model.LocationData)
+	if !ok || loc.Validate() != nil {
+		return "", false
+	}
+	return "SRID=4326;POINT(" + strconv.FormatFloat(loc.Longitude, 'f', -1, 64) + " " +
+		strconv.FormatFloat(loc.Latitude, 'f', -1, 64) + ")", true
+}
@@ -0,0 +1,419 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// errSchemaIncompatible 数据库中的schema版本高于网关支持的版本，或未开启自动迁移时需要迁移
+var errSchemaIncompatible = errors.New("数据库schema版本不兼容")
+
+// migrationLockID 迁移使用的全局advisory锁，避免多个网关实例同时建表
+const migrationLockID int64 = 0x696f742d6777 // "iot-gw"
+
+// migration 一个schema版本，语句在同一事务中执行
+type migration struct {
+	version     int
+	description string
+	statements  func(t *tableSpec) []string
+}
+
+// narrowMigrations 窄表的版本历史，只能追加，不能修改已发布的版本
+var narrowMigrations = []migration{
+	{
+		version:     1,
+		description: "创建窄表",
+		statements: func(t *tableSpec) []string {
+			return []string{
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	ts timestamptz NOT NULL,
+	device_id text NOT NULL,
+	key text NOT NULL,
+	value_double double precision,
+	value_text text,
+	value_json jsonb,
+	quality integer NOT NULL DEFAULT 0,
+	tags jsonb,
+	PRIMARY KEY (device_id, key, ts)
+)`, t.qualified()),
+				fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (key, ts DESC)`,
+					pgx.Identifier{t.name + "_key_ts_idx"}.Sanitize(), t.qualified()),
+			}
+		},
+	},
+}
+
+// wideMigrations 宽表的版本历史，数据列由配置决定，在ensureColumns中补齐
+var wideMigrations = []migration{
+	{
+		version:     1,
+		description: "创建宽表",
+		statements: func(t *tableSpec) []string {
+			return []string{
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	ts timestamptz NOT NULL,
+	device_id text NOT NULL,
+	quality integer NOT NULL DEFAULT 0,
+	tags jsonb,
+	PRIMARY KEY (device_id, ts)
+)`, t.qualified()),
+			}
+		},
+	},
+}
+
+// columnSpec 表的数据列
+type columnSpec struct {
+	name    string // 列名
+	sqlType string // 目标表中的类型
+	stage   string // 暂存表中的类型，COPY使用
+	cast    string // 从暂存表插入时的类型转换
+}
+
+// tableSpec 一张目标表的结构
+type tableSpec struct {
+	schema     string
+	name       string
+	wide       bool
+	conflict   []string     // 冲突判定列
+	columns    []columnSpec // 全部写入列，包含基础列
+	extra      []columnSpec // 由配置决定、需要补齐的列
+	migrations []migration
+}
+
+func (t *tableSpec) qualified() string {
+	return pgx.Identifier{t.schema, t.name}.Sanitize()
+}
+
+func (t *tableSpec) scope() string {
+	return t.schema + "." + t.name
+}
+
+func (t *tableSpec) columnNames() []string {
+	names := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		names[i] = c.name
+	}
+	return names
+}
+
+// wideColumnTypes 宽表列类型: 目标类型、暂存类型、插入转换
+var wideColumnTypes = map[string]columnSpec{
+	"double":    {sqlType: "double precision", stage: "double precision"},
+	"bigint":    {sqlType: "bigint", stage: "bigint"},
+	"boolean":   {sqlType: "boolean", stage: "boolean"},
+	"text":      {sqlType: "text", stage: "text"},
+	"jsonb":     {sqlType: "jsonb", stage: "jsonb"},
+	"geography": {sqlType: "geography(Point, 4326)", stage: "text", cast: "::geography"},
+}
+
+// narrowSpec 窄表结构，PostGIS模式额外写入geog列
+func narrowSpec(schema, table string, postgis bool) *tableSpec {
+	t := &tableSpec{
+		schema:   schema,
+		name:     table,
+		conflict: []string{"device_id", "key", "ts"},
+		columns: []columnSpec{
+			{name: "ts", sqlType: "timestamptz", stage: "timestamptz"},
+			{name: "device_id", sqlType: "text", stage: "text"},
+			{name: "key", sqlType: "text", stage: "text"},
+			{name: "value_double", sqlType: "double precision", stage: "double precision"},
+			{name: "value_text", sqlType: "text", stage: "text"},
+			{name: "value_json", sqlType: "jsonb", stage: "jsonb"},
+			{name: "quality", sqlType: "integer", stage: "integer"},
+			{name: "tags", sqlType: "jsonb", stage: "jsonb"},
+		},
+		migrations: narrowMigrations,
+	}
+	if postgis {
+		geog := wideColumnTypes["geography"]
+		geog.name = "geog"
+		t.columns = append(t.columns, geog)
+		t.extra = append(t.extra, geog)
+	}
+	return t
+}
+
+// wideSpec 宽表结构
+func wideSpec(schema string, cfg *WideTableConfig) *tableSpec {
+	t := &tableSpec{
+		schema:   schema,
+		name:     cfg.Table,
+		wide:     true,
+		conflict: []string{"device_id", "ts"},
+		columns: []columnSpec{
+			{name: "ts", sqlType: "timestamptz", stage: "timestamptz"},
+			{name: "device_id", sqlType: "text", stage: "text"},
+			{name: "quality", sqlType: "integer", stage: "integer"},
+			{name: "tags", sqlType: "jsonb", stage: "jsonb"},
+		},
+		migrations: wideMigrations,
+	}
+	for _, col := range cfg.Columns {
+		spec := wideColumnTypes[col.Type]
+		spec.name = col.Column
+		t.columns = append(t.columns, spec)
+		t.extra = append(t.extra, spec)
+	}
+	return t
+}
+
+// stageDDL 暂存表，每个连接一张，提交时清空
+func (t *tableSpec) stageDDL(stage string) string {
+	cols := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		cols[i] = pgx.Identifier{c.name}.Sanitize() + " " + c.stage
+	}
+	return fmt.Sprintf("CREATE TEMP TABLE IF NOT EXISTS %s (%s) ON COMMIT DELETE ROWS",
+		pgx.Identifier{stage}.Sanitize(), strings.Join(cols, ", "))
+}
+
+// insertSQL 从暂存表写入目标表
+// update: 窄表覆盖同一时刻的值；宽表合并列，新值为NULL时保留旧值
+// ignore: 保留已有数据
+// error: 冲突时整批失败
+func (t *tableSpec) insertSQL(stage, onConflict string) string {
+	names := make([]string, len(t.columns))
+	selects := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		names[i] = pgx.Identifier{c.name}.Sanitize()
+		selects[i] = names[i] + c.cast
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "INSERT INTO %s AS t (%s) SELECT %s FROM %s",
+		t.qualified(), strings.Join(names, ", "), strings.Join(selects, ", "), pgx.Identifier{stage}.Sanitize())
+
+	conflict := make([]string, len(t.conflict))
+	for i, c := range t.conflict {
+		conflict[i] = pgx.Identifier{c}.Sanitize()
+	}
+	switch onConflict {
+	case "ignore":
+		fmt.Fprintf(&b, " ON CONFLICT (%s) DO NOTHING", strings.Join(conflict, ", "))
+	case "update":
+		var sets []string
+		for i, c := range t.columns {
+			if contains(t.conflict, c.name) {
+				continue
+			}
+			col := names[i]
+			switch {
+			case !t.wide:
+				sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", col, col))
+			case c.name == "quality":
+				sets = append(sets, "quality = GREATEST(t.quality, EXCLUDED.quality)")
+			case c.name == "tags":
+				sets = append(sets, "tags = COALESCE(t.tags, '{}'::jsonb) || COALESCE(EXCLUDED.tags, '{}'::jsonb)")
+			default:
+				sets = append(sets, fmt.Sprintf("%s = COALESCE(EXCLUDED.%s, t.%s)", col, col, col))
+			}
+		}
+		fmt.Fprintf(&b, " ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(conflict, ", "), strings.Join(sets, ", "))
+	}
+	return b.String()
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// setupSchema 创建schema、执行迁移并补齐配置列，最后按需转换为hypertable
+func (s *PostgresSink) setupSchema(ctx context.Context) error {
+	pool := s.pool
+	cfg := &s.config
+
+	if cfg.CreateExtensions {
+		if cfg.Timescale.Enabled {
+			if _, err := pool.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS timescaledb"); err != nil {
+				return fmt.Errorf("创建timescaledb扩展失败: %w", err)
+			}
+		}
+		if s.usesPostGIS() {
+			if _, err := pool.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS postgis"); err != nil {
+				return fmt.Errorf("创建postgis扩展失败: %w", err)
+			}
+		}
+	}
+	if cfg.Timescale.Enabled {
+		if err := requireExtension(ctx, pool, "timescaledb"); err != nil {
+			return err
+		}
+	}
+	if s.usesPostGIS() {
+		if err := requireExtension(ctx, pool, "postgis"); err != nil {
+			return err
+		}
+	}
+
+	if _, err := pool.Exec(ctx, fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", pgx.Identifier{cfg.Schema}.Sanitize())); err != nil {
+		return fmt.Errorf("创建schema失败: %w", err)
+	}
+
+	for _, t := range s.tables {
+		if err := s.migrate(ctx, t); err != nil {
+			return err
+		}
+		if err := ensureColumns(ctx, pool, t); err != nil {
+			return err
+		}
+		if cfg.Timescale.Enabled {
+			if err := s.ensureHypertable(ctx, t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func requireExtension(ctx context.Context, pool *pgxpool.Pool, name string) error {
+	var exists bool
+	err := pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = $1)", name).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("检查%s扩展失败: %w", name, err)
+	}
+	if !exists {
+		return fmt.Errorf("数据库未安装%s扩展，请手动创建或开启create_extensions", name)
+	}
+	return nil
+}
+
+// migrate 在事务中执行目标表未应用的迁移，并记录到版本表
+func (s *PostgresSink) migrate(ctx context.Context, t *tableSpec) error {
+	versions := pgx.Identifier{s.config.Schema, s.config.MigrationsTable}.Sanitize()
+	latest := t.migrations[len(t.migrations)-1].version
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("开始迁移事务失败: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("获取迁移锁失败: %w", err)
+	}
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	scope text NOT NULL,
+	version integer NOT NULL,
+	description text NOT NULL,
+	applied_at timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY (scope, version)
+)`, versions)); err != nil {
+		return fmt.Errorf("创建版本表失败: %w", err)
+	}
+
+	var current int
+	if err := tx.QueryRow(ctx, fmt.Sprintf("SELECT COALESCE(MAX(version), 0) FROM %s WHERE scope = $1", versions), t.scope()).Scan(&current); err != nil {
+		return fmt.Errorf("读取schema版本失败: %w", err)
+	}
+	if current > latest {
+		return fmt.Errorf("%w: 表 %s 的版本为 %d，当前网关最高支持 %d，请升级网关", errSchemaIncompatible, t.scope(), current, latest)
+	}
+	if current == latest {
+		return nil
+	}
+	if !s.autoMigrate() {
+		return fmt.Errorf("%w: 表 %s 的版本为 %d，需要迁移到 %d，请开启auto_migrate或手动迁移", errSchemaIncompatible, t.scope(), current, latest)
+	}
+
+	for _, m := range t.migrations {
+		if m.version <= current {
+			continue
+		}
+		for _, stmt := range m.statements(t) {
+			if _, err := tx.Exec(ctx, stmt); err != nil {
+				return fmt.Errorf("执行迁移 %s v%d 失败: %w", t.scope(), m.version, err)
+			}
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf("INSERT INTO %s (scope, version, description) VALUES ($1, $2, $3)", versions),
+			t.scope(), m.version, m.description); err != nil {
+			return fmt.Errorf("记录迁移版本失败: %w", err)
+		}
+		log.Info().
+			Str("name", s.Name()).
+			Str("table", t.scope()).
+			Int("version", m.version).
+			Str("description", m.description).
+			Msg("PostgreSQL schema迁移完成")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("提交迁移失败: %w", err)
+	}
+	return nil
+}
+
+// ensureColumns 补齐配置中新增的列，已有列不做修改
+func ensureColumns(ctx context.Context, pool *pgxpool.Pool, t *tableSpec) error {
+	for _, c := range t.extra {
+		stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s",
+			t.qualified(), pgx.Identifier{c.name}.Sanitize(), c.sqlType)
+		if _, err := pool.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("为表 %s 添加列 %s 失败: %w", t.scope(), c.name, err)
+		}
+		if strings.HasPrefix(c.sqlType, "geography") {
+			stmt = fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING GIST (%s)",
+				pgx.Identifier{t.name + "_" + c.name + "_idx"}.Sanitize(), t.qualified(), pgx.Identifier{c.name}.Sanitize())
+			if _, err := pool.Exec(ctx, stmt); err != nil {
+				return fmt.Errorf("为表 %s 创建空间索引失败: %w", t.scope(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// ensureHypertable 转换为hypertable并配置压缩和保留策略，可重复执行
+func (s *PostgresSink) ensureHypertable(ctx context.Context, t *tableSpec) error {
+	ts := s.config.Timescale
+	pool := s.pool
+	relation := t.qualified()
+
+	if _, err := pool.Exec(ctx,
+		"SELECT create_hypertable($1::regclass, 'ts', chunk_time_interval => $2::interval, if_not_exists => TRUE, migrate_data => TRUE)",
+		relation, ts.ChunkInterval); err != nil {
+		return fmt.Errorf("创建hypertable %s 失败: %w", t.scope(), err)
+	}
+
+	if ts.CompressAfter != "" {
+		var enabled bool
+		err := pool.QueryRow(ctx,
+			"SELECT compression_enabled FROM timescaledb_information.hypertables WHERE hypertable_schema = $1 AND hypertable_name = $2",
+			t.schema, t.name).Scan(&enabled)
+		if err != nil {
+			return fmt.Errorf("读取hypertable %s 压缩状态失败: %w", t.scope(), err)
+		}
+		if !enabled {
+			segmentBy := "device_id"
+			if !t.wide {
+				segmentBy = "device_id, key"
+			}
+			stmt := fmt.Sprintf("ALTER TABLE %s SET (timescaledb.compress, timescaledb.compress_segmentby = '%s')", relation, segmentBy)
+			if _, err := pool.Exec(ctx, stmt); err != nil {
+				return fmt.Errorf("开启hypertable %s 压缩失败: %w", t.scope(), err)
+			}
+		}
+		if _, err := pool.Exec(ctx, "SELECT add_compression_policy($1::regclass, $2::interval, if_not_exists => TRUE)",
+			relation, ts.CompressAfter); err != nil {
+			return fmt.Errorf("添加压缩策略失败: %w", err)
+		}
+	}
+
+	if ts.Retention != "" {
+		if _, err := pool.Exec(ctx, "SELECT add_retention_policy($1::regclass, $2::interval, if_not_exists => TRUE)",
+			relation, ts.Retention); err != nil {
+			return fmt.Errorf("添加保留策略失败: %w", err)
+		}
+	}
+	return nil
+}
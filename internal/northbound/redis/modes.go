@@ -0,0 +1,293 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/codec"
+	"github.com/y001j/iot-gateway/internal/model"
+	"github.com/y001j/iot-gateway/internal/northbound"
+)
+
+// 写入模式
+const (
+	modeKV         = "kv"
+	modeStream     = "stream"
+	modeTimeSeries = "timeseries"
+	modePubSub     = "pubsub"
+)
+
+// StreamConfig Redis Streams模式配置，每个数据点XADD一条消息，可供消费组读取
+type StreamConfig struct {
+	KeyTemplate string `json:"key_template"` // 流的键模板，支持 {device_id} {key} {type} {tag:名称}，默认 iot:stream:{device_id}
+	MaxLen      int64  `json:"max_len"`      // 按长度裁剪（MAXLEN），默认100000，0表示不按长度裁剪
+	MaxAge      string `json:"max_age"`      // 按时间裁剪（MINID），如 24h，与max_len同时配置时max_len优先
+	ExactTrim   bool   `json:"exact_trim"`   // 精确裁剪，默认使用 ~ 近似裁剪以降低开销
+}
+
+// TimeSeriesConfig RedisTimeSeries模式配置，每个数值TS.ADD到一个序列
+type TimeSeriesConfig struct {
+	KeyTemplate     string            `json:"key_template"`     // 序列键模板，默认 ts:{device_id}:{key}，复合数据的{key}为 key.字段
+	Retention       string            `json:"retention"`        // 序列保留时长，如 168h，仅在序列创建时生效
+	DuplicatePolicy string            `json:"duplicate_policy"` // 时间戳重复时的处理: last（默认）first min max sum block
+	Labels          map[string]string `json:"labels"`           // 附加的静态标签
+	TagLabels       bool              `json:"tag_labels"`       // 是否将数据点标签作为序列标签，默认true
+}
+
+// PubSubConfig 发布订阅模式配置，每个数据点PUBLISH一条JSON消息
+type PubSubConfig struct {
+	ChannelTemplate string `json:"channel_template"` // 频道模板，默认 iot:{device_id}:{key}
+}
+
+// initMode 校验写入模式配置
+func (s *RedisSink) initMode(cfg *RedisConfig) error {
+	if cfg.Mode == "" {
+		cfg.Mode = modeKV
+	}
+	switch cfg.Mode {
+	case modeKV:
+	case modeStream:
+		if cfg.Stream.KeyTemplate == "" {
+			return fmt.Errorf("stream模式需要配置stream.key_template")
+		}
+		if cfg.Stream.MaxAge != "" {
+			d, err := time.ParseDuration(cfg.Stream.MaxAge)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("无效的stream.max_age: %s", cfg.Stream.MaxAge)
+			}
+			s.streamMaxAge = d
+		}
+	case modeTimeSeries:
+		if cfg.TimeSeries.KeyTemplate == "" {
+			return fmt.Errorf("timeseries模式需要配置timeseries.key_template")
+		}
+		if cfg.TimeSeries.Retention != "" {
+			d, err := time.ParseDuration(cfg.TimeSeries.Retention)
+			if err != nil || d < 0 {
+				return fmt.Errorf("无效的timeseries.retention: %s", cfg.TimeSeries.Retention)
+			}
+			s.tsRetention = d.Milliseconds()
+		}
+		switch strings.ToLower(cfg.TimeSeries.DuplicatePolicy) {
+		case "", "last", "first", "min", "max", "sum", "block":
+		default:
+			return fmt.Errorf("不支持的duplicate_policy: %s", cfg.TimeSeries.DuplicatePolicy)
+		}
+	case modePubSub:
+		if cfg.PubSub.ChannelTemplate == "" {
+			return fmt.Errorf("pubsub模式需要配置pubsub.channel_template")
+		}
+	default:
+		return fmt.Errorf("不支持的Redis写入模式: %s，可选 kv stream timeseries pubsub", cfg.Mode)
+	}
+	return nil
+}
+
+func pointTimestamp(point *model.Point) time.Time {
+	if point.Timestamp.IsZero() {
+		return time.Now()
+	}
+	return point.Timestamp
+}
+
+// valueString 消息中的值，复合数据为JSON
+func (s *RedisSink) valueString(point *model.Point) string {
+	if point.IsComposite() {
+		if composite, err := model.DecodeCompositeValue(point.Type, point.Value); err == nil {
+			if data, err := json.Marshal(composite); err == nil {
+				return string(data)
+			}
+		}
+	}
+	return fmt.Sprintf("%v", s.convertValue(*point))
+}
+
+// queueStream 将数据点作为一条流消息加入pipeline
+func (s *RedisSink) queueStream(ctx context.Context, pipe redis.Pipeliner, point *model.Point) (int, error) {
+	cfg := &s.config.Stream
+	values := []interface{}{
+		"device_id", point.DeviceID,
+		"key", point.Key,
+		"type", string(point.Type),
+		"value", s.valueString(point),
+		"quality", point.Quality,
+		"timestamp", pointTimestamp(point).UnixMilli(),
+	}
+	if tags := point.GetTagsCopy(); len(tags) > 0 {
+		data, err := json.Marshal(tags)
+		if err != nil {
+			return 0, err
+		}
+		values = append(values, "tags", string(data))
+	}
+
+	args := &redis.XAddArgs{
+		Stream: northbound.FormatPointTemplate(cfg.KeyTemplate, point),
+		ID:     "*",
+		Values: values,
+		Approx: !cfg.ExactTrim,
+	}
+	if cfg.MaxLen > 0 {
+		args.MaxLen = cfg.MaxLen
+	} else if s.streamMaxAge > 0 {
+		args.MinID = strconv.FormatInt(time.Now().Add(-s.streamMaxAge).UnixMilli(), 10)
+	}
+	pipe.XAdd(ctx, args)
+	return 1, nil
+}
+
+// queueTimeSeries 将数值加入pipeline，复合数据的每个数值字段写入单独的序列，字符串被跳过
+func (s *RedisSink) queueTimeSeries(ctx context.Context, pipe redis.Pipeliner, point *model.Point) int {
+	ts := pointTimestamp(point).UnixMilli()
+	tags := point.GetTagsCopy()
+
+	if fields, ok := northbound.FlattenComposite(point); ok {
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		n := 0
+		for _, name := range names {
+			v, ok := tsValue(fields[name])
+			if !ok {
+				continue
+			}
+			series := *point
+			series.Key = point.Key + "." + name
+			key := northbound.FormatPointTemplate(s.config.TimeSeries.KeyTemplate, &series)
+			s.queueTSAdd(ctx, pipe, key, ts, v, point, name, tags)
+			n++
+		}
+		return n
+	}
+
+	v, ok := tsValue(point.Value)
+	if !ok {
+		log.Debug().Str("name", s.Name()).Str("device_id", point.DeviceID).Str("key", point.Key).Msg("非数值数据点，跳过TS.ADD")
+		return 0
+	}
+	key := northbound.FormatPointTemplate(s.config.TimeSeries.KeyTemplate, point)
+	s.queueTSAdd(ctx, pipe, key, ts, v, point, "", tags)
+	return 1
+}
+
+// tsValue 转换为时序数值，布尔值为0/1
+func tsValue(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case bool:
+		if val {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		return 0, false
+	}
+	return northbound.ToFloat64(v)
+}
+
+// queueTSAdd 组装TS.ADD命令，RETENTION和LABELS仅在序列首次创建时生效，ON_DUPLICATE对每次写入生效
+func (s *RedisSink) queueTSAdd(ctx context.Context, pipe redis.Pipeliner, key string, ts int64, v float64, point *model.Point, field string, tags map[string]string) {
+	cfg := &s.config.TimeSeries
+	args := []interface{}{"TS.ADD", key, ts, v}
+	if s.tsRetention > 0 {
+		args = append(args, "RETENTION", s.tsRetention)
+	}
+	if cfg.DuplicatePolicy != "" {
+		args = append(args, "ON_DUPLICATE", strings.ToUpper(cfg.DuplicatePolicy))
+	}
+
+	labels := map[string]string{
+		"device_id": point.DeviceID,
+		"key":       point.Key,
+		"type":      string(point.Type),
+	}
+	if field != "" {
+		labels["field"] = field
+	}
+	if cfg.TagLabels {
+		for k, val := range tags {
+			if _, exists := labels[k]; !exists && val != "" {
+				labels[k] = val
+			}
+		}
+	}
+	for k, val := range cfg.Labels {
+		labels[k] = val
+	}
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	args = append(args, "LABELS")
+	for _, k := range names {
+		args = append(args, k, labels[k])
+	}
+	pipe.Do(ctx, args...)
+}
+
+// queuePubSub 将数据点作为JSON消息发布到频道，配置了二进制encoding时按对应编码发布
+func (s *RedisSink) queuePubSub(ctx context.Context, pipe redis.Pipeliner, point *model.Point) (int, error) {
+	channel := northbound.FormatPointTemplate(s.config.PubSub.ChannelTemplate, point)
+	if c := s.Codec(); c.Name() != codec.JSON {
+		data, err := c.Marshal(point)
+		if err != nil {
+			return 0, err
+		}
+		pipe.Publish(ctx, channel, data)
+		return 1, nil
+	}
+
+	value := s.convertValue(*point)
+	if point.IsComposite() {
+		if composite, err := model.DecodeCompositeValue(point.Type, point.Value); err == nil {
+			value = composite
+		}
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"key":       point.Key,
+		"device_id": point.DeviceID,
+		"value":     value,
+		"type":      string(point.Type),
+		"quality":   point.Quality,
+		"timestamp": pointTimestamp(point).UnixMilli(),
+		"tags":      point.GetTagsCopy(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	pipe.Publish(ctx, channel, data)
+	return 1, nil
+}
+
+// execPipeline 发送pipeline，单条命令失败不影响其他命令，错误中包含失败数量和第一个错误
+func (s *RedisSink) execPipeline(ctx context.Context, pipe redis.Pipeliner) error {
+	cmds, err := pipe.Exec(ctx)
+	if err == nil {
+		return nil
+	}
+	failed := 0
+	var firstErr error
+	for _, cmd := range cmds {
+		if cmdErr := cmd.Err(); cmdErr != nil && cmdErr != redis.Nil {
+			failed++
+			if firstErr == nil {
+				firstErr = cmdErr
+			}
+		}
+	}
+	if firstErr == nil {
+		// 连接错误等，所有命令都未执行
+		return fmt.Errorf("Redis pipeline执行失败: %w", err)
+	}
+	return fmt.Errorf("Redis pipeline中 %d/%d 条命令失败: %w", failed, len(cmds), firstErr)
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"strings"
 	"sync"
 	"time"
 
@@ -32,8 +31,11 @@ func NewRedisSink() *RedisSink {
 type RedisSink struct {
 	*northbound.BaseSink
 	client        *redis.Client
+	config        RedisConfig
 	pointsConfig  map[string]PointConfig
 	defaultExpiry time.Duration
+	streamMaxAge  time.Duration
+	tsRetention   int64 // 毫秒
 	ctx           context.Context
 	cancel        context.CancelFunc
 	wg            sync.WaitGroup
@@ -42,7 +44,7 @@ type RedisSink struct {
 // PointConfig 定义了数据点的Redis配置
 type PointConfig struct {
 	KeyPrefix  string            `json:"key_prefix"`  // Redis键前缀
-	KeyFormat  string            `json:"key_format"`  // Redis键格式，支持 {device_id} 和 {key} 占位符
+	KeyFormat  string            `json:"key_format"`  // Redis键格式，支持 {device_id} {key} {type} {tag:名称} 占位符
 	Expiry     int               `json:"expiry_sec"`  // 过期时间（秒）
 	Format     string            `json:"format"`      // 存储格式: json, string, hash
 	HashFields []string          `json:"hash_fields"` // 用于hash格式的字段列表
@@ -56,6 +58,10 @@ type RedisConfig struct {
 	Database      int                    `json:"database"`     // Redis数据库
 	DefaultExpiry int                    `json:"default_expiry_sec"` // 默认过期时间（秒）
 	Points        map[string]PointConfig `json:"points"`       // 数据点配置
+	Mode          string                 `json:"mode"`         // kv stream timeseries pubsub，默认kv（按points配置写入最新值）
+	Stream        StreamConfig           `json:"stream"`       // stream模式配置
+	TimeSeries    TimeSeriesConfig       `json:"timeseries"`   // timeseries模式配置
+	PubSub        PubSubConfig           `json:"pubsub"`       // pubsub模式配置
 }
 
 // Init 初始化连接器
@@ -67,11 +73,29 @@ func (s *RedisSink) Init(cfg json.RawMessage) error {
 	}
 
 	// 解析Redis特定参数
-	var redisConfig RedisConfig
+	redisConfig := RedisConfig{
+		Mode: modeKV,
+		Stream: StreamConfig{
+			KeyTemplate: "iot:stream:{device_id}",
+			MaxLen:      100000,
+		},
+		TimeSeries: TimeSeriesConfig{
+			KeyTemplate:     "ts:{device_id}:{key}",
+			DuplicatePolicy: "last",
+			TagLabels:       true,
+		},
+		PubSub: PubSubConfig{
+			ChannelTemplate: "iot:{device_id}:{key}",
+		},
+	}
 	if err := json.Unmarshal(standardConfig.Params, &redisConfig); err != nil {
 		return fmt.Errorf("解析Redis特定参数失败: %w", err)
 	}
+	if err := s.initMode(&redisConfig); err != nil {
+		return err
+	}
 
+	s.config = redisConfig
 	s.pointsConfig = redisConfig.Points
 	
 	// 设置默认过期时间
@@ -98,6 +122,7 @@ func (s *RedisSink) Init(cfg json.RawMessage) error {
 		Str("name", s.Name()).
 		Str("address", redisConfig.Address).
 		Int("database", redisConfig.Database).
+		Str("mode", redisConfig.Mode).
 		Int("points_config", len(s.pointsConfig)).
 		Int("batch_size", s.GetBatchSize()).
 		Int("buffer_size", s.GetBufferSize()).
@@ -147,69 +172,95 @@ func (s *RedisSink) Publish(batch []model.Point) error {
 		// 使用基础方法添加标签
 		s.AddTags(batch)
 
-		// 创建上下文
+		// 整批命令通过pipeline在一次往返中发送
 		ctx := context.Background()
+		pipe := s.client.Pipeline()
 
-		// 处理每个数据点
-		for _, point := range batch {
-			// 查找数据点配置
-			config, found := s.pointsConfig[point.Key]
-			if !found {
-				// 如果没有特定配置，使用默认值
-				config = PointConfig{
-					KeyFormat: "{device_id}:{key}",
-					Format:    "json",
-				}
-			}
-
-			// 确定Redis键
-			redisKey := s.formatKey(config, point)
-
-			// 确定过期时间
-			var expiry time.Duration
-			if config.Expiry > 0 {
-				expiry = time.Duration(config.Expiry) * time.Second
-			} else {
-				expiry = s.defaultExpiry
-			}
-
-			// 根据配置的格式存储数据
-			format := config.Format
-			if format == "" {
-				format = "json"
-			}
-
+		queued := 0
+		for i := range batch {
+			point := &batch[i]
+			var n int
 			var err error
-			switch format {
-			case "json":
-				err = s.storeAsJSON(ctx, redisKey, point, expiry)
-			case "string":
-				err = s.storeAsString(ctx, redisKey, point, expiry)
-			case "hash":
-				err = s.storeAsHash(ctx, redisKey, point, config.HashFields, expiry)
+			switch s.config.Mode {
+			case modeStream:
+				n, err = s.queueStream(ctx, pipe, point)
+			case modeTimeSeries:
+				n = s.queueTimeSeries(ctx, pipe, point)
+			case modePubSub:
+				n, err = s.queuePubSub(ctx, pipe, point)
 			default:
-				err = fmt.Errorf("不支持的存储格式: %s", format)
+				n, err = s.queueKV(ctx, pipe, point)
 			}
-
 			if err != nil {
+				pipe.Discard()
 				return fmt.Errorf("存储数据点到Redis失败: %w", err)
 			}
-
-			log.Debug().
-				Str("name", s.Name()).
-				Str("key", point.Key).
-				Str("device_id", point.DeviceID).
-				Interface("value", point.Value).
-				Str("type", string(point.Type)).
-				Str("redis_key", redisKey).
-				Str("format", format).
-				Msg("发布数据点到Redis")
+			queued += n
+		}
+		if queued == 0 {
+			return nil
 		}
 
-		return nil
+		return s.execPipeline(ctx, pipe)
 	}, publishStart)
 }
 
+// queueKV 按数据点配置写入最新值
+func (s *RedisSink) queueKV(ctx context.Context, pipe redis.Pipeliner, point *model.Point) (int, error) {
+	// 查找数据点配置
+	config, found := s.pointsConfig[point.Key]
+	if !found {
+		// 如果没有特定配置，使用默认值
+		config = PointConfig{
+			KeyFormat: "{device_id}:{key}",
+			Format:    "json",
+		}
+	}
+
+	// 确定Redis键
+	redisKey := s.formatKey(config, *point)
+
+	// 确定过期时间
+	var expiry time.Duration
+	if config.Expiry > 0 {
+		expiry = time.Duration(config.Expiry) * time.Second
+	} else {
+		expiry = s.defaultExpiry
+	}
+
+	// 根据配置的格式存储数据
+	format := config.Format
+	if format == "" {
+		format = "json"
+	}
+
+	var err error
+	switch format {
+	case "json":
+		err = s.storeAsJSON(ctx, pipe, redisKey, *point, expiry)
+	case "string":
+		err = s.storeAsString(ctx, pipe, redisKey, *point, expiry)
+	case "hash":
+		err = s.storeAsHash(ctx, pipe, redisKey, *point, config.HashFields, expiry)
+	default:
+		err = fmt.Errorf("不支持的存储格式: %s", format)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	log.Debug().
+		Str("name", s.Name()).
+		Str("key", point.Key).
+		Str("device_id", point.DeviceID).
+		Interface("value", point.Value).
+		Str("type", string(point.Type)).
+		Str("redis_key", redisKey).
+		Str("format", format).
+		Msg("发布数据点到Redis")
+	return 1, nil
+}
+
 // formatKey 格式化Redis键
 func (s *RedisSink) formatKey(config PointConfig, point model.Point) string {
 	keyFormat := config.KeyFormat
@@ -218,9 +269,7 @@ func (s *RedisSink) formatKey(config PointConfig, point model.Point) string {
 	}
 
 	// 替换占位符
-	key := keyFormat
-	key = strings.ReplaceAll(key, "{device_id}", point.DeviceID)
-	key = strings.ReplaceAll(key, "{key}", point.Key)
+	key := northbound.FormatPointTemplate(keyFormat, &point)
 
 	// 添加前缀
 	if config.KeyPrefix != "" {
@@ -231,7 +280,7 @@ func (s *RedisSink) formatKey(config PointConfig, point model.Point) string {
 }
 
 // storeAsJSON 将数据点作为JSON存储
-func (s *RedisSink) storeAsJSON(ctx context.Context, key string, point model.Point, expiry time.Duration) error {
+func (s *RedisSink) storeAsJSON(ctx context.Context, c redis.Cmdable, key string, point model.Point, expiry time.Duration) error {
 	// 创建安全的Tags副本 - 使用GetTagsCopy()
 	safeTags := point.GetTagsCopy()
 
@@ -253,25 +302,25 @@ func (s *RedisSink) storeAsJSON(ctx context.Context, key string, point model.Poi
 
 	// 存储到Redis
 	if expiry > 0 {
-		return s.client.Set(ctx, key, jsonData, expiry).Err()
+		return c.Set(ctx, key, jsonData, expiry).Err()
 	}
-	return s.client.Set(ctx, key, jsonData, 0).Err()
+	return c.Set(ctx, key, jsonData, 0).Err()
 }
 
 // storeAsString 将数据点作为字符串存储
-func (s *RedisSink) storeAsString(ctx context.Context, key string, point model.Point, expiry time.Duration) error {
+func (s *RedisSink) storeAsString(ctx context.Context, c redis.Cmdable, key string, point model.Point, expiry time.Duration) error {
 	// 将值转换为字符串
 	value := fmt.Sprintf("%v", s.convertValue(point))
 
 	// 存储到Redis
 	if expiry > 0 {
-		return s.client.Set(ctx, key, value, expiry).Err()
+		return c.Set(ctx, key, value, expiry).Err()
 	}
-	return s.client.Set(ctx, key, value, 0).Err()
+	return c.Set(ctx, key, value, 0).Err()
 }
 
 // storeAsHash 将数据点作为哈希表存储
-func (s *RedisSink) storeAsHash(ctx context.Context, key string, point model.Point, fields []string, expiry time.Duration) error {
+func (s *RedisSink) storeAsHash(ctx context.Context, c redis.Cmdable, key string, point model.Point, fields []string, expiry time.Duration) error {
 	// 创建哈希表字段
 	hash := map[string]interface{}{
 		"value":     s.convertValue(point),
@@ -300,13 +349,13 @@ func (s *RedisSink) storeAsHash(ctx context.Context, key string, point model.Poi
 	}
 
 	// 存储到Redis
-	if err := s.client.HSet(ctx, key, hash).Err(); err != nil {
+	if err := c.HSet(ctx, key, hash).Err(); err != nil {
 		return err
 	}
 
 	// 设置过期时间（如果指定）
 	if expiry > 0 {
-		return s.client.Expire(ctx, key, expiry).Err()
+		return c.Expire(ctx, key, expiry).Err()
 	}
 
 	return nil
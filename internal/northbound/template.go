@@ -0,0 +1,51 @@
+package northbound
+
+import (
+	"strings"
+
+	"github.com/y001j/iot-gateway/internal/model"
+)
+
+// FormatPointTemplate 使用数据点填充模板
+// 支持 {device_id}、{key}、{type} 以及 {tag:名称}，缺失的标签替换为空字符串
+func FormatPointTemplate(tpl string, point *model.Point) string {
+	if !strings.Contains(tpl, "{") {
+		return tpl
+	}
+
+	var b strings.Builder
+	b.Grow(len(tpl) + 32)
+	for {
+		start := strings.IndexByte(tpl, '{')
+		if start < 0 {
+			b.WriteString(tpl)
+			break
+		}
+		end := strings.IndexByte(tpl[start:], '}')
+		if end < 0 {
+			b.WriteString(tpl)
+			break
+		}
+		end += start
+
+		b.WriteString(tpl[:start])
+		name := tpl[start+1 : end]
+		switch {
+		case name == "device_id":
+			b.WriteString(point.DeviceID)
+		case name == "key":
+			b.WriteString(point.Key)
+		case name == "type":
+			b.WriteString(string(point.Type))
+		case strings.HasPrefix(name, "tag:"):
+			if v, ok := point.GetTag(name[4:]); ok {
+				b.WriteString(v)
+			}
+		default:
+			// 未知占位符原样保留
+			b.WriteString(tpl[start : end+1])
+		}
+		tpl = tpl[end+1:]
+	}
+	return b.String()
+}
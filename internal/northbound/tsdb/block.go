@@ -0,0 +1,251 @@
+package tsdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	blockMagic   = "IOTTSDB1"
+	blockVersion = 1
+	blockExt     = ".blk"
+)
+
+// seriesMeta 序列的标识和最新标签
+type seriesMeta struct {
+	DeviceID string            `json:"device_id"`
+	Key      string            `json:"key"`
+	Tags     map[string]string `json:"tags,omitempty"`
+}
+
+func seriesID(deviceID, key string) string {
+	return deviceID + "\x00" + key
+}
+
+// blockSeries 块内的单个序列
+type blockSeries struct {
+	meta  *seriesMeta
+	chunk *chunkEncoder
+}
+
+// block 一个时间窗口内所有序列的数据，[start, end) 毫秒
+type block struct {
+	start   int64
+	end     int64
+	columns int
+	series  map[string]*blockSeries
+	dirty   bool // 上次写盘后有新数据
+}
+
+func newBlock(start, end int64, columns int) *block {
+	return &block{start: start, end: end, columns: columns, series: make(map[string]*blockSeries)}
+}
+
+// append 追加一行，时间戳不大于该序列最后一行时返回false
+func (b *block) append(meta *seriesMeta, t int64, values []float64) bool {
+	id := seriesID(meta.DeviceID, meta.Key)
+	s, ok := b.series[id]
+	if !ok {
+		s = &blockSeries{meta: meta, chunk: newChunkEncoder(b.columns)}
+		b.series[id] = s
+	}
+	s.meta = meta
+	if last, ok := s.chunk.lastTime(); ok && t <= last {
+		return false
+	}
+	s.chunk.append(t, values)
+	b.dirty = true
+	return true
+}
+
+// blockFile 磁盘上已封存的块
+type blockFile struct {
+	start int64
+	end   int64
+	path  string
+}
+
+func blockFileName(start, end int64) string {
+	return strconv.FormatInt(start, 10) + "-" + strconv.FormatInt(end, 10) + blockExt
+}
+
+// listBlockFiles 列出目录中的块文件，按起始时间排序
+func listBlockFiles(dir string) ([]blockFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var files []blockFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, blockExt) {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimSuffix(name, blockExt), "-", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		start, err1 := strconv.ParseInt(parts[0], 10, 64)
+		end, err2 := strconv.ParseInt(parts[1], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		files = append(files, blockFile{start: start, end: end, path: filepath.Join(dir, name)})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].start < files[j].start })
+	return files, nil
+}
+
+// encode 块文件格式:
+//
+//	magic(8) version(1) columns(1) start(8) end(8) 序列数(uvarint)
+//	每个序列: 元数据长度(uvarint) 元数据JSON 数据长度(uvarint) Gorilla数据
+//	crc32(4)
+func (b *block) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(blockMagic)
+	buf.WriteByte(blockVersion)
+	buf.WriteByte(byte(b.columns))
+	var tmp [binary.MaxVarintLen64]byte
+	binary.BigEndian.PutUint64(tmp[:8], uint64(b.start))
+	buf.Write(tmp[:8])
+	binary.BigEndian.PutUint64(tmp[:8], uint64(b.end))
+	buf.Write(tmp[:8])
+
+	ids := make([]string, 0, len(b.series))
+	for id := range b.series {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	buf.Write(tmp[:binary.PutUvarint(tmp[:], uint64(len(ids)))])
+	for _, id := range ids {
+		s := b.series[id]
+		meta, err := json.Marshal(s.meta)
+		if err != nil {
+			return nil, err
+		}
+		data := s.chunk.bytes()
+		buf.Write(tmp[:binary.PutUvarint(tmp[:], uint64(len(meta)))])
+		buf.Write(meta)
+		buf.Write(tmp[:binary.PutUvarint(tmp[:], uint64(len(data)))])
+		buf.Write(data)
+	}
+	binary.BigEndian.PutUint32(tmp[:4], crc32.ChecksumIEEE(buf.Bytes()))
+	buf.Write(tmp[:4])
+	return buf.Bytes(), nil
+}
+
+// writeBlockFile 原子写入块文件，返回文件路径
+func writeBlockFile(dir string, start, end int64, data []byte) (string, error) {
+	path := filepath.Join(dir, blockFileName(start, end))
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp, path)
+}
+
+// blockReader 顺序读取块文件中的序列
+type blockReader struct {
+	columns int
+	start   int64
+	end     int64
+	r       *bufio.Reader
+	left    uint64
+}
+
+func readBlockFile(path string) (*blockReader, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < len(blockMagic)+2+16+4 || string(data[:len(blockMagic)]) != blockMagic {
+		return nil, fmt.Errorf("%s: 不是有效的块文件", path)
+	}
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[len(data)-4:]) {
+		return nil, fmt.Errorf("%s: 校验失败", path)
+	}
+	if body[len(blockMagic)] != blockVersion {
+		return nil, fmt.Errorf("%s: 不支持的块版本 %d", path, body[len(blockMagic)])
+	}
+
+	pos := len(blockMagic) + 1
+	br := &blockReader{columns: int(body[pos])}
+	pos++
+	br.start = int64(binary.BigEndian.Uint64(body[pos:]))
+	br.end = int64(binary.BigEndian.Uint64(body[pos+8:]))
+	br.r = bufio.NewReader(bytes.NewReader(body[pos+16:]))
+	if br.left, err = binary.ReadUvarint(br.r); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, errChunkCorrupted)
+	}
+	return br, nil
+}
+
+// next 读取下一个序列的元数据和压缩数据，读完时返回io.EOF
+func (br *blockReader) next() (*seriesMeta, []byte, error) {
+	if br.left == 0 {
+		return nil, nil, io.EOF
+	}
+	br.left--
+	metaLen, err := binary.ReadUvarint(br.r)
+	if err != nil {
+		return nil, nil, errChunkCorrupted
+	}
+	metaData := make([]byte, metaLen)
+	if _, err := io.ReadFull(br.r, metaData); err != nil {
+		return nil, nil, errChunkCorrupted
+	}
+	var meta seriesMeta
+	if err := json.Unmarshal(metaData, &meta); err != nil {
+		return nil, nil, errChunkCorrupted
+	}
+	dataLen, err := binary.ReadUvarint(br.r)
+	if err != nil {
+		return nil, nil, errChunkCorrupted
+	}
+	data := make([]byte, dataLen)
+	if _, err := io.ReadFull(br.r, data); err != nil {
+		return nil, nil, errChunkCorrupted
+	}
+	return &meta, data, nil
+}
+
+// loadBlock 读取块文件并恢复为可追加的内存块
+func loadBlock(path string) (*block, error) {
+	br, err := readBlockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := newBlock(br.start, br.end, br.columns)
+	for {
+		meta, data, err := br.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := decodeChunk(data, br.columns, func(t int64, values []float64) bool {
+			b.append(meta, t, values)
+			return true
+		}); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	b.dirty = false
+	return b, nil
+}
@@ -0,0 +1,317 @@
+package tsdb
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+)
+
+var errChunkCorrupted = errors.New("数据块已损坏")
+
+// bitWriter 按位写入
+type bitWriter struct {
+	buf   []byte
+	count uint8 // 最后一个字节剩余可写的位数
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.count == 0 {
+		w.buf = append(w.buf, 0)
+		w.count = 8
+	}
+	if bit {
+		w.buf[len(w.buf)-1] |= 1 << (w.count - 1)
+	}
+	w.count--
+}
+
+// writeBits 写入u的低nbits位，高位在前
+func (w *bitWriter) writeBits(u uint64, nbits int) {
+	u <<= 64 - uint(nbits)
+	for nbits >= 8 {
+		b := byte(u >> 56)
+		if w.count == 0 {
+			w.buf = append(w.buf, b)
+		} else {
+			w.buf[len(w.buf)-1] |= b >> (8 - w.count)
+			w.buf = append(w.buf, b<<w.count)
+		}
+		u <<= 8
+		nbits -= 8
+	}
+	for nbits > 0 {
+		w.writeBit(u>>63 == 1)
+		u <<= 1
+		nbits--
+	}
+}
+
+// bitReader 按位读取
+type bitReader struct {
+	buf []byte
+	pos int // 已读取的位数
+}
+
+func (r *bitReader) readBit() (bool, error) {
+	if r.pos >= len(r.buf)*8 {
+		return false, errChunkCorrupted
+	}
+	bit := r.buf[r.pos/8]&(0x80>>(r.pos%8)) != 0
+	r.pos++
+	return bit, nil
+}
+
+func (r *bitReader) readBits(nbits int) (uint64, error) {
+	if r.pos+nbits > len(r.buf)*8 {
+		return 0, errChunkCorrupted
+	}
+	var u uint64
+	for nbits > 0 {
+		// 按字节对齐时整字节读取
+		if r.pos%8 == 0 && nbits >= 8 {
+			u = u<<8 | uint64(r.buf[r.pos/8])
+			r.pos += 8
+			nbits -= 8
+			continue
+		}
+		bit, _ := r.readBit()
+		u <<= 1
+		if bit {
+			u |= 1
+		}
+		nbits--
+	}
+	return u, nil
+}
+
+// xorState 单列浮点值的XOR压缩状态
+type xorState struct {
+	prev     uint64
+	leading  uint8
+	trailing uint8
+}
+
+// chunkEncoder Gorilla压缩的数据块，每行一个毫秒时间戳和固定列数的float64值
+// 时间戳使用delta-of-delta编码，值按列使用XOR编码
+type chunkEncoder struct {
+	w       bitWriter
+	columns int
+	count   int
+	t       int64
+	tDelta  int64
+	values  []xorState
+}
+
+func newChunkEncoder(columns int) *chunkEncoder {
+	return &chunkEncoder{columns: columns, values: make([]xorState, columns)}
+}
+
+// lastTime 最后一行的时间戳
+func (e *chunkEncoder) lastTime() (int64, bool) {
+	return e.t, e.count > 0
+}
+
+// append 追加一行，调用方保证时间戳严格递增
+func (e *chunkEncoder) append(t int64, values []float64) {
+	switch e.count {
+	case 0:
+		e.w.writeBits(uint64(t), 64)
+		for i, v := range values {
+			u := math.Float64bits(v)
+			e.w.writeBits(u, 64)
+			e.values[i] = xorState{prev: u, leading: 0xff}
+		}
+	default:
+		delta := t - e.t
+		writeDoD(&e.w, delta-e.tDelta)
+		e.tDelta = delta
+		for i, v := range values {
+			writeXOR(&e.w, &e.values[i], math.Float64bits(v))
+		}
+	}
+	e.t = t
+	e.count++
+}
+
+// bytes 返回块数据的副本，格式为行数(4字节) + 位流
+func (e *chunkEncoder) bytes() []byte {
+	out := make([]byte, 4+len(e.w.buf))
+	out[0] = byte(e.count >> 24)
+	out[1] = byte(e.count >> 16)
+	out[2] = byte(e.count >> 8)
+	out[3] = byte(e.count)
+	copy(out[4:], e.w.buf)
+	return out
+}
+
+func writeDoD(w *bitWriter, dod int64) {
+	switch {
+	case dod == 0:
+		w.writeBit(false)
+	case -8191 <= dod && dod <= 8192:
+		w.writeBits(0b10, 2)
+		w.writeBits(uint64(dod), 14)
+	case -65535 <= dod && dod <= 65536:
+		w.writeBits(0b110, 3)
+		w.writeBits(uint64(dod), 17)
+	case -524287 <= dod && dod <= 524288:
+		w.writeBits(0b1110, 4)
+		w.writeBits(uint64(dod), 20)
+	default:
+		w.writeBits(0b1111, 4)
+		w.writeBits(uint64(dod), 64)
+	}
+}
+
+func writeXOR(w *bitWriter, st *xorState, u uint64) {
+	xor := u ^ st.prev
+	st.prev = u
+	if xor == 0 {
+		w.writeBit(false)
+		return
+	}
+	w.writeBit(true)
+
+	leading := uint8(bits.LeadingZeros64(xor))
+	trailing := uint8(bits.TrailingZeros64(xor))
+	if leading >= 32 {
+		leading = 31 // 前导零用5位存储
+	}
+
+	// 有效位落在上一个窗口内时复用窗口
+	if st.leading != 0xff && leading >= st.leading && trailing >= st.trailing {
+		w.writeBit(false)
+		w.writeBits(xor>>st.trailing, 64-int(st.leading)-int(st.trailing))
+		return
+	}
+
+	st.leading, st.trailing = leading, trailing
+	w.writeBit(true)
+	w.writeBits(uint64(leading), 5)
+	sigbits := 64 - leading - trailing
+	// 64个有效位存储为0
+	w.writeBits(uint64(sigbits), 6)
+	w.writeBits(xor>>trailing, int(sigbits))
+}
+
+// decodeChunk 解码数据块，对每一行调用fn，fn返回false时停止
+func decodeChunk(data []byte, columns int, fn func(t int64, values []float64) bool) error {
+	if len(data) < 4 {
+		return errChunkCorrupted
+	}
+	count := int(data[0])<<24 | int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+	r := &bitReader{buf: data[4:]}
+	values := make([]float64, columns)
+	states := make([]xorState, columns)
+
+	var t, tDelta int64
+	for row := 0; row < count; row++ {
+		if row == 0 {
+			u, err := r.readBits(64)
+			if err != nil {
+				return err
+			}
+			t = int64(u)
+			for i := range states {
+				u, err := r.readBits(64)
+				if err != nil {
+					return err
+				}
+				states[i] = xorState{prev: u, leading: 0xff}
+			}
+		} else {
+			dod, err := readDoD(r)
+			if err != nil {
+				return err
+			}
+			tDelta += dod
+			t += tDelta
+			for i := range states {
+				if err := readXOR(r, &states[i]); err != nil {
+					return err
+				}
+			}
+		}
+		for i := range states {
+			values[i] = math.Float64frombits(states[i].prev)
+		}
+		if !fn(t, values) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func readDoD(r *bitReader) (int64, error) {
+	var prefix int
+	for prefix < 4 {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if !bit {
+			break
+		}
+		prefix++
+	}
+	var nbits int
+	switch prefix {
+	case 0:
+		return 0, nil
+	case 1:
+		nbits = 14
+	case 2:
+		nbits = 17
+	case 3:
+		nbits = 20
+	default:
+		nbits = 64
+	}
+	u, err := r.readBits(nbits)
+	if err != nil {
+		return 0, err
+	}
+	if nbits == 64 {
+		return int64(u), nil
+	}
+	// 符号扩展
+	if u > 1<<(nbits-1) {
+		return int64(u) - 1<<nbits, nil
+	}
+	return int64(u), nil
+}
+
+func readXOR(r *bitReader, st *xorState) error {
+	bit, err := r.readBit()
+	if err != nil || !bit {
+		return err
+	}
+	newWindow, err := r.readBit()
+	if err != nil {
+		return err
+	}
+	if newWindow {
+		leading, err := r.readBits(5)
+		if err != nil {
+			return err
+		}
+		sigbits, err := r.readBits(6)
+		if err != nil {
+			return err
+		}
+		if sigbits == 0 {
+			sigbits = 64
+		}
+		st.leading = uint8(leading)
+		st.trailing = uint8(64 - leading - sigbits)
+	} else if st.leading == 0xff {
+		return errChunkCorrupted
+	}
+	sigbits := 64 - int(st.leading) - int(st.trailing)
+	u, err := r.readBits(sigbits)
+	if err != nil {
+		return err
+	}
+	st.prev ^= u << st.trailing
+	return nil
+}
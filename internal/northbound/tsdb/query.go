@@ -0,0 +1,392 @@
+package tsdb
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/utils"
+)
+
+// DefaultMaxPoints 单个序列默认最多返回的点数
+const DefaultMaxPoints = 11000
+
+// Selector 序列选择器，配置的条件需要同时满足
+type Selector struct {
+	Devices []string          `json:"devices,omitempty"` // 设备ID通配符，满足任意一个
+	Keys    []string          `json:"keys,omitempty"`    // 数据点key通配符，满足任意一个
+	Tags    map[string]string `json:"tags,omitempty"`    // 标签名 -> 值通配符
+}
+
+func (sel *Selector) matches(meta *seriesMeta) bool {
+	if len(sel.Devices) > 0 && !matchAny(sel.Devices, meta.DeviceID) {
+		return false
+	}
+	if len(sel.Keys) > 0 && !matchAny(sel.Keys, meta.Key) {
+		return false
+	}
+	for name, pattern := range sel.Tags {
+		value, ok := meta.Tags[name]
+		if !ok || !utils.MatchGlob(pattern, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if utils.MatchGlob(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Query 查询条件，时间范围为 [Start, End)
+type Query struct {
+	Selector
+	Start       time.Time
+	End         time.Time
+	Step        time.Duration // 为0时返回存储的原始点（降采样精度下每个窗口一个点）
+	Aggregation string        // avg min max sum count last，默认avg
+	Resolution  string        // auto（默认）、raw 或降采样名称如 1m、1h
+	MaxPoints   int           // 单个序列最多返回的点数
+}
+
+// Sample 查询结果中的一个点，时间为毫秒时间戳
+type Sample struct {
+	T int64   `json:"t"`
+	V float64 `json:"v"`
+}
+
+// SeriesResult 单个序列的查询结果
+type SeriesResult struct {
+	DeviceID string            `json:"device_id"`
+	Key      string            `json:"key"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Points   []Sample          `json:"points"`
+}
+
+// QueryResult 查询结果
+type QueryResult struct {
+	Resolution  string         `json:"resolution"`
+	StepMs      int64          `json:"step_ms"`
+	Aggregation string         `json:"aggregation"`
+	Series      []SeriesResult `json:"series"`
+}
+
+// SeriesInfo 序列信息
+type SeriesInfo struct {
+	DeviceID string            `json:"device_id"`
+	Key      string            `json:"key"`
+	Tags     map[string]string `json:"tags,omitempty"`
+}
+
+// aggState 聚合状态，原始点和降采样行统一按 min/max/sum/count/last 合并
+type aggState struct {
+	min   float64
+	max   float64
+	sum   float64
+	count float64
+	last  float64
+}
+
+func (a *aggState) merge(row []float64, columns int) {
+	if columns == 1 {
+		a.mergeRow(row[0], row[0], row[0], 1, row[0])
+		return
+	}
+	a.mergeRow(row[colMin], row[colMax], row[colSum], row[colCount], row[colLast])
+}
+
+func (a *aggState) mergeRow(min, max, sum, count, last float64) {
+	if a.count == 0 || min < a.min {
+		a.min = min
+	}
+	if a.count == 0 || max > a.max {
+		a.max = max
+	}
+	a.sum += sum
+	a.count += count
+	a.last = last
+}
+
+func (a *aggState) value(agg string) float64 {
+	switch agg {
+	case "min":
+		return a.min
+	case "max":
+		return a.max
+	case "sum":
+		return a.sum
+	case "count":
+		return a.count
+	case "last":
+		return a.last
+	default:
+		return a.sum / a.count
+	}
+}
+
+// seriesAgg 单个序列的查询中间结果
+type seriesAgg struct {
+	meta    *seriesMeta
+	buckets map[int64]*aggState
+	samples []Sample
+}
+
+// querySource 一个块的待解码数据
+type querySource struct {
+	start  int64
+	path   string            // 磁盘上的块
+	chunks map[string][]byte // 内存中的块，序列ID -> 数据
+	metas  map[string]*seriesMeta
+}
+
+// Query 执行查询
+func (s *Store) Query(q *Query) (*QueryResult, error) {
+	if !q.End.After(q.Start) {
+		return nil, fmt.Errorf("结束时间必须晚于开始时间")
+	}
+	if q.Step < 0 {
+		return nil, fmt.Errorf("step不能为负数")
+	}
+	if q.Aggregation == "" {
+		q.Aggregation = "avg"
+	}
+	switch q.Aggregation {
+	case "avg", "min", "max", "sum", "count", "last":
+	default:
+		return nil, fmt.Errorf("不支持的聚合方式: %s", q.Aggregation)
+	}
+	if q.MaxPoints <= 0 {
+		q.MaxPoints = DefaultMaxPoints
+	}
+	start, end, step := q.Start.UnixMilli(), q.End.UnixMilli(), q.Step.Milliseconds()
+
+	s.mu.RLock()
+	r, err := s.chooseResolution(q)
+	if err != nil {
+		s.mu.RUnlock()
+		return nil, err
+	}
+
+	// 在锁内复制内存块和未结束的降采样窗口，文件在锁外读取
+	var sources []querySource
+	for blockStart, b := range r.open {
+		if b.end <= start || b.start >= end {
+			continue
+		}
+		src := querySource{start: blockStart, chunks: make(map[string][]byte), metas: make(map[string]*seriesMeta)}
+		for id, bs := range b.series {
+			if q.matches(bs.meta) {
+				src.chunks[id] = bs.chunk.bytes()
+				src.metas[id] = bs.meta
+			}
+		}
+		sources = append(sources, src)
+	}
+	for blockStart, f := range r.files {
+		if _, open := r.open[blockStart]; open || f.end <= start || f.start >= end {
+			continue
+		}
+		sources = append(sources, querySource{start: blockStart, path: f.path})
+	}
+	type accRow struct {
+		id   string
+		meta *seriesMeta
+		t    int64
+		row  []float64
+	}
+	var pendingRows []accRow
+	for id, acc := range r.accs {
+		if acc.start >= start && acc.start < end && q.matches(acc.meta) {
+			pendingRows = append(pendingRows, accRow{id: id, meta: acc.meta, t: acc.start, row: acc.row()})
+		}
+	}
+	current := make(map[string]*seriesMeta, len(s.series))
+	for id, meta := range s.series {
+		current[id] = meta
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(sources, func(i, j int) bool { return sources[i].start < sources[j].start })
+
+	results := make(map[string]*seriesAgg)
+	add := func(id string, meta *seriesMeta, t int64, row []float64) error {
+		if t < start || t >= end {
+			return nil
+		}
+		sa, ok := results[id]
+		if !ok {
+			sa = &seriesAgg{meta: meta, buckets: make(map[int64]*aggState)}
+			results[id] = sa
+		}
+		if step == 0 {
+			if len(sa.samples) >= q.MaxPoints {
+				return fmt.Errorf("序列 %s/%s 的点数超过 %d，请设置更大的step", meta.DeviceID, meta.Key, q.MaxPoints)
+			}
+			if r.columns == 1 {
+				sa.samples = append(sa.samples, Sample{T: t, V: row[0]})
+			} else {
+				var st aggState
+				st.merge(row, r.columns)
+				sa.samples = append(sa.samples, Sample{T: t, V: st.value(q.Aggregation)})
+			}
+			return nil
+		}
+		bucket := t - mod(t, step)
+		st, ok := sa.buckets[bucket]
+		if !ok {
+			if len(sa.buckets) >= q.MaxPoints {
+				return fmt.Errorf("序列 %s/%s 的点数超过 %d，请设置更大的step", meta.DeviceID, meta.Key, q.MaxPoints)
+			}
+			st = &aggState{}
+			sa.buckets[bucket] = st
+		}
+		st.merge(row, r.columns)
+		return nil
+	}
+
+	for _, src := range sources {
+		if src.path == "" {
+			for id, data := range src.chunks {
+				meta := src.metas[id]
+				var addErr error
+				if err := decodeChunk(data, r.columns, func(t int64, row []float64) bool {
+					addErr = add(id, meta, t, row)
+					return addErr == nil
+				}); err != nil {
+					return nil, err
+				}
+				if addErr != nil {
+					return nil, addErr
+				}
+			}
+			continue
+		}
+
+		br, err := readBlockFile(src.path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// 查询期间被保留策略删除
+				continue
+			}
+			log.Warn().Err(err).Str("path", src.path).Msg("读取块文件失败，跳过")
+			continue
+		}
+		for {
+			meta, data, err := br.next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				log.Warn().Err(err).Str("path", src.path).Msg("块文件损坏，跳过剩余序列")
+				break
+			}
+			if !q.matches(meta) {
+				continue
+			}
+			id := seriesID(meta.DeviceID, meta.Key)
+			var addErr error
+			if err := decodeChunk(data, r.columns, func(t int64, row []float64) bool {
+				addErr = add(id, meta, t, row)
+				return addErr == nil
+			}); err != nil {
+				log.Warn().Err(err).Str("path", src.path).Msg("数据块损坏，跳过")
+				continue
+			}
+			if addErr != nil {
+				return nil, addErr
+			}
+		}
+	}
+	for _, p := range pendingRows {
+		if err := add(p.id, p.meta, p.t, p.row); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &QueryResult{Resolution: r.name, StepMs: step, Aggregation: q.Aggregation}
+	ids := make([]string, 0, len(results))
+	for id := range results {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		sa := results[id]
+		meta := sa.meta
+		if m, ok := current[id]; ok {
+			meta = m
+		}
+		series := SeriesResult{DeviceID: meta.DeviceID, Key: meta.Key, Tags: meta.Tags}
+		if step == 0 {
+			series.Points = sa.samples
+			sort.Slice(series.Points, func(i, j int) bool { return series.Points[i].T < series.Points[j].T })
+		} else {
+			series.Points = make([]Sample, 0, len(sa.buckets))
+			for t, st := range sa.buckets {
+				series.Points = append(series.Points, Sample{T: t, V: st.value(q.Aggregation)})
+			}
+			sort.Slice(series.Points, func(i, j int) bool { return series.Points[i].T < series.Points[j].T })
+		}
+		result.Series = append(result.Series, series)
+	}
+	return result, nil
+}
+
+// chooseResolution 选择查询精度，auto时使用间隔能整除step且保留时长覆盖开始时间的最粗精度
+func (s *Store) chooseResolution(q *Query) (*resolution, error) {
+	if q.Resolution != "" && q.Resolution != "auto" {
+		for _, r := range s.resolutions {
+			if r.name == q.Resolution {
+				if r.bucket > 0 && q.Step > 0 && q.Step.Milliseconds()%r.bucket != 0 {
+					return nil, fmt.Errorf("step必须是精度 %s 的整数倍", r.name)
+				}
+				return r, nil
+			}
+		}
+		return nil, fmt.Errorf("未知的精度: %s", q.Resolution)
+	}
+
+	step := q.Step.Milliseconds()
+	if step == 0 {
+		return s.resolutions[0], nil
+	}
+	oldest := time.Now().UnixMilli() - q.Start.UnixMilli()
+	raw := s.resolutions[0]
+	for i := len(s.resolutions) - 1; i >= 1; i-- {
+		r := s.resolutions[i]
+		if r.bucket > step || step%r.bucket != 0 {
+			continue
+		}
+		if r.retention > 0 && oldest > r.retention {
+			continue
+		}
+		return r, nil
+	}
+	return raw, nil
+}
+
+// Series 列出匹配的序列
+func (s *Store) Series(sel *Selector) []SeriesInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []SeriesInfo
+	for _, meta := range s.series {
+		if sel.matches(meta) {
+			list = append(list, SeriesInfo{DeviceID: meta.DeviceID, Key: meta.Key, Tags: meta.Tags})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].DeviceID != list[j].DeviceID {
+			return list[i].DeviceID < list[j].DeviceID
+		}
+		return list[i].Key < list[j].Key
+	})
+	return list
+}
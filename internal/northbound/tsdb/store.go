@@ -0,0 +1,422 @@
+package tsdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// 降采样数据的列
+const (
+	colMin = iota
+	colMax
+	colSum
+	colCount
+	colLast
+	rollupColumns
+)
+
+const seriesIndexFile = "series.json"
+
+// resolution 一种存储精度：原始数据或某个降采样间隔
+type resolution struct {
+	name      string
+	bucket    int64 // 降采样间隔（毫秒），原始数据为0
+	blockDur  int64 // 每个块覆盖的时长（毫秒）
+	retention int64 // 保留时长（毫秒）
+	columns   int
+	dir       string
+
+	open  map[int64]*block      // 可追加的块
+	files map[int64]blockFile   // 已写入磁盘的块
+	accs  map[string]*rollupAcc // 序列ID -> 当前降采样窗口
+}
+
+// rollupAcc 降采样窗口的累计值
+type rollupAcc struct {
+	meta  *seriesMeta
+	start int64
+	min   float64
+	max   float64
+	sum   float64
+	count float64
+	last  float64
+}
+
+func (a *rollupAcc) add(v float64) {
+	if a.count == 0 || v < a.min {
+		a.min = v
+	}
+	if a.count == 0 || v > a.max {
+		a.max = v
+	}
+	a.sum += v
+	a.count++
+	a.last = v
+}
+
+func (a *rollupAcc) row() []float64 {
+	row := make([]float64, rollupColumns)
+	row[colMin], row[colMax], row[colSum], row[colCount], row[colLast] = a.min, a.max, a.sum, a.count, a.last
+	return row
+}
+
+// StoreConfig 存储配置，时长均为毫秒
+type StoreConfig struct {
+	Path          string
+	BlockDuration int64
+	SealDelay     int64 // 块结束后保持可追加的时长，用于接收迟到数据
+	RawRetention  int64
+	Rollups       []RollupConfig
+}
+
+// RollupConfig 降采样配置
+type RollupConfig struct {
+	Name          string
+	Interval      int64
+	BlockDuration int64
+	Retention     int64
+}
+
+// StoreStats 存储统计
+type StoreStats struct {
+	Series      int            `json:"series"`
+	OpenBlocks  int            `json:"open_blocks"`
+	Files       int            `json:"files"`
+	DiskBytes   int64          `json:"disk_bytes"`
+	Appended    int64          `json:"appended"`
+	OutOfOrder  int64          `json:"out_of_order"` // 时间戳不大于序列最后一个点而丢弃
+	Expired     int64          `json:"expired"`      // 超出保留时长而丢弃
+	Skipped     int64          `json:"skipped"`      // 非数值数据点
+	Resolutions map[string]int `json:"resolutions"`  // 精度 -> 块数量
+}
+
+// Store 嵌入式时序存储，按精度分目录保存Gorilla压缩的块文件
+type Store struct {
+	config StoreConfig
+
+	mu          sync.RWMutex
+	series      map[string]*seriesMeta
+	resolutions []*resolution // 第一个为原始数据，其余按间隔从小到大排列
+	seriesDirty bool
+
+	appended   atomic.Int64
+	outOfOrder atomic.Int64
+	expired    atomic.Int64
+	skipped    atomic.Int64
+}
+
+// OpenStore 打开存储目录，加载序列索引和块文件列表
+func OpenStore(cfg StoreConfig) (*Store, error) {
+	s := &Store{config: cfg, series: make(map[string]*seriesMeta)}
+	raw := &resolution{
+		name:      "raw",
+		blockDur:  cfg.BlockDuration,
+		retention: cfg.RawRetention,
+		columns:   1,
+		dir:       filepath.Join(cfg.Path, "raw"),
+	}
+	s.resolutions = append(s.resolutions, raw)
+	rollups := append([]RollupConfig(nil), cfg.Rollups...)
+	sort.Slice(rollups, func(i, j int) bool { return rollups[i].Interval < rollups[j].Interval })
+	for _, r := range rollups {
+		s.resolutions = append(s.resolutions, &resolution{
+			name:      r.Name,
+			bucket:    r.Interval,
+			blockDur:  r.BlockDuration,
+			retention: r.Retention,
+			columns:   rollupColumns,
+			dir:       filepath.Join(cfg.Path, r.Name),
+		})
+	}
+
+	for _, r := range s.resolutions {
+		if err := os.MkdirAll(r.dir, 0755); err != nil {
+			return nil, fmt.Errorf("创建存储目录失败: %w", err)
+		}
+		r.open = make(map[int64]*block)
+		r.files = make(map[int64]blockFile)
+		r.accs = make(map[string]*rollupAcc)
+		files, err := listBlockFiles(r.dir)
+		if err != nil {
+			return nil, fmt.Errorf("读取块文件列表失败: %w", err)
+		}
+		for _, f := range files {
+			r.files[f.start] = f
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(cfg.Path, seriesIndexFile))
+	if err == nil {
+		var metas []*seriesMeta
+		if err := json.Unmarshal(data, &metas); err != nil {
+			log.Warn().Err(err).Str("path", cfg.Path).Msg("序列索引损坏，将在写入时重建")
+		}
+		for _, m := range metas {
+			s.series[seriesID(m.DeviceID, m.Key)] = m
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取序列索引失败: %w", err)
+	}
+	return s, nil
+}
+
+// Append 写入一个数值，tags为序列当前的标签
+func (s *Store) Append(deviceID, key string, tags map[string]string, t int64, v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		s.skipped.Add(1)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := seriesID(deviceID, key)
+	meta, ok := s.series[id]
+	if !ok || !sameTags(meta.Tags, tags) {
+		// 标签变化时替换元数据，已封存的块保留旧的元数据
+		meta = &seriesMeta{DeviceID: deviceID, Key: key, Tags: tags}
+		s.series[id] = meta
+		s.seriesDirty = true
+	}
+
+	raw := s.resolutions[0]
+	b := s.blockFor(raw, t)
+	if b == nil {
+		s.expired.Add(1)
+		return
+	}
+	if !b.append(meta, t, []float64{v}) {
+		s.outOfOrder.Add(1)
+		return
+	}
+	s.appended.Add(1)
+
+	for _, r := range s.resolutions[1:] {
+		start := t - mod(t, r.bucket)
+		acc := r.accs[id]
+		if acc != nil && acc.start != start {
+			if start < acc.start {
+				// 已经进入新的窗口，旧窗口的迟到数据只保存在原始数据中
+				continue
+			}
+			s.emit(r, acc)
+			acc = nil
+		}
+		if acc == nil {
+			acc = &rollupAcc{start: start}
+			r.accs[id] = acc
+		}
+		acc.meta = meta
+		acc.add(v)
+	}
+}
+
+func sameTags(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// mod 向下取整的取模，负时间戳也对齐到窗口起点
+func mod(t, d int64) int64 {
+	m := t % d
+	if m < 0 {
+		m += d
+	}
+	return m
+}
+
+// blockFor 返回时间戳所在的可追加块，已封存的块从磁盘重新打开，超出保留时长返回nil
+func (s *Store) blockFor(r *resolution, t int64) *block {
+	start := t - mod(t, r.blockDur)
+	if b, ok := r.open[start]; ok {
+		return b
+	}
+	end := start + r.blockDur
+	if r.retention > 0 && end < time.Now().UnixMilli()-r.retention {
+		return nil
+	}
+	if f, ok := r.files[start]; ok {
+		b, err := loadBlock(f.path)
+		if err != nil {
+			log.Error().Err(err).Str("path", f.path).Msg("重新打开块文件失败，数据点被丢弃")
+			return nil
+		}
+		r.open[start] = b
+		return b
+	}
+	b := newBlock(start, end, r.columns)
+	r.open[start] = b
+	return b
+}
+
+// emit 将结束的降采样窗口写入块
+func (s *Store) emit(r *resolution, acc *rollupAcc) {
+	b := s.blockFor(r, acc.start)
+	if b == nil {
+		return
+	}
+	b.append(acc.meta, acc.start, acc.row())
+}
+
+// Flush 输出已结束的降采样窗口，写入有变化的块，封存过期的块并清理超出保留时长的文件
+func (s *Store) Flush(now time.Time, sealAll bool) error {
+	nowMs := now.UnixMilli()
+
+	type pending struct {
+		r     *resolution
+		start int64
+		end   int64
+		data  []byte
+		seal  bool
+	}
+	var writes []pending
+	var seriesData []byte
+
+	s.mu.Lock()
+	for _, r := range s.resolutions[1:] {
+		for id, acc := range r.accs {
+			if sealAll || acc.start+r.bucket+s.config.SealDelay <= nowMs {
+				s.emit(r, acc)
+				delete(r.accs, id)
+			}
+		}
+	}
+	var firstErr error
+	for _, r := range s.resolutions {
+		for start, b := range r.open {
+			seal := sealAll || b.end+s.config.SealDelay <= nowMs
+			if !b.dirty {
+				if seal {
+					delete(r.open, start)
+				}
+				continue
+			}
+			data, err := b.encode()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			writes = append(writes, pending{r: r, start: b.start, end: b.end, data: data, seal: seal})
+			b.dirty = false
+		}
+	}
+	if s.seriesDirty {
+		metas := make([]*seriesMeta, 0, len(s.series))
+		for _, m := range s.series {
+			metas = append(metas, m)
+		}
+		seriesData, _ = json.Marshal(metas)
+		s.seriesDirty = false
+	}
+	s.mu.Unlock()
+
+	// 文件写入在锁外进行
+	for _, w := range writes {
+		path, err := writeBlockFile(w.r.dir, w.start, w.end, w.data)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("写入块文件失败: %w", err)
+			}
+			s.mu.Lock()
+			// 写入失败时保留数据，下次重试
+			if b, ok := w.r.open[w.start]; ok {
+				b.dirty = true
+			}
+			s.mu.Unlock()
+			continue
+		}
+		s.mu.Lock()
+		w.r.files[w.start] = blockFile{start: w.start, end: w.end, path: path}
+		// 写盘后才封存，期间查询仍从内存读取；写盘期间有新数据的块保持打开
+		if b, ok := w.r.open[w.start]; ok && w.seal && !b.dirty {
+			delete(w.r.open, w.start)
+		}
+		s.mu.Unlock()
+	}
+	if seriesData != nil {
+		path := filepath.Join(s.config.Path, seriesIndexFile)
+		if err := os.WriteFile(path+".tmp", seriesData, 0644); err == nil {
+			os.Rename(path+".tmp", path)
+		}
+	}
+
+	s.applyRetention(nowMs)
+	return firstErr
+}
+
+// applyRetention 删除超出保留时长的块文件
+func (s *Store) applyRetention(nowMs int64) {
+	var remove []string
+	s.mu.Lock()
+	for _, r := range s.resolutions {
+		if r.retention <= 0 {
+			continue
+		}
+		for start, f := range r.files {
+			if f.end < nowMs-r.retention {
+				if _, open := r.open[start]; open {
+					continue
+				}
+				delete(r.files, start)
+				remove = append(remove, f.path)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	for _, path := range remove {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Warn().Err(err).Str("path", path).Msg("删除过期块文件失败")
+		} else {
+			log.Debug().Str("path", path).Msg("已删除过期块文件")
+		}
+	}
+}
+
+// Stats 返回存储统计
+func (s *Store) Stats() StoreStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stats := StoreStats{
+		Series:      len(s.series),
+		Appended:    s.appended.Load(),
+		OutOfOrder:  s.outOfOrder.Load(),
+		Expired:     s.expired.Load(),
+		Skipped:     s.skipped.Load(),
+		Resolutions: make(map[string]int),
+	}
+	for _, r := range s.resolutions {
+		stats.OpenBlocks += len(r.open)
+		stats.Files += len(r.files)
+		stats.Resolutions[r.name] = len(r.files)
+		for _, f := range r.files {
+			if info, err := os.Stat(f.path); err == nil {
+				stats.DiskBytes += info.Size()
+			}
+		}
+	}
+	return stats
+}
+
+// Skip 记录无法存储的数据点（非数值）
+func (s *Store) Skip() {
+	s.skipped.Add(1)
+}
@@ -0,0 +1,315 @@
+package tsdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/model"
+	"github.com/y001j/iot-gateway/internal/northbound"
+)
+
+func init() {
+	// 注册连接器工厂
+	northbound.Register("tsdb", func() northbound.Sink {
+		return NewTSDBSink()
+	})
+}
+
+// NewTSDBSink 创建一个新的本地时序存储连接器
+func NewTSDBSink() *TSDBSink {
+	return &TSDBSink{
+		BaseSink: northbound.NewBaseSink("tsdb"),
+	}
+}
+
+// TSDBSink 将数值数据保存到本地Gorilla压缩存储，供Web图表和规则试运行查询
+type TSDBSink struct {
+	*northbound.BaseSink
+	config   TSDBConfig
+	store    *Store
+	storeCfg StoreConfig
+	flushInt time.Duration
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// TSDBConfig 是本地时序存储的特定参数配置，时长使用Go duration格式（如 90s、1h、168h）
+type TSDBConfig struct {
+	Path          string         `json:"path"`           // 数据目录
+	BlockDuration string         `json:"block_duration"` // 原始数据每个块的时长，默认1h
+	FlushInterval string         `json:"flush_interval"` // 写盘间隔，默认1m
+	SealDelay     string         `json:"seal_delay"`     // 块结束后仍接收迟到数据的时长，默认10m
+	Retention     string         `json:"retention"`      // 原始数据保留时长，默认168h
+	Rollups       []RollupParams `json:"rollups"`        // 降采样配置，默认1m和1h，配置为空列表时关闭
+}
+
+// RollupParams 降采样参数
+type RollupParams struct {
+	Name          string `json:"name"`           // 精度名称，查询时使用，默认与interval相同
+	Interval      string `json:"interval"`       // 降采样间隔
+	BlockDuration string `json:"block_duration"` // 每个块的时长
+	Retention     string `json:"retention"`      // 保留时长
+}
+
+// Init 初始化连接器
+func (s *TSDBSink) Init(cfg json.RawMessage) error {
+	// 使用标准化配置解析
+	standardConfig, err := s.ParseStandardConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("解析TSDB sink配置失败: %w", err)
+	}
+
+	config := TSDBConfig{
+		Path:          "data/tsdb",
+		BlockDuration: "1h",
+		FlushInterval: "1m",
+		SealDelay:     "10m",
+		Retention:     "168h",
+		Rollups: []RollupParams{
+			{Name: "1m", Interval: "1m", BlockDuration: "24h", Retention: "720h"},
+			{Name: "1h", Interval: "1h", BlockDuration: "720h", Retention: "8760h"},
+		},
+	}
+	if len(standardConfig.Params) > 0 {
+		if err := json.Unmarshal(standardConfig.Params, &config); err != nil {
+			return fmt.Errorf("解析TSDB特定参数失败: %w", err)
+		}
+	}
+
+	storeCfg := StoreConfig{Path: config.Path}
+	if storeCfg.BlockDuration, err = parseMillis("block_duration", config.BlockDuration); err != nil {
+		return err
+	}
+	if storeCfg.SealDelay, err = parseMillis("seal_delay", config.SealDelay); err != nil {
+		return err
+	}
+	if storeCfg.RawRetention, err = parseMillis("retention", config.Retention); err != nil {
+		return err
+	}
+	flushMs, err := parseMillis("flush_interval", config.FlushInterval)
+	if err != nil {
+		return err
+	}
+	if storeCfg.BlockDuration <= 0 || flushMs <= 0 {
+		return fmt.Errorf("block_duration和flush_interval必须大于0")
+	}
+
+	names := map[string]bool{"raw": true}
+	for _, r := range config.Rollups {
+		rc := RollupConfig{Name: r.Name}
+		if rc.Name == "" {
+			rc.Name = r.Interval
+		}
+		if names[rc.Name] {
+			return fmt.Errorf("降采样名称重复: %s", rc.Name)
+		}
+		names[rc.Name] = true
+		if rc.Interval, err = parseMillis("rollups.interval", r.Interval); err != nil {
+			return err
+		}
+		if rc.BlockDuration, err = parseMillis("rollups.block_duration", r.BlockDuration); err != nil {
+			return err
+		}
+		if rc.Retention, err = parseMillis("rollups.retention", r.Retention); err != nil {
+			return err
+		}
+		if rc.Interval <= 0 || rc.BlockDuration < rc.Interval || rc.BlockDuration%rc.Interval != 0 {
+			return fmt.Errorf("降采样 %s 的block_duration必须是interval的整数倍", rc.Name)
+		}
+		storeCfg.Rollups = append(storeCfg.Rollups, rc)
+	}
+
+	s.config = config
+	s.storeCfg = storeCfg
+	s.flushInt = time.Duration(flushMs) * time.Millisecond
+
+	log.Info().
+		Str("name", s.Name()).
+		Str("path", config.Path).
+		Str("block_duration", config.BlockDuration).
+		Str("retention", config.Retention).
+		Int("rollups", len(storeCfg.Rollups)).
+		Msg("TSDB连接器初始化完成")
+	return nil
+}
+
+func parseMillis(name, value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("无效的%s: %s", name, value)
+	}
+	return d.Milliseconds(), nil
+}
+
+// Start 打开存储并启动定期写盘
+func (s *TSDBSink) Start(ctx context.Context) error {
+	store, err := OpenStore(s.storeCfg)
+	if err != nil {
+		return fmt.Errorf("打开TSDB存储失败: %w", err)
+	}
+	s.mu.Lock()
+	s.store = store
+	s.mu.Unlock()
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.wg.Add(1)
+	go s.flushLoop(ctx)
+
+	s.SetRunning(true)
+	stats := store.Stats()
+	log.Info().
+		Str("name", s.Name()).
+		Int("series", stats.Series).
+		Int("files", stats.Files).
+		Int64("disk_bytes", stats.DiskBytes).
+		Msg("TSDB连接器启动")
+	return nil
+}
+
+func (s *TSDBSink) flushLoop(ctx context.Context) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.flushInt)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := s.store.Flush(now, false); err != nil {
+				s.HandleError(err, "TSDB写盘")
+			}
+		}
+	}
+}
+
+// Publish 保存数据点，数值和布尔值直接保存，复合数据按字段保存为 key.字段，字符串被跳过
+func (s *TSDBSink) Publish(batch []model.Point) error {
+	if !s.IsRunning() {
+		return fmt.Errorf("TSDB连接器未启动")
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	// 记录发布操作开始时间
+	publishStart := time.Now()
+
+	return s.SafePublishBatch(batch, func(batch []model.Point) error {
+		// 使用基础方法添加标签
+		s.AddTags(batch)
+
+		for i := range batch {
+			s.appendPoint(&batch[i])
+		}
+		return nil
+	}, publishStart)
+}
+
+func (s *TSDBSink) appendPoint(point *model.Point) {
+	ts := point.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	t := ts.UnixMilli()
+	tags := point.GetTagsCopy()
+
+	if fields, ok := northbound.FlattenComposite(point); ok {
+		for name, v := range fields {
+			if _, isString := v.(string); isString {
+				continue
+			}
+			if f, ok := northbound.ToFloat64(v); ok {
+				s.store.Append(point.DeviceID, point.Key+"."+name, tags, t, f)
+			}
+		}
+		return
+	}
+	if _, isString := point.Value.(string); isString {
+		s.store.Skip()
+		return
+	}
+	f, ok := northbound.ToFloat64(point.Value)
+	if !ok {
+		s.store.Skip()
+		return
+	}
+	s.store.Append(point.DeviceID, point.Key, tags, t, f)
+}
+
+// Stop 写入所有未保存的数据并停止连接器
+func (s *TSDBSink) Stop() error {
+	if !s.IsRunning() {
+		return nil
+	}
+	s.SetRunning(false)
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+
+	if err := s.store.Flush(time.Now(), true); err != nil {
+		s.HandleError(err, "TSDB写盘")
+	}
+	stats := s.store.Stats()
+	log.Info().
+		Str("name", s.Name()).
+		Int("series", stats.Series).
+		Int64("appended", stats.Appended).
+		Int64("out_of_order", stats.OutOfOrder).
+		Int64("disk_bytes", stats.DiskBytes).
+		Msg("TSDB连接器停止")
+	return nil
+}
+
+// Healthy 检查连接器健康状态
+func (s *TSDBSink) Healthy() error {
+	if !s.IsRunning() {
+		return fmt.Errorf("TSDB连接器未运行")
+	}
+	return nil
+}
+
+func (s *TSDBSink) getStore() (*Store, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.store == nil {
+		return nil, fmt.Errorf("TSDB存储未打开")
+	}
+	return s.store, nil
+}
+
+// Query 查询历史数据
+func (s *TSDBSink) Query(q *Query) (*QueryResult, error) {
+	store, err := s.getStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.Query(q)
+}
+
+// Series 列出匹配的序列
+func (s *TSDBSink) Series(sel *Selector) ([]SeriesInfo, error) {
+	store, err := s.getStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.Series(sel), nil
+}
+
+// StoreStats 返回存储统计
+func (s *TSDBSink) StoreStats() (StoreStats, error) {
+	store, err := s.getStore()
+	if err != nil {
+		return StoreStats{}, err
+	}
+	return store.Stats(), nil
+}
@@ -0,0 +1,92 @@
+package northbound
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/y001j/iot-gateway/internal/model"
+)
+
+// ToFloat64 将数据点的标量值转换为float64，布尔值转换为0/1
+func ToFloat64(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case float32:
+		return float64(val), true
+	case int:
+		return float64(val), true
+	case int8:
+		return float64(val), true
+	case int16:
+		return float64(val), true
+	case int32:
+		return float64(val), true
+	case int64:
+		return float64(val), true
+	case uint:
+		return float64(val), true
+	case uint8:
+		return float64(val), true
+	case uint16:
+		return float64(val), true
+	case uint32:
+		return float64(val), true
+	case uint64:
+		return float64(val), true
+	case bool:
+		if val {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(val, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// FlattenComposite 将复合数据点展开为扁平字段，嵌套对象以下划线连接，数组按下标展开
+// 如 location -> latitude、longitude；vector -> values_0、values_1
+// 非复合数据点返回false
+func FlattenComposite(point *model.Point) (map[string]interface{}, bool) {
+	if !point.IsComposite() {
+		return nil, false
+	}
+
+	composite, err := model.DecodeCompositeValue(point.Type, point.Value)
+	if err != nil {
+		return nil, false
+	}
+	data, err := json.Marshal(composite)
+	if err != nil {
+		return nil, false
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, false
+	}
+
+	fields := make(map[string]interface{}, len(raw))
+	for name, v := range raw {
+		flattenValue(fields, name, v)
+	}
+	return fields, true
+}
+
+func flattenValue(fields map[string]interface{}, prefix string, v interface{}) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for name, item := range val {
+			flattenValue(fields, prefix+"_"+name, item)
+		}
+	case []interface{}:
+		for i, item := range val {
+			flattenValue(fields, prefix+"_"+strconv.Itoa(i), item)
+		}
+	case nil:
+	default:
+		fields[prefix] = val
+	}
+}
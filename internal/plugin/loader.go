@@ -426,7 +426,7 @@ func (l *Loader) loadBuiltinPlugin(meta Meta) error {
 	case TypeSink:
 		// 加载内置连接器
 		switch builtinName {
-		case "mqtt", "console", "influxdb", "redis", "websocket", "jetstream":
+		case "mqtt", "console", "influxdb", "redis", "websocket", "jetstream", "modbus_server", "opcua_server", "kafka", "postgres", "http", "tsdb", "file":
 			// 使用新的注册系统创建连接器
 			sink := northbound.CreateSink(builtinName)
 			if sink == nil {
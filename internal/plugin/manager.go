@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -13,6 +14,7 @@ import (
 	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
+	"github.com/y001j/iot-gateway/internal/codec"
 	"github.com/y001j/iot-gateway/internal/metrics"
 	"github.com/y001j/iot-gateway/internal/model"
 	"github.com/y001j/iot-gateway/internal/northbound"
@@ -28,13 +30,6 @@ var (
 		},
 	}
 	
-	// JSON数据缓冲池
-	jsonBufferPool = sync.Pool{
-		New: func() interface{} {
-			return make([]byte, 0, 1024)
-		},
-	}
-	
 	// 设备数据点映射池
 	deviceMapPool = sync.Pool{
 		New: func() interface{} {
@@ -83,6 +78,10 @@ type Manager struct {
 	// 已初始化的适配器和连接器
 	adapters map[string]southbound.Adapter
 	sinks    map[string]northbound.Sink
+
+	// 连接器路由配置，未配置路由的连接器接收全部数据
+	routes   map[string]*sinkRoute
+	routesMu sync.RWMutex
 	
 	// 插件元数据缓存优化
 	pluginCache       []*Meta
@@ -100,6 +99,7 @@ func NewManager(dir string, bus *nats.Conn, v *viper.Viper) *Manager {
 		loader:          NewLoader(dir),
 		adapters:        make(map[string]southbound.Adapter),
 		sinks:           make(map[string]northbound.Sink),
+		routes:          make(map[string]*sinkRoute),
 		dataChan:        make(chan model.Point, 1000),
 		cacheExpiration: 30 * time.Second, // 缓存30秒过期
 	}
@@ -249,12 +249,15 @@ func (m *Manager) initSinks() error {
 			}
 		}
 
-		// 如果是NATS订阅器连接器，设置NATS连接
-		if sinkType == "nats_subscriber" {
-			if natsAwareSink, ok := sink.(northbound.NATSAwareSink); ok {
-				natsAwareSink.SetNATSConnection(m.bus)
-				log.Info().Str("name", name).Msg("为NATS订阅器连接器设置NATS连接")
-			}
+		// 需要NATS连接的连接器（NATS订阅器、转发写入命令的服务端连接器等），设置NATS连接
+		if natsAwareSink, ok := sink.(northbound.NATSAwareSink); ok {
+			natsAwareSink.SetNATSConnection(m.bus)
+			log.Info().Str("name", name).Str("type", sinkType).Msg("为连接器设置NATS连接")
+		}
+
+		// 解析路由配置
+		if err := m.setRoute(name, sinkMap); err != nil {
+			return err
 		}
 
 		// 保存已初始化的连接器
@@ -353,6 +356,8 @@ func (m *Manager) setupDataFlow(ctx context.Context) {
 					m.sendBatchOptimized(batch)
 					batch = batch[:0] // 重置长度但保留底层数组
 				}
+				// 输出降采样中已结束的窗口
+				m.flushRoutes(time.Now())
 
 			case <-statsTicker.C:
 				// 输出统计信息
@@ -542,15 +547,17 @@ func (m *Manager) sendBatch(points []model.Point) {
 		// 同时发布到NATS总线，用于MQTT连接器和规则引擎订阅
 		if m.bus != nil {
 			topic := fmt.Sprintf("data.%s", name)
+			busCodec := codec.Bus()
+			header := codec.Header(busCodec)
 			for _, point := range points {
-				data, err := json.Marshal(point)
+				data, err := busCodec.Marshal(&point)
 				if err != nil {
 					log.Error().Err(err).Str("name", name).Msg("序列化数据点失败")
 					continue
 				}
 
 				// 发布到sink特定的主题（用于MQTT连接器）
-				err = m.bus.Publish(topic, data)
+				err = m.bus.PublishMsg(&nats.Msg{Subject: topic, Data: data, Header: header})
 				if err != nil {
 					log.Error().Err(err).Str("name", name).Str("topic", topic).Msg("发布数据点到NATS失败")
 				} else {
@@ -559,7 +566,7 @@ func (m *Manager) sendBatch(points []model.Point) {
 
 				// 同时发布到规则引擎主题
 				rulesTopic := fmt.Sprintf("iot.data.%s.%s", point.DeviceID, point.Key)
-				err = m.bus.Publish(rulesTopic, data)
+				err = m.bus.PublishMsg(&nats.Msg{Subject: rulesTopic, Data: data, Header: header})
 				if err != nil {
 					log.Error().Err(err).Str("topic", rulesTopic).Msg("发布数据点到规则引擎主题失败")
 				} else {
@@ -594,22 +601,23 @@ func (m *Manager) sendBatchOptimized(points []model.Point) {
 		devicePoints[point.DeviceID] = append(devicePoints[point.DeviceID], point)
 	}
 
-	// 批量序列化数据点
+	// 批量序列化数据点，编码由 gateway.bus_encoding 决定
 	var serializedData [][]byte
 	var natsSubjects []string
-	jsonBuffer := jsonBufferPool.Get().([]byte)
-	defer func() {
-		jsonBuffer = jsonBuffer[:0]
-		jsonBufferPool.Put(jsonBuffer)
-	}()
+	busCodec := codec.Bus()
 
-	// 发送到所有连接器
+	// 按路由配置发送到各连接器，未配置路由的连接器接收全部数据
+	routed := make(map[string][]model.Point, len(m.sinks))
 	for name, sink := range m.sinks {
-		// 直接发送到连接器
-		if err := sink.Publish(points); err != nil {
+		sinkPoints := m.routePoints(name, points)
+		if len(sinkPoints) == 0 {
+			continue
+		}
+		routed[name] = sinkPoints
+		if err := sink.Publish(sinkPoints); err != nil {
 			log.Error().Err(err).Str("name", name).Msg("发送数据到连接器失败")
 		} else {
-			log.Debug().Str("name", name).Int("count", len(points)).Msg("成功发送数据到连接器")
+			log.Debug().Str("name", name).Int("count", len(sinkPoints)).Msg("成功发送数据到连接器")
 		}
 	}
 
@@ -620,16 +628,17 @@ func (m *Manager) sendBatchOptimized(points []model.Point) {
 		natsSubjects = make([]string, 0, len(points)*2)
 
 		for _, point := range points {
-			// 复用JSON缓冲区
-			jsonBuffer = jsonBuffer[:0]
-			data, err := json.Marshal(point)
+			data, err := busCodec.Marshal(&point)
 			if err != nil {
 				log.Error().Err(err).Msg("序列化数据点失败")
 				continue
 			}
 
-			// 添加连接器特定主题
-			for name := range m.sinks {
+			// 添加连接器特定主题（仅未配置路由的连接器，路由后的数据在下面单独添加）
+			for name := range routed {
+				if m.getRoute(name) != nil {
+					continue
+				}
 				topic := fmt.Sprintf("data.%s", name)
 				serializedData = append(serializedData, data)
 				natsSubjects = append(natsSubjects, topic)
@@ -641,8 +650,25 @@ func (m *Manager) sendBatchOptimized(points []model.Point) {
 			natsSubjects = append(natsSubjects, rulesTopic)
 		}
 
+		// 添加配置了路由的连接器主题
+		for name, sinkPoints := range routed {
+			if m.getRoute(name) == nil {
+				continue
+			}
+			topic := fmt.Sprintf("data.%s", name)
+			for i := range sinkPoints {
+				data, err := busCodec.Marshal(&sinkPoints[i])
+				if err != nil {
+					log.Error().Err(err).Msg("序列化数据点失败")
+					continue
+				}
+				serializedData = append(serializedData, data)
+				natsSubjects = append(natsSubjects, topic)
+			}
+		}
+
 		// 批量发布所有消息
-		if err := m.publishBatch(natsSubjects, serializedData); err != nil {
+		if err := m.publishBatch(busCodec, natsSubjects, serializedData); err != nil {
 			log.Error().Err(err).Msg("批量发布NATS消息失败")
 		}
 	}
@@ -651,15 +677,16 @@ func (m *Manager) sendBatchOptimized(points []model.Point) {
 	log.Debug().Int("count", len(points)).Int("device_count", len(devicePoints)).Msg("发送数据点批次完成")
 }
 
-// publishBatch 批量发布NATS消息以减少网络开销
-func (m *Manager) publishBatch(subjects []string, data [][]byte) error {
+// publishBatch 批量发布NATS消息以减少网络开销，非JSON编码的消息带Content-Type头
+func (m *Manager) publishBatch(c codec.Codec, subjects []string, data [][]byte) error {
 	if len(subjects) != len(data) {
 		return fmt.Errorf("主题和数据数量不匹配")
 	}
 
 	// 使用异步发布提高性能
+	header := codec.Header(c)
 	for i, subject := range subjects {
-		if err := m.bus.Publish(subject, data[i]); err != nil {
+		if err := m.bus.PublishMsg(&nats.Msg{Subject: subject, Data: data[i], Header: header}); err != nil {
 			log.Error().Err(err).Str("subject", subject).Msg("发布消息失败")
 		}
 	}
@@ -1124,10 +1151,22 @@ func (m *Manager) startBuiltinSink(name string) error {
 	if setter, ok := sink.(interface{ SetBus(*nats.Conn) }); ok {
 		setter.SetBus(m.bus)
 	}
+	if natsAwareSink, ok := sink.(northbound.NATSAwareSink); ok {
+		natsAwareSink.SetNATSConnection(m.bus)
+	}
 	if nameSetter, ok := sink.(interface{ SetName(string) }); ok {
 		nameSetter.SetName(name)
 	}
 
+	// 解析路由配置
+	if found {
+		if err := m.setRoute(name, pluginConfigMap); err != nil {
+			return err
+		}
+	} else {
+		m.removeRoute(name)
+	}
+
 	if err := sink.Start(m.ctx); err != nil {
 		return fmt.Errorf("failed to start builtin sink '%s': %w", name, err)
 	}
@@ -1210,6 +1249,7 @@ func (m *Manager) StopPlugin(name string) error {
 			log.Error().Err(err).Str("plugin_name", name).Msg("Failed to stop sink cleanly, proceeding with cleanup")
 		}
 		delete(m.sinks, name)
+		m.removeRoute(name)
 
 		// 对于外部插件，需要卸载
 		if _, isExternal := m.loader.Get(name); isExternal {
@@ -1255,6 +1295,19 @@ func (m *Manager) GetSink(name string) (northbound.Sink, bool) {
 	return sink, exists
 }
 
+// SinkNames 返回所有运行中的连接器名称
+func (m *Manager) SinkNames() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.sinks))
+	for name := range m.sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // loadAllDiscoveredPlugins 加载所有发现的插件
 func (m *Manager) loadAllDiscoveredPlugins() error {
 	plugins := m.loader.List()
@@ -0,0 +1,502 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/codec"
+	"github.com/y001j/iot-gateway/internal/model"
+	"github.com/y001j/iot-gateway/internal/northbound"
+	"github.com/y001j/iot-gateway/internal/utils"
+)
+
+// RouteSelector 路由选择器，配置的条件需要同时满足，未配置的条件不参与匹配
+type RouteSelector struct {
+	Devices []string          `json:"devices,omitempty"` // 设备ID通配符
+	Keys    []string          `json:"keys,omitempty"`    // 数据点key通配符
+	Tags    map[string]string `json:"tags,omitempty"`    // 标签名 -> 值通配符，"*" 表示标签存在即可
+	Types   []string          `json:"types,omitempty"`   // 数据类型，如 float、location
+	Quality []int             `json:"quality,omitempty"` // 允许的质量码
+}
+
+// SampleConfig 采样/降采样配置，按设备+key分别计算
+type SampleConfig struct {
+	EveryN    int    `json:"every_n,omitempty"`   // 每N个数据点保留1个
+	Interval  string `json:"interval,omitempty"`  // 时间窗口，如 1s、1m、1h
+	Aggregate string `json:"aggregate,omitempty"` // 窗口输出: first last avg min max，默认first
+}
+
+// RouteConfig 连接器的路由配置
+// 数据点满足include中任意一个选择器（include为空时全部满足）且不满足exclude中任何选择器时发送到该连接器
+type RouteConfig struct {
+	Include []RouteSelector `json:"include,omitempty"`
+	Exclude []RouteSelector `json:"exclude,omitempty"`
+	Sample  *SampleConfig   `json:"sample,omitempty"`
+}
+
+// SinkRouteInfo 路由表中的一项，用于监控接口
+type SinkRouteInfo struct {
+	Sink          string          `json:"sink"`
+	Passthrough   bool            `json:"passthrough"` // 未配置路由，接收全部数据
+	Include       []RouteSelector `json:"include,omitempty"`
+	Exclude       []RouteSelector `json:"exclude,omitempty"`
+	Sample        *SampleConfig   `json:"sample,omitempty"`
+	Received      int64           `json:"received"`       // 进入路由的数据点
+	Filtered      int64           `json:"filtered"`       // 被选择器过滤的数据点
+	Sampled       int64           `json:"sampled"`        // 被采样丢弃或合并的数据点
+	Routed        int64           `json:"routed"`         // 发送到连接器的数据点
+	PendingSeries int             `json:"pending_series"` // 降采样中尚未输出的序列
+}
+
+// sinkRoute 单个连接器的路由状态
+type sinkRoute struct {
+	config    RouteConfig
+	interval  time.Duration
+	aggregate string
+
+	mu     sync.Mutex
+	series map[string]*sampleState
+
+	received atomic.Int64
+	filtered atomic.Int64
+	sampled  atomic.Int64
+	routed   atomic.Int64
+}
+
+// sampleIdleWindows 序列空闲超过该数量的窗口后清除采样状态
+const sampleIdleWindows = 10
+
+// sampleState 一个序列的采样状态
+type sampleState struct {
+	count     int64
+	window    int64 // 当前窗口序号（时间戳 / interval）
+	hasWindow bool
+	emitted   bool      // first模式下当前窗口是否已输出
+	closed    bool      // 聚合模式下当前窗口是否已因序列空闲输出
+	seen      time.Time // 最近一个数据点的到达时间
+
+	// 聚合模式下当前窗口的累计值
+	last    model.Point
+	sum     float64
+	min     float64
+	max     float64
+	samples int64
+	numeric bool
+}
+
+// parseRouteConfig 从连接器配置中解析routing字段，未配置时返回nil
+func parseRouteConfig(raw interface{}) (*sinkRoute, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("序列化路由配置失败: %w", err)
+	}
+	var cfg RouteConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("解析路由配置失败: %w", err)
+	}
+	return newSinkRoute(cfg)
+}
+
+func newSinkRoute(cfg RouteConfig) (*sinkRoute, error) {
+	r := &sinkRoute{config: cfg, series: make(map[string]*sampleState)}
+	if s := cfg.Sample; s != nil {
+		if s.EveryN < 0 {
+			return nil, fmt.Errorf("every_n不能为负数")
+		}
+		if s.Interval != "" {
+			d, err := time.ParseDuration(s.Interval)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("无效的采样间隔: %s", s.Interval)
+			}
+			r.interval = d
+		}
+		r.aggregate = s.Aggregate
+		if r.aggregate == "" {
+			r.aggregate = "first"
+		}
+		switch r.aggregate {
+		case "first", "last", "avg", "min", "max":
+		default:
+			return nil, fmt.Errorf("不支持的聚合方式: %s", s.Aggregate)
+		}
+		if r.aggregate != "first" && r.interval == 0 {
+			return nil, fmt.Errorf("聚合方式 %s 需要配置interval", r.aggregate)
+		}
+	}
+	return r, nil
+}
+
+// matches 判断数据点是否满足选择器
+func (sel *RouteSelector) matches(point *model.Point) bool {
+	if len(sel.Devices) > 0 && !matchAnyGlob(sel.Devices, point.DeviceID) {
+		return false
+	}
+	if len(sel.Keys) > 0 && !matchAnyGlob(sel.Keys, point.Key) {
+		return false
+	}
+	if len(sel.Types) > 0 {
+		found := false
+		for _, t := range sel.Types {
+			if t == string(point.Type) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(sel.Quality) > 0 {
+		found := false
+		for _, q := range sel.Quality {
+			if q == point.Quality {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for name, pattern := range sel.Tags {
+		value, ok := point.GetTag(name)
+		if !ok || !utils.MatchGlob(pattern, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAnyGlob(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if utils.MatchGlob(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// accepts 判断数据点是否通过include/exclude
+func (r *sinkRoute) accepts(point *model.Point) bool {
+	if len(r.config.Include) > 0 {
+		included := false
+		for i := range r.config.Include {
+			if r.config.Include[i].matches(point) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	for i := range r.config.Exclude {
+		if r.config.Exclude[i].matches(point) {
+			return false
+		}
+	}
+	return true
+}
+
+// route 过滤并采样一批数据点，返回需要发送给连接器的数据点
+func (r *sinkRoute) route(points []model.Point) []model.Point {
+	r.received.Add(int64(len(points)))
+	out := make([]model.Point, 0, len(points))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range points {
+		point := &points[i]
+		if !r.accepts(point) {
+			r.filtered.Add(1)
+			continue
+		}
+		if r.config.Sample == nil {
+			out = append(out, *point)
+			continue
+		}
+		out = r.sample(point, out)
+	}
+	r.routed.Add(int64(len(out)))
+	return out
+}
+
+// sample 对单个数据点采样。窗口按数据点时间戳分配，只由本序列更新的窗口推进关闭，
+// 聚合模式在进入新窗口时输出上一个窗口的结果，早于当前窗口的乱序数据被丢弃
+func (r *sinkRoute) sample(point *model.Point, out []model.Point) []model.Point {
+	seriesKey := point.DeviceID + "\x00" + point.Key
+	st, ok := r.series[seriesKey]
+	if !ok {
+		st = &sampleState{}
+		r.series[seriesKey] = st
+	}
+	now := time.Now()
+	st.seen = now
+
+	if n := int64(r.config.Sample.EveryN); n > 1 {
+		st.count++
+		if (st.count-1)%n != 0 {
+			r.sampled.Add(1)
+			return out
+		}
+	}
+	if r.interval == 0 {
+		return append(out, *point)
+	}
+
+	ts := point.Timestamp
+	if ts.IsZero() {
+		ts = now
+	}
+	window := ts.UnixNano() / int64(r.interval)
+	if st.hasWindow && window < st.window {
+		r.sampled.Add(1)
+		return out
+	}
+	if st.hasWindow && window > st.window {
+		// 进入新窗口，输出上一个窗口的聚合结果
+		if r.aggregate != "first" && st.samples > 0 && !st.closed {
+			out = append(out, r.summary(st))
+		}
+		st.reset()
+	}
+	if !st.hasWindow {
+		st.window = window
+		st.hasWindow = true
+	}
+
+	if r.aggregate == "first" {
+		if st.emitted {
+			r.sampled.Add(1)
+			return out
+		}
+		st.emitted = true
+		return append(out, *point)
+	}
+
+	// 聚合模式：累计当前窗口，窗口结束时输出一个数据点
+	if st.closed {
+		r.sampled.Add(1)
+		return out
+	}
+	if st.samples > 0 {
+		r.sampled.Add(1)
+	}
+	st.add(point)
+	return out
+}
+
+func (st *sampleState) reset() {
+	st.hasWindow = false
+	st.emitted = false
+	st.closed = false
+	st.samples = 0
+	st.sum = 0
+	st.numeric = false
+}
+
+func (st *sampleState) add(point *model.Point) {
+	st.last = *point
+	f, ok := northbound.ToFloat64(point.Value)
+	if _, isString := point.Value.(string); isString || point.IsComposite() {
+		ok = false
+	}
+	if st.samples == 0 {
+		st.numeric = ok
+		st.min, st.max = f, f
+	}
+	st.samples++
+	if !ok {
+		st.numeric = false
+		return
+	}
+	st.sum += f
+	if f < st.min {
+		st.min = f
+	}
+	if f > st.max {
+		st.max = f
+	}
+}
+
+// summary 生成窗口的聚合数据点，时间戳为窗口起始时间；非数值序列输出窗口内最后一个值
+func (r *sinkRoute) summary(st *sampleState) model.Point {
+	point := st.last
+	point.Timestamp = time.Unix(0, st.window*int64(r.interval))
+	tags := point.GetTagsCopy()
+	point.SafeTags = utils.NewShardedTags(16)
+	point.SetTagsSafe(tags)
+	point.AddTag("downsample", r.aggregate+"/"+r.interval.String())
+
+	if !st.numeric {
+		return point
+	}
+	switch r.aggregate {
+	case "avg":
+		point.Value = st.sum / float64(st.samples)
+		point.Type = model.TypeFloat
+	case "min":
+		point.Value = st.min
+	case "max":
+		point.Value = st.max
+	}
+	return point
+}
+
+// flush 输出空闲序列的当前窗口，并清理长时间空闲的序列。
+// 窗口按事件时间分配，不能与当前时间比较；序列超过一个interval没有新数据时
+// 不会再推进窗口，此时输出窗口结果，之后到达的同一窗口数据被丢弃
+func (r *sinkRoute) flush(now time.Time) []model.Point {
+	if r.interval == 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []model.Point
+	for key, st := range r.series {
+		idle := now.Sub(st.seen)
+		if idle < r.interval {
+			continue
+		}
+		if r.aggregate != "first" && st.samples > 0 && !st.closed {
+			out = append(out, r.summary(st))
+			st.closed = true
+		}
+		// 保留计数和窗口状态，避免空闲后重复输出同一窗口或重新开始every_n计数
+		if idle >= sampleIdleWindows*r.interval {
+			delete(r.series, key)
+		}
+	}
+	r.routed.Add(int64(len(out)))
+	return out
+}
+
+func (r *sinkRoute) info(sink string) SinkRouteInfo {
+	r.mu.Lock()
+	pending := 0
+	for _, st := range r.series {
+		if st.samples > 0 && !st.closed {
+			pending++
+		}
+	}
+	r.mu.Unlock()
+	return SinkRouteInfo{
+		Sink:          sink,
+		Include:       r.config.Include,
+		Exclude:       r.config.Exclude,
+		Sample:        r.config.Sample,
+		Received:      r.received.Load(),
+		Filtered:      r.filtered.Load(),
+		Sampled:       r.sampled.Load(),
+		Routed:        r.routed.Load(),
+		PendingSeries: pending,
+	}
+}
+
+// setRoute 根据连接器配置设置或清除路由
+func (m *Manager) setRoute(name string, sinkConfig map[string]interface{}) error {
+	route, err := parseRouteConfig(sinkConfig["routing"])
+	if err != nil {
+		return fmt.Errorf("连接器 %s 的路由配置无效: %w", name, err)
+	}
+	m.routesMu.Lock()
+	defer m.routesMu.Unlock()
+	if route == nil {
+		delete(m.routes, name)
+	} else {
+		m.routes[name] = route
+	}
+	return nil
+}
+
+func (m *Manager) removeRoute(name string) {
+	m.routesMu.Lock()
+	delete(m.routes, name)
+	m.routesMu.Unlock()
+}
+
+func (m *Manager) getRoute(name string) *sinkRoute {
+	m.routesMu.RLock()
+	defer m.routesMu.RUnlock()
+	return m.routes[name]
+}
+
+// routePoints 返回发送给连接器的数据点，未配置路由时原样返回
+func (m *Manager) routePoints(name string, points []model.Point) []model.Point {
+	route := m.getRoute(name)
+	if route == nil {
+		return points
+	}
+	return route.route(points)
+}
+
+// flushRoutes 输出降采样中已结束的窗口
+func (m *Manager) flushRoutes(now time.Time) {
+	m.routesMu.RLock()
+	pending := make(map[string][]model.Point)
+	for name, route := range m.routes {
+		if points := route.flush(now); len(points) > 0 {
+			pending[name] = points
+		}
+	}
+	m.routesMu.RUnlock()
+
+	for name, points := range pending {
+		m.publishToSink(name, points)
+	}
+}
+
+// publishToSink 发送降采样输出的数据点到连接器及其NATS主题
+func (m *Manager) publishToSink(name string, points []model.Point) {
+	sink, ok := m.sinks[name]
+	if !ok {
+		return
+	}
+	if err := sink.Publish(points); err != nil {
+		log.Error().Err(err).Str("name", name).Msg("发送降采样数据到连接器失败")
+	} else {
+		log.Debug().Str("name", name).Int("count", len(points)).Msg("成功发送降采样数据到连接器")
+	}
+
+	if m.bus == nil {
+		return
+	}
+	subjects := make([]string, 0, len(points))
+	data := make([][]byte, 0, len(points))
+	topic := fmt.Sprintf("data.%s", name)
+	busCodec := codec.Bus()
+	for i := range points {
+		payload, err := busCodec.Marshal(&points[i])
+		if err != nil {
+			log.Error().Err(err).Msg("序列化数据点失败")
+			continue
+		}
+		subjects = append(subjects, topic)
+		data = append(data, payload)
+	}
+	if err := m.publishBatch(busCodec, subjects, data); err != nil {
+		log.Error().Err(err).Msg("批量发布NATS消息失败")
+	}
+}
+
+// RoutingTable 返回所有连接器的路由表
+func (m *Manager) RoutingTable() []SinkRouteInfo {
+	names := m.SinkNames()
+	table := make([]SinkRouteInfo, 0, len(names))
+	for _, name := range names {
+		if route := m.getRoute(name); route != nil {
+			table = append(table, route.info(name))
+		} else {
+			table = append(table, SinkRouteInfo{Sink: name, Passthrough: true})
+		}
+	}
+	return table
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -31,16 +32,7 @@ func (h *AggregateHandler) Name() string {
 
 // Execute 执行聚合动作 - 使用增量统计优化
 func (h *AggregateHandler) Execute(ctx context.Context, point model.Point, rule *rules.Rule, config map[string]interface{}) (*rules.ActionResult, error) {
-	// 首先验证配置
-	if err := h.Validate(config); err != nil {
-		return &rules.ActionResult{
-			Type:     "aggregate",
-			Success:  false,
-			Error:    fmt.Sprintf("配置验证失败: %v", err),
-			Duration: 0,
-		}, err
-	}
-	
+	// 配置已在规则加载时验证
 	// 解析配置
 	aggregateConfig, err := h.parseConfig(config)
 	if err != nil {
@@ -104,8 +96,8 @@ func (h *AggregateHandler) parseConfig(config map[string]interface{}) (*Aggregat
 		if windowType, ok := windowTypeVal.(string); ok {
 			aggregateConfig.WindowType = windowType
 			
-			// 如果是时间窗口，解析时间参数
-			if windowType == "time" {
+			// 如果是时间窗口或跳跃窗口，解析时间参数
+			if windowType == windowTypeTime || windowType == windowTypeHopping {
 				if windowVal, ok := config["window"]; ok {
 					if windowStr, ok := windowVal.(string); ok {
 						if duration, err := time.ParseDuration(windowStr); err == nil {
@@ -124,7 +116,47 @@ func (h *AggregateHandler) parseConfig(config map[string]interface{}) (*Aggregat
 					return nil, fmt.Errorf("时间窗口模式下必须配置window参数")
 				}
 			}
+			
+			switch windowType {
+			case windowTypeHopping:
+				advance, _, err := parseDurationField(config, "advance")
+				if err != nil {
+					return nil, err
+				}
+				aggregateConfig.WindowAdvance = advance
+			case windowTypeSession:
+				gap, _, err := parseDurationField(config, "gap")
+				if err != nil {
+					return nil, err
+				}
+				aggregateConfig.SessionGap = gap
+				if aggregateConfig.SessionMinLength, _, err = parseDurationField(config, "min_length"); err != nil {
+					return nil, err
+				}
+				if aggregateConfig.SessionMaxLength, _, err = parseDurationField(config, "max_length"); err != nil {
+					return nil, err
+				}
+				if aggregateConfig.WindowSize == 0 {
+					aggregateConfig.WindowSize = 1000 // 默认每个会话最多缓存1000个点
+				}
+			}
+		}
+	}
+
+	// 解析窗口输出触发配置
+	if triggerVal, ok := config["trigger"].(map[string]interface{}); ok {
+		if triggerType, ok := triggerVal["type"].(string); ok {
+			if triggerType == triggerTime {
+				triggerType = triggerEarly
+			}
+			aggregateConfig.Trigger.Type = triggerType
 		}
+		aggregateConfig.Trigger.Count = h.convertInt(triggerVal["count"])
+		interval, _, err := parseDurationField(triggerVal, "interval")
+		if err != nil {
+			return nil, err
+		}
+		aggregateConfig.Trigger.Interval = interval
 	}
 
 	// 解析对齐方式 (Phase 2)
@@ -136,6 +168,34 @@ func (h *AggregateHandler) parseConfig(config map[string]interface{}) (*Aggregat
 		}
 	}
 
+	// 解析事件时间窗口配置
+	if timeModeVal, ok := config["time_mode"].(string); ok && timeModeVal == "event" {
+		aggregateConfig.TimeMode = "event"
+		aggregateConfig.TTL = 24 * time.Hour // 设备可能长时间离线后补传数据
+		aggregateConfig.LatePolicy = latePolicyDrop
+		aggregateConfig.LateRetention = aggregateConfig.WindowDuration
+		if aggregateConfig.WindowType == windowTypeSession {
+			aggregateConfig.LateRetention = aggregateConfig.SessionGap
+		}
+		
+		lateness, _, err := parseDurationField(config, "allowed_lateness")
+		if err != nil {
+			return nil, err
+		}
+		aggregateConfig.AllowedLateness = lateness
+		if policy, ok := config["late_policy"].(string); ok && policy != "" {
+			aggregateConfig.LatePolicy = policy
+		}
+		if subject, ok := config["late_subject"].(string); ok {
+			aggregateConfig.LateSubject = subject
+		}
+		if retention, ok, err := parseDurationField(config, "late_retention"); err != nil {
+			return nil, err
+		} else if ok {
+			aggregateConfig.LateRetention = retention
+		}
+	}
+
 	// 如果都没设置，使用默认值为10（滑动窗口模式）
 	// 设置为0时表示累积模式，设置为>0时表示滑动窗口模式
 	if aggregateConfig.WindowSize == 0 && aggregateConfig.WindowType == "count" {
@@ -241,9 +301,45 @@ func (h *AggregateHandler) parseConfig(config map[string]interface{}) (*Aggregat
 		}
 	}
 
+	aggregateConfig.raw = config
 	return aggregateConfig, nil
 }
 
+// convertInt 转换配置中的整数
+func (h *AggregateHandler) convertInt(val interface{}) int {
+	switch v := val.(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	case string:
+		if intVal, err := strconv.Atoi(v); err == nil {
+			return intVal
+		}
+	}
+	return 0
+}
+
+// parseDurationField 解析字符串格式的时长字段
+func parseDurationField(config map[string]interface{}, field string) (time.Duration, bool, error) {
+	val, ok := config[field]
+	if !ok {
+		return 0, false, nil
+	}
+	str, ok := val.(string)
+	if !ok {
+		return 0, true, fmt.Errorf("%s必须为字符串格式，如'30s', '5m'", field)
+	}
+	duration, err := time.ParseDuration(str)
+	if err != nil {
+		return 0, true, fmt.Errorf("%s格式错误: %v", field, err)
+	}
+	if duration < 0 {
+		return 0, true, fmt.Errorf("%s不能为负数", field)
+	}
+	return duration, true, nil
+}
+
 // Close 关闭处理器
 func (h *AggregateHandler) Close() {
 	if h.manager != nil {
@@ -252,6 +348,11 @@ func (h *AggregateHandler) Close() {
 	}
 }
 
+// SetAggregateResultSink 实现rules.AggregateResultEmitter，接收处理时间窗口到期输出的结果
+func (h *AggregateHandler) SetAggregateResultSink(sink rules.AggregateResultSink) {
+	h.manager.windows.setSink(sink)
+}
+
 // GetStats 获取处理器统计信息
 func (h *AggregateHandler) GetStats() map[string]interface{} {
 	if h.manager != nil {
@@ -276,11 +377,19 @@ func (h *AggregateHandler) Validate(config map[string]interface{}) error {
 						return fmt.Errorf("无效的时间窗口格式: %s", windowStr)
 					}
 				}
-			} else if windowType != "count" {
-				return fmt.Errorf("不支持的窗口类型: %s，仅支持'time'和'count'", windowType)
+			} else if windowType != "count" && windowType != windowTypeHopping && windowType != windowTypeSession {
+				return fmt.Errorf("不支持的窗口类型: %s，仅支持'time'、'count'、'hopping'和'session'", windowType)
 			}
 		}
 	}
+	// 验证跳跃、会话窗口和触发配置
+	if err := validateWindowConfig(config); err != nil {
+		return err
+	}
+	// 验证事件时间窗口配置
+	if err := validateEventTimeConfig(config); err != nil {
+		return err
+	}
 	// 验证窗口大小
 	if windowSizeVal, ok := config["window_size"]; ok {
 		switch v := windowSizeVal.(type) {
@@ -487,4 +596,141 @@ func (h *AggregateHandler) Validate(config map[string]interface{}) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// validateEventTimeConfig 验证事件时间窗口配置
+func validateEventTimeConfig(config map[string]interface{}) error {
+	timeModeVal, ok := config["time_mode"]
+	if !ok {
+		return nil
+	}
+	timeMode, ok := timeModeVal.(string)
+	if !ok {
+		return fmt.Errorf("time_mode必须为字符串")
+	}
+	switch timeMode {
+	case "", "processing":
+		return nil
+	case "event":
+	default:
+		return fmt.Errorf("不支持的时间模式: %s，仅支持'processing'和'event'", timeMode)
+	}
+
+	switch windowType, _ := config["window_type"].(string); windowType {
+	case windowTypeTime, windowTypeHopping, windowTypeSession:
+	default:
+		return fmt.Errorf("事件时间模式需要window_type为'time'、'hopping'或'session'")
+	}
+
+	for _, field := range []string{"allowed_lateness", "late_retention"} {
+		duration, _, err := parseDurationField(config, field)
+		if err != nil {
+			return err
+		}
+		if duration > 24*time.Hour {
+			return fmt.Errorf("%s不能超过24小时", field)
+		}
+	}
+
+	policy, _ := config["late_policy"].(string)
+	switch policy {
+	case "", latePolicyDrop, latePolicyUpdate:
+	case latePolicySideOutput:
+		subject, _ := config["late_subject"].(string)
+		if subject == "" {
+			return fmt.Errorf("side_output策略必须配置late_subject")
+		}
+		if strings.ContainsAny(subject, "*> \t") {
+			return fmt.Errorf("late_subject不能包含通配符或空白: %s", subject)
+		}
+	default:
+		return fmt.Errorf("不支持的迟到数据策略: %s，仅支持'drop'、'side_output'和'update'", policy)
+	}
+	return nil
+}
+
+// validateWindowConfig 验证跳跃窗口、会话窗口和窗口输出触发配置
+func validateWindowConfig(config map[string]interface{}) error {
+	windowType, _ := config["window_type"].(string)
+	switch windowType {
+	case windowTypeHopping:
+		windowStr, ok := config["window"].(string)
+		if !ok {
+			return fmt.Errorf("跳跃窗口必须配置window参数")
+		}
+		size, err := time.ParseDuration(windowStr)
+		if err != nil || size <= 0 {
+			return fmt.Errorf("无效的时间窗口格式: %s", windowStr)
+		}
+		advance, ok, err := parseDurationField(config, "advance")
+		if err != nil {
+			return err
+		}
+		if !ok || advance <= 0 {
+			return fmt.Errorf("跳跃窗口必须配置大于0的advance参数")
+		}
+		if advance > size {
+			return fmt.Errorf("advance(%s)不能大于窗口大小(%s)", advance, size)
+		}
+		// 每个数据点会进入 size/advance 个窗口
+		if size/advance > 100 {
+			return fmt.Errorf("窗口大小与advance之比不能超过100")
+		}
+	case windowTypeSession:
+		gap, ok, err := parseDurationField(config, "gap")
+		if err != nil {
+			return err
+		}
+		if !ok || gap <= 0 {
+			return fmt.Errorf("会话窗口必须配置大于0的gap参数")
+		}
+		minLength, _, err := parseDurationField(config, "min_length")
+		if err != nil {
+			return err
+		}
+		maxLength, _, err := parseDurationField(config, "max_length")
+		if err != nil {
+			return err
+		}
+		if maxLength > 0 && minLength > maxLength {
+			return fmt.Errorf("min_length(%s)不能大于max_length(%s)", minLength, maxLength)
+		}
+	}
+
+	triggerVal, ok := config["trigger"]
+	if !ok {
+		return nil
+	}
+	trigger, ok := triggerVal.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("trigger必须为对象")
+	}
+	triggerType, _ := trigger["type"].(string)
+	switch triggerType {
+	case "", triggerOnClose:
+	case triggerCount:
+		count, ok := trigger["count"].(float64)
+		if intCount, isInt := trigger["count"].(int); isInt {
+			count, ok = float64(intCount), true
+		}
+		if !ok || count < 1 || count > 100000 {
+			return fmt.Errorf("count触发需要1到100000之间的count参数")
+		}
+	case triggerEarly:
+		interval, ok, err := parseDurationField(trigger, "interval")
+		if err != nil {
+			return err
+		}
+		if !ok || interval < time.Second {
+			return fmt.Errorf("early触发需要不小于1秒的interval参数")
+		}
+	case triggerTime:
+		// 旧版配置，按early处理，未配置interval时不输出中间结果
+		if _, _, err := parseDurationField(trigger, "interval"); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("不支持的触发方式: %s，仅支持'on_close'、'count'、'early'和'time'", triggerType)
+	}
+	return nil
+}
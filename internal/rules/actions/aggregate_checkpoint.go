@@ -0,0 +1,364 @@
+package actions
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/rules"
+)
+
+// 聚合状态检查点的状态类型
+const (
+	incrementalStateKind     = "incremental"
+	highPerformanceStateKind = "high_performance"
+)
+
+// incrementalStatsState IncrementalStats的检查点，缓存字段不保存，恢复后重新计算
+type incrementalStatsState struct {
+	Count            int64            `json:"count"`
+	Sum              float64          `json:"sum"`
+	SumSquares       float64          `json:"sum_squares"`
+	Min              *float64         `json:"min,omitempty"` // 没有数据时为±Inf，JSON无法表示
+	Max              *float64         `json:"max,omitempty"`
+	LastValue        float64          `json:"last_value"`
+	FirstValue       float64          `json:"first_value"`
+	FirstValueSet    bool             `json:"first_value_set"`
+	LastUpdateTime   time.Time        `json:"last_update_time"`
+	FirstUpdateTime  time.Time        `json:"first_update_time"`
+	WindowSize       int              `json:"window_size"`
+	Values           []float64        `json:"values,omitempty"`
+	ValueIndex       int              `json:"value_index"`
+	WindowFull       bool             `json:"window_full"`
+	WindowType       string           `json:"window_type"`
+	WindowDuration   time.Duration    `json:"window_duration"`
+	TimeValues       []TimestampValue `json:"time_values,omitempty"`
+	TimeIndex        int              `json:"time_index"`
+	Alignment        string           `json:"alignment"`
+	NullCount        int64            `json:"null_count"`
+	ValidCount       int64            `json:"valid_count"`
+	UpperLimit       *float64         `json:"upper_limit,omitempty"`
+	LowerLimit       *float64         `json:"lower_limit,omitempty"`
+	OutlierThreshold float64          `json:"outlier_threshold"`
+}
+
+func finiteOrNil(v float64) *float64 {
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return nil
+	}
+	return &v
+}
+
+func valueOr(p *float64, def float64) float64 {
+	if p == nil {
+		return def
+	}
+	return *p
+}
+
+// checkpointState 导出统计状态
+func (s *IncrementalStats) checkpointState() incrementalStatsState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return incrementalStatsState{
+		Count:            s.count,
+		Sum:              s.sum,
+		SumSquares:       s.sumSquares,
+		Min:              finiteOrNil(s.min),
+		Max:              finiteOrNil(s.max),
+		LastValue:        s.lastValue,
+		FirstValue:       s.firstValue,
+		FirstValueSet:    s.firstValueSet,
+		LastUpdateTime:   s.lastUpdateTime,
+		FirstUpdateTime:  s.firstUpdateTime,
+		WindowSize:       s.windowSize,
+		Values:           append([]float64(nil), s.values...),
+		ValueIndex:       s.valueIndex,
+		WindowFull:       s.windowFull,
+		WindowType:       s.windowType,
+		WindowDuration:   s.windowDuration,
+		TimeValues:       append([]TimestampValue(nil), s.timeValues...),
+		TimeIndex:        s.timeIndex,
+		Alignment:        s.alignment,
+		NullCount:        s.nullCount,
+		ValidCount:       s.validCount,
+		UpperLimit:       s.upperLimit,
+		LowerLimit:       s.lowerLimit,
+		OutlierThreshold: s.outlierThreshold,
+	}
+}
+
+// restoreIncrementalStats 从检查点重建统计计算器
+func restoreIncrementalStats(state *incrementalStatsState) (*IncrementalStats, error) {
+	stats := NewIncrementalStatsWithWindow(state.WindowSize, state.WindowType, state.WindowDuration, state.Alignment)
+	if len(state.Values) != len(stats.values) || len(state.TimeValues) != len(stats.timeValues) {
+		return nil, fmt.Errorf("窗口缓冲区长度与窗口大小 %d 不一致", state.WindowSize)
+	}
+	if n := len(stats.values); n > 0 && (state.ValueIndex < 0 || state.ValueIndex >= n) {
+		return nil, fmt.Errorf("窗口索引 %d 越界", state.ValueIndex)
+	}
+	if n := len(stats.timeValues); n > 0 && (state.TimeIndex < 0 || state.TimeIndex >= n) {
+		return nil, fmt.Errorf("时间窗口索引 %d 越界", state.TimeIndex)
+	}
+
+	copy(stats.values, state.Values)
+	copy(stats.timeValues, state.TimeValues)
+	stats.count = state.Count
+	stats.sum = state.Sum
+	stats.sumSquares = state.SumSquares
+	stats.min = valueOr(state.Min, math.Inf(1))
+	stats.max = valueOr(state.Max, math.Inf(-1))
+	stats.lastValue = state.LastValue
+	stats.firstValue = state.FirstValue
+	stats.firstValueSet = state.FirstValueSet
+	stats.lastUpdateTime = state.LastUpdateTime
+	stats.firstUpdateTime = state.FirstUpdateTime
+	stats.valueIndex = state.ValueIndex
+	stats.windowFull = state.WindowFull
+	stats.timeIndex = state.TimeIndex
+	stats.nullCount = state.NullCount
+	stats.validCount = state.ValidCount
+	stats.upperLimit = state.UpperLimit
+	stats.lowerLimit = state.LowerLimit
+	if state.OutlierThreshold > 0 {
+		stats.outlierThreshold = state.OutlierThreshold
+	}
+	return stats, nil
+}
+
+// highPerformanceStatsState HighPerformanceStats的检查点
+type highPerformanceStatsState struct {
+	Count            int64     `json:"count"`
+	Sum              float64   `json:"sum"`
+	SumSquares       float64   `json:"sum_squares"`
+	Min              *float64  `json:"min,omitempty"`
+	Max              *float64  `json:"max,omitempty"`
+	FirstUpdateTime  int64     `json:"first_update_time"`
+	LastUpdateTime   int64     `json:"last_update_time"`
+	FirstValue       float64   `json:"first_value"`
+	LastValue        float64   `json:"last_value"`
+	NullCount        int64     `json:"null_count"`
+	ValidCount       int64     `json:"valid_count"`
+	WriteIndex       uint64    `json:"write_index"`
+	WindowSize       int       `json:"window_size"`
+	WindowFull       bool      `json:"window_full"`
+	UpperLimit       float64   `json:"upper_limit"`
+	LowerLimit       float64   `json:"lower_limit"`
+	OutlierThreshold float64   `json:"outlier_threshold"`
+	RingBuffer       []float64 `json:"ring_buffer,omitempty"`
+}
+
+// checkpointState 导出统计状态
+func (hps *HighPerformanceStats) checkpointState() highPerformanceStatsState {
+	state := highPerformanceStatsState{
+		Count:            atomic.LoadInt64(&hps.count),
+		Sum:              atomicLoadFloat64(&hps.sum),
+		SumSquares:       atomicLoadFloat64(&hps.sumSquares),
+		Min:              finiteOrNil(atomicLoadFloat64(&hps.minVal)),
+		Max:              finiteOrNil(atomicLoadFloat64(&hps.maxVal)),
+		FirstUpdateTime:  int64(atomic.LoadUint64(&hps.firstUpdateTime)),
+		LastUpdateTime:   int64(atomic.LoadUint64(&hps.lastUpdateTime)),
+		FirstValue:       atomicLoadFloat64(&hps.firstValue),
+		LastValue:        atomicLoadFloat64(&hps.lastValue),
+		NullCount:        atomic.LoadInt64(&hps.nullCount),
+		ValidCount:       atomic.LoadInt64(&hps.validCount),
+		WriteIndex:       atomic.LoadUint64(&hps.writeIndex),
+		WindowSize:       int(hps.windowSize),
+		WindowFull:       atomic.LoadUint32(&hps.windowFull) == 1,
+		UpperLimit:       atomicLoadFloat64(&hps.upperLimit),
+		LowerLimit:       atomicLoadFloat64(&hps.lowerLimit),
+		OutlierThreshold: atomicLoadFloat64(&hps.outlierThreshold),
+	}
+	if len(hps.ringBuffer) > 0 {
+		state.RingBuffer = make([]float64, len(hps.ringBuffer))
+		for i := range hps.ringBuffer {
+			state.RingBuffer[i] = math.Float64frombits(atomic.LoadUint64(&hps.ringBuffer[i]))
+		}
+	}
+	return state
+}
+
+// restoreHighPerformanceStats 从检查点重建统计计算器
+func restoreHighPerformanceStats(state *highPerformanceStatsState) (*HighPerformanceStats, error) {
+	hps := NewHighPerformanceStats(state.WindowSize)
+	if len(state.RingBuffer) != len(hps.ringBuffer) {
+		return nil, fmt.Errorf("环形缓冲区长度与窗口大小 %d 不一致", state.WindowSize)
+	}
+	for i, v := range state.RingBuffer {
+		hps.ringBuffer[i] = math.Float64bits(v)
+	}
+	hps.count = state.Count
+	hps.sum = math.Float64bits(state.Sum)
+	hps.sumSquares = math.Float64bits(state.SumSquares)
+	hps.minVal = math.Float64bits(valueOr(state.Min, math.Inf(1)))
+	hps.maxVal = math.Float64bits(valueOr(state.Max, math.Inf(-1)))
+	hps.firstUpdateTime = uint64(state.FirstUpdateTime)
+	hps.lastUpdateTime = uint64(state.LastUpdateTime)
+	hps.firstValue = math.Float64bits(state.FirstValue)
+	hps.lastValue = math.Float64bits(state.LastValue)
+	hps.nullCount = state.NullCount
+	hps.validCount = state.ValidCount
+	hps.writeIndex = state.WriteIndex
+	if state.WindowFull {
+		hps.windowFull = 1
+	}
+	hps.upperLimit = math.Float64bits(state.UpperLimit)
+	hps.lowerLimit = math.Float64bits(state.LowerLimit)
+	if state.OutlierThreshold > 0 {
+		hps.outlierThreshold = math.Float64bits(state.OutlierThreshold)
+	}
+	return hps, nil
+}
+
+// AggregateStateKind 实现rules.AggregateStateProvider
+func (m *AggregateManager) AggregateStateKind() string { return incrementalStateKind }
+
+// SnapshotAggregateStates 导出全部非空聚合状态
+func (m *AggregateManager) SnapshotAggregateStates() []rules.AggregateCheckpoint {
+	m.mu.RLock()
+	states := make([]*AggregateState, 0, len(m.states))
+	for _, state := range m.states {
+		states = append(states, state)
+	}
+	m.mu.RUnlock()
+
+	checkpoints := make([]rules.AggregateCheckpoint, 0, len(states))
+	for _, state := range states {
+		if state.Stats.IsEmpty() {
+			continue
+		}
+		data, err := json.Marshal(state.Stats.checkpointState())
+		if err != nil {
+			log.Warn().Err(err).Str("state_key", state.GroupKey).Msg("序列化聚合状态失败")
+			continue
+		}
+		checkpoints = append(checkpoints, rules.AggregateCheckpoint{
+			RuleID:   state.RuleID,
+			GroupKey: state.GroupKey,
+			State:    data,
+		})
+	}
+	return checkpoints
+}
+
+// RestoreAggregateState 恢复一个聚合状态，不覆盖已存在的状态
+func (m *AggregateManager) RestoreAggregateState(cp *rules.AggregateCheckpoint) error {
+	var saved incrementalStatsState
+	if err := json.Unmarshal(cp.State, &saved); err != nil {
+		return err
+	}
+	stats, err := restoreIncrementalStats(&saved)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.states[cp.GroupKey]; exists {
+		return nil
+	}
+	if len(m.states) >= m.maxStates {
+		return fmt.Errorf("状态数量已达上限 %d", m.maxStates)
+	}
+	m.states[cp.GroupKey] = &AggregateState{
+		RuleID:     cp.RuleID,
+		GroupKey:   cp.GroupKey,
+		WindowSize: saved.WindowSize,
+		Stats:      stats,
+		LastAccess: time.Now(),
+	}
+	m.currentMem += m.estimateStateSize(saved.WindowSize)
+	return nil
+}
+
+// DropAggregateStates 丢弃规则的全部聚合状态
+func (m *AggregateManager) DropAggregateStates(ruleID string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dropped := 0
+	for key, state := range m.states {
+		if state.RuleID != ruleID {
+			continue
+		}
+		delete(m.states, key)
+		m.currentMem -= m.estimateStateSize(state.WindowSize)
+		dropped++
+	}
+	if m.currentMem < 0 {
+		m.currentMem = 0
+	}
+	return dropped
+}
+
+// AggregateStateKind 实现rules.AggregateStateProvider
+func (sam *ShardedAggregateManager) AggregateStateKind() string { return highPerformanceStateKind }
+
+// SnapshotAggregateStates 导出全部非空聚合状态
+func (sam *ShardedAggregateManager) SnapshotAggregateStates() []rules.AggregateCheckpoint {
+	var checkpoints []rules.AggregateCheckpoint
+	for _, shard := range sam.shards {
+		shard.states.Range(func(key, value interface{}) bool {
+			state := value.(*shardedAggregateState)
+			if state.stats.IsEmpty() {
+				return true
+			}
+			data, err := json.Marshal(state.stats.checkpointState())
+			if err != nil {
+				log.Warn().Err(err).Str("state_key", key.(string)).Msg("序列化聚合状态失败")
+				return true
+			}
+			checkpoints = append(checkpoints, rules.AggregateCheckpoint{
+				RuleID:   state.ruleID,
+				GroupKey: key.(string),
+				State:    data,
+			})
+			return true
+		})
+	}
+	return checkpoints
+}
+
+// RestoreAggregateState 恢复一个聚合状态，不覆盖已存在的状态
+func (sam *ShardedAggregateManager) RestoreAggregateState(cp *rules.AggregateCheckpoint) error {
+	var saved highPerformanceStatsState
+	if err := json.Unmarshal(cp.State, &saved); err != nil {
+		return err
+	}
+	stats, err := restoreHighPerformanceStats(&saved)
+	if err != nil {
+		return err
+	}
+	shard := sam.shards[sam.getShardID(cp.GroupKey)]
+	shard.states.LoadOrStore(cp.GroupKey, &shardedAggregateState{ruleID: cp.RuleID, stats: stats})
+	return nil
+}
+
+// DropAggregateStates 丢弃规则的全部聚合状态
+func (sam *ShardedAggregateManager) DropAggregateStates(ruleID string) int {
+	dropped := 0
+	for _, shard := range sam.shards {
+		shard.states.Range(func(key, value interface{}) bool {
+			if value.(*shardedAggregateState).ruleID == ruleID {
+				shard.states.Delete(key)
+				dropped++
+			}
+			return true
+		})
+	}
+	return dropped
+}
+
+// AggregateStateProviders 实现rules.AggregateStateProviderSource
+func (h *AggregateHandler) AggregateStateProviders() []rules.AggregateStateProvider {
+	return []rules.AggregateStateProvider{h.manager, h.manager.windows}
+}
+
+// AggregateStateProviders 实现rules.AggregateStateProviderSource，包括回退使用的原始处理器
+func (h *OptimizedAggregateHandler) AggregateStateProviders() []rules.AggregateStateProvider {
+	return append([]rules.AggregateStateProvider{h.shardedManager}, h.fallback.AggregateStateProviders()...)
+}
@@ -26,10 +26,27 @@ type AggregateConfig struct {
 	UpperLimit       *float64               `json:"upper_limit,omitempty"`
 	LowerLimit       *float64               `json:"lower_limit,omitempty"`
 	OutlierThreshold *float64               `json:"outlier_threshold,omitempty"`
+
+	// 跳跃窗口和会话窗口配置
+	WindowAdvance    time.Duration `json:"window_advance"`     // 跳跃窗口步长
+	SessionGap       time.Duration `json:"session_gap"`        // 会话不活跃间隔
+	SessionMinLength time.Duration `json:"session_min_length"` // 短于该时长的会话不输出
+	SessionMaxLength time.Duration `json:"session_max_length"` // 超过该时长的会话强制关闭
+	Trigger          WindowTrigger `json:"trigger"`
+
+	// 事件时间窗口配置
+	TimeMode        string        `json:"time_mode"`        // "processing"(默认) 或 "event"
+	AllowedLateness time.Duration `json:"allowed_lateness"` // 水位线落后最大事件时间的时长
+	LatePolicy      string        `json:"late_policy"`      // "drop", "side_output", "update"
+	LateSubject     string        `json:"late_subject"`     // side_output 策略的输出主题
+	LateRetention   time.Duration `json:"late_retention"`   // update 策略下已输出窗口的保留时长
+
+	raw map[string]interface{} // 原始动作配置，定时输出结果时交给规则引擎
 }
 
 // AggregateState 聚合状态
 type AggregateState struct {
+	RuleID      string
 	GroupKey    string
 	WindowSize  int
 	Stats       *IncrementalStats
@@ -49,6 +66,7 @@ type AggregateManager struct {
 	maxStates   int           // 最大状态数量限制
 	maxMemory   int64         // 最大内存使用限制（字节）
 	currentMem  int64         // 当前内存使用估算
+	windows     *windowAggregator // 跳跃、会话和事件时间窗口状态
 }
 
 // NewAggregateManager 创建聚合管理器
@@ -64,17 +82,22 @@ func NewAggregateManager() *AggregateManager {
 		maxStates:   10000,                // 最大状态数量限制
 		maxMemory:   100 * 1024 * 1024,    // 100MB内存限制
 		currentMem:  0,
+		windows:     newWindowAggregator(),
 	}
 	
 	// 启动清理协程
 	manager.wg.Add(1)
 	go manager.cleanupLoop()
 	
+	// 启动处理时间窗口定时器
+	manager.wg.Add(1)
+	go manager.windowTimerLoop()
+	
 	return manager
 }
 
 // GetOrCreateState 获取或创建聚合状态
-func (m *AggregateManager) GetOrCreateState(stateKey string, windowSize int, config ...*AggregateConfig) *AggregateState {
+func (m *AggregateManager) GetOrCreateState(ruleID, stateKey string, windowSize int, config ...*AggregateConfig) *AggregateState {
 	m.mu.RLock()
 	if state, exists := m.states[stateKey]; exists {
 		state.mu.Lock()
@@ -107,6 +130,7 @@ func (m *AggregateManager) GetOrCreateState(stateKey string, windowSize int, con
 			log.Warn().Int("current_states", len(m.states)).Int("max_states", m.maxStates).Msg("状态数量超限，拒绝创建新状态")
 			// 返回一个临时状态，不保存到管理器中
 			return &AggregateState{
+				RuleID:     ruleID,
 				GroupKey:   stateKey,
 				WindowSize: windowSize,
 				Stats:      NewIncrementalStats(windowSize),
@@ -126,6 +150,7 @@ func (m *AggregateManager) GetOrCreateState(stateKey string, windowSize int, con
 			log.Warn().Int64("current_memory", m.currentMem).Int64("max_memory", m.maxMemory).Msg("内存使用超限，拒绝创建新状态")
 			// 返回一个临时状态
 			return &AggregateState{
+				RuleID:     ruleID,
 				GroupKey:   stateKey,
 				WindowSize: windowSize,
 				Stats:      NewIncrementalStats(windowSize),
@@ -183,6 +208,7 @@ func (m *AggregateManager) GetOrCreateState(stateKey string, windowSize int, con
 	}
 	
 	state := &AggregateState{
+		RuleID:     ruleID,
 		GroupKey:   stateKey,
 		WindowSize: windowSize,
 		Stats:      stats,
@@ -203,8 +229,12 @@ func (m *AggregateManager) ProcessPoint(rule *rules.Rule, point model.Point, con
 	// 生成状态键
 	stateKey := m.generateStateKey(rule.ID, point, config.GroupBy)
 	
+	if usesWindowAggregator(config) {
+		return m.processWindowed(rule, stateKey, point, config, start)
+	}
+	
 	// 获取或创建聚合状态
-	state := m.GetOrCreateState(stateKey, config.WindowSize, config)
+	state := m.GetOrCreateState(rule.ID, stateKey, config.WindowSize, config)
 	
 	// 提取数值
 	value, err := extractNumericValue(point.Value)
@@ -262,13 +292,62 @@ func (m *AggregateManager) ProcessPoint(rule *rules.Rule, point model.Point, con
 	return result, nil
 }
 
+// processWindowed 跳跃、会话和事件时间窗口处理，一个数据点可能触发多个窗口输出
+func (m *AggregateManager) processWindowed(rule *rules.Rule, stateKey string, point model.Point, config *AggregateConfig, start time.Time) (*rules.ActionResult, error) {
+	value, err := extractNumericValue(point.Value)
+	if err != nil {
+		return &rules.ActionResult{
+			Type:     "aggregate",
+			Success:  false,
+			Error:    fmt.Sprintf("无法提取数值: %v", err),
+			Duration: time.Since(start),
+		}, err
+	}
+	
+	outcome := m.windows.process(rule.ID, stateKey, point, value, config)
+	
+	outputMap := map[string]interface{}{
+		"state_key":  stateKey,
+		"aggregated": len(outcome.results) > 0,
+		"late":       outcome.late,
+	}
+	if len(outcome.results) > 0 {
+		outputMap["aggregate_results"] = outcome.results
+	}
+	if outcome.sideOut {
+		outputMap["late_point"] = point
+		outputMap["late_subject"] = config.LateSubject
+	}
+	
+	return &rules.ActionResult{
+		Type:     "aggregate",
+		Success:  true,
+		Duration: time.Since(start),
+		Output:   outputMap,
+	}, nil
+}
+
 // calculateAggregateResult 计算聚合结果
 func (m *AggregateManager) calculateAggregateResult(state *AggregateState, config *AggregateConfig, point model.Point) *rules.AggregateResult {
-	stats := state.Stats.GetStats()
+	return &rules.AggregateResult{
+		DeviceID:  point.DeviceID,
+		Key:       point.Key,
+		Window:    fmt.Sprintf("window_size:%d", state.WindowSize),
+		GroupBy:   groupByValues(point, config.GroupBy),
+		Functions: selectFunctions(state.Stats.GetStats(), config.Functions),
+		StartTime: state.Stats.GetLastUpdateTime(),
+		EndTime:   time.Now(),
+		Count:     state.Stats.GetCount(),
+		Timestamp: time.Now(),
+	}
+}
+
+// selectFunctions 从统计结果中选出请求的函数
+func selectFunctions(stats map[string]float64, requested []string) map[string]interface{} {
 	functions := make(map[string]interface{})
 	
 	// 计算请求的函数
-	for _, function := range config.Functions {
+	for _, function := range requested {
 		if value, exists := stats[function]; exists {
 			functions[function] = value
 		} else {
@@ -280,10 +359,13 @@ func (m *AggregateManager) calculateAggregateResult(state *AggregateState, confi
 	if len(functions) == 0 {
 		functions["avg"] = stats["avg"]
 	}
-	
-	// 构建分组信息
+	return functions
+}
+
+// groupByValues 构建分组信息
+func groupByValues(point model.Point, fields []string) map[string]string {
 	groupBy := make(map[string]string)
-	for _, field := range config.GroupBy {
+	for _, field := range fields {
 		switch field {
 		case "device_id":
 			groupBy[field] = point.DeviceID
@@ -298,18 +380,7 @@ func (m *AggregateManager) calculateAggregateResult(state *AggregateState, confi
 			}
 		}
 	}
-	
-	return &rules.AggregateResult{
-		DeviceID:  point.DeviceID,
-		Key:       point.Key,
-		Window:    fmt.Sprintf("window_size:%d", state.WindowSize),
-		GroupBy:   groupBy,
-		Functions: functions,
-		StartTime: state.Stats.GetLastUpdateTime(),
-		EndTime:   time.Now(),
-		Count:     state.Stats.GetCount(),
-		Timestamp: time.Now(),
-	}
+	return groupBy
 }
 
 // generateStateKey 生成状态键
@@ -367,8 +438,30 @@ func (m *AggregateManager) cleanupLoop() {
 	}
 }
 
+// windowTimerLoop 定时关闭到期的处理时间窗口，数据停止后会话窗口也能按时输出
+func (m *AggregateManager) windowTimerLoop() {
+	defer m.wg.Done()
+	
+	ticker := time.NewTicker(windowTimerInterval)
+	defer ticker.Stop()
+	
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.windows.advanceProcessingTime(now)
+		}
+	}
+}
+
 // cleanupExpiredStates 清理过期状态
 func (m *AggregateManager) cleanupExpiredStates() {
+	// 窗口分组清理会输出未关闭的窗口，不能持有m.mu
+	if cleaned := m.windows.cleanup(m.defaultTTL); cleaned > 0 {
+		log.Info().Int("cleaned", cleaned).Msg("清理空闲的窗口分组")
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	
@@ -466,6 +559,7 @@ func (m *AggregateManager) GetStats() map[string]interface{} {
 		"memory_usage_percent": memoryUsagePercent,
 		"default_ttl":          m.defaultTTL.String(),
 		"cleanup_tick":         m.cleanupTick.String(),
+		"windows":              m.windows.stats(),
 	}
 }
 
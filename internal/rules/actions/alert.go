@@ -73,10 +73,10 @@ func (h *AlertHandler) Execute(ctx context.Context, point model.Point, rule *rul
 	}
 
 	// 创建报警消息
-	alert := h.createAlert(point, rule, alertConfig)
+	alert := h.createAlert(ctx, point, rule, alertConfig)
 
-	// 检查节流（原子操作，避免竞态条件）
-	if h.checkAndRecordThrottle(alert) {
+	// 检查节流（原子操作，避免竞态条件），报警条件的产生和恢复事件本身已去重，不参与节流
+	if alert.Alarm == nil && h.checkAndRecordThrottle(alert) {
 		return &rules.ActionResult{
 			Type:     "alert",
 			Success:  true,
@@ -234,12 +234,16 @@ func (h *AlertHandler) parseConfig(config map[string]interface{}) (*AlertConfig,
 }
 
 // createAlert 创建报警消息
-func (h *AlertHandler) createAlert(point model.Point, rule *rules.Rule, config *AlertConfig) *rules.Alert {
+func (h *AlertHandler) createAlert(ctx context.Context, point model.Point, rule *rules.Rule, config *AlertConfig) *rules.Alert {
 	// 生成报警ID
 	alertID := h.generateAlertID()
 
+	// 序列规则触发时附带匹配到的事件，报警规则附带产生或恢复事件
+	sequence := rules.SequenceMatchFromContext(ctx)
+	alarm := rules.AlarmEventFromContext(ctx)
+
 	// 解析消息模板
-	message := h.parseMessageTemplate(config.Message, point, rule, config)
+	message := h.parseMessageTemplate(config.Message, point, rule, config, sequence, alarm)
 
 	// 合并标签
 	tags := make(map[string]string)
@@ -254,6 +258,10 @@ func (h *AlertHandler) createAlert(point model.Point, rule *rules.Rule, config *
 	for k, v := range pointTags {
 		tags["point_"+k] = v
 	}
+	if alarm != nil {
+		tags["alarm_event"] = alarm.Event
+		tags["alarm_state"] = alarm.State
+	}
 
 	return &rules.Alert{
 		ID:        alertID,
@@ -267,11 +275,13 @@ func (h *AlertHandler) createAlert(point model.Point, rule *rules.Rule, config *
 		Tags:      tags,
 		Timestamp: time.Now(),
 		Throttle:  config.Throttle,
+		Sequence:  sequence,
+		Alarm:     alarm,
 	}
 }
 
 // parseMessageTemplate 解析消息模板，支持Go模板语法
-func (h *AlertHandler) parseMessageTemplate(templateStr string, point model.Point, rule *rules.Rule, config *AlertConfig) string {
+func (h *AlertHandler) parseMessageTemplate(templateStr string, point model.Point, rule *rules.Rule, config *AlertConfig, sequence *rules.SequenceMatch, alarm *rules.AlarmEvent) string {
 	// 准备模板数据
 	templateData := map[string]interface{}{
 		"RuleName":  rule.Name,
@@ -285,6 +295,12 @@ func (h *AlertHandler) parseMessageTemplate(templateStr string, point model.Poin
 		"Level":     config.Level,
 		"Tags":      make(map[string]interface{}),
 	}
+	if sequence != nil {
+		templateData["Sequence"] = sequence
+	}
+	if alarm != nil {
+		templateData["Alarm"] = alarm
+	}
 
 	// Go 1.24安全：添加point的tags，确保正确的映射结构
 	pointTags := point.GetTagsSafe()
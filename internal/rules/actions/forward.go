@@ -63,6 +63,12 @@ func (h *ForwardHandler) Execute(ctx context.Context, point model.Point, rule *r
 		},
 		"processed_at": time.Now(),
 	}
+	if sequence := rules.SequenceMatchFromContext(ctx); sequence != nil {
+		forwardData["sequence"] = sequence
+	}
+	if alarm := rules.AlarmEventFromContext(ctx); alarm != nil {
+		forwardData["alarm"] = alarm
+	}
 
 	// 序列化并发送
 	jsonData, err := json.Marshal(forwardData)
@@ -75,7 +81,8 @@ func (h *ForwardHandler) Execute(ctx context.Context, point model.Point, rule *r
 		}, nil
 	}
 
-	if err := h.natsConn.Publish(subject, jsonData); err != nil {
+	msg := &nats.Msg{Subject: subject, Data: jsonData, Header: rules.HopHeader(ctx, subject)}
+	if err := h.natsConn.PublishMsg(msg); err != nil {
 		return &rules.ActionResult{
 			Type:     "forward",
 			Success:  false,
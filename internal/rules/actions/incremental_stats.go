@@ -848,6 +848,11 @@ func (s *IncrementalStats) GetStats() map[string]float64 {
 
 // sanitizeFloat 清理浮点数，处理NaN、Inf等异常值
 func (s *IncrementalStats) sanitizeFloat(value float64) float64 {
+	return sanitizeStat(value)
+}
+
+// sanitizeStat 清理统计结果中的NaN、Inf和接近0的极小值
+func sanitizeStat(value float64) float64 {
 	if math.IsNaN(value) {
 		return 0.0
 	}
@@ -16,6 +16,7 @@ import (
 // 使用分片管理器实现超高性能聚合处理
 type OptimizedAggregateHandler struct {
 	shardedManager *ShardedAggregateManager
+	fallback       *AggregateHandler
 	enabled        bool
 }
 
@@ -23,6 +24,7 @@ type OptimizedAggregateHandler struct {
 func NewOptimizedAggregateHandler() *OptimizedAggregateHandler {
 	return &OptimizedAggregateHandler{
 		shardedManager: NewShardedAggregateManager(),
+		fallback:       NewAggregateHandler(),
 		enabled:        true,
 	}
 }
@@ -34,22 +36,16 @@ func (h *OptimizedAggregateHandler) Name() string {
 
 // Execute 执行优化版聚合动作
 func (h *OptimizedAggregateHandler) Execute(ctx context.Context, point model.Point, rule *rules.Rule, config map[string]interface{}) (*rules.ActionResult, error) {
-	if !h.enabled {
+	// 分片管理器不支持跳跃、会话和事件时间窗口，交给原始处理器
+	timeMode, _ := config["time_mode"].(string)
+	windowType, _ := config["window_type"].(string)
+	if !h.enabled || timeMode == "event" || windowType == windowTypeHopping || windowType == windowTypeSession {
 		return h.fallbackToOriginal(ctx, point, rule, config)
 	}
 
 	start := time.Now()
 	
-	// 验证配置
-	if err := h.Validate(config); err != nil {
-		return &rules.ActionResult{
-			Type:     "aggregate",
-			Success:  false,
-			Error:    fmt.Sprintf("配置验证失败: %v", err),
-			Duration: time.Since(start),
-		}, err
-	}
-	
+	// 配置已在规则加载时验证
 	// 解析配置
 	aggregateConfig, err := h.parseOptimizedConfig(config)
 	if err != nil {
@@ -288,9 +284,8 @@ func (h *OptimizedAggregateHandler) validateThresholds(config map[string]interfa
 
 // fallbackToOriginal 回退到原始实现
 func (h *OptimizedAggregateHandler) fallbackToOriginal(ctx context.Context, point model.Point, rule *rules.Rule, config map[string]interface{}) (*rules.ActionResult, error) {
-	// 创建原始处理器并执行
-	originalHandler := NewAggregateHandler()
-	return originalHandler.Execute(ctx, point, rule, config)
+	// 使用原始处理器执行，复用同一个处理器以保留聚合状态
+	return h.fallback.Execute(ctx, point, rule, config)
 }
 
 // Close 关闭处理器
@@ -298,6 +293,14 @@ func (h *OptimizedAggregateHandler) Close() {
 	if h.shardedManager != nil {
 		h.shardedManager.Close()
 	}
+	if h.fallback != nil {
+		h.fallback.Close()
+	}
+}
+
+// SetAggregateResultSink 实现rules.AggregateResultEmitter，窗口聚合由原始处理器执行
+func (h *OptimizedAggregateHandler) SetAggregateResultSink(sink rules.AggregateResultSink) {
+	h.fallback.SetAggregateResultSink(sink)
 }
 
 // GetMetrics 获取性能指标
@@ -382,6 +385,11 @@ func init() {
 	rules.SetOptimizedAggregateHandlerFactory(func() rules.OptimizedAggregateHandler {
 		return NewOptimizedAggregateHandler()
 	})
+
+	// 聚合配置在规则加载时验证，不在每次执行时验证
+	rules.RegisterActionConfigValidator("aggregate", func(action *rules.Action) error {
+		return (&AggregateHandler{}).Validate(action.Config)
+	})
 	
 	// 检查环境变量来决定是否启用优化
 	if enableOpt := os.Getenv("IOT_GATEWAY_ENABLE_OPTIMIZED_AGGREGATE"); enableOpt == "true" {
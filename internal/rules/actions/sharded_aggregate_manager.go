@@ -30,7 +30,13 @@ type AggregateManagerShard struct {
 	cleanupRunning int32                    // atomic - 清理是否在运行
 	shardID        int32
 	// Other fields
-	states         sync.Map                 // key: stateKey, value: *HighPerformanceStats
+	states         sync.Map                 // key: stateKey, value: *shardedAggregateState
+}
+
+// shardedAggregateState 分片中的聚合状态
+type shardedAggregateState struct {
+	ruleID string
+	stats  *HighPerformanceStats
 }
 
 // BatchProcessor 批量处理器
@@ -129,7 +135,7 @@ func (sam *ShardedAggregateManager) processDirect(rule *rules.Rule, point model.
 	shard := sam.shards[shardID]
 	
 	// 获取或创建统计状态
-	stats := sam.getOrCreateStats(shard, stateKey, config)
+	stats := sam.getOrCreateStats(shard, rule.ID, stateKey, config)
 	
 	// 添加数据点
 	if point.Value != nil {
@@ -216,10 +222,10 @@ func (sam *ShardedAggregateManager) generateStateKey(rule *rules.Rule, point mod
 }
 
 // getOrCreateStats 获取或创建统计状态
-func (sam *ShardedAggregateManager) getOrCreateStats(shard *AggregateManagerShard, stateKey string, config *AggregateConfig) *HighPerformanceStats {
+func (sam *ShardedAggregateManager) getOrCreateStats(shard *AggregateManagerShard, ruleID, stateKey string, config *AggregateConfig) *HighPerformanceStats {
 	// 首次尝试快速获取
 	if value, exists := shard.states.Load(stateKey); exists {
-		return value.(*HighPerformanceStats)
+		return value.(*shardedAggregateState).stats
 	}
 	
 	// 创建新的统计状态
@@ -237,8 +243,8 @@ func (sam *ShardedAggregateManager) getOrCreateStats(shard *AggregateManagerShar
 	newStats := NewHighPerformanceStatsWithConfig(config.WindowSize, configMap)
 	
 	// 原子存储
-	actual, _ := shard.states.LoadOrStore(stateKey, newStats)
-	return actual.(*HighPerformanceStats)
+	actual, _ := shard.states.LoadOrStore(stateKey, &shardedAggregateState{ruleID: ruleID, stats: newStats})
+	return actual.(*shardedAggregateState).stats
 }
 
 // buildResult 构建结果
@@ -348,9 +354,9 @@ func (sam *ShardedAggregateManager) processBatch(shard *AggregateManagerShard, b
 		groups[stateKey] = append(groups[stateKey], point)
 	}
 	
-	// 批量处理每个分组
+	// 批量处理每个分组，状态按状态键分片，与直接处理模式使用同一个状态
 	for stateKey, groupPoints := range groups {
-		sam.processBatchGroup(shard, stateKey, groupPoints, start)
+		sam.processBatchGroup(sam.shards[sam.getShardID(stateKey)], stateKey, groupPoints, start)
 	}
 }
 
@@ -364,7 +370,7 @@ func (sam *ShardedAggregateManager) processBatchGroup(shard *AggregateManagerSha
 	config := points[0].Config
 	
 	// 获取或创建统计状态
-	stats := sam.getOrCreateStats(shard, stateKey, config)
+	stats := sam.getOrCreateStats(shard, points[0].Rule.ID, stateKey, config)
 	
 	// 提取数值进行批量处理
 	values := make([]float64, 0, len(points))
@@ -461,7 +467,7 @@ func (sam *ShardedAggregateManager) cleanupExpiredStates() {
 			
 			cleanupCount := 0
 			s.states.Range(func(key, value interface{}) bool {
-				stats := value.(*HighPerformanceStats)
+				stats := value.(*shardedAggregateState).stats
 				
 				// 如果统计状态为空且超过清理时间，则删除
 				if stats.IsEmpty() {
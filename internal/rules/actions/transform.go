@@ -16,6 +16,30 @@ import (
 	"github.com/y001j/iot-gateway/internal/rules"
 )
 
+func init() {
+	// 引用最新值的表达式在规则加载时编译，执行时不再解析
+	rules.RegisterActionConfigValidator("transform", validateTransformAction)
+}
+
+// validateTransformAction 编译expression转换中使用last/age/avg_over的表达式并保存到动作上
+func validateTransformAction(action *rules.Action) error {
+	action.SetCompiledExpressions()
+	if transformType, _ := action.Config["type"].(string); transformType != "expression" {
+		return nil
+	}
+	parameters, _ := action.Config["parameters"].(map[string]interface{})
+	expression, ok := parameters["expression"].(string)
+	if !ok || !rules.UsesLastValueFunctions(expression) {
+		return nil
+	}
+	compiled, err := rules.CompileExpression(expression)
+	if err != nil {
+		return fmt.Errorf("表达式无效: %w", err)
+	}
+	action.SetCompiledExpressions(compiled)
+	return nil
+}
+
 // TransformHandler Transform动作处理器
 type TransformHandler struct{
 	natsConn *nats.Conn
@@ -57,6 +81,10 @@ func (h *TransformHandler) Execute(ctx context.Context, point model.Point, rule
 		}, nil
 	}
 
+	if expression, ok := transformConfig.Parameters["expression"].(string); ok {
+		transformConfig.compiled = rules.ActionFromContext(ctx).CompiledExpression(expression)
+	}
+
 	// 执行转换
 	transformedPoint, err := h.transformPoint(point, transformConfig)
 	if err != nil {
@@ -102,7 +130,8 @@ func (h *TransformHandler) Execute(ctx context.Context, point model.Point, rule
 
 		// 序列化并发布
 		if jsonData, err := json.Marshal(publishData); err == nil {
-			if err := h.natsConn.Publish(publishSubject, jsonData); err != nil {
+			msg := &nats.Msg{Subject: publishSubject, Data: jsonData, Header: rules.HopHeader(ctx, publishSubject)}
+			if err := h.natsConn.PublishMsg(msg); err != nil {
 				publishError = err
 				log.Error().Err(err).Str("subject", publishSubject).Msg("发布转换数据到NATS失败")
 			} else {
@@ -162,6 +191,8 @@ type TransformConfig struct {
 	ErrorAction  string                 `json:"error_action"`  // 错误处理：ignore, default, error
 	DefaultValue interface{}            `json:"default_value"` // 默认值
 	AddTags      map[string]string      `json:"add_tags"`      // 添加标签
+
+	compiled *rules.CompiledExpression // 规则验证时编译的expression参数
 }
 
 // parseConfig 解析配置
@@ -259,7 +290,7 @@ func (h *TransformHandler) transformPoint(point model.Point, config *TransformCo
 	case "format":
 		transformedValue, err = h.formatTransform(point.Value, config.Parameters)
 	case "expression":
-		transformedValue, err = h.expressionTransform(point.Value, config.Parameters)
+		transformedValue, err = h.expressionTransform(point, config.Parameters, config.compiled)
 	case "lookup":
 		transformedValue, err = h.lookupTransform(point.Value, config.Parameters)
 	case "round":
@@ -406,12 +437,24 @@ func (h *TransformHandler) formatTransform(value interface{}, params map[string]
 }
 
 // expressionTransform 表达式转换
-func (h *TransformHandler) expressionTransform(value interface{}, params map[string]interface{}) (interface{}, error) {
+func (h *TransformHandler) expressionTransform(point model.Point, params map[string]interface{}, compiled *rules.CompiledExpression) (interface{}, error) {
 	expression, ok := params["expression"].(string)
 	if !ok {
 		return nil, fmt.Errorf("表达式未配置")
 	}
 
+	// 引用其他设备输入时使用规则表达式引擎，x为当前值；
+	// 表达式在规则验证时编译，只有未经验证直接执行的动作才在这里解析
+	if rules.UsesLastValueFunctions(expression) {
+		engine := rules.NewExpressionEngine()
+		engine.SetVariable("x", point.Value)
+		if compiled != nil {
+			return engine.EvaluateCompiled(compiled, point)
+		}
+		return engine.Evaluate(expression, point)
+	}
+	value := point.Value
+
 	// 简单的表达式计算（这里可以集成更强大的表达式引擎）
 	return h.evaluateSimpleExpression(expression, value)
 }
@@ -0,0 +1,679 @@
+package actions
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/model"
+	"github.com/y001j/iot-gateway/internal/rules"
+)
+
+// 窗口类型，count 和处理时间的 time 窗口由 IncrementalStats 处理
+const (
+	windowTypeTime    = "time"    // 滚动窗口
+	windowTypeHopping = "hopping" // 跳跃窗口，窗口大小加步长
+	windowTypeSession = "session" // 会话窗口，超过不活跃间隔后关闭
+)
+
+// 窗口结果输出触发方式
+const (
+	triggerOnClose = "on_close" // 窗口关闭时输出
+	triggerCount   = "count"    // 每N个数据点输出一次中间结果
+	triggerEarly   = "early"    // 按处理时间间隔提前输出中间结果
+	triggerTime    = "time"     // 旧版配置的定时触发，等同于early
+)
+
+// 事件时间窗口的迟到数据处理策略
+const (
+	latePolicyDrop       = "drop"        // 丢弃迟到数据
+	latePolicySideOutput = "side_output" // 迟到数据旁路输出到指定主题
+	latePolicyUpdate     = "update"      // 迟到数据并入原窗口并重新输出更新后的结果
+)
+
+// 窗口状态检查点类型，保持事件时间窗口引入时的名称以兼容已有检查点
+const windowStateKind = "event_time"
+
+// 处理时间窗口的到期检查间隔
+const windowTimerInterval = time.Second
+
+// WindowTrigger 窗口结果输出触发配置
+type WindowTrigger struct {
+	Type     string        `json:"type"`     // "on_close"(默认), "count", "early"
+	Count    int           `json:"count"`    // count 触发的点数
+	Interval time.Duration `json:"interval"` // early 触发的间隔
+}
+
+// timeWindow 滚动、跳跃或会话窗口
+type timeWindow struct {
+	Start     time.Time        `json:"start"`
+	End       time.Time        `json:"end"`
+	First     time.Time        `json:"first"` // 窗口内最早的事件时间
+	Last      time.Time        `json:"last"`  // 窗口内最晚的事件时间
+	Stats     windowStats      `json:"stats"`
+	Values    []TimestampValue `json:"values,omitempty"` // 旧版检查点的原始数值，恢复时并入Stats
+	NullCount int64            `json:"null_count"`
+	Overflow  int64            `json:"overflow"` // 超过缓存上限未缓存原始数值的点数，仍计入统计
+	Fired     bool             `json:"fired"`
+	Pending   int              `json:"pending"` // 上次输出后新增的点数
+	LastEmit  time.Time        `json:"-"`       // 上次输出的处理时间
+}
+
+// windowGroup 分组的窗口状态，水位线按分组独立推进
+type windowGroup struct {
+	RuleID         string                `json:"rule_id"`
+	GroupKey       string                `json:"group_key"`
+	DeviceID       string                `json:"device_id"`
+	Key            string                `json:"key"`
+	GroupBy        map[string]string     `json:"group_by,omitempty"`
+	MaxEventTime   time.Time             `json:"max_event_time"`
+	Watermark      time.Time             `json:"watermark"`
+	Windows        map[int64]*timeWindow `json:"windows"` // 以窗口起始时间(UnixNano)为键
+	TTL            time.Duration         `json:"ttl"`
+	ProcessingTime bool                  `json:"processing_time"`
+	LastSeen       time.Time             `json:"-"` // 处理时间，用于清理空闲分组
+
+	config    *AggregateConfig // 最近一次的配置，定时输出时使用
+	lastPoint model.Point
+}
+
+// windowOutcome 单个数据点的窗口处理结果
+type windowOutcome struct {
+	results []*rules.AggregateResult
+	late    bool // 数据点所属窗口均已输出
+	sideOut bool // 需要旁路输出
+}
+
+// windowEmission 定时器触发的结果
+type windowEmission struct {
+	ruleID  string
+	config  map[string]interface{}
+	point   model.Point
+	results []*rules.AggregateResult
+}
+
+// windowAggregator 时间窗口聚合器，支持滚动、跳跃和会话窗口
+// 事件时间模式下窗口按 point.Timestamp 分配，水位线为分组内最大事件时间减去允许延迟；
+// 处理时间模式下水位线即当前时间，由定时器推进。水位线越过窗口结束时间时输出窗口结果
+type windowAggregator struct {
+	mu     sync.Mutex
+	groups map[string]*windowGroup
+	sink   atomic.Value // rules.AggregateResultSink
+
+	windowsEmitted    int64
+	partialsEmitted   int64
+	sessionsDiscarded int64
+	lateDropped       int64
+	lateSideOutput    int64
+	lateUpdated       int64
+	overflow          int64
+}
+
+func newWindowAggregator() *windowAggregator {
+	return &windowAggregator{groups: make(map[string]*windowGroup)}
+}
+
+// usesWindowAggregator 配置是否由窗口聚合器处理
+func usesWindowAggregator(config *AggregateConfig) bool {
+	return config.TimeMode == "event" || config.WindowType == windowTypeHopping || config.WindowType == windowTypeSession
+}
+
+// process 处理数据点，返回本次触发输出的窗口结果
+func (a *windowAggregator) process(ruleID, stateKey string, point model.Point, value float64, config *AggregateConfig) windowOutcome {
+	var outcome windowOutcome
+
+	now := time.Now()
+	processingTime := config.TimeMode != "event"
+	eventTime := point.Timestamp
+	if processingTime || eventTime.IsZero() {
+		// 处理时间模式以及没有时间戳的数据点按到达时间处理
+		eventTime = now
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	group, exists := a.groups[stateKey]
+	if !exists {
+		group = &windowGroup{
+			RuleID:   ruleID,
+			GroupKey: stateKey,
+			Windows:  make(map[int64]*timeWindow),
+		}
+		a.groups[stateKey] = group
+	}
+	group.DeviceID = point.DeviceID
+	group.Key = point.Key
+	group.GroupBy = groupByValues(point, config.GroupBy)
+	group.TTL = config.TTL
+	group.ProcessingTime = processingTime
+	group.LastSeen = now
+	group.config = config
+	group.lastPoint = point
+
+	if config.WindowType == windowTypeSession {
+		outcome = a.assignSession(group, eventTime, value, config, now)
+	} else {
+		outcome = a.assignFixed(group, eventTime, value, config, now)
+	}
+	if outcome.late {
+		return outcome
+	}
+
+	// 推进水位线
+	if eventTime.After(group.MaxEventTime) {
+		group.MaxEventTime = eventTime
+		if watermark := eventTime.Add(-config.AllowedLateness); watermark.After(group.Watermark) {
+			group.Watermark = watermark
+		}
+	}
+
+	outcome.results = append(outcome.results, a.fire(group, config)...)
+	return outcome
+}
+
+// assignFixed 把数据点分配到包含它的滚动或跳跃窗口
+func (a *windowAggregator) assignFixed(group *windowGroup, eventTime time.Time, value float64, config *AggregateConfig, now time.Time) windowOutcome {
+	var outcome windowOutcome
+
+	size := config.WindowDuration
+	advance := size
+	if config.WindowType == windowTypeHopping {
+		advance = config.WindowAdvance
+	}
+
+	open := 0
+	var updated []*timeWindow
+	for start := eventTime.Truncate(advance); start.After(eventTime.Add(-size)); start = start.Add(-advance) {
+		end := start.Add(size)
+		if end.After(group.Watermark) {
+			window := group.window(start, end)
+			a.addValue(window, eventTime, value, config)
+			outcome.results = append(outcome.results, a.triggerPartial(group, window, config, now)...)
+			open++
+			continue
+		}
+		// 窗口已输出，update策略下并入保留的窗口
+		if config.LatePolicy == latePolicyUpdate && end.Add(config.LateRetention).After(group.Watermark) {
+			window := group.window(start, end)
+			window.Fired = true
+			a.addValue(window, eventTime, value, config)
+			updated = append(updated, window)
+		}
+	}
+
+	for _, window := range updated {
+		atomic.AddInt64(&a.lateUpdated, 1)
+		outcome.results = append(outcome.results, a.buildResult(group, window, config, true, false))
+	}
+
+	if open == 0 {
+		a.handleLate(&outcome, config, len(updated) > 0)
+	}
+	return outcome
+}
+
+// assignSession 把数据点并入会话窗口，相邻会话在不活跃间隔内合并
+func (a *windowAggregator) assignSession(group *windowGroup, eventTime time.Time, value float64, config *AggregateConfig, now time.Time) windowOutcome {
+	var outcome windowOutcome
+	gap := config.SessionGap
+
+	// 数据点自身的会话也已过期，属于迟到数据
+	if !eventTime.Add(gap).After(group.Watermark) {
+		var updated *timeWindow
+		if config.LatePolicy == latePolicyUpdate {
+			for _, window := range group.Windows {
+				if window.Fired && !eventTime.Before(window.First.Add(-gap)) && eventTime.Before(window.End) &&
+					window.End.Add(config.LateRetention).After(group.Watermark) {
+					updated = window
+					break
+				}
+			}
+		}
+		if updated != nil {
+			a.addValue(updated, eventTime, value, config)
+			atomic.AddInt64(&a.lateUpdated, 1)
+			outcome.results = append(outcome.results, a.buildResult(group, updated, config, true, false))
+		}
+		a.handleLate(&outcome, config, updated != nil)
+		return outcome
+	}
+
+	// 找出与 [eventTime, eventTime+gap) 重叠的未输出会话
+	var overlapping []*timeWindow
+	for _, window := range group.Windows {
+		if !window.Fired && window.First.Before(eventTime.Add(gap)) && eventTime.Before(window.End) {
+			overlapping = append(overlapping, window)
+		}
+	}
+
+	first, last := eventTime, eventTime
+	for _, window := range overlapping {
+		if window.First.Before(first) {
+			first = window.First
+		}
+		if window.Last.After(last) {
+			last = window.Last
+		}
+	}
+
+	// 超过最大会话时长时关闭已有会话，从当前数据点开始新会话
+	if config.SessionMaxLength > 0 && last.Sub(first) > config.SessionMaxLength && len(overlapping) > 0 {
+		for _, window := range overlapping {
+			delete(group.Windows, window.Start.UnixNano())
+			if result := a.closeWindow(group, window, config); result != nil {
+				outcome.results = append(outcome.results, result)
+			}
+		}
+		overlapping = nil
+		first, last = eventTime, eventTime
+	}
+
+	merged := &timeWindow{LastEmit: now}
+	for _, window := range overlapping {
+		delete(group.Windows, window.Start.UnixNano())
+		dropped := merged.Stats.merge(&window.Stats, config)
+		merged.NullCount += window.NullCount
+		merged.Overflow += window.Overflow + int64(dropped)
+		atomic.AddInt64(&a.overflow, int64(dropped))
+		merged.Pending += window.Pending
+		if window.LastEmit.Before(merged.LastEmit) {
+			merged.LastEmit = window.LastEmit
+		}
+	}
+	merged.First, merged.Last = first, last
+	merged.Start, merged.End = first, last.Add(gap)
+	group.Windows[merged.Start.UnixNano()] = merged
+
+	a.addValue(merged, eventTime, value, config)
+	outcome.results = append(outcome.results, a.triggerPartial(group, merged, config, now)...)
+	return outcome
+}
+
+// handleLate 按策略处理所属窗口均已输出的数据点
+func (a *windowAggregator) handleLate(outcome *windowOutcome, config *AggregateConfig, updated bool) {
+	outcome.late = true
+	switch {
+	case updated:
+	case config.LatePolicy == latePolicySideOutput:
+		atomic.AddInt64(&a.lateSideOutput, 1)
+		outcome.sideOut = true
+	default:
+		// drop策略，或update策略下窗口已超过保留时长
+		atomic.AddInt64(&a.lateDropped, 1)
+	}
+}
+
+// window 获取或创建固定窗口
+func (g *windowGroup) window(start, end time.Time) *timeWindow {
+	window, exists := g.Windows[start.UnixNano()]
+	if !exists {
+		window = &timeWindow{Start: start, End: end, LastEmit: time.Now()}
+		g.Windows[start.UnixNano()] = window
+	}
+	return window
+}
+
+// addValue 把数值加入窗口的增量统计，NaN和无穷大计为空值
+func (a *windowAggregator) addValue(window *timeWindow, eventTime time.Time, value float64, config *AggregateConfig) {
+	if window.First.IsZero() || eventTime.Before(window.First) {
+		window.First = eventTime
+	}
+	if eventTime.After(window.Last) {
+		window.Last = eventTime
+	}
+	window.Pending++
+
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		window.NullCount++
+		return
+	}
+	if !window.Stats.add(value, eventTime, config) {
+		// 中位数、分位数和异常值按已缓存的数值计算，数量等其他统计不受影响
+		window.Overflow++
+		atomic.AddInt64(&a.overflow, 1)
+	}
+}
+
+// triggerPartial 按触发配置输出未关闭窗口的中间结果
+func (a *windowAggregator) triggerPartial(group *windowGroup, window *timeWindow, config *AggregateConfig, now time.Time) []*rules.AggregateResult {
+	if window.Fired || window.Pending == 0 {
+		return nil
+	}
+	switch config.Trigger.Type {
+	case triggerCount:
+		if config.Trigger.Count <= 0 || window.Pending < config.Trigger.Count {
+			return nil
+		}
+	case triggerEarly:
+		if config.Trigger.Interval <= 0 || now.Sub(window.LastEmit) < config.Trigger.Interval {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	window.Pending = 0
+	window.LastEmit = now
+	atomic.AddInt64(&a.partialsEmitted, 1)
+	return []*rules.AggregateResult{a.buildResult(group, window, config, false, true)}
+}
+
+// fire 输出水位线已越过的窗口，并清除超过保留时长的已输出窗口
+func (a *windowAggregator) fire(group *windowGroup, config *AggregateConfig) []*rules.AggregateResult {
+	var ready []*timeWindow
+	for _, window := range group.Windows {
+		if !window.Fired && !window.End.After(group.Watermark) {
+			ready = append(ready, window)
+		}
+	}
+	sort.Slice(ready, func(i, j int) bool { return ready[i].Start.Before(ready[j].Start) })
+
+	var results []*rules.AggregateResult
+	for _, window := range ready {
+		if result := a.closeWindow(group, window, config); result != nil {
+			results = append(results, result)
+		}
+	}
+
+	// 非update策略下输出后立即清除
+	retention := time.Duration(0)
+	if config.LatePolicy == latePolicyUpdate {
+		retention = config.LateRetention
+	}
+	for startKey, window := range group.Windows {
+		if window.Fired && !window.End.Add(retention).After(group.Watermark) {
+			delete(group.Windows, startKey)
+		}
+	}
+	return results
+}
+
+// closeWindow 关闭窗口并生成最终结果，短于最小会话时长的会话被丢弃
+func (a *windowAggregator) closeWindow(group *windowGroup, window *timeWindow, config *AggregateConfig) *rules.AggregateResult {
+	window.Fired = true
+	window.Pending = 0
+	if config.WindowType == windowTypeSession && window.Last.Sub(window.First) < config.SessionMinLength {
+		atomic.AddInt64(&a.sessionsDiscarded, 1)
+		return nil
+	}
+	atomic.AddInt64(&a.windowsEmitted, 1)
+	return a.buildResult(group, window, config, false, false)
+}
+
+// buildResult 由窗口的增量统计生成结果
+func (a *windowAggregator) buildResult(group *windowGroup, window *timeWindow, config *AggregateConfig, late, partial bool) *rules.AggregateResult {
+	var descriptor string
+	switch config.WindowType {
+	case windowTypeHopping:
+		descriptor = fmt.Sprintf("hopping:%s/%s", config.WindowDuration, config.WindowAdvance)
+	case windowTypeSession:
+		descriptor = fmt.Sprintf("session:%s", config.SessionGap)
+	default:
+		descriptor = fmt.Sprintf("time:%s", config.WindowDuration)
+	}
+
+	end := window.End
+	if config.WindowType == windowTypeSession {
+		// 会话结果的结束时间取最后一个事件，而不是加上不活跃间隔
+		end = window.Last
+	}
+
+	log.Debug().
+		Str("state_key", group.GroupKey).
+		Str("window", descriptor).
+		Time("window_start", window.Start).
+		Time("window_end", end).
+		Time("watermark", group.Watermark).
+		Int64("count", window.Stats.Count).
+		Int64("overflow", window.Overflow).
+		Bool("late", late).
+		Bool("partial", partial).
+		Msg("窗口结果输出")
+
+	return &rules.AggregateResult{
+		DeviceID:  group.DeviceID,
+		Key:       group.Key,
+		Window:    descriptor,
+		GroupBy:   group.GroupBy,
+		Functions: selectFunctions(window.Stats.result(config, window.NullCount), config.Functions),
+		StartTime: window.Start,
+		EndTime:   end,
+		Count:     window.Stats.Count,
+		Timestamp: end,
+		Late:      late,
+		Partial:   partial,
+	}
+}
+
+// setSink 设置定时器触发结果的接收方
+func (a *windowAggregator) setSink(sink rules.AggregateResultSink) {
+	a.sink.Store(sink)
+}
+
+// advanceProcessingTime 推进处理时间分组的水位线，关闭到期窗口并执行提前输出
+func (a *windowAggregator) advanceProcessingTime(now time.Time) {
+	sink, _ := a.sink.Load().(rules.AggregateResultSink)
+	if sink == nil {
+		return
+	}
+
+	var emissions []windowEmission
+	a.mu.Lock()
+	for _, group := range a.groups {
+		// 规则已没有窗口聚合配置的恢复分组不能输出
+		if !group.ProcessingTime || group.config == nil || len(group.Windows) == 0 {
+			continue
+		}
+		if now.After(group.Watermark) {
+			group.Watermark = now
+		}
+		// 即将关闭的窗口直接输出最终结果
+		var results []*rules.AggregateResult
+		for _, window := range group.Windows {
+			if window.End.After(group.Watermark) {
+				results = append(results, a.triggerPartial(group, window, group.config, now)...)
+			}
+		}
+		results = append(results, a.fire(group, group.config)...)
+		if len(results) > 0 {
+			emissions = append(emissions, windowEmission{
+				ruleID:  group.RuleID,
+				config:  group.config.raw,
+				point:   group.lastPoint,
+				results: results,
+			})
+		}
+	}
+	a.mu.Unlock()
+
+	for _, emission := range emissions {
+		sink(emission.ruleID, emission.config, emission.point, emission.results)
+	}
+}
+
+// cleanup 清理长时间没有数据的分组，删除前把水位线推进到窗口结束并输出未输出的窗口；
+// 无法输出（恢复后没有配置或未设置接收方）的窗口计入late_dropped
+func (a *windowAggregator) cleanup(defaultTTL time.Duration) int {
+	sink, _ := a.sink.Load().(rules.AggregateResultSink)
+
+	var emissions []windowEmission
+	a.mu.Lock()
+	now := time.Now()
+	cleaned := 0
+	for key, group := range a.groups {
+		ttl := group.TTL
+		if ttl <= 0 {
+			ttl = defaultTTL
+		}
+		if now.Sub(group.LastSeen) <= ttl {
+			continue
+		}
+
+		if sink != nil && group.config != nil {
+			if results := a.flushGroup(group, group.config); len(results) > 0 {
+				emissions = append(emissions, windowEmission{
+					ruleID:  group.RuleID,
+					config:  group.config.raw,
+					point:   group.lastPoint,
+					results: results,
+				})
+			}
+		} else {
+			for _, window := range group.Windows {
+				if !window.Fired {
+					atomic.AddInt64(&a.lateDropped, 1)
+				}
+			}
+		}
+		delete(a.groups, key)
+		cleaned++
+	}
+	a.mu.Unlock()
+
+	for _, emission := range emissions {
+		sink(emission.ruleID, emission.config, emission.point, emission.results)
+	}
+	return cleaned
+}
+
+// flushGroup 把分组水位线推进到最后一个窗口结束，关闭所有未输出的窗口
+func (a *windowAggregator) flushGroup(group *windowGroup, config *AggregateConfig) []*rules.AggregateResult {
+	for _, window := range group.Windows {
+		if window.End.After(group.Watermark) {
+			group.Watermark = window.End
+		}
+	}
+	return a.fire(group, config)
+}
+
+// stats 窗口聚合统计信息
+func (a *windowAggregator) stats() map[string]interface{} {
+	a.mu.Lock()
+	groups := len(a.groups)
+	windows := 0
+	for _, group := range a.groups {
+		windows += len(group.Windows)
+	}
+	a.mu.Unlock()
+
+	return map[string]interface{}{
+		"groups":             groups,
+		"open_windows":       windows,
+		"windows_emitted":    atomic.LoadInt64(&a.windowsEmitted),
+		"partials_emitted":   atomic.LoadInt64(&a.partialsEmitted),
+		"sessions_discarded": atomic.LoadInt64(&a.sessionsDiscarded),
+		"late_dropped":       atomic.LoadInt64(&a.lateDropped),
+		"late_side_output":   atomic.LoadInt64(&a.lateSideOutput),
+		"late_updated":       atomic.LoadInt64(&a.lateUpdated),
+		"overflow":           atomic.LoadInt64(&a.overflow),
+	}
+}
+
+// AggregateStateKind 实现rules.AggregateStateProvider
+func (a *windowAggregator) AggregateStateKind() string { return windowStateKind }
+
+// SnapshotAggregateStates 导出所有分组的水位线和未清除的窗口
+func (a *windowAggregator) SnapshotAggregateStates() []rules.AggregateCheckpoint {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	checkpoints := make([]rules.AggregateCheckpoint, 0, len(a.groups))
+	for key, group := range a.groups {
+		data, err := json.Marshal(group)
+		if err != nil {
+			log.Warn().Err(err).Str("state_key", key).Msg("序列化窗口状态失败")
+			continue
+		}
+		checkpoints = append(checkpoints, rules.AggregateCheckpoint{
+			RuleID:   group.RuleID,
+			GroupKey: key,
+			State:    data,
+		})
+	}
+	return checkpoints
+}
+
+// RestoreAggregateState 从检查点恢复分组状态，不覆盖已存在的分组。
+// 配置按规则当前的聚合动作重新解析，处理时间窗口无需等待新数据即可由定时器输出
+func (a *windowAggregator) RestoreAggregateState(cp *rules.AggregateCheckpoint) error {
+	var group windowGroup
+	if err := json.Unmarshal(cp.State, &group); err != nil {
+		return fmt.Errorf("解析窗口状态失败: %w", err)
+	}
+	if group.Windows == nil {
+		group.Windows = make(map[int64]*timeWindow)
+	}
+	now := time.Now()
+	for _, window := range group.Windows {
+		window.LastEmit = now
+		// 事件时间窗口引入时没有记录 First/Last
+		if window.First.IsZero() {
+			window.First = window.Start
+		}
+		if window.Last.IsZero() {
+			window.Last = window.Start
+		}
+		// 旧版检查点缓存原始数值，转换为增量统计并保留数值用于分位数；阈值计数在恢复时无法得到
+		legacy := &AggregateConfig{Functions: []string{"median"}, WindowSize: len(window.Values)}
+		for _, v := range window.Values {
+			window.Stats.add(v.Value, v.Timestamp, legacy)
+		}
+		window.Values = nil
+	}
+	group.RuleID = cp.RuleID
+	group.GroupKey = cp.GroupKey
+	group.LastSeen = now
+	group.config = restoredWindowConfig(cp.Rule)
+	group.lastPoint = model.Point{DeviceID: group.DeviceID, Key: group.Key, Timestamp: now}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, exists := a.groups[cp.GroupKey]; exists {
+		return nil
+	}
+	a.groups[cp.GroupKey] = &group
+	return nil
+}
+
+// restoredWindowConfig 解析规则中由窗口聚合器处理的聚合动作配置
+func restoredWindowConfig(rule *rules.Rule) *AggregateConfig {
+	if rule == nil {
+		return nil
+	}
+	handler := &AggregateHandler{}
+	for _, action := range rule.Actions {
+		if action.Type != "aggregate" {
+			continue
+		}
+		config, err := handler.parseConfig(action.Config)
+		if err != nil {
+			log.Warn().Err(err).Str("rule_id", rule.ID).Msg("解析恢复窗口的聚合配置失败")
+			continue
+		}
+		if usesWindowAggregator(config) {
+			return config
+		}
+	}
+	return nil
+}
+
+// DropAggregateStates 删除规则的所有分组状态
+func (a *windowAggregator) DropAggregateStates(ruleID string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	dropped := 0
+	for key, group := range a.groups {
+		if group.RuleID == ruleID {
+			delete(a.groups, key)
+			dropped++
+		}
+	}
+	return dropped
+}
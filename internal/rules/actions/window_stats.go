@@ -0,0 +1,242 @@
+package actions
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// defaultWindowSamples 未配置window_size时单个窗口最多缓存的原始数值数
+const defaultWindowSamples = 1000
+
+// sampleFunctions 需要窗口内原始数值才能计算的聚合函数
+var sampleFunctions = map[string]bool{
+	"median":        true,
+	"p25":           true,
+	"p50":           true,
+	"p75":           true,
+	"p90":           true,
+	"p95":           true,
+	"p99":           true,
+	"outlier_count": true,
+}
+
+// windowPercentiles 窗口结果中的分位数
+var windowPercentiles = []struct {
+	name       string
+	percentile float64
+}{{"p25", 25}, {"p50", 50}, {"p75", 75}, {"p90", 90}, {"p95", 95}, {"p99", 99}}
+
+// windowStats 窗口的增量统计，数量、和、最值、首末值按数据点累加，
+// 只有请求了中位数、分位数或异常值时才缓存原始数值
+type windowStats struct {
+	Count     int64     `json:"count"`
+	Sum       float64   `json:"sum"`
+	Mean      float64   `json:"mean"`
+	M2        float64   `json:"m2"` // 与均值之差的平方和（Welford）
+	Min       float64   `json:"min"`
+	Max       float64   `json:"max"`
+	First     float64   `json:"first"`
+	Last      float64   `json:"last"`
+	FirstTime time.Time `json:"first_time"`
+	LastTime  time.Time `json:"last_time"`
+	Above     int64     `json:"above,omitempty"`
+	Below     int64     `json:"below,omitempty"`
+	InRange   int64     `json:"in_range,omitempty"`
+	Samples   []float64 `json:"samples,omitempty"`
+}
+
+// needsSamples 聚合函数是否需要原始数值
+func needsSamples(config *AggregateConfig) bool {
+	for _, function := range config.Functions {
+		if sampleFunctions[function] {
+			return true
+		}
+	}
+	return false
+}
+
+// sampleLimit 单个窗口最多缓存的原始数值数
+func sampleLimit(config *AggregateConfig) int {
+	if config.WindowSize > 0 {
+		return config.WindowSize
+	}
+	return defaultWindowSamples
+}
+
+// add 加入一个有效数值，需要缓存原始数值但已达到上限时返回false，统计值仍包含该数值
+func (s *windowStats) add(value float64, eventTime time.Time, config *AggregateConfig) bool {
+	s.Count++
+	s.Sum += value
+	delta := value - s.Mean
+	s.Mean += delta / float64(s.Count)
+	s.M2 += delta * (value - s.Mean)
+
+	if s.Count == 1 || value < s.Min {
+		s.Min = value
+	}
+	if s.Count == 1 || value > s.Max {
+		s.Max = value
+	}
+	// 首末值按事件时间，时间相同时先到的为首值、后到的为末值
+	if s.Count == 1 || eventTime.Before(s.FirstTime) {
+		s.First, s.FirstTime = value, eventTime
+	}
+	if s.Count == 1 || !eventTime.Before(s.LastTime) {
+		s.Last, s.LastTime = value, eventTime
+	}
+
+	if config.UpperLimit != nil && value > *config.UpperLimit {
+		s.Above++
+	}
+	if config.LowerLimit != nil && value < *config.LowerLimit {
+		s.Below++
+	}
+	if config.UpperLimit != nil && config.LowerLimit != nil && value >= *config.LowerLimit && value <= *config.UpperLimit {
+		s.InRange++
+	}
+
+	if !needsSamples(config) {
+		return true
+	}
+	if len(s.Samples) >= sampleLimit(config) {
+		return false
+	}
+	s.Samples = append(s.Samples, value)
+	return true
+}
+
+// merge 合并另一个窗口的统计（会话合并），返回超过缓存上限未合并的原始数值数
+func (s *windowStats) merge(other *windowStats, config *AggregateConfig) int {
+	if other.Count == 0 {
+		return 0
+	}
+	if s.Count == 0 {
+		*s = *other
+		s.Samples = append([]float64(nil), other.Samples...)
+		return s.trimSamples(config)
+	}
+
+	n := s.Count + other.Count
+	delta := other.Mean - s.Mean
+	s.M2 += other.M2 + delta*delta*float64(s.Count)*float64(other.Count)/float64(n)
+	s.Mean += delta * float64(other.Count) / float64(n)
+	s.Count = n
+	s.Sum += other.Sum
+	s.Min = math.Min(s.Min, other.Min)
+	s.Max = math.Max(s.Max, other.Max)
+	if other.FirstTime.Before(s.FirstTime) {
+		s.First, s.FirstTime = other.First, other.FirstTime
+	}
+	if !other.LastTime.Before(s.LastTime) {
+		s.Last, s.LastTime = other.Last, other.LastTime
+	}
+	s.Above += other.Above
+	s.Below += other.Below
+	s.InRange += other.InRange
+	s.Samples = append(s.Samples, other.Samples...)
+	return s.trimSamples(config)
+}
+
+func (s *windowStats) trimSamples(config *AggregateConfig) int {
+	limit := sampleLimit(config)
+	if len(s.Samples) <= limit {
+		return 0
+	}
+	dropped := len(s.Samples) - limit
+	s.Samples = s.Samples[:limit]
+	return dropped
+}
+
+// result 计算与IncrementalStats.GetStats相同名称的统计结果，nullCount为窗口内的空值数
+func (s *windowStats) result(config *AggregateConfig, nullCount int64) map[string]float64 {
+	variance := 0.0
+	if s.Count > 1 {
+		variance = math.Max(s.M2/float64(s.Count-1), 0)
+	}
+	stddev := math.Sqrt(variance)
+	mean := 0.0
+	if s.Count > 0 {
+		mean = s.Mean
+	}
+
+	nullRate := 0.0
+	if total := s.Count + nullCount; total > 0 {
+		nullRate = float64(nullCount) / float64(total)
+	}
+	change, changeRate := 0.0, 0.0
+	if s.Count > 0 {
+		change = s.Last - s.First
+		if s.First != 0 {
+			changeRate = change / math.Abs(s.First) * 100
+		}
+	}
+	volatility := 0.0
+	if mean != 0 {
+		volatility = stddev / math.Abs(mean)
+	}
+
+	result := map[string]float64{
+		"count":        float64(s.Count),
+		"sum":          sanitizeStat(s.Sum),
+		"mean":         sanitizeStat(mean),
+		"avg":          sanitizeStat(mean),
+		"average":      sanitizeStat(mean),
+		"variance":     sanitizeStat(variance),
+		"stddev":       sanitizeStat(stddev),
+		"std":          sanitizeStat(stddev),
+		"min":          sanitizeStat(s.Min),
+		"max":          sanitizeStat(s.Max),
+		"first":        sanitizeStat(s.First),
+		"last":         sanitizeStat(s.Last),
+		"null_rate":    sanitizeStat(nullRate),
+		"completeness": sanitizeStat(1 - nullRate),
+		"change":       sanitizeStat(change),
+		"change_rate":  sanitizeStat(changeRate),
+		"volatility":   sanitizeStat(volatility),
+		"cv":           sanitizeStat(volatility),
+	}
+	if config.UpperLimit != nil {
+		result["above_count"] = float64(s.Above)
+	}
+	if config.LowerLimit != nil {
+		result["below_count"] = float64(s.Below)
+	}
+	if config.UpperLimit != nil && config.LowerLimit != nil {
+		result["in_range_count"] = float64(s.InRange)
+	}
+
+	if len(s.Samples) > 0 {
+		sorted := append([]float64(nil), s.Samples...)
+		sort.Float64s(sorted)
+		n := len(sorted)
+		median := sorted[n/2]
+		if n%2 == 0 {
+			median = (sorted[n/2-1] + sorted[n/2]) / 2
+		}
+		result["median"] = sanitizeStat(median)
+		for _, p := range windowPercentiles {
+			result[p.name] = sanitizeStat(interpolatePercentile(sorted, p.percentile/100*float64(n-1)))
+		}
+		result["outlier_count"] = outlierCount(sorted)
+	}
+	return result
+}
+
+// outlierCount 按IQR方法统计已排序数值中的异常值，与IncrementalStats一致至少需要4个数值
+func outlierCount(sorted []float64) float64 {
+	n := len(sorted)
+	if n < 4 {
+		return 0
+	}
+	q1 := interpolatePercentile(sorted, float64(n-1)*0.25)
+	q3 := interpolatePercentile(sorted, float64(n-1)*0.75)
+	iqr := q3 - q1
+	outliers := 0.0
+	for _, v := range sorted {
+		if v < q1-1.5*iqr || v > q3+1.5*iqr {
+			outliers++
+		}
+	}
+	return outliers
+}
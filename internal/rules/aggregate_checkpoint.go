@@ -0,0 +1,594 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/model"
+)
+
+// AggregateCheckpointVersion 聚合状态检查点格式版本，状态结构不兼容变化时递增，
+// 版本不一致的检查点在恢复时丢弃
+const AggregateCheckpointVersion = 1
+
+// AggregateCheckpointConfig 聚合状态检查点配置
+type AggregateCheckpointConfig struct {
+	Enabled  bool   `yaml:"enabled" json:"enabled"`
+	Backend  string `yaml:"backend" json:"backend"`   // file 或 nats_kv，默认 file
+	Dir      string `yaml:"dir" json:"dir"`           // file后端的目录
+	Bucket   string `yaml:"bucket" json:"bucket"`     // nats_kv后端的桶名
+	Interval string `yaml:"interval" json:"interval"` // 检查点间隔
+	MaxAge   string `yaml:"max_age" json:"max_age"`   // 超过该时间的检查点在恢复时丢弃
+}
+
+// AggregateCheckpoint 单个聚合状态的检查点，按规则ID加分组键保存
+type AggregateCheckpoint struct {
+	Version     int             `json:"version"`
+	Kind        string          `json:"kind"` // 状态类型，由对应的AggregateStateProvider恢复
+	RuleID      string          `json:"rule_id"`
+	GroupKey    string          `json:"group_key"`
+	Fingerprint string          `json:"fingerprint"` // 保存时规则聚合配置的指纹
+	SavedAt     time.Time       `json:"saved_at"`
+	State       json.RawMessage `json:"state"`
+
+	Rule *Rule `json:"-"` // 恢复时规则的当前定义，由检查点器填写，供组件重建配置
+}
+
+// AggregateStateProvider 持有聚合窗口状态的组件，由检查点器定期快照并在启动时恢复
+type AggregateStateProvider interface {
+	// AggregateStateKind 返回状态类型，用于把检查点交给对应的组件恢复
+	AggregateStateKind() string
+	// SnapshotAggregateStates 返回当前全部聚合状态，只需填写RuleID、GroupKey和State
+	SnapshotAggregateStates() []AggregateCheckpoint
+	// RestoreAggregateState 恢复一个聚合状态，已存在的同键状态不被覆盖
+	RestoreAggregateState(cp *AggregateCheckpoint) error
+	// DropAggregateStates 丢弃规则的全部聚合状态，返回丢弃的数量
+	DropAggregateStates(ruleID string) int
+}
+
+// AggregateStateProviderSource 包含多个状态组件的处理器（如优化聚合处理器）
+type AggregateStateProviderSource interface {
+	AggregateStateProviders() []AggregateStateProvider
+}
+
+// CheckpointStore 检查点存储后端
+type CheckpointStore interface {
+	// Save 替换规则的全部检查点
+	Save(ruleID string, checkpoints []AggregateCheckpoint) error
+	// Delete 删除规则的全部检查点
+	Delete(ruleID string) error
+	// LoadAll 读取全部检查点
+	LoadAll() ([]AggregateCheckpoint, error)
+	Close() error
+}
+
+// CheckpointStats 检查点运行统计
+type CheckpointStats struct {
+	Enabled          bool          `json:"enabled"`
+	Backend          string        `json:"backend"`
+	LastCheckpointAt time.Time     `json:"last_checkpoint_at"`
+	Lag              time.Duration `json:"lag"`
+	States           int64         `json:"states"`
+	Restored         int64         `json:"restored"`
+	Dropped          int64         `json:"dropped"`
+	Errors           int64         `json:"errors"`
+	LastError        string        `json:"last_error,omitempty"`
+}
+
+// aggregateCheckpointer 定期把聚合状态写入检查点存储，并在规则聚合配置变化时丢弃旧状态
+type aggregateCheckpointer struct {
+	backend     string
+	store       CheckpointStore
+	interval    time.Duration
+	maxAge      time.Duration
+	fingerprint func() map[string]string // 当前全部规则的聚合配置指纹
+	lookup      func(ruleID string) (*Rule, error)
+	started     time.Time
+
+	mu           sync.Mutex
+	providers    map[string]AggregateStateProvider
+	pending      map[string][]AggregateCheckpoint // 尚无组件认领的检查点，按类型
+	fingerprints map[string]string                // 状态对应的规则配置指纹
+	savedHash    map[string]string                // 每个规则上次保存内容的哈希
+
+	// 64-bit atomic fields
+	lastCheckpoint int64 // UnixNano
+	states         int64
+	restored       int64
+	dropped        int64
+	errors         int64
+	lastError      atomic.Value
+}
+
+// newAggregateCheckpointer 创建检查点器
+func newAggregateCheckpointer(cfg *AggregateCheckpointConfig, store CheckpointStore, fingerprint func() map[string]string, lookup func(ruleID string) (*Rule, error)) (*aggregateCheckpointer, error) {
+	interval := 30 * time.Second
+	if cfg.Interval != "" {
+		d, err := time.ParseDuration(cfg.Interval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("无效的检查点间隔: %s", cfg.Interval)
+		}
+		interval = d
+	}
+	maxAge := 24 * time.Hour
+	if cfg.MaxAge != "" {
+		d, err := time.ParseDuration(cfg.MaxAge)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("无效的检查点最大保留时间: %s", cfg.MaxAge)
+		}
+		maxAge = d
+	}
+	backend := cfg.Backend
+	if backend == "" {
+		backend = "file"
+	}
+	return &aggregateCheckpointer{
+		backend:      backend,
+		store:        store,
+		interval:     interval,
+		maxAge:       maxAge,
+		fingerprint:  fingerprint,
+		lookup:       lookup,
+		started:      time.Now(),
+		providers:    make(map[string]AggregateStateProvider),
+		pending:      make(map[string][]AggregateCheckpoint),
+		fingerprints: make(map[string]string),
+		savedHash:    make(map[string]string),
+	}, nil
+}
+
+// aggregateFingerprint 计算规则聚合配置的指纹，规则没有聚合动作时返回空字符串
+func aggregateFingerprint(rule *Rule) string {
+	var configs []map[string]interface{}
+	for _, action := range rule.Actions {
+		if action.Type == "aggregate" {
+			configs = append(configs, action.Config)
+		}
+	}
+	if len(configs) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(configs)
+	if err != nil {
+		// YAML解析可能产生JSON无法序列化的映射，fmt按键排序输出，同样稳定
+		data = []byte(fmt.Sprintf("%v", configs))
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Register 注册状态组件，并恢复该类型尚未认领的检查点
+func (c *aggregateCheckpointer) Register(provider AggregateStateProvider) {
+	kind := provider.AggregateStateKind()
+
+	c.mu.Lock()
+	c.providers[kind] = provider
+	pending := c.pending[kind]
+	delete(c.pending, kind)
+	c.mu.Unlock()
+
+	restored := 0
+	for i := range pending {
+		if err := provider.RestoreAggregateState(&pending[i]); err != nil {
+			log.Warn().Err(err).
+				Str("rule_id", pending[i].RuleID).
+				Str("group_key", pending[i].GroupKey).
+				Str("kind", kind).
+				Msg("恢复聚合状态失败，丢弃该检查点")
+			continue
+		}
+		restored++
+	}
+	if restored > 0 {
+		atomic.AddInt64(&c.restored, int64(restored))
+		log.Info().Str("kind", kind).Int("restored", restored).Msg("已恢复聚合状态检查点")
+	}
+}
+
+// Restore 读取检查点，丢弃版本不符、过期或规则聚合配置已变化的状态，其余交给组件恢复。
+// 应在注册组件之前调用，之后注册的组件在Register时恢复
+func (c *aggregateCheckpointer) Restore() error {
+	checkpoints, err := c.store.LoadAll()
+	if err != nil {
+		return fmt.Errorf("读取聚合状态检查点失败: %w", err)
+	}
+
+	current := c.fingerprint()
+	now := time.Now()
+	var kept, discarded int
+	stale := make(map[string]bool)
+	keptRules := make(map[string]bool)
+
+	c.mu.Lock()
+	for _, cp := range checkpoints {
+		fp, ok := current[cp.RuleID]
+		switch {
+		case cp.Version != AggregateCheckpointVersion:
+			log.Warn().Str("rule_id", cp.RuleID).Int("version", cp.Version).Msg("聚合状态检查点版本不兼容，已丢弃")
+		case !ok || fp == "":
+			log.Info().Str("rule_id", cp.RuleID).Msg("规则已删除或不再包含聚合动作，丢弃聚合状态检查点")
+		case fp != cp.Fingerprint:
+			log.Info().Str("rule_id", cp.RuleID).Msg("规则聚合配置已变化，丢弃聚合状态检查点")
+		case now.Sub(cp.SavedAt) > c.maxAge:
+			log.Info().Str("rule_id", cp.RuleID).Time("saved_at", cp.SavedAt).Msg("聚合状态检查点已过期，已丢弃")
+		default:
+			if rule, err := c.lookup(cp.RuleID); err == nil {
+				cp.Rule = rule
+			}
+			c.pending[cp.Kind] = append(c.pending[cp.Kind], cp)
+			keptRules[cp.RuleID] = true
+			kept++
+			continue
+		}
+		stale[cp.RuleID] = true
+		discarded++
+	}
+	// 记录全部规则当前的指纹，之后据此判断规则更新是否改变了聚合配置
+	for ruleID, fp := range current {
+		if fp != "" {
+			c.fingerprints[ruleID] = fp
+		}
+	}
+	c.mu.Unlock()
+
+	// 规则的检查点是整体替换的，部分条目被丢弃时下一次检查点会重写该规则，
+	// 全部条目都被丢弃的规则在这里删除
+	for ruleID := range stale {
+		if keptRules[ruleID] {
+			continue
+		}
+		if err := c.store.Delete(ruleID); err != nil {
+			c.recordError(err)
+		}
+	}
+	atomic.AddInt64(&c.dropped, int64(discarded))
+
+	log.Info().
+		Int("loaded", len(checkpoints)).
+		Int("kept", kept).
+		Int("discarded", discarded).
+		Msg("聚合状态检查点加载完成")
+	return nil
+}
+
+// RuleChanged 规则更新或删除时调用，聚合配置变化则丢弃该规则的全部状态和检查点
+func (c *aggregateCheckpointer) RuleChanged(rule *Rule, deleted bool) {
+	fp := ""
+	if !deleted {
+		fp = aggregateFingerprint(rule)
+	}
+
+	c.mu.Lock()
+	old, known := c.fingerprints[rule.ID]
+	c.mu.Unlock()
+	if known && old == fp {
+		return
+	}
+	c.dropRule(rule.ID)
+	if fp != "" {
+		c.mu.Lock()
+		c.fingerprints[rule.ID] = fp
+		c.mu.Unlock()
+	}
+}
+
+// dropRule 丢弃规则在所有组件、未认领检查点和存储中的聚合状态
+func (c *aggregateCheckpointer) dropRule(ruleID string) {
+	c.mu.Lock()
+	providers := make([]AggregateStateProvider, 0, len(c.providers))
+	for _, p := range c.providers {
+		providers = append(providers, p)
+	}
+	dropped := 0
+	for kind, list := range c.pending {
+		kept := list[:0]
+		for _, cp := range list {
+			if cp.RuleID == ruleID {
+				dropped++
+				continue
+			}
+			kept = append(kept, cp)
+		}
+		c.pending[kind] = kept
+	}
+	delete(c.fingerprints, ruleID)
+	_, saved := c.savedHash[ruleID]
+	delete(c.savedHash, ruleID)
+	c.mu.Unlock()
+
+	for _, p := range providers {
+		dropped += p.DropAggregateStates(ruleID)
+	}
+	if saved {
+		if err := c.store.Delete(ruleID); err != nil {
+			c.recordError(err)
+		}
+	}
+	atomic.AddInt64(&c.dropped, int64(dropped))
+	if dropped > 0 || saved {
+		log.Info().Str("rule_id", ruleID).Int("dropped", dropped).Msg("规则聚合配置已变化，丢弃聚合状态")
+	}
+}
+
+// Run 定期写检查点，直到ctx结束
+func (c *aggregateCheckpointer) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Checkpoint(); err != nil {
+				log.Error().Err(err).Msg("写入聚合状态检查点失败")
+			}
+		}
+	}
+}
+
+// Checkpoint 写一次检查点，内容未变化的规则跳过
+func (c *aggregateCheckpointer) Checkpoint() error {
+	current := c.fingerprint()
+
+	// 没有收到规则变更事件时（如热加载被禁用），在这里发现配置变化
+	c.mu.Lock()
+	var changed []string
+	for ruleID, fp := range c.fingerprints {
+		if current[ruleID] != fp {
+			changed = append(changed, ruleID)
+		}
+	}
+	c.mu.Unlock()
+	for _, ruleID := range changed {
+		c.dropRule(ruleID)
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	byRule := make(map[string][]AggregateCheckpoint)
+	for kind, list := range c.pending {
+		// 未认领的检查点保留原保存时间，超过最大保留时间后丢弃
+		kept := list[:0]
+		for _, cp := range list {
+			if now.Sub(cp.SavedAt) > c.maxAge {
+				atomic.AddInt64(&c.dropped, 1)
+				continue
+			}
+			kept = append(kept, cp)
+			byRule[cp.RuleID] = append(byRule[cp.RuleID], cp)
+		}
+		c.pending[kind] = kept
+	}
+	providers := make([]AggregateStateProvider, 0, len(c.providers))
+	for _, p := range c.providers {
+		providers = append(providers, p)
+	}
+	c.mu.Unlock()
+
+	for _, p := range providers {
+		kind := p.AggregateStateKind()
+		for _, cp := range p.SnapshotAggregateStates() {
+			cp.Version = AggregateCheckpointVersion
+			cp.Kind = kind
+			cp.SavedAt = now
+			byRule[cp.RuleID] = append(byRule[cp.RuleID], cp)
+		}
+	}
+
+	var firstErr error
+	var total int64
+	for ruleID, list := range byRule {
+		fp := current[ruleID]
+		if fp == "" {
+			// 规则已删除或没有聚合动作，状态会被组件的过期清理回收
+			continue
+		}
+		for i := range list {
+			list[i].Fingerprint = fp
+		}
+		total += int64(len(list))
+
+		hash := checkpointHash(list)
+		c.mu.Lock()
+		c.fingerprints[ruleID] = fp
+		unchanged := c.savedHash[ruleID] == hash
+		c.mu.Unlock()
+		if unchanged {
+			continue
+		}
+
+		if err := c.store.Save(ruleID, list); err != nil {
+			c.recordError(err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("保存规则 %s 的聚合状态失败: %w", ruleID, err)
+			}
+			continue
+		}
+		c.mu.Lock()
+		c.savedHash[ruleID] = hash
+		c.mu.Unlock()
+	}
+
+	// 状态已全部过期的规则删除其检查点
+	c.mu.Lock()
+	var removed []string
+	for ruleID := range c.savedHash {
+		if _, ok := byRule[ruleID]; !ok {
+			removed = append(removed, ruleID)
+			delete(c.savedHash, ruleID)
+		}
+	}
+	c.mu.Unlock()
+	for _, ruleID := range removed {
+		if err := c.store.Delete(ruleID); err != nil {
+			c.recordError(err)
+		}
+	}
+
+	atomic.StoreInt64(&c.states, total)
+	if firstErr == nil {
+		atomic.StoreInt64(&c.lastCheckpoint, now.UnixNano())
+	}
+	return firstErr
+}
+
+// checkpointHash 计算检查点内容的哈希（不含保存时间），用于跳过未变化的规则
+func checkpointHash(list []AggregateCheckpoint) string {
+	sorted := make([]AggregateCheckpoint, len(list))
+	copy(sorted, list)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Kind != sorted[j].Kind {
+			return sorted[i].Kind < sorted[j].Kind
+		}
+		return sorted[i].GroupKey < sorted[j].GroupKey
+	})
+
+	h := sha256.New()
+	for _, cp := range sorted {
+		h.Write([]byte(cp.Kind))
+		h.Write([]byte{0})
+		h.Write([]byte(cp.GroupKey))
+		h.Write([]byte{0})
+		h.Write([]byte(cp.Fingerprint))
+		h.Write([]byte{0})
+		h.Write(bytes.TrimSpace(cp.State))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *aggregateCheckpointer) recordError(err error) {
+	atomic.AddInt64(&c.errors, 1)
+	c.lastError.Store(err.Error())
+}
+
+// Stats 返回检查点统计，Lag为距上次成功检查点的时间
+func (c *aggregateCheckpointer) Stats() CheckpointStats {
+	stats := CheckpointStats{
+		Enabled:  true,
+		Backend:  c.backend,
+		States:   atomic.LoadInt64(&c.states),
+		Restored: atomic.LoadInt64(&c.restored),
+		Dropped:  atomic.LoadInt64(&c.dropped),
+		Errors:   atomic.LoadInt64(&c.errors),
+	}
+	// 尚未成功写过检查点时从启动时间算起
+	since := c.started
+	if last := atomic.LoadInt64(&c.lastCheckpoint); last > 0 {
+		stats.LastCheckpointAt = time.Unix(0, last)
+		since = stats.LastCheckpointAt
+	}
+	stats.Lag = time.Since(since)
+	if v, ok := c.lastError.Load().(string); ok {
+		stats.LastError = v
+	}
+	return stats
+}
+
+// Close 写最后一次检查点并关闭存储
+func (c *aggregateCheckpointer) Close() {
+	if err := c.Checkpoint(); err != nil {
+		log.Error().Err(err).Msg("关闭前写入聚合状态检查点失败")
+	}
+	if err := c.store.Close(); err != nil {
+		log.Warn().Err(err).Msg("关闭聚合状态检查点存储失败")
+	}
+}
+
+// bufferAggregateState 内置聚合动作的窗口缓冲状态
+type bufferAggregateState struct {
+	WindowSize int           `json:"window_size"`
+	GroupKey   string        `json:"group_key,omitempty"`
+	Buffer     []model.Point `json:"buffer"`
+}
+
+// bufferAggregateProvider 内置聚合动作（executeLegacyAggregateAction）的状态组件
+type bufferAggregateProvider struct {
+	s *RuleEngineService
+}
+
+func (p bufferAggregateProvider) AggregateStateKind() string { return "buffer" }
+
+func (p bufferAggregateProvider) SnapshotAggregateStates() []AggregateCheckpoint {
+	var states map[string]AggregateState
+	if p.s.useShardedAggregates {
+		states = p.s.shardedAggregates.SnapshotStates()
+	} else {
+		p.s.aggregateMutex.RLock()
+		states = make(map[string]AggregateState, len(p.s.aggregateStates))
+		for key, state := range p.s.aggregateStates {
+			if len(state.Buffer) == 0 {
+				continue
+			}
+			snapshot := *state
+			snapshot.Buffer = append([]model.Point(nil), state.Buffer...)
+			states[key] = snapshot
+		}
+		p.s.aggregateMutex.RUnlock()
+	}
+
+	checkpoints := make([]AggregateCheckpoint, 0, len(states))
+	for key, state := range states {
+		data, err := json.Marshal(bufferAggregateState{
+			WindowSize: state.WindowSize,
+			GroupKey:   state.GroupKey,
+			Buffer:     state.Buffer,
+		})
+		if err != nil {
+			log.Warn().Err(err).Str("state_key", key).Msg("序列化聚合状态失败")
+			continue
+		}
+		checkpoints = append(checkpoints, AggregateCheckpoint{RuleID: state.RuleID, GroupKey: key, State: data})
+	}
+	return checkpoints
+}
+
+func (p bufferAggregateProvider) RestoreAggregateState(cp *AggregateCheckpoint) error {
+	var saved bufferAggregateState
+	if err := json.Unmarshal(cp.State, &saved); err != nil {
+		return err
+	}
+	state := &AggregateState{
+		RuleID:     cp.RuleID,
+		Buffer:     saved.Buffer,
+		GroupKey:   saved.GroupKey,
+		WindowSize: saved.WindowSize,
+		LastUpdate: time.Now(),
+	}
+	if p.s.useShardedAggregates {
+		p.s.shardedAggregates.RestoreState(cp.GroupKey, state)
+		return nil
+	}
+	p.s.aggregateMutex.Lock()
+	if _, exists := p.s.aggregateStates[cp.GroupKey]; !exists {
+		p.s.aggregateStates[cp.GroupKey] = state
+	}
+	p.s.aggregateMutex.Unlock()
+	return nil
+}
+
+func (p bufferAggregateProvider) DropAggregateStates(ruleID string) int {
+	if p.s.useShardedAggregates {
+		return p.s.shardedAggregates.DropRuleStates(ruleID)
+	}
+	p.s.aggregateMutex.Lock()
+	defer p.s.aggregateMutex.Unlock()
+	dropped := 0
+	for key, state := range p.s.aggregateStates {
+		if state.RuleID == ruleID {
+			delete(p.s.aggregateStates, key)
+			dropped++
+		}
+	}
+	return dropped
+}
@@ -0,0 +1,437 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/y001j/iot-gateway/internal/model"
+)
+
+// 报警状态，参照ISA-18.2
+const (
+	AlarmStateNormal   = "normal"   // 正常
+	AlarmStatePending  = "pending"  // 已越限，等待on_delay
+	AlarmStateActive   = "active"   // 报警中
+	AlarmStateClearing = "clearing" // 已回到恢复阈值内，等待off_delay
+	AlarmStateLatched  = "latched"  // 已恢复但处于锁存，等待人工复位
+)
+
+// 报警转换事件
+const (
+	AlarmEventRaise = "raise"
+	AlarmEventClear = "clear"
+)
+
+// AlarmCondition 有状态报警条件，按设备和key跟踪报警状态，只在报警产生和恢复时满足
+type AlarmCondition struct {
+	Field     string   `json:"field,omitempty" yaml:"field,omitempty"`         // 比较字段，默认value
+	Direction string   `json:"direction,omitempty" yaml:"direction,omitempty"` // high（默认）：不低于raise时报警；low：不高于raise时报警
+	Raise     *float64 `json:"raise" yaml:"raise"`                             // 报警阈值
+	Clear     *float64 `json:"clear,omitempty" yaml:"clear,omitempty"`         // 恢复阈值，与raise之间为死区，默认等于raise
+	OnDelay   string   `json:"on_delay,omitempty" yaml:"on_delay,omitempty"`   // 持续越限该时间后才报警
+	OffDelay  string   `json:"off_delay,omitempty" yaml:"off_delay,omitempty"` // 持续恢复该时间后才解除
+	Latch     bool     `json:"latch,omitempty" yaml:"latch,omitempty"`         // 锁存：恢复后保持报警直到人工复位
+}
+
+// AlarmEvent 报警产生或恢复事件，通过context传给动作
+type AlarmEvent struct {
+	RuleID    string      `json:"rule_id"`
+	DeviceID  string      `json:"device_id"`
+	Key       string      `json:"key"`
+	Event     string      `json:"event"` // raise 或 clear
+	State     string      `json:"state"` // 转换后的状态
+	Value     interface{} `json:"value"`
+	Threshold float64     `json:"threshold"` // 触发本次转换的阈值
+	RaisedAt  time.Time   `json:"raised_at"`
+	Timestamp time.Time   `json:"timestamp"`
+	Manual    bool        `json:"manual,omitempty"` // 人工复位产生的恢复事件
+}
+
+// AlarmStatus 报警状态快照，供规则API查询
+type AlarmStatus struct {
+	RuleID     string      `json:"rule_id"`
+	DeviceID   string      `json:"device_id"`
+	Key        string      `json:"key"`
+	State      string      `json:"state"`
+	Value      interface{} `json:"value"`
+	Since      time.Time   `json:"since"` // 进入当前状态的时间
+	RaisedAt   time.Time   `json:"raised_at,omitempty"`
+	LastUpdate time.Time   `json:"last_update"`
+}
+
+type alarmEventKey struct{}
+
+// WithAlarmEvent 把报警事件放入动作执行的context
+func WithAlarmEvent(ctx context.Context, event *AlarmEvent) context.Context {
+	if event == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, alarmEventKey{}, event)
+}
+
+// AlarmEventFromContext 获取触发本次动作的报警事件，非报警规则返回nil
+func AlarmEventFromContext(ctx context.Context) *AlarmEvent {
+	if ctx == nil {
+		return nil
+	}
+	event, _ := ctx.Value(alarmEventKey{}).(*AlarmEvent)
+	return event
+}
+
+// validateAlarm 验证报警条件
+func validateAlarm(alarm *AlarmCondition) error {
+	if alarm == nil {
+		return fmt.Errorf("报警条件必须指定alarm")
+	}
+	_, err := compileAlarm(alarm)
+	return err
+}
+
+// alarmPoint 单个设备+key的报警状态
+type alarmPoint struct {
+	state      string
+	since      time.Time
+	raisedAt   time.Time
+	lastUpdate time.Time
+	point      model.Point
+}
+
+// alarmTracker 单个规则中一个报警条件的状态，按设备和key区分
+type alarmTracker struct {
+	field    string
+	low      bool
+	raise    float64
+	clear    float64
+	onDelay  time.Duration
+	offDelay time.Duration
+	latch    bool
+	points   map[string]*alarmPoint
+	mu       sync.Mutex
+}
+
+// compileAlarm 解析报警条件
+func compileAlarm(alarm *AlarmCondition) (*alarmTracker, error) {
+	if alarm.Raise == nil {
+		return nil, fmt.Errorf("报警条件必须指定raise阈值")
+	}
+	t := &alarmTracker{
+		field:  alarm.Field,
+		raise:  *alarm.Raise,
+		clear:  *alarm.Raise,
+		latch:  alarm.Latch,
+		points: make(map[string]*alarmPoint),
+	}
+	if t.field == "" {
+		t.field = "value"
+	}
+	switch alarm.Direction {
+	case "", "high":
+	case "low":
+		t.low = true
+	default:
+		return nil, fmt.Errorf("不支持的报警方向: %s，可选high或low", alarm.Direction)
+	}
+	if alarm.Clear != nil {
+		t.clear = *alarm.Clear
+		if !t.low && t.clear > t.raise {
+			return nil, fmt.Errorf("高报警的clear阈值(%v)不能高于raise阈值(%v)", t.clear, t.raise)
+		}
+		if t.low && t.clear < t.raise {
+			return nil, fmt.Errorf("低报警的clear阈值(%v)不能低于raise阈值(%v)", t.clear, t.raise)
+		}
+	}
+	if alarm.OnDelay != "" {
+		d, err := time.ParseDuration(alarm.OnDelay)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("无效的on_delay: %s", alarm.OnDelay)
+		}
+		t.onDelay = d
+	}
+	if alarm.OffDelay != "" {
+		d, err := time.ParseDuration(alarm.OffDelay)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("无效的off_delay: %s", alarm.OffDelay)
+		}
+		t.offDelay = d
+	}
+	return t, nil
+}
+
+// abnormal 是否越过报警阈值
+func (t *alarmTracker) abnormal(v float64) bool {
+	if t.low {
+		return v <= t.raise
+	}
+	return v >= t.raise
+}
+
+// cleared 是否回到恢复阈值以内
+func (t *alarmTracker) cleared(v float64) bool {
+	if t.low {
+		return v > t.clear
+	}
+	return v < t.clear
+}
+
+// update 用新值推进状态机，发生报警或恢复时返回事件
+func (t *alarmTracker) update(ruleID string, point model.Point, v float64) *AlarmEvent {
+	now := point.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	id := point.DeviceID + "/" + point.Key
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ap, ok := t.points[id]
+	if !ok {
+		ap = &alarmPoint{state: AlarmStateNormal, since: now}
+		t.points[id] = ap
+	}
+	ap.point = point
+	ap.lastUpdate = now
+
+	enter := func(state string) {
+		ap.state = state
+		ap.since = now
+	}
+
+	switch ap.state {
+	case AlarmStateNormal, AlarmStatePending:
+		if !t.abnormal(v) {
+			if ap.state == AlarmStatePending {
+				enter(AlarmStateNormal)
+			}
+			return nil
+		}
+		if ap.state == AlarmStateNormal {
+			enter(AlarmStatePending)
+		}
+		if now.Sub(ap.since) < t.onDelay {
+			return nil
+		}
+		enter(AlarmStateActive)
+		ap.raisedAt = now
+		return t.event(ruleID, ap, AlarmEventRaise, t.raise)
+
+	case AlarmStateActive, AlarmStateClearing:
+		if !t.cleared(v) {
+			if ap.state == AlarmStateClearing {
+				enter(AlarmStateActive)
+			}
+			return nil
+		}
+		if ap.state == AlarmStateActive {
+			enter(AlarmStateClearing)
+		}
+		if now.Sub(ap.since) < t.offDelay {
+			return nil
+		}
+		if t.latch {
+			enter(AlarmStateLatched)
+			return nil
+		}
+		enter(AlarmStateNormal)
+		return t.event(ruleID, ap, AlarmEventClear, t.clear)
+
+	case AlarmStateLatched:
+		// 锁存期间再次越限，回到报警中，报警已通知过不再重复
+		if t.abnormal(v) {
+			enter(AlarmStateActive)
+		}
+	}
+	return nil
+}
+
+// AlarmTransition 定时器推进的报警转换，Point为该报警最后的数据点
+type AlarmTransition struct {
+	Event *AlarmEvent
+	Point model.Point
+}
+
+// expire 推进on_delay或off_delay已到期的报警。延时期间没有新数据时值保持不变，
+// 转换时间为进入等待状态的时间加上延时
+func (t *alarmTracker) expire(ruleID string, now time.Time) []AlarmTransition {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var transitions []AlarmTransition
+	for _, ap := range t.points {
+		switch ap.state {
+		case AlarmStatePending:
+			at := ap.since.Add(t.onDelay)
+			if now.Before(at) {
+				continue
+			}
+			ap.state, ap.since = AlarmStateActive, at
+			ap.raisedAt = at
+			transitions = append(transitions, AlarmTransition{Event: t.event(ruleID, ap, AlarmEventRaise, t.raise), Point: ap.point})
+		case AlarmStateClearing:
+			at := ap.since.Add(t.offDelay)
+			if now.Before(at) {
+				continue
+			}
+			if t.latch {
+				ap.state, ap.since = AlarmStateLatched, at
+				continue
+			}
+			ap.state, ap.since = AlarmStateNormal, at
+			transitions = append(transitions, AlarmTransition{Event: t.event(ruleID, ap, AlarmEventClear, t.clear), Point: ap.point})
+		}
+	}
+	return transitions
+}
+
+// reset 人工复位处于锁存的报警
+func (t *alarmTracker) reset(ruleID, deviceID, key string) (*AlarmEvent, model.Point, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ap, ok := t.points[deviceID+"/"+key]
+	if !ok || ap.state != AlarmStateLatched {
+		state := AlarmStateNormal
+		if ok {
+			state = ap.state
+		}
+		return nil, model.Point{}, fmt.Errorf("报警状态为%s，只有锁存的报警可以复位", state)
+	}
+	ap.state = AlarmStateNormal
+	ap.since = time.Now()
+	event := t.event(ruleID, ap, AlarmEventClear, t.clear)
+	event.Timestamp = ap.since
+	event.Manual = true
+	return event, ap.point, nil
+}
+
+// event 生成报警事件，调用方持有锁
+func (t *alarmTracker) event(ruleID string, ap *alarmPoint, kind string, threshold float64) *AlarmEvent {
+	return &AlarmEvent{
+		RuleID:    ruleID,
+		DeviceID:  ap.point.DeviceID,
+		Key:       ap.point.Key,
+		Event:     kind,
+		State:     ap.state,
+		Value:     ap.point.Value,
+		Threshold: threshold,
+		RaisedAt:  ap.raisedAt,
+		Timestamp: ap.since,
+	}
+}
+
+// statuses 当前全部报警状态
+func (t *alarmTracker) statuses(ruleID string) []AlarmStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make([]AlarmStatus, 0, len(t.points))
+	for _, ap := range t.points {
+		result = append(result, AlarmStatus{
+			RuleID:     ruleID,
+			DeviceID:   ap.point.DeviceID,
+			Key:        ap.point.Key,
+			State:      ap.state,
+			Value:      ap.point.Value,
+			Since:      ap.since,
+			RaisedAt:   ap.raisedAt,
+			LastUpdate: ap.lastUpdate,
+		})
+	}
+	return result
+}
+
+// evaluateAlarm 评估报警条件，只在报警产生或恢复时返回true
+func (e *Evaluator) evaluateAlarm(condition *Condition, point model.Point, ec *evalContext) (bool, error) {
+	if condition.Alarm == nil {
+		return false, fmt.Errorf("alarm类型条件缺少alarm字段定义")
+	}
+	if ec == nil || ec.rule == nil {
+		return false, fmt.Errorf("报警条件只能在规则中评估")
+	}
+
+	state, err := e.states.state(ec.rule.ID, ec.rule.Conditions, condition.Alarm, func() (interface{}, error) {
+		return compileAlarm(condition.Alarm)
+	})
+	if err != nil {
+		return false, err
+	}
+	tracker := state.(*alarmTracker)
+
+	value, err := e.getFieldValue(tracker.field, point)
+	if err != nil {
+		return false, err
+	}
+	num, ok := toFloat64(value)
+	if !ok {
+		// 非数值数据不参与报警判断
+		return false, nil
+	}
+
+	event := tracker.update(ec.rule.ID, point, num)
+	if event == nil {
+		return false, nil
+	}
+	if ec.match.Alarm == nil {
+		ec.match.Alarm = event
+	}
+	return true, nil
+}
+
+// AlarmStates 获取规则中报警条件的当前状态，按设备和key排序
+func (e *Evaluator) AlarmStates(ruleID string) []AlarmStatus {
+	var result []AlarmStatus
+	for _, state := range e.states.ruleStates(ruleID) {
+		if tracker, ok := state.(*alarmTracker); ok {
+			result = append(result, tracker.statuses(ruleID)...)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].DeviceID != result[j].DeviceID {
+			return result[i].DeviceID < result[j].DeviceID
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+// ExpireAlarms 推进全部规则中延时已到期的报警，返回产生的报警和恢复事件
+func (e *Evaluator) ExpireAlarms(now time.Time) []AlarmTransition {
+	var result []AlarmTransition
+	for ruleID, states := range e.states.snapshot() {
+		for _, state := range states {
+			if tracker, ok := state.(*alarmTracker); ok {
+				result = append(result, tracker.expire(ruleID, now)...)
+			}
+		}
+	}
+	return result
+}
+
+// ResetAlarm 人工复位规则中锁存的报警，返回恢复事件和该报警最后的数据点
+func (e *Evaluator) ResetAlarm(ruleID, deviceID, key string) (*AlarmEvent, model.Point, error) {
+	var lastErr error
+	for _, state := range e.states.ruleStates(ruleID) {
+		tracker, ok := state.(*alarmTracker)
+		if !ok {
+			continue
+		}
+		event, point, err := tracker.reset(ruleID, deviceID, key)
+		if err == nil {
+			return event, point, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("规则%s没有报警状态", ruleID)
+	}
+	return nil, model.Point{}, lastErr
+}
+
+// AlarmStateProvider 报警状态查询和人工复位，由规则引擎服务实现
+type AlarmStateProvider interface {
+	GetAlarmStates(ruleID string) ([]AlarmStatus, error)
+	ResetAlarm(ruleID, deviceID, key string) ([]AlarmEvent, error)
+}
@@ -0,0 +1,218 @@
+package rules
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+)
+
+// newCheckpointStore 按配置创建检查点存储
+func newCheckpointStore(cfg *AggregateCheckpointConfig, js nats.JetStreamContext) (CheckpointStore, error) {
+	switch cfg.Backend {
+	case "", "file":
+		dir := cfg.Dir
+		if dir == "" {
+			dir = "./data/rule_state"
+		}
+		return newFileCheckpointStore(dir)
+	case "nats_kv", "kv":
+		if js == nil {
+			return nil, fmt.Errorf("nats_kv检查点后端需要JetStream")
+		}
+		bucket := cfg.Bucket
+		if bucket == "" {
+			bucket = "rule_aggregate_state"
+		}
+		return newKVCheckpointStore(js, bucket)
+	default:
+		return nil, fmt.Errorf("不支持的检查点后端: %s", cfg.Backend)
+	}
+}
+
+// checkpointToken 把规则ID、分组键编码为文件名和KV键可用的字符
+func checkpointToken(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// fileCheckpointStore 本地文件检查点存储，每个规则一个JSON文件，先写临时文件再改名
+type fileCheckpointStore struct {
+	dir string
+}
+
+func newFileCheckpointStore(dir string) (*fileCheckpointStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建检查点目录失败: %w", err)
+	}
+	return &fileCheckpointStore{dir: dir}, nil
+}
+
+func (s *fileCheckpointStore) path(ruleID string) string {
+	return filepath.Join(s.dir, checkpointToken(ruleID)+".json")
+}
+
+func (s *fileCheckpointStore) Save(ruleID string, checkpoints []AggregateCheckpoint) error {
+	data, err := json.Marshal(checkpoints)
+	if err != nil {
+		return err
+	}
+	path := s.path(ruleID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *fileCheckpointStore) Delete(ruleID string) error {
+	if err := os.Remove(s.path(ruleID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *fileCheckpointStore) LoadAll() ([]AggregateCheckpoint, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var all []AggregateCheckpoint
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(s.dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var checkpoints []AggregateCheckpoint
+		if err := json.Unmarshal(data, &checkpoints); err != nil {
+			// 损坏的文件不影响其他规则的恢复
+			log.Warn().Err(err).Str("file", path).Msg("聚合状态检查点文件损坏，已删除")
+			os.Remove(path)
+			continue
+		}
+		all = append(all, checkpoints...)
+	}
+	return all, nil
+}
+
+func (s *fileCheckpointStore) Close() error { return nil }
+
+// kvCheckpointStore NATS KV检查点存储，键为 <规则ID>.<状态类型>.<分组键>
+type kvCheckpointStore struct {
+	kv nats.KeyValue
+
+	mu   sync.Mutex
+	keys map[string]map[string]struct{} // 每个规则已写入的键
+}
+
+func newKVCheckpointStore(js nats.JetStreamContext, bucket string) (*kvCheckpointStore, error) {
+	kv, err := js.KeyValue(bucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      bucket,
+			Description: "规则引擎聚合状态检查点",
+			History:     1,
+			Storage:     nats.FileStorage,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("打开KV桶 %s 失败: %w", bucket, err)
+	}
+	return &kvCheckpointStore{kv: kv, keys: make(map[string]map[string]struct{})}, nil
+}
+
+func kvCheckpointKey(cp *AggregateCheckpoint) string {
+	return checkpointToken(cp.RuleID) + "." + cp.Kind + "." + checkpointToken(cp.GroupKey)
+}
+
+func (s *kvCheckpointStore) Save(ruleID string, checkpoints []AggregateCheckpoint) error {
+	written := make(map[string]struct{}, len(checkpoints))
+	for i := range checkpoints {
+		data, err := json.Marshal(&checkpoints[i])
+		if err != nil {
+			return err
+		}
+		key := kvCheckpointKey(&checkpoints[i])
+		if _, err := s.kv.Put(key, data); err != nil {
+			return err
+		}
+		written[key] = struct{}{}
+	}
+
+	s.mu.Lock()
+	previous := s.keys[ruleID]
+	s.keys[ruleID] = written
+	s.mu.Unlock()
+
+	// 清除已不存在的分组
+	for key := range previous {
+		if _, ok := written[key]; ok {
+			continue
+		}
+		if err := s.kv.Purge(key); err != nil && !errors.Is(err, nats.ErrKeyNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *kvCheckpointStore) Delete(ruleID string) error {
+	s.mu.Lock()
+	keys := s.keys[ruleID]
+	delete(s.keys, ruleID)
+	s.mu.Unlock()
+
+	for key := range keys {
+		if err := s.kv.Purge(key); err != nil && !errors.Is(err, nats.ErrKeyNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *kvCheckpointStore) LoadAll() ([]AggregateCheckpoint, error) {
+	keys, err := s.kv.Keys()
+	if errors.Is(err, nats.ErrNoKeysFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var all []AggregateCheckpoint
+	for _, key := range keys {
+		entry, err := s.kv.Get(key)
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var cp AggregateCheckpoint
+		if err := json.Unmarshal(entry.Value(), &cp); err != nil {
+			log.Warn().Err(err).Str("key", key).Msg("聚合状态检查点损坏，已删除")
+			s.kv.Purge(key)
+			continue
+		}
+		s.mu.Lock()
+		if s.keys[cp.RuleID] == nil {
+			s.keys[cp.RuleID] = make(map[string]struct{})
+		}
+		s.keys[cp.RuleID][key] = struct{}{}
+		s.mu.Unlock()
+		all = append(all, cp)
+	}
+	return all, nil
+}
+
+func (s *kvCheckpointStore) Close() error { return nil }
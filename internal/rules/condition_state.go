@@ -0,0 +1,96 @@
+package rules
+
+import (
+	"context"
+	"sync"
+)
+
+// ruleConditionStates 一个规则中有状态条件的状态，root为创建时规则的条件树
+type ruleConditionStates struct {
+	root   *Condition
+	states map[interface{}]interface{} // 键为条件配置指针，如*SequenceCondition、*AlarmCondition
+}
+
+// conditionStateStore 按规则保存有状态条件（序列、报警）的状态。
+// 状态与规则的条件树绑定，规则更新后条件树变化，旧状态随之丢弃
+type conditionStateStore struct {
+	rules map[string]*ruleConditionStates
+	mu    sync.Mutex
+}
+
+func newConditionStateStore() *conditionStateStore {
+	return &conditionStateStore{rules: make(map[string]*ruleConditionStates)}
+}
+
+// state 获取规则中某个条件的状态，不存在时调用create创建
+func (s *conditionStateStore) state(ruleID string, root *Condition, key interface{}, create func() (interface{}, error)) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rule := s.rules[ruleID]
+	if rule == nil || rule.root != root {
+		rule = &ruleConditionStates{root: root, states: make(map[interface{}]interface{})}
+		s.rules[ruleID] = rule
+	}
+	if state, ok := rule.states[key]; ok {
+		return state, nil
+	}
+	state, err := create()
+	if err != nil {
+		return nil, err
+	}
+	rule.states[key] = state
+	return state, nil
+}
+
+// ruleStates 获取规则当前的全部条件状态
+func (s *conditionStateStore) ruleStates(ruleID string) []interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rule := s.rules[ruleID]
+	if rule == nil {
+		return nil
+	}
+	states := make([]interface{}, 0, len(rule.states))
+	for _, state := range rule.states {
+		states = append(states, state)
+	}
+	return states
+}
+
+// snapshot 获取全部规则的条件状态，按规则ID
+func (s *conditionStateStore) snapshot() map[string][]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make(map[string][]interface{}, len(s.rules))
+	for ruleID, rule := range s.rules {
+		for _, state := range rule.states {
+			result[ruleID] = append(result[ruleID], state)
+		}
+	}
+	return result
+}
+
+// drop 删除规则的全部条件状态
+func (s *conditionStateStore) drop(ruleID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.rules, ruleID)
+}
+
+// RuleMatch 有状态条件在规则满足时产生的上下文
+type RuleMatch struct {
+	Sequence *SequenceMatch `json:"sequence,omitempty"`
+	Alarm    *AlarmEvent    `json:"alarm,omitempty"`
+}
+
+// Context 把匹配上下文放入动作执行的context
+func (m *RuleMatch) Context(ctx context.Context) context.Context {
+	if m == nil {
+		return ctx
+	}
+	ctx = WithSequenceMatch(ctx, m.Sequence)
+	return WithAlarmEvent(ctx, m.Alarm)
+}
@@ -1,8 +1,8 @@
 package rules
 
 import (
+	"errors"
 	"fmt"
-	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
@@ -13,8 +13,16 @@ import (
 
 // Evaluator 条件评估器
 type Evaluator struct {
-	functions    map[string]Function
+	functions    *FunctionRegistry    // 与表达式引擎共用的函数注册表
+	expressions  *ExpressionEngine    // 表达式引擎，评估规则验证时编译并保存在条件上的表达式，不缓存
 	regexCache   sync.Map // 使用sync.Map替代带锁的map
+	states       *conditionStateStore // 序列、报警等有状态条件的状态
+}
+
+// evalContext 一次规则评估的上下文，有状态的条件据此定位规则状态
+type evalContext struct {
+	rule  *Rule
+	match RuleMatch
 }
 
 // Function 内置函数接口
@@ -26,33 +34,52 @@ type Function interface {
 // NewEvaluator 创建条件评估器
 func NewEvaluator() *Evaluator {
 	evaluator := &Evaluator{
-		functions: make(map[string]Function),
+		functions:   DefaultFunctions(),
+		expressions: NewExpressionEngine(),
+		states:      newConditionStateStore(),
 		// regexCache 使用sync.Map，无需初始化
 	}
 
-	// 注册内置函数
-	evaluator.registerBuiltinFunctions()
-
 	return evaluator
 }
 
 // Evaluate 评估条件
 func (e *Evaluator) Evaluate(condition *Condition, point model.Point) (bool, error) {
+	return e.evaluate(condition, point, nil)
+}
+
+// EvaluateRule 评估规则条件，同时返回序列、报警等有状态条件产生的上下文
+func (e *Evaluator) EvaluateRule(rule *Rule, point model.Point) (bool, *RuleMatch, error) {
+	ec := &evalContext{rule: rule}
+	matched, err := e.evaluate(rule.Conditions, point, ec)
+	if !matched || (ec.match.Sequence == nil && ec.match.Alarm == nil) {
+		return matched, nil, err
+	}
+	return matched, &ec.match, err
+}
+
+// DropRuleState 删除规则的序列、报警等条件状态
+func (e *Evaluator) DropRuleState(ruleID string) {
+	e.states.drop(ruleID)
+}
+
+// evaluate 评估条件，ec为空时不支持有状态的条件
+func (e *Evaluator) evaluate(condition *Condition, point model.Point, ec *evalContext) (bool, error) {
 	if condition == nil {
 		return true, nil
 	}
 
 	// 首先检查复合条件（优先级最高）
 	if condition.And != nil {
-		return e.evaluateAndCondition(condition.And, point)
+		return e.evaluateAndCondition(condition.And, point, ec)
 	}
 
 	if condition.Or != nil {
-		return e.evaluateOrCondition(condition.Or, point)
+		return e.evaluateOrCondition(condition.Or, point, ec)
 	}
 
 	if condition.Not != nil {
-		result, err := e.Evaluate(condition.Not, point)
+		result, err := e.evaluate(condition.Not, point, ec)
 		if err != nil {
 			return false, err
 		}
@@ -68,22 +95,51 @@ func (e *Evaluator) Evaluate(condition *Condition, point model.Point) (bool, err
 		if len(condition.And) == 0 {
 			return false, fmt.Errorf("and类型条件缺少and字段定义")
 		}
-		return e.evaluateAndCondition(condition.And, point)
+		return e.evaluateAndCondition(condition.And, point, ec)
 	case "or":
 		// 对于类型为"or"的条件，如果Or字段为空，则检查是否有其他字段定义的复合逻辑
 		if len(condition.Or) == 0 {
 			return false, fmt.Errorf("or类型条件缺少or字段定义")
 		}
-		return e.evaluateOrCondition(condition.Or, point)
+		return e.evaluateOrCondition(condition.Or, point, ec)
 	case "expression":
 		return e.evaluateExpression(condition, point)
 	case "lua":
 		return e.evaluateLuaScript(condition, point)
+	case "sequence":
+		return e.evaluateSequence(condition, point, ec)
+	case "alarm":
+		return e.evaluateAlarm(condition, point, ec)
 	default:
 		return false, fmt.Errorf("不支持的条件类型: %s", condition.Type)
 	}
 }
 
+// evaluateSequence 评估序列条件，需要规则上下文保存部分匹配状态
+func (e *Evaluator) evaluateSequence(condition *Condition, point model.Point, ec *evalContext) (bool, error) {
+	if condition.Sequence == nil {
+		return false, fmt.Errorf("sequence类型条件缺少sequence字段定义")
+	}
+	if ec == nil || ec.rule == nil {
+		return false, fmt.Errorf("序列条件只能在规则中评估")
+	}
+
+	state, err := e.states.state(ec.rule.ID, ec.rule.Conditions, condition.Sequence, func() (interface{}, error) {
+		return compileSequence(condition.Sequence)
+	})
+	if err != nil {
+		return false, err
+	}
+	match, err := state.(*sequenceMatcher).process(e, ec.rule.ID, point)
+	if err != nil || match == nil {
+		return false, err
+	}
+	if ec.match.Sequence == nil {
+		ec.match.Sequence = match
+	}
+	return true, nil
+}
+
 // evaluateSimpleCondition 评估简单条件
 func (e *Evaluator) evaluateSimpleCondition(condition *Condition, point model.Point) (bool, error) {
 	// 注意：在新的Evaluate方法中，复合条件已经在上层处理了
@@ -94,7 +150,7 @@ func (e *Evaluator) evaluateSimpleCondition(condition *Condition, point model.Po
 }
 
 // evaluateAndCondition 评估AND条件
-func (e *Evaluator) evaluateAndCondition(conditions []*Condition, point model.Point) (bool, error) {
+func (e *Evaluator) evaluateAndCondition(conditions []*Condition, point model.Point, ec *evalContext) (bool, error) {
 	if len(conditions) == 0 {
 		return true, nil // 空AND条件数组返回true（没有任何条件为false）
 	}
@@ -106,7 +162,7 @@ func (e *Evaluator) evaluateAndCondition(conditions []*Condition, point model.Po
 				WithContext("condition_type", "and")
 		}
 
-		result, err := e.Evaluate(cond, point)
+		result, err := e.evaluate(cond, point, ec)
 		if err != nil {
 			return false, NewConditionError(ErrCodeConditionEval, "AND条件评估失败", err).
 				WithContext("condition_index", i).
@@ -120,7 +176,7 @@ func (e *Evaluator) evaluateAndCondition(conditions []*Condition, point model.Po
 }
 
 // evaluateOrCondition 评估OR条件
-func (e *Evaluator) evaluateOrCondition(conditions []*Condition, point model.Point) (bool, error) {
+func (e *Evaluator) evaluateOrCondition(conditions []*Condition, point model.Point, ec *evalContext) (bool, error) {
 	if len(conditions) == 0 {
 		return false, nil // 空OR条件数组返回false（没有任何条件为true）
 	}
@@ -132,7 +188,7 @@ func (e *Evaluator) evaluateOrCondition(conditions []*Condition, point model.Poi
 				WithContext("condition_type", "or")
 		}
 
-		result, err := e.Evaluate(cond, point)
+		result, err := e.evaluate(cond, point, ec)
 		if err != nil {
 			return false, NewConditionError(ErrCodeConditionEval, "OR条件评估失败", err).
 				WithContext("condition_index", i).
@@ -448,17 +504,29 @@ func (e *Evaluator) evaluateExpression(condition *Condition, point model.Point)
 			WithContext("max_length", 10000)
 	}
 
-	// 使用增强的表达式引擎
-	engine := NewExpressionEngine()
-	result, err := engine.Evaluate(expression, point)
+	// 使用增强的表达式引擎，表达式在规则验证时已编译；未经验证的条件每次编译
+	var result interface{}
+	var err error
+	if compiled := condition.compiled; compiled != nil && compiled.Source() == expression {
+		result, err = e.expressions.EvaluateCompiled(compiled, point)
+	} else {
+		result, err = e.expressions.Evaluate(expression, point)
+	}
+	if errors.Is(err, ErrLastValueUnavailable) {
+		// 引用的其他设备输入无数据或已过期，条件不满足
+		return false, nil
+	}
 	if err != nil {
-		// 检查是否是语法错误，如果是则直接报告
-		if strings.Contains(err.Error(), "表达式语法错误") {
-			return false, NewConditionError(ErrCodeConditionParse, "表达式语法错误", err).
-				WithContext("expression", expression)
+		// 编译错误（语法、类型等）直接报告
+		var exprErr *ExpressionError
+		if errors.As(err, &exprErr) {
+			return false, NewConditionError(ErrCodeConditionParse, "表达式"+exprErr.Kind, err).
+				WithContext("expression", expression).
+				WithContext("line", exprErr.Line).
+				WithContext("column", exprErr.Column)
 		}
 		
-		// 只有在非语法错误时才回退到简单表达式解析
+		// 只有在运行时错误时才回退到简单表达式解析
 		fallbackResult, fallbackErr := e.parseSimpleExpression(expression, point)
 		if fallbackErr != nil {
 			return false, NewConditionError(ErrCodeConditionParse, "表达式解析失败", fallbackErr).
@@ -615,9 +683,22 @@ func (e *Evaluator) evaluateLuaScript(condition *Condition, point model.Point) (
 	return false, fmt.Errorf("Lua脚本评估暂未实现")
 }
 
-// RegisterFunction 注册自定义函数
+// RegisterFunction 注册自定义函数，注册到与表达式引擎共用的函数注册表
 func (e *Evaluator) RegisterFunction(fn Function) {
-	e.functions[fn.Name()] = fn
+	e.functions.Register(functionAdapter{fn})
+}
+
+// functionAdapter 将条件评估器的Function适配为表达式函数
+type functionAdapter struct {
+	fn Function
+}
+
+func (a functionAdapter) Name() string { return a.fn.Name() }
+
+func (a functionAdapter) Description() string { return a.fn.Name() }
+
+func (a functionAdapter) Call(args ...interface{}) (interface{}, error) {
+	return a.fn.Call(args)
 }
 
 // GetCompiledRegex 获取编译后的正则表达式（无锁缓存）
@@ -638,253 +719,6 @@ func (e *Evaluator) GetCompiledRegex(pattern string) (*regexp.Regexp, error) {
 	return actual.(*regexp.Regexp), nil
 }
 
-// registerBuiltinFunctions 注册内置函数
-func (e *Evaluator) registerBuiltinFunctions() {
-	// 数学函数
-	e.RegisterFunction(&AbsFunction{})
-	e.RegisterFunction(&MaxFunction{})
-	e.RegisterFunction(&MinFunction{})
-
-	// 字符串函数
-	e.RegisterFunction(&LengthFunction{})
-	e.RegisterFunction(&UpperFunction{})
-	e.RegisterFunction(&LowerFunction{})
-
-	// 类型转换函数
-	e.RegisterFunction(&ToStringFunction{})
-	e.RegisterFunction(&ToNumberFunction{})
-	e.RegisterFunction(&ToBoolFunction{})
-}
-
-// 内置函数实现
-
-// AbsFunction 绝对值函数
-type AbsFunction struct{}
-
-func (f *AbsFunction) Name() string { return "abs" }
-
-func (f *AbsFunction) Call(args []interface{}) (interface{}, error) {
-	if len(args) != 1 {
-		return nil, fmt.Errorf("abs函数需要1个参数")
-	}
-
-	if num, ok := toFloat64(args[0]); ok {
-		if num < 0 {
-			return -num, nil
-		}
-		return num, nil
-	}
-
-	return nil, fmt.Errorf("abs函数参数必须是数字")
-}
-
-// MaxFunction 最大值函数
-type MaxFunction struct{}
-
-func (f *MaxFunction) Name() string { return "max" }
-
-func (f *MaxFunction) Call(args []interface{}) (interface{}, error) {
-	if len(args) < 2 {
-		return nil, fmt.Errorf("max函数至少需要2个参数")
-	}
-
-	var maxVal float64
-	var hasValue bool
-
-	for i, arg := range args {
-		if num, ok := toFloat64(arg); ok {
-			if !hasValue || num > maxVal {
-				maxVal = num
-				hasValue = true
-			}
-		} else {
-			return nil, fmt.Errorf("max函数第%d个参数必须是数字", i+1)
-		}
-	}
-
-	if !hasValue {
-		return nil, fmt.Errorf("max函数没有有效的数字参数")
-	}
-
-	return maxVal, nil
-}
-
-// MinFunction 最小值函数
-type MinFunction struct{}
-
-func (f *MinFunction) Name() string { return "min" }
-
-func (f *MinFunction) Call(args []interface{}) (interface{}, error) {
-	if len(args) < 2 {
-		return nil, fmt.Errorf("min函数至少需要2个参数")
-	}
-
-	var minVal float64
-	var hasValue bool
-
-	for i, arg := range args {
-		if num, ok := toFloat64(arg); ok {
-			if !hasValue || num < minVal {
-				minVal = num
-				hasValue = true
-			}
-		} else {
-			return nil, fmt.Errorf("min函数第%d个参数必须是数字", i+1)
-		}
-	}
-
-	if !hasValue {
-		return nil, fmt.Errorf("min函数没有有效的数字参数")
-	}
-
-	return minVal, nil
-}
-
-// LengthFunction 长度函数
-type LengthFunction struct{}
-
-func (f *LengthFunction) Name() string { return "length" }
-
-func (f *LengthFunction) Call(args []interface{}) (interface{}, error) {
-	if len(args) != 1 {
-		return nil, fmt.Errorf("length函数需要1个参数")
-	}
-
-	switch v := args[0].(type) {
-	case string:
-		return len(v), nil
-	case []interface{}:
-		return len(v), nil
-	case map[string]interface{}:
-		return len(v), nil
-	default:
-		// 使用反射获取长度
-		rv := reflect.ValueOf(v)
-		switch rv.Kind() {
-		case reflect.Slice, reflect.Array, reflect.Map, reflect.Chan, reflect.String:
-			return rv.Len(), nil
-		default:
-			return nil, fmt.Errorf("length函数参数类型不支持")
-		}
-	}
-}
-
-// UpperFunction 转大写函数
-type UpperFunction struct{}
-
-func (f *UpperFunction) Name() string { return "upper" }
-
-func (f *UpperFunction) Call(args []interface{}) (interface{}, error) {
-	if len(args) != 1 {
-		return nil, fmt.Errorf("upper函数需要1个参数")
-	}
-
-	if str, ok := args[0].(string); ok {
-		return strings.ToUpper(str), nil
-	}
-
-	return nil, fmt.Errorf("upper函数参数必须是字符串")
-}
-
-// LowerFunction 转小写函数
-type LowerFunction struct{}
-
-func (f *LowerFunction) Name() string { return "lower" }
-
-func (f *LowerFunction) Call(args []interface{}) (interface{}, error) {
-	if len(args) != 1 {
-		return nil, fmt.Errorf("lower函数需要1个参数")
-	}
-
-	if str, ok := args[0].(string); ok {
-		return strings.ToLower(str), nil
-	}
-
-	return nil, fmt.Errorf("lower函数参数必须是字符串")
-}
-
-// ToStringFunction 转字符串函数
-type ToStringFunction struct{}
-
-func (f *ToStringFunction) Name() string { return "toString" }
-
-func (f *ToStringFunction) Call(args []interface{}) (interface{}, error) {
-	if len(args) != 1 {
-		return nil, fmt.Errorf("toString函数需要1个参数")
-	}
-
-	return fmt.Sprintf("%v", args[0]), nil
-}
-
-// ToNumberFunction 转数字函数
-type ToNumberFunction struct{}
-
-func (f *ToNumberFunction) Name() string { return "toNumber" }
-
-func (f *ToNumberFunction) Call(args []interface{}) (interface{}, error) {
-	if len(args) != 1 {
-		return nil, NewConditionError(ErrCodeConditionType, "toNumber函数需要1个参数", nil).
-			WithContext("args_count", len(args))
-	}
-
-	arg := args[0]
-	if arg == nil {
-		return nil, NewConditionError(ErrCodeConditionType, "toNumber函数参数不能为nil", nil)
-	}
-
-	if num, ok := toFloat64(arg); ok {
-		return num, nil
-	}
-
-	// 详细的错误信息
-	return nil, NewConditionError(ErrCodeConditionType, "无法转换为数字", nil).
-		WithContext("value", arg).
-		WithContext("type", fmt.Sprintf("%T", arg)).
-		WithContext("supported_types", []string{"int", "float", "string", "bool"})
-}
-
-// ToBoolFunction 转布尔函数
-type ToBoolFunction struct{}
-
-func (f *ToBoolFunction) Name() string { return "toBool" }
-
-func (f *ToBoolFunction) Call(args []interface{}) (interface{}, error) {
-	if len(args) != 1 {
-		return nil, NewConditionError(ErrCodeConditionType, "toBool函数需要1个参数", nil).
-			WithContext("args_count", len(args))
-	}
-
-	arg := args[0]
-	if arg == nil {
-		return false, nil
-	}
-
-	switch v := arg.(type) {
-	case bool:
-		return v, nil
-	case string:
-		// 严格的布尔转换
-		switch strings.ToLower(strings.TrimSpace(v)) {
-		case "true", "1", "yes", "on":
-			return true, nil
-		case "false", "0", "no", "off", "":
-			return false, nil
-		default:
-			return len(v) > 0, nil
-		}
-	case int, int8, int16, int32, int64:
-		return v != 0, nil
-	case uint, uint8, uint16, uint32, uint64:
-		return v != 0, nil
-	case float32, float64:
-		if num, ok := toFloat64(v); ok {
-			return num != 0, nil
-		}
-	}
-
-	return arg != nil, nil
-}
-
 // 通用复合数据类型字段访问函数
 
 // getVectorFieldValue 获取通用向量数据字段值
@@ -0,0 +1,118 @@
+package rules
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/y001j/iot-gateway/internal/model"
+)
+
+// benchExpressionPatterns 规则表达式模板，%d为阈值
+var benchExpressionPatterns = []string{
+	"value > %d",
+	"value >= %d && tags.site == 'plant-1'",
+	"key == 'temperature' && num_value * 1.8 + 32 > %d",
+	"abs(value - %d) > 5 || quality != 0",
+	"device_id == 'sensor-007' && value < %d",
+	"max([value, 10, 20]) > %d && contains(device_id, 'sensor')",
+	"tags['line'] == 'line-2' && value %% 10 < %d",
+	"!(value < %d) && exists('value')",
+}
+
+// benchRules 生成表达式条件的规则，并与规则加载时一样验证，表达式编译结果保存在条件上
+func benchRules(b *testing.B, n int) []*Rule {
+	manager := NewManager("")
+	ruleList := make([]*Rule, n)
+	for i := 0; i < n; i++ {
+		pattern := benchExpressionPatterns[i%len(benchExpressionPatterns)]
+		ruleList[i] = &Rule{
+			ID:      fmt.Sprintf("bench_%03d", i),
+			Name:    fmt.Sprintf("bench rule %d", i),
+			Enabled: true,
+			Conditions: &Condition{
+				Type:       "expression",
+				Expression: fmt.Sprintf(pattern, 10+i%80),
+			},
+			Actions: []Action{{Type: "alert"}},
+		}
+		if err := manager.ValidateRule(ruleList[i]); err != nil {
+			b.Fatalf("规则%s验证失败: %v", ruleList[i].ID, err)
+		}
+	}
+	return ruleList
+}
+
+// benchPoints 带标签的数值数据点
+func benchPoints(n int) []model.Point {
+	points := make([]model.Point, n)
+	for i := range points {
+		p := model.NewPoint("temperature", fmt.Sprintf("sensor-%03d", i%20), 20+float64(i%70), model.TypeFloat)
+		p.AddTag("site", "plant-1")
+		p.AddTag("line", fmt.Sprintf("line-%d", i%3))
+		points[i] = p
+	}
+	return points
+}
+
+// BenchmarkEvaluate500Rules 每次操作为一个数据点依次评估500条表达式规则，
+// 对比每次解析表达式、预编译串行评估和并行评估（并行度由 -cpu 控制）
+func BenchmarkEvaluate500Rules(b *testing.B) {
+	ruleList := benchRules(b, 500)
+	points := benchPoints(64)
+	evaluator := NewEvaluator()
+
+	reportThroughput := func(b *testing.B) {
+		if ns := b.Elapsed().Nanoseconds(); ns > 0 {
+			b.ReportMetric(float64(b.N)*float64(len(ruleList))/(float64(ns)/1e9), "rules/s")
+		}
+	}
+
+	b.Run("reparse", func(b *testing.B) {
+		// 每次评估重新解析表达式，即预编译之前的开销
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			point := points[i%len(points)]
+			for _, rule := range ruleList {
+				compiled, err := CompileExpression(rule.Conditions.Expression)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := compiled.Evaluate(point, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		reportThroughput(b)
+	})
+
+	b.Run("compiled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			point := points[i%len(points)]
+			for _, rule := range ruleList {
+				if _, err := evaluator.Evaluate(rule.Conditions, point); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		reportThroughput(b)
+	})
+
+	b.Run("parallel", func(b *testing.B) {
+		b.ReportAllocs()
+		var next uint64
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				point := points[atomic.AddUint64(&next, 1)%uint64(len(points))]
+				for _, rule := range ruleList {
+					if _, err := evaluator.Evaluate(rule.Conditions, point); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			}
+		})
+		reportThroughput(b)
+	})
+}
@@ -2,15 +2,13 @@ package rules
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"go/ast"
-	"go/parser"
-	"go/token"
 	"math"
 	"regexp"
 	"strconv"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/y001j/iot-gateway/internal/model"
@@ -18,11 +16,11 @@ import (
 )
 
 // ExpressionEngine 增强的表达式引擎
+// 表达式按源码编译一次并缓存，每次评估使用独立的环境，可被多个goroutine并发使用
 type ExpressionEngine struct {
-	functions   map[string]ExprFunction
-	variables   map[string]interface{}
-	mu          sync.RWMutex // 保护variables map的读写锁
-	geoProcessor *geo.GeoProcessor // 地理数据处理器
+	functions    *FunctionRegistry                       // 与条件评估器共用的函数注册表
+	variables    atomic.Pointer[map[string]interface{}] // SetVariable设置的附加变量，写时复制
+	geoProcessor *geo.GeoProcessor                       // 地理数据处理器
 }
 
 // ExprFunction 表达式函数接口
@@ -34,156 +32,62 @@ type ExprFunction interface {
 
 // NewExpressionEngine 创建表达式引擎
 func NewExpressionEngine() *ExpressionEngine {
-	engine := &ExpressionEngine{
-		functions:   make(map[string]ExprFunction),
-		variables:   make(map[string]interface{}),
-		geoProcessor: geo.NewGeoProcessor(),
+	functions := DefaultFunctions()
+	return &ExpressionEngine{
+		functions:    functions,
+		geoProcessor: defaultGeoProcessor,
 	}
-	
-	// 初始化地理区域数据
-	engine.initializeGeoData()
-	
-	// 注册内置函数
-	engine.registerBuiltinFunctions()
-	
-	return engine
 }
 
-// Evaluate 评估表达式
+// Evaluate 编译并评估表达式，重复评估的表达式应先Compile再使用EvaluateCompiled
 func (e *ExpressionEngine) Evaluate(expression string, point model.Point) (interface{}, error) {
-	// 设置当前数据点的变量
-	e.setPointVariables(point)
-	
-	// 尝试使用Go表达式解析器（安全的表达式子集）
-	result, goErr := e.evaluateGoExpression(expression)
-	if goErr == nil {
-		return result, nil
-	}
-	
-	// 检查是否是语法错误，如果是则不回退
-	if e.isSyntaxError(goErr) {
-		return nil, fmt.Errorf("表达式语法错误: %v", goErr)
+	compiled, err := e.Compile(expression)
+	if err != nil {
+		return nil, err
 	}
-	
-	// 只有在不是语法错误时才回退到自定义表达式解析器
-	result, customErr := e.evaluateCustomExpression(expression)
-	return result, customErr
+	return e.EvaluateCompiled(compiled, point)
 }
 
-// isSyntaxError 判断是否为语法错误
-func (e *ExpressionEngine) isSyntaxError(err error) bool {
-	if err == nil {
-		return false
+// EvaluateCompiled 评估已编译的表达式
+func (e *ExpressionEngine) EvaluateCompiled(compiled *CompiledExpression, point model.Point) (interface{}, error) {
+	expression := compiled.Source()
+	var vars map[string]interface{}
+	if v := e.variables.Load(); v != nil {
+		vars = *v
 	}
-	
-	errMsg := err.Error()
-	// Go parser的典型语法错误模式
-	syntaxPatterns := []string{
-		"expected operand",
-		"expected 'EOF'",
-		"expected ')'",
-		"expected '}'", 
-		"expected ']'",
-		"illegal character",
-		"invalid character",
-		"unterminated",
+	env := &exprEnv{point: &point, vars: vars}
+	result, evalErr := compiled.root.eval(env)
+	if evalErr == nil {
+		return result, nil
 	}
 	
-	for _, pattern := range syntaxPatterns {
-		if strings.Contains(errMsg, pattern) {
-			return true
-		}
+	// 引用的设备输入无数据或已过期，不回退到自定义解析器
+	if errors.Is(evalErr, ErrLastValueUnavailable) {
+		return nil, evalErr
 	}
 	
-	return false
+	// 运行时错误时尝试自定义表达式解析器
+	if result, customErr := e.evaluateCustomExpression(expression, env); customErr == nil {
+		return result, nil
+	}
+	return nil, evalErr
 }
 
-// setPointVariables 设置数据点变量
-func (e *ExpressionEngine) setPointVariables(point model.Point) {
-	e.mu.Lock()
-	defer e.mu.Unlock()
-	
-	e.variables["device_id"] = point.DeviceID
-	e.variables["key"] = point.Key
-	e.variables["value"] = point.Value
-	e.variables["type"] = string(point.Type)
-	e.variables["timestamp"] = point.Timestamp
-	e.variables["quality"] = point.Quality
-	
-	// 增强的时间戳字段访问
-	if !point.Timestamp.IsZero() {
-		e.variables["timestamp_unix"] = point.Timestamp.Unix()
-		e.variables["timestamp_string"] = point.Timestamp.Format(time.RFC3339)
-		e.variables["timestamp_year"] = point.Timestamp.Year()
-		e.variables["timestamp_month"] = int(point.Timestamp.Month())
-		e.variables["timestamp_day"] = point.Timestamp.Day()
-		e.variables["timestamp_hour"] = point.Timestamp.Hour()
-		e.variables["timestamp_minute"] = point.Timestamp.Minute()
-		e.variables["timestamp_second"] = point.Timestamp.Second()
-	}
-	
-	// 添加时间相关变量
-	now := time.Now()
-	e.variables["now"] = now
-	e.variables["today"] = now.Truncate(24 * time.Hour)
-	e.variables["hour"] = now.Hour()
-	e.variables["minute"] = now.Minute()
-	e.variables["weekday"] = int(now.Weekday())
-	
-	// 添加数值变量（如果value是数值）
-	if numValue, ok := toFloat64(point.Value); ok {
-		e.variables["num_value"] = numValue
-	}
-	
-	// 设置标签变量（用于tags['key']访问）
-	// 使用GetTagsCopy()来获取实际的标签数据，支持SafeTags
-	actualTags := point.GetTagsCopy()
-	if len(actualTags) > 0 {
-		e.variables["tags"] = actualTags
-		// 增强的标签变量支持 - 支持深层访问
-		e.setDeepTagVariables(actualTags, "tag")
-	} else {
-		e.variables["tags"] = make(map[string]string)
-	}
-	
-	// 处理复合数据字段变量
-	e.setCompositeDataVariables(point)
-	
-	// 添加常用变量的默认值
-	e.variables["emergency_threshold"] = 100.0
-	e.variables["avg_threshold"] = 50.0
-	e.variables["nil"] = nil
-	
-	// 模拟历史数据用于统计函数
-	// 在实际应用中，这些应该来自历史数据存储
-	if numValue, ok := toFloat64(point.Value); ok {
-		// 生成一些示例历史数据
-		last_values := make([]interface{}, 5)
-		for i := 0; i < 5; i++ {
-			// 在实际值附近生成模拟数据
-			variance := numValue * 0.1 * (float64(i%3) - 1) // -10% to +10% variance
-			last_values[i] = numValue + variance
-		}
-		e.variables["last_values"] = last_values
-	}
+// Compile 编译表达式，结果可以并发评估，由调用方保存
+func (e *ExpressionEngine) Compile(expression string) (*CompiledExpression, error) {
+	return CompileExpression(expression)
 }
 
 // setDeepTagVariables 递归设置深层标签变量
-func (e *ExpressionEngine) setDeepTagVariables(tags map[string]string, prefix string) {
-	defer func() {
-		if r := recover(); r != nil {
-			// 防止并发访问map导致的panic
-		}
-	}()
-	
+func setDeepTagVariables(vars map[string]interface{}, tags map[string]string, prefix string) {
 	for k, v := range tags {
 		// 基础标签访问
-		e.variables[prefix+"_"+k] = v
+		vars[prefix+"_"+k] = v
 		
 		// 支持嵌套访问（如果值是JSON格式）
 		if strings.HasPrefix(v, "{") || strings.HasPrefix(v, "[") {
-			if nestedMap, ok := e.parseJSONValue(v); ok {
-				e.setNestedVariables(nestedMap, prefix+"_"+k)
+			if nestedMap, ok := parseJSONValue(v); ok {
+				setNestedVariables(vars, nestedMap, prefix+"_"+k)
 			}
 		}
 		
@@ -193,14 +97,14 @@ func (e *ExpressionEngine) setDeepTagVariables(tags map[string]string, prefix st
 			currentPrefix := prefix
 			for _, part := range parts {
 				currentPrefix = currentPrefix + "_" + part
-				e.variables[currentPrefix] = v
+				vars[currentPrefix] = v
 			}
 		}
 	}
 }
 
 // parseJSONValue 尝试解析JSON值
-func (e *ExpressionEngine) parseJSONValue(jsonStr string) (interface{}, bool) {
+func parseJSONValue(jsonStr string) (interface{}, bool) {
 	var result interface{}
 	if err := json.Unmarshal([]byte(jsonStr), &result); err == nil {
 		return result, true
@@ -209,7 +113,7 @@ func (e *ExpressionEngine) parseJSONValue(jsonStr string) (interface{}, bool) {
 }
 
 // setCompositeDataVariables 设置复合数据字段变量
-func (e *ExpressionEngine) setCompositeDataVariables(point model.Point) {
+func setCompositeDataVariables(vars map[string]interface{}, point model.Point) {
 	// 只处理复合数据类型
 	if !isCompositeDataType(point.Type) {
 		return
@@ -226,35 +130,35 @@ func (e *ExpressionEngine) setCompositeDataVariables(point model.Point) {
 		if locationData, ok := compositeData.(*model.LocationData); ok {
 			// 使用key作为前缀，例如 "location.latitude"
 			prefix := point.Key
-			e.variables[prefix+".latitude"] = locationData.Latitude
-			e.variables[prefix+".longitude"] = locationData.Longitude
-			e.variables[prefix+".altitude"] = locationData.Altitude
-			e.variables[prefix+".accuracy"] = locationData.Accuracy
-			e.variables[prefix+".speed"] = locationData.Speed
-			e.variables[prefix+".heading"] = locationData.Heading
+			vars[prefix+".latitude"] = locationData.Latitude
+			vars[prefix+".longitude"] = locationData.Longitude
+			vars[prefix+".altitude"] = locationData.Altitude
+			vars[prefix+".accuracy"] = locationData.Accuracy
+			vars[prefix+".speed"] = locationData.Speed
+			vars[prefix+".heading"] = locationData.Heading
 		}
 		
 	case model.TypeVector3D:
 		if vectorData, ok := compositeData.(*model.Vector3D); ok {
 			prefix := point.Key
-			e.variables[prefix+".x"] = vectorData.X
-			e.variables[prefix+".y"] = vectorData.Y
-			e.variables[prefix+".z"] = vectorData.Z
+			vars[prefix+".x"] = vectorData.X
+			vars[prefix+".y"] = vectorData.Y
+			vars[prefix+".z"] = vectorData.Z
 		}
 		
 	case model.TypeVector:
 		if vectorData, ok := compositeData.(*model.VectorData); ok {
 			prefix := point.Key
-			e.variables[prefix+".dimension"] = vectorData.Dimension
-			e.variables[prefix+".length"] = len(vectorData.Values)
-			e.variables[prefix+".unit"] = vectorData.Unit
+			vars[prefix+".dimension"] = vectorData.Dimension
+			vars[prefix+".length"] = len(vectorData.Values)
+			vars[prefix+".unit"] = vectorData.Unit
 			
 			// 设置向量元素访问（限制前10个元素）
 			for i, value := range vectorData.Values {
 				if i >= 10 {
 					break
 				}
-				e.variables[fmt.Sprintf("%s.%d", prefix, i)] = value
+				vars[fmt.Sprintf("%s.%d", prefix, i)] = value
 			}
 			
 			// 设置标签访问（如果有）
@@ -263,37 +167,37 @@ func (e *ExpressionEngine) setCompositeDataVariables(point model.Point) {
 					break
 				}
 				if label != "" {
-					e.variables[prefix+"."+label] = vectorData.Values[i]
+					vars[prefix+"."+label] = vectorData.Values[i]
 				}
 			}
 			
 			// 设置向量对象本身，用于函数调用
-			e.variables[prefix] = vectorData
+			vars[prefix] = vectorData
 		}
 		
 	case model.TypeColor:
 		if colorData, ok := compositeData.(*model.ColorData); ok {
 			prefix := point.Key
-			e.variables[prefix+".r"] = int(colorData.R)
-			e.variables[prefix+".g"] = int(colorData.G)
-			e.variables[prefix+".b"] = int(colorData.B)
-			e.variables[prefix+".a"] = int(colorData.A)
+			vars[prefix+".r"] = int(colorData.R)
+			vars[prefix+".g"] = int(colorData.G)
+			vars[prefix+".b"] = int(colorData.B)
+			vars[prefix+".a"] = int(colorData.A)
 		}
 		
 	case model.TypeArray:
 		if arrayData, ok := compositeData.(*model.ArrayData); ok {
 			prefix := point.Key
-			e.variables[prefix+".size"] = arrayData.Size
-			e.variables[prefix+".length"] = len(arrayData.Values)
-			e.variables[prefix+".data_type"] = arrayData.DataType
-			e.variables[prefix+".unit"] = arrayData.Unit
+			vars[prefix+".size"] = arrayData.Size
+			vars[prefix+".length"] = len(arrayData.Values)
+			vars[prefix+".data_type"] = arrayData.DataType
+			vars[prefix+".unit"] = arrayData.Unit
 			
 			// 设置数组元素访问（限制前10个元素）
 			for i, value := range arrayData.Values {
 				if i >= 10 {
 					break
 				}
-				e.variables[fmt.Sprintf("%s.%d", prefix, i)] = value
+				vars[fmt.Sprintf("%s.%d", prefix, i)] = value
 			}
 			
 			// 设置标签访问（如果有）
@@ -302,26 +206,26 @@ func (e *ExpressionEngine) setCompositeDataVariables(point model.Point) {
 					break
 				}
 				if label != "" {
-					e.variables[prefix+"."+label] = arrayData.Values[i]
+					vars[prefix+"."+label] = arrayData.Values[i]
 				}
 			}
 			
 			// 设置数组对象本身，用于函数调用
-			e.variables[prefix] = arrayData
+			vars[prefix] = arrayData
 		}
 		
 	case model.TypeMatrix:
 		if matrixData, ok := compositeData.(*model.MatrixData); ok {
 			prefix := point.Key
-			e.variables[prefix+".rows"] = matrixData.Rows
-			e.variables[prefix+".cols"] = matrixData.Cols
-			e.variables[prefix+".unit"] = matrixData.Unit
+			vars[prefix+".rows"] = matrixData.Rows
+			vars[prefix+".cols"] = matrixData.Cols
+			vars[prefix+".unit"] = matrixData.Unit
 			
 			// 设置矩阵元素访问（格式：matrix.0_0）
 			for i := 0; i < matrixData.Rows && i < 5; i++ { // 限制5x5
 				for j := 0; j < matrixData.Cols && j < 5; j++ {
 					if i < len(matrixData.Values) && j < len(matrixData.Values[i]) {
-						e.variables[fmt.Sprintf("%s.%d_%d", prefix, i, j)] = matrixData.Values[i][j]
+						vars[fmt.Sprintf("%s.%d_%d", prefix, i, j)] = matrixData.Values[i][j]
 					}
 				}
 			}
@@ -330,14 +234,14 @@ func (e *ExpressionEngine) setCompositeDataVariables(point model.Point) {
 	case model.TypeTimeSeries:
 		if timeSeriesData, ok := compositeData.(*model.TimeSeriesData); ok {
 			prefix := point.Key
-			e.variables[prefix+".length"] = len(timeSeriesData.Values)
-			e.variables[prefix+".unit"] = timeSeriesData.Unit
-			e.variables[prefix+".interval"] = timeSeriesData.Interval.Seconds()
+			vars[prefix+".length"] = len(timeSeriesData.Values)
+			vars[prefix+".unit"] = timeSeriesData.Unit
+			vars[prefix+".interval"] = timeSeriesData.Interval.Seconds()
 			
 			// 设置特殊值访问
 			if len(timeSeriesData.Values) > 0 {
-				e.variables[prefix+".first_value"] = timeSeriesData.Values[0]
-				e.variables[prefix+".last_value"] = timeSeriesData.Values[len(timeSeriesData.Values)-1]
+				vars[prefix+".first_value"] = timeSeriesData.Values[0]
+				vars[prefix+".last_value"] = timeSeriesData.Values[len(timeSeriesData.Values)-1]
 			}
 			
 			// 设置索引访问和负索引访问（限制前10个）
@@ -345,14 +249,14 @@ func (e *ExpressionEngine) setCompositeDataVariables(point model.Point) {
 				if i >= 10 {
 					break
 				}
-				e.variables[fmt.Sprintf("%s.%d", prefix, i)] = value
+				vars[fmt.Sprintf("%s.%d", prefix, i)] = value
 			}
 			
 			// 负索引访问
 			if len(timeSeriesData.Values) > 0 {
-				e.variables[prefix+".-1"] = timeSeriesData.Values[len(timeSeriesData.Values)-1]
+				vars[prefix+".-1"] = timeSeriesData.Values[len(timeSeriesData.Values)-1]
 				if len(timeSeriesData.Values) > 1 {
-					e.variables[prefix+".-2"] = timeSeriesData.Values[len(timeSeriesData.Values)-2]
+					vars[prefix+".-2"] = timeSeriesData.Values[len(timeSeriesData.Values)-2]
 				}
 			}
 		}
@@ -371,443 +275,45 @@ func isCompositeDataType(dataType model.DataType) bool {
 }
 
 // setNestedVariables 设置嵌套变量
-func (e *ExpressionEngine) setNestedVariables(data interface{}, prefix string) {
+func setNestedVariables(vars map[string]interface{}, data interface{}, prefix string) {
 	switch v := data.(type) {
 	case map[string]interface{}:
 		for key, value := range v {
 			newPrefix := prefix + "_" + key
-			e.variables[newPrefix] = value
+			vars[newPrefix] = value
 			
 			// 递归处理嵌套结构
 			if nestedMap, ok := value.(map[string]interface{}); ok {
-				e.setNestedVariables(nestedMap, newPrefix)
+				setNestedVariables(vars, nestedMap, newPrefix)
 			}
 			if nestedArray, ok := value.([]interface{}); ok && len(nestedArray) > 0 {
 				// 数组访问支持
-				e.variables[newPrefix+"_length"] = len(nestedArray)
+				vars[newPrefix+"_length"] = len(nestedArray)
 				for i, item := range nestedArray {
 					if i < 10 { // 限制数组索引访问数量，防止变量爆炸
-						e.variables[fmt.Sprintf("%s_%d", newPrefix, i)] = item
+						vars[fmt.Sprintf("%s_%d", newPrefix, i)] = item
 					}
 				}
 			}
 		}
 	case []interface{}:
-		e.variables[prefix+"_length"] = len(v)
+		vars[prefix+"_length"] = len(v)
 		for i, item := range v {
 			if i < 10 { // 限制数组索引访问数量
-				e.variables[fmt.Sprintf("%s_%d", prefix, i)] = item
+				vars[fmt.Sprintf("%s_%d", prefix, i)] = item
 				if nestedMap, ok := item.(map[string]interface{}); ok {
-					e.setNestedVariables(nestedMap, fmt.Sprintf("%s_%d", prefix, i))
+					setNestedVariables(vars, nestedMap, fmt.Sprintf("%s_%d", prefix, i))
 				}
 			}
 		}
 	}
 }
 
-// preprocessArrayLiterals 预处理数组字面量，将其转换为函数调用
-func (e *ExpressionEngine) preprocessArrayLiterals(expression string) string {
-	// 将 [a, b, c] 转换为 __array__(a, b, c)
-	// 这样Go解析器可以解析，然后我们在evaluateCallExpr中特殊处理
-	
-	result := expression
-	
-	// 简单的数组字面量匹配和替换（使用缓存）
-	re, err := GetCompiledRegex(`\[([^\]]+)\]`)
-	if err != nil {
-		return result // 降级处理，返回原表达式
-	}
-	result = re.ReplaceAllStringFunc(result, func(match string) string {
-		// 去掉方括号
-		content := match[1 : len(match)-1]
-		// 转换为函数调用形式
-		return fmt.Sprintf("__array__(%s)", content)
-	})
-	
-	return result
-}
-
-// preprocessTagsAccess 预处理标签访问语法
-func (e *ExpressionEngine) preprocessTagsAccess(expression string) string {
-	// 将 tags['key'] 或 tags["key"] 转换为 __tag_access__("key")
-	// 将 tags.key 转换为 __tag_access__("key")
-	
-	result := expression
-	
-	// 处理 tags['key'] 和 tags["key"] 语法（使用缓存）
-	re1, err := GetCompiledRegex(`tags\[['"]([^'"]+)['"]\]`)
-	if err != nil {
-		return result // 降级处理
-	}
-	result = re1.ReplaceAllStringFunc(result, func(match string) string {
-		// 提取键名
-		matches := re1.FindStringSubmatch(match)
-		if len(matches) > 1 {
-			return fmt.Sprintf(`__tag_access__("%s")`, matches[1])
-		}
-		return match
-	})
-	
-	// 处理 tags.key 语法（使用缓存）
-	re2, err := GetCompiledRegex(`tags\.([a-zA-Z_][a-zA-Z0-9_]*)`)
-	if err != nil {
-		return result // 降级处理
-	}
-	result = re2.ReplaceAllStringFunc(result, func(match string) string {
-		// 提取键名
-		matches := re2.FindStringSubmatch(match)
-		if len(matches) > 1 {
-			return fmt.Sprintf(`__tag_access__("%s")`, matches[1])
-		}
-		return match
-	})
-	
-	return result
-}
-
-// normalizeSingleQuotes 将单引号字符串转换为双引号字符串
-func (e *ExpressionEngine) normalizeSingleQuotes(expression string) string {
-	// 简单的单引号到双引号转换
-	// 这个实现假设单引号总是用于字符串字面量
-	result := ""
-	inSingleQuote := false
-	escaped := false
-	
-	for _, char := range expression {
-		if escaped {
-			result += string(char)
-			escaped = false
-			continue
-		}
-		
-		if char == '\\' {
-			result += string(char)
-			escaped = true
-			continue
-		}
-		
-		if char == '\'' {
-			if !inSingleQuote {
-				// 开始单引号字符串
-				result += "\""
-				inSingleQuote = true
-			} else {
-				// 结束单引号字符串
-				result += "\""
-				inSingleQuote = false
-			}
-		} else {
-			result += string(char)
-		}
-	}
-	
-	return result
-}
-
-// evaluateGoExpression 使用Go解析器评估安全表达式
-func (e *ExpressionEngine) evaluateGoExpression(expression string) (interface{}, error) {
-	// 预处理：将单引号字符串转换为双引号字符串
-	normalizedExpr := e.normalizeSingleQuotes(expression)
-	
-	// 预处理：处理标签访问语法
-	tagsProcessedExpr := e.preprocessTagsAccess(normalizedExpr)
-	
-	// 预处理：处理数组字面量
-	processedExpr := e.preprocessArrayLiterals(tagsProcessedExpr)
-	
-	// 仅支持安全的表达式类型，不允许函数调用和复杂语句
-	expr, err := parser.ParseExpr(processedExpr)
-	if err != nil {
-		return nil, err
-	}
-	
-	return e.evaluateASTNode(expr)
-}
-
-// evaluateASTNode 评估AST节点
-func (e *ExpressionEngine) evaluateASTNode(node ast.Node) (interface{}, error) {
-	switch n := node.(type) {
-	case *ast.BasicLit:
-		return e.parseBasicLit(n)
-	case *ast.Ident:
-		// 处理布尔字面量
-		if n.Name == "true" {
-			return true, nil
-		}
-		if n.Name == "false" {
-			return false, nil
-		}
-		
-		e.mu.RLock()
-		value, exists := e.variables[n.Name]
-		e.mu.RUnlock()
-		if exists {
-			return value, nil
-		}
-		return nil, fmt.Errorf("未定义的变量: %s", n.Name)
-	case *ast.BinaryExpr:
-		return e.evaluateBinaryExpr(n)
-	case *ast.UnaryExpr:
-		return e.evaluateUnaryExpr(n)
-	case *ast.ParenExpr:
-		return e.evaluateASTNode(n.X)
-	case *ast.CallExpr:
-		return e.evaluateCallExpr(n)
-	case *ast.SelectorExpr:
-		return e.evaluateSelectorExpr(n)
-	default:
-		return nil, fmt.Errorf("不支持的表达式类型: %T", node)
-	}
-}
-
-// parseBasicLit 解析基本字面量
-func (e *ExpressionEngine) parseBasicLit(lit *ast.BasicLit) (interface{}, error) {
-	switch lit.Kind {
-	case token.INT:
-		return strconv.ParseInt(lit.Value, 10, 64)
-	case token.FLOAT:
-		return strconv.ParseFloat(lit.Value, 64)
-	case token.STRING:
-		// 去掉引号
-		return strconv.Unquote(lit.Value)
-	default:
-		return nil, fmt.Errorf("不支持的字面量类型: %s", lit.Kind)
-	}
-}
-
-// evaluateBinaryExpr 评估二元表达式
-func (e *ExpressionEngine) evaluateBinaryExpr(expr *ast.BinaryExpr) (interface{}, error) {
-	left, err := e.evaluateASTNode(expr.X)
-	if err != nil {
-		return nil, err
-	}
-	
-	right, err := e.evaluateASTNode(expr.Y)
-	if err != nil {
-		return nil, err
-	}
-	
-	return e.applyBinaryOperator(left, right, expr.Op)
-}
-
-// applyBinaryOperator 应用二元操作符，包含优先级和结果验证
-func (e *ExpressionEngine) applyBinaryOperator(left, right interface{}, op token.Token) (interface{}, error) {
-	// 预处理：对于逻辑操作符，支持短路评估
-	switch op {
-	case token.LAND:
-		// 短路评估：如果左操作数为false，直接返回false
-		if !toBool(left) {
-			return false, nil
-		}
-		return toBool(right), nil
-	case token.LOR:
-		// 短路评估：如果左操作数为true，直接返回true
-		if toBool(left) {
-			return true, nil
-		}
-		return toBool(right), nil
-	}
-	
-	// 处理其他操作符
-	switch op {
-	case token.ADD:
-		result, err := e.add(left, right)
-		if err != nil {
-			return nil, fmt.Errorf("加法操作失败: %v", err)
-		}
-		return result, nil
-	case token.SUB:
-		result, err := e.subtract(left, right)
-		if err != nil {
-			return nil, fmt.Errorf("减法操作失败: %v", err)
-		}
-		return result, nil
-	case token.MUL:
-		result, err := e.multiply(left, right)
-		if err != nil {
-			return nil, fmt.Errorf("乘法操作失败: %v", err)
-		}
-		return result, nil
-	case token.QUO:
-		result, err := e.divide(left, right)
-		if err != nil {
-			return nil, fmt.Errorf("除法操作失败: %v", err)
-		}
-		return result, nil
-	case token.REM:
-		result, err := e.modulo(left, right)
-		if err != nil {
-			return nil, fmt.Errorf("取模操作失败: %v", err)
-		}
-		return result, nil
-	case token.EQL:
-		return e.equal(left, right), nil
-	case token.NEQ:
-		return !e.equal(left, right), nil
-	case token.LSS:
-		result, err := e.less(left, right)
-		if err != nil {
-			return nil, fmt.Errorf("小于比较失败: %v", err)
-		}
-		return result, nil
-	case token.GTR:
-		result, err := e.greater(left, right)
-		if err != nil {
-			return nil, fmt.Errorf("大于比较失败: %v", err)
-		}
-		return result, nil
-	case token.LEQ:
-		result, err := e.lessEqual(left, right)
-		if err != nil {
-			return nil, fmt.Errorf("小于等于比较失败: %v", err)
-		}
-		return result, nil
-	case token.GEQ:
-		result, err := e.greaterEqual(left, right)
-		if err != nil {
-			return nil, fmt.Errorf("大于等于比较失败: %v", err)
-		}
-		return result, nil
-	default:
-		return nil, fmt.Errorf("不支持的二元操作符: %s", op)
-	}
-}
-
-// evaluateUnaryExpr 评估一元表达式
-func (e *ExpressionEngine) evaluateUnaryExpr(expr *ast.UnaryExpr) (interface{}, error) {
-	operand, err := e.evaluateASTNode(expr.X)
-	if err != nil {
-		return nil, err
-	}
-	
-	switch expr.Op {
-	case token.SUB:
-		if num, ok := toFloat64(operand); ok {
-			return -num, nil
-		}
-		return nil, fmt.Errorf("无法对非数值类型应用负号")
-	case token.NOT:
-		return !toBool(operand), nil
-	default:
-		return nil, fmt.Errorf("不支持的一元操作符: %s", expr.Op)
-	}
-}
-
-// evaluateSelectorExpr 评估选择器表达式（如 acceleration.x）
-func (e *ExpressionEngine) evaluateSelectorExpr(expr *ast.SelectorExpr) (interface{}, error) {
-	// 构造完整的字段名，如 "acceleration.x"
-	var baseName string
-	if ident, ok := expr.X.(*ast.Ident); ok {
-		baseName = ident.Name
-	} else {
-		return nil, fmt.Errorf("不支持的选择器基础类型: %T", expr.X)
-	}
-	
-	fieldName := baseName + "." + expr.Sel.Name
-	
-	// 查找变量
-	e.mu.RLock()
-	value, exists := e.variables[fieldName]
-	e.mu.RUnlock()
-	
-	if exists {
-		return value, nil
-	}
-	
-	// 提供更多诊断信息
-	availableVars := make([]string, 0)
-	for varName := range e.variables {
-		availableVars = append(availableVars, varName)
-	}
-	
-	if len(availableVars) == 0 {
-		return nil, fmt.Errorf("未定义的字段: %s (当前无任何可用变量)", fieldName)
-	}
-	
-	return nil, fmt.Errorf("未定义的字段: %s (可用变量: %v)", fieldName, availableVars)
-}
-
-// evaluateCallExpr 评估函数调用表达式
-func (e *ExpressionEngine) evaluateCallExpr(expr *ast.CallExpr) (interface{}, error) {
-	// 获取函数名
-	var funcName string
-	if ident, ok := expr.Fun.(*ast.Ident); ok {
-		funcName = ident.Name
-	} else {
-		return nil, fmt.Errorf("不支持的函数调用形式")
-	}
-	
-	// 处理特殊函数
-	if funcName == "__array__" {
-		// 处理数组字面量
-		var array []interface{}
-		for _, arg := range expr.Args {
-			value, err := e.evaluateASTNode(arg)
-			if err != nil {
-				return nil, err
-			}
-			array = append(array, value)
-		}
-		return array, nil
-	}
-	
-	if funcName == "__tag_access__" {
-		// 处理标签访问
-		if len(expr.Args) != 1 {
-			return nil, fmt.Errorf("__tag_access__函数需要1个参数")
-		}
-		
-		keyValue, err := e.evaluateASTNode(expr.Args[0])
-		if err != nil {
-			return nil, err
-		}
-		
-		keyStr, ok := keyValue.(string)
-		if !ok {
-			return nil, fmt.Errorf("标签键必须是字符串")
-		}
-		
-		// 从当前数据点的tags中获取值
-		e.mu.RLock()
-		if tags, exists := e.variables["tags"]; exists {
-			if tagsMap, ok := tags.(map[string]string); ok {
-				value, found := tagsMap[keyStr]
-				e.mu.RUnlock()
-				if found {
-					return value, nil
-				}
-				return "", nil // 标签不存在时返回空字符串
-			}
-		}
-		e.mu.RUnlock()
-		return "", nil
-	}
-	
-	// 查找普通函数
-	function, exists := e.functions[funcName]
-	if !exists {
-		return nil, fmt.Errorf("未定义的函数: %s", funcName)
-	}
-	
-	// 评估参数
-	var args []interface{}
-	for _, arg := range expr.Args {
-		value, err := e.evaluateASTNode(arg)
-		if err != nil {
-			return nil, err
-		}
-		args = append(args, value)
-	}
-	
-	// 调用函数
-	return function.Call(args...)
-}
-
 // evaluateCustomExpression 评估自定义表达式（复杂模式匹配等）
-func (e *ExpressionEngine) evaluateCustomExpression(expression string) (interface{}, error) {
+func (e *ExpressionEngine) evaluateCustomExpression(expression string, env *exprEnv) (interface{}, error) {
 	// 处理正则表达式匹配
 	if strings.HasPrefix(expression, "regex(") && strings.HasSuffix(expression, ")") {
-		return e.evaluateRegexExpression(expression)
+		return e.evaluateRegexExpression(expression, env)
 	}
 	
 	// 处理时间范围检查
@@ -824,7 +330,7 @@ func (e *ExpressionEngine) evaluateCustomExpression(expression string) (interfac
 }
 
 // evaluateRegexExpression 评估正则表达式
-func (e *ExpressionEngine) evaluateRegexExpression(expression string) (interface{}, error) {
+func (e *ExpressionEngine) evaluateRegexExpression(expression string, env *exprEnv) (interface{}, error) {
 	// 提取参数: regex(pattern, field)
 	content := expression[6 : len(expression)-1] // 去掉 "regex(" 和 ")"
 	parts := strings.Split(content, ",")
@@ -836,9 +342,7 @@ func (e *ExpressionEngine) evaluateRegexExpression(expression string) (interface
 	fieldName := strings.TrimSpace(parts[1])
 	
 	// 获取字段值
-	e.mu.RLock()
-	fieldValue, exists := e.variables[fieldName]
-	e.mu.RUnlock()
+	fieldValue, exists := env.lookup(fieldName)
 	if !exists {
 		return false, nil
 	}
@@ -906,132 +410,32 @@ func (e *ExpressionEngine) evaluateInArrayExpression(expression string) (interfa
 	return false, fmt.Errorf("in_array函数暂未实现")
 }
 
-// 数学运算函数
-func (e *ExpressionEngine) add(left, right interface{}) (interface{}, error) {
-	if leftNum, ok := toFloat64(left); ok {
-		if rightNum, ok := toFloat64(right); ok {
-			return leftNum + rightNum, nil
-		}
-	}
-	// 字符串连接
-	return fmt.Sprintf("%v%v", left, right), nil
-}
-
-func (e *ExpressionEngine) subtract(left, right interface{}) (interface{}, error) {
-	leftNum, leftOk := toFloat64(left)
-	rightNum, rightOk := toFloat64(right)
-	if !leftOk || !rightOk {
-		return nil, fmt.Errorf("减法操作需要数值类型")
-	}
-	return leftNum - rightNum, nil
-}
-
-func (e *ExpressionEngine) multiply(left, right interface{}) (interface{}, error) {
-	leftNum, leftOk := toFloat64(left)
-	rightNum, rightOk := toFloat64(right)
-	if !leftOk || !rightOk {
-		return nil, fmt.Errorf("乘法操作需要数值类型")
-	}
-	return leftNum * rightNum, nil
-}
-
-func (e *ExpressionEngine) divide(left, right interface{}) (interface{}, error) {
-	leftNum, leftOk := toFloat64(left)
-	rightNum, rightOk := toFloat64(right)
-	if !leftOk || !rightOk {
-		return nil, fmt.Errorf("除法操作需要数值类型")
-	}
-	if rightNum == 0 {
-		return nil, fmt.Errorf("除零错误")
-	}
-	result := leftNum / rightNum
-	
-	// 检查结果是否为有效数值
-	if math.IsNaN(result) || math.IsInf(result, 0) {
-		return nil, fmt.Errorf("除法运算产生无效结果")
-	}
-	
-	return result, nil
-}
-
-func (e *ExpressionEngine) modulo(left, right interface{}) (interface{}, error) {
-	leftNum, leftOk := toFloat64(left)
-	rightNum, rightOk := toFloat64(right)
-	if !leftOk || !rightOk {
-		return nil, fmt.Errorf("取模操作需要数值类型")
-	}
-	if rightNum == 0 {
-		return nil, fmt.Errorf("除零错误")
-	}
-	return math.Mod(leftNum, rightNum), nil
-}
-
-// 比较函数
-func (e *ExpressionEngine) equal(left, right interface{}) bool {
-	result := compareValues(left, right)
-	if result == -2 { // NaN参与比较，根据IEEE 754标准返回false
-		return false
-	}
-	return result == 0
-}
-
-func (e *ExpressionEngine) less(left, right interface{}) (bool, error) {
-	result := compareValues(left, right)
-	if result == -2 { // NaN参与比较，根据IEEE 754标准返回false
-		return false, nil
-	}
-	return result < 0, nil
-}
-
-func (e *ExpressionEngine) greater(left, right interface{}) (bool, error) {
-	result := compareValues(left, right)
-	if result == -2 { // NaN参与比较，根据IEEE 754标准返回false
-		return false, nil
-	}
-	return result > 0, nil
-}
-
-func (e *ExpressionEngine) lessEqual(left, right interface{}) (bool, error) {
-	result := compareValues(left, right)
-	if result == -2 { // NaN参与比较，根据IEEE 754标准返回false
-		return false, nil
-	}
-	return result <= 0, nil
-}
-
-func (e *ExpressionEngine) greaterEqual(left, right interface{}) (bool, error) {
-	result := compareValues(left, right)
-	if result == -2 { // NaN参与比较，根据IEEE 754标准返回false
-		return false, nil
-	}
-	return result >= 0, nil
-}
-
-// 逻辑函数
-func (e *ExpressionEngine) logicalAnd(left, right interface{}) bool {
-	return toBool(left) && toBool(right)
-}
-
-func (e *ExpressionEngine) logicalOr(left, right interface{}) bool {
-	return toBool(left) || toBool(right)
-}
-
-// RegisterFunction 注册自定义函数
+// RegisterFunction 注册自定义函数，注册到共享的函数注册表，对所有引擎和条件评估器生效
 func (e *ExpressionEngine) RegisterFunction(fn ExprFunction) {
-	e.functions[fn.Name()] = fn
+	e.functions.Register(fn)
 }
 
 // SetVariable 设置变量
 func (e *ExpressionEngine) SetVariable(name string, value interface{}) {
-	e.mu.Lock()
-	defer e.mu.Unlock()
-	e.variables[name] = value
+	for {
+		old := e.variables.Load()
+		vars := make(map[string]interface{})
+		if old != nil {
+			for k, v := range *old {
+				vars[k] = v
+			}
+		}
+		vars[name] = value
+		if e.variables.CompareAndSwap(old, &vars) {
+			return
+		}
+	}
 }
 
 // initializeGeoData 初始化地理区域数据
-func (e *ExpressionEngine) initializeGeoData() {
+func initializeGeoData(geoProcessor *geo.GeoProcessor) {
 	// 添加一些常用的中国城市区域
-	e.geoProcessor.AddRegion(&geo.Region{
+	geoProcessor.AddRegion(&geo.Region{
 		Name: "北京",
 		Center: geo.Coordinate{
 			Latitude:  39.9042,
@@ -1040,7 +444,7 @@ func (e *ExpressionEngine) initializeGeoData() {
 		Radius: 50, // 50公里半径
 	})
 	
-	e.geoProcessor.AddRegion(&geo.Region{
+	geoProcessor.AddRegion(&geo.Region{
 		Name: "上海",
 		Center: geo.Coordinate{
 			Latitude:  31.2304,
@@ -1049,7 +453,7 @@ func (e *ExpressionEngine) initializeGeoData() {
 		Radius: 40,
 	})
 	
-	e.geoProcessor.AddRegion(&geo.Region{
+	geoProcessor.AddRegion(&geo.Region{
 		Name: "深圳",
 		Center: geo.Coordinate{
 			Latitude:  22.5431,
@@ -1058,7 +462,7 @@ func (e *ExpressionEngine) initializeGeoData() {
 		Radius: 30,
 	})
 	
-	e.geoProcessor.AddRegion(&geo.Region{
+	geoProcessor.AddRegion(&geo.Region{
 		Name: "广州",
 		Center: geo.Coordinate{
 			Latitude:  23.1291,
@@ -1067,7 +471,7 @@ func (e *ExpressionEngine) initializeGeoData() {
 		Radius: 35,
 	})
 	
-	e.geoProcessor.AddRegion(&geo.Region{
+	geoProcessor.AddRegion(&geo.Region{
 		Name: "杭州",
 		Center: geo.Coordinate{
 			Latitude:  30.2741,
@@ -1078,110 +482,115 @@ func (e *ExpressionEngine) initializeGeoData() {
 }
 
 // registerBuiltinFunctions 注册内置函数
-func (e *ExpressionEngine) registerBuiltinFunctions() {
+func registerBuiltinFunctions(r *FunctionRegistry, geoProcessor *geo.GeoProcessor) {
 	// 数学函数 - 使用优化版本
-	e.RegisterFunction(&MathAbsFunction{})
-	e.RegisterFunction(&MathMaxFunction{})
-	e.RegisterFunction(&MathMinFunction{})
-	e.RegisterFunction(&MathSqrtFunction{})
-	e.RegisterFunction(&MathPowFunction{})
-	e.RegisterFunction(&MathFloorFunction{})
-	e.RegisterFunction(&MathCeilFunction{})
+	r.Register(&MathAbsFunction{})
+	r.Register(&MathMaxFunction{})
+	r.Register(&MathMinFunction{})
+	r.Register(&MathSqrtFunction{})
+	r.Register(&MathPowFunction{})
+	r.Register(&MathFloorFunction{})
+	r.Register(&MathCeilFunction{})
 	
 	// 字符串函数
-	e.RegisterFunction(&StringLenFunction{})
-	e.RegisterFunction(&StringUpperFunction{})
-	e.RegisterFunction(&StringLowerFunction{})
-	e.RegisterFunction(&StringContainsFunction{})
-	e.RegisterFunction(&StringStartsWithFunction{})
-	e.RegisterFunction(&StringEndsWithFunction{})
+	r.Register(&StringLenFunction{})
+	r.Register(&StringUpperFunction{})
+	r.Register(&StringLowerFunction{})
+	r.Register(&StringContainsFunction{})
+	r.Register(&StringStartsWithFunction{})
+	r.Register(&StringEndsWithFunction{})
 	
 	// 数据检查函数
-	e.RegisterFunction(&ExistsFunction{engine: e})
+	r.Register(&ExistsFunction{})
 	
 	// 时间函数
-	e.RegisterFunction(&TimeNowFunction{})
-	e.RegisterFunction(&TimeFormatFunction{})
-	e.RegisterFunction(&TimeDiffFunction{})
-	e.RegisterFunction(&TimeRangeFunction{})
+	r.Register(&TimeNowFunction{})
+	r.Register(&TimeFormatFunction{})
+	r.Register(&TimeDiffFunction{})
+	r.Register(&TimeRangeFunction{})
 	
 	// 类型转换函数
-	e.RegisterFunction(&ConvertToStringFunction{})
-	e.RegisterFunction(&ConvertToNumberFunction{})
-	e.RegisterFunction(&ConvertToBoolFunction{})
+	r.Register(&ConvertToStringFunction{})
+	r.Register(&ConvertToNumberFunction{})
+	r.Register(&ConvertToBoolFunction{})
 	
 	// 统计函数
-	e.RegisterFunction(&AvgFunction{})
-	e.RegisterFunction(&StddevFunction{})
+	r.Register(&AvgFunction{})
+	r.Register(&StddevFunction{})
 	
 	// 数据质量检测函数
-	e.RegisterFunction(&IsNaNFunction{})
-	e.RegisterFunction(&IsInfFunction{})
-	e.RegisterFunction(&IsFiniteFunction{})
+	r.Register(&IsNaNFunction{})
+	r.Register(&IsInfFunction{})
+	r.Register(&IsFiniteFunction{})
 	
 	// 模式匹配函数
-	e.RegisterFunction(&RegexFunction{})
+	r.Register(&RegexFunction{})
+	
+	// 跨设备最新值函数
+	r.Register(&LastValueFunction{cache: globalLastValueCache})
+	r.Register(&AgeFunction{cache: globalLastValueCache})
+	r.Register(&AvgOverFunction{cache: globalLastValueCache})
 	
 	// 地理数据处理函数
-	if e.geoProcessor != nil {
-		e.RegisterFunction(geo.NewDistanceFunction(e.geoProcessor))
-		e.RegisterFunction(geo.NewInRegionFunction(e.geoProcessor))
-		e.RegisterFunction(geo.NewNearestRegionFunction(e.geoProcessor))
-		e.RegisterFunction(geo.NewBearingFunction(e.geoProcessor))
-		e.RegisterFunction(geo.NewValidCoordinateFunction(e.geoProcessor))
+	if geoProcessor != nil {
+		r.Register(geo.NewDistanceFunction(geoProcessor))
+		r.Register(geo.NewInRegionFunction(geoProcessor))
+		r.Register(geo.NewNearestRegionFunction(geoProcessor))
+		r.Register(geo.NewBearingFunction(geoProcessor))
+		r.Register(geo.NewValidCoordinateFunction(geoProcessor))
 	}
 	
 	// 向量函数
-	e.RegisterFunction(&VectorMagnitudeFunction{})
-	e.RegisterFunction(&VectorDotProductFunction{})
-	e.RegisterFunction(&VectorCrossProductFunction{})
-	e.RegisterFunction(&VectorNormalizeFunction{})
-	e.RegisterFunction(&VectorAngleFunction{})
-	e.RegisterFunction(&VectorDistanceFunction{})
+	r.Register(&VectorMagnitudeFunction{})
+	r.Register(&VectorDotProductFunction{})
+	r.Register(&VectorCrossProductFunction{})
+	r.Register(&VectorNormalizeFunction{})
+	r.Register(&VectorAngleFunction{})
+	r.Register(&VectorDistanceFunction{})
 	
 	// 通用复合数据函数
-	e.RegisterFunction(&GenericVectorMagnitudeFunction{})
-	e.RegisterFunction(&GenericVectorSumFunction{})
-	e.RegisterFunction(&GenericVectorMeanFunction{})
-	e.RegisterFunction(&GenericVectorMinFunction{})
-	e.RegisterFunction(&GenericVectorMaxFunction{})
-	e.RegisterFunction(&GenericVectorDotProductFunction{})
-	e.RegisterFunction(&GenericVectorNormalizeFunction{})
+	r.Register(&GenericVectorMagnitudeFunction{})
+	r.Register(&GenericVectorSumFunction{})
+	r.Register(&GenericVectorMeanFunction{})
+	r.Register(&GenericVectorMinFunction{})
+	r.Register(&GenericVectorMaxFunction{})
+	r.Register(&GenericVectorDotProductFunction{})
+	r.Register(&GenericVectorNormalizeFunction{})
 	
 	// 数组函数
-	e.RegisterFunction(&ArrayLengthFunction{})
-	e.RegisterFunction(&ArraySumFunction{})
-	e.RegisterFunction(&ArrayMeanFunction{})
-	e.RegisterFunction(&ArrayMinFunction{})
-	e.RegisterFunction(&ArrayMaxFunction{})
-	e.RegisterFunction(&ArrayCountFunction{})
-	e.RegisterFunction(&ArrayGetFunction{})
+	r.Register(&ArrayLengthFunction{})
+	r.Register(&ArraySumFunction{})
+	r.Register(&ArrayMeanFunction{})
+	r.Register(&ArrayMinFunction{})
+	r.Register(&ArrayMaxFunction{})
+	r.Register(&ArrayCountFunction{})
+	r.Register(&ArrayGetFunction{})
 	
 	// 矩阵函数
-	e.RegisterFunction(&MatrixTraceFunction{})
-	e.RegisterFunction(&MatrixDeterminantFunction{})
-	e.RegisterFunction(&MatrixSumFunction{})
-	e.RegisterFunction(&MatrixMeanFunction{})
-	e.RegisterFunction(&MatrixGetFunction{})
+	r.Register(&MatrixTraceFunction{})
+	r.Register(&MatrixDeterminantFunction{})
+	r.Register(&MatrixSumFunction{})
+	r.Register(&MatrixMeanFunction{})
+	r.Register(&MatrixGetFunction{})
 	
 	// 时间序列函数
-	e.RegisterFunction(&TimeSeriesLengthFunction{})
-	e.RegisterFunction(&TimeSeriesMeanFunction{})
-	e.RegisterFunction(&TimeSeriesMinFunction{})
-	e.RegisterFunction(&TimeSeriesMaxFunction{})
-	e.RegisterFunction(&TimeSeriesTrendFunction{})
-	e.RegisterFunction(&TimeSeriesVarianceFunction{})
-	e.RegisterFunction(&TimeSeriesStdDevFunction{})
+	r.Register(&TimeSeriesLengthFunction{})
+	r.Register(&TimeSeriesMeanFunction{})
+	r.Register(&TimeSeriesMinFunction{})
+	r.Register(&TimeSeriesMaxFunction{})
+	r.Register(&TimeSeriesTrendFunction{})
+	r.Register(&TimeSeriesVarianceFunction{})
+	r.Register(&TimeSeriesStdDevFunction{})
 	
 	// Vector3D专用函数
-	e.RegisterFunction(&Vector3DMagnitudeFunction{})
-	e.RegisterFunction(&Vector3DDotProductFunction{})
-	e.RegisterFunction(&Vector3DCrossProductFunction{})
+	r.Register(&Vector3DMagnitudeFunction{})
+	r.Register(&Vector3DDotProductFunction{})
+	r.Register(&Vector3DCrossProductFunction{})
 	
 	// 通用复合数据实用函数
-	e.RegisterFunction(&CompositeDataTypeFunction{})
-	e.RegisterFunction(&CompositeDataSizeFunction{})
-	e.RegisterFunction(&CompositeDataValidateFunction{})
+	r.Register(&CompositeDataTypeFunction{})
+	r.Register(&CompositeDataSizeFunction{})
+	r.Register(&CompositeDataValidateFunction{})
 }
 
 // 内置函数实现
@@ -1424,12 +833,15 @@ func (f *StringEndsWithFunction) Call(args ...interface{}) (interface{}, error)
 }
 
 // 数据检查函数
-type ExistsFunction struct {
-	engine *ExpressionEngine // 引用表达式引擎以访问变量
-}
+type ExistsFunction struct{}
 func (f *ExistsFunction) Name() string { return "exists" }
 func (f *ExistsFunction) Description() string { return "检查指定字段是否存在" }
 func (f *ExistsFunction) Call(args ...interface{}) (interface{}, error) {
+	return f.callWithEnv(nil, args)
+}
+
+// callWithEnv 在当前评估环境中检查字段
+func (f *ExistsFunction) callWithEnv(env *exprEnv, args []interface{}) (interface{}, error) {
 	if len(args) != 1 {
 		return nil, fmt.Errorf("exists函数需要1个参数")
 	}
@@ -1442,16 +854,13 @@ func (f *ExistsFunction) Call(args ...interface{}) (interface{}, error) {
 	fieldName := fmt.Sprintf("%v", args[0])
 	
 	// 检查当前数据点中是否存在该字段
-	if f.engine != nil {
-		f.engine.mu.RLock()
-		_, exists := f.engine.variables[fieldName]
-		f.engine.mu.RUnlock()
-		if exists {
+	if env != nil {
+		if _, exists := env.lookup(fieldName); exists {
 			return true, nil
 		}
 		
 		// 检查是否是当前数据点的key
-		if currentKey, ok := f.engine.variables["key"]; ok && currentKey == fieldName {
+		if env.point.Key == fieldName {
 			return true, nil
 		}
 	}
@@ -0,0 +1,902 @@
+package rules
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/y001j/iot-gateway/internal/model"
+	"github.com/y001j/iot-gateway/internal/rules/geo"
+)
+
+// FunctionRegistry 表达式函数注册表，条件评估器和表达式引擎共用同一个注册表
+type FunctionRegistry struct {
+	mu        sync.RWMutex
+	functions map[string]ExprFunction
+}
+
+// NewFunctionRegistry 创建空的函数注册表
+func NewFunctionRegistry() *FunctionRegistry {
+	return &FunctionRegistry{functions: make(map[string]ExprFunction)}
+}
+
+// Register 注册函数，同名函数会被替换。已编译的表达式在编译时绑定函数，
+// 自定义函数应在规则加载前注册
+func (r *FunctionRegistry) Register(fn ExprFunction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.functions[fn.Name()] = fn
+}
+
+// Lookup 查找函数
+func (r *FunctionRegistry) Lookup(name string) (ExprFunction, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	fn, ok := r.functions[name]
+	return fn, ok
+}
+
+// Names 返回已注册的函数名，按字母排序
+func (r *FunctionRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.functions))
+	for name := range r.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var (
+	defaultFunctionsOnce sync.Once
+	defaultFunctions     *FunctionRegistry
+	defaultGeoProcessor  *geo.GeoProcessor
+)
+
+// DefaultFunctions 返回内置函数注册表
+func DefaultFunctions() *FunctionRegistry {
+	defaultFunctionsOnce.Do(func() {
+		defaultGeoProcessor = geo.NewGeoProcessor()
+		initializeGeoData(defaultGeoProcessor)
+		defaultFunctions = NewFunctionRegistry()
+		registerBuiltinFunctions(defaultFunctions, defaultGeoProcessor)
+	})
+	return defaultFunctions
+}
+
+// envFunction 需要访问当前评估环境的函数（如exists）
+type envFunction interface {
+	callWithEnv(env *exprEnv, args []interface{}) (interface{}, error)
+}
+
+// ExpressionError 表达式编译错误，位置为原始表达式中的行列（从1开始）
+type ExpressionError struct {
+	Expression string `json:"expression"`
+	Kind       string `json:"kind"` // 语法错误、类型错误、编译错误
+	Line       int    `json:"line"`
+	Column     int    `json:"column"`
+	Message    string `json:"message"`
+}
+
+func (e *ExpressionError) Error() string {
+	return fmt.Sprintf("表达式%s(第%d行第%d列): %s", e.Kind, e.Line, e.Column, e.Message)
+}
+
+// 表达式错误类型
+const (
+	ExprErrorSyntax  = "语法错误"
+	ExprErrorType    = "类型错误"
+	ExprErrorCompile = "编译错误"
+)
+
+// exprKind 编译期推断的值类型
+type exprKind uint8
+
+const (
+	kindAny exprKind = iota
+	kindNumber
+	kindString
+	kindBool
+)
+
+func (k exprKind) String() string {
+	switch k {
+	case kindNumber:
+		return "数值"
+	case kindString:
+		return "字符串"
+	case kindBool:
+		return "布尔"
+	default:
+		return "任意类型"
+	}
+}
+
+// pointVariableKinds 数据点内置变量的类型，未列出的变量在运行时解析
+var pointVariableKinds = map[string]exprKind{
+	"device_id":           kindString,
+	"key":                 kindString,
+	"type":                kindString,
+	"quality":             kindNumber,
+	"timestamp_unix":      kindNumber,
+	"timestamp_string":    kindString,
+	"timestamp_year":      kindNumber,
+	"timestamp_month":     kindNumber,
+	"timestamp_day":       kindNumber,
+	"timestamp_hour":      kindNumber,
+	"timestamp_minute":    kindNumber,
+	"timestamp_second":    kindNumber,
+	"hour":                kindNumber,
+	"minute":              kindNumber,
+	"weekday":             kindNumber,
+	"num_value":           kindNumber,
+	"emergency_threshold": kindNumber,
+	"avg_threshold":       kindNumber,
+}
+
+// exprEval 编译后的节点求值函数
+type exprEval func(env *exprEnv) (interface{}, error)
+
+// exprNode 编译后的表达式节点
+type exprNode struct {
+	eval     exprEval
+	kind     exprKind
+	constant bool
+	value    interface{}
+}
+
+func constNode(value interface{}) *exprNode {
+	return &exprNode{
+		eval:     func(*exprEnv) (interface{}, error) { return value, nil },
+		kind:     kindOf(value),
+		constant: true,
+		value:    value,
+	}
+}
+
+func kindOf(value interface{}) exprKind {
+	switch v := value.(type) {
+	case bool:
+		return kindBool
+	case string:
+		// 数字字符串在运算中按数值处理
+		if _, ok := toFloat64(v); ok {
+			return kindAny
+		}
+		return kindString
+	case int64, float64:
+		return kindNumber
+	default:
+		return kindAny
+	}
+}
+
+// CompiledExpression 编译后的表达式，可被多个goroutine并发评估
+type CompiledExpression struct {
+	source string
+	root   *exprNode
+}
+
+// Source 返回表达式源码
+func (c *CompiledExpression) Source() string {
+	return c.source
+}
+
+// Evaluate 使用数据点和附加变量评估表达式，vars在评估期间只读
+func (c *CompiledExpression) Evaluate(point model.Point, vars map[string]interface{}) (interface{}, error) {
+	env := &exprEnv{point: &point, vars: vars}
+	return c.root.eval(env)
+}
+
+// CompileExpression 编译表达式，使用内置函数注册表。
+// 规则的表达式在验证时编译并保存在条件上，随规则一起替换和删除
+func CompileExpression(expression string) (*CompiledExpression, error) {
+	return compileExpression(expression, DefaultFunctions())
+}
+
+func compileExpression(expression string, functions *FunctionRegistry) (*CompiledExpression, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, &ExpressionError{Expression: expression, Kind: ExprErrorSyntax, Line: 1, Column: 1, Message: "表达式不能为空"}
+	}
+
+	src := preprocessExpression(expression)
+	c := &exprCompiler{
+		fset:       token.NewFileSet(),
+		expression: expression,
+		src:        src,
+		functions:  functions,
+	}
+	node, err := parser.ParseExprFrom(c.fset, "", src.text, 0)
+	if err != nil {
+		if list, ok := err.(scanner.ErrorList); ok && len(list) > 0 {
+			return nil, c.errorAt(list[0].Pos.Offset, ExprErrorSyntax, "%s", list[0].Msg)
+		}
+		return nil, c.errorAt(0, ExprErrorSyntax, "%v", err)
+	}
+
+	root, err := c.compile(node)
+	if err != nil {
+		return nil, err
+	}
+	return &CompiledExpression{source: expression, root: root}, nil
+}
+
+// exprSource 预处理后的表达式，offsets记录每个字节对应的原始表达式偏移
+type exprSource struct {
+	text    string
+	offsets []int
+}
+
+// preprocessExpression 将表达式转换为Go表达式语法：
+// 单引号字符串转为双引号，[a, b]转为__array__(a, b)，tags.key转为__tag_access__("key")
+func preprocessExpression(expression string) exprSource {
+	var b strings.Builder
+	offsets := make([]int, 0, len(expression)+16)
+	emit := func(s string, offset int) {
+		b.WriteString(s)
+		for i := 0; i < len(s); i++ {
+			offsets = append(offsets, offset)
+		}
+	}
+
+	var brackets []bool // true表示数组字面量
+	var prev byte       // 上一个非空白字符
+	for i := 0; i < len(expression); i++ {
+		ch := expression[i]
+		switch {
+		case ch == '\'' || ch == '"':
+			// 字符串字面量统一为双引号
+			emit(`"`, i)
+			j := i + 1
+			for ; j < len(expression) && expression[j] != ch; j++ {
+				switch {
+				case expression[j] == '\\' && j+1 < len(expression) && expression[j+1] == '\'':
+					// 双引号字符串中不能转义单引号
+					emit("'", j)
+					j++
+				case expression[j] == '\\' && j+1 < len(expression):
+					emit(expression[j:j+2], j)
+					j++
+				case expression[j] == '"':
+					emit(`\"`, j)
+				default:
+					emit(expression[j:j+1], j)
+				}
+			}
+			if j < len(expression) {
+				emit(`"`, j)
+			}
+			i = j
+			prev = '"'
+			continue
+		case ch == '[':
+			literal := !(isIdentByte(prev) || prev == ')' || prev == ']' || prev == '"')
+			brackets = append(brackets, literal)
+			if literal {
+				emit("__array__(", i)
+			} else {
+				emit("[", i)
+			}
+		case ch == ']':
+			literal := false
+			if n := len(brackets); n > 0 {
+				literal = brackets[n-1]
+				brackets = brackets[:n-1]
+			}
+			if literal {
+				emit(")", i)
+			} else {
+				emit("]", i)
+			}
+		case ch == 't' && (i == 0 || !isIdentByte(expression[i-1])) && strings.HasPrefix(expression[i:], "tags."):
+			// tags.key 中的key可能是Go关键字（如tags.type），在解析前改写
+			end := i + len("tags.")
+			for end < len(expression) && isIdentByte(expression[end]) {
+				end++
+			}
+			if end == i+len("tags.") {
+				emit(expression[i:i+1], i)
+				break
+			}
+			emit(`__tag_access__("`+expression[i+len("tags."):end]+`")`, i)
+			i = end - 1
+			prev = ')'
+			continue
+		default:
+			emit(expression[i:i+1], i)
+		}
+		if ch != ' ' && ch != '\t' && ch != '\n' && ch != '\r' {
+			prev = ch
+		}
+	}
+	offsets = append(offsets, len(expression))
+	return exprSource{text: b.String(), offsets: offsets}
+}
+
+func isIdentByte(ch byte) bool {
+	return ch == '_' || ch >= 0x80 || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+}
+
+// exprCompiler 把Go表达式AST编译为闭包树
+type exprCompiler struct {
+	fset       *token.FileSet
+	expression string
+	src        exprSource
+	functions  *FunctionRegistry
+}
+
+// errorAt 生成位置为预处理后偏移的编译错误
+func (c *exprCompiler) errorAt(offset int, kind, format string, args ...interface{}) *ExpressionError {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(c.src.offsets) {
+		offset = len(c.src.offsets) - 1
+	}
+	original := c.src.offsets[offset]
+	prefix := c.expression[:original]
+	line := strings.Count(prefix, "\n") + 1
+	if idx := strings.LastIndexByte(prefix, '\n'); idx >= 0 {
+		prefix = prefix[idx+1:]
+	}
+	return &ExpressionError{
+		Expression: c.expression,
+		Kind:       kind,
+		Line:       line,
+		Column:     utf8.RuneCountInString(prefix) + 1,
+		Message:    fmt.Sprintf(format, args...),
+	}
+}
+
+func (c *exprCompiler) errorf(pos token.Pos, kind, format string, args ...interface{}) *ExpressionError {
+	return c.errorAt(c.fset.Position(pos).Offset, kind, format, args...)
+}
+
+// fold 所有操作数为常量时在编译期求值
+func (c *exprCompiler) fold(node *exprNode, pos token.Pos, operands ...*exprNode) (*exprNode, error) {
+	for _, operand := range operands {
+		if !operand.constant {
+			return node, nil
+		}
+	}
+	value, err := node.eval(nil)
+	if err != nil {
+		return nil, c.errorf(pos, ExprErrorCompile, "%v", err)
+	}
+	folded := constNode(value)
+	if node.kind != kindAny {
+		folded.kind = node.kind
+	}
+	return folded, nil
+}
+
+func (c *exprCompiler) compile(node ast.Expr) (*exprNode, error) {
+	switch n := node.(type) {
+	case *ast.BasicLit:
+		return c.compileBasicLit(n)
+	case *ast.Ident:
+		return c.compileIdent(n), nil
+	case *ast.ParenExpr:
+		return c.compile(n.X)
+	case *ast.UnaryExpr:
+		return c.compileUnary(n)
+	case *ast.BinaryExpr:
+		return c.compileBinary(n)
+	case *ast.SelectorExpr:
+		return c.compileSelector(n)
+	case *ast.IndexExpr:
+		return c.compileIndex(n)
+	case *ast.CallExpr:
+		return c.compileCall(n)
+	default:
+		return nil, c.errorf(node.Pos(), ExprErrorCompile, "不支持的表达式类型: %T", node)
+	}
+}
+
+func (c *exprCompiler) compileBasicLit(lit *ast.BasicLit) (*exprNode, error) {
+	switch lit.Kind {
+	case token.INT:
+		value, err := strconv.ParseInt(lit.Value, 10, 64)
+		if err != nil {
+			return nil, c.errorf(lit.Pos(), ExprErrorSyntax, "无效的整数: %s", lit.Value)
+		}
+		return constNode(value), nil
+	case token.FLOAT:
+		value, err := strconv.ParseFloat(lit.Value, 64)
+		if err != nil {
+			return nil, c.errorf(lit.Pos(), ExprErrorSyntax, "无效的数值: %s", lit.Value)
+		}
+		return constNode(value), nil
+	case token.STRING:
+		value, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return nil, c.errorf(lit.Pos(), ExprErrorSyntax, "无效的字符串: %s", lit.Value)
+		}
+		return constNode(value), nil
+	default:
+		return nil, c.errorf(lit.Pos(), ExprErrorCompile, "不支持的字面量类型: %s", lit.Kind)
+	}
+}
+
+func (c *exprCompiler) compileIdent(ident *ast.Ident) *exprNode {
+	switch ident.Name {
+	case "true":
+		return constNode(true)
+	case "false":
+		return constNode(false)
+	}
+	name := ident.Name
+	return &exprNode{
+		kind: pointVariableKinds[name],
+		eval: func(env *exprEnv) (interface{}, error) {
+			if value, ok := env.lookup(name); ok {
+				return value, nil
+			}
+			return nil, fmt.Errorf("未定义的变量: %s", name)
+		},
+	}
+}
+
+func (c *exprCompiler) compileUnary(expr *ast.UnaryExpr) (*exprNode, error) {
+	operand, err := c.compile(expr.X)
+	if err != nil {
+		return nil, err
+	}
+	x := operand.eval
+
+	var node *exprNode
+	switch expr.Op {
+	case token.SUB:
+		if operand.kind == kindString {
+			return nil, c.errorf(expr.OpPos, ExprErrorType, "负号不能用于%s", operand.kind)
+		}
+		node = &exprNode{kind: kindNumber, eval: func(env *exprEnv) (interface{}, error) {
+			value, err := x(env)
+			if err != nil {
+				return nil, err
+			}
+			if num, ok := toFloat64(value); ok {
+				return -num, nil
+			}
+			return nil, fmt.Errorf("无法对非数值类型应用负号")
+		}}
+	case token.NOT:
+		node = &exprNode{kind: kindBool, eval: func(env *exprEnv) (interface{}, error) {
+			value, err := x(env)
+			if err != nil {
+				return nil, err
+			}
+			return !toBool(value), nil
+		}}
+	default:
+		return nil, c.errorf(expr.OpPos, ExprErrorCompile, "不支持的一元操作符: %s", expr.Op)
+	}
+	return c.fold(node, expr.OpPos, operand)
+}
+
+// arithmeticOps 算术操作符及其运行时错误描述
+var arithmeticOps = map[token.Token]struct {
+	name string
+	fn   func(left, right interface{}) (interface{}, error)
+}{
+	token.ADD: {"加法", exprAdd},
+	token.SUB: {"减法", exprSubtract},
+	token.MUL: {"乘法", exprMultiply},
+	token.QUO: {"除法", exprDivide},
+	token.REM: {"取模", exprModulo},
+}
+
+// comparisonOps 比较操作符，参数为compareValues的结果（-2表示NaN参与比较）
+var comparisonOps = map[token.Token]func(result int) bool{
+	token.EQL: func(r int) bool { return r == 0 },
+	token.NEQ: func(r int) bool { return r != 0 },
+	token.LSS: func(r int) bool { return r != -2 && r < 0 },
+	token.GTR: func(r int) bool { return r != -2 && r > 0 },
+	token.LEQ: func(r int) bool { return r != -2 && r <= 0 },
+	token.GEQ: func(r int) bool { return r != -2 && r >= 0 },
+}
+
+func (c *exprCompiler) compileBinary(expr *ast.BinaryExpr) (*exprNode, error) {
+	left, err := c.compile(expr.X)
+	if err != nil {
+		return nil, err
+	}
+	right, err := c.compile(expr.Y)
+	if err != nil {
+		return nil, err
+	}
+	x, y := left.eval, right.eval
+
+	var node *exprNode
+	switch expr.Op {
+	case token.LAND, token.LOR:
+		// 短路评估
+		isAnd := expr.Op == token.LAND
+		node = &exprNode{kind: kindBool, eval: func(env *exprEnv) (interface{}, error) {
+			lv, err := x(env)
+			if err != nil {
+				return nil, err
+			}
+			if toBool(lv) != isAnd {
+				return !isAnd, nil
+			}
+			rv, err := y(env)
+			if err != nil {
+				return nil, err
+			}
+			return toBool(rv), nil
+		}}
+
+	case token.ADD, token.SUB, token.MUL, token.QUO, token.REM:
+		op := arithmeticOps[expr.Op]
+		kind := kindNumber
+		if expr.Op == token.ADD {
+			// 加法在任一操作数不是数值时为字符串连接
+			switch {
+			case left.kind == kindString || right.kind == kindString:
+				kind = kindString
+			case left.kind == kindAny || right.kind == kindAny:
+				kind = kindAny
+			}
+		} else {
+			for _, operand := range []*exprNode{left, right} {
+				if operand.kind == kindString {
+					return nil, c.errorf(expr.OpPos, ExprErrorType, "%s操作需要数值类型，操作数为%s", op.name, operand.kind)
+				}
+			}
+		}
+		node = &exprNode{kind: kind, eval: func(env *exprEnv) (interface{}, error) {
+			lv, err := x(env)
+			if err != nil {
+				return nil, err
+			}
+			rv, err := y(env)
+			if err != nil {
+				return nil, err
+			}
+			result, err := op.fn(lv, rv)
+			if err != nil {
+				return nil, fmt.Errorf("%s操作失败: %v", op.name, err)
+			}
+			return result, nil
+		}}
+
+	case token.EQL, token.NEQ, token.LSS, token.GTR, token.LEQ, token.GEQ:
+		if expr.Op != token.EQL && expr.Op != token.NEQ &&
+			((left.kind == kindString && right.kind == kindNumber) || (left.kind == kindNumber && right.kind == kindString)) {
+			return nil, c.errorf(expr.OpPos, ExprErrorType, "无法使用%s比较%s和%s", expr.Op, left.kind, right.kind)
+		}
+		cmp := comparisonOps[expr.Op]
+		node = &exprNode{kind: kindBool, eval: func(env *exprEnv) (interface{}, error) {
+			lv, err := x(env)
+			if err != nil {
+				return nil, err
+			}
+			rv, err := y(env)
+			if err != nil {
+				return nil, err
+			}
+			return cmp(compareValues(lv, rv)), nil
+		}}
+
+	default:
+		return nil, c.errorf(expr.OpPos, ExprErrorCompile, "不支持的二元操作符: %s", expr.Op)
+	}
+	return c.fold(node, expr.OpPos, left, right)
+}
+
+// compileSelector 编译字段访问，如 acceleration.x 或 tags.key
+func (c *exprCompiler) compileSelector(expr *ast.SelectorExpr) (*exprNode, error) {
+	ident, ok := expr.X.(*ast.Ident)
+	if !ok {
+		return nil, c.errorf(expr.Sel.Pos(), ExprErrorCompile, "不支持多级字段访问: %s", expr.Sel.Name)
+	}
+	if ident.Name == "tags" {
+		return tagAccessNode(constNode(expr.Sel.Name).eval), nil
+	}
+	fieldName := ident.Name + "." + expr.Sel.Name
+	return &exprNode{eval: func(env *exprEnv) (interface{}, error) {
+		if value, ok := env.lookup(fieldName); ok {
+			return value, nil
+		}
+		return nil, fmt.Errorf("未定义的字段: %s", fieldName)
+	}}, nil
+}
+
+// compileIndex 编译 tags['key'] 形式的标签访问
+func (c *exprCompiler) compileIndex(expr *ast.IndexExpr) (*exprNode, error) {
+	ident, ok := expr.X.(*ast.Ident)
+	if !ok || ident.Name != "tags" {
+		return nil, c.errorf(expr.Lbrack, ExprErrorCompile, "仅支持tags[...]形式的索引访问")
+	}
+	index, err := c.compile(expr.Index)
+	if err != nil {
+		return nil, err
+	}
+	if index.kind == kindNumber || index.kind == kindBool {
+		return nil, c.errorf(expr.Index.Pos(), ExprErrorType, "标签键必须是字符串，实际为%s", index.kind)
+	}
+	return tagAccessNode(index.eval), nil
+}
+
+// tagAccessNode 读取当前数据点的标签，标签不存在时返回空字符串
+func tagAccessNode(key exprEval) *exprNode {
+	return &exprNode{kind: kindString, eval: func(env *exprEnv) (interface{}, error) {
+		k, err := key(env)
+		if err != nil {
+			return nil, err
+		}
+		keyStr, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("标签键必须是字符串")
+		}
+		return env.tagMap()[keyStr], nil
+	}}
+}
+
+func (c *exprCompiler) compileCall(expr *ast.CallExpr) (*exprNode, error) {
+	ident, ok := expr.Fun.(*ast.Ident)
+	if !ok {
+		return nil, c.errorf(expr.Fun.Pos(), ExprErrorCompile, "不支持的函数调用形式")
+	}
+	if expr.Ellipsis.IsValid() {
+		return nil, c.errorf(expr.Ellipsis, ExprErrorCompile, "不支持可变参数展开")
+	}
+
+	args := make([]exprEval, len(expr.Args))
+	for i, arg := range expr.Args {
+		compiled, err := c.compile(arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = compiled.eval
+	}
+	evalArgs := func(env *exprEnv) ([]interface{}, error) {
+		values := make([]interface{}, len(args))
+		for i, arg := range args {
+			value, err := arg(env)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	}
+
+	switch ident.Name {
+	case "__array__":
+		return &exprNode{eval: func(env *exprEnv) (interface{}, error) {
+			return evalArgs(env)
+		}}, nil
+	case "__tag_access__":
+		if len(args) != 1 {
+			return nil, c.errorf(expr.Pos(), ExprErrorCompile, "标签访问需要1个参数")
+		}
+		return tagAccessNode(args[0]), nil
+	}
+
+	function, exists := c.functions.Lookup(ident.Name)
+	if !exists {
+		return nil, c.errorf(ident.Pos(), ExprErrorCompile, "未定义的函数: %s", ident.Name)
+	}
+	if withEnv, ok := function.(envFunction); ok {
+		return &exprNode{eval: func(env *exprEnv) (interface{}, error) {
+			values, err := evalArgs(env)
+			if err != nil {
+				return nil, err
+			}
+			return withEnv.callWithEnv(env, values)
+		}}, nil
+	}
+	return &exprNode{eval: func(env *exprEnv) (interface{}, error) {
+		values, err := evalArgs(env)
+		if err != nil {
+			return nil, err
+		}
+		return function.Call(values...)
+	}}, nil
+}
+
+// exprEnv 单次评估的环境，只被当前goroutine使用，派生变量在首次访问时构建
+type exprEnv struct {
+	point *model.Point
+	vars  map[string]interface{}
+
+	now     time.Time
+	tags    map[string]string
+	derived map[string]interface{}
+}
+
+// lookup 查找变量：数据点内置变量、标签和复合数据派生变量、附加变量
+func (env *exprEnv) lookup(name string) (interface{}, bool) {
+	if env == nil {
+		return nil, false
+	}
+	point := env.point
+	switch name {
+	case "device_id":
+		return point.DeviceID, true
+	case "key":
+		return point.Key, true
+	case "value":
+		return point.Value, true
+	case "type":
+		return string(point.Type), true
+	case "timestamp":
+		return point.Timestamp, true
+	case "quality":
+		return point.Quality, true
+	case "timestamp_unix", "timestamp_string", "timestamp_year", "timestamp_month",
+		"timestamp_day", "timestamp_hour", "timestamp_minute", "timestamp_second":
+		if point.Timestamp.IsZero() {
+			return nil, false
+		}
+		return timestampVariable(point.Timestamp, name), true
+	case "now":
+		return env.clock(), true
+	case "today":
+		return env.clock().Truncate(24 * time.Hour), true
+	case "hour":
+		return env.clock().Hour(), true
+	case "minute":
+		return env.clock().Minute(), true
+	case "weekday":
+		return int(env.clock().Weekday()), true
+	case "num_value":
+		if num, ok := toFloat64(point.Value); ok {
+			return num, true
+		}
+		return nil, false
+	case "tags":
+		return env.tagMap(), true
+	case "emergency_threshold":
+		return 100.0, true
+	case "avg_threshold":
+		return 50.0, true
+	case "nil":
+		return nil, true
+	}
+
+	if value, ok := env.derivedVariables()[name]; ok {
+		return value, true
+	}
+	value, ok := env.vars[name]
+	return value, ok
+}
+
+func timestampVariable(ts time.Time, name string) interface{} {
+	switch name {
+	case "timestamp_unix":
+		return ts.Unix()
+	case "timestamp_string":
+		return ts.Format(time.RFC3339)
+	case "timestamp_year":
+		return ts.Year()
+	case "timestamp_month":
+		return int(ts.Month())
+	case "timestamp_day":
+		return ts.Day()
+	case "timestamp_hour":
+		return ts.Hour()
+	case "timestamp_minute":
+		return ts.Minute()
+	default:
+		return ts.Second()
+	}
+}
+
+// clock 同一次评估内的当前时间保持一致
+func (env *exprEnv) clock() time.Time {
+	if env.now.IsZero() {
+		env.now = time.Now()
+	}
+	return env.now
+}
+
+func (env *exprEnv) tagMap() map[string]string {
+	if env == nil {
+		return map[string]string{}
+	}
+	if env.tags == nil {
+		env.tags = env.point.GetTagsCopy()
+		if env.tags == nil {
+			env.tags = make(map[string]string)
+		}
+	}
+	return env.tags
+}
+
+// derivedVariables 标签深层变量（tag_xxx）、复合数据字段变量和统计用历史数据
+func (env *exprEnv) derivedVariables() map[string]interface{} {
+	if env.derived != nil {
+		return env.derived
+	}
+	vars := make(map[string]interface{})
+	if tags := env.tagMap(); len(tags) > 0 {
+		setDeepTagVariables(vars, tags, "tag")
+	}
+	setCompositeDataVariables(vars, *env.point)
+
+	// 模拟历史数据用于统计函数
+	// 在实际应用中，这些应该来自历史数据存储
+	if numValue, ok := toFloat64(env.point.Value); ok {
+		lastValues := make([]interface{}, 5)
+		for i := 0; i < 5; i++ {
+			variance := numValue * 0.1 * (float64(i%3) - 1) // -10% to +10% variance
+			lastValues[i] = numValue + variance
+		}
+		vars["last_values"] = lastValues
+	}
+	env.derived = vars
+	return vars
+}
+
+// 数学运算函数
+func exprAdd(left, right interface{}) (interface{}, error) {
+	if leftNum, ok := toFloat64(left); ok {
+		if rightNum, ok := toFloat64(right); ok {
+			return leftNum + rightNum, nil
+		}
+	}
+	// 字符串连接
+	return fmt.Sprintf("%v%v", left, right), nil
+}
+
+func exprSubtract(left, right interface{}) (interface{}, error) {
+	leftNum, leftOk := toFloat64(left)
+	rightNum, rightOk := toFloat64(right)
+	if !leftOk || !rightOk {
+		return nil, fmt.Errorf("减法操作需要数值类型")
+	}
+	return leftNum - rightNum, nil
+}
+
+func exprMultiply(left, right interface{}) (interface{}, error) {
+	leftNum, leftOk := toFloat64(left)
+	rightNum, rightOk := toFloat64(right)
+	if !leftOk || !rightOk {
+		return nil, fmt.Errorf("乘法操作需要数值类型")
+	}
+	return leftNum * rightNum, nil
+}
+
+func exprDivide(left, right interface{}) (interface{}, error) {
+	leftNum, leftOk := toFloat64(left)
+	rightNum, rightOk := toFloat64(right)
+	if !leftOk || !rightOk {
+		return nil, fmt.Errorf("除法操作需要数值类型")
+	}
+	if rightNum == 0 {
+		return nil, fmt.Errorf("除零错误")
+	}
+	result := leftNum / rightNum
+
+	// 检查结果是否为有效数值
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return nil, fmt.Errorf("除法运算产生无效结果")
+	}
+
+	return result, nil
+}
+
+func exprModulo(left, right interface{}) (interface{}, error) {
+	leftNum, leftOk := toFloat64(left)
+	rightNum, rightOk := toFloat64(right)
+	if !leftOk || !rightOk {
+		return nil, fmt.Errorf("取模操作需要数值类型")
+	}
+	if rightNum == 0 {
+		return nil, fmt.Errorf("除零错误")
+	}
+	return math.Mod(leftNum, rightNum), nil
+}
@@ -14,9 +14,30 @@ type Index struct {
 	priorityIndex []*Rule            // 按优先级排序
 	typeIndex     map[string][]*Rule // 按数据类型索引
 	allRules      []*Rule            // 所有启用的规则
+	refIndex      map[string][]*Rule // 按表达式中last/age/avg_over引用的设备输入索引
+	triggers      map[string]RuleTrigger
+	matchStates   map[string]*matchState // 引用了其他输入的规则按触发数据点记录的最近评估结果
 	mu            sync.RWMutex
 }
 
+// matchState 规则按触发数据点（设备|key）记录的最近一次评估结果
+type matchState struct {
+	mu   sync.Mutex
+	last map[string]bool
+}
+
+// RuleTrigger 规则自身的触发输入，取自条件中device_id和key的eq值，空表示不限
+type RuleTrigger struct {
+	DeviceIDs []string
+	Keys      []string
+}
+
+// ReferencedRule 引用了某个设备输入的规则
+type ReferencedRule struct {
+	Rule    *Rule
+	Trigger RuleTrigger
+}
+
 // NewIndex 创建新的索引
 func NewIndex() *Index {
 	return &Index{
@@ -24,6 +45,9 @@ func NewIndex() *Index {
 		keyIndex:    make(map[string][]*Rule),
 		typeIndex:   make(map[string][]*Rule),
 		allRules:    make([]*Rule, 0),
+		refIndex:    make(map[string][]*Rule),
+		matchStates: make(map[string]*matchState),
+		triggers:    make(map[string]RuleTrigger),
 	}
 }
 
@@ -35,8 +59,15 @@ func (idx *Index) AddRule(rule *Rule) {
 	// 移除旧的规则（如果存在）
 	idx.removeRuleFromIndex(rule.ID)
 
-	// 只索引启用的规则
-	if !rule.Enabled {
+	// 记录avg_over引用的输入，最新值缓存只为这些输入保留数值历史
+	if rule.Enabled {
+		globalLastValueCache.TrackHistory(rule.ID, ruleHistoryReferences(rule))
+	} else {
+		globalLastValueCache.TrackHistory(rule.ID, nil)
+	}
+
+	// 只索引启用的规则，定时触发的规则由定时器评估
+	if !rule.Enabled || rule.Schedule != nil {
 		return
 	}
 
@@ -57,6 +88,7 @@ func (idx *Index) RemoveRule(rule *Rule) {
 
 	idx.removeRuleFromIndex(rule.ID)
 	idx.rebuildPriorityIndex()
+	globalLastValueCache.TrackHistory(rule.ID, nil)
 }
 
 // removeRuleFromIndex 从索引中移除规则（内部方法，不加锁）
@@ -107,6 +139,21 @@ func (idx *Index) removeRuleFromIndex(ruleID string) {
 			}
 		}
 	}
+
+	// 从引用索引中移除
+	for ref, rules := range idx.refIndex {
+		for i, rule := range rules {
+			if rule.ID == ruleID {
+				idx.refIndex[ref] = append(rules[:i], rules[i+1:]...)
+				if len(idx.refIndex[ref]) == 0 {
+					delete(idx.refIndex, ref)
+				}
+				break
+			}
+		}
+	}
+	delete(idx.triggers, ruleID)
+	delete(idx.matchStates, ruleID)
 }
 
 // analyzeAndIndex 分析规则条件并建立索引
@@ -152,6 +199,58 @@ func (idx *Index) analyzeAndIndex(rule *Rule) {
 		// 没有指定类型的规则，添加到通配符索引
 		idx.typeIndex["*"] = append(idx.typeIndex["*"], rule)
 	}
+
+	// 建立引用索引，被引用的输入变化时重新评估规则
+	refs := make(map[string]bool)
+	idx.extractReferences(rule.Conditions, refs)
+	if len(refs) == 0 {
+		return
+	}
+	for ref := range refs {
+		idx.refIndex[ref] = append(idx.refIndex[ref], rule)
+	}
+	idx.triggers[rule.ID] = RuleTrigger{
+		DeviceIDs: filterWildcards(fields["device_id"]),
+		Keys:      filterWildcards(fields["key"]),
+	}
+	idx.matchStates[rule.ID] = &matchState{last: make(map[string]bool)}
+}
+
+// extractReferences 递归提取表达式条件引用的设备输入
+func (idx *Index) extractReferences(condition *Condition, refs map[string]bool) {
+	if condition == nil {
+		return
+	}
+	if condition.Expression != "" {
+		for _, ref := range ExtractLastValueReferences(condition.Expression) {
+			refs[referenceKey(ref.DeviceID, ref.Key)] = true
+		}
+	}
+	for _, subCondition := range condition.And {
+		idx.extractReferences(subCondition, refs)
+	}
+	for _, subCondition := range condition.Or {
+		idx.extractReferences(subCondition, refs)
+	}
+	if condition.Not != nil {
+		idx.extractReferences(condition.Not, refs)
+	}
+}
+
+// referenceKey 引用索引的键
+func referenceKey(deviceID, key string) string {
+	return deviceID + "\x00" + key
+}
+
+// filterWildcards 去掉通配符和空值
+func filterWildcards(values []string) []string {
+	var result []string
+	for _, v := range values {
+		if v != "*" && v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
 }
 
 // extractFields 提取条件中的字段值
@@ -267,6 +366,40 @@ func (idx *Index) Match(point model.Point) []*Rule {
 	return result
 }
 
+// MatchReferences 获取表达式引用了该数据点设备输入的规则
+func (idx *Index) MatchReferences(point model.Point) []ReferencedRule {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	rules := idx.refIndex[referenceKey(point.DeviceID, point.Key)]
+	if len(rules) == 0 {
+		return nil
+	}
+	result := make([]ReferencedRule, 0, len(rules))
+	for _, rule := range rules {
+		result = append(result, ReferencedRule{Rule: rule, Trigger: idx.triggers[rule.ID]})
+	}
+	return result
+}
+
+// SwapMatch 记录引用了其他输入的规则对触发数据点的评估结果，返回上一次的结果
+// 没有引用其他输入的规则不记录，总是返回false
+func (idx *Index) SwapMatch(ruleID string, point model.Point, matched bool) bool {
+	idx.mu.RLock()
+	state := idx.matchStates[ruleID]
+	idx.mu.RUnlock()
+	if state == nil {
+		return false
+	}
+
+	key := referenceKey(point.DeviceID, point.Key)
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	prev := state.last[key]
+	state.last[key] = matched
+	return prev
+}
+
 // GetAllRules 获取所有启用的规则（按优先级排序）
 func (idx *Index) GetAllRules() []*Rule {
 	idx.mu.RLock()
@@ -363,6 +496,7 @@ func (idx *Index) GetStats() map[string]interface{} {
 		"type_index_count":     typeCount,
 		"avg_rules_per_device": avgRulesPerDevice,
 		"avg_rules_per_key":    avgRulesPerKey,
+		"reference_count":      len(idx.refIndex),
 	}
 }
 
@@ -376,4 +510,7 @@ func (idx *Index) Clear() {
 	idx.typeIndex = make(map[string][]*Rule)
 	idx.priorityIndex = make([]*Rule, 0)
 	idx.allRules = make([]*Rule, 0)
+	idx.refIndex = make(map[string][]*Rule)
+	idx.triggers = make(map[string]RuleTrigger)
+	idx.matchStates = make(map[string]*matchState)
 }
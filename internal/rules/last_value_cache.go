@@ -0,0 +1,546 @@
+package rules
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/y001j/iot-gateway/internal/model"
+)
+
+// ErrLastValueUnavailable 引用的设备输入没有数据或数据已过期，表达式条件按不满足处理
+var ErrLastValueUnavailable = errors.New("最新值不存在或已过期")
+
+const (
+	defaultLastValueMaxAge     = 5 * time.Minute
+	defaultLastValueHistory    = 15 * time.Minute
+	defaultLastValueMaxSamples = 1000
+	defaultLastValueMaxEntries = 100000
+)
+
+// LastValueCacheConfig 跨设备最新值缓存配置
+type LastValueCacheConfig struct {
+	MaxAge     string `yaml:"max_age" json:"max_age"`         // 默认陈旧阈值，超过后last()视为无数据，默认5m
+	History    string `yaml:"history" json:"history"`         // avg_over()可回溯的最长时间，默认15m
+	MaxSamples int    `yaml:"max_samples" json:"max_samples"` // 每个输入保留的历史样本上限，默认1000
+	MaxEntries int    `yaml:"max_entries" json:"max_entries"` // 缓存的设备+key数量上限，默认100000
+}
+
+// lastValueSample 数值历史样本
+type lastValueSample struct {
+	at    time.Time
+	value float64
+}
+
+// lastValueEntry 单个设备+key的最新值
+type lastValueEntry struct {
+	point   model.Point
+	updated time.Time // 网关收到数据的时间，陈旧判断不依赖设备时钟
+	samples []lastValueSample
+	elem    *list.Element // 在LRU链表中的位置
+}
+
+// LastValueCache 按设备和key缓存最新数据点，供规则表达式跨设备、跨key引用
+type LastValueCache struct {
+	entries    map[string]map[string]*lastValueEntry // deviceID -> key -> entry
+	lru        *list.List                            // 按更新时间排列，表头最新
+	count      int
+	maxAge     time.Duration
+	history    time.Duration
+	maxSamples int
+	maxEntries int
+	updates    int64
+	evictions  int64
+
+	historyRules map[string][]LastValueReference // 规则ID -> avg_over引用的输入
+	historyRefs  map[string]int                  // 被avg_over引用的输入 -> 引用次数
+	historyAll   int                             // avg_over参数不是字面量的引用次数，此时记录全部输入
+
+	mu sync.RWMutex
+}
+
+var globalLastValueCache = NewLastValueCache()
+
+// GetLastValueCache 获取规则引擎共享的最新值缓存
+func GetLastValueCache() *LastValueCache {
+	return globalLastValueCache
+}
+
+// NewLastValueCache 创建最新值缓存
+func NewLastValueCache() *LastValueCache {
+	return &LastValueCache{
+		entries:    make(map[string]map[string]*lastValueEntry),
+		lru:        list.New(),
+		maxAge:     defaultLastValueMaxAge,
+		history:    defaultLastValueHistory,
+		maxSamples: defaultLastValueMaxSamples,
+		maxEntries: defaultLastValueMaxEntries,
+
+		historyRules: make(map[string][]LastValueReference),
+		historyRefs:  make(map[string]int),
+	}
+}
+
+// Configure 应用缓存配置，未设置的字段保持默认值
+func (c *LastValueCache) Configure(cfg *LastValueCacheConfig) error {
+	if cfg == nil {
+		return nil
+	}
+
+	maxAge := defaultLastValueMaxAge
+	if cfg.MaxAge != "" {
+		d, err := time.ParseDuration(cfg.MaxAge)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("无效的last_values.max_age: %s", cfg.MaxAge)
+		}
+		maxAge = d
+	}
+	history := defaultLastValueHistory
+	if cfg.History != "" {
+		d, err := time.ParseDuration(cfg.History)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("无效的last_values.history: %s", cfg.History)
+		}
+		history = d
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxAge = maxAge
+	c.history = history
+	if cfg.MaxSamples > 0 {
+		c.maxSamples = cfg.MaxSamples
+	}
+	if cfg.MaxEntries > 0 {
+		c.maxEntries = cfg.MaxEntries
+	}
+	return nil
+}
+
+// MaxAge 返回默认陈旧阈值
+func (c *LastValueCache) MaxAge() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.maxAge
+}
+
+// Update 记录数据点为对应设备+key的最新值
+func (c *LastValueCache) Update(point model.Point) {
+	if point.DeviceID == "" || point.Key == "" {
+		return
+	}
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.updates++
+	keys, ok := c.entries[point.DeviceID]
+	if !ok {
+		keys = make(map[string]*lastValueEntry)
+		c.entries[point.DeviceID] = keys
+	}
+	entry, ok := keys[point.Key]
+	if !ok {
+		if c.count >= c.maxEntries {
+			c.evictOldest()
+		}
+		entry = &lastValueEntry{}
+		entry.elem = c.lru.PushFront(entry)
+		keys[point.Key] = entry
+		c.count++
+	} else {
+		c.lru.MoveToFront(entry.elem)
+	}
+	entry.point = point
+	entry.updated = now
+
+	// 只有avg_over引用的输入需要数值历史
+	if !c.recordsHistory(point.DeviceID, point.Key) {
+		entry.samples = nil
+		return
+	}
+	if num, ok := toFloat64(point.Value); ok {
+		entry.samples = append(entry.samples, lastValueSample{at: now, value: num})
+	}
+	entry.samples = c.trimSamples(entry.samples, now)
+}
+
+// recordsHistory 输入是否被avg_over引用（调用方持有锁）
+func (c *LastValueCache) recordsHistory(deviceID, key string) bool {
+	return c.historyAll > 0 || c.historyRefs[referenceKey(deviceID, key)] > 0
+}
+
+// TrackHistory 设置规则中avg_over引用的输入，refs为空时取消该规则的引用。
+// DeviceID为空的引用表示参数不是字面量，需要记录全部输入的历史
+func (c *LastValueCache) TrackHistory(ruleID string, refs []LastValueReference) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, ref := range c.historyRules[ruleID] {
+		if ref.DeviceID == "" {
+			c.historyAll--
+			continue
+		}
+		k := referenceKey(ref.DeviceID, ref.Key)
+		if c.historyRefs[k]--; c.historyRefs[k] <= 0 {
+			delete(c.historyRefs, k)
+		}
+	}
+	delete(c.historyRules, ruleID)
+	if len(refs) == 0 {
+		return
+	}
+	for _, ref := range refs {
+		if ref.DeviceID == "" {
+			c.historyAll++
+			continue
+		}
+		c.historyRefs[referenceKey(ref.DeviceID, ref.Key)]++
+	}
+	c.historyRules[ruleID] = refs
+}
+
+// trimSamples 丢弃超出回溯时间和数量上限的历史样本
+func (c *LastValueCache) trimSamples(samples []lastValueSample, now time.Time) []lastValueSample {
+	cutoff := now.Add(-c.history)
+	drop := 0
+	for drop < len(samples) && samples[drop].at.Before(cutoff) {
+		drop++
+	}
+	if over := len(samples) - drop - c.maxSamples; over > 0 {
+		drop += over
+	}
+	if drop == 0 {
+		return samples
+	}
+	return append(samples[:0], samples[drop:]...)
+}
+
+// evictOldest 缓存已满时淘汰最久未更新的输入
+func (c *LastValueCache) evictOldest() {
+	elem := c.lru.Back()
+	if elem == nil {
+		return
+	}
+	entry := c.lru.Remove(elem).(*lastValueEntry)
+	deviceID, key := entry.point.DeviceID, entry.point.Key
+	delete(c.entries[deviceID], key)
+	if len(c.entries[deviceID]) == 0 {
+		delete(c.entries, deviceID)
+	}
+	c.count--
+	c.evictions++
+}
+
+// Last 获取最新数据点，maxAge<=0时使用默认陈旧阈值
+func (c *LastValueCache) Last(deviceID, key string, maxAge time.Duration) (model.Point, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[deviceID][key]
+	if !ok {
+		return model.Point{}, false
+	}
+	if maxAge <= 0 {
+		maxAge = c.maxAge
+	}
+	if time.Since(entry.updated) > maxAge {
+		return model.Point{}, false
+	}
+	return entry.point, true
+}
+
+// Age 获取距最近一次更新的时间，不受陈旧阈值限制
+func (c *LastValueCache) Age(deviceID, key string) (time.Duration, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[deviceID][key]
+	if !ok {
+		return 0, false
+	}
+	return time.Since(entry.updated), true
+}
+
+// Average 计算最近window内数值样本的平均值
+func (c *LastValueCache) Average(deviceID, key string, window time.Duration) (float64, int, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[deviceID][key]
+	if !ok {
+		return 0, 0, false
+	}
+	cutoff := time.Now().Add(-window)
+	var sum float64
+	count := 0
+	for i := len(entry.samples) - 1; i >= 0 && !entry.samples[i].at.Before(cutoff); i-- {
+		sum += entry.samples[i].value
+		count++
+	}
+	if count == 0 {
+		return 0, 0, false
+	}
+	return sum / float64(count), count, true
+}
+
+// Points 获取匹配设备和key的未过期最新数据点，空列表表示不限
+func (c *LastValueCache) Points(deviceIDs, keys []string, maxAge time.Duration) []model.Point {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if maxAge <= 0 {
+		maxAge = c.maxAge
+	}
+	var result []model.Point
+	collect := func(entries map[string]*lastValueEntry) {
+		if len(keys) == 0 {
+			for _, entry := range entries {
+				if time.Since(entry.updated) <= maxAge {
+					result = append(result, entry.point)
+				}
+			}
+			return
+		}
+		for _, key := range keys {
+			if entry, ok := entries[key]; ok && time.Since(entry.updated) <= maxAge {
+				result = append(result, entry.point)
+			}
+		}
+	}
+
+	if len(deviceIDs) == 0 {
+		for _, entries := range c.entries {
+			collect(entries)
+		}
+		return result
+	}
+	for _, deviceID := range deviceIDs {
+		if entries, ok := c.entries[deviceID]; ok {
+			collect(entries)
+		}
+	}
+	return result
+}
+
+// Stats 获取缓存统计信息
+func (c *LastValueCache) Stats() map[string]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return map[string]interface{}{
+		"entries":   c.count,
+		"devices":   len(c.entries),
+		"updates":   c.updates,
+		"evictions": c.evictions,
+		"max_age":   c.maxAge.String(),
+		"history":   c.history.String(),
+
+		"history_inputs": len(c.historyRefs),
+		"history_all":    c.historyAll > 0,
+	}
+}
+
+// lastValueRefPattern 匹配表达式中以字符串字面量引用设备输入的函数调用
+var lastValueRefPattern = regexp.MustCompile(`\b(?:last|age|avg_over)\(\s*["']([^"']+)["']\s*,\s*["']([^"']+)["']`)
+
+// lastValueFuncPattern 匹配last/age/avg_over函数调用
+var lastValueFuncPattern = regexp.MustCompile(`\b(?:last|age|avg_over)\(`)
+
+// avgOverRefPattern 匹配以字符串字面量引用设备输入的avg_over调用
+var avgOverRefPattern = regexp.MustCompile(`\bavg_over\(\s*["']([^"']+)["']\s*,\s*["']([^"']+)["']`)
+
+// avgOverFuncPattern 匹配avg_over函数调用
+var avgOverFuncPattern = regexp.MustCompile(`\bavg_over\(`)
+
+// UsesLastValueFunctions 表达式是否使用了最新值函数
+func UsesLastValueFunctions(expression string) bool {
+	return lastValueFuncPattern.MatchString(expression)
+}
+
+// LastValueReference 表达式引用的设备输入
+type LastValueReference struct {
+	DeviceID string
+	Key      string
+}
+
+// ExtractLastValueReferences 提取表达式中last/age/avg_over引用的设备输入
+func ExtractLastValueReferences(expression string) []LastValueReference {
+	matches := lastValueRefPattern.FindAllStringSubmatch(expression, -1)
+	refs := make([]LastValueReference, 0, len(matches))
+	for _, m := range matches {
+		refs = append(refs, LastValueReference{DeviceID: m[1], Key: m[2]})
+	}
+	return refs
+}
+
+// ExtractAverageReferences 提取表达式中avg_over引用的设备输入，
+// 参数不是字符串字面量的调用返回DeviceID为空的引用
+func ExtractAverageReferences(expression string) []LastValueReference {
+	calls := len(avgOverFuncPattern.FindAllStringIndex(expression, -1))
+	if calls == 0 {
+		return nil
+	}
+	matches := avgOverRefPattern.FindAllStringSubmatch(expression, -1)
+	refs := make([]LastValueReference, 0, calls)
+	for _, m := range matches {
+		refs = append(refs, LastValueReference{DeviceID: m[1], Key: m[2]})
+	}
+	if calls > len(matches) {
+		refs = append(refs, LastValueReference{})
+	}
+	return refs
+}
+
+// ruleHistoryReferences 提取规则条件、定时表达式和动作配置中avg_over引用的设备输入
+func ruleHistoryReferences(rule *Rule) []LastValueReference {
+	var refs []LastValueReference
+	var walkCondition func(condition *Condition)
+	walkCondition = func(condition *Condition) {
+		if condition == nil {
+			return
+		}
+		refs = append(refs, ExtractAverageReferences(condition.Expression)...)
+		for _, sub := range condition.And {
+			walkCondition(sub)
+		}
+		for _, sub := range condition.Or {
+			walkCondition(sub)
+		}
+		walkCondition(condition.Not)
+	}
+	walkCondition(rule.Conditions)
+	if rule.Schedule != nil {
+		refs = append(refs, ExtractAverageReferences(rule.Schedule.Value)...)
+	}
+	var walkValue func(v interface{})
+	walkValue = func(v interface{}) {
+		switch val := v.(type) {
+		case string:
+			refs = append(refs, ExtractAverageReferences(val)...)
+		case map[string]interface{}:
+			for _, item := range val {
+				walkValue(item)
+			}
+		case []interface{}:
+			for _, item := range val {
+				walkValue(item)
+			}
+		}
+	}
+	for _, action := range rule.Actions {
+		walkValue(action.Config)
+	}
+	return refs
+}
+
+// parseLastValueDuration 解析函数中的时长参数，字符串按Go时长格式，数值按秒
+func parseLastValueDuration(arg interface{}) (time.Duration, error) {
+	if s, ok := arg.(string); ok {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("无效的时长: %s", s)
+		}
+		return d, nil
+	}
+	if num, ok := toFloat64(arg); ok {
+		return time.Duration(num * float64(time.Second)), nil
+	}
+	return 0, fmt.Errorf("无效的时长: %v", arg)
+}
+
+// lastValueArgs 解析设备ID和key参数
+func lastValueArgs(name string, args []interface{}, min, max int) (string, string, error) {
+	if len(args) < min || len(args) > max {
+		if min == max {
+			return "", "", fmt.Errorf("%s函数需要%d个参数", name, min)
+		}
+		return "", "", fmt.Errorf("%s函数需要%d到%d个参数", name, min, max)
+	}
+	deviceID, ok1 := args[0].(string)
+	key, ok2 := args[1].(string)
+	if !ok1 || !ok2 {
+		return "", "", fmt.Errorf("%s函数的设备ID和key必须是字符串", name)
+	}
+	return deviceID, key, nil
+}
+
+// LastValueFunction last(device_id, key[, max_age]) 获取其他设备或key的最新值
+type LastValueFunction struct {
+	cache *LastValueCache
+}
+
+func (f *LastValueFunction) Name() string { return "last" }
+func (f *LastValueFunction) Description() string {
+	return "获取指定设备和key的最新值，超过陈旧阈值视为无数据"
+}
+func (f *LastValueFunction) Call(args ...interface{}) (interface{}, error) {
+	deviceID, key, err := lastValueArgs("last", args, 2, 3)
+	if err != nil {
+		return nil, err
+	}
+	var maxAge time.Duration
+	if len(args) == 3 {
+		if maxAge, err = parseLastValueDuration(args[2]); err != nil {
+			return nil, err
+		}
+	}
+	point, ok := f.cache.Last(deviceID, key, maxAge)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s/%s", ErrLastValueUnavailable, deviceID, key)
+	}
+	return point.Value, nil
+}
+
+// AgeFunction age(device_id, key) 获取距指定输入最近一次更新的秒数
+type AgeFunction struct {
+	cache *LastValueCache
+}
+
+func (f *AgeFunction) Name() string { return "age" }
+func (f *AgeFunction) Description() string {
+	return "获取指定设备和key距最近一次更新的秒数"
+}
+func (f *AgeFunction) Call(args ...interface{}) (interface{}, error) {
+	deviceID, key, err := lastValueArgs("age", args, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	age, ok := f.cache.Age(deviceID, key)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s/%s", ErrLastValueUnavailable, deviceID, key)
+	}
+	return age.Seconds(), nil
+}
+
+// AvgOverFunction avg_over(device_id, key, window) 计算指定输入最近一段时间的平均值
+type AvgOverFunction struct {
+	cache *LastValueCache
+}
+
+func (f *AvgOverFunction) Name() string { return "avg_over" }
+func (f *AvgOverFunction) Description() string {
+	return "计算指定设备和key在最近时间窗口内的平均值"
+}
+func (f *AvgOverFunction) Call(args ...interface{}) (interface{}, error) {
+	deviceID, key, err := lastValueArgs("avg_over", args, 3, 3)
+	if err != nil {
+		return nil, err
+	}
+	window, err := parseLastValueDuration(args[2])
+	if err != nil {
+		return nil, err
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("avg_over函数的时间窗口必须大于0")
+	}
+	avg, _, ok := f.cache.Average(deviceID, key, window)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s/%s", ErrLastValueUnavailable, deviceID, key)
+	}
+	return avg, nil
+}
@@ -40,6 +40,22 @@ type RuleManager interface {
 	Close() error
 	GetStats() map[string]interface{}
 	SetHotReloadConfig(config *HotReloadConfig) // 设置热加载配置
+	SetPipelines(pipelines []*RulePipeline) error // 设置规则管道
+	GetPipelines() []*RulePipeline
+	Downstream(ruleID string) []*Rule // 规则的下游规则
+	IsDownstream(ruleID string) bool  // 规则是否只由上游规则的输出触发
+	ValidateRule(rule *Rule) error    // 验证规则，不保存
+
+	// 修订历史
+	SetHistoryDir(dir string)
+	SaveRuleWithChange(rule *Rule, change RuleChange) error
+	DeleteRuleWithChange(id string, change RuleChange) error
+	SetRuleEnabled(id string, enabled bool, change RuleChange) error
+	ListRevisions(id string) ([]*RuleRevision, error)
+	GetRevision(id string, revision int) (*RuleRevision, error)
+	DiffRevisions(id string, from, to int) ([]RuleDiffEntry, error)
+	RollbackRule(id string, revision int, change RuleChange) (*Rule, error)
+	ExportHistoryGit(dir string) (string, int, error) // 返回导出目录和提交数量
 }
 
 // Manager 规则管理器
@@ -52,6 +68,9 @@ type Manager struct {
 	hotReloadConfig  *HotReloadConfig  // 热加载配置
 	hotReloadEnabled bool              // 热加载状态
 	retryCount       int               // 重试计数
+	pipelines        []*RulePipeline   // 规则管道
+	graph            *ruleGraph        // 规则上下游关系
+	history          *revisionStore    // 规则修订历史，未设置时不记录
 	mu               sync.RWMutex
 }
 
@@ -62,6 +81,7 @@ func NewManager(rulesDir string) *Manager {
 		rules:       make(map[string]*Rule),
 		ruleIndex:   NewIndex(),
 		changesChan: make(chan RuleChangeEvent, 100),
+		graph:       buildRuleGraph(nil, nil),
 		hotReloadConfig: &HotReloadConfig{
 			Enabled:          true,
 			GracefulFallback: true,
@@ -85,6 +105,7 @@ func (m *Manager) LoadRules() error {
 	// 清空现有规则
 	m.rules = make(map[string]*Rule)
 	m.ruleIndex = NewIndex()
+	m.graph = buildRuleGraph(nil, m.pipelines)
 
 	// 扫描规则文件
 	err := filepath.Walk(m.rulesDir, func(path string, info os.FileInfo, err error) error {
@@ -117,6 +138,11 @@ func (m *Manager) LoadRules() error {
 		return fmt.Errorf("扫描规则目录失败: %w", err)
 	}
 
+	// 网关停止期间修改的规则文件补记修订
+	for _, rule := range m.rules {
+		m.recordFileChange(rule, "加载时规则文件与修订历史不一致")
+	}
+
 	log.Info().Int("count", len(m.rules)).Str("dir", m.rulesDir).Msg("规则加载完成")
 	// 调试：输出所有加载的规则ID和名称
 	for id, rule := range m.rules {
@@ -209,28 +235,75 @@ func (m *Manager) validateRule(rule *Rule) error {
 	if rule.Name == "" {
 		return fmt.Errorf("规则名称不能为空")
 	}
-	if rule.Conditions == nil {
+	if rule.Conditions == nil && rule.Schedule == nil {
 		return fmt.Errorf("规则条件不能为空")
 	}
 	if len(rule.Actions) == 0 {
 		return fmt.Errorf("规则动作不能为空")
 	}
 
-	// 验证条件
-	if err := m.validateCondition(rule.Conditions); err != nil {
-		return fmt.Errorf("条件验证失败: %w", err)
+	// 验证条件，定时触发的规则可以不设条件
+	if rule.Conditions != nil {
+		if err := m.validateCondition(rule.Conditions); err != nil {
+			return fmt.Errorf("条件验证失败: %w", err)
+		}
+	}
+
+	// 验证上游规则
+	for i, after := range rule.After {
+		if after == "" {
+			return fmt.Errorf("after[%d]规则ID不能为空", i)
+		}
+		if after == rule.ID {
+			return fmt.Errorf("规则不能依赖自身")
+		}
+	}
+	if len(rule.After) > 0 && rule.Schedule != nil {
+		return fmt.Errorf("定时触发的规则不能指定after")
+	}
+
+	// 验证定时触发
+	if rule.Schedule != nil {
+		if err := validateSchedule(rule.Schedule); err != nil {
+			return fmt.Errorf("定时触发验证失败: %w", err)
+		}
 	}
 
 	// 验证动作
-	for i, action := range rule.Actions {
+	for i := range rule.Actions {
+		action := &rule.Actions[i]
 		if action.Type == "" {
 			return fmt.Errorf("动作[%d]类型不能为空", i)
 		}
+		if validate := actionConfigValidator(action.Type); validate != nil {
+			if err := validate(action); err != nil {
+				return fmt.Errorf("动作[%d](%s)配置无效: %w", i, action.Type, err)
+			}
+		}
 	}
 
 	return nil
 }
 
+var (
+	actionValidatorsMu sync.RWMutex
+	actionValidators   = make(map[string]func(action *Action) error)
+)
+
+// RegisterActionConfigValidator 注册动作配置验证函数，规则加载和保存时调用，
+// 动作处理器执行时不再重复验证。验证函数可以把编译的表达式保存到动作上
+func RegisterActionConfigValidator(actionType string, validate func(action *Action) error) {
+	actionValidatorsMu.Lock()
+	defer actionValidatorsMu.Unlock()
+	actionValidators[actionType] = validate
+}
+
+func actionConfigValidator(actionType string) func(action *Action) error {
+	actionValidatorsMu.RLock()
+	defer actionValidatorsMu.RUnlock()
+	return actionValidators[actionType]
+}
+
 // validateCondition 验证条件
 func (m *Manager) validateCondition(condition *Condition) error {
 	if condition == nil {
@@ -259,10 +332,32 @@ func (m *Manager) validateCondition(condition *Condition) error {
 		if condition.Expression == "" {
 			return fmt.Errorf("表达式条件必须指定expression")
 		}
+		// 加载时编译表达式并保存在条件上，评估时直接使用编译结果
+		compiled, err := CompileExpression(condition.Expression)
+		if err != nil {
+			return err
+		}
+		condition.compiled = compiled
 	case "lua":
 		if condition.Script == "" {
 			return fmt.Errorf("Lua条件必须指定script")
 		}
+	case "sequence":
+		if err := validateSequence(condition.Sequence); err != nil {
+			return err
+		}
+		for i, step := range condition.Sequence.Steps {
+			if step.Condition == nil {
+				continue
+			}
+			if err := m.validateCondition(step.Condition); err != nil {
+				return fmt.Errorf("序列步骤[%d]: %w", i, err)
+			}
+		}
+	case "alarm":
+		if err := validateAlarm(condition.Alarm); err != nil {
+			return err
+		}
 	default:
 		return fmt.Errorf("不支持的条件类型: %s", condition.Type)
 	}
@@ -306,6 +401,10 @@ func (m *Manager) initializeRule(rule *Rule) {
 
 // addRule 添加规则
 func (m *Manager) addRule(rule *Rule) error {
+	if err := m.checkDependencies(rule); err != nil {
+		return err
+	}
+
 	// 检查重复ID
 	if existingRule, exists := m.rules[rule.ID]; exists {
 		log.Warn().
@@ -317,6 +416,7 @@ func (m *Manager) addRule(rule *Rule) error {
 
 	m.rules[rule.ID] = rule
 	m.ruleIndex.AddRule(rule)
+	m.graph = buildRuleGraph(m.rules, m.pipelines)
 
 	log.Debug().
 		Str("rule_id", rule.ID).
@@ -391,20 +491,38 @@ func (m *Manager) GetEnabledRules() []*Rule {
 
 // SaveRule 保存规则
 func (m *Manager) SaveRule(rule *Rule) error {
+	return m.SaveRuleWithChange(rule, RuleChange{})
+}
+
+// SaveRuleWithChange 保存规则并记录修改人和变更说明
+func (m *Manager) SaveRuleWithChange(rule *Rule, change RuleChange) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	return m.saveRule(rule, "", change)
+}
 
+// saveRule 保存规则，action为空时按规则是否存在记为创建或更新，调用方持有锁
+func (m *Manager) saveRule(rule *Rule, action string, change RuleChange) error {
 	if err := m.validateRule(rule); err != nil {
 		return fmt.Errorf("规则验证失败: %w", err)
 	}
+	if err := m.checkDependencies(rule); err != nil {
+		return fmt.Errorf("规则验证失败: %w", err)
+	}
 
 	// 更新版本和时间
 	if existingRule, exists := m.rules[rule.ID]; exists {
 		rule.Version = existingRule.Version + 1
 		rule.CreatedAt = existingRule.CreatedAt
+		if action == "" {
+			action = RevisionUpdate
+		}
 	} else {
 		rule.Version = 1
 		rule.CreatedAt = time.Now()
+		if action == "" {
+			action = RevisionCreate
+		}
 	}
 	rule.UpdatedAt = time.Now()
 
@@ -422,6 +540,8 @@ func (m *Manager) SaveRule(rule *Rule) error {
 	// 确保内存状态同步：强制更新内存中的规则
 	m.rules[rule.ID] = rule
 	m.ruleIndex.AddRule(rule) // AddRule内部会处理重复规则的覆盖
+	m.graph = buildRuleGraph(m.rules, m.pipelines)
+	m.recordRevision(rule.ID, action, rule, change)
 
 	// 发送变更事件
 	select {
@@ -447,6 +567,11 @@ func (m *Manager) saveRuleToFile(rule *Rule, filePath string) error {
 
 // DeleteRule 删除规则
 func (m *Manager) DeleteRule(id string) error {
+	return m.DeleteRuleWithChange(id, RuleChange{})
+}
+
+// DeleteRuleWithChange 删除规则并记录修改人和变更说明，规则的修订历史保留
+func (m *Manager) DeleteRuleWithChange(id string, change RuleChange) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -458,12 +583,14 @@ func (m *Manager) DeleteRule(id string) error {
 	// 从内存中删除
 	delete(m.rules, id)
 	m.ruleIndex.RemoveRule(rule)
+	m.graph = buildRuleGraph(m.rules, m.pipelines)
 
 	// 删除文件
 	filePath := filepath.Join(m.rulesDir, fmt.Sprintf("%s.json", id))
 	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
 		log.Error().Err(err).Str("file", filePath).Msg("删除规则文件失败")
 	}
+	m.recordRevision(id, RevisionDelete, nil, change)
 
 	// 发送变更事件
 	select {
@@ -478,6 +605,16 @@ func (m *Manager) DeleteRule(id string) error {
 
 // EnableRule 启用规则
 func (m *Manager) EnableRule(id string) error {
+	return m.SetRuleEnabled(id, true, RuleChange{})
+}
+
+// DisableRule 禁用规则
+func (m *Manager) DisableRule(id string) error {
+	return m.SetRuleEnabled(id, false, RuleChange{})
+}
+
+// SetRuleEnabled 启用或禁用规则并记录修改人和变更说明
+func (m *Manager) SetRuleEnabled(id string, enabled bool, change RuleChange) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -486,8 +623,8 @@ func (m *Manager) EnableRule(id string) error {
 		return fmt.Errorf("规则不存在: %s", id)
 	}
 
-	if !rule.Enabled {
-		rule.Enabled = true
+	if rule.Enabled != enabled {
+		rule.Enabled = enabled
 		rule.UpdatedAt = time.Now()
 		rule.Version++
 
@@ -500,6 +637,12 @@ func (m *Manager) EnableRule(id string) error {
 			return fmt.Errorf("保存规则文件失败: %w", err)
 		}
 
+		action := RevisionEnable
+		if !enabled {
+			action = RevisionDisable
+		}
+		m.recordRevision(rule.ID, action, rule, change)
+
 		// 发送变更事件
 		select {
 		case m.changesChan <- RuleChangeEvent{Type: "update", Rule: rule}:
@@ -507,63 +650,238 @@ func (m *Manager) EnableRule(id string) error {
 			log.Warn().Str("rule_id", rule.ID).Msg("规则变更事件队列已满")
 		}
 
-		log.Info().Str("rule_id", id).Str("name", rule.Name).Msg("规则已启用")
+		if enabled {
+			log.Info().Str("rule_id", id).Str("name", rule.Name).Msg("规则已启用")
+		} else {
+			log.Info().Str("rule_id", id).Str("name", rule.Name).Msg("规则已禁用")
+		}
 	}
 
 	return nil
 }
 
-// DisableRule 禁用规则
-func (m *Manager) DisableRule(id string) error {
+// GetIndex 获取规则索引
+func (m *Manager) GetIndex() *Index {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.ruleIndex
+}
+
+// SetHotReloadConfig 设置热加载配置
+func (m *Manager) SetHotReloadConfig(config *HotReloadConfig) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if config != nil {
+		m.hotReloadConfig = config
+	}
+}
 
-	rule, exists := m.rules[id]
-	if !exists {
-		return fmt.Errorf("规则不存在: %s", id)
+// SetPipelines 设置规则管道，管道与规则的after一起构成依赖图，不能形成环路
+func (m *Manager) SetPipelines(pipelines []*RulePipeline) error {
+	if err := validatePipelines(pipelines); err != nil {
+		return err
 	}
 
-	if rule.Enabled {
-		rule.Enabled = false
-		rule.UpdatedAt = time.Now()
-		rule.Version++
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-		// 更新索引
-		m.ruleIndex.AddRule(rule)
+	graph := buildRuleGraph(m.rules, pipelines)
+	if cycle := graph.findAnyCycle(); cycle != nil {
+		return cycleError(cycle)
+	}
+	m.pipelines = pipelines
+	m.graph = graph
+	return nil
+}
 
-		// 保存到文件
-		filePath := filepath.Join(m.rulesDir, fmt.Sprintf("%s.json", rule.ID))
-		if err := m.saveRuleToFile(rule, filePath); err != nil {
-			return fmt.Errorf("保存规则文件失败: %w", err)
-		}
+// GetPipelines 获取规则管道
+func (m *Manager) GetPipelines() []*RulePipeline {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]*RulePipeline(nil), m.pipelines...)
+}
 
-		// 发送变更事件
-		select {
-		case m.changesChan <- RuleChangeEvent{Type: "update", Rule: rule}:
-		default:
-			log.Warn().Str("rule_id", rule.ID).Msg("规则变更事件队列已满")
-		}
+// Downstream 获取规则启用的下游规则，按优先级排序
+func (m *Manager) Downstream(ruleID string) []*Rule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
-		log.Info().Str("rule_id", id).Str("name", rule.Name).Msg("规则已禁用")
+	ids := m.graph.downstream[ruleID]
+	if len(ids) == 0 {
+		return nil
+	}
+	rules := make([]*Rule, 0, len(ids))
+	for _, id := range ids {
+		if rule, ok := m.rules[id]; ok && rule.Enabled {
+			rules = append(rules, rule)
+		}
 	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].Priority > rules[j].Priority
+	})
+	return rules
+}
 
-	return nil
+// IsDownstream 规则是否有上游规则，有上游的规则只评估上游的输出数据点
+func (m *Manager) IsDownstream(ruleID string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.graph.upstream[ruleID]) > 0
 }
 
-// GetIndex 获取规则索引
-func (m *Manager) GetIndex() *Index {
+// ValidateRule 按保存时的规则验证规则，包括依赖环路检查，但不保存
+func (m *Manager) ValidateRule(rule *Rule) error {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return m.ruleIndex
+
+	if err := m.validateRule(rule); err != nil {
+		return err
+	}
+	return m.checkDependencies(rule)
 }
 
-// SetHotReloadConfig 设置热加载配置
-func (m *Manager) SetHotReloadConfig(config *HotReloadConfig) {
+// SetHistoryDir 设置规则修订历史目录，需在加载规则前设置
+func (m *Manager) SetHistoryDir(dir string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	if config != nil {
-		m.hotReloadConfig = config
+	m.history = newRevisionStore(dir)
+}
+
+// recordRevision 记录规则修订，rule为变更后的规则，删除时为nil。
+// 记录失败不影响规则变更，调用方持有锁
+func (m *Manager) recordRevision(ruleID, action string, rule *Rule, change RuleChange) {
+	if m.history == nil {
+		return
+	}
+	if change.Author == "" {
+		change.Author = defaultRevisionAuthor
+	}
+	revision := &RuleRevision{
+		RuleID:    ruleID,
+		Action:    action,
+		Author:    change.Author,
+		Note:      change.Note,
+		Timestamp: time.Now(),
+		Rule:      rule,
+	}
+	if rule != nil {
+		revision.Version = rule.Version
+	}
+	if err := m.history.append(revision); err != nil {
+		log.Error().Err(err).Str("rule_id", ruleID).Str("action", action).Msg("记录规则修订失败")
+	}
+}
+
+// recordFileChange 直接修改规则文件时补记修订。保存规则写文件后触发的重新加载与最新修订相同，不会重复记录
+func (m *Manager) recordFileChange(rule *Rule, note string) {
+	if m.history == nil {
+		return
+	}
+	last := m.history.last(rule.ID)
+	if last != nil && last.Rule != nil && sameRuleContent(last.Rule, rule) {
+		return
+	}
+	action := RevisionUpdate
+	if last == nil || last.Rule == nil {
+		action = RevisionCreate
 	}
+	m.recordRevision(rule.ID, action, rule, RuleChange{Author: fileRevisionAuthor, Note: note})
+}
+
+// ListRevisions 获取规则的修订历史，规则删除后历史仍可查询
+func (m *Manager) ListRevisions(id string) ([]*RuleRevision, error) {
+	if m.history == nil {
+		return nil, fmt.Errorf("未启用规则修订历史")
+	}
+	revisions, err := m.history.list(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(revisions) == 0 {
+		if _, err := m.GetRule(id); err != nil {
+			return nil, err
+		}
+	}
+	return revisions, nil
+}
+
+// GetRevision 获取规则的指定修订
+func (m *Manager) GetRevision(id string, revision int) (*RuleRevision, error) {
+	if m.history == nil {
+		return nil, fmt.Errorf("未启用规则修订历史")
+	}
+	return m.history.get(id, revision)
+}
+
+// DiffRevisions 比较规则两个修订之间的差异，from为0时与空规则比较
+func (m *Manager) DiffRevisions(id string, from, to int) ([]RuleDiffEntry, error) {
+	var fromRule *Rule
+	if from > 0 {
+		revision, err := m.GetRevision(id, from)
+		if err != nil {
+			return nil, err
+		}
+		fromRule = revision.Rule
+	}
+	revision, err := m.GetRevision(id, to)
+	if err != nil {
+		return nil, err
+	}
+	return diffRules(fromRule, revision.Rule), nil
+}
+
+// RollbackRule 把规则恢复为指定修订的内容，作为新版本保存。规则已删除时重新创建
+func (m *Manager) RollbackRule(id string, revision int, change RuleChange) (*Rule, error) {
+	target, err := m.GetRevision(id, revision)
+	if err != nil {
+		return nil, err
+	}
+	if target.Rule == nil {
+		return nil, fmt.Errorf("修订%d是删除记录，无法回滚", revision)
+	}
+	rule := *target.Rule
+	if change.Note == "" {
+		change.Note = fmt.Sprintf("回滚到修订%d", revision)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.saveRule(&rule, RevisionRollback, change); err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// ExportHistoryGit 把全部规则的修订历史导出为git裸仓库，dir为空时导出到修订历史目录下的git目录
+func (m *Manager) ExportHistoryGit(dir string) (string, int, error) {
+	if m.history == nil {
+		return "", 0, fmt.Errorf("未启用规则修订历史")
+	}
+	if dir == "" {
+		dir = filepath.Join(m.history.dir, "git")
+	}
+	commits, err := m.history.exportGit(dir)
+	if err != nil {
+		return "", 0, err
+	}
+	log.Info().Str("dir", dir).Int("commits", commits).Msg("规则修订历史导出完成")
+	return dir, commits, nil
+}
+
+// checkDependencies 检查保存规则后依赖图是否出现环路，调用方持有锁
+func (m *Manager) checkDependencies(rule *Rule) error {
+	if len(rule.After) == 0 && len(m.graph.downstream[rule.ID]) == 0 {
+		return nil
+	}
+	rules := make(map[string]*Rule, len(m.rules)+1)
+	for id, existing := range m.rules {
+		rules[id] = existing
+	}
+	rules[rule.ID] = rule
+	if cycle := buildRuleGraph(rules, m.pipelines).findCycle(rule.ID); cycle != nil {
+		return cycleError(cycle)
+	}
+	return nil
 }
 
 // WatchChanges 监控规则变化
@@ -690,10 +1008,16 @@ func (m *Manager) handleFileUpdate(filePath string) {
 			log.Error().Err(err).Str("rule_id", rule.ID).Msg("规则验证失败")
 			continue
 		}
+		if err := m.checkDependencies(rule); err != nil {
+			log.Error().Err(err).Str("rule_id", rule.ID).Msg("规则验证失败")
+			continue
+		}
 
 		m.initializeRule(rule)
 		m.rules[rule.ID] = rule
 		m.ruleIndex.AddRule(rule)
+		m.graph = buildRuleGraph(m.rules, m.pipelines)
+		m.recordFileChange(rule, "规则文件变更")
 
 		// 发送变更事件
 		select {
@@ -724,6 +1048,8 @@ func (m *Manager) handleFileDelete(filePath string) {
 	if rule, exists := m.rules[ruleID]; exists {
 		delete(m.rules, ruleID)
 		m.ruleIndex.RemoveRule(rule)
+		m.graph = buildRuleGraph(m.rules, m.pipelines)
+		m.recordRevision(ruleID, RevisionDelete, nil, RuleChange{Author: fileRevisionAuthor, Note: "规则文件删除"})
 
 		// 发送变更事件
 		select {
@@ -442,7 +442,11 @@ func (p *OptimizedWorkerPool) processBatch(workerID int, batch []RuleTask) {
 func (p *OptimizedWorkerPool) processRuleTask(task RuleTask) error {
 	// 这里调用实际的规则处理逻辑
 	// 为了避免循环依赖，使用接口调用
-	return p.service.processRuleTaskInternal(task.Rule, task.Point)
+	if task.Reevaluate {
+		p.service.reevaluateRule(task.Rule, task.Point)
+		return nil
+	}
+	return p.service.processRuleTaskInternal(task.Rule, task.Point, task.Hops)
 }
 
 // updateWorkerStats 更新worker统计
@@ -0,0 +1,224 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/y001j/iot-gateway/internal/model"
+)
+
+const (
+	// HeaderRuleHops 转发、转换发回规则引擎订阅主题的消息上记录经过规则次数的NATS消息头，
+	// 不写入数据点标签，不会传到北向连接器
+	HeaderRuleHops = "Rule-Hops"
+	// defaultMaxHops 数据点最多经过的规则次数，超过后丢弃，防止规则转发形成环路
+	defaultMaxHops = 8
+)
+
+// RulePipeline 规则管道，按顺序执行的规则，前一阶段的输出数据点在进程内传给下一阶段
+type RulePipeline struct {
+	ID     string   `json:"id" yaml:"id"`
+	Name   string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Stages []string `json:"stages" yaml:"stages"` // 规则ID
+}
+
+// validatePipelines 验证管道定义
+func validatePipelines(pipelines []*RulePipeline) error {
+	ids := make(map[string]bool, len(pipelines))
+	for i, pipeline := range pipelines {
+		if pipeline == nil || pipeline.ID == "" {
+			return fmt.Errorf("管道[%d]的ID不能为空", i)
+		}
+		if ids[pipeline.ID] {
+			return fmt.Errorf("管道ID重复: %s", pipeline.ID)
+		}
+		ids[pipeline.ID] = true
+		if len(pipeline.Stages) < 2 {
+			return fmt.Errorf("管道%s至少需要2个阶段", pipeline.ID)
+		}
+		for j, stage := range pipeline.Stages {
+			if stage == "" {
+				return fmt.Errorf("管道%s的阶段[%d]规则ID不能为空", pipeline.ID, j)
+			}
+		}
+	}
+	return nil
+}
+
+// ruleGraph 规则间的上下游关系，边来自规则的after和管道中相邻的阶段
+type ruleGraph struct {
+	downstream map[string][]string // 上游规则ID -> 下游规则ID
+	upstream   map[string][]string // 下游规则ID -> 上游规则ID
+}
+
+// buildRuleGraph 由规则和管道构建依赖图
+func buildRuleGraph(rules map[string]*Rule, pipelines []*RulePipeline) *ruleGraph {
+	g := &ruleGraph{
+		downstream: make(map[string][]string),
+		upstream:   make(map[string][]string),
+	}
+	seen := make(map[[2]string]bool)
+	addEdge := func(from, to string) {
+		edge := [2]string{from, to}
+		if seen[edge] {
+			return
+		}
+		seen[edge] = true
+		g.downstream[from] = append(g.downstream[from], to)
+		g.upstream[to] = append(g.upstream[to], from)
+	}
+
+	ids := make([]string, 0, len(rules))
+	for id := range rules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		for _, after := range rules[id].After {
+			addEdge(after, id)
+		}
+	}
+	for _, pipeline := range pipelines {
+		for i := 1; i < len(pipeline.Stages); i++ {
+			addEdge(pipeline.Stages[i-1], pipeline.Stages[i])
+		}
+	}
+	return g
+}
+
+// findCycle 查找经过start的环，返回环上的规则ID，没有环时返回nil
+func (g *ruleGraph) findCycle(start string) []string {
+	visited := make(map[string]bool)
+	var path []string
+	var visit func(id string) bool
+	visit = func(id string) bool {
+		path = append(path, id)
+		for _, next := range g.downstream[id] {
+			if next == start {
+				path = append(path, next)
+				return true
+			}
+			if !visited[next] {
+				visited[next] = true
+				if visit(next) {
+					return true
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+	if visit(start) {
+		return path
+	}
+	return nil
+}
+
+// findAnyCycle 查找图中任意一个环
+func (g *ruleGraph) findAnyCycle() []string {
+	ids := make([]string, 0, len(g.downstream))
+	for id := range g.downstream {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if cycle := g.findCycle(id); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// cycleError 环路错误
+func cycleError(cycle []string) error {
+	return fmt.Errorf("规则依赖存在环路: %s", strings.Join(cycle, " -> "))
+}
+
+type ruleHopsKey struct{}
+
+// ruleHops 动作执行时数据点经过的规则次数和规则引擎订阅的主题
+type ruleHops struct {
+	hops    int
+	subject string
+}
+
+// withHops 把经过的规则次数放入动作执行的context
+func withHops(ctx context.Context, hops int, subject string) context.Context {
+	return context.WithValue(ctx, ruleHopsKey{}, ruleHops{hops: hops, subject: subject})
+}
+
+// HopHeader 转发、转换动作发布消息时使用的消息头。只有目标主题会再次进入规则引擎、
+// 可能形成环路时才带经过的规则次数，否则返回nil
+func HopHeader(ctx context.Context, subject string) nats.Header {
+	if ctx == nil {
+		return nil
+	}
+	info, ok := ctx.Value(ruleHopsKey{}).(ruleHops)
+	if !ok || !subjectMatches(info.subject, subject) {
+		return nil
+	}
+	return nats.Header{HeaderRuleHops: []string{strconv.Itoa(info.hops)}}
+}
+
+// msgHops 消息已经过的规则次数，没有消息头时为0
+func msgHops(msg *nats.Msg) int {
+	if msg.Header == nil {
+		return 0
+	}
+	hops, err := strconv.Atoi(msg.Header.Get(HeaderRuleHops))
+	if err != nil || hops < 0 {
+		return 0
+	}
+	return hops
+}
+
+// subjectMatches 主题是否匹配订阅主题，支持通配符*和>
+func subjectMatches(pattern, subject string) bool {
+	if pattern == "" || subject == "" {
+		return false
+	}
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+	for i, token := range patternTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) {
+			return false
+		}
+		if token != "*" && token != subjectTokens[i] {
+			return false
+		}
+	}
+	return len(patternTokens) == len(subjectTokens)
+}
+
+// pipelineOutput 根据动作结果计算规则传给下游的数据点：
+// 过滤动作判定丢弃时不再传递，转换动作的结果作为输出，否则传递原数据点
+func pipelineOutput(point model.Point, results []*ActionResult) (model.Point, bool) {
+	out := point
+	for _, result := range results {
+		if result == nil || !result.Success {
+			continue
+		}
+		output, ok := result.Output.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch result.Type {
+		case "filter":
+			if filtered, _ := output["filtered"].(bool); filtered {
+				return model.Point{}, false
+			}
+		case "transform":
+			if transformed, ok := output["transformed_point"].(model.Point); ok {
+				out = transformed
+			}
+		}
+	}
+	return out, true
+}
@@ -0,0 +1,427 @@
+package rules
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 规则修订的变更类型
+const (
+	RevisionCreate   = "create"
+	RevisionUpdate   = "update"
+	RevisionDelete   = "delete"
+	RevisionEnable   = "enable"
+	RevisionDisable  = "disable"
+	RevisionRollback = "rollback"
+)
+
+// 未指定修改人时的默认值
+const (
+	defaultRevisionAuthor = "system"
+	fileRevisionAuthor    = "file" // 直接修改规则文件
+)
+
+// RuleChange 规则变更的修改人和说明，随修订记录保存
+type RuleChange struct {
+	Author string `json:"author,omitempty"`
+	Note   string `json:"note,omitempty"`
+}
+
+// RuleRevision 规则修订记录，Rule为变更后的规则快照，删除时为空
+type RuleRevision struct {
+	RuleID    string    `json:"rule_id"`
+	Revision  int       `json:"revision"` // 每个规则从1开始递增，删除后重建也继续递增
+	Version   int       `json:"version"`  // 变更后的规则版本
+	Action    string    `json:"action"`
+	Author    string    `json:"author"`
+	Note      string    `json:"note,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Rule      *Rule     `json:"rule,omitempty"`
+}
+
+// RuleDiffEntry 两个规则快照之间的一处差异
+type RuleDiffEntry struct {
+	Path string      `json:"path"` // 如 conditions.and[1].value
+	Op   string      `json:"op"`   // added、removed或changed
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// revisionStore 规则修订历史，每个规则一个只追加的JSON Lines文件
+type revisionStore struct {
+	dir  string
+	mu   sync.Mutex
+	next map[string]int // 规则ID -> 下一个修订号
+}
+
+// newRevisionStore 创建修订历史存储
+func newRevisionStore(dir string) *revisionStore {
+	return &revisionStore{
+		dir:  dir,
+		next: make(map[string]int),
+	}
+}
+
+// path 规则的修订历史文件
+func (s *revisionStore) path(ruleID string) string {
+	return filepath.Join(s.dir, ruleID+".jsonl")
+}
+
+// append 追加修订记录并分配修订号
+func (s *revisionStore) append(revision *RuleRevision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next, ok := s.next[revision.RuleID]
+	if !ok {
+		revisions, err := s.read(revision.RuleID)
+		if err != nil {
+			return err
+		}
+		next = 1
+		if len(revisions) > 0 {
+			next = revisions[len(revisions)-1].Revision + 1
+		}
+	}
+	revision.Revision = next
+
+	data, err := json.Marshal(revision)
+	if err != nil {
+		return fmt.Errorf("序列化修订记录失败: %w", err)
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("创建修订历史目录失败: %w", err)
+	}
+	file, err := os.OpenFile(s.path(revision.RuleID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开修订历史文件失败: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("写入修订历史失败: %w", err)
+	}
+
+	s.next[revision.RuleID] = next + 1
+	return nil
+}
+
+// list 规则的全部修订记录，按修订号升序
+func (s *revisionStore) list(ruleID string) ([]*RuleRevision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read(ruleID)
+}
+
+// get 获取指定修订
+func (s *revisionStore) get(ruleID string, revision int) (*RuleRevision, error) {
+	revisions, err := s.list(ruleID)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range revisions {
+		if r.Revision == revision {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("规则%s的修订不存在: %d", ruleID, revision)
+}
+
+// last 最新的修订，没有历史时返回nil
+func (s *revisionStore) last(ruleID string) *RuleRevision {
+	revisions, err := s.list(ruleID)
+	if err != nil || len(revisions) == 0 {
+		return nil
+	}
+	return revisions[len(revisions)-1]
+}
+
+// read 读取修订历史文件，调用方持有锁
+func (s *revisionStore) read(ruleID string) ([]*RuleRevision, error) {
+	file, err := os.Open(s.path(ruleID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("打开修订历史文件失败: %w", err)
+	}
+	defer file.Close()
+
+	var revisions []*RuleRevision
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var revision RuleRevision
+		if err := json.Unmarshal(line, &revision); err != nil {
+			// 写入中断留下的不完整记录不影响其他记录
+			continue
+		}
+		revisions = append(revisions, &revision)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取修订历史失败: %w", err)
+	}
+	return revisions, nil
+}
+
+// all 全部规则的修订记录，按时间排序
+func (s *revisionStore) all() ([]*RuleRevision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := ioutil.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取修订历史目录失败: %w", err)
+	}
+
+	var revisions []*RuleRevision
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".jsonl" {
+			continue
+		}
+		ruleRevisions, err := s.read(strings.TrimSuffix(file.Name(), ".jsonl"))
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, ruleRevisions...)
+	}
+	sort.SliceStable(revisions, func(i, j int) bool {
+		if !revisions[i].Timestamp.Equal(revisions[j].Timestamp) {
+			return revisions[i].Timestamp.Before(revisions[j].Timestamp)
+		}
+		if revisions[i].RuleID != revisions[j].RuleID {
+			return revisions[i].RuleID < revisions[j].RuleID
+		}
+		return revisions[i].Revision < revisions[j].Revision
+	})
+	return revisions, nil
+}
+
+// diffRules 比较两个规则快照的结构差异，忽略版本和时间。快照为空时视为没有任何字段
+func diffRules(from, to *Rule) []RuleDiffEntry {
+	diffs := []RuleDiffEntry{}
+	diffValues("", ruleDiffValue(from), ruleDiffValue(to), &diffs)
+	return diffs
+}
+
+// ruleDiffValue 把规则转换为通用的JSON结构
+func ruleDiffValue(rule *Rule) map[string]interface{} {
+	value := make(map[string]interface{})
+	if rule == nil {
+		return value
+	}
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return value
+	}
+	json.Unmarshal(data, &value)
+	delete(value, "version")
+	delete(value, "created_at")
+	delete(value, "updated_at")
+	return value
+}
+
+// diffValues 递归比较，对象按键、数组按下标比较
+func diffValues(path string, from, to interface{}, diffs *[]RuleDiffEntry) {
+	fromMap, fromIsMap := from.(map[string]interface{})
+	toMap, toIsMap := to.(map[string]interface{})
+	if fromIsMap && toIsMap {
+		keys := make([]string, 0, len(fromMap)+len(toMap))
+		for key := range fromMap {
+			keys = append(keys, key)
+		}
+		for key := range toMap {
+			if _, ok := fromMap[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := key
+			if path != "" {
+				child = path + "." + key
+			}
+			fromValue, inFrom := fromMap[key]
+			toValue, inTo := toMap[key]
+			switch {
+			case !inFrom:
+				*diffs = append(*diffs, RuleDiffEntry{Path: child, Op: "added", New: toValue})
+			case !inTo:
+				*diffs = append(*diffs, RuleDiffEntry{Path: child, Op: "removed", Old: fromValue})
+			default:
+				diffValues(child, fromValue, toValue, diffs)
+			}
+		}
+		return
+	}
+
+	fromList, fromIsList := from.([]interface{})
+	toList, toIsList := to.([]interface{})
+	if fromIsList && toIsList {
+		for i := 0; i < len(fromList) || i < len(toList); i++ {
+			child := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(fromList):
+				*diffs = append(*diffs, RuleDiffEntry{Path: child, Op: "added", New: toList[i]})
+			case i >= len(toList):
+				*diffs = append(*diffs, RuleDiffEntry{Path: child, Op: "removed", Old: fromList[i]})
+			default:
+				diffValues(child, fromList[i], toList[i], diffs)
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		*diffs = append(*diffs, RuleDiffEntry{Path: path, Op: "changed", Old: from, New: to})
+	}
+}
+
+// exportGit 把修订历史导出为git裸仓库：每个修订一次提交，提交的树中每个规则一个JSON文件。
+// 目录需不存在、为空或是之前导出的仓库，返回提交数量
+func (s *revisionStore) exportGit(dir string) (int, error) {
+	if entries, err := ioutil.ReadDir(dir); err == nil && len(entries) > 0 {
+		if _, err := os.Stat(filepath.Join(dir, "HEAD")); err != nil {
+			return 0, fmt.Errorf("导出目录不为空且不是git仓库: %s", dir)
+		}
+	}
+	revisions, err := s.all()
+	if err != nil {
+		return 0, err
+	}
+
+	git := &gitWriter{dir: dir}
+	for _, sub := range []string{"objects", "refs/heads", "refs/tags"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return 0, fmt.Errorf("创建导出目录失败: %w", err)
+		}
+	}
+
+	files := make(map[string]string) // 文件名 -> blob哈希
+	parent := ""
+	for _, revision := range revisions {
+		name := revision.RuleID + ".json"
+		if revision.Rule == nil {
+			delete(files, name)
+		} else {
+			data, err := json.MarshalIndent(revision.Rule, "", "  ")
+			if err != nil {
+				return 0, fmt.Errorf("序列化规则快照失败: %w", err)
+			}
+			blob, err := git.write("blob", append(data, '\n'))
+			if err != nil {
+				return 0, err
+			}
+			files[name] = blob
+		}
+
+		tree, err := git.writeTree(files)
+		if err != nil {
+			return 0, err
+		}
+		commit, err := git.writeCommit(tree, parent, revision)
+		if err != nil {
+			return 0, err
+		}
+		parent = commit
+	}
+
+	refs := map[string]string{
+		"HEAD":   "ref: refs/heads/master\n",
+		"config": "[core]\n\trepositoryformatversion = 0\n\tfilemode = true\n\tbare = true\n",
+	}
+	if parent != "" {
+		refs["refs/heads/master"] = parent + "\n"
+	}
+	for name, content := range refs {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			return 0, fmt.Errorf("写入%s失败: %w", name, err)
+		}
+	}
+	return len(revisions), nil
+}
+
+// gitWriter 写入git松散对象
+type gitWriter struct {
+	dir string
+}
+
+// write 写入对象，返回十六进制哈希
+func (g *gitWriter) write(kind string, content []byte) (string, error) {
+	raw := append([]byte(fmt.Sprintf("%s %d\x00", kind, len(content))), content...)
+	sum := sha1.Sum(raw)
+	hash := hex.EncodeToString(sum[:])
+
+	path := filepath.Join(g.dir, "objects", hash[:2], hash[2:])
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(raw)
+	zw.Close()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("创建对象目录失败: %w", err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0444); err != nil {
+		return "", fmt.Errorf("写入git对象失败: %w", err)
+	}
+	return hash, nil
+}
+
+// writeTree 写入只包含文件的树对象，条目按名称排序
+func (g *gitWriter) writeTree(files map[string]string) (string, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		hash, _ := hex.DecodeString(files[name])
+		fmt.Fprintf(&buf, "100644 %s\x00", name)
+		buf.Write(hash)
+	}
+	return g.write("tree", buf.Bytes())
+}
+
+// writeCommit 写入修订对应的提交
+func (g *gitWriter) writeCommit(tree, parent string, revision *RuleRevision) (string, error) {
+	author := revision.Author
+	if author == "" {
+		author = defaultRevisionAuthor
+	}
+	signature := fmt.Sprintf("%s <%s@iot-gateway> %d +0000", author, strings.ReplaceAll(author, " ", "."), revision.Timestamp.Unix())
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "tree %s\n", tree)
+	if parent != "" {
+		fmt.Fprintf(&buf, "parent %s\n", parent)
+	}
+	fmt.Fprintf(&buf, "author %s\ncommitter %s\n\n", signature, signature)
+	fmt.Fprintf(&buf, "%s %s (revision %d, version %d)\n", revision.Action, revision.RuleID, revision.Revision, revision.Version)
+	if revision.Note != "" {
+		fmt.Fprintf(&buf, "\n%s\n", revision.Note)
+	}
+	return g.write("commit", buf.Bytes())
+}
@@ -0,0 +1,468 @@
+package rules
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/model"
+)
+
+// 定时触发类型
+const (
+	ScheduleTypeAbsence  = "absence"  // 数据缺失：设备/key超过期望周期未上报
+	ScheduleTypeCron     = "cron"     // 按cron表达式定时评估
+	ScheduleTypeInterval = "interval" // 按固定间隔生成合成数据点
+
+	scheduleTickInterval = time.Second
+	defaultScheduleKey   = "schedule"
+)
+
+// RuleSchedule 规则的定时触发配置。设置后规则不再由数据点触发，
+// 而是由定时器生成合成数据点后按普通规则评估条件、执行动作
+type RuleSchedule struct {
+	Type     string `json:"type" yaml:"type"`                               // absence、cron或interval
+	DeviceID string `json:"device_id,omitempty" yaml:"device_id,omitempty"` // absence为设备ID模式（支持*通配）；cron/interval为合成数据点的设备ID，默认规则ID
+	Key      string `json:"key,omitempty" yaml:"key,omitempty"`             // absence为key模式（支持*通配）；cron/interval为合成数据点的key，默认schedule
+	Period   string `json:"period,omitempty" yaml:"period,omitempty"`       // absence: 期望上报周期
+	Grace    string `json:"grace,omitempty" yaml:"grace,omitempty"`         // absence: 超过周期后的宽限时间
+	Cron     string `json:"cron,omitempty" yaml:"cron,omitempty"`           // cron: 分 时 日 月 周，或@daily等简写
+	Timezone string `json:"timezone,omitempty" yaml:"timezone,omitempty"`   // cron: 时区，默认使用规则引擎配置的时区
+	Interval string `json:"interval,omitempty" yaml:"interval,omitempty"`   // interval: 触发间隔
+	Value    string `json:"value,omitempty" yaml:"value,omitempty"`         // cron/interval: 合成数据点值的表达式，可使用last/age/avg_over
+	Publish  bool   `json:"publish,omitempty" yaml:"publish,omitempty"`     // cron/interval: 同时把合成数据点发布到数据总线
+}
+
+// ScheduleStatus 定时器状态快照
+type ScheduleStatus struct {
+	RuleID  string          `json:"rule_id"`
+	Type    string          `json:"type"`
+	NextRun time.Time       `json:"next_run,omitempty"`
+	Series  []AbsenceStatus `json:"series,omitempty"`
+}
+
+// AbsenceStatus 数据缺失检测中单个设备+key的状态
+type AbsenceStatus struct {
+	DeviceID string    `json:"device_id"`
+	Key      string    `json:"key"`
+	LastSeen time.Time `json:"last_seen"`
+	Missing  bool      `json:"missing"`
+}
+
+// validateSchedule 验证定时触发配置
+func validateSchedule(schedule *RuleSchedule) error {
+	_, err := compileSchedule(schedule, time.Local)
+	return err
+}
+
+// absenceSeries 数据缺失检测跟踪的一个设备+key
+type absenceSeries struct {
+	deviceID string
+	key      string
+	lastSeen time.Time
+	missing  bool
+}
+
+// ruleTimer 单个规则的定时器
+type ruleTimer struct {
+	rule        *Rule
+	fingerprint string
+	location    *time.Location
+	cron        *cronSchedule
+	interval    time.Duration
+	period      time.Duration
+	grace       time.Duration
+	value       *CompiledExpression // cron/interval合成数据点值的表达式
+	next        time.Time
+	series      map[string]*absenceSeries
+}
+
+// compileSchedule 解析定时触发配置
+func compileSchedule(schedule *RuleSchedule, defaultLocation *time.Location) (*ruleTimer, error) {
+	if schedule == nil {
+		return nil, fmt.Errorf("定时触发配置不能为空")
+	}
+	t := &ruleTimer{location: defaultLocation}
+	parse := func(name, value string) (time.Duration, error) {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return 0, fmt.Errorf("无效的%s: %s", name, value)
+		}
+		return d, nil
+	}
+
+	var err error
+	switch schedule.Type {
+	case ScheduleTypeAbsence:
+		if schedule.Period == "" {
+			return nil, fmt.Errorf("数据缺失触发必须指定period")
+		}
+		if t.period, err = parse("period", schedule.Period); err != nil {
+			return nil, err
+		}
+		if schedule.Grace != "" {
+			if t.grace, err = parse("grace", schedule.Grace); err != nil {
+				return nil, err
+			}
+		}
+		for _, pattern := range []string{schedule.DeviceID, schedule.Key} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("无效的匹配模式: %s", pattern)
+			}
+		}
+		t.series = make(map[string]*absenceSeries)
+	case ScheduleTypeCron:
+		if schedule.Cron == "" {
+			return nil, fmt.Errorf("cron触发必须指定cron表达式")
+		}
+		if t.cron, err = parseCron(schedule.Cron); err != nil {
+			return nil, err
+		}
+		if schedule.Timezone != "" {
+			if t.location, err = time.LoadLocation(schedule.Timezone); err != nil {
+				return nil, fmt.Errorf("无效的时区: %s", schedule.Timezone)
+			}
+		}
+	case ScheduleTypeInterval:
+		if schedule.Interval == "" {
+			return nil, fmt.Errorf("间隔触发必须指定interval")
+		}
+		if t.interval, err = parse("interval", schedule.Interval); err != nil {
+			return nil, err
+		}
+		if t.interval < scheduleTickInterval {
+			return nil, fmt.Errorf("interval不能小于%s", scheduleTickInterval)
+		}
+	default:
+		return nil, fmt.Errorf("不支持的定时触发类型: %s，可选absence、cron或interval", schedule.Type)
+	}
+	if schedule.Value != "" {
+		if t.value, err = CompileExpression(schedule.Value); err != nil {
+			return nil, fmt.Errorf("value表达式无效: %w", err)
+		}
+	}
+	return t, nil
+}
+
+// scheduleFingerprint 定时配置指纹，配置不变时规则编辑和热加载保留定时器状态
+func scheduleFingerprint(schedule *RuleSchedule) string {
+	data, _ := json.Marshal(schedule)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// matchSeries 数据点是否属于数据缺失检测的范围
+func (t *ruleTimer) matchSeries(deviceID, key string) bool {
+	schedule := t.rule.Schedule
+	if schedule.DeviceID != "" {
+		if ok, _ := path.Match(schedule.DeviceID, deviceID); !ok {
+			return false
+		}
+	}
+	if schedule.Key != "" {
+		if ok, _ := path.Match(schedule.Key, key); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// seed 设备和key都没有通配时，从启动时刻开始等待，从未上报的输入也能被检测到
+func (t *ruleTimer) seed(now time.Time) {
+	schedule := t.rule.Schedule
+	if schedule.DeviceID == "" || schedule.Key == "" ||
+		strings.ContainsAny(schedule.DeviceID, "*?[") || strings.ContainsAny(schedule.Key, "*?[") {
+		return
+	}
+	id := referenceKey(schedule.DeviceID, schedule.Key)
+	if _, ok := t.series[id]; ok {
+		return
+	}
+	lastSeen := now
+	if age, ok := globalLastValueCache.Age(schedule.DeviceID, schedule.Key); ok {
+		lastSeen = now.Add(-age)
+	}
+	t.series[id] = &absenceSeries{deviceID: schedule.DeviceID, key: schedule.Key, lastSeen: lastSeen}
+}
+
+// scheduleNext 计算下一次cron/interval触发时间
+func (t *ruleTimer) scheduleNext(now time.Time) {
+	switch {
+	case t.cron != nil:
+		t.next = t.cron.Next(now.In(t.location))
+	case t.interval > 0:
+		if t.next.IsZero() {
+			t.next = now.Add(t.interval)
+			return
+		}
+		for !t.next.After(now) {
+			t.next = t.next.Add(t.interval)
+		}
+	}
+}
+
+// scheduledFiring 一次到期的定时触发
+type scheduledFiring struct {
+	rule  *Rule
+	point model.Point
+}
+
+// ruleScheduler 管理所有规则的定时器，定时器按规则ID和定时配置指纹保存，
+// 规则热加载或编辑后配置未变的定时器保留下次触发时间和缺失检测状态
+type ruleScheduler struct {
+	location *time.Location
+	timers   map[string]*ruleTimer
+	invalid  map[string]string // 配置无效的规则ID到配置指纹
+	absence  int               // 数据缺失检测定时器数量，为0时Observe直接返回
+	mu       sync.Mutex
+}
+
+func newRuleScheduler(location *time.Location) *ruleScheduler {
+	if location == nil {
+		location = time.Local
+	}
+	return &ruleScheduler{
+		location: location,
+		timers:   make(map[string]*ruleTimer),
+		invalid:  make(map[string]string),
+	}
+}
+
+// Sync 按当前启用的规则增删定时器
+func (s *ruleScheduler) Sync(rules []*Rule, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		if rule == nil || rule.Schedule == nil {
+			continue
+		}
+		active[rule.ID] = true
+		fp := scheduleFingerprint(rule.Schedule)
+		if old, ok := s.timers[rule.ID]; ok && old.fingerprint == fp {
+			old.rule = rule
+			continue
+		}
+
+		timer, err := compileSchedule(rule.Schedule, s.location)
+		if err != nil {
+			// 同一配置只记录一次错误
+			if s.invalid[rule.ID] != fp {
+				log.Error().Err(err).Str("rule_id", rule.ID).Msg("规则定时触发配置无效")
+				s.invalid[rule.ID] = fp
+			}
+			delete(s.timers, rule.ID)
+			continue
+		}
+		delete(s.invalid, rule.ID)
+		timer.rule = rule
+		timer.fingerprint = fp
+		if old, ok := s.timers[rule.ID]; ok && old.series != nil && timer.series != nil {
+			// 缺失检测范围调整后，仍在范围内的输入保留最后上报时间
+			for id, series := range old.series {
+				if timer.matchSeries(series.deviceID, series.key) {
+					timer.series[id] = series
+				}
+			}
+		}
+		if timer.series != nil {
+			timer.seed(now)
+		}
+		timer.scheduleNext(now)
+		s.timers[rule.ID] = timer
+
+		log.Info().
+			Str("rule_id", rule.ID).
+			Str("type", rule.Schedule.Type).
+			Time("next_run", timer.next).
+			Msg("规则定时器已设置")
+	}
+
+	for id := range s.invalid {
+		if !active[id] {
+			delete(s.invalid, id)
+		}
+	}
+	s.absence = 0
+	for id, timer := range s.timers {
+		if !active[id] {
+			delete(s.timers, id)
+			log.Info().Str("rule_id", id).Msg("规则定时器已移除")
+			continue
+		}
+		if timer.series != nil {
+			s.absence++
+		}
+	}
+}
+
+// Observe 记录数据点到达时间，供数据缺失检测使用
+func (s *ruleScheduler) Observe(point model.Point) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.absence == 0 {
+		return
+	}
+	now := time.Now()
+	for _, timer := range s.timers {
+		if timer.series == nil || !timer.matchSeries(point.DeviceID, point.Key) {
+			continue
+		}
+		id := referenceKey(point.DeviceID, point.Key)
+		series, ok := timer.series[id]
+		if !ok {
+			series = &absenceSeries{deviceID: point.DeviceID, key: point.Key}
+			timer.series[id] = series
+		}
+		if series.missing {
+			log.Info().
+				Str("rule_id", timer.rule.ID).
+				Str("device_id", point.DeviceID).
+				Str("key", point.Key).
+				Msg("数据恢复上报")
+		}
+		series.lastSeen = now
+		series.missing = false
+	}
+}
+
+// Due 返回到期的定时触发，并推进定时器
+func (s *ruleScheduler) Due(now time.Time) []scheduledFiring {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var firings []scheduledFiring
+	for _, timer := range s.timers {
+		if timer.series != nil {
+			for _, series := range timer.series {
+				if series.missing || now.Sub(series.lastSeen) <= timer.period+timer.grace {
+					continue
+				}
+				series.missing = true
+				firings = append(firings, scheduledFiring{rule: timer.rule, point: absencePoint(timer.rule, series, now)})
+			}
+			continue
+		}
+		if timer.next.IsZero() || now.Before(timer.next) {
+			continue
+		}
+		scheduled := timer.next
+		timer.scheduleNext(now)
+		point, err := syntheticPoint(timer.rule, timer.value, scheduled)
+		if err != nil {
+			log.Warn().Err(err).Str("rule_id", timer.rule.ID).Msg("生成定时数据点失败，跳过本次触发")
+			continue
+		}
+		firings = append(firings, scheduledFiring{rule: timer.rule, point: point})
+	}
+	return firings
+}
+
+// Statuses 所有定时器的状态，按规则ID排序
+func (s *ruleScheduler) Statuses() []ScheduleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]ScheduleStatus, 0, len(s.timers))
+	for id, timer := range s.timers {
+		status := ScheduleStatus{RuleID: id, Type: timer.rule.Schedule.Type, NextRun: timer.next}
+		for _, series := range timer.series {
+			status.Series = append(status.Series, AbsenceStatus{
+				DeviceID: series.deviceID,
+				Key:      series.key,
+				LastSeen: series.lastSeen,
+				Missing:  series.missing,
+			})
+		}
+		sort.Slice(status.Series, func(i, j int) bool {
+			if status.Series[i].DeviceID != status.Series[j].DeviceID {
+				return status.Series[i].DeviceID < status.Series[j].DeviceID
+			}
+			return status.Series[i].Key < status.Series[j].Key
+		})
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].RuleID < result[j].RuleID })
+	return result
+}
+
+// Run 每秒同步规则并分发到期的触发，之后调用tick（如推进报警延时），直到ctx取消
+func (s *ruleScheduler) Run(ctx context.Context, rules func() []*Rule, dispatch func(*Rule, model.Point), tick func(now time.Time)) {
+	ticker := time.NewTicker(scheduleTickInterval)
+	defer ticker.Stop()
+
+	s.Sync(rules(), time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.Sync(rules(), now)
+			for _, firing := range s.Due(now) {
+				dispatch(firing.rule, firing.point)
+			}
+			if tick != nil {
+				tick(now)
+			}
+		}
+	}
+}
+
+// absencePoint 数据缺失时生成的合成数据点，值为距最后一次上报的秒数
+func absencePoint(rule *Rule, series *absenceSeries, now time.Time) model.Point {
+	point := model.NewPoint(series.key, series.deviceID, now.Sub(series.lastSeen).Seconds(), model.TypeFloat)
+	point.Timestamp = now
+	point.AddTag("trigger", ScheduleTypeAbsence)
+	point.AddTag("rule_id", rule.ID)
+	point.AddTag("last_seen", series.lastSeen.Format(time.RFC3339))
+	return point
+}
+
+// syntheticPoint cron/interval触发时生成的合成数据点，值为定时器编译的value表达式结果，
+// 未设置时为计划触发时间的Unix秒数
+func syntheticPoint(rule *Rule, value *CompiledExpression, scheduled time.Time) (model.Point, error) {
+	schedule := rule.Schedule
+	deviceID := schedule.DeviceID
+	if deviceID == "" {
+		deviceID = rule.ID
+	}
+	key := schedule.Key
+	if key == "" {
+		key = defaultScheduleKey
+	}
+
+	point := model.NewPoint(key, deviceID, scheduled.Unix(), model.TypeInt)
+	point.Timestamp = scheduled
+	point.AddTag("trigger", schedule.Type)
+	point.AddTag("rule_id", rule.ID)
+	if value == nil {
+		return point, nil
+	}
+
+	result, err := NewExpressionEngine().EvaluateCompiled(value, point)
+	if err != nil {
+		return point, fmt.Errorf("计算合成数据点的值失败: %w", err)
+	}
+	point.Value = result
+	switch result.(type) {
+	case bool:
+		point.Type = model.TypeBool
+	case string:
+		point.Type = model.TypeString
+	case int, int32, int64:
+		point.Type = model.TypeInt
+	default:
+		point.Type = model.TypeFloat
+	}
+	return point, nil
+}
@@ -0,0 +1,376 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/model"
+)
+
+const (
+	defaultSequenceMaxPartial = 100
+	sequenceSweepInterval     = 30 * time.Second
+)
+
+// SequenceCondition 事件序列条件，按顺序匹配多个步骤，
+// 例如"开门后10分钟内温度超过8度，且期间没有关门"
+type SequenceCondition struct {
+	Steps       []*SequenceStep `json:"steps" yaml:"steps"`
+	Within      string          `json:"within,omitempty" yaml:"within,omitempty"`             // 第一步到最后一步的最长时间
+	PartitionBy string          `json:"partition_by,omitempty" yaml:"partition_by,omitempty"` // device_id、key或tags.<名称>，为空时全部数据共用一个分区
+	MaxPartial  int             `json:"max_partial,omitempty" yaml:"max_partial,omitempty"`   // 每个分区同时进行的部分匹配上限，默认100
+}
+
+// SequenceStep 序列中的一个步骤
+type SequenceStep struct {
+	Name      string     `json:"name,omitempty" yaml:"name,omitempty"`
+	DeviceID  string     `json:"device_id,omitempty" yaml:"device_id,omitempty"` // 只匹配该设备的数据点
+	Key       string     `json:"key,omitempty" yaml:"key,omitempty"`             // 只匹配该key的数据点
+	Condition *Condition `json:"condition,omitempty" yaml:"condition,omitempty"`
+	Within    string     `json:"within,omitempty" yaml:"within,omitempty"` // 距上一个匹配步骤的最长时间
+	Negate    bool       `json:"negate,omitempty" yaml:"negate,omitempty"` // 否定步骤：前后两个步骤之间出现该事件时放弃部分匹配
+}
+
+// SequenceEvent 序列中某一步匹配到的事件
+type SequenceEvent struct {
+	Step      int               `json:"step"`
+	Name      string            `json:"name,omitempty"`
+	DeviceID  string            `json:"device_id"`
+	Key       string            `json:"key"`
+	Value     interface{}       `json:"value"`
+	Timestamp time.Time         `json:"timestamp"`
+	Tags      map[string]string `json:"tags,omitempty"`
+}
+
+// SequenceMatch 完整匹配的事件序列，通过context传给动作
+type SequenceMatch struct {
+	RuleID      string          `json:"rule_id"`
+	Partition   string          `json:"partition,omitempty"`
+	StartedAt   time.Time       `json:"started_at"`
+	CompletedAt time.Time       `json:"completed_at"`
+	Events      []SequenceEvent `json:"events"`
+}
+
+type sequenceMatchKey struct{}
+
+// WithSequenceMatch 把序列匹配结果放入动作执行的context
+func WithSequenceMatch(ctx context.Context, match *SequenceMatch) context.Context {
+	if match == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, sequenceMatchKey{}, match)
+}
+
+// SequenceMatchFromContext 获取触发本次动作的序列匹配结果，非序列规则返回nil
+func SequenceMatchFromContext(ctx context.Context) *SequenceMatch {
+	if ctx == nil {
+		return nil
+	}
+	match, _ := ctx.Value(sequenceMatchKey{}).(*SequenceMatch)
+	return match
+}
+
+// validateSequence 验证序列条件
+func validateSequence(seq *SequenceCondition) error {
+	if seq == nil {
+		return fmt.Errorf("序列条件必须指定sequence")
+	}
+	_, err := compileSequence(seq)
+	return err
+}
+
+// sequenceStep 解析后的步骤
+type sequenceStep struct {
+	*SequenceStep
+	within time.Duration
+}
+
+// sequenceRun 一个进行中的部分匹配
+type sequenceRun struct {
+	prev    int // 最近匹配的肯定步骤
+	next    int // 下一个待匹配的肯定步骤
+	started time.Time
+	last    time.Time
+	events  []SequenceEvent
+}
+
+// sequenceMatcher 单个规则中一个序列条件的匹配状态，按分区保存部分匹配
+type sequenceMatcher struct {
+	steps      []sequenceStep
+	within     time.Duration
+	partition  string
+	maxPartial int
+	partitions map[string][]*sequenceRun
+	lastSweep  time.Time
+	mu         sync.Mutex
+}
+
+// compileSequence 解析序列条件的时长和步骤
+func compileSequence(seq *SequenceCondition) (*sequenceMatcher, error) {
+	if len(seq.Steps) == 0 {
+		return nil, fmt.Errorf("序列条件至少需要1个步骤")
+	}
+
+	m := &sequenceMatcher{
+		partition:  seq.PartitionBy,
+		maxPartial: seq.MaxPartial,
+		partitions: make(map[string][]*sequenceRun),
+	}
+	if m.maxPartial <= 0 {
+		m.maxPartial = defaultSequenceMaxPartial
+	}
+	switch {
+	case m.partition == "", m.partition == "device_id", m.partition == "key":
+	case strings.HasPrefix(m.partition, "tags.") && len(m.partition) > len("tags."):
+	default:
+		return nil, fmt.Errorf("不支持的序列分区: %s，可选device_id、key或tags.<名称>", m.partition)
+	}
+	if seq.Within != "" {
+		d, err := time.ParseDuration(seq.Within)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("无效的序列within: %s", seq.Within)
+		}
+		m.within = d
+	}
+
+	for i, step := range seq.Steps {
+		if step == nil {
+			return nil, fmt.Errorf("序列步骤[%d]不能为空", i)
+		}
+		if step.Condition == nil && step.DeviceID == "" && step.Key == "" {
+			return nil, fmt.Errorf("序列步骤[%d]必须指定condition、device_id或key", i)
+		}
+		if containsSequence(step.Condition) {
+			return nil, fmt.Errorf("序列步骤[%d]的条件不能包含序列或报警条件", i)
+		}
+		compiled := sequenceStep{SequenceStep: step}
+		if step.Within != "" {
+			d, err := time.ParseDuration(step.Within)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("序列步骤[%d]的within无效: %s", i, step.Within)
+			}
+			if step.Negate {
+				return nil, fmt.Errorf("序列步骤[%d]是否定步骤，不能指定within", i)
+			}
+			compiled.within = d
+		}
+		m.steps = append(m.steps, compiled)
+	}
+	if m.steps[0].Negate {
+		return nil, fmt.Errorf("序列的第一个步骤不能是否定步骤")
+	}
+	if m.steps[len(m.steps)-1].Negate {
+		return nil, fmt.Errorf("序列的最后一个步骤不能是否定步骤")
+	}
+	return m, nil
+}
+
+// containsSequence 条件树中是否包含有状态条件
+func containsSequence(condition *Condition) bool {
+	if condition == nil {
+		return false
+	}
+	if condition.Type == "sequence" || condition.Sequence != nil || condition.Type == "alarm" || condition.Alarm != nil {
+		return true
+	}
+	for _, sub := range condition.And {
+		if containsSequence(sub) {
+			return true
+		}
+	}
+	for _, sub := range condition.Or {
+		if containsSequence(sub) {
+			return true
+		}
+	}
+	return containsSequence(condition.Not)
+}
+
+// process 处理一个数据点，序列完整匹配时返回匹配结果
+func (m *sequenceMatcher) process(e *Evaluator, ruleID string, point model.Point) (*SequenceMatch, error) {
+	now := point.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	partition := m.partitionKey(point)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastSweep) >= sequenceSweepInterval {
+		m.sweep(now)
+	}
+
+	var completed *SequenceMatch
+	runs := m.partitions[partition]
+	kept := make([]*sequenceRun, 0, len(runs)+1)
+	for _, run := range runs {
+		if m.expired(run, now) {
+			continue
+		}
+
+		// 上一步和下一步之间出现否定事件，放弃该部分匹配
+		broken := false
+		for i := run.prev + 1; i < run.next; i++ {
+			ok, err := m.matchStep(e, i, point)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				broken = true
+				break
+			}
+		}
+		if broken {
+			continue
+		}
+
+		ok, err := m.matchStep(e, run.next, point)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			m.advance(run, point, now)
+			if run.next >= len(m.steps) {
+				if completed == nil {
+					completed = m.buildMatch(ruleID, partition, run, now)
+				}
+				continue
+			}
+		}
+		kept = append(kept, run)
+	}
+
+	// 第一步匹配时开始新的部分匹配
+	ok, err := m.matchStep(e, 0, point)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		run := &sequenceRun{prev: -1, next: 0, started: now}
+		m.advance(run, point, now)
+		if run.next >= len(m.steps) {
+			if completed == nil {
+				completed = m.buildMatch(ruleID, partition, run, now)
+			}
+		} else {
+			kept = append(kept, run)
+		}
+	}
+
+	if over := len(kept) - m.maxPartial; over > 0 {
+		kept = append(kept[:0], kept[over:]...)
+	}
+	if len(kept) == 0 {
+		delete(m.partitions, partition)
+	} else {
+		m.partitions[partition] = kept
+	}
+	return completed, nil
+}
+
+// advance 记录当前步骤的事件并移动到下一个肯定步骤
+func (m *sequenceMatcher) advance(run *sequenceRun, point model.Point, now time.Time) {
+	step := run.next
+	run.events = append(run.events, SequenceEvent{
+		Step:      step,
+		Name:      m.steps[step].Name,
+		DeviceID:  point.DeviceID,
+		Key:       point.Key,
+		Value:     point.Value,
+		Timestamp: now,
+		Tags:      point.GetTagsCopy(),
+	})
+	run.prev = step
+	run.last = now
+	run.next = step + 1
+	for run.next < len(m.steps) && m.steps[run.next].Negate {
+		run.next++
+	}
+}
+
+// expired 部分匹配是否已超过序列或下一步骤的时间限制
+func (m *sequenceMatcher) expired(run *sequenceRun, now time.Time) bool {
+	if m.within > 0 && now.Sub(run.started) > m.within {
+		return true
+	}
+	if run.next < len(m.steps) {
+		if within := m.steps[run.next].within; within > 0 && now.Sub(run.last) > within {
+			return true
+		}
+	}
+	return false
+}
+
+// sweep 清理所有分区中已超时的部分匹配
+func (m *sequenceMatcher) sweep(now time.Time) {
+	m.lastSweep = now
+	timeouts := 0
+	for partition, runs := range m.partitions {
+		kept := runs[:0]
+		for _, run := range runs {
+			if m.expired(run, now) {
+				timeouts++
+				continue
+			}
+			kept = append(kept, run)
+		}
+		if len(kept) == 0 {
+			delete(m.partitions, partition)
+		} else {
+			m.partitions[partition] = kept
+		}
+	}
+	if timeouts > 0 {
+		log.Debug().Int("timeouts", timeouts).Msg("清理超时的序列部分匹配")
+	}
+}
+
+// matchStep 判断数据点是否满足某个步骤
+func (m *sequenceMatcher) matchStep(e *Evaluator, index int, point model.Point) (bool, error) {
+	step := m.steps[index]
+	if step.DeviceID != "" && step.DeviceID != point.DeviceID {
+		return false, nil
+	}
+	if step.Key != "" && step.Key != point.Key {
+		return false, nil
+	}
+	if step.Condition == nil {
+		return true, nil
+	}
+	ok, err := e.Evaluate(step.Condition, point)
+	if err != nil {
+		return false, fmt.Errorf("序列步骤[%d]评估失败: %w", index, err)
+	}
+	return ok, nil
+}
+
+// partitionKey 计算数据点所属的分区
+func (m *sequenceMatcher) partitionKey(point model.Point) string {
+	switch m.partition {
+	case "":
+		return ""
+	case "device_id":
+		return point.DeviceID
+	case "key":
+		return point.Key
+	default:
+		value, _ := point.GetTag(strings.TrimPrefix(m.partition, "tags."))
+		return value
+	}
+}
+
+// buildMatch 生成完整匹配结果
+func (m *sequenceMatcher) buildMatch(ruleID, partition string, run *sequenceRun, now time.Time) *SequenceMatch {
+	return &SequenceMatch{
+		RuleID:      ruleID,
+		Partition:   partition,
+		StartedAt:   run.started,
+		CompletedAt: now,
+		Events:      run.events,
+	}
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/codec"
 	"github.com/y001j/iot-gateway/internal/model"
 )
 
@@ -25,6 +26,13 @@ type RuleEngineConfig struct {
 	Rules     []*Rule           `yaml:"rules" json:"rules"`
 	Subject   string            `yaml:"subject" json:"subject"`
 	HotReload *HotReloadConfig  `yaml:"hot_reload" json:"hot_reload"` // 热加载配置
+	Checkpoint *AggregateCheckpointConfig `yaml:"checkpoint" json:"checkpoint"` // 聚合状态检查点配置
+	LastValues *LastValueCacheConfig `yaml:"last_values" json:"last_values"` // 跨设备最新值缓存配置
+	Timezone   string                `yaml:"timezone" json:"timezone"`       // cron定时规则的默认时区，默认本地时区
+	Pipelines  []*RulePipeline       `yaml:"pipelines" json:"pipelines"`     // 规则管道
+	MaxHops    int                   `yaml:"max_hops" json:"max_hops"`       // 数据点最多经过的规则次数，默认8
+	TemplatesDir string              `yaml:"templates_dir" json:"templates_dir"` // 规则模板目录，默认./data/rule_templates
+	HistoryDir   string              `yaml:"history_dir" json:"history_dir"`     // 规则修订历史目录，默认./data/rule_history
 }
 
 // RuleEngineService 规则引擎服务
@@ -73,6 +81,18 @@ type RuleEngineService struct {
 	// 规则索引系统
 	ruleIndex *Index
 	useRuleIndex bool
+	
+	// 聚合状态检查点
+	checkpointer *aggregateCheckpointer
+	
+	// 定时触发规则的定时器
+	scheduler *ruleScheduler
+	
+	// 数据点最多经过的规则次数
+	maxHops int
+	
+	// 规则模板
+	templates *TemplateManager
 }
 
 // GetRuleManager 获取规则管理器实例
@@ -84,6 +104,11 @@ func (s *RuleEngineService) GetRuleManager() RuleManager {
 type RuleTask struct {
 	Rule  *Rule
 	Point model.Point
+	// Reevaluate 被引用的输入变化时的重新评估，Point是缓存的触发数据点，
+	// 只评估条件并在由不满足变为满足时执行报警动作
+	Reevaluate bool
+	// Hops 数据点已经过的规则次数
+	Hops int
 }
 
 // WorkerPool 工作池
@@ -98,6 +123,7 @@ type WorkerPool struct {
 
 // AggregateState 聚合状态
 type AggregateState struct {
+	RuleID     string
 	Buffer     []model.Point
 	GroupKey   string
 	Count      int
@@ -252,6 +278,31 @@ func (wp *WorkerPool) worker(workerID int) {
 func (s *RuleEngineService) RegisterActionHandler(actionType string, handler ActionHandler) {
 	s.actionHandlers[actionType] = handler
 	log.Info().Str("type", actionType).Str("name", handler.Name()).Msg("动作处理器已注册")
+	
+	// 持有聚合状态的处理器参与检查点
+	if source, ok := handler.(AggregateStateProviderSource); ok && s.checkpointer != nil {
+		for _, provider := range source.AggregateStateProviders() {
+			s.checkpointer.Register(provider)
+		}
+	}
+	if emitter, ok := handler.(AggregateResultEmitter); ok {
+		emitter.SetAggregateResultSink(s.emitAggregateResults)
+	}
+}
+
+// emitAggregateResults 处理定时器触发的聚合结果，如会话窗口在数据停止后关闭
+func (s *RuleEngineService) emitAggregateResults(ruleID string, config map[string]interface{}, point model.Point, results []*AggregateResult) {
+	rule, err := s.manager.GetRule(ruleID)
+	if err != nil || rule == nil || !rule.Enabled {
+		log.Debug().Str("rule_id", ruleID).Int("results", len(results)).Msg("规则不存在或已禁用，丢弃窗口结果")
+		return
+	}
+	action := &Action{Type: "aggregate", Config: config}
+	for _, aggregateResult := range results {
+		if err := s.handleAggregateResult(aggregateResult, point, rule, action); err != nil {
+			log.Error().Err(err).Str("rule_id", ruleID).Msg("处理窗口结果失败")
+		}
+	}
 }
 
 // handleAggregateResult 处理聚合结果并转发
@@ -298,6 +349,17 @@ func (s *RuleEngineService) handleAggregateResult(aggregateResult *AggregateResu
 	resultPoint.AddTag("aggregated", "true")
 	resultPoint.AddTag("source_rule", rule.ID)
 	resultPoint.AddTag("window_count", fmt.Sprintf("%d", aggregateResult.Count))
+	if windowType, _, ok := strings.Cut(aggregateResult.Window, ":"); ok && windowType != "window_size" {
+		resultPoint.AddTag("window_type", windowType)
+		resultPoint.AddTag("window_start", aggregateResult.StartTime.Format(time.RFC3339Nano))
+		resultPoint.AddTag("window_end", aggregateResult.EndTime.Format(time.RFC3339Nano))
+	}
+	if aggregateResult.Late {
+		resultPoint.AddTag("late_update", "true")
+	}
+	if aggregateResult.Partial {
+		resultPoint.AddTag("partial", "true")
+	}
 
 	log.Info().
 		Str("rule_id", rule.ID).
@@ -348,9 +410,24 @@ func (s *RuleEngineService) Init(cfg any) error {
 	if s.config.Subject == "" {
 		s.config.Subject = "iot.data.>"
 	}
+	if s.config.TemplatesDir == "" {
+		s.config.TemplatesDir = "./data/rule_templates"
+	}
+	if s.config.HistoryDir == "" {
+		s.config.HistoryDir = "./data/rule_history"
+	}
 
 	// 创建规则管理器
 	s.manager = NewManager(s.config.RulesDir)
+	s.manager.SetHistoryDir(s.config.HistoryDir)
+	if err := s.manager.SetPipelines(s.config.Pipelines); err != nil {
+		return fmt.Errorf("规则管道配置无效: %w", err)
+	}
+	s.maxHops = s.config.MaxHops
+	if s.maxHops <= 0 {
+		s.maxHops = defaultMaxHops
+	}
+	s.templates = NewTemplateManager(s.config.TemplatesDir, s.manager)
 	
 	// 传递热加载配置给规则管理器
 	if s.config.HotReload != nil {
@@ -367,6 +444,21 @@ func (s *RuleEngineService) Init(cfg any) error {
 	
 	s.evaluator = NewEvaluator()
 	
+	// 配置表达式last/age/avg_over使用的最新值缓存
+	if err := globalLastValueCache.Configure(s.config.LastValues); err != nil {
+		return err
+	}
+	
+	// 定时触发规则的默认时区
+	location := time.Local
+	if s.config.Timezone != "" {
+		location, err = time.LoadLocation(s.config.Timezone)
+		if err != nil {
+			return fmt.Errorf("无效的规则引擎时区 %s: %w", s.config.Timezone, err)
+		}
+	}
+	s.scheduler = newRuleScheduler(location)
+	
 	// 如果启用了规则索引，重新构建索引
 	if s.useRuleIndex && s.ruleIndex != nil {
 		s.rebuildRuleIndex()
@@ -403,6 +495,11 @@ func (s *RuleEngineService) Start(ctx context.Context) error {
 		return fmt.Errorf("加载内联规则失败: %w", err)
 	}
 	
+	// 加载规则模板，展开的规则与模板不一致时重新生成
+	if err := s.templates.Load(); err != nil {
+		log.Error().Err(err).Msg("加载规则模板失败")
+	}
+	
 	// 构建规则索引
 	if s.useRuleIndex && s.ruleIndex != nil {
 		s.rebuildRuleIndex()
@@ -416,6 +513,11 @@ func (s *RuleEngineService) Start(ctx context.Context) error {
 		return fmt.Errorf("设置NATS连接失败: %w", err)
 	}
 
+	// 恢复聚合状态检查点，需在订阅数据之前完成
+	if err := s.setupAggregateCheckpoint(); err != nil {
+		return err
+	}
+
 	// 创建并启动工作池
 	
 	if s.useOptimizedPool {
@@ -468,6 +570,23 @@ func (s *RuleEngineService) Start(ctx context.Context) error {
 	s.wg.Add(1)
 	go s.aggregateStatesCleaner()
 
+	// 启动定时触发规则的定时器，每次检查时与当前规则同步，热加载和编辑后继续生效；
+	// 同一定时器推进报警的on_delay和off_delay
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.scheduler.Run(s.ctx, s.manager.GetEnabledRules, s.dispatchScheduledRule, s.expireAlarms)
+	}()
+
+	// 启动聚合状态检查点
+	if s.checkpointer != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.checkpointer.Run(s.ctx)
+		}()
+	}
+
 	log.Info().
 		Int("rules_count", len(s.manager.GetEnabledRules())).
 		Msg("规则引擎服务启动成功")
@@ -514,6 +633,11 @@ func (s *RuleEngineService) Stop(ctx context.Context) error {
 		log.Warn().Msg("规则引擎服务停止超时")
 	}
 
+	// 写最后一次聚合状态检查点
+	if s.checkpointer != nil {
+		s.checkpointer.Close()
+	}
+
 	// 关闭监控器
 	if s.monitor != nil {
 		s.monitor.Close()
@@ -590,9 +714,9 @@ func (s *RuleEngineService) handleDataPoint(msg *nats.Msg) {
 		Int("data_size", len(msg.Data)).
 		Msg("🎯 规则引擎收到数据点消息")
 
-	// 解析数据点
+	// 解析数据点，编码由消息的Content-Type头决定
 	var point model.Point
-	if err := json.Unmarshal(msg.Data, &point); err != nil {
+	if err := codec.DecodeMsg(msg, &point); err != nil {
 		if s.enableMetrics {
 			s.monitor.RecordError(ErrorTypeValidation, ErrorLevelError, 
 				"解析数据点失败", err.Error(), 
@@ -601,6 +725,12 @@ func (s *RuleEngineService) handleDataPoint(msg *nats.Msg) {
 		log.Error().Err(err).Str("subject", msg.Subject).Msg("解析数据点失败")
 		return
 	}
+	
+	// 经过规则次数超过上限的数据点来自转发环路，丢弃
+	hops := msgHops(msg)
+	if !s.checkHops(point, hops) {
+		return
+	}
 
 	log.Debug().
 		Str("key", point.Key).
@@ -608,6 +738,14 @@ func (s *RuleEngineService) handleDataPoint(msg *nats.Msg) {
 		Interface("value", point.Value).
 		Msg("开始处理数据点")
 
+	// 更新最新值缓存，供其他规则的last/age/avg_over引用
+	globalLastValueCache.Update(point)
+	
+	// 记录到达时间，供数据缺失检测
+	if s.scheduler != nil {
+		s.scheduler.Observe(point)
+	}
+
 	// 获取候选规则（使用索引优化）
 	var rules []*Rule
 	if s.useRuleIndex && s.ruleIndex != nil {
@@ -615,18 +753,34 @@ func (s *RuleEngineService) handleDataPoint(msg *nats.Msg) {
 		rules = s.ruleIndex.Match(point)
 		log.Debug().Int("indexed_rules", len(rules)).Msg("🔍 使用规则索引获取候选规则")
 	} else {
-		// 回退到获取所有启用的规则
-		rules = s.manager.GetEnabledRules()
+		// 回退到获取所有启用的规则，定时触发的规则除外
+		for _, rule := range s.manager.GetEnabledRules() {
+			if rule.Schedule == nil {
+				rules = append(rules, rule)
+			}
+		}
 		log.Debug().Int("all_rules", len(rules)).Msg("📝 使用所有启用规则")
 	}
 	
-	if len(rules) == 0 {
+	tasks := make([]RuleTask, 0, len(rules))
+	for _, rule := range rules {
+		// 有上游的规则只评估上游规则的输出
+		if s.manager.IsDownstream(rule.ID) {
+			continue
+		}
+		tasks = append(tasks, RuleTask{Rule: rule, Point: point, Hops: hops})
+	}
+	// 被引用的输入变化时，用规则自身触发输入的最新值重新评估
+	tasks = append(tasks, s.referencedRuleTasks(point)...)
+	
+	if len(tasks) == 0 {
 		log.Warn().Msg("⚠️ 没有匹配的规则")
 		return
 	}
 
 	log.Info().
 		Int("rules_count", len(rules)).
+		Int("tasks_count", len(tasks)).
 		Bool("use_index", s.useRuleIndex && s.ruleIndex != nil).
 		Msg("🔢 开始评估规则")
 
@@ -634,9 +788,7 @@ func (s *RuleEngineService) handleDataPoint(msg *nats.Msg) {
 	successCount := 0
 	failCount := 0
 	
-	for _, rule := range rules {
-		task := RuleTask{Rule: rule, Point: point}
-		
+	for _, task := range tasks {
 		var submitted bool
 		if s.useOptimizedPool && s.optimizedPool != nil {
 			// 使用优化工作池
@@ -650,7 +802,7 @@ func (s *RuleEngineService) handleDataPoint(msg *nats.Msg) {
 			successCount++
 		} else {
 			// 工作池满或不可用，回退到同步处理
-			s.processRule(rule, point)
+			s.processRule(task.Rule, task.Point, task.Hops)
 			failCount++
 		}
 	}
@@ -664,17 +816,146 @@ func (s *RuleEngineService) handleDataPoint(msg *nats.Msg) {
 		Msg("📋 规则任务分发完成")
 }
 
+// dispatchScheduledRule 分发定时器生成的合成数据点，按普通规则任务评估
+func (s *RuleEngineService) dispatchScheduledRule(rule *Rule, point model.Point) {
+	log.Info().
+		Str("rule_id", rule.ID).
+		Str("trigger", rule.Schedule.Type).
+		Str("device_id", point.DeviceID).
+		Str("key", point.Key).
+		Msg("⏰ 定时触发规则")
+
+	if rule.Schedule.Publish && rule.Schedule.Type != ScheduleTypeAbsence && s.bus != nil {
+		subject := fmt.Sprintf("iot.data.%s.%s", point.DeviceID, point.Key)
+		if err := s.publishPointTo(subject, point); err != nil {
+			log.Error().Err(err).Str("rule_id", rule.ID).Msg("发布定时数据点失败")
+		}
+	}
+
+	task := RuleTask{Rule: rule, Point: point}
+	var submitted bool
+	if s.useOptimizedPool && s.optimizedPool != nil {
+		submitted = s.optimizedPool.SubmitTask(task)
+	} else if s.workerPool != nil {
+		submitted = s.workerPool.SubmitTask(task)
+	}
+	if !submitted {
+		s.processRule(rule, point, 0)
+	}
+}
+
+// GetScheduleStatus 获取定时触发规则的定时器状态
+func (s *RuleEngineService) GetScheduleStatus() []ScheduleStatus {
+	if s.scheduler == nil {
+		return nil
+	}
+	return s.scheduler.Statuses()
+}
+
+// referencedRuleTasks 为表达式引用了该数据点的规则生成重新评估任务。
+// 规则条件中device_id/key的eq值决定用哪些输入的最新数据点作为评估上下文，
+// 未限定设备和key的规则已按当前数据点评估，不再重复
+func (s *RuleEngineService) referencedRuleTasks(point model.Point) []RuleTask {
+	if !s.useRuleIndex || s.ruleIndex == nil {
+		return nil
+	}
+	refs := s.ruleIndex.MatchReferences(point)
+	if len(refs) == 0 {
+		return nil
+	}
+
+	var tasks []RuleTask
+	for _, ref := range refs {
+		if len(ref.Trigger.DeviceIDs) == 0 && len(ref.Trigger.Keys) == 0 {
+			continue
+		}
+		if s.manager.IsDownstream(ref.Rule.ID) {
+			continue
+		}
+		for _, trigger := range globalLastValueCache.Points(ref.Trigger.DeviceIDs, ref.Trigger.Keys, 0) {
+			if trigger.DeviceID == point.DeviceID && trigger.Key == point.Key {
+				continue // 当前数据点已正常评估
+			}
+			tasks = append(tasks, RuleTask{Rule: ref.Rule, Point: trigger, Reevaluate: true})
+		}
+	}
+	if len(tasks) > 0 {
+		log.Debug().
+			Str("device_id", point.DeviceID).
+			Str("key", point.Key).
+			Int("tasks", len(tasks)).
+			Msg("被引用输入变化，重新评估相关规则")
+	}
+	return tasks
+}
+
 // processRuleTask 处理规则任务（由工作池调用）
 func (s *RuleEngineService) processRuleTask(task RuleTask) {
-	s.processRule(task.Rule, task.Point)
+	if task.Reevaluate {
+		s.reevaluateRule(task.Rule, task.Point)
+		return
+	}
+	s.processRule(task.Rule, task.Point, task.Hops)
 }
 
-// processRule 处理单个规则
-func (s *RuleEngineService) processRule(rule *Rule, point model.Point) {
+// reevaluationActions 重新评估时执行的动作类型。
+// 触发数据点是缓存的旧值，aggregate/forward/transform/filter会把它再处理一遍，重复计入统计或重复转发
+var reevaluationActions = map[string]bool{
+	"alert": true,
+}
+
+// reevaluateRule 被引用的输入变化后用缓存的触发数据点重新评估条件，
+// 只有条件由不满足变为满足时才执行报警动作，条件持续满足时不重复报警
+func (s *RuleEngineService) reevaluateRule(rule *Rule, point model.Point) {
+	matched, ruleMatch, err := s.evaluator.EvaluateRule(rule, point)
+	if err != nil {
+		log.Debug().Err(err).Str("rule_id", rule.ID).Msg("重新评估规则条件失败")
+		return
+	}
+	if prev := s.swapReferenceMatch(rule, point, matched); !matched || prev {
+		return
+	}
+
+	log.Debug().
+		Str("rule_id", rule.ID).
+		Str("device_id", point.DeviceID).
+		Str("key", point.Key).
+		Msg("被引用输入变化使规则条件满足，执行报警动作")
+	s.publishRuleEvent("matched", rule, point, map[string]interface{}{
+		"matched":     true,
+		"reevaluated": true,
+	})
+
+	actionCtx := ruleMatch.Context(context.Background())
+	for i := range rule.Actions {
+		action := &rule.Actions[i]
+		if !reevaluationActions[action.Type] {
+			continue
+		}
+		if _, err := s.executeAction(actionCtx, action, point, rule); err != nil {
+			log.Error().
+				Err(err).
+				Str("rule_id", rule.ID).
+				Str("action_type", action.Type).
+				Msg("执行规则动作失败")
+		}
+	}
+}
+
+// swapReferenceMatch 记录引用了其他输入的规则的评估结果，返回该触发数据点上一次的结果
+func (s *RuleEngineService) swapReferenceMatch(rule *Rule, point model.Point, matched bool) bool {
+	if !s.useRuleIndex || s.ruleIndex == nil {
+		return false
+	}
+	return s.ruleIndex.SwapMatch(rule.ID, point, matched)
+}
+
+// processRule 处理单个规则，hops是数据点已经过的规则次数
+func (s *RuleEngineService) processRule(rule *Rule, point model.Point, hops int) {
 	start := time.Now()
 	
 	// 评估条件
-	matched, err := s.evaluator.Evaluate(rule.Conditions, point)
+	matched, ruleMatch, err := s.evaluator.EvaluateRule(rule, point)
 	duration := time.Since(start)
 	
 	// 临时调试：记录规则评估详情
@@ -722,6 +1003,7 @@ func (s *RuleEngineService) processRule(rule *Rule, point model.Point) {
 			Msg("规则条件评估失败")
 		return
 	}
+	s.swapReferenceMatch(rule, point, matched)
 
 	// 发布规则评估事件
 	var errorStr *string
@@ -750,21 +1032,34 @@ func (s *RuleEngineService) processRule(rule *Rule, point model.Point) {
 		Msg("规则条件匹配，开始执行动作")
 
 	// 发布规则匹配事件
-	s.publishRuleEvent("matched", rule, point, map[string]interface{}{
+	matchedDetails := map[string]interface{}{
 		"matched": true,
 		"duration_ns": duration.Nanoseconds(),
 		"actions_count": len(rule.Actions),
-	})
+	}
+	if ruleMatch != nil {
+		if ruleMatch.Sequence != nil {
+			matchedDetails["sequence"] = ruleMatch.Sequence
+		}
+		if ruleMatch.Alarm != nil {
+			matchedDetails["alarm"] = ruleMatch.Alarm
+		}
+	}
+	s.publishRuleEvent("matched", rule, point, matchedDetails)
 
-	// 执行动作
+	// 执行动作，序列匹配的事件、报警转换和经过的规则次数通过context传给动作
+	actionCtx := withHops(ruleMatch.Context(context.Background()), hops+1, s.config.Subject)
 	executedActions := make([]map[string]interface{}, 0, len(rule.Actions))
 	totalDuration := time.Duration(0)
 	successCount := 0
 	errorCount := 0
+	downstream := s.manager.Downstream(rule.ID)
+	results := make([]*ActionResult, 0, len(rule.Actions))
 
 	for i, action := range rule.Actions {
 		actionStart := time.Now()
-		err := s.executeAction(&action, point, rule)
+		result, err := s.executeAction(actionCtx, &action, point, rule)
+		results = append(results, result)
 		actionDuration := time.Since(actionStart)
 		totalDuration += actionDuration
 		
@@ -834,10 +1129,12 @@ func (s *RuleEngineService) processRule(rule *Rule, point model.Point) {
 		"actions_success": successCount,
 		"actions_error": errorCount,
 	})
+	
+	s.feedDownstream(rule, downstream, point, hops+1, results)
 }
 
 // processRuleTaskInternal 内部规则处理方法（供优化工作池调用）
-func (s *RuleEngineService) processRuleTaskInternal(rule *Rule, point model.Point) error {
+func (s *RuleEngineService) processRuleTaskInternal(rule *Rule, point model.Point, hops int) error {
 	if !rule.Enabled {
 		return nil
 	}
@@ -845,7 +1142,7 @@ func (s *RuleEngineService) processRuleTaskInternal(rule *Rule, point model.Poin
 	startTime := time.Now()
 	
 	// 评估条件
-	matched, err := s.evaluator.Evaluate(rule.Conditions, point)
+	matched, ruleMatch, err := s.evaluator.EvaluateRule(rule, point)
 	if err != nil {
 		if s.enableMetrics {
 			s.monitor.RecordError(ErrorTypeCondition, ErrorLevelError,
@@ -889,8 +1186,13 @@ func (s *RuleEngineService) processRuleTaskInternal(rule *Rule, point model.Poin
 	// 如果条件匹配，执行动作
 	if matched {
 		// 简化的动作执行，避免循环依赖
+		actionCtx := withHops(ruleMatch.Context(context.Background()), hops+1, s.config.Subject)
+		downstream := s.manager.Downstream(rule.ID)
+		results := make([]*ActionResult, 0, len(rule.Actions))
 		for _, action := range rule.Actions {
-			if err := s.executeAction(&action, point, rule); err != nil {
+			result, err := s.executeAction(actionCtx, &action, point, rule)
+			results = append(results, result)
+			if err != nil {
 				log.Error().
 					Err(err).
 					Str("rule_id", rule.ID).
@@ -898,19 +1200,61 @@ func (s *RuleEngineService) processRuleTaskInternal(rule *Rule, point model.Poin
 					Msg("执行规则动作失败")
 			}
 		}
+		s.feedDownstream(rule, downstream, point, hops+1, results)
 	}
 	
 	return nil
 }
 
-// executeAction 执行动作
-func (s *RuleEngineService) executeAction(action *Action, point model.Point, rule *Rule) error {
+// checkHops 数据点经过的规则次数是否在上限内，超过时记录并返回false
+func (s *RuleEngineService) checkHops(point model.Point, hops int) bool {
+	if hops < s.maxHops {
+		return true
+	}
+	if s.enableMetrics && s.monitor != nil {
+		s.monitor.RecordError(ErrorTypeValidation, ErrorLevelWarning,
+			"数据点经过的规则次数超过上限", fmt.Sprintf("hops=%d, max_hops=%d", hops, s.maxHops),
+			map[string]string{"device_id": point.DeviceID, "key": point.Key})
+	}
+	log.Warn().
+		Str("device_id", point.DeviceID).
+		Str("key", point.Key).
+		Int("hops", hops).
+		Int("max_hops", s.maxHops).
+		Msg("数据点经过的规则次数超过上限，可能存在转发环路，已丢弃")
+	return false
+}
+
+// feedDownstream 把规则的输出数据点在进程内按顺序传给下游规则，hops是输出数据点经过的规则次数
+func (s *RuleEngineService) feedDownstream(rule *Rule, downstream []*Rule, point model.Point, hops int, results []*ActionResult) {
+	if len(downstream) == 0 {
+		return
+	}
+	out, ok := pipelineOutput(point, results)
+	if !ok {
+		log.Debug().Str("rule_id", rule.ID).Msg("数据点已被过滤，不再传给下游规则")
+		return
+	}
+	if !s.checkHops(out, hops) {
+		return
+	}
+	for _, next := range downstream {
+		log.Debug().
+			Str("rule_id", rule.ID).
+			Str("downstream_rule_id", next.ID).
+			Msg("规则输出传给下游规则")
+		s.processRule(next, out, hops)
+	}
+}
+
+// executeAction 执行动作，返回动作处理器的结果，内置实现没有结果
+func (s *RuleEngineService) executeAction(ctx context.Context, action *Action, point model.Point, rule *Rule) (*ActionResult, error) {
 	actionStart := time.Now()
 	
 	handler, exists := s.actionHandlers[action.Type]
 	if exists {
 		// 使用新的动作处理器
-		result, err := handler.Execute(context.Background(), point, rule, action.Config)
+		result, err := handler.Execute(withAction(ctx, action), point, rule, action.Config)
 		actionDuration := time.Since(actionStart)
 		
 		// *** 修复：记录动作执行统计 ***
@@ -919,24 +1263,17 @@ func (s *RuleEngineService) executeAction(action *Action, point model.Point, rul
 		}
 		
 		if err != nil {
-			return err
+			return result, err
 		}
 
 		// 处理聚合结果，如果需要转发
 		if action.Type == "aggregate" && result.Success {
 			if output, ok := result.Output.(map[string]interface{}); ok {
-				if aggregated, ok := output["aggregated"].(bool); ok && aggregated {
-					if aggregateResult, ok := output["aggregate_result"].(*AggregateResult); ok {
-						// 创建聚合结果数据点并转发
-						if err := s.handleAggregateResult(aggregateResult, point, rule, action); err != nil {
-							log.Error().Err(err).Msg("处理聚合结果失败")
-						}
-					}
-				}
+				s.handleAggregateOutput(output, point, rule, action)
 			}
 		}
 
-		return nil
+		return result, nil
 	}
 
 	// 回退到旧的内置实现
@@ -945,11 +1282,11 @@ func (s *RuleEngineService) executeAction(action *Action, point model.Point, rul
 	case "aggregate":
 		err = s.executeAggregateAction(action, point, rule)
 	case "transform":
-		err = s.executeTransformAction(action, point, rule)
+		err = s.executeTransformAction(ctx, action, point, rule)
 	case "filter":
 		err = s.executeFilterAction(action, point, rule)
 	case "forward":
-		err = s.executeForwardAction(action, point, rule)
+		err = s.executeForwardAction(ctx, action, point, rule)
 	case "alert":
 		err = s.executeAlertAction(action, point, rule)
 	default:
@@ -962,7 +1299,7 @@ func (s *RuleEngineService) executeAction(action *Action, point model.Point, rul
 		s.monitor.RecordActionExecution(action.Type, actionDuration, err == nil, err)
 	}
 	
-	return err
+	return nil, err
 }
 
 // executeAggregateAction 执行聚合动作 - 高性能优化版本
@@ -970,7 +1307,8 @@ func (s *RuleEngineService) executeAggregateAction(action *Action, point model.P
 	// 检查是否启用高性能聚合引擎
 	useOptimized := os.Getenv("IOT_GATEWAY_ENABLE_OPTIMIZED_AGGREGATE") == "true"
 	
-	if useOptimized {
+	// 传统缓冲区实现不支持跳跃、会话和事件时间窗口
+	if useOptimized || isWindowedAggregate(action.Config) {
 		return s.executeOptimizedAggregateAction(action, point, rule)
 	}
 	
@@ -988,10 +1326,23 @@ func (s *RuleEngineService) executeOptimizedAggregateAction(action *Action, poin
 		}
 		s.optimizedAggregateHandler = OptimizedAggregateHandlerFactory()
 		log.Info().Msg("高性能聚合引擎已启动")
+		
+		// 注册状态组件，恢复该处理器的聚合状态检查点
+		if source, ok := s.optimizedAggregateHandler.(AggregateStateProviderSource); ok && s.checkpointer != nil {
+			for _, provider := range source.AggregateStateProviders() {
+				s.checkpointer.Register(provider)
+			}
+		}
+		if emitter, ok := s.optimizedAggregateHandler.(AggregateResultEmitter); ok {
+			emitter.SetAggregateResultSink(s.emitAggregateResults)
+		}
 	}
 	
 	// 使用优化处理器处理
 	result, err := s.optimizedAggregateHandler.Execute(context.Background(), point, rule, action.Config)
+	if err != nil && isWindowedAggregate(action.Config) {
+		return err
+	}
 	if err != nil {
 		log.Error().Err(err).Msg("优化聚合处理失败，回退到传统实现")
 		return s.executeLegacyAggregateAction(action, point, rule)
@@ -1000,19 +1351,59 @@ func (s *RuleEngineService) executeOptimizedAggregateAction(action *Action, poin
 	// 处理聚合结果转发
 	if result.Success && result.Output != nil {
 		if outputMap, ok := result.Output.(map[string]interface{}); ok {
-			if aggregated, ok := outputMap["aggregated"].(bool); ok && aggregated {
-				if aggregateResultData, ok := outputMap["aggregate_result"]; ok {
-					if aggResult, ok := aggregateResultData.(map[string]interface{}); ok {
-						if err := s.handleOptimizedAggregateResult(aggResult, point, rule, action); err != nil {
-							log.Error().Err(err).Msg("处理优化聚合结果失败")
-						}
-					}
+			s.handleAggregateOutput(outputMap, point, rule, action)
+		}
+	}
+	
+	return nil
+}
+
+// isWindowedAggregate 聚合动作是否使用跳跃、会话或事件时间窗口
+func isWindowedAggregate(config map[string]interface{}) bool {
+	timeMode, _ := config["time_mode"].(string)
+	windowType, _ := config["window_type"].(string)
+	return timeMode == "event" || windowType == "hopping" || windowType == "session"
+}
+
+// handleAggregateOutput 处理聚合动作输出：单个结果、事件时间窗口的多个结果和迟到数据旁路输出
+func (s *RuleEngineService) handleAggregateOutput(output map[string]interface{}, point model.Point, rule *Rule, action *Action) {
+	if aggregated, ok := output["aggregated"].(bool); ok && aggregated {
+		switch aggregateResult := output["aggregate_result"].(type) {
+		case *AggregateResult:
+			if err := s.handleAggregateResult(aggregateResult, point, rule, action); err != nil {
+				log.Error().Err(err).Msg("处理聚合结果失败")
+			}
+		case map[string]interface{}:
+			if err := s.handleOptimizedAggregateResult(aggregateResult, point, rule, action); err != nil {
+				log.Error().Err(err).Msg("处理优化聚合结果失败")
+			}
+		}
+		
+		// 跳跃、会话和事件时间窗口一个数据点可能触发多个窗口输出
+		if results, ok := output["aggregate_results"].([]*AggregateResult); ok {
+			for _, aggregateResult := range results {
+				if err := s.handleAggregateResult(aggregateResult, point, rule, action); err != nil {
+					log.Error().Err(err).Msg("处理窗口结果失败")
 				}
 			}
 		}
 	}
 	
-	return nil
+	// 迟到数据旁路输出
+	if original, ok := output["late_point"].(model.Point); ok {
+		subject, _ := output["late_subject"].(string)
+		// 标签容器是共享指针，复制后再添加标签
+		latePoint := original
+		latePoint.SafeTags = nil
+		for k, v := range original.GetTagsCopy() {
+			latePoint.AddTag(k, v)
+		}
+		latePoint.AddTag("late", "true")
+		latePoint.AddTag("source_rule", rule.ID)
+		if err := s.publishPointTo(subject, latePoint); err != nil {
+			log.Error().Err(err).Str("rule_id", rule.ID).Str("subject", subject).Msg("迟到数据旁路输出失败")
+		}
+	}
 }
 
 // executeLegacyAggregateAction 执行传统聚合动作（保持向后兼容）
@@ -1058,7 +1449,7 @@ func (s *RuleEngineService) executeLegacyAggregateAction(action *Action, point m
 	
 	if s.useShardedAggregates {
 		// 使用分片聚合状态管理器（高性能）
-		state, windowReady = s.shardedAggregates.UpdateState(stateKey, point, windowSize)
+		state, windowReady = s.shardedAggregates.UpdateState(rule.ID, stateKey, point, windowSize)
 	} else {
 		// 使用原始聚合状态管理器（向后兼容）
 		s.aggregateMutex.Lock()
@@ -1066,6 +1457,7 @@ func (s *RuleEngineService) executeLegacyAggregateAction(action *Action, point m
 		state, exists = s.aggregateStates[stateKey]
 		if !exists {
 			state = &AggregateState{
+				RuleID:     rule.ID,
 				Buffer:     make([]model.Point, 0, windowSize),
 				GroupKey:   groupKey,
 				WindowSize: windowSize,
@@ -1236,7 +1628,7 @@ func (s *RuleEngineService) generateGroupKey(point model.Point, groupBy []interf
 		case "key":
 			keyParts = append(keyParts, point.Key)
 		case "device_id":
-			keyParts = append(keyParts, fmt.Sprintf("%d", point.DeviceID))
+			keyParts = append(keyParts, point.DeviceID)
 		case "type":
 			keyParts = append(keyParts, string(point.Type))
 		default:
@@ -1438,7 +1830,7 @@ func (s *RuleEngineService) extractNumericFromComplexType(data map[string]interf
 }
 
 // executeTransformAction 执行转换动作
-func (s *RuleEngineService) executeTransformAction(action *Action, point model.Point, rule *Rule) error {
+func (s *RuleEngineService) executeTransformAction(ctx context.Context, action *Action, point model.Point, rule *Rule) error {
 	config := action.Config
 	
 	// 简单的转换实现
@@ -1482,7 +1874,8 @@ func (s *RuleEngineService) executeTransformAction(action *Action, point model.P
 		}
 		
 		if jsonData, err := json.Marshal(publishData); err == nil {
-			if err := s.bus.Publish(subject, jsonData); err != nil {
+			msg := &nats.Msg{Subject: subject, Data: jsonData, Header: HopHeader(ctx, subject)}
+			if err := s.bus.PublishMsg(msg); err != nil {
 				log.Error().Err(err).Str("subject", subject).Msg("发布转换数据失败")
 			} else {
 				log.Debug().
@@ -1514,7 +1907,7 @@ func (s *RuleEngineService) executeFilterAction(action *Action, point model.Poin
 }
 
 // executeForwardAction 执行转发动作
-func (s *RuleEngineService) executeForwardAction(action *Action, point model.Point, rule *Rule) error {
+func (s *RuleEngineService) executeForwardAction(ctx context.Context, action *Action, point model.Point, rule *Rule) error {
 	config := action.Config
 	
 	if s.bus == nil {
@@ -1550,7 +1943,8 @@ func (s *RuleEngineService) executeForwardAction(action *Action, point model.Poi
 		return fmt.Errorf("序列化转发数据失败: %w", err)
 	}
 	
-	if err := s.bus.Publish(subject, jsonData); err != nil {
+	msg := &nats.Msg{Subject: subject, Data: jsonData, Header: HopHeader(ctx, subject)}
+	if err := s.bus.PublishMsg(msg); err != nil {
 		return fmt.Errorf("发送NATS消息失败: %w", err)
 	}
 	
@@ -1576,13 +1970,17 @@ func (s *RuleEngineService) executeAlertAction(action *Action, point model.Point
 
 // publishPoint 发布数据点到总线
 func (s *RuleEngineService) publishPoint(point model.Point) error {
-	data, err := json.Marshal(point)
+	return s.publishPointTo(fmt.Sprintf("iot.data.%s", point.Key), point)
+}
+
+// publishPointTo 发布数据点到指定主题
+func (s *RuleEngineService) publishPointTo(subject string, point model.Point) error {
+	msg, err := codec.NewMsg(subject, &point)
 	if err != nil {
 		return fmt.Errorf("序列化数据点失败: %w", err)
 	}
 
-	subject := fmt.Sprintf("iot.data.%s", point.Key)
-	if err := s.bus.Publish(subject, data); err != nil {
+	if err := s.bus.PublishMsg(msg); err != nil {
 		return fmt.Errorf("发布数据点失败: %w", err)
 	}
 
@@ -1666,8 +2064,15 @@ func (s *RuleEngineService) watchRuleChanges() {
 					s.updateRuleIndex(event.Rule, "update")
 				case "deleted":
 					s.updateRuleIndex(event.Rule, "remove")
+					s.evaluator.DropRuleState(event.Rule.ID)
 				}
 			}
+			
+			// 聚合配置变化时丢弃旧的聚合状态
+			if event.Rule != nil && s.checkpointer != nil {
+				deleted := event.Type == "delete" || event.Type == "deleted"
+				s.checkpointer.RuleChanged(event.Rule, deleted)
+			}
 		}
 	}
 }
@@ -1739,9 +2144,200 @@ func (s *RuleEngineService) GetMetrics() *EngineMetrics {
 		metrics.RulesEnabled = int64(len(enabledRules))
 	}
 	
+	// 聚合状态检查点
+	if s.checkpointer != nil {
+		stats := s.checkpointer.Stats()
+		metrics.CheckpointLag = stats.Lag
+		metrics.LastCheckpointAt = stats.LastCheckpointAt
+		metrics.CheckpointStates = stats.States
+		metrics.CheckpointErrors = stats.Errors
+	}
+	
 	return metrics
 }
 
+// ListTemplates 获取全部规则模板
+func (s *RuleEngineService) ListTemplates() ([]*RuleTemplate, error) {
+	if s.templates == nil {
+		return nil, fmt.Errorf("规则引擎未初始化")
+	}
+	return s.templates.List(), nil
+}
+
+// GetTemplate 获取规则模板
+func (s *RuleEngineService) GetTemplate(id string) (*RuleTemplate, error) {
+	if s.templates == nil {
+		return nil, fmt.Errorf("规则引擎未初始化")
+	}
+	return s.templates.Get(id)
+}
+
+// SaveTemplate 保存规则模板并重新展开实例规则
+func (s *RuleEngineService) SaveTemplate(template *RuleTemplate) error {
+	if s.templates == nil {
+		return fmt.Errorf("规则引擎未初始化")
+	}
+	return s.templates.Save(template)
+}
+
+// DeleteTemplate 删除规则模板及其展开的规则
+func (s *RuleEngineService) DeleteTemplate(id string) error {
+	if s.templates == nil {
+		return fmt.Errorf("规则引擎未初始化")
+	}
+	return s.templates.Delete(id)
+}
+
+// ExpandTemplate 获取规则模板展开的规则
+func (s *RuleEngineService) ExpandTemplate(id string) ([]*Rule, error) {
+	if s.templates == nil {
+		return nil, fmt.Errorf("规则引擎未初始化")
+	}
+	return s.templates.Expand(id)
+}
+
+// GetAlarmStates 获取规则中报警条件的当前状态
+func (s *RuleEngineService) GetAlarmStates(ruleID string) ([]AlarmStatus, error) {
+	if _, err := s.manager.GetRule(ruleID); err != nil {
+		return nil, err
+	}
+	return s.evaluator.AlarmStates(ruleID), nil
+}
+
+// expireAlarms 推进延时到期的报警，并以报警或恢复事件和该报警最后的数据点执行规则动作
+func (s *RuleEngineService) expireAlarms(now time.Time) {
+	for _, transition := range s.evaluator.ExpireAlarms(now) {
+		event := transition.Event
+		rule, err := s.manager.GetRule(event.RuleID)
+		if err != nil || rule == nil || !rule.Enabled {
+			continue
+		}
+		log.Info().
+			Str("rule_id", rule.ID).
+			Str("device_id", event.DeviceID).
+			Str("key", event.Key).
+			Str("event", event.Event).
+			Msg("报警延时到期")
+		s.executeAlarmActions(rule, event, transition.Point)
+	}
+}
+
+// executeAlarmActions 发布规则匹配事件，并以报警事件执行规则动作
+func (s *RuleEngineService) executeAlarmActions(rule *Rule, event *AlarmEvent, point model.Point) {
+	s.publishRuleEvent("matched", rule, point, map[string]interface{}{
+		"matched": true,
+		"actions_count": len(rule.Actions),
+		"alarm": event,
+	})
+	actionCtx := WithAlarmEvent(context.Background(), event)
+	for i := range rule.Actions {
+		if _, err := s.executeAction(actionCtx, &rule.Actions[i], point, rule); err != nil {
+			log.Error().
+				Err(err).
+				Str("rule_id", rule.ID).
+				Str("action_type", rule.Actions[i].Type).
+				Msg("执行报警动作失败")
+		}
+	}
+}
+
+// ResetAlarm 人工复位锁存的报警，并以恢复事件执行规则动作。
+// deviceID和key都为空时复位该规则全部锁存的报警
+func (s *RuleEngineService) ResetAlarm(ruleID, deviceID, key string) ([]AlarmEvent, error) {
+	rule, err := s.manager.GetRule(ruleID)
+	if err != nil {
+		return nil, err
+	}
+
+	type alarmTarget struct{ deviceID, key string }
+	targets := []alarmTarget{{deviceID, key}}
+	if deviceID == "" && key == "" {
+		targets = targets[:0]
+		for _, status := range s.evaluator.AlarmStates(ruleID) {
+			if status.State == AlarmStateLatched {
+				targets = append(targets, alarmTarget{status.DeviceID, status.Key})
+			}
+		}
+		if len(targets) == 0 {
+			return nil, fmt.Errorf("规则%s没有锁存的报警", ruleID)
+		}
+	}
+
+	events := make([]AlarmEvent, 0, len(targets))
+	for _, target := range targets {
+		event, point, err := s.evaluator.ResetAlarm(ruleID, target.deviceID, target.key)
+		if err != nil {
+			return events, err
+		}
+
+		s.executeAlarmActions(rule, event, point)
+
+		log.Info().
+			Str("rule_id", ruleID).
+			Str("device_id", event.DeviceID).
+			Str("key", event.Key).
+			Msg("锁存报警已人工复位")
+		events = append(events, *event)
+	}
+	return events, nil
+}
+
+// GetCheckpointStats 获取聚合状态检查点统计
+func (s *RuleEngineService) GetCheckpointStats() CheckpointStats {
+	if s.checkpointer == nil {
+		return CheckpointStats{}
+	}
+	return s.checkpointer.Stats()
+}
+
+// setupAggregateCheckpoint 创建检查点存储并恢复内置聚合动作的状态。
+// 存储不可用时记录错误并在没有检查点的情况下继续运行
+func (s *RuleEngineService) setupAggregateCheckpoint() error {
+	cfg := s.config.Checkpoint
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+
+	store, err := newCheckpointStore(cfg, s.js)
+	if err != nil {
+		log.Error().Err(err).Str("backend", cfg.Backend).Msg("创建聚合状态检查点存储失败，聚合状态将不会持久化")
+		return nil
+	}
+	checkpointer, err := newAggregateCheckpointer(cfg, store, s.aggregateFingerprints, s.manager.GetRule)
+	if err != nil {
+		store.Close()
+		return fmt.Errorf("聚合状态检查点配置错误: %w", err)
+	}
+	if err := checkpointer.Restore(); err != nil {
+		log.Error().Err(err).Msg("恢复聚合状态失败，从空状态开始")
+	}
+	checkpointer.Register(bufferAggregateProvider{s: s})
+	for _, handler := range s.actionHandlers {
+		if source, ok := handler.(AggregateStateProviderSource); ok {
+			for _, provider := range source.AggregateStateProviders() {
+				checkpointer.Register(provider)
+			}
+		}
+	}
+	s.checkpointer = checkpointer
+
+	log.Info().
+		Str("backend", cfg.Backend).
+		Dur("interval", checkpointer.interval).
+		Msg("聚合状态检查点已启用")
+	return nil
+}
+
+// aggregateFingerprints 返回全部规则的聚合配置指纹
+func (s *RuleEngineService) aggregateFingerprints() map[string]string {
+	rules := s.manager.ListRules()
+	fingerprints := make(map[string]string, len(rules))
+	for _, rule := range rules {
+		fingerprints[rule.ID] = aggregateFingerprint(rule)
+	}
+	return fingerprints
+}
+
 // GetHealthStatus 获取健康状态
 func (s *RuleEngineService) GetHealthStatus() HealthStatus {
 	if s.monitor == nil {
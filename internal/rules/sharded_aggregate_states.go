@@ -91,7 +91,7 @@ func (s *ShardedAggregateStates) GetOrCreateState(stateKey string, windowSize in
 }
 
 // UpdateState 更新聚合状态（线程安全）
-func (s *ShardedAggregateStates) UpdateState(stateKey string, point model.Point, windowSize int) (*AggregateState, bool) {
+func (s *ShardedAggregateStates) UpdateState(ruleID, stateKey string, point model.Point, windowSize int) (*AggregateState, bool) {
 	shard := s.getShard(stateKey)
 	
 	shard.mu.Lock()
@@ -101,6 +101,7 @@ func (s *ShardedAggregateStates) UpdateState(stateKey string, point model.Point,
 	state, exists := shard.states[stateKey]
 	if !exists {
 		state = &AggregateState{
+			RuleID:     ruleID,
 			Buffer:     make([]model.Point, 0, windowSize),
 			WindowSize: windowSize,
 			LastUpdate: time.Now(),
@@ -289,4 +290,54 @@ func (s *ShardedAggregateStates) ListAllStates() []string {
 	
 	wg.Wait()
 	return allKeys
-}
\ No newline at end of file
+}
+
+// SnapshotStates 复制全部非空状态，用于写检查点
+func (s *ShardedAggregateStates) SnapshotStates() map[string]AggregateState {
+	out := make(map[string]AggregateState)
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.RLock()
+		for key, state := range shard.states {
+			if len(state.Buffer) == 0 {
+				continue
+			}
+			snapshot := *state
+			snapshot.Buffer = append([]model.Point(nil), state.Buffer...)
+			out[key] = snapshot
+		}
+		shard.mu.RUnlock()
+	}
+	return out
+}
+
+// RestoreState 恢复状态，已存在的状态不被覆盖
+func (s *ShardedAggregateStates) RestoreState(stateKey string, state *AggregateState) bool {
+	shard := s.getShard(stateKey)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if _, exists := shard.states[stateKey]; exists {
+		return false
+	}
+	shard.states[stateKey] = state
+	return true
+}
+
+// DropRuleStates 删除规则的全部状态，返回删除的数量
+func (s *ShardedAggregateStates) DropRuleStates(ruleID string) int {
+	dropped := 0
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		for key, state := range shard.states {
+			if state.RuleID == ruleID {
+				delete(shard.states, key)
+				dropped++
+			}
+		}
+		shard.mu.Unlock()
+	}
+	return dropped
+}
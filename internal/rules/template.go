@@ -0,0 +1,733 @@
+package rules
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// 模板参数类型
+const (
+	TemplateParamNumber   = "number"
+	TemplateParamInteger  = "integer"
+	TemplateParamString   = "string"
+	TemplateParamBool     = "bool"
+	TemplateParamDuration = "duration"
+)
+
+// RuleTemplate 规则模板，按实例绑定的设备展开为普通规则
+type RuleTemplate struct {
+	ID          string                        `json:"id" yaml:"id"`
+	Name        string                        `json:"name" yaml:"name"`
+	Description string                        `json:"description,omitempty" yaml:"description,omitempty"`
+	Parameters  map[string]*TemplateParameter `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	Rule        map[string]interface{}        `json:"rule" yaml:"rule"` // 规则主体，字符串中的${参数名}会被替换
+	Instances   []*TemplateInstance           `json:"instances" yaml:"instances"`
+	Version     int                           `json:"version" yaml:"version"`
+	CreatedAt   time.Time                     `json:"created_at" yaml:"created_at"`
+	UpdatedAt   time.Time                     `json:"updated_at" yaml:"updated_at"`
+}
+
+// TemplateParameter 模板参数定义
+type TemplateParameter struct {
+	Type        string        `json:"type" yaml:"type"`                                   // number、integer、string、bool或duration
+	Default     interface{}   `json:"default,omitempty" yaml:"default,omitempty"`         // 默认值，未设置时实例必须提供
+	Min         *float64      `json:"min,omitempty" yaml:"min,omitempty"`                 // 数值下限，duration按秒
+	Max         *float64      `json:"max,omitempty" yaml:"max,omitempty"`                 // 数值上限，duration按秒
+	Options     []interface{} `json:"options,omitempty" yaml:"options,omitempty"`         // 可选值
+	Description string        `json:"description,omitempty" yaml:"description,omitempty"` // 参数说明
+}
+
+// TemplateInstance 模板实例，绑定一组设备和参数值，每个实例展开为一个规则
+type TemplateInstance struct {
+	ID         string                            `json:"id" yaml:"id"`
+	Devices    []string                          `json:"devices,omitempty" yaml:"devices,omitempty"`         // 设备ID列表
+	DeviceGlob string                            `json:"device_glob,omitempty" yaml:"device_glob,omitempty"` // 设备ID通配模式，支持*和?
+	Tags       map[string]string                 `json:"tags,omitempty" yaml:"tags,omitempty"`               // 按数据点标签选择
+	Parameters map[string]interface{}            `json:"parameters,omitempty" yaml:"parameters,omitempty"`   // 实例参数，覆盖默认值
+	Overrides  map[string]map[string]interface{} `json:"overrides,omitempty" yaml:"overrides,omitempty"`     // 设备ID -> 参数，为这些设备单独展开规则
+	Enabled    *bool                             `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+}
+
+// RuleTemplateRef 由模板展开的规则记录来源
+type RuleTemplateRef struct {
+	TemplateID string `json:"template_id" yaml:"template_id"`
+	InstanceID string `json:"instance_id" yaml:"instance_id"`
+	DeviceID   string `json:"device_id,omitempty" yaml:"device_id,omitempty"` // 单独覆盖参数的设备
+}
+
+// RuleTemplateStore 规则模板的管理接口，由规则引擎服务实现
+type RuleTemplateStore interface {
+	ListTemplates() ([]*RuleTemplate, error)
+	GetTemplate(id string) (*RuleTemplate, error)
+	SaveTemplate(template *RuleTemplate) error
+	DeleteTemplate(id string) error
+	ExpandTemplate(id string) ([]*Rule, error)
+}
+
+var (
+	templatePlaceholder = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+	templateIDChars     = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+)
+
+// TemplateManager 管理规则模板，模板变化时通过RuleManager保存或删除展开的规则，
+// 规则文件随之更新，运行中的引擎经由正常的规则变更流程生效
+type TemplateManager struct {
+	dir       string
+	manager   RuleManager
+	templates map[string]*RuleTemplate
+	mu        sync.RWMutex
+}
+
+// NewTemplateManager 创建模板管理器
+func NewTemplateManager(dir string, manager RuleManager) *TemplateManager {
+	return &TemplateManager{
+		dir:       dir,
+		manager:   manager,
+		templates: make(map[string]*RuleTemplate),
+	}
+}
+
+// Load 加载模板目录中的模板并同步展开的规则
+func (tm *TemplateManager) Load() error {
+	if err := os.MkdirAll(tm.dir, 0755); err != nil {
+		return fmt.Errorf("创建模板目录失败: %w", err)
+	}
+	files, err := ioutil.ReadDir(tm.dir)
+	if err != nil {
+		return fmt.Errorf("读取模板目录失败: %w", err)
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	loaded := make(map[string]string) // 模板ID -> 文件
+	for _, file := range files {
+		ext := filepath.Ext(file.Name())
+		if file.IsDir() || (ext != ".json" && ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		path := filepath.Join(tm.dir, file.Name())
+		template, err := loadTemplateFile(path)
+		if err != nil {
+			log.Error().Err(err).Str("file", path).Msg("加载规则模板失败")
+			continue
+		}
+		if first, ok := loaded[template.ID]; ok {
+			log.Error().
+				Str("template_id", template.ID).
+				Str("file", path).
+				Str("loaded_file", first).
+				Msg("模板ID重复，忽略该文件")
+			continue
+		}
+		loaded[template.ID] = path
+		if err := tm.apply(template); err != nil {
+			log.Error().Err(err).Str("template_id", template.ID).Msg("同步模板规则失败")
+			continue
+		}
+		tm.templates[template.ID] = template
+	}
+
+	log.Info().Int("count", len(tm.templates)).Str("dir", tm.dir).Msg("规则模板加载完成")
+	return nil
+}
+
+// loadTemplateFile 读取单个模板文件
+func loadTemplateFile(path string) (*RuleTemplate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件失败: %w", err)
+	}
+	var template RuleTemplate
+	if filepath.Ext(path) == ".json" {
+		err = json.Unmarshal(data, &template)
+	} else {
+		err = yaml.Unmarshal(data, &template)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析模板失败: %w", err)
+	}
+	if template.Version == 0 {
+		template.Version = 1
+	}
+	return &template, nil
+}
+
+// List 获取全部模板，按ID排序
+func (tm *TemplateManager) List() []*RuleTemplate {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	templates := make([]*RuleTemplate, 0, len(tm.templates))
+	for _, template := range tm.templates {
+		templates = append(templates, template)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].ID < templates[j].ID })
+	return templates
+}
+
+// Get 获取模板
+func (tm *TemplateManager) Get(id string) (*RuleTemplate, error) {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	template, ok := tm.templates[id]
+	if !ok {
+		return nil, fmt.Errorf("规则模板不存在: %s", id)
+	}
+	return template, nil
+}
+
+// Save 保存模板，重新展开全部实例并同步规则
+func (tm *TemplateManager) Save(template *RuleTemplate) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := tm.templates[template.ID]; ok {
+		template.Version = existing.Version + 1
+		template.CreatedAt = existing.CreatedAt
+	} else {
+		template.Version = 1
+		template.CreatedAt = now
+	}
+	template.UpdatedAt = now
+
+	if err := tm.apply(template); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(template, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化模板失败: %w", err)
+	}
+	if err := os.MkdirAll(tm.dir, 0755); err != nil {
+		return fmt.Errorf("创建模板目录失败: %w", err)
+	}
+	if err := ioutil.WriteFile(tm.templatePath(template.ID), data, 0644); err != nil {
+		return fmt.Errorf("保存模板文件失败: %w", err)
+	}
+	// 模板以JSON保存，删除同ID的YAML文件，避免重新加载时读到旧内容
+	for _, ext := range []string{".yaml", ".yml"} {
+		path := filepath.Join(tm.dir, template.ID+ext)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Error().Err(err).Str("file", path).Msg("删除旧模板文件失败")
+		}
+	}
+	tm.templates[template.ID] = template
+
+	log.Info().
+		Str("template_id", template.ID).
+		Int("version", template.Version).
+		Int("instances", len(template.Instances)).
+		Msg("规则模板保存成功")
+	return nil
+}
+
+// Delete 删除模板及其展开的规则
+func (tm *TemplateManager) Delete(id string) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if _, ok := tm.templates[id]; !ok {
+		return fmt.Errorf("规则模板不存在: %s", id)
+	}
+	change := RuleChange{Author: "template", Note: fmt.Sprintf("删除模板%s", id)}
+	for _, rule := range tm.derivedRules(id) {
+		if err := tm.manager.DeleteRuleWithChange(rule.ID, change); err != nil {
+			return fmt.Errorf("删除模板规则%s失败: %w", rule.ID, err)
+		}
+	}
+	for _, ext := range []string{".json", ".yaml", ".yml"} {
+		path := filepath.Join(tm.dir, id+ext)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Error().Err(err).Str("file", path).Msg("删除模板文件失败")
+		}
+	}
+	delete(tm.templates, id)
+
+	log.Info().Str("template_id", id).Msg("规则模板删除成功")
+	return nil
+}
+
+// Expand 获取模板当前展开的规则
+func (tm *TemplateManager) Expand(id string) ([]*Rule, error) {
+	template, err := tm.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return expandTemplate(template)
+}
+
+// templatePath 模板文件路径
+func (tm *TemplateManager) templatePath(id string) string {
+	return filepath.Join(tm.dir, id+".json")
+}
+
+// apply 展开模板并同步规则：内容变化的规则经SaveRule保存，不再属于模板的规则被删除。
+// 所有展开的规则先通过验证，避免模板错误时只更新了一部分实例
+func (tm *TemplateManager) apply(template *RuleTemplate) error {
+	rules, err := expandTemplate(template)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if existing, err := tm.manager.GetRule(rule.ID); err == nil {
+			if existing.Template == nil || existing.Template.TemplateID != template.ID {
+				return fmt.Errorf("规则ID%s已被其他规则使用", rule.ID)
+			}
+		}
+		if err := tm.manager.ValidateRule(rule); err != nil {
+			return fmt.Errorf("模板展开的规则%s无效: %w", rule.ID, err)
+		}
+	}
+
+	existing := make(map[string]*Rule)
+	for _, rule := range tm.derivedRules(template.ID) {
+		existing[rule.ID] = rule
+	}
+
+	change := RuleChange{Author: "template", Note: fmt.Sprintf("模板%s版本%d", template.ID, template.Version)}
+	saved := 0
+	for _, rule := range rules {
+		if old, ok := existing[rule.ID]; ok {
+			delete(existing, rule.ID)
+			if sameRuleContent(old, rule) {
+				continue
+			}
+		}
+		if err := tm.manager.SaveRuleWithChange(rule, change); err != nil {
+			return fmt.Errorf("保存模板规则%s失败: %w", rule.ID, err)
+		}
+		saved++
+	}
+	for id := range existing {
+		if err := tm.manager.DeleteRuleWithChange(id, change); err != nil {
+			return fmt.Errorf("删除模板规则%s失败: %w", id, err)
+		}
+	}
+
+	log.Info().
+		Str("template_id", template.ID).
+		Int("rules", len(rules)).
+		Int("saved", saved).
+		Int("removed", len(existing)).
+		Msg("模板规则同步完成")
+	return nil
+}
+
+// derivedRules 由模板展开的现有规则
+func (tm *TemplateManager) derivedRules(templateID string) []*Rule {
+	var rules []*Rule
+	for _, rule := range tm.manager.ListRules() {
+		if rule.Template != nil && rule.Template.TemplateID == templateID {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// sameRuleContent 比较规则内容，忽略版本和时间
+func sameRuleContent(a, b *Rule) bool {
+	normalize := func(rule *Rule) []byte {
+		copied := *rule
+		copied.Version = 0
+		copied.CreatedAt = time.Time{}
+		copied.UpdatedAt = time.Time{}
+		data, _ := json.Marshal(&copied)
+		return data
+	}
+	return string(normalize(a)) == string(normalize(b))
+}
+
+// validateTemplate 验证模板定义
+func validateTemplate(template *RuleTemplate) error {
+	if template.ID == "" {
+		return fmt.Errorf("模板ID不能为空")
+	}
+	if templateIDChars.MatchString(template.ID) {
+		return fmt.Errorf("模板ID只能包含字母、数字、_、.和-: %s", template.ID)
+	}
+	if len(template.Rule) == 0 {
+		return fmt.Errorf("模板必须定义rule")
+	}
+	for name, param := range template.Parameters {
+		if param == nil {
+			return fmt.Errorf("参数%s定义不能为空", name)
+		}
+		switch param.Type {
+		case TemplateParamNumber, TemplateParamInteger, TemplateParamString, TemplateParamBool, TemplateParamDuration:
+		default:
+			return fmt.Errorf("参数%s的类型不支持: %s", name, param.Type)
+		}
+		if param.Default != nil {
+			if _, err := param.coerce(param.Default); err != nil {
+				return fmt.Errorf("参数%s的默认值无效: %w", name, err)
+			}
+		}
+	}
+
+	ids := make(map[string]bool, len(template.Instances))
+	for i, instance := range template.Instances {
+		if instance == nil || instance.ID == "" {
+			return fmt.Errorf("实例[%d]的ID不能为空", i)
+		}
+		if templateIDChars.MatchString(instance.ID) {
+			return fmt.Errorf("实例ID只能包含字母、数字、_、.和-: %s", instance.ID)
+		}
+		if ids[instance.ID] {
+			return fmt.Errorf("实例ID重复: %s", instance.ID)
+		}
+		ids[instance.ID] = true
+	}
+	return nil
+}
+
+// coerce 按参数类型转换并检查取值
+func (p *TemplateParameter) coerce(value interface{}) (interface{}, error) {
+	var result interface{}
+	var number float64
+	ranged := false
+
+	switch p.Type {
+	case TemplateParamNumber, TemplateParamInteger:
+		f, ok := toFloat64(value)
+		if !ok {
+			return nil, fmt.Errorf("%v不是数值", value)
+		}
+		number, ranged = f, true
+		result = f
+		if p.Type == TemplateParamInteger {
+			if f != math.Trunc(f) {
+				return nil, fmt.Errorf("%v不是整数", value)
+			}
+			result = int64(f)
+		}
+	case TemplateParamString:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v不是字符串", value)
+		}
+		result = s
+	case TemplateParamBool:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%v不是布尔值", value)
+		}
+		result = b
+	case TemplateParamDuration:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v不是时长字符串", value)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("无效的时长: %s", s)
+		}
+		number, ranged = d.Seconds(), true
+		result = s
+	default:
+		return nil, fmt.Errorf("不支持的参数类型: %s", p.Type)
+	}
+
+	if ranged {
+		if p.Min != nil && number < *p.Min {
+			return nil, fmt.Errorf("%v小于下限%v", value, *p.Min)
+		}
+		if p.Max != nil && number > *p.Max {
+			return nil, fmt.Errorf("%v大于上限%v", value, *p.Max)
+		}
+	}
+	if len(p.Options) > 0 {
+		matched := false
+		for _, option := range p.Options {
+			if fmt.Sprintf("%v", option) == fmt.Sprintf("%v", result) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("%v不在可选值%v中", value, p.Options)
+		}
+	}
+	return result, nil
+}
+
+// resolveParameters 合并默认值和各层参数，并按类型检查
+func (template *RuleTemplate) resolveParameters(layers ...map[string]interface{}) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(template.Parameters))
+	for _, layer := range layers {
+		for name := range layer {
+			if _, ok := template.Parameters[name]; !ok {
+				return nil, fmt.Errorf("未定义的参数: %s", name)
+			}
+		}
+	}
+	for name, param := range template.Parameters {
+		raw := param.Default
+		for _, layer := range layers {
+			if value, ok := layer[name]; ok {
+				raw = value
+			}
+		}
+		if raw == nil {
+			return nil, fmt.Errorf("缺少参数: %s", name)
+		}
+		value, err := param.coerce(raw)
+		if err != nil {
+			return nil, fmt.Errorf("参数%s: %w", name, err)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// expandTemplate 把模板的每个实例展开为规则。实例中单独覆盖参数的设备各自展开为一个规则，
+// 并从实例的设备范围中排除
+func expandTemplate(template *RuleTemplate) ([]*Rule, error) {
+	if err := validateTemplate(template); err != nil {
+		return nil, err
+	}
+
+	var rules []*Rule
+	for _, instance := range template.Instances {
+		overridden := make([]string, 0, len(instance.Overrides))
+		for deviceID := range instance.Overrides {
+			overridden = append(overridden, deviceID)
+		}
+		sort.Strings(overridden)
+
+		values, err := template.resolveParameters(instance.Parameters)
+		if err != nil {
+			return nil, fmt.Errorf("实例%s: %w", instance.ID, err)
+		}
+		scope := instanceScope(instance, overridden)
+		rule, err := template.buildRule(instance, "", values, scope)
+		if err != nil {
+			return nil, fmt.Errorf("实例%s: %w", instance.ID, err)
+		}
+		rules = append(rules, rule)
+
+		for _, deviceID := range overridden {
+			values, err := template.resolveParameters(instance.Parameters, instance.Overrides[deviceID])
+			if err != nil {
+				return nil, fmt.Errorf("实例%s设备%s: %w", instance.ID, deviceID, err)
+			}
+			scope := []*Condition{{Field: "device_id", Operator: "eq", Value: deviceID}}
+			for _, key := range sortedKeys(instance.Tags) {
+				scope = append(scope, &Condition{Field: "tags." + key, Operator: "eq", Value: instance.Tags[key]})
+			}
+			rule, err := template.buildRule(instance, deviceID, values, scope)
+			if err != nil {
+				return nil, fmt.Errorf("实例%s设备%s: %w", instance.ID, deviceID, err)
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	// 实例ID与设备ID拼接后可能相同，重复的规则ID会互相覆盖
+	seen := make(map[string]*RuleTemplateRef, len(rules))
+	for _, rule := range rules {
+		if prev, ok := seen[rule.ID]; ok {
+			return nil, fmt.Errorf("实例%s设备%s与实例%s设备%s展开的规则ID %s 重复",
+				prev.InstanceID, prev.DeviceID, rule.Template.InstanceID, rule.Template.DeviceID, rule.ID)
+		}
+		seen[rule.ID] = rule.Template
+	}
+	return rules, nil
+}
+
+// instanceScope 实例选择设备的条件，排除单独覆盖参数的设备
+func instanceScope(instance *TemplateInstance, excluded []string) []*Condition {
+	var scope []*Condition
+	if len(instance.Devices) > 0 {
+		scope = append(scope, anyDevice(instance.Devices))
+	}
+	if instance.DeviceGlob != "" {
+		scope = append(scope, &Condition{Field: "device_id", Operator: "regex", Value: globToRegex(instance.DeviceGlob)})
+	}
+	for _, key := range sortedKeys(instance.Tags) {
+		scope = append(scope, &Condition{Field: "tags." + key, Operator: "eq", Value: instance.Tags[key]})
+	}
+	if len(excluded) > 0 {
+		scope = append(scope, &Condition{Not: anyDevice(excluded)})
+	}
+	return scope
+}
+
+// anyDevice 匹配任一设备ID的条件，设备ID的eq条件可被规则索引使用
+func anyDevice(deviceIDs []string) *Condition {
+	if len(deviceIDs) == 1 {
+		return &Condition{Field: "device_id", Operator: "eq", Value: deviceIDs[0]}
+	}
+	or := make([]*Condition, 0, len(deviceIDs))
+	for _, deviceID := range deviceIDs {
+		or = append(or, &Condition{Field: "device_id", Operator: "eq", Value: deviceID})
+	}
+	return &Condition{Or: or}
+}
+
+// globToRegex 把设备通配模式转换为正则表达式
+func globToRegex(glob string) string {
+	pattern := regexp.QuoteMeta(glob)
+	pattern = strings.ReplaceAll(pattern, `\*`, ".*")
+	pattern = strings.ReplaceAll(pattern, `\?`, ".")
+	return "^" + pattern + "$"
+}
+
+// buildRule 替换参数生成规则，设备范围条件与模板条件组合
+func (template *RuleTemplate) buildRule(instance *TemplateInstance, deviceID string, values map[string]interface{}, scope []*Condition) (*Rule, error) {
+	builtin := map[string]interface{}{
+		"template_id": template.ID,
+		"instance_id": instance.ID,
+		"device_id":   deviceID,
+	}
+	body, err := substituteTemplate(template.Rule, values, builtin)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("序列化规则失败: %w", err)
+	}
+	var rule Rule
+	if err := json.Unmarshal(data, &rule); err != nil {
+		return nil, fmt.Errorf("解析展开的规则失败: %w", err)
+	}
+
+	rule.ID = "tpl_" + template.ID + "_" + instance.ID
+	if deviceID != "" {
+		rule.ID += "_" + templateDeviceSuffix(deviceID)
+	}
+	if rule.Name == "" {
+		rule.Name = template.Name + " - " + instance.ID
+		if deviceID != "" {
+			rule.Name += " - " + deviceID
+		}
+	}
+	if _, ok := body["enabled"]; !ok {
+		rule.Enabled = true
+	}
+	if instance.Enabled != nil {
+		rule.Enabled = *instance.Enabled
+	}
+	if rule.Tags == nil {
+		rule.Tags = make(map[string]string)
+	}
+	rule.Tags["template"] = template.ID
+	rule.Tags["template_instance"] = instance.ID
+	rule.Template = &RuleTemplateRef{TemplateID: template.ID, InstanceID: instance.ID, DeviceID: deviceID}
+
+	// 设备范围放在前面，报警、序列等有状态条件只看到范围内的数据
+	if len(scope) > 0 {
+		conditions := append([]*Condition{}, scope...)
+		if rule.Conditions != nil {
+			conditions = append(conditions, rule.Conditions)
+		}
+		if len(conditions) == 1 {
+			rule.Conditions = conditions[0]
+		} else {
+			rule.Conditions = &Condition{And: conditions}
+		}
+	}
+	return &rule, nil
+}
+
+// templateDeviceSuffix 覆盖设备规则ID的后缀。设备ID含有不能用于规则ID的字符时替换为_，
+// 并加上原设备ID的短哈希，避免a/b和a:b得到相同的规则ID
+func templateDeviceSuffix(deviceID string) string {
+	sanitized := templateIDChars.ReplaceAllString(deviceID, "_")
+	if sanitized == deviceID {
+		return deviceID
+	}
+	sum := sha256.Sum256([]byte(deviceID))
+	return sanitized + "_" + hex.EncodeToString(sum[:4])
+}
+
+// substituteTemplate 递归替换${参数名}：整个字符串是一个占位符时保留参数类型，否则按文本替换
+func substituteTemplate(value interface{}, values, builtin map[string]interface{}) (map[string]interface{}, error) {
+	result, err := substituteValue(value, values, builtin)
+	if err != nil {
+		return nil, err
+	}
+	body, ok := result.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("模板rule必须是对象")
+	}
+	return body, nil
+}
+
+func substituteValue(value interface{}, values, builtin map[string]interface{}) (interface{}, error) {
+	lookup := func(name string) (interface{}, error) {
+		if v, ok := values[name]; ok {
+			return v, nil
+		}
+		if v, ok := builtin[name]; ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("未定义的参数: ${%s}", name)
+	}
+
+	switch v := value.(type) {
+	case string:
+		if m := templatePlaceholder.FindStringSubmatch(v); m != nil && m[0] == v {
+			return lookup(m[1])
+		}
+		var lookupErr error
+		replaced := templatePlaceholder.ReplaceAllStringFunc(v, func(match string) string {
+			param, err := lookup(match[2 : len(match)-1])
+			if err != nil {
+				lookupErr = err
+				return match
+			}
+			return fmt.Sprintf("%v", param)
+		})
+		return replaced, lookupErr
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			replaced, err := substituteValue(item, values, builtin)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = replaced
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			replaced, err := substituteValue(item, values, builtin)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = replaced
+		}
+		return out, nil
+	default:
+		return value, nil
+	}
+}
+
+// sortedKeys 按键排序，保证展开结果稳定
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
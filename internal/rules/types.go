@@ -50,8 +50,11 @@ type Rule struct {
 	Version     int                  `json:"version" yaml:"version"`
 	DataType    interface{}          `json:"data_type,omitempty" yaml:"data_type,omitempty"` // 数据类型：字符串或详细定义
 	Conditions  *Condition           `json:"conditions" yaml:"conditions"`
+	Schedule    *RuleSchedule        `json:"schedule,omitempty" yaml:"schedule,omitempty"` // 定时触发，设置后不再由数据点触发
+	After       []string             `json:"after,omitempty" yaml:"after,omitempty"`       // 上游规则ID，设置后只评估上游规则的输出数据点
 	Actions     []Action             `json:"actions" yaml:"actions"`
 	Tags        map[string]string    `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Template    *RuleTemplateRef     `json:"template,omitempty" yaml:"template,omitempty"` // 由模板展开时记录来源，模板变化时规则会被重新生成
 	CreatedAt   time.Time            `json:"created_at" yaml:"created_at"`
 	UpdatedAt   time.Time            `json:"updated_at" yaml:"updated_at"`
 }
@@ -86,7 +89,7 @@ func (r *Rule) GetDataTypeName() string {
 
 // Condition 条件定义
 type Condition struct {
-	Type       string       `json:"type,omitempty" yaml:"type,omitempty"`             // "simple", "expression", "lua"
+	Type       string       `json:"type,omitempty" yaml:"type,omitempty"`             // "simple", "expression", "lua", "sequence", "alarm"
 	Field      string       `json:"field,omitempty" yaml:"field,omitempty"`           // 字段名
 	Operator   string       `json:"operator,omitempty" yaml:"operator,omitempty"`     // 操作符
 	Value      interface{}  `json:"value,omitempty" yaml:"value,omitempty"`           // 比较值
@@ -95,6 +98,10 @@ type Condition struct {
 	And        []*Condition `json:"and,omitempty" yaml:"and,omitempty"`               // AND条件
 	Or         []*Condition `json:"or,omitempty" yaml:"or,omitempty"`                 // OR条件
 	Not        *Condition   `json:"not,omitempty" yaml:"not,omitempty"`               // NOT条件
+	Sequence   *SequenceCondition `json:"sequence,omitempty" yaml:"sequence,omitempty"` // 事件序列条件
+	Alarm      *AlarmCondition    `json:"alarm,omitempty" yaml:"alarm,omitempty"`       // 有状态报警条件
+
+	compiled *CompiledExpression // 验证规则时编译的expression
 }
 
 // Action 动作定义
@@ -104,6 +111,45 @@ type Action struct {
 	Async   bool                   `json:"async,omitempty" yaml:"async,omitempty"`
 	Timeout time.Duration          `json:"timeout,omitempty" yaml:"timeout,omitempty"`
 	Retry   int                    `json:"retry,omitempty" yaml:"retry,omitempty"`
+
+	compiled map[string]*CompiledExpression // 验证配置时编译的表达式，按源码索引，复制的Action共享
+}
+
+// SetCompiledExpressions 保存动作配置验证时编译的表达式，替换之前保存的全部表达式
+func (a *Action) SetCompiledExpressions(compiled ...*CompiledExpression) {
+	if len(compiled) == 0 {
+		a.compiled = nil
+		return
+	}
+	m := make(map[string]*CompiledExpression, len(compiled))
+	for _, c := range compiled {
+		m[c.Source()] = c
+	}
+	a.compiled = m
+}
+
+// CompiledExpression 获取验证时编译的表达式，未编译时返回nil
+func (a *Action) CompiledExpression(source string) *CompiledExpression {
+	if a == nil {
+		return nil
+	}
+	return a.compiled[source]
+}
+
+type actionKey struct{}
+
+// withAction 把正在执行的动作放入context
+func withAction(ctx context.Context, action *Action) context.Context {
+	return context.WithValue(ctx, actionKey{}, action)
+}
+
+// ActionFromContext 获取正在执行的动作，动作处理器据此取得验证时编译的表达式
+func ActionFromContext(ctx context.Context) *Action {
+	if ctx == nil {
+		return nil
+	}
+	action, _ := ctx.Value(actionKey{}).(*Action)
+	return action
 }
 
 // ProcessedPoint 处理后的数据点
@@ -138,6 +184,8 @@ type Alert struct {
 	Tags      map[string]string `json:"tags,omitempty"`
 	Timestamp time.Time         `json:"timestamp"`
 	Throttle  time.Duration     `json:"throttle,omitempty"`
+	Sequence  *SequenceMatch    `json:"sequence,omitempty"` // 序列规则匹配到的事件
+	Alarm     *AlarmEvent       `json:"alarm,omitempty"`    // 报警条件的产生或恢复事件
 }
 
 // AggregateResult 聚合结果
@@ -151,6 +199,16 @@ type AggregateResult struct {
 	EndTime   time.Time              `json:"end_time"`
 	Count     int64                  `json:"count"`
 	Timestamp time.Time              `json:"timestamp"`
+	Late      bool                   `json:"late,omitempty"`    // 迟到数据触发的更新结果
+	Partial   bool                   `json:"partial,omitempty"` // 窗口关闭前提前输出的中间结果
+}
+
+// AggregateResultSink 接收聚合处理器在数据点之外触发的结果，如处理时间窗口到期关闭
+type AggregateResultSink func(ruleID string, config map[string]interface{}, point model.Point, results []*AggregateResult)
+
+// AggregateResultEmitter 能够异步输出聚合结果的动作处理器
+type AggregateResultEmitter interface {
+	SetAggregateResultSink(sink AggregateResultSink)
 }
 
 // ActionHandler 动作处理器接口
@@ -199,6 +257,10 @@ type EngineMetrics struct {
 	ActionsFailed      int64         `json:"actions_failed"`
 	ProcessingDuration time.Duration `json:"processing_duration"`
 	LastProcessedAt    time.Time     `json:"last_processed_at"`
+	CheckpointLag      time.Duration `json:"checkpoint_lag"`      // 距上次成功写入聚合状态检查点的时间
+	LastCheckpointAt   time.Time     `json:"last_checkpoint_at"`
+	CheckpointStates   int64         `json:"checkpoint_states"`
+	CheckpointErrors   int64         `json:"checkpoint_errors"`
 }
 
 // CircularBuffer 环形缓冲区（用于时间窗口数据）
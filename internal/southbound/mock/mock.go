@@ -7,6 +7,7 @@ import (
 	"math"
 	"math/rand"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -31,6 +32,10 @@ type MockAdapter struct {
 	tags     map[string]interface{} // 设备标签
 	stopCh   chan struct{}
 	parser   *config.ConfigParser[config.MockConfig]
+
+	rng          *rand.Rand      // 随机数源，配置seed后可重复
+	scenarios    *scenarioRunner // 场景脚本
+	disconnected bool            // 是否处于场景模拟的断连状态
 }
 
 // mockPoint 定义了模拟点位的配置
@@ -122,6 +127,8 @@ func NewMockAdapter() *MockAdapter {
 		deviceID:    "mock-device", 
 		interval:    5000 * time.Millisecond,
 		stopCh:      make(chan struct{}),
+		rng:         rand.New(rand.NewSource(time.Now().UnixNano())),
+		scenarios:   emptyScenarioRunner(), // Init前也可以通过API下发临时场景
 	}
 }
 
@@ -219,6 +226,18 @@ func (a *MockAdapter) initFromNewConfig(config *config.MockConfig) error {
 	// 初始化BaseAdapter
 	a.BaseAdapter = southbound.NewBaseAdapter(config.Name, "mock")
 	a.interval = config.Interval.Duration()
+
+	// 配置了种子时使用固定随机序列，便于复现测试
+	if config.Seed != 0 {
+		a.rng = rand.New(rand.NewSource(config.Seed))
+	}
+
+	// 解析场景脚本
+	scenarios, err := newScenarioRunner(config.Scenarios, config.Seed)
+	if err != nil {
+		return fmt.Errorf("解析模拟场景失败: %w", err)
+	}
+	a.scenarios = scenarios
 	
 	// 从新配置格式转换到内部格式
 	a.points = make([]mockPoint, len(config.DataPoints))
@@ -230,7 +249,7 @@ func (a *MockAdapter) initFromNewConfig(config *config.MockConfig) error {
 			Max:      dp.MaxValue,
 			Type:     "float", // 默认为浮点类型
 			Variance: 0.1,     // 默认波动
-			lastVal:  dp.MinValue + rand.Float64()*(dp.MaxValue-dp.MinValue),
+			lastVal:  dp.MinValue + a.rng.Float64()*(dp.MaxValue-dp.MinValue),
 		}
 		
 		// 处理复合数据类型配置
@@ -245,8 +264,8 @@ func (a *MockAdapter) initFromNewConfig(config *config.MockConfig) error {
 					point.locationState = &locationState{
 						currentLat: dp.LocationConfig.StartLatitude,
 						currentLng: dp.LocationConfig.StartLongitude,
-						direction:  rand.Float64() * 2 * math.Pi, // 随机初始方向
-						speed:      dp.LocationConfig.SpeedMin + rand.Float64()*(dp.LocationConfig.SpeedMax-dp.LocationConfig.SpeedMin),
+						direction:  a.rng.Float64() * 2 * math.Pi, // 随机初始方向
+						speed:      dp.LocationConfig.SpeedMin + a.rng.Float64()*(dp.LocationConfig.SpeedMax-dp.LocationConfig.SpeedMin),
 						lastUpdate: time.Now(),
 					}
 				}
@@ -254,9 +273,9 @@ func (a *MockAdapter) initFromNewConfig(config *config.MockConfig) error {
 				if dp.Vector3DConfig != nil {
 					point.Vector3DConfig = dp.Vector3DConfig
 					point.vector3dState = &vector3dState{
-						lastX: dp.Vector3DConfig.XMin + rand.Float64()*(dp.Vector3DConfig.XMax-dp.Vector3DConfig.XMin),
-						lastY: dp.Vector3DConfig.YMin + rand.Float64()*(dp.Vector3DConfig.YMax-dp.Vector3DConfig.YMin),
-						lastZ: dp.Vector3DConfig.ZMin + rand.Float64()*(dp.Vector3DConfig.ZMax-dp.Vector3DConfig.ZMin),
+						lastX: dp.Vector3DConfig.XMin + a.rng.Float64()*(dp.Vector3DConfig.XMax-dp.Vector3DConfig.XMin),
+						lastY: dp.Vector3DConfig.YMin + a.rng.Float64()*(dp.Vector3DConfig.YMax-dp.Vector3DConfig.YMin),
+						lastZ: dp.Vector3DConfig.ZMin + a.rng.Float64()*(dp.Vector3DConfig.ZMax-dp.Vector3DConfig.ZMin),
 						time:  0,
 					}
 				}
@@ -264,7 +283,7 @@ func (a *MockAdapter) initFromNewConfig(config *config.MockConfig) error {
 				if dp.ColorConfig != nil {
 					point.ColorConfig = dp.ColorConfig
 					point.colorState = &colorState{
-						currentHue: rand.Float64() * 360,
+						currentHue: a.rng.Float64() * 360,
 						colorIndex: 0,
 					}
 				}
@@ -344,6 +363,8 @@ func (a *MockAdapter) Start(ctx context.Context, ch chan<- model.Point) error {
 		return nil
 	}
 
+	a.scenarios.autoStart(time.Now())
+
 	go func() {
 		ticker := time.NewTicker(a.interval)
 		defer ticker.Stop()
@@ -354,6 +375,8 @@ func (a *MockAdapter) Start(ctx context.Context, ch chan<- model.Point) error {
 				// 记录数据生成开始时间
 				operationStart := time.Now()
 				
+				disconnected := false
+
 				// 生成所有点位的数据
 				for i := range a.points {
 					p := &a.points[i]
@@ -370,7 +393,7 @@ func (a *MockAdapter) Start(ctx context.Context, ch chan<- model.Point) error {
 						pointValue = p.Constant
 					} else if len(p.Values) > 0 {
 						// 从预定义值列表中随机选择
-						idx := rand.Intn(len(p.Values))
+						idx := a.rng.Intn(len(p.Values))
 						pointValue = p.Values[idx]
 					} else {
 						// 生成随机波动
@@ -380,7 +403,7 @@ func (a *MockAdapter) Start(ctx context.Context, ch chan<- model.Point) error {
 						}
 
 						// 在上次值的基础上添加随机波动
-						delta := (rand.Float64()*2 - 1) * variance * (p.Max - p.Min)
+						delta := (a.rng.Float64()*2 - 1) * variance * (p.Max - p.Min)
 						newVal := p.lastVal + delta
 
 						// 确保值在范围内
@@ -393,6 +416,24 @@ func (a *MockAdapter) Start(ctx context.Context, ch chan<- model.Point) error {
 						pointValue = newVal
 					}
 
+					// 使用数据点自己的device_id而不是适配器级别的device_id
+					var pointDeviceID string
+					if p.DeviceID != "" {
+						pointDeviceID = p.DeviceID
+					} else {
+						pointDeviceID = a.deviceID // 回退到适配器默认值
+					}
+
+					// 应用场景脚本（故障注入）
+					effect := a.scenarios.apply(pointDeviceID, p.Key, pointValue, operationStart)
+					if effect.Disconnected {
+						disconnected = true
+					}
+					if effect.Drop {
+						continue
+					}
+					pointValue = effect.Value
+
 					// 根据配置的类型转换值
 					switch p.Type {
 					case "int":
@@ -466,14 +507,6 @@ func (a *MockAdapter) Start(ctx context.Context, ch chan<- model.Point) error {
 						pointType = model.TypeFloat
 					}
 
-					// 创建数据点 - 使用数据点自己的device_id而不是适配器级别的device_id
-					var pointDeviceID string
-					if p.DeviceID != "" {
-						pointDeviceID = p.DeviceID
-					} else {
-						pointDeviceID = a.deviceID // 回退到适配器默认值
-					}
-
 					// 打印调试日志
 					log.Debug().
 						Str("key", p.Key).
@@ -498,6 +531,15 @@ func (a *MockAdapter) Start(ctx context.Context, ch chan<- model.Point) error {
 						point = model.NewPoint(p.Key, pointDeviceID, pointValue, pointType)
 					}
 					point.AddTag("source", "mock")
+					if effect.Quality != 0 {
+						point.SetQuality(effect.Quality)
+					}
+					if effect.Skew > 0 {
+						point.Timestamp = point.Timestamp.Add(-effect.Skew)
+					}
+					if len(effect.Scenarios) > 0 {
+						point.AddTag("scenario", strings.Join(effect.Scenarios, ","))
+					}
 					
 					// 添加设备标签
 					if a.tags != nil {
@@ -556,6 +598,7 @@ func (a *MockAdapter) Start(ctx context.Context, ch chan<- model.Point) error {
 					// 使用BaseAdapter的SafeSendDataPoint方法，自动处理统计
 					a.SafeSendDataPoint(ch, point, operationStart)
 				}
+				a.updateDisconnectHealth(disconnected)
 			case <-a.stopCh:
 				log.Info().Str("device_id", a.deviceID).Msg("模拟适配器停止")
 				return
@@ -633,7 +676,7 @@ func (a *MockAdapter) generateLocationData(p *mockPoint) (*model.LocationData, m
 		switch config.MovementPattern {
 		case "random_walk":
 			// 随机游走
-			state.direction += (rand.Float64() - 0.5) * 0.2 // 方向略微变化
+			state.direction += (a.rng.Float64() - 0.5) * 0.2 // 方向略微变化
 			speedKmh := state.speed
 			speedMs := speedKmh / 3.6 // 转换为米/秒
 			
@@ -653,12 +696,12 @@ func (a *MockAdapter) generateLocationData(p *mockPoint) (*model.LocationData, m
 			// 确保在指定范围内
 			if config.LatitudeRange > 0 {
 				if math.Abs(state.currentLat - config.StartLatitude) > config.LatitudeRange {
-					state.currentLat = config.StartLatitude + (config.LatitudeRange * (rand.Float64()*2 - 1))
+					state.currentLat = config.StartLatitude + (config.LatitudeRange * (a.rng.Float64()*2 - 1))
 				}
 			}
 			if config.LongitudeRange > 0 {
 				if math.Abs(state.currentLng - config.StartLongitude) > config.LongitudeRange {
-					state.currentLng = config.StartLongitude + (config.LongitudeRange * (rand.Float64()*2 - 1))
+					state.currentLng = config.StartLongitude + (config.LongitudeRange * (a.rng.Float64()*2 - 1))
 				}
 			}
 			
@@ -683,8 +726,8 @@ func (a *MockAdapter) generateLocationData(p *mockPoint) (*model.LocationData, m
 		state.lastUpdate = now
 		
 		// 随机调整速度
-		if rand.Float64() < 0.1 { // 10%概率调整速度
-			state.speed = config.SpeedMin + rand.Float64()*(config.SpeedMax-config.SpeedMin)
+		if a.rng.Float64() < 0.1 { // 10%概率调整速度
+			state.speed = config.SpeedMin + a.rng.Float64()*(config.SpeedMax-config.SpeedMin)
 		}
 	}
 	
@@ -696,7 +739,7 @@ func (a *MockAdapter) generateLocationData(p *mockPoint) (*model.LocationData, m
 	
 	// 添加可选字段
 	if config.AltitudeMin < config.AltitudeMax {
-		locationData.Altitude = config.AltitudeMin + rand.Float64()*(config.AltitudeMax-config.AltitudeMin)
+		locationData.Altitude = config.AltitudeMin + a.rng.Float64()*(config.AltitudeMax-config.AltitudeMin)
 	}
 	
 	if state.speed > 0 {
@@ -704,7 +747,7 @@ func (a *MockAdapter) generateLocationData(p *mockPoint) (*model.LocationData, m
 	}
 	
 	// 添加GPS精度 (3-10米)
-	locationData.Accuracy = 3.0 + rand.Float64()*7.0
+	locationData.Accuracy = 3.0 + a.rng.Float64()*7.0
 	
 	// 添加方向角
 	locationData.Heading = state.direction * (180.0 / math.Pi)
@@ -741,16 +784,16 @@ func (a *MockAdapter) generateVector3DData(p *mockPoint) (*model.Vector3D, model
 		// 考虑轴间相关性
 		if config.Correlation > 0 {
 			// 生成相关的随机变化
-			baseChange := (rand.Float64() - 0.5) * variance
+			baseChange := (a.rng.Float64() - 0.5) * variance
 			
 			x = state.lastX + baseChange*(config.XMax-config.XMin)
-			y = state.lastY + (baseChange*config.Correlation+(rand.Float64()-0.5)*variance*(1-config.Correlation))*(config.YMax-config.YMin)
-			z = state.lastZ + (baseChange*config.Correlation+(rand.Float64()-0.5)*variance*(1-config.Correlation))*(config.ZMax-config.ZMin)
+			y = state.lastY + (baseChange*config.Correlation+(a.rng.Float64()-0.5)*variance*(1-config.Correlation))*(config.YMax-config.YMin)
+			z = state.lastZ + (baseChange*config.Correlation+(a.rng.Float64()-0.5)*variance*(1-config.Correlation))*(config.ZMax-config.ZMin)
 		} else {
 			// 独立的随机变化
-			x = state.lastX + (rand.Float64()-0.5)*variance*(config.XMax-config.XMin)
-			y = state.lastY + (rand.Float64()-0.5)*variance*(config.YMax-config.YMin)
-			z = state.lastZ + (rand.Float64()-0.5)*variance*(config.ZMax-config.ZMin)
+			x = state.lastX + (a.rng.Float64()-0.5)*variance*(config.XMax-config.XMin)
+			y = state.lastY + (a.rng.Float64()-0.5)*variance*(config.YMax-config.YMin)
+			z = state.lastZ + (a.rng.Float64()-0.5)*variance*(config.ZMax-config.ZMin)
 		}
 		
 		// 确保在范围内
@@ -789,9 +832,9 @@ func (a *MockAdapter) generateColorData(p *mockPoint) (*model.ColorData, model.D
 	switch config.ColorMode {
 	case "random":
 		// 完全随机颜色
-		r = uint8(rand.Intn(256))
-		g = uint8(rand.Intn(256))
-		b = uint8(rand.Intn(256))
+		r = uint8(a.rng.Intn(256))
+		g = uint8(a.rng.Intn(256))
+		b = uint8(a.rng.Intn(256))
 		
 	case "rainbow":
 		// 彩虹色相循环
@@ -842,16 +885,16 @@ func (a *MockAdapter) generateColorData(p *mockPoint) (*model.ColorData, model.D
 			}
 			
 			// 循环颜色索引
-			if rand.Float64() < 0.1 { // 10%概率切换颜色
+			if a.rng.Float64() < 0.1 { // 10%概率切换颜色
 				state.colorIndex = (state.colorIndex + 1) % len(config.FixedColors)
 			}
 		}
 		
 	default:
 		// 默认随机模式
-		r = uint8(rand.Intn(256))
-		g = uint8(rand.Intn(256))
-		b = uint8(rand.Intn(256))
+		r = uint8(a.rng.Intn(256))
+		g = uint8(a.rng.Intn(256))
+		b = uint8(a.rng.Intn(256))
 	}
 	
 	return &model.ColorData{
@@ -888,13 +931,13 @@ func (a *MockAdapter) initVectorState(config *config.MockVectorConfig) *vectorSt
 		switch config.Distribution {
 		case "normal":
 			// 正态分布（简化版本）
-			values[i] = (minVal + maxVal) / 2.0 + (rand.Float64()-0.5)*(maxVal-minVal)*0.3
+			values[i] = (minVal + maxVal) / 2.0 + (a.rng.Float64()-0.5)*(maxVal-minVal)*0.3
 		case "exponential":
 			// 指数分布（简化版本）
-			values[i] = minVal + (maxVal-minVal)*(-math.Log(1.0-rand.Float64()))
+			values[i] = minVal + (maxVal-minVal)*(-math.Log(1.0-a.rng.Float64()))
 		default:
 			// 均匀分布
-			values[i] = minVal + rand.Float64()*(maxVal-minVal)
+			values[i] = minVal + a.rng.Float64()*(maxVal-minVal)
 		}
 	}
 	
@@ -993,12 +1036,12 @@ func (a *MockAdapter) initTimeSeriesState(config *config.MockTimeSeriesConfig) *
 		
 		// 添加噪声
 		if config.Noise > 0 {
-			value += (rand.Float64() - 0.5) * 2 * config.Noise
+			value += (a.rng.Float64() - 0.5) * 2 * config.Noise
 		}
 		
 		// 添加异常值（如果配置了）
-		if config.Anomalies != nil && rand.Float64() < config.Anomalies.Probability {
-			value += (rand.Float64() - 0.5) * config.Anomalies.Magnitude * value
+		if config.Anomalies != nil && a.rng.Float64() < config.Anomalies.Probability {
+			value += (a.rng.Float64() - 0.5) * config.Anomalies.Magnitude * value
 		}
 		
 		values = append(values, value)
@@ -1045,7 +1088,7 @@ func (a *MockAdapter) generateVectorData(p *mockPoint) (*model.VectorData, model
 			}
 			
 			// 随机变化，有相关性
-			change := (rand.Float64() - 0.5) * 0.1 * (maxVal - minVal)
+			change := (a.rng.Float64() - 0.5) * 0.1 * (maxVal - minVal)
 			if config.Correlation > 0 && i > 0 {
 				// 与前一个维度有相关性
 				prevChange := newValues[i-1] - state.lastValues[i-1]
@@ -1091,13 +1134,13 @@ func (a *MockAdapter) generateVectorData(p *mockPoint) (*model.VectorData, model
 			case "normal":
 				// 正态分布
 				center := (minVal + maxVal) / 2.0
-				newValues[i] = center + (rand.Float64()-0.5)*(maxVal-minVal)*0.3
+				newValues[i] = center + (a.rng.Float64()-0.5)*(maxVal-minVal)*0.3
 			case "exponential":
 				// 指数分布
-				newValues[i] = minVal + (maxVal-minVal)*(-math.Log(1.0-rand.Float64()))
+				newValues[i] = minVal + (maxVal-minVal)*(-math.Log(1.0-a.rng.Float64()))
 			default:
 				// 均匀分布
-				newValues[i] = minVal + rand.Float64()*(maxVal-minVal)
+				newValues[i] = minVal + a.rng.Float64()*(maxVal-minVal)
 			}
 		}
 	}
@@ -1144,7 +1187,7 @@ func (a *MockAdapter) generateArrayData(p *mockPoint) (*model.ArrayData, model.D
 	
 	// 随机打乱
 	for i := len(indices) - 1; i > 0; i-- {
-		j := rand.Intn(i + 1)
+		j := a.rng.Intn(i + 1)
 		indices[i], indices[j] = indices[j], indices[i]
 	}
 	
@@ -1196,9 +1239,9 @@ func (a *MockAdapter) generateMatrixData(p *mockPoint) (*model.MatrixData, model
 		// 微调部分元素
 		changeCount := max(1, (config.Rows*config.Cols)/10) // 改变10%的元素
 		for k := 0; k < changeCount; k++ {
-			i := rand.Intn(config.Rows)
-			j := rand.Intn(config.Cols)
-			change := (rand.Float64() - 0.5) * (config.MaxValue - config.MinValue) * 0.1
+			i := a.rng.Intn(config.Rows)
+			j := a.rng.Intn(config.Cols)
+			change := (a.rng.Float64() - 0.5) * (config.MaxValue - config.MinValue) * 0.1
 			newValues[i][j] += change
 			
 			// 边界检查
@@ -1257,12 +1300,12 @@ func (a *MockAdapter) generateTimeSeriesData(p *mockPoint) (*model.TimeSeriesDat
 	
 	// 添加噪声
 	if config.Noise > 0 {
-		newValue += (rand.Float64() - 0.5) * 2 * config.Noise
+		newValue += (a.rng.Float64() - 0.5) * 2 * config.Noise
 	}
 	
 	// 添加异常值
-	if config.Anomalies != nil && rand.Float64() < config.Anomalies.Probability {
-		newValue += (rand.Float64() - 0.5) * config.Anomalies.Magnitude * newValue
+	if config.Anomalies != nil && a.rng.Float64() < config.Anomalies.Probability {
+		newValue += (a.rng.Float64() - 0.5) * config.Anomalies.Magnitude * newValue
 	}
 	
 	// 更新序列（滑动窗口）
@@ -1298,40 +1341,40 @@ func (a *MockAdapter) generateTimeSeriesData(p *mockPoint) (*model.TimeSeriesDat
 // generateArrayElement 生成数组元素
 func (a *MockAdapter) generateArrayElement(config *config.MockArrayConfig) interface{} {
 	// 检查是否生成null值
-	if config.NullProbability > 0 && rand.Float64() < config.NullProbability {
+	if config.NullProbability > 0 && a.rng.Float64() < config.NullProbability {
 		return nil
 	}
 	
 	switch config.ElementType {
 	case "int":
-		return int(config.MinValue + rand.Float64()*(config.MaxValue-config.MinValue))
+		return int(config.MinValue + a.rng.Float64()*(config.MaxValue-config.MinValue))
 	case "float":
-		return config.MinValue + rand.Float64()*(config.MaxValue-config.MinValue)
+		return config.MinValue + a.rng.Float64()*(config.MaxValue-config.MinValue)
 	case "string":
 		if len(config.StringOptions) > 0 {
-			return config.StringOptions[rand.Intn(len(config.StringOptions))]
+			return config.StringOptions[a.rng.Intn(len(config.StringOptions))]
 		}
-		return fmt.Sprintf("string_%d", rand.Intn(1000))
+		return fmt.Sprintf("string_%d", a.rng.Intn(1000))
 	case "bool":
 		prob := config.BoolProbability
 		if prob == 0 {
 			prob = 0.5 // 默认50%概率
 		}
-		return rand.Float64() < prob
+		return a.rng.Float64() < prob
 	case "mixed":
 		// 混合类型，随机选择
-		switch rand.Intn(4) {
+		switch a.rng.Intn(4) {
 		case 0:
-			return int(config.MinValue + rand.Float64()*(config.MaxValue-config.MinValue))
+			return int(config.MinValue + a.rng.Float64()*(config.MaxValue-config.MinValue))
 		case 1:
-			return config.MinValue + rand.Float64()*(config.MaxValue-config.MinValue)
+			return config.MinValue + a.rng.Float64()*(config.MaxValue-config.MinValue)
 		case 2:
 			if len(config.StringOptions) > 0 {
-				return config.StringOptions[rand.Intn(len(config.StringOptions))]
+				return config.StringOptions[a.rng.Intn(len(config.StringOptions))]
 			}
-			return fmt.Sprintf("mixed_%d", rand.Intn(1000))
+			return fmt.Sprintf("mixed_%d", a.rng.Intn(1000))
 		case 3:
-			return rand.Float64() < 0.5
+			return a.rng.Float64() < 0.5
 		}
 	}
 	
@@ -1341,7 +1384,7 @@ func (a *MockAdapter) generateArrayElement(config *config.MockArrayConfig) inter
 // generateMatrixElement 生成矩阵元素
 func (a *MockAdapter) generateMatrixElement(config *config.MockMatrixConfig, row, col int) float64 {
 	// 检查稀疏度
-	if config.Sparsity > 0 && rand.Float64() < config.Sparsity {
+	if config.Sparsity > 0 && a.rng.Float64() < config.Sparsity {
 		return 0.0
 	}
 	
@@ -1358,7 +1401,7 @@ func (a *MockAdapter) generateMatrixElement(config *config.MockMatrixConfig, row
 			if config.MatrixType == "identity" {
 				return 1.0
 			} else {
-				value = config.MinValue + rand.Float64()*(config.MaxValue-config.MinValue)
+				value = config.MinValue + a.rng.Float64()*(config.MaxValue-config.MinValue)
 			}
 		} else {
 			return 0.0
@@ -1371,9 +1414,9 @@ func (a *MockAdapter) generateMatrixElement(config *config.MockMatrixConfig, row
 		switch config.Distribution {
 		case "normal":
 			center := (config.MinValue + config.MaxValue) / 2.0
-			value = center + (rand.Float64()-0.5)*(config.MaxValue-config.MinValue)*0.3
+			value = center + (a.rng.Float64()-0.5)*(config.MaxValue-config.MinValue)*0.3
 		default:
-			value = config.MinValue + rand.Float64()*(config.MaxValue-config.MinValue)
+			value = config.MinValue + a.rng.Float64()*(config.MaxValue-config.MinValue)
 		}
 	}
 	
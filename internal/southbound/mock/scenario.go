@@ -0,0 +1,555 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/config"
+	"github.com/y001j/iot-gateway/internal/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// 支持的场景阶段类型
+const (
+	phaseRamp       = "ramp"
+	phaseStep       = "step"
+	phaseHold       = "hold"
+	phaseNoise      = "noise"
+	phaseDrift      = "drift"
+	phaseStuck      = "stuck"
+	phaseSpike      = "spike"
+	phaseDropout    = "dropout"
+	phaseBadQuality = "bad_quality"
+	phaseOutOfOrder = "out_of_order"
+	phaseDisconnect = "disconnect"
+)
+
+// scenario 已解析的场景定义
+type scenario struct {
+	cfg    config.MockScenarioConfig
+	phases []scenarioPhase
+	length time.Duration // 时间线总长度
+}
+
+// scenarioPhase 带绝对偏移的阶段
+type scenarioPhase struct {
+	config.MockScenarioPhase
+	start time.Duration
+	end   time.Duration
+}
+
+// activeScenario 正在运行的场景实例
+type activeScenario struct {
+	def       *scenario
+	startedAt time.Time
+	rng       *rand.Rand
+	cycle     int64
+	states    map[string]*phaseState // phase索引|设备|key -> 阶段状态
+}
+
+// phaseState 阶段在某个设备/key上的状态
+type phaseState struct {
+	baseline float64
+}
+
+// scenarioEffect 场景对单个数据点的作用结果
+type scenarioEffect struct {
+	Value        interface{}
+	Drop         bool
+	Disconnected bool
+	Quality      int
+	Skew         time.Duration
+	Scenarios    []string // 生效的场景名
+}
+
+// ScenarioStatus 场景运行状态，通过REST接口暴露
+type ScenarioStatus struct {
+	Name         string    `json:"name"`
+	Active       bool      `json:"active"`
+	Repeat       bool      `json:"repeat"`
+	Seed         int64     `json:"seed"`
+	Phases       int       `json:"phases"`
+	Length       string    `json:"length"`
+	StartedAt    time.Time `json:"started_at,omitempty"`
+	Elapsed      string    `json:"elapsed,omitempty"`
+	Cycle        int64     `json:"cycle,omitempty"`
+	ActivePhases []string  `json:"active_phases,omitempty"`
+}
+
+// scenarioRunner 管理场景定义和运行中的场景
+type scenarioRunner struct {
+	mu         sync.Mutex
+	defs       map[string]*scenario
+	active     map[string]*activeScenario
+	seed       int64
+	lastValues map[string]float64 // 设备|key -> 最近一次发送的数值
+}
+
+// newScenarioRunner 解析场景配置
+func newScenarioRunner(cfgs []config.MockScenarioConfig, seed int64) (*scenarioRunner, error) {
+	r := &scenarioRunner{
+		defs:       make(map[string]*scenario),
+		active:     make(map[string]*activeScenario),
+		seed:       seed,
+		lastValues: make(map[string]float64),
+	}
+
+	for _, cfg := range cfgs {
+		def, err := parseScenario(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := r.defs[def.cfg.Name]; exists {
+			return nil, fmt.Errorf("场景名称重复: %s", def.cfg.Name)
+		}
+		r.defs[def.cfg.Name] = def
+	}
+
+	return r, nil
+}
+
+// emptyScenarioRunner 没有预定义场景的运行器
+func emptyScenarioRunner() *scenarioRunner {
+	r, _ := newScenarioRunner(nil, 0)
+	return r
+}
+
+// parseScenario 加载场景文件并计算阶段时间线
+func parseScenario(cfg config.MockScenarioConfig) (*scenario, error) {
+	if cfg.File != "" {
+		fileCfg, err := loadScenarioFile(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		// 行内配置优先于文件配置
+		if cfg.Name == "" {
+			cfg.Name = fileCfg.Name
+		}
+		if cfg.Seed == 0 {
+			cfg.Seed = fileCfg.Seed
+		}
+		cfg.Repeat = cfg.Repeat || fileCfg.Repeat
+		cfg.AutoStart = cfg.AutoStart || fileCfg.AutoStart
+		if len(cfg.Phases) == 0 {
+			cfg.Phases = fileCfg.Phases
+		}
+	}
+
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("场景名称不能为空")
+	}
+	if len(cfg.Phases) == 0 {
+		return nil, fmt.Errorf("场景 %s 没有配置阶段", cfg.Name)
+	}
+
+	def := &scenario{cfg: cfg, phases: make([]scenarioPhase, 0, len(cfg.Phases))}
+	var cursor time.Duration
+	for i, phase := range cfg.Phases {
+		if err := validatePhase(phase); err != nil {
+			return nil, fmt.Errorf("场景 %s 第%d个阶段无效: %w", cfg.Name, i+1, err)
+		}
+
+		start := cursor
+		if phase.Start != nil {
+			start = phase.Start.Duration()
+		}
+		end := start + phase.Duration.Duration()
+		def.phases = append(def.phases, scenarioPhase{MockScenarioPhase: phase, start: start, end: end})
+
+		cursor = end
+		if end > def.length {
+			def.length = end
+		}
+	}
+
+	return def, nil
+}
+
+// validatePhase 校验阶段配置
+func validatePhase(phase config.MockScenarioPhase) error {
+	switch phase.Type {
+	case phaseRamp, phaseStep, phaseHold, phaseNoise, phaseDrift, phaseStuck,
+		phaseSpike, phaseDropout, phaseBadQuality, phaseOutOfOrder, phaseDisconnect:
+	default:
+		return fmt.Errorf("不支持的阶段类型: %s", phase.Type)
+	}
+	if phase.Duration.Duration() <= 0 {
+		return fmt.Errorf("阶段持续时间必须大于0")
+	}
+	if phase.Probability < 0 || phase.Probability > 1 {
+		return fmt.Errorf("概率必须在0到1之间: %f", phase.Probability)
+	}
+	if phase.Profile != "" && phase.Profile != "gaussian" && phase.Profile != "uniform" {
+		return fmt.Errorf("不支持的噪声分布: %s", phase.Profile)
+	}
+	return nil
+}
+
+// loadScenarioFile 从YAML或JSON文件加载场景
+func loadScenarioFile(path string) (config.MockScenarioConfig, error) {
+	var cfg config.MockScenarioConfig
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("读取场景文件失败: %w", err)
+	}
+
+	// YAML文件先转换为JSON，复用JSON标签和Duration解析
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		var raw interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return cfg, fmt.Errorf("解析场景文件失败: %w", err)
+		}
+		if data, err = json.Marshal(raw); err != nil {
+			return cfg, fmt.Errorf("转换场景文件失败: %w", err)
+		}
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("解析场景文件失败: %w", err)
+	}
+	return cfg, nil
+}
+
+// autoStart 启动配置为自动运行的场景
+func (r *scenarioRunner) autoStart(now time.Time) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for name, def := range r.defs {
+		if def.cfg.AutoStart {
+			r.startLocked(def, now)
+			log.Info().Str("scenario", name).Msg("自动启动模拟场景")
+		}
+	}
+}
+
+// Trigger 按名称启动场景，已在运行的场景从头开始
+func (r *scenarioRunner) Trigger(name string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	def, ok := r.defs[name]
+	if !ok {
+		return fmt.Errorf("场景不存在: %s", name)
+	}
+	r.startLocked(def, now)
+	return nil
+}
+
+// Define 注册（或替换）场景定义并立即启动，用于运行时下发临时场景
+func (r *scenarioRunner) Define(cfg config.MockScenarioConfig, now time.Time) error {
+	def, err := parseScenario(cfg)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.defs[def.cfg.Name] = def
+	r.startLocked(def, now)
+	return nil
+}
+
+// Stop 停止指定场景，名称为空时停止全部
+func (r *scenarioRunner) Stop(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if name == "" {
+		r.active = make(map[string]*activeScenario)
+		return nil
+	}
+	if _, ok := r.active[name]; !ok {
+		return fmt.Errorf("场景未运行: %s", name)
+	}
+	delete(r.active, name)
+	return nil
+}
+
+// startLocked 创建场景运行实例，使用固定种子保证可重复
+func (r *scenarioRunner) startLocked(def *scenario, now time.Time) {
+	seed := def.cfg.Seed
+	if seed == 0 {
+		seed = r.seed
+	}
+	if seed == 0 {
+		seed = now.UnixNano()
+	}
+
+	r.active[def.cfg.Name] = &activeScenario{
+		def:       def,
+		startedAt: now,
+		rng:       rand.New(rand.NewSource(seed)),
+		states:    make(map[string]*phaseState),
+	}
+}
+
+// Status 返回所有场景的状态
+func (r *scenarioRunner) Status(now time.Time) []ScenarioStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	statuses := make([]ScenarioStatus, 0, len(r.defs))
+	for name, def := range r.defs {
+		status := ScenarioStatus{
+			Name:   name,
+			Repeat: def.cfg.Repeat,
+			Seed:   def.cfg.Seed,
+			Phases: len(def.phases),
+			Length: def.length.String(),
+		}
+		if run, ok := r.active[name]; ok {
+			elapsed := now.Sub(run.startedAt)
+			status.Active = true
+			status.StartedAt = run.startedAt
+			status.Elapsed = elapsed.String()
+			if def.cfg.Repeat && def.length > 0 {
+				status.Cycle = int64(elapsed / def.length)
+				elapsed %= def.length
+			}
+			for i, phase := range def.phases {
+				if elapsed >= phase.start && elapsed < phase.end {
+					status.ActivePhases = append(status.ActivePhases, phaseLabel(i, phase))
+				}
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// apply 计算运行中场景对数据点的作用，数值类变换只作用于数值
+func (r *scenarioRunner) apply(deviceID, key string, value interface{}, now time.Time) scenarioEffect {
+	effect := scenarioEffect{Value: value}
+	if r == nil {
+		return effect
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.active) == 0 {
+		return effect
+	}
+
+	target := deviceID + "|" + key
+	numeric, isNumeric := value.(float64)
+
+	names := make([]string, 0, len(r.active))
+	for name := range r.active {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		run := r.active[name]
+		def := run.def
+		elapsed := now.Sub(run.startedAt)
+
+		if elapsed >= def.length {
+			if !def.cfg.Repeat {
+				delete(r.active, name)
+				log.Info().Str("scenario", name).Msg("模拟场景执行完成")
+				continue
+			}
+			// 新一轮循环重置阶段状态，保证每轮行为一致
+			cycle := int64(elapsed / def.length)
+			if cycle != run.cycle {
+				run.cycle = cycle
+				run.states = make(map[string]*phaseState)
+			}
+			elapsed %= def.length
+		}
+
+		applied := false
+		for i := range def.phases {
+			phase := &def.phases[i]
+			if elapsed < phase.start || elapsed >= phase.end {
+				continue
+			}
+			if !utils.MatchGlob(phase.DeviceID, deviceID) {
+				continue
+			}
+			// 断连作用于整个设备，忽略key选择器
+			if phase.Type != phaseDisconnect && !utils.MatchGlob(phase.Key, key) {
+				continue
+			}
+
+			stateKey := fmt.Sprintf("%d|%s", i, target)
+			state, seen := run.states[stateKey]
+			if !seen {
+				state = &phaseState{baseline: numeric}
+				if phase.Type == phaseStuck {
+					if last, ok := r.lastValues[target]; ok {
+						state.baseline = last
+					}
+				}
+				run.states[stateKey] = state
+			}
+
+			progress := float64(elapsed-phase.start) / float64(phase.end-phase.start)
+			applied = true
+
+			switch phase.Type {
+			case phaseRamp:
+				if isNumeric {
+					from := state.baseline
+					if phase.From != nil {
+						from = *phase.From
+					}
+					to := from + phase.Delta
+					if phase.Value != nil {
+						to = *phase.Value
+					}
+					numeric = from + (to-from)*progress
+				}
+			case phaseStep:
+				if isNumeric {
+					if phase.Value != nil {
+						numeric = *phase.Value
+					} else {
+						numeric = state.baseline + phase.Delta
+					}
+				}
+			case phaseHold:
+				if isNumeric {
+					if phase.Value != nil {
+						numeric = *phase.Value
+					} else {
+						numeric = state.baseline
+					}
+				}
+			case phaseStuck:
+				if isNumeric {
+					numeric = state.baseline
+				}
+			case phaseNoise:
+				if isNumeric {
+					if phase.Profile == "uniform" {
+						numeric += (run.rng.Float64()*2 - 1) * phase.Amplitude
+					} else {
+						numeric += run.rng.NormFloat64() * phase.Amplitude
+					}
+				}
+			case phaseDrift:
+				if isNumeric {
+					numeric += phase.Rate * (elapsed - phase.start).Seconds()
+				}
+			case phaseSpike:
+				if isNumeric && run.rng.Float64() < probabilityOr(phase.Probability, 0.3) {
+					sign := 1.0
+					if run.rng.Intn(2) == 0 {
+						sign = -1.0
+					}
+					numeric += sign * math.Abs(phase.Amplitude)
+				}
+			case phaseDropout:
+				if run.rng.Float64() < probabilityOr(phase.Probability, 1) {
+					effect.Drop = true
+				}
+			case phaseBadQuality:
+				effect.Quality = phase.Quality
+				if effect.Quality == 0 {
+					effect.Quality = 1
+				}
+			case phaseOutOfOrder:
+				if run.rng.Float64() < probabilityOr(phase.Probability, 0.5) {
+					maxSkew := phase.MaxSkew.Duration()
+					if maxSkew <= 0 {
+						maxSkew = 5 * time.Second
+					}
+					effect.Skew = time.Duration(run.rng.Int63n(int64(maxSkew)) + 1)
+				}
+			case phaseDisconnect:
+				effect.Drop = true
+				effect.Disconnected = true
+			}
+		}
+
+		if applied {
+			effect.Scenarios = append(effect.Scenarios, name)
+		}
+	}
+
+	if isNumeric {
+		effect.Value = numeric
+		if !effect.Drop {
+			r.lastValues[target] = numeric
+		}
+	}
+	return effect
+}
+
+// probabilityOr 未配置概率时使用默认值
+func probabilityOr(p, def float64) float64 {
+	if p <= 0 {
+		return def
+	}
+	return p
+}
+
+// phaseLabel 阶段的可读标识
+func phaseLabel(index int, phase scenarioPhase) string {
+	if phase.Name != "" {
+		return phase.Name
+	}
+	return fmt.Sprintf("%d:%s", index+1, phase.Type)
+}
+
+// updateDisconnectHealth 根据断连阶段更新健康状态
+func (a *MockAdapter) updateDisconnectHealth(disconnected bool) {
+	if disconnected == a.disconnected {
+		return
+	}
+	a.disconnected = disconnected
+	if disconnected {
+		a.SetHealthStatus("degraded", "模拟场景: 设备断连")
+	} else {
+		a.SetHealthStatus("healthy", "模拟场景: 设备恢复连接")
+	}
+}
+
+// ScenarioStatus 返回场景定义及运行状态
+func (a *MockAdapter) ScenarioStatus() (interface{}, error) {
+	return a.scenarios.Status(time.Now()), nil
+}
+
+// TriggerScenario 启动场景，definition非空时先注册该临时场景
+// 运行时下发的定义不能引用文件，避免通过API读取网关主机上的任意路径
+func (a *MockAdapter) TriggerScenario(name string, definition json.RawMessage) error {
+	if len(definition) > 0 {
+		var cfg config.MockScenarioConfig
+		if err := json.Unmarshal(definition, &cfg); err != nil {
+			return fmt.Errorf("解析场景定义失败: %w", err)
+		}
+		if cfg.File != "" {
+			return fmt.Errorf("运行时下发的场景不能指定file，请直接提供phases或在适配器配置中定义场景")
+		}
+		if cfg.Name == "" {
+			cfg.Name = name
+		}
+		return a.scenarios.Define(cfg, time.Now())
+	}
+
+	return a.scenarios.Trigger(name, time.Now())
+}
+
+// StopScenario 停止场景，name为空时停止所有场景
+func (a *MockAdapter) StopScenario(name string) error {
+	return a.scenarios.Stop(name)
+}
@@ -0,0 +1,324 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/y001j/iot-gateway/internal/config"
+	"github.com/y001j/iot-gateway/internal/model"
+	"github.com/y001j/iot-gateway/internal/utils"
+)
+
+// recordReader 按文件顺序读取回放记录，每条记录可能展开为多个数据点（CSV宽表）
+type recordReader interface {
+	Next() ([]model.Point, error)
+	Close() error
+}
+
+// openReader 根据格式打开回放文件
+func openReader(path, format string, csvCfg config.ReplayCSVConfig) (recordReader, error) {
+	if format == "" || format == "auto" {
+		format = detectFormat(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开回放文件失败: %w", err)
+	}
+
+	switch format {
+	case "jsonl":
+		return newJSONLReader(f), nil
+	case "csv":
+		r, err := newCSVReader(f, csvCfg)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return r, nil
+	default:
+		f.Close()
+		return nil, fmt.Errorf("不支持的回放文件格式: %s", format)
+	}
+}
+
+// detectFormat 根据文件扩展名推断格式
+func detectFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv", ".tsv":
+		return "csv"
+	default:
+		return "jsonl"
+	}
+}
+
+// jsonlReader 读取每行一个model.Point JSON的捕获文件
+type jsonlReader struct {
+	file    *os.File
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newJSONLReader(f *os.File) *jsonlReader {
+	scanner := bufio.NewScanner(f)
+	// 复合数据（矩阵、时间序列）单行可能很长
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &jsonlReader{file: f, scanner: scanner}
+}
+
+// Next 读取下一条有效记录，跳过空行
+func (r *jsonlReader) Next() ([]model.Point, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var point model.Point
+		if err := json.Unmarshal(line, &point); err != nil {
+			return nil, fmt.Errorf("第%d行解析失败: %w", r.line, err)
+		}
+
+		// JSON反序列化后复合数据为map，需要还原为具体结构
+		if point.IsComposite() {
+			compositeData, err := model.DecodeCompositeValue(point.Type, point.Value)
+			if err != nil {
+				return nil, fmt.Errorf("第%d行复合数据还原失败: %w", r.line, err)
+			}
+			point.Value = compositeData
+		}
+		return []model.Point{point}, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (r *jsonlReader) Close() error {
+	return r.file.Close()
+}
+
+// csvReader 按列映射读取CSV文件，支持窄表（每行一个点）和宽表（每列一个key）
+type csvReader struct {
+	file    *os.File
+	reader  *csv.Reader
+	cfg     config.ReplayCSVConfig
+	columns map[string]int
+	wide    []string // 宽表数值列，排序后保证输出顺序稳定
+	line    int
+}
+
+func newCSVReader(f *os.File, cfg config.ReplayCSVConfig) (*csvReader, error) {
+	reader := csv.NewReader(bufio.NewReader(f))
+	if cfg.Delimiter != "" {
+		reader.Comma = []rune(cfg.Delimiter)[0]
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("读取CSV表头失败: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+
+	if _, ok := columns[cfg.TimestampColumn]; !ok {
+		return nil, fmt.Errorf("CSV缺少时间戳列: %s", cfg.TimestampColumn)
+	}
+	if len(cfg.ValueColumns) == 0 {
+		if _, ok := columns[cfg.ValueColumn]; !ok {
+			return nil, fmt.Errorf("CSV缺少数值列: %s", cfg.ValueColumn)
+		}
+		if _, ok := columns[cfg.KeyColumn]; !ok {
+			return nil, fmt.Errorf("CSV缺少key列: %s", cfg.KeyColumn)
+		}
+	}
+
+	wide := make([]string, 0, len(cfg.ValueColumns))
+	for column := range cfg.ValueColumns {
+		wide = append(wide, column)
+	}
+	sort.Strings(wide)
+
+	return &csvReader{file: f, reader: reader, cfg: cfg, columns: columns, wide: wide, line: 1}, nil
+}
+
+// field 返回指定列的值，列不存在时返回空字符串
+func (r *csvReader) field(record []string, column string) string {
+	if column == "" {
+		return ""
+	}
+	idx, ok := r.columns[column]
+	if !ok || idx >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[idx])
+}
+
+// Next 读取下一行并转换为数据点
+func (r *csvReader) Next() ([]model.Point, error) {
+	record, err := r.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	r.line++
+
+	ts, err := parseTimestamp(r.field(record, r.cfg.TimestampColumn), r.cfg.TimestampFormat)
+	if err != nil {
+		return nil, fmt.Errorf("第%d行时间戳解析失败: %w", r.line, err)
+	}
+
+	deviceID := r.field(record, r.cfg.DeviceIDColumn)
+	if deviceID == "" {
+		deviceID = r.cfg.DeviceID
+	}
+
+	quality := 0
+	if q := r.field(record, r.cfg.QualityColumn); q != "" {
+		if quality, err = strconv.Atoi(q); err != nil {
+			return nil, fmt.Errorf("第%d行质量码解析失败: %w", r.line, err)
+		}
+	}
+
+	tags := make(map[string]string, len(r.cfg.TagColumns))
+	for column, tag := range r.cfg.TagColumns {
+		if v := r.field(record, column); v != "" {
+			tags[tag] = v
+		}
+	}
+
+	// 宽表：每个映射列生成一个数据点
+	if len(r.wide) > 0 {
+		points := make([]model.Point, 0, len(r.wide))
+		for _, column := range r.wide {
+			key := r.cfg.ValueColumns[column]
+			raw := r.field(record, column)
+			if raw == "" {
+				continue
+			}
+			point, err := r.buildPoint(deviceID, key, raw, model.DataType(r.cfg.DataType), ts, quality, tags)
+			if err != nil {
+				return nil, fmt.Errorf("第%d行列%s解析失败: %w", r.line, column, err)
+			}
+			points = append(points, point)
+		}
+		return points, nil
+	}
+
+	dataType := model.DataType(r.field(record, r.cfg.TypeColumn))
+	if dataType == "" {
+		dataType = model.DataType(r.cfg.DataType)
+	}
+	point, err := r.buildPoint(deviceID, r.field(record, r.cfg.KeyColumn), r.field(record, r.cfg.ValueColumn), dataType, ts, quality, tags)
+	if err != nil {
+		return nil, fmt.Errorf("第%d行解析失败: %w", r.line, err)
+	}
+	return []model.Point{point}, nil
+}
+
+// buildPoint 根据数据类型解析原始字符串值
+func (r *csvReader) buildPoint(deviceID, key, raw string, dataType model.DataType, ts time.Time, quality int, tags map[string]string) (model.Point, error) {
+	value, dataType, err := parseValue(raw, dataType)
+	if err != nil {
+		return model.Point{}, err
+	}
+
+	point := model.Point{
+		Key:       key,
+		DeviceID:  deviceID,
+		Timestamp: ts,
+		Type:      dataType,
+		Value:     value,
+		Quality:   quality,
+		SafeTags:  utils.NewShardedTags(16),
+	}
+	point.SetTagsSafe(tags)
+	return point, nil
+}
+
+func (r *csvReader) Close() error {
+	return r.file.Close()
+}
+
+// parseValue 按声明类型解析值，类型为空时自动推断
+func parseValue(raw string, dataType model.DataType) (interface{}, model.DataType, error) {
+	switch dataType {
+	case model.TypeInt:
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			f, ferr := strconv.ParseFloat(raw, 64)
+			if ferr != nil {
+				return nil, dataType, err
+			}
+			v = int64(f)
+		}
+		return int(v), dataType, nil
+	case model.TypeFloat:
+		v, err := strconv.ParseFloat(raw, 64)
+		return v, dataType, err
+	case model.TypeBool:
+		v, err := strconv.ParseBool(raw)
+		return v, dataType, err
+	case model.TypeString, model.TypeBinary:
+		return raw, dataType, nil
+	case "":
+		if v, err := strconv.ParseFloat(raw, 64); err == nil {
+			return v, model.TypeFloat, nil
+		}
+		if v, err := strconv.ParseBool(raw); err == nil {
+			return v, model.TypeBool, nil
+		}
+		return raw, model.TypeString, nil
+	default:
+		// 复合类型在CSV中以JSON文本存储
+		compositeData, err := model.DecodeCompositeValue(dataType, raw)
+		if err != nil {
+			return nil, dataType, err
+		}
+		return compositeData, dataType, nil
+	}
+}
+
+// parseTimestamp 解析时间戳，支持RFC3339、Unix秒/毫秒/微秒和自定义布局
+func parseTimestamp(raw, format string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, fmt.Errorf("时间戳为空")
+	}
+
+	switch format {
+	case "", "rfc3339":
+		return time.Parse(time.RFC3339Nano, raw)
+	case "unix", "unix_ms", "unix_us":
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		switch format {
+		case "unix":
+			return time.Unix(0, int64(v*float64(time.Second))), nil
+		case "unix_ms":
+			return time.Unix(0, int64(v*float64(time.Millisecond))), nil
+		default:
+			return time.Unix(0, int64(v*float64(time.Microsecond))), nil
+		}
+	default:
+		return time.Parse(format, raw)
+	}
+}
@@ -0,0 +1,249 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/config"
+	"github.com/y001j/iot-gateway/internal/model"
+	"github.com/y001j/iot-gateway/internal/southbound"
+)
+
+func init() {
+	// 注册适配器工厂
+	southbound.Register("replay", func() southbound.Adapter {
+		return NewReplayAdapter()
+	})
+}
+
+// ReplayAdapter 回放适配器，读取捕获的JSONL或CSV文件并按原始节奏重新发出数据点
+type ReplayAdapter struct {
+	*southbound.BaseAdapter
+	cfg    *config.ReplayConfig
+	parser *config.ConfigParser[config.ReplayConfig]
+	tags   map[string]string
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewReplayAdapter 创建新的回放适配器实例
+func NewReplayAdapter() *ReplayAdapter {
+	return &ReplayAdapter{
+		BaseAdapter: southbound.NewBaseAdapter("replay-adapter", "replay"),
+		stopCh:      make(chan struct{}),
+	}
+}
+
+// Init 初始化适配器
+func (a *ReplayAdapter) Init(cfg json.RawMessage) error {
+	a.parser = config.NewParserWithDefaults(config.GetDefaultReplayConfig())
+	replayConfig, err := a.parser.Parse(cfg)
+	if err != nil {
+		return fmt.Errorf("解析Replay配置失败: %w", err)
+	}
+
+	a.BaseAdapter = southbound.NewBaseAdapter(replayConfig.Name, "replay")
+	a.cfg = replayConfig
+	a.tags = replayConfig.Tags
+
+	log.Info().
+		Str("name", a.Name()).
+		Strs("files", replayConfig.Files).
+		Str("format", replayConfig.Format).
+		Float64("speed", replayConfig.Speed).
+		Bool("loop", replayConfig.Loop).
+		Bool("rebase_timestamps", replayConfig.RebaseTimestamps).
+		Msg("回放适配器初始化完成")
+
+	return nil
+}
+
+// Start 启动适配器
+func (a *ReplayAdapter) Start(ctx context.Context, ch chan<- model.Point) error {
+	if a.IsRunning() {
+		return nil
+	}
+	if a.cfg == nil {
+		return fmt.Errorf("回放适配器未初始化")
+	}
+	a.SetRunning(true)
+	a.SetHealthStatus("healthy", "Replay adapter started")
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		a.run(ctx, ch)
+	}()
+
+	log.Info().Str("name", a.Name()).Msg("回放适配器启动")
+	return nil
+}
+
+// Stop 停止适配器
+func (a *ReplayAdapter) Stop() error {
+	if !a.IsRunning() {
+		return nil
+	}
+
+	close(a.stopCh)
+	a.wg.Wait()
+	a.SetRunning(false)
+	a.SetHealthStatus("healthy", "Replay adapter stopped")
+
+	// 重新创建stopCh为下次使用
+	a.stopCh = make(chan struct{})
+	return nil
+}
+
+// run 按配置回放所有文件，循环模式下重复直到停止
+func (a *ReplayAdapter) run(ctx context.Context, ch chan<- model.Point) {
+	for pass := 1; ; pass++ {
+		passSent := 0
+		for _, file := range a.cfg.Files {
+			sent, err := a.replayFile(ctx, ch, file)
+			if errors.Is(err, errStopped) {
+				log.Info().Str("name", a.Name()).Msg("回放适配器停止")
+				return
+			}
+			if err != nil {
+				a.SetLastError(err)
+				log.Error().Err(err).Str("name", a.Name()).Str("file", file).Msg("回放文件失败")
+				continue
+			}
+			passSent += sent
+			log.Info().
+				Str("name", a.Name()).
+				Str("file", file).
+				Int("pass", pass).
+				Int("points", sent).
+				Msg("回放文件完成")
+		}
+
+		if !a.cfg.Loop {
+			a.SetHealthStatus("healthy", "Replay finished")
+			log.Info().Str("name", a.Name()).Msg("回放完成")
+			return
+		}
+		// 一轮没有发送任何数据点（文件全部失败或为空）时停止循环，避免空转占满CPU
+		if passSent == 0 {
+			a.SetHealthStatus("degraded", "Replay loop stopped: no points in a full pass")
+			log.Error().Str("name", a.Name()).Int("pass", pass).Msg("一轮回放没有发送任何数据点，停止循环回放")
+			return
+		}
+	}
+}
+
+// errStopped 表示回放因停止或上下文取消而中断
+var errStopped = errors.New("replay stopped")
+
+// replayFile 回放单个文件，返回已发送的数据点数量
+func (a *ReplayAdapter) replayFile(ctx context.Context, ch chan<- model.Point, path string) (int, error) {
+	reader, err := openReader(path, a.cfg.Format, a.cfg.CSV)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	var (
+		sent      int
+		firstTS   time.Time
+		passStart time.Time
+	)
+
+	for {
+		points, err := reader.Next()
+		if err == io.EOF {
+			return sent, nil
+		}
+		if err != nil {
+			return sent, err
+		}
+		if len(points) == 0 {
+			continue
+		}
+
+		// 以文件中第一条记录为时间基准，按缩放后的相对偏移调度发送，避免累计漂移
+		ts := points[0].Timestamp
+		if firstTS.IsZero() {
+			firstTS = ts
+			passStart = time.Now()
+		}
+		offset := ts.Sub(firstTS)
+		if a.cfg.Speed > 0 {
+			offset = time.Duration(float64(offset) / a.cfg.Speed)
+			if wait := time.Until(passStart.Add(offset)); wait > 0 {
+				if err := a.sleep(ctx, wait); err != nil {
+					return sent, err
+				}
+			}
+		}
+
+		for _, point := range points {
+			operationStart := time.Now()
+			a.rewrite(&point, passStart, firstTS, offset)
+			if err := a.send(ctx, ch, point); err != nil {
+				return sent, err
+			}
+			a.IncrementDataPointsWithTiming(operationStart)
+			sent++
+		}
+	}
+}
+
+// rewrite 应用时间戳平移、设备ID改写和附加标签
+func (a *ReplayAdapter) rewrite(point *model.Point, passStart, firstTS time.Time, offset time.Duration) {
+	if a.cfg.RebaseTimestamps {
+		// 按速度缩放时时间戳与发送时刻对齐；尽可能快模式下保留原始间隔
+		if a.cfg.Speed > 0 {
+			point.Timestamp = passStart.Add(offset)
+		} else {
+			point.Timestamp = passStart.Add(point.Timestamp.Sub(firstTS))
+		}
+	}
+
+	if mapped, ok := a.cfg.DeviceIDMap[point.DeviceID]; ok {
+		point.DeviceID = mapped
+	}
+	if a.cfg.DeviceIDTemplate != "" {
+		point.DeviceID = strings.ReplaceAll(a.cfg.DeviceIDTemplate, "{device_id}", point.DeviceID)
+	}
+
+	point.AddTag("source", "replay")
+	for k, v := range a.tags {
+		point.AddTag(k, v)
+	}
+}
+
+// send 阻塞发送数据点，回放需要保证不丢点
+func (a *ReplayAdapter) send(ctx context.Context, ch chan<- model.Point, point model.Point) error {
+	select {
+	case ch <- point:
+		return nil
+	case <-a.stopCh:
+		return errStopped
+	case <-ctx.Done():
+		return errStopped
+	}
+}
+
+// sleep 可中断的等待
+func (a *ReplayAdapter) sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-a.stopCh:
+		return errStopped
+	case <-ctx.Done():
+		return errStopped
+	}
+}
@@ -0,0 +1,16 @@
+package utils
+
+import "path"
+
+// MatchGlob 使用shell风格通配符匹配字符串，空模式和"*"匹配任意值
+func MatchGlob(pattern, s string) bool {
+	if pattern == "" || pattern == "*" {
+		return true
+	}
+	matched, err := path.Match(pattern, s)
+	if err != nil {
+		// 非法模式退化为精确匹配
+		return pattern == s
+	}
+	return matched
+}
@@ -58,6 +58,34 @@ func (h *AdapterMonitoringHandler) GetAdapterStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// GetRoutingTable 获取连接器路由表
+// @Summary 获取连接器路由表
+// @Description 获取每个连接器的路由选择器、采样配置以及路由统计
+// @Tags 适配器监控
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.BaseResponse
+// @Failure 500 {object} models.BaseResponse
+// @Router /api/monitoring/routing [get]
+func (h *AdapterMonitoringHandler) GetRoutingTable(c *gin.Context) {
+	table, err := h.monitoringService.GetRoutingTable()
+	if err != nil {
+		log.Error().Err(err).Msg("获取路由表失败")
+		c.JSON(http.StatusInternalServerError, models.BaseResponse{
+			Code:    500,
+			Message: "获取路由表失败",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.BaseResponse{
+		Code:    200,
+		Message: "获取路由表成功",
+		Data:    table,
+	})
+}
+
 // GetDataFlowMetrics 获取数据流指标
 // @Summary 获取数据流指标
 // @Description 获取指定时间范围内的数据流指标，包括吞吐量、延迟等信息
@@ -0,0 +1,242 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/northbound/tsdb"
+	"github.com/y001j/iot-gateway/internal/web/models"
+	"github.com/y001j/iot-gateway/internal/web/services"
+)
+
+// DataHandler 历史数据查询处理器
+type DataHandler struct {
+	dataService services.DataService
+}
+
+// NewDataHandler 创建历史数据查询处理器
+func NewDataHandler(dataService services.DataService) *DataHandler {
+	return &DataHandler{dataService: dataService}
+}
+
+// DataQueryRequest 历史数据查询请求
+// 时间支持 RFC3339、毫秒时间戳或相对当前的时长（如 -1h、-7d），end默认为当前时间，start默认为end前1小时
+type DataQueryRequest struct {
+	Source      string            `json:"source"`      // 存储连接器名称，为空时使用第一个tsdb连接器
+	Start       string            `json:"start"`       // 开始时间（包含）
+	End         string            `json:"end"`         // 结束时间（不包含）
+	Step        string            `json:"step"`        // 聚合间隔，如 1m，为空时返回存储的原始点
+	Aggregation string            `json:"aggregation"` // avg min max sum count last
+	Resolution  string            `json:"resolution"`  // auto raw 或降采样名称
+	MaxPoints   int               `json:"max_points"`  // 单个序列最多返回的点数
+	Devices     []string          `json:"devices"`     // 设备ID通配符
+	Keys        []string          `json:"keys"`        // 数据点key通配符
+	Tags        map[string]string `json:"tags"`        // 标签通配符
+}
+
+// Query 查询历史数据
+// @Summary 查询历史数据
+// @Description 按时间范围、聚合间隔和设备/数据点/标签选择器查询本地时序存储，用于图表和规则试运行
+// @Tags 历史数据
+// @Accept json
+// @Produce json
+// @Param start query string false "开始时间" default("-1h")
+// @Param end query string false "结束时间"
+// @Param step query string false "聚合间隔"
+// @Param agg query string false "聚合方式" default("avg")
+// @Param device query string false "设备ID，逗号分隔，支持通配符"
+// @Param key query string false "数据点key，逗号分隔，支持通配符"
+// @Param tag query []string false "标签过滤 name=value"
+// @Success 200 {object} models.BaseResponse
+// @Failure 400 {object} models.BaseResponse
+// @Router /api/v1/data/query [get]
+func (h *DataHandler) Query(c *gin.Context) {
+	var req DataQueryRequest
+	if c.Request.Method == http.MethodPost {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.BaseResponse{
+				Code:    400,
+				Message: "请求参数错误",
+				Error:   err.Error(),
+			})
+			return
+		}
+	} else {
+		req = DataQueryRequest{
+			Source:      c.Query("source"),
+			Start:       c.Query("start"),
+			End:         c.Query("end"),
+			Step:        c.Query("step"),
+			Aggregation: c.Query("agg"),
+			Resolution:  c.Query("resolution"),
+			Devices:     splitList(c.Query("device")),
+			Keys:        splitList(c.Query("key")),
+			Tags:        parseTagParams(c.QueryArray("tag")),
+		}
+		if v := c.Query("max_points"); v != "" {
+			req.MaxPoints, _ = strconv.Atoi(v)
+		}
+	}
+
+	q, err := buildDataQuery(&req, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.BaseResponse{
+			Code:    400,
+			Message: "请求参数错误",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := h.dataService.Query(req.Source, q)
+	if err != nil {
+		log.Error().Err(err).Msg("查询历史数据失败")
+		c.JSON(http.StatusBadRequest, models.BaseResponse{
+			Code:    400,
+			Message: "查询历史数据失败",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.BaseResponse{
+		Code:    200,
+		Message: "查询成功",
+		Data:    result,
+	})
+}
+
+// Series 列出历史数据序列
+// @Summary 列出历史数据序列
+// @Description 列出本地时序存储中匹配选择器的序列
+// @Tags 历史数据
+// @Produce json
+// @Param device query string false "设备ID，逗号分隔，支持通配符"
+// @Param key query string false "数据点key，逗号分隔，支持通配符"
+// @Param tag query []string false "标签过滤 name=value"
+// @Success 200 {object} models.BaseResponse
+// @Router /api/v1/data/series [get]
+func (h *DataHandler) Series(c *gin.Context) {
+	sel := &tsdb.Selector{
+		Devices: splitList(c.Query("device")),
+		Keys:    splitList(c.Query("key")),
+		Tags:    parseTagParams(c.QueryArray("tag")),
+	}
+	series, err := h.dataService.Series(c.Query("source"), sel)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.BaseResponse{
+			Code:    400,
+			Message: "获取序列失败",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.BaseResponse{
+		Code:    200,
+		Message: "获取序列成功",
+		Data:    series,
+	})
+}
+
+// buildDataQuery 将请求转换为存储查询
+func buildDataQuery(req *DataQueryRequest, now time.Time) (*tsdb.Query, error) {
+	end := now
+	if req.End != "" {
+		t, err := parseQueryTime(req.End, now)
+		if err != nil {
+			return nil, fmt.Errorf("无效的end: %w", err)
+		}
+		end = t
+	}
+	start := end.Add(-time.Hour)
+	if req.Start != "" {
+		t, err := parseQueryTime(req.Start, now)
+		if err != nil {
+			return nil, fmt.Errorf("无效的start: %w", err)
+		}
+		start = t
+	}
+
+	q := &tsdb.Query{
+		Selector: tsdb.Selector{
+			Devices: req.Devices,
+			Keys:    req.Keys,
+			Tags:    req.Tags,
+		},
+		Start:       start,
+		End:         end,
+		Aggregation: req.Aggregation,
+		Resolution:  req.Resolution,
+		MaxPoints:   req.MaxPoints,
+	}
+	if req.Step != "" {
+		step, err := parseDurationWithDays(req.Step)
+		if err != nil || step < 0 {
+			return nil, fmt.Errorf("无效的step: %s", req.Step)
+		}
+		q.Step = step
+	}
+	return q, nil
+}
+
+// parseQueryTime 解析 RFC3339、毫秒时间戳、now 或相对时长
+func parseQueryTime(value string, now time.Time) (time.Time, error) {
+	if value == "now" {
+		return now, nil
+	}
+	if strings.HasPrefix(value, "-") || strings.HasPrefix(value, "now-") {
+		d, err := parseDurationWithDays(strings.TrimPrefix(strings.TrimPrefix(value, "now"), "-"))
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(-d), nil
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// parseDurationWithDays 在Go时长格式基础上支持以d结尾的天数
+func parseDurationWithDays(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, fmt.Errorf("无效的时长: %s", value)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(value)
+}
+
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func parseTagParams(values []string) map[string]string {
+	if len(values) == 0 {
+		return nil
+	}
+	tags := make(map[string]string, len(values))
+	for _, v := range values {
+		if name, pattern, ok := strings.Cut(v, "="); ok && name != "" {
+			tags[name] = pattern
+		}
+	}
+	return tags
+}
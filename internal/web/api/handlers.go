@@ -1,6 +1,7 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -104,6 +105,17 @@ func (h *BaseHandler) GetUserID(c *gin.Context) string {
 	return ""
 }
 
+// GetUsername 从上下文获取用户名
+func (h *BaseHandler) GetUsername(c *gin.Context) string {
+	if username, exists := c.Get("username"); exists && username != nil {
+		if name, ok := username.(string); ok {
+			return name
+		}
+		return fmt.Sprintf("%v", username)
+	}
+	return ""
+}
+
 // GetUserRoles 从上下文获取用户角色
 func (h *BaseHandler) GetUserRoles(c *gin.Context) []string {
 	if roles, exists := c.Get("roles"); exists {
@@ -327,3 +327,85 @@ func (h *PluginHandler) GetPluginStats(c *gin.Context) {
 
 	h.SuccessResponse(c, stats)
 }
+
+// GetScenarios 获取适配器场景
+// @Summary 获取适配器场景
+// @Description 获取支持场景脚本的适配器（如mock）的场景定义和运行状态
+// @Tags 插件管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Param name path string true "插件名称"
+// @Success 200 {object} APIResponse
+// @Failure 401 {object} APIResponse
+// @Failure 404 {object} APIResponse
+// @Router /plugins/{name}/scenarios [get]
+func (h *PluginHandler) GetScenarios(c *gin.Context) {
+	name := c.Param("id")
+	scenarios, err := h.pluginService.GetAdapterScenarios(name)
+	if err != nil {
+		h.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.SuccessResponse(c, scenarios)
+}
+
+// TriggerScenario 触发适配器场景
+// @Summary 触发适配器场景
+// @Description 按名称启动场景，或下发行内场景定义并立即启动
+// @Tags 插件管理
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param name path string true "插件名称"
+// @Param request body models.PluginScenarioRequest true "场景请求"
+// @Success 200 {object} APIResponse
+// @Failure 400 {object} APIResponse
+// @Failure 401 {object} APIResponse
+// @Router /plugins/{name}/scenarios/trigger [post]
+func (h *PluginHandler) TriggerScenario(c *gin.Context) {
+	name := c.Param("id")
+	var req models.PluginScenarioRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.ErrorResponse(c, http.StatusBadRequest, "无效的请求格式")
+		return
+	}
+
+	if err := h.pluginService.TriggerAdapterScenario(name, &req); err != nil {
+		h.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.SuccessResponse(c, nil)
+}
+
+// StopScenario 停止适配器场景
+// @Summary 停止适配器场景
+// @Description 停止指定场景，未指定场景名称时停止全部
+// @Tags 插件管理
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param name path string true "插件名称"
+// @Param request body models.PluginScenarioRequest false "场景请求"
+// @Success 200 {object} APIResponse
+// @Failure 400 {object} APIResponse
+// @Failure 401 {object} APIResponse
+// @Router /plugins/{name}/scenarios/stop [post]
+func (h *PluginHandler) StopScenario(c *gin.Context) {
+	name := c.Param("id")
+	var req models.PluginScenarioRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			h.ErrorResponse(c, http.StatusBadRequest, "无效的请求格式")
+			return
+		}
+	}
+
+	if err := h.pluginService.StopAdapterScenario(name, req.Scenario); err != nil {
+		h.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.SuccessResponse(c, nil)
+}
@@ -32,6 +32,7 @@ func SetupRoutes(router *gin.Engine, svc *services.Services, natsConn *nats.Conn
 	ruleHandler := NewRuleHandler(svc.Rule)
 	alertHandler := NewAlertHandler(svc.Alert)
 	wsHandler := NewWebSocketHandler(svc, natsConn)
+	dataHandler := NewDataHandler(svc.Data)
 	
 	// 创建适配器监控处理器（如果服务可用）
 	var monitoringHandler *AdapterMonitoringHandler
@@ -131,12 +132,15 @@ func SetupRoutes(router *gin.Engine, svc *services.Services, natsConn *nats.Conn
 					adminPlugins.DELETE("/:id", pluginHandler.DeletePlugin)
 					adminPlugins.PUT("/:id/config", pluginHandler.UpdatePluginConfig)
 					adminPlugins.POST("/:id/config/validate", pluginHandler.ValidatePluginConfig)
+					adminPlugins.POST("/:id/scenarios/trigger", pluginHandler.TriggerScenario)
+					adminPlugins.POST("/:id/scenarios/stop", pluginHandler.StopScenario)
 				}
 
 				// 普通用户权限
 				plugins.GET("/:id/config", pluginHandler.GetPluginConfig)
 				plugins.GET("/:id/logs", pluginHandler.GetPluginLogs)
 				plugins.GET("/:id/stats", pluginHandler.GetPluginStats)
+				plugins.GET("/:id/scenarios", pluginHandler.GetScenarios)
 
 				// 规则管理
 				rules := plugins.Group("/rules")
@@ -148,6 +152,23 @@ func SetupRoutes(router *gin.Engine, svc *services.Services, natsConn *nats.Conn
 					rules.DELETE("/:id", ruleHandler.DeleteRule)
 					rules.POST("/:id/enable", ruleHandler.EnableRule)
 					rules.POST("/:id/disable", ruleHandler.DisableRule)
+					rules.GET("/:id/alarms", ruleHandler.GetRuleAlarms)
+					rules.POST("/:id/alarms/reset", ruleHandler.ResetRuleAlarm)
+
+					// 规则修订历史
+					rules.GET("/:id/revisions", ruleHandler.ListRuleRevisions)
+					rules.GET("/:id/revisions/:rev", ruleHandler.GetRuleRevision)
+					rules.GET("/:id/revisions/:rev/diff", ruleHandler.DiffRuleRevisions)
+					rules.POST("/:id/revisions/:rev/rollback", ruleHandler.RollbackRule)
+					rules.POST("/revisions/export", ruleHandler.ExportRuleHistory)
+
+					// 参数化规则模板
+					rules.GET("/templates", ruleHandler.ListTemplateDefinitions)
+					rules.POST("/templates", ruleHandler.CreateTemplateDefinition)
+					rules.GET("/templates/:tid", ruleHandler.GetTemplateDefinition)
+					rules.PUT("/templates/:tid", ruleHandler.UpdateTemplateDefinition)
+					rules.DELETE("/templates/:tid", ruleHandler.DeleteTemplateDefinition)
+					rules.GET("/templates/:tid/rules", ruleHandler.GetTemplateRules)
 				}
 			}
 
@@ -205,9 +226,20 @@ func SetupRoutes(router *gin.Engine, svc *services.Services, natsConn *nats.Conn
 							adminAdapters.POST("/:name/restart", monitoringHandler.RestartAdapter)
 						}
 					}
+
+					// 连接器路由表
+					monitoring.GET("/routing", monitoringHandler.GetRoutingTable)
 				}
 			}
 
+			// 历史数据查询
+			data := protected.Group("/data")
+			{
+				data.GET("/query", dataHandler.Query)
+				data.POST("/query", dataHandler.Query)
+				data.GET("/series", dataHandler.Series)
+			}
+
 			// 日志管理（如果需要的话，可以后续添加）
 			// logs := protected.Group("/logs")
 			// {
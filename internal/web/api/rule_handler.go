@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/rs/zerolog/log"
 	"github.com/y001j/iot-gateway/internal/web/models"
@@ -89,7 +90,7 @@ func (h *RuleHandler) CreateRule(c *gin.Context) {
 		h.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
 		return
 	}
-	rule, err := h.ruleService.CreateRule(&req)
+	rule, err := h.ruleService.CreateRule(&req, h.ruleChange(c, req.Note))
 	if err != nil {
 		h.ErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
@@ -115,7 +116,7 @@ func (h *RuleHandler) UpdateRule(c *gin.Context) {
 		h.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
 		return
 	}
-	rule, err := h.ruleService.UpdateRule(id, &req)
+	rule, err := h.ruleService.UpdateRule(id, &req, h.ruleChange(c, req.Note))
 	if err != nil {
 		h.ErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
@@ -130,11 +131,12 @@ func (h *RuleHandler) UpdateRule(c *gin.Context) {
 // @Security ApiKeyAuth
 // @Produce json
 // @Param id path string true "规则ID"
+// @Param note query string false "变更说明"
 // @Success 204
 // @Router /rules/{id} [delete]
 func (h *RuleHandler) DeleteRule(c *gin.Context) {
 	id := c.Param("id")
-	if err := h.ruleService.DeleteRule(id); err != nil {
+	if err := h.ruleService.DeleteRule(id, h.ruleChange(c, c.Query("note"))); err != nil {
 		h.ErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -148,11 +150,12 @@ func (h *RuleHandler) DeleteRule(c *gin.Context) {
 // @Security ApiKeyAuth
 // @Produce json
 // @Param id path string true "规则ID"
+// @Param note query string false "变更说明"
 // @Success 200 {object} APIResponse
 // @Router /rules/{id}/enable [post]
 func (h *RuleHandler) EnableRule(c *gin.Context) {
 	id := c.Param("id")
-	if err := h.ruleService.EnableRule(id); err != nil {
+	if err := h.ruleService.EnableRule(id, h.ruleChange(c, c.Query("note"))); err != nil {
 		h.ErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -166,13 +169,318 @@ func (h *RuleHandler) EnableRule(c *gin.Context) {
 // @Security ApiKeyAuth
 // @Produce json
 // @Param id path string true "规则ID"
+// @Param note query string false "变更说明"
 // @Success 200 {object} APIResponse
 // @Router /rules/{id}/disable [post]
 func (h *RuleHandler) DisableRule(c *gin.Context) {
 	id := c.Param("id")
-	if err := h.ruleService.DisableRule(id); err != nil {
+	if err := h.ruleService.DisableRule(id, h.ruleChange(c, c.Query("note"))); err != nil {
 		h.ErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 	h.SuccessResponse(c, gin.H{"status": "disabled"})
 }
+
+// GetRuleAlarms 获取规则报警状态
+// @Summary 获取规则报警状态
+// @Description 获取规则中报警条件按设备和key跟踪的当前状态
+// @Tags 规则管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "规则ID"
+// @Success 200 {object} APIResponse{data=[]models.RuleAlarmState}
+// @Router /rules/{id}/alarms [get]
+func (h *RuleHandler) GetRuleAlarms(c *gin.Context) {
+	id := c.Param("id")
+	alarms, err := h.ruleService.GetRuleAlarms(id)
+	if err != nil {
+		h.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+	h.SuccessResponse(c, alarms)
+}
+
+// ResetRuleAlarm 复位锁存的报警
+// @Summary 复位锁存的报警
+// @Description 人工复位已恢复但处于锁存的报警，设备ID和key都为空时复位全部锁存的报警
+// @Tags 规则管理
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "规则ID"
+// @Param request body models.RuleAlarmResetRequest false "复位目标"
+// @Success 200 {object} APIResponse{data=[]models.RuleAlarmState}
+// @Router /rules/{id}/alarms/reset [post]
+func (h *RuleHandler) ResetRuleAlarm(c *gin.Context) {
+	id := c.Param("id")
+	var req models.RuleAlarmResetRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			h.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+	alarms, err := h.ruleService.ResetRuleAlarm(id, &req)
+	if err != nil {
+		h.ErrorResponse(c, http.StatusConflict, err.Error())
+		return
+	}
+	h.SuccessResponse(c, alarms)
+}
+
+// ruleChange 规则变更的修改人和说明，修改人取自认证上下文
+func (h *RuleHandler) ruleChange(c *gin.Context, note string) models.RuleChange {
+	return models.RuleChange{Author: h.GetUsername(c), Note: note}
+}
+
+// ListRuleRevisions 获取规则修订历史
+// @Summary 获取规则修订历史
+// @Description 获取规则的修订记录，按修订号倒序，规则删除后仍可查询
+// @Tags 规则管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "规则ID"
+// @Success 200 {object} APIResponse{data=[]models.RuleRevision}
+// @Router /rules/{id}/revisions [get]
+func (h *RuleHandler) ListRuleRevisions(c *gin.Context) {
+	revisions, err := h.ruleService.ListRuleRevisions(c.Param("id"))
+	if err != nil {
+		h.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+	h.SuccessResponse(c, revisions)
+}
+
+// GetRuleRevision 获取规则修订详情
+// @Summary 获取规则修订详情
+// @Description 获取指定修订及其规则快照
+// @Tags 规则管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "规则ID"
+// @Param rev path int true "修订号"
+// @Success 200 {object} APIResponse{data=models.RuleRevision}
+// @Router /rules/{id}/revisions/{rev} [get]
+func (h *RuleHandler) GetRuleRevision(c *gin.Context) {
+	rev, err := strconv.Atoi(c.Param("rev"))
+	if err != nil {
+		h.ErrorResponse(c, http.StatusBadRequest, "Invalid revision")
+		return
+	}
+	revision, err := h.ruleService.GetRuleRevision(c.Param("id"), rev)
+	if err != nil {
+		h.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+	h.SuccessResponse(c, revision)
+}
+
+// DiffRuleRevisions 比较规则修订
+// @Summary 比较规则修订
+// @Description 比较两个修订之间规则的结构差异，from默认为上一个修订，为0时与空规则比较
+// @Tags 规则管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "规则ID"
+// @Param rev path int true "修订号"
+// @Param from query int false "比较的起始修订号"
+// @Success 200 {object} APIResponse{data=models.RuleRevisionDiff}
+// @Router /rules/{id}/revisions/{rev}/diff [get]
+func (h *RuleHandler) DiffRuleRevisions(c *gin.Context) {
+	rev, err := strconv.Atoi(c.Param("rev"))
+	if err != nil {
+		h.ErrorResponse(c, http.StatusBadRequest, "Invalid revision")
+		return
+	}
+	from := rev - 1
+	if fromStr := c.Query("from"); fromStr != "" {
+		if from, err = strconv.Atoi(fromStr); err != nil || from < 0 {
+			h.ErrorResponse(c, http.StatusBadRequest, "Invalid from revision")
+			return
+		}
+	}
+	diff, err := h.ruleService.DiffRuleRevisions(c.Param("id"), from, rev)
+	if err != nil {
+		h.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+	h.SuccessResponse(c, diff)
+}
+
+// RollbackRule 回滚规则
+// @Summary 回滚规则
+// @Description 把规则恢复为指定修订的内容并作为新版本保存，规则已删除时重新创建
+// @Tags 规则管理
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "规则ID"
+// @Param rev path int true "修订号"
+// @Param request body models.RuleRollbackRequest false "回滚说明"
+// @Success 200 {object} APIResponse{data=models.Rule}
+// @Router /rules/{id}/revisions/{rev}/rollback [post]
+func (h *RuleHandler) RollbackRule(c *gin.Context) {
+	rev, err := strconv.Atoi(c.Param("rev"))
+	if err != nil {
+		h.ErrorResponse(c, http.StatusBadRequest, "Invalid revision")
+		return
+	}
+	var req models.RuleRollbackRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			h.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+	rule, err := h.ruleService.RollbackRule(c.Param("id"), rev, h.ruleChange(c, req.Note))
+	if err != nil {
+		h.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	h.SuccessResponse(c, rule)
+}
+
+// ExportRuleHistory 导出规则修订历史
+// @Summary 导出规则修订历史
+// @Description 把全部规则的修订历史导出为修订历史目录下的git裸仓库，每个修订一次提交，可用git clone查看
+// @Tags 规则管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} APIResponse{data=models.RuleHistoryExport}
+// @Router /rules/revisions/export [post]
+func (h *RuleHandler) ExportRuleHistory(c *gin.Context) {
+	export, err := h.ruleService.ExportRuleHistory()
+	if err != nil {
+		h.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.SuccessResponse(c, export)
+}
+
+// ListTemplateDefinitions 获取参数化规则模板
+// @Summary 获取参数化规则模板
+// @Description 获取按设备或标签组展开为规则的参数化模板
+// @Tags 规则管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} APIResponse{data=[]models.RuleTemplateDefinition}
+// @Router /rules/templates [get]
+func (h *RuleHandler) ListTemplateDefinitions(c *gin.Context) {
+	templates, err := h.ruleService.ListTemplateDefinitions()
+	if err != nil {
+		h.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.SuccessResponse(c, templates)
+}
+
+// GetTemplateDefinition 获取参数化规则模板详情
+// @Summary 获取参数化规则模板详情
+// @Tags 规则管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Param tid path string true "模板ID"
+// @Success 200 {object} APIResponse{data=models.RuleTemplateDefinition}
+// @Router /rules/templates/{tid} [get]
+func (h *RuleHandler) GetTemplateDefinition(c *gin.Context) {
+	template, err := h.ruleService.GetTemplateDefinition(c.Param("tid"))
+	if err != nil {
+		h.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+	h.SuccessResponse(c, template)
+}
+
+// CreateTemplateDefinition 创建参数化规则模板
+// @Summary 创建参数化规则模板
+// @Description 创建模板并为每个实例生成规则
+// @Tags 规则管理
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param template body models.RuleTemplateDefinition true "模板定义"
+// @Success 201 {object} APIResponse{data=models.RuleTemplateDefinition}
+// @Router /rules/templates [post]
+func (h *RuleHandler) CreateTemplateDefinition(c *gin.Context) {
+	var req models.RuleTemplateDefinition
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if _, err := h.ruleService.GetTemplateDefinition(req.ID); err == nil {
+		h.ErrorResponse(c, http.StatusConflict, "规则模板已存在: "+req.ID)
+		return
+	}
+	template, err := h.ruleService.SaveTemplateDefinition(&req)
+	if err != nil {
+		h.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	h.SuccessResponseWithCode(c, http.StatusCreated, template)
+}
+
+// UpdateTemplateDefinition 更新参数化规则模板
+// @Summary 更新参数化规则模板
+// @Description 更新模板后重新生成实例规则，不再属于模板的规则会被删除
+// @Tags 规则管理
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param tid path string true "模板ID"
+// @Param template body models.RuleTemplateDefinition true "模板定义"
+// @Success 200 {object} APIResponse{data=models.RuleTemplateDefinition}
+// @Router /rules/templates/{tid} [put]
+func (h *RuleHandler) UpdateTemplateDefinition(c *gin.Context) {
+	id := c.Param("tid")
+	var req models.RuleTemplateDefinition
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if _, err := h.ruleService.GetTemplateDefinition(id); err != nil {
+		h.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+	req.ID = id
+	template, err := h.ruleService.SaveTemplateDefinition(&req)
+	if err != nil {
+		h.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	h.SuccessResponse(c, template)
+}
+
+// DeleteTemplateDefinition 删除参数化规则模板
+// @Summary 删除参数化规则模板
+// @Description 删除模板及其生成的全部规则
+// @Tags 规则管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Param tid path string true "模板ID"
+// @Success 200 {object} APIResponse
+// @Router /rules/templates/{tid} [delete]
+func (h *RuleHandler) DeleteTemplateDefinition(c *gin.Context) {
+	if err := h.ruleService.DeleteTemplateDefinition(c.Param("tid")); err != nil {
+		h.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+	h.SuccessResponse(c, gin.H{"status": "deleted"})
+}
+
+// GetTemplateRules 获取模板展开的规则
+// @Summary 获取模板展开的规则
+// @Description 获取模板每个实例和覆盖设备展开后生效的规则
+// @Tags 规则管理
+// @Security ApiKeyAuth
+// @Produce json
+// @Param tid path string true "模板ID"
+// @Success 200 {object} APIResponse{data=[]models.Rule}
+// @Router /rules/templates/{tid}/rules [get]
+func (h *RuleHandler) GetTemplateRules(c *gin.Context) {
+	rules, err := h.ruleService.GetTemplateRules(c.Param("tid"))
+	if err != nil {
+		h.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+	h.SuccessResponse(c, rules)
+}
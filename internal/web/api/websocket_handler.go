@@ -15,6 +15,8 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/codec"
+	"github.com/y001j/iot-gateway/internal/model"
 	"github.com/y001j/iot-gateway/internal/web/models"
 	"github.com/y001j/iot-gateway/internal/web/services"
 )
@@ -532,7 +534,7 @@ func (h *WebSocketHandler) subscribeToNATSData() {
 	_, err := h.natsConn.Subscribe("iot.data.>", func(msg *nats.Msg) {
 		log.Debug().Str("subject", msg.Subject).Msg("WebSocket处理器收到IoT数据消息")
 		var data map[string]interface{}
-		if err := json.Unmarshal(msg.Data, &data); err == nil {
+		if err := decodeDataMessage(msg, &data); err == nil {
 			// 检查是否有客户端连接
 			h.mutex.RLock()
 			clientCount := len(h.clients)
@@ -611,6 +613,26 @@ func (h *WebSocketHandler) subscribeToNATSData() {
 
 }
 
+// decodeDataMessage 解码数据点消息为通用映射，二进制总线编码的消息先按Content-Type解码为数据点
+func decodeDataMessage(msg *nats.Msg, data *map[string]interface{}) error {
+	c, err := codec.ForMsg(msg)
+	if err != nil {
+		return err
+	}
+	if c.Name() == codec.JSON {
+		return json.Unmarshal(msg.Data, data)
+	}
+	var point model.Point
+	if err := c.Unmarshal(msg.Data, &point); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(point)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, data)
+}
+
 // smartBroadcastMessage 智能广播消息，支持客户端订阅管理和推送控制
 func (h *WebSocketHandler) smartBroadcastMessage(messageType string, data interface{}) {
 	message := WebSocketMessage{
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Plugin 插件模型
 type Plugin struct {
@@ -146,6 +149,12 @@ type PluginConfigValidationRequest struct {
 	Config map[string]interface{} `json:"config" binding:"required"`
 }
 
+// PluginScenarioRequest 模拟场景触发/停止请求
+type PluginScenarioRequest struct {
+	Scenario   string          `json:"scenario"`
+	Definition json.RawMessage `json:"definition,omitempty"` // 可选，行内场景定义
+}
+
 // PluginError 插件错误
 type PluginError struct {
 	PluginID   string    `json:"plugin_id"`
@@ -14,16 +14,33 @@ type Rule struct {
 	Version     int               `json:"version"`
 	DataType    interface{}       `json:"data_type,omitempty"` // 数据类型：字符串或详细定义
 	Conditions  *RuleCondition    `json:"conditions"`
+	Schedule    *RuleSchedule     `json:"schedule,omitempty"` // 定时触发
+	After       []string          `json:"after,omitempty"`    // 上游规则ID
 	Actions     []RuleAction      `json:"actions"`
 	Tags        map[string]string `json:"tags,omitempty"`
+	Template    *RuleTemplateRef  `json:"template,omitempty"` // 由模板展开时的来源
 	Stats       *RuleStats        `json:"stats,omitempty"`
 	CreatedAt   time.Time         `json:"created_at"`
 	UpdatedAt   time.Time         `json:"updated_at"`
 }
 
+// RuleSchedule 规则定时触发配置
+type RuleSchedule struct {
+	Type     string `json:"type"`                // absence, cron, interval
+	DeviceID string `json:"device_id,omitempty"` // absence为设备ID模式，cron/interval为合成数据点的设备ID
+	Key      string `json:"key,omitempty"`       // absence为key模式，cron/interval为合成数据点的key
+	Period   string `json:"period,omitempty"`    // 期望上报周期
+	Grace    string `json:"grace,omitempty"`     // 宽限时间
+	Cron     string `json:"cron,omitempty"`      // cron表达式
+	Timezone string `json:"timezone,omitempty"`  // 时区
+	Interval string `json:"interval,omitempty"`  // 触发间隔
+	Value    string `json:"value,omitempty"`     // 合成数据点值的表达式
+	Publish  bool   `json:"publish,omitempty"`   // 发布合成数据点
+}
+
 // RuleCondition 条件定义
 type RuleCondition struct {
-	Type       string          `json:"type,omitempty"`       // "simple", "expression", "lua"
+	Type       string          `json:"type,omitempty"`       // "simple", "expression", "lua", "sequence"
 	Field      string          `json:"field,omitempty"`      // 字段名
 	Operator   string          `json:"operator,omitempty"`   // 操作符
 	Value      interface{}     `json:"value,omitempty"`      // 比较值
@@ -32,6 +49,54 @@ type RuleCondition struct {
 	And        []RuleCondition `json:"and,omitempty"`        // AND条件
 	Or         []RuleCondition `json:"or,omitempty"`         // OR条件
 	Not        *RuleCondition  `json:"not,omitempty"`        // NOT条件
+	Sequence   *RuleSequence   `json:"sequence,omitempty"`   // 事件序列条件
+	Alarm      *RuleAlarm      `json:"alarm,omitempty"`      // 有状态报警条件
+}
+
+// RuleAlarm 有状态报警条件
+type RuleAlarm struct {
+	Field     string   `json:"field,omitempty"`     // 比较字段，默认value
+	Direction string   `json:"direction,omitempty"` // high 或 low
+	Raise     *float64 `json:"raise"`               // 报警阈值
+	Clear     *float64 `json:"clear,omitempty"`     // 恢复阈值
+	OnDelay   string   `json:"on_delay,omitempty"`  // 报警延时
+	OffDelay  string   `json:"off_delay,omitempty"` // 恢复延时
+	Latch     bool     `json:"latch,omitempty"`     // 锁存，需人工复位
+}
+
+// RuleAlarmState 规则报警状态
+type RuleAlarmState struct {
+	DeviceID   string      `json:"device_id"`
+	Key        string      `json:"key"`
+	State      string      `json:"state"` // normal, pending, active, clearing, latched
+	Value      interface{} `json:"value"`
+	Since      time.Time   `json:"since"`
+	RaisedAt   time.Time   `json:"raised_at"`
+	LastUpdate time.Time   `json:"last_update"`
+}
+
+// RuleAlarmResetRequest 报警复位请求，设备ID和key都为空时复位规则全部锁存的报警
+type RuleAlarmResetRequest struct {
+	DeviceID string `json:"device_id"`
+	Key      string `json:"key"`
+}
+
+// RuleSequence 事件序列条件
+type RuleSequence struct {
+	Steps       []RuleSequenceStep `json:"steps"`
+	Within      string             `json:"within,omitempty"`       // 第一步到最后一步的最长时间
+	PartitionBy string             `json:"partition_by,omitempty"` // device_id、key或tags.<名称>
+	MaxPartial  int                `json:"max_partial,omitempty"`  // 每个分区的部分匹配上限
+}
+
+// RuleSequenceStep 序列步骤
+type RuleSequenceStep struct {
+	Name      string         `json:"name,omitempty"`
+	DeviceID  string         `json:"device_id,omitempty"`
+	Key       string         `json:"key,omitempty"`
+	Condition *RuleCondition `json:"condition,omitempty"`
+	Within    string         `json:"within,omitempty"` // 距上一个匹配步骤的最长时间
+	Negate    bool           `json:"negate,omitempty"` // 否定步骤
 }
 
 // RuleAction 动作定义
@@ -70,10 +135,13 @@ type RuleCreateRequest struct {
 	Name        string            `json:"name" binding:"required"`
 	Description string            `json:"description"`
 	Priority    int               `json:"priority"`
-	Conditions  *RuleCondition    `json:"conditions" binding:"required"`
+	Conditions  *RuleCondition    `json:"conditions"`
+	Schedule    *RuleSchedule     `json:"schedule"`
+	After       []string          `json:"after"`
 	Actions     []RuleAction      `json:"actions" binding:"required,min=1"`
 	Tags        map[string]string `json:"tags"`
 	Enabled     bool              `json:"enabled"`
+	Note        string            `json:"note"` // 变更说明，记入修订历史
 }
 
 // RuleUpdateRequest 更新规则请求
@@ -82,9 +150,12 @@ type RuleUpdateRequest struct {
 	Description string            `json:"description"`
 	Priority    int               `json:"priority"`
 	Conditions  *RuleCondition    `json:"conditions"`
+	Schedule    *RuleSchedule     `json:"schedule"`
+	After       []string          `json:"after"` // 非nil时替换上游规则，空数组表示清除
 	Actions     []RuleAction      `json:"actions"`
 	Tags        map[string]string `json:"tags"`
 	Enabled     *bool             `json:"enabled"`
+	Note        string            `json:"note"` // 变更说明，记入修订历史
 }
 
 // RuleValidationResponse 规则验证响应
@@ -169,6 +240,92 @@ type RuleFromTemplateRequest struct {
 	Parameters  map[string]interface{} `json:"parameters"`
 }
 
+// RuleChange 规则变更的修改人和说明
+type RuleChange struct {
+	Author string `json:"author"`
+	Note   string `json:"note"`
+}
+
+// RuleRevision 规则修订记录
+type RuleRevision struct {
+	RuleID    string    `json:"rule_id"`
+	Revision  int       `json:"revision"`
+	Version   int       `json:"version"`
+	Action    string    `json:"action"` // create, update, delete, enable, disable, rollback
+	Author    string    `json:"author"`
+	Note      string    `json:"note,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Rule      *Rule     `json:"rule,omitempty"` // 变更后的规则，删除时为空
+}
+
+// RuleDiffEntry 规则修订之间的一处差异
+type RuleDiffEntry struct {
+	Path string      `json:"path"`
+	Op   string      `json:"op"` // added, removed, changed
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// RuleRevisionDiff 规则修订差异
+type RuleRevisionDiff struct {
+	RuleID  string          `json:"rule_id"`
+	From    int             `json:"from"`
+	To      int             `json:"to"`
+	Changes []RuleDiffEntry `json:"changes"`
+}
+
+// RuleRollbackRequest 规则回滚请求
+type RuleRollbackRequest struct {
+	Note string `json:"note"`
+}
+
+// RuleHistoryExport 修订历史导出结果
+type RuleHistoryExport struct {
+	Dir     string `json:"dir"`
+	Commits int    `json:"commits"`
+}
+
+// RuleTemplateDefinition 参数化规则模板，按实例绑定的设备展开为规则
+type RuleTemplateDefinition struct {
+	ID          string                            `json:"id"`
+	Name        string                            `json:"name"`
+	Description string                            `json:"description,omitempty"`
+	Parameters  map[string]*RuleTemplateParameter `json:"parameters,omitempty"`
+	Rule        map[string]interface{}            `json:"rule"`      // 规则主体，字符串中的${参数名}会被替换
+	Instances   []*RuleTemplateInstance           `json:"instances"` // 模板实例
+	Version     int                               `json:"version"`
+	CreatedAt   time.Time                         `json:"created_at"`
+	UpdatedAt   time.Time                         `json:"updated_at"`
+}
+
+// RuleTemplateParameter 模板参数定义
+type RuleTemplateParameter struct {
+	Type        string        `json:"type"`                  // number, integer, string, bool, duration
+	Default     interface{}   `json:"default,omitempty"`     // 默认值，未设置时实例必须提供
+	Min         *float64      `json:"min,omitempty"`         // 数值下限
+	Max         *float64      `json:"max,omitempty"`         // 数值上限
+	Options     []interface{} `json:"options,omitempty"`     // 可选值
+	Description string        `json:"description,omitempty"` // 参数说明
+}
+
+// RuleTemplateInstance 模板实例
+type RuleTemplateInstance struct {
+	ID         string                            `json:"id"`
+	Devices    []string                          `json:"devices,omitempty"`     // 设备ID列表
+	DeviceGlob string                            `json:"device_glob,omitempty"` // 设备ID通配模式
+	Tags       map[string]string                 `json:"tags,omitempty"`        // 按标签选择
+	Parameters map[string]interface{}            `json:"parameters,omitempty"`  // 实例参数
+	Overrides  map[string]map[string]interface{} `json:"overrides,omitempty"`   // 设备ID -> 参数覆盖
+	Enabled    *bool                             `json:"enabled,omitempty"`
+}
+
+// RuleTemplateRef 规则的模板来源
+type RuleTemplateRef struct {
+	TemplateID string `json:"template_id"`
+	InstanceID string `json:"instance_id"`
+	DeviceID   string `json:"device_id,omitempty"`
+}
+
 // Updated RuleStats to match service usage
 type RuleStatsExtended struct {
 	RuleID                string                 `json:"rule_id"`
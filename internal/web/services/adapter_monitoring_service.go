@@ -9,6 +9,7 @@ import (
 
 	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog/log"
+	"github.com/y001j/iot-gateway/internal/codec"
 	"github.com/y001j/iot-gateway/internal/model"
 	"github.com/y001j/iot-gateway/internal/northbound"
 	"github.com/y001j/iot-gateway/internal/plugin"
@@ -331,7 +332,7 @@ func (s *AdapterMonitoringService) subscribeToDataFlow() {
 // handleDataFlowMessage 处理数据流消息
 func (s *AdapterMonitoringService) handleDataFlowMessage(msg *nats.Msg) {
 	var point model.Point
-	if err := point.UnmarshalJSON(msg.Data); err != nil {
+	if err := codec.DecodeMsg(msg, &point); err != nil {
 		log.Error().Err(err).Msg("解析数据流消息失败")
 		return
 	}
@@ -643,6 +644,15 @@ func (s *AdapterMonitoringService) TrackSinkStart(name string) {
 	s.sinkStartTimes[name] = time.Now()
 }
 
+// GetRoutingTable 获取连接器路由表
+func (s *AdapterMonitoringService) GetRoutingTable() ([]plugin.SinkRouteInfo, error) {
+	provider, ok := s.pluginManager.(interface{ RoutingTable() []plugin.SinkRouteInfo })
+	if !ok {
+		return nil, fmt.Errorf("插件管理器不支持路由表查询")
+	}
+	return provider.RoutingTable(), nil
+}
+
 // Stop 停止监控服务
 func (s *AdapterMonitoringService) Stop() {
 	if s.cancel != nil {
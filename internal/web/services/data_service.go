@@ -0,0 +1,81 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/y001j/iot-gateway/internal/northbound/tsdb"
+	"github.com/y001j/iot-gateway/internal/plugin"
+)
+
+// historyStore 支持历史数据查询的连接器
+type historyStore interface {
+	Query(q *tsdb.Query) (*tsdb.QueryResult, error)
+	Series(sel *tsdb.Selector) ([]tsdb.SeriesInfo, error)
+}
+
+// DataService 本地历史数据查询服务
+type DataService interface {
+	// Query 查询历史数据，source为空时使用第一个本地存储连接器
+	Query(source string, q *tsdb.Query) (*tsdb.QueryResult, error)
+	// Series 列出存储中匹配的序列
+	Series(source string, sel *tsdb.Selector) ([]tsdb.SeriesInfo, error)
+}
+
+// dataService 数据查询服务实现
+type dataService struct {
+	pluginManager plugin.PluginManager
+}
+
+// NewDataService 创建数据查询服务
+func NewDataService(pluginManager plugin.PluginManager) DataService {
+	return &dataService{pluginManager: pluginManager}
+}
+
+// findStore 按名称查找存储连接器，未指定名称时返回第一个
+func (s *dataService) findStore(source string) (historyStore, error) {
+	if s.pluginManager == nil {
+		return nil, fmt.Errorf("插件管理器不可用")
+	}
+	if source != "" {
+		sink, ok := s.pluginManager.GetSink(source)
+		if !ok {
+			return nil, fmt.Errorf("连接器 %s 不存在或未运行", source)
+		}
+		store, ok := sink.(historyStore)
+		if !ok {
+			return nil, fmt.Errorf("连接器 %s 不支持历史数据查询", source)
+		}
+		return store, nil
+	}
+
+	lister, ok := s.pluginManager.(interface{ SinkNames() []string })
+	if !ok {
+		return nil, fmt.Errorf("插件管理器不支持列出连接器")
+	}
+	for _, name := range lister.SinkNames() {
+		if sink, ok := s.pluginManager.GetSink(name); ok {
+			if store, ok := sink.(historyStore); ok {
+				return store, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("未配置本地时序存储连接器（type: tsdb）")
+}
+
+// Query 查询历史数据
+func (s *dataService) Query(source string, q *tsdb.Query) (*tsdb.QueryResult, error) {
+	store, err := s.findStore(source)
+	if err != nil {
+		return nil, err
+	}
+	return store.Query(q)
+}
+
+// Series 列出匹配的序列
+func (s *dataService) Series(source string, sel *tsdb.Selector) ([]tsdb.SeriesInfo, error) {
+	store, err := s.findStore(source)
+	if err != nil {
+		return nil, err
+	}
+	return store.Series(sel)
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"bufio"
 	"crypto/rand"
+	"encoding/json"
 	"fmt"
 	"math/big"
 	"os"
@@ -31,6 +32,9 @@ type PluginService interface {
 	ValidatePluginConfig(name string, config map[string]interface{}) (*models.PluginConfigValidationResponse, error)
 	GetPluginLogs(name string, req *models.PluginLogRequest) ([]models.PluginLog, int, error)
 	GetPluginStats(name string) (*models.PluginStats, error)
+	GetAdapterScenarios(name string) (interface{}, error)
+	TriggerAdapterScenario(name string, req *models.PluginScenarioRequest) error
+	StopAdapterScenario(name string, scenario string) error
 }
 
 // pluginService 插件服务实现
@@ -722,3 +726,55 @@ func (s *pluginService) getProcessCPUUsage() float64 {
 	
 	return baseCPU // 默认返回基础CPU使用率
 }
+
+// scenarioAdapter 支持场景脚本的适配器（如mock）
+type scenarioAdapter interface {
+	ScenarioStatus() (interface{}, error)
+	TriggerScenario(name string, definition json.RawMessage) error
+	StopScenario(name string) error
+}
+
+// getScenarioAdapter 获取支持场景脚本的适配器
+func (s *pluginService) getScenarioAdapter(name string) (scenarioAdapter, error) {
+	adapter, ok := s.manager.GetAdapter(name)
+	if !ok {
+		return nil, fmt.Errorf("适配器不存在: %s", name)
+	}
+	sa, ok := adapter.(scenarioAdapter)
+	if !ok {
+		return nil, fmt.Errorf("适配器 %s 不支持场景脚本", name)
+	}
+	return sa, nil
+}
+
+// GetAdapterScenarios 获取适配器场景状态
+func (s *pluginService) GetAdapterScenarios(name string) (interface{}, error) {
+	sa, err := s.getScenarioAdapter(name)
+	if err != nil {
+		return nil, err
+	}
+	return sa.ScenarioStatus()
+}
+
+// TriggerAdapterScenario 触发适配器场景
+func (s *pluginService) TriggerAdapterScenario(name string, req *models.PluginScenarioRequest) error {
+	sa, err := s.getScenarioAdapter(name)
+	if err != nil {
+		return err
+	}
+	if req.Scenario == "" && len(req.Definition) == 0 {
+		return fmt.Errorf("必须指定场景名称或场景定义")
+	}
+	log.Info().Str("plugin_name", name).Str("scenario", req.Scenario).Msg("触发模拟场景")
+	return sa.TriggerScenario(req.Scenario, req.Definition)
+}
+
+// StopAdapterScenario 停止适配器场景，scenario为空时停止全部
+func (s *pluginService) StopAdapterScenario(name string, scenario string) error {
+	sa, err := s.getScenarioAdapter(name)
+	if err != nil {
+		return err
+	}
+	log.Info().Str("plugin_name", name).Str("scenario", scenario).Msg("停止模拟场景")
+	return sa.StopScenario(scenario)
+}
@@ -18,30 +18,63 @@ import (
 type RuleService interface {
 	GetRules(req *models.RuleListRequest) ([]models.Rule, int, error)
 	GetRule(id string) (*models.Rule, error)
-	CreateRule(rule *models.RuleCreateRequest) (*models.Rule, error)
-	UpdateRule(id string, rule *models.RuleUpdateRequest) (*models.Rule, error)
-	DeleteRule(id string) error
-	EnableRule(id string) error
-	DisableRule(id string) error
+	CreateRule(rule *models.RuleCreateRequest, change models.RuleChange) (*models.Rule, error)
+	UpdateRule(id string, rule *models.RuleUpdateRequest, change models.RuleChange) (*models.Rule, error)
+	DeleteRule(id string, change models.RuleChange) error
+	EnableRule(id string, change models.RuleChange) error
+	DisableRule(id string, change models.RuleChange) error
 	ValidateRule(rule *models.Rule) (*models.RuleValidationResponseExtended, error)
 	TestRule(req *models.RuleTestRequestExtended) (*models.RuleTestResponseExtended, error)
 	GetRuleStats(id string) (*models.RuleStatsExtended, error)
 	GetRuleExecutionHistory(id string, req *models.RuleHistoryRequest) ([]models.RuleExecution, int, error)
 	GetRuleTemplates() ([]models.RuleTemplate, error)
 	CreateRuleFromTemplate(templateID string, req *models.RuleFromTemplateRequest) (*models.Rule, error)
+	GetRuleAlarms(id string) ([]models.RuleAlarmState, error)
+	ResetRuleAlarm(id string, req *models.RuleAlarmResetRequest) ([]models.RuleAlarmState, error)
+	ListRuleRevisions(id string) ([]models.RuleRevision, error)
+	GetRuleRevision(id string, revision int) (*models.RuleRevision, error)
+	DiffRuleRevisions(id string, from, to int) (*models.RuleRevisionDiff, error)
+	RollbackRule(id string, revision int, change models.RuleChange) (*models.Rule, error)
+	ExportRuleHistory() (*models.RuleHistoryExport, error)
+	ListTemplateDefinitions() ([]models.RuleTemplateDefinition, error)
+	GetTemplateDefinition(id string) (*models.RuleTemplateDefinition, error)
+	SaveTemplateDefinition(template *models.RuleTemplateDefinition) (*models.RuleTemplateDefinition, error)
+	DeleteTemplateDefinition(id string) error
+	GetTemplateRules(id string) ([]models.Rule, error)
+}
+
+// RuleEngine 规则服务使用的规则引擎能力，由规则引擎服务实现
+type RuleEngine interface {
+	rules.AlarmStateProvider
+	rules.RuleTemplateStore
 }
 
 // ruleService 规则服务实现
 type ruleService struct {
-	manager rules.RuleManager
+	manager   rules.RuleManager
+	alarms    rules.AlarmStateProvider
+	templates rules.RuleTemplateStore
 }
 
 // NewRuleService 创建规则服务
 func NewRuleService(manager rules.RuleManager) (RuleService, error) {
+	return NewRuleServiceWithAlarms(manager, nil)
+}
+
+// NewRuleServiceWithAlarms 创建带报警状态查询的规则服务
+func NewRuleServiceWithAlarms(manager rules.RuleManager, alarms rules.AlarmStateProvider) (RuleService, error) {
+	if manager == nil {
+		return nil, fmt.Errorf("rule manager is required")
+	}
+	return &ruleService{manager: manager, alarms: alarms}, nil
+}
+
+// NewRuleServiceWithEngine 创建使用规则引擎报警状态和规则模板的规则服务
+func NewRuleServiceWithEngine(manager rules.RuleManager, engine RuleEngine) (RuleService, error) {
 	if manager == nil {
 		return nil, fmt.Errorf("rule manager is required")
 	}
-	return &ruleService{manager: manager}, nil
+	return &ruleService{manager: manager, alarms: engine, templates: engine}, nil
 }
 
 // convertToWebRule converts a manager rule to a web model rule.
@@ -55,13 +88,63 @@ func convertToWebRule(managerRule *rules.Rule) models.Rule {
 		Version:     managerRule.Version,
 		DataType:    managerRule.DataType, // 传递数据类型字段
 		Conditions:  convertCondition(managerRule.Conditions),
+		Schedule:    convertSchedule(managerRule.Schedule),
+		After:       managerRule.After,
 		Actions:     convertActions(managerRule.Actions),
 		Tags:        managerRule.Tags,
+		Template:    convertTemplateRef(managerRule.Template),
 		CreatedAt:   managerRule.CreatedAt,
 		UpdatedAt:   managerRule.UpdatedAt,
 	}
 }
 
+// convertTemplateRef converts rules.RuleTemplateRef to models.RuleTemplateRef
+func convertTemplateRef(ref *rules.RuleTemplateRef) *models.RuleTemplateRef {
+	if ref == nil {
+		return nil
+	}
+	webRef := models.RuleTemplateRef(*ref)
+	return &webRef
+}
+
+// convertSchedule converts rules.RuleSchedule to models.RuleSchedule
+func convertSchedule(schedule *rules.RuleSchedule) *models.RuleSchedule {
+	if schedule == nil {
+		return nil
+	}
+	return &models.RuleSchedule{
+		Type:     schedule.Type,
+		DeviceID: schedule.DeviceID,
+		Key:      schedule.Key,
+		Period:   schedule.Period,
+		Grace:    schedule.Grace,
+		Cron:     schedule.Cron,
+		Timezone: schedule.Timezone,
+		Interval: schedule.Interval,
+		Value:    schedule.Value,
+		Publish:  schedule.Publish,
+	}
+}
+
+// convertToManagerSchedule converts models.RuleSchedule to rules.RuleSchedule
+func convertToManagerSchedule(schedule *models.RuleSchedule) *rules.RuleSchedule {
+	if schedule == nil {
+		return nil
+	}
+	return &rules.RuleSchedule{
+		Type:     schedule.Type,
+		DeviceID: schedule.DeviceID,
+		Key:      schedule.Key,
+		Period:   schedule.Period,
+		Grace:    schedule.Grace,
+		Cron:     schedule.Cron,
+		Timezone: schedule.Timezone,
+		Interval: schedule.Interval,
+		Value:    schedule.Value,
+		Publish:  schedule.Publish,
+	}
+}
+
 // convertCondition converts rules.Condition to models.RuleCondition
 func convertCondition(cond *rules.Condition) *models.RuleCondition {
 	if cond == nil {
@@ -102,6 +185,42 @@ func convertCondition(cond *rules.Condition) *models.RuleCondition {
 		webCond.Not = convertCondition(cond.Not)
 	}
 	
+	// Convert alarm condition
+	if cond.Alarm != nil {
+		webCond.Alarm = &models.RuleAlarm{
+			Field:     cond.Alarm.Field,
+			Direction: cond.Alarm.Direction,
+			Raise:     cond.Alarm.Raise,
+			Clear:     cond.Alarm.Clear,
+			OnDelay:   cond.Alarm.OnDelay,
+			OffDelay:  cond.Alarm.OffDelay,
+			Latch:     cond.Alarm.Latch,
+		}
+	}
+	
+	// Convert sequence condition
+	if cond.Sequence != nil {
+		webCond.Sequence = &models.RuleSequence{
+			Within:      cond.Sequence.Within,
+			PartitionBy: cond.Sequence.PartitionBy,
+			MaxPartial:  cond.Sequence.MaxPartial,
+			Steps:       make([]models.RuleSequenceStep, 0, len(cond.Sequence.Steps)),
+		}
+		for _, step := range cond.Sequence.Steps {
+			if step == nil {
+				continue
+			}
+			webCond.Sequence.Steps = append(webCond.Sequence.Steps, models.RuleSequenceStep{
+				Name:      step.Name,
+				DeviceID:  step.DeviceID,
+				Key:       step.Key,
+				Condition: convertCondition(step.Condition),
+				Within:    step.Within,
+				Negate:    step.Negate,
+			})
+		}
+	}
+	
 	return webCond
 }
 
@@ -167,8 +286,11 @@ func (s *ruleService) GetRule(id string) (*models.Rule, error) {
 	return &webRule, nil
 }
 
-func (s *ruleService) CreateRule(req *models.RuleCreateRequest) (*models.Rule, error) {
+func (s *ruleService) CreateRule(req *models.RuleCreateRequest, change models.RuleChange) (*models.Rule, error) {
 	// Convert web condition to manager condition
+	if req.Conditions == nil && req.Schedule == nil {
+		return nil, fmt.Errorf("invalid conditions: 规则条件不能为空")
+	}
 	managerCondition, err := convertToManagerCondition(req.Conditions)
 	if err != nil {
 		return nil, fmt.Errorf("invalid conditions: %w", err)
@@ -188,13 +310,15 @@ func (s *ruleService) CreateRule(req *models.RuleCreateRequest) (*models.Rule, e
 		Priority:    req.Priority,
 		Version:     1,
 		Conditions:  managerCondition,
+		Schedule:    convertToManagerSchedule(req.Schedule),
+		After:       req.After,
 		Actions:     managerActions,
 		Tags:        req.Tags,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
 
-	if err := s.manager.SaveRule(newRule); err != nil {
+	if err := s.manager.SaveRuleWithChange(newRule, rules.RuleChange(change)); err != nil {
 		return nil, err
 	}
 
@@ -202,11 +326,14 @@ func (s *ruleService) CreateRule(req *models.RuleCreateRequest) (*models.Rule, e
 	return &webRule, nil
 }
 
-func (s *ruleService) UpdateRule(id string, req *models.RuleUpdateRequest) (*models.Rule, error) {
-	managerRule, err := s.manager.GetRule(id)
+func (s *ruleService) UpdateRule(id string, req *models.RuleUpdateRequest, change models.RuleChange) (*models.Rule, error) {
+	existingRule, err := s.manager.GetRule(id)
 	if err != nil {
 		return nil, err
 	}
+	// 在副本上修改，保存失败（如依赖出现环路）时不影响正在运行的规则
+	updatedRule := *existingRule
+	managerRule := &updatedRule
 
 	// Apply updates from req
 	if req.Name != "" {
@@ -235,6 +362,16 @@ func (s *ruleService) UpdateRule(id string, req *models.RuleUpdateRequest) (*mod
 		managerRule.Conditions = managerCondition
 	}
 	
+	// Update schedule if provided
+	if req.Schedule != nil {
+		managerRule.Schedule = convertToManagerSchedule(req.Schedule)
+	}
+	
+	// Update upstream rules if provided
+	if req.After != nil {
+		managerRule.After = req.After
+	}
+	
 	// Update actions if provided
 	if req.Actions != nil && len(req.Actions) > 0 {
 		// Convert web actions to manager actions
@@ -249,7 +386,7 @@ func (s *ruleService) UpdateRule(id string, req *models.RuleUpdateRequest) (*mod
 	managerRule.Version++
 	managerRule.UpdatedAt = time.Now()
 
-	if err := s.manager.SaveRule(managerRule); err != nil {
+	if err := s.manager.SaveRuleWithChange(managerRule, rules.RuleChange(change)); err != nil {
 		return nil, err
 	}
 
@@ -257,16 +394,94 @@ func (s *ruleService) UpdateRule(id string, req *models.RuleUpdateRequest) (*mod
 	return &webRule, nil
 }
 
-func (s *ruleService) DeleteRule(id string) error {
-	return s.manager.DeleteRule(id)
+func (s *ruleService) DeleteRule(id string, change models.RuleChange) error {
+	return s.manager.DeleteRuleWithChange(id, rules.RuleChange(change))
+}
+
+func (s *ruleService) EnableRule(id string, change models.RuleChange) error {
+	return s.manager.SetRuleEnabled(id, true, rules.RuleChange(change))
+}
+
+func (s *ruleService) DisableRule(id string, change models.RuleChange) error {
+	return s.manager.SetRuleEnabled(id, false, rules.RuleChange(change))
+}
+
+// convertRevision converts rules.RuleRevision to models.RuleRevision
+func convertRevision(revision *rules.RuleRevision) models.RuleRevision {
+	webRevision := models.RuleRevision{
+		RuleID:    revision.RuleID,
+		Revision:  revision.Revision,
+		Version:   revision.Version,
+		Action:    revision.Action,
+		Author:    revision.Author,
+		Note:      revision.Note,
+		Timestamp: revision.Timestamp,
+	}
+	if revision.Rule != nil {
+		webRule := convertToWebRule(revision.Rule)
+		webRevision.Rule = &webRule
+	}
+	return webRevision
+}
+
+// ListRuleRevisions 获取规则修订历史，按修订号倒序
+func (s *ruleService) ListRuleRevisions(id string) ([]models.RuleRevision, error) {
+	revisions, err := s.manager.ListRevisions(id)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]models.RuleRevision, 0, len(revisions))
+	for i := len(revisions) - 1; i >= 0; i-- {
+		result = append(result, convertRevision(revisions[i]))
+	}
+	return result, nil
+}
+
+// GetRuleRevision 获取规则的指定修订
+func (s *ruleService) GetRuleRevision(id string, revision int) (*models.RuleRevision, error) {
+	managerRevision, err := s.manager.GetRevision(id, revision)
+	if err != nil {
+		return nil, err
+	}
+	webRevision := convertRevision(managerRevision)
+	return &webRevision, nil
+}
+
+// DiffRuleRevisions 比较规则两个修订之间的差异
+func (s *ruleService) DiffRuleRevisions(id string, from, to int) (*models.RuleRevisionDiff, error) {
+	diffs, err := s.manager.DiffRevisions(id, from, to)
+	if err != nil {
+		return nil, err
+	}
+	result := &models.RuleRevisionDiff{
+		RuleID:  id,
+		From:    from,
+		To:      to,
+		Changes: make([]models.RuleDiffEntry, 0, len(diffs)),
+	}
+	for _, diff := range diffs {
+		result.Changes = append(result.Changes, models.RuleDiffEntry(diff))
+	}
+	return result, nil
 }
 
-func (s *ruleService) EnableRule(id string) error {
-	return s.manager.EnableRule(id)
+// RollbackRule 把规则恢复为指定修订的内容
+func (s *ruleService) RollbackRule(id string, revision int, change models.RuleChange) (*models.Rule, error) {
+	rule, err := s.manager.RollbackRule(id, revision, rules.RuleChange(change))
+	if err != nil {
+		return nil, err
+	}
+	webRule := convertToWebRule(rule)
+	return &webRule, nil
 }
 
-func (s *ruleService) DisableRule(id string) error {
-	return s.manager.DisableRule(id)
+// ExportRuleHistory 把规则修订历史导出为git仓库
+func (s *ruleService) ExportRuleHistory() (*models.RuleHistoryExport, error) {
+	dir, commits, err := s.manager.ExportHistoryGit("")
+	if err != nil {
+		return nil, err
+	}
+	return &models.RuleHistoryExport{Dir: dir, Commits: commits}, nil
 }
 
 // ValidateRule 验证规则
@@ -288,10 +503,12 @@ func (s *ruleService) ValidateRule(rule *models.Rule) (*models.RuleValidationRes
 		response.Errors = append(response.Errors, "规则优先级必须在0-100之间")
 	}
 
-	// 验证条件
+	// 验证条件，定时触发的规则可以不设条件
 	if rule.Conditions == nil {
-		response.Valid = false
-		response.Errors = append(response.Errors, "规则条件不能为空")
+		if rule.Schedule == nil {
+			response.Valid = false
+			response.Errors = append(response.Errors, "规则条件不能为空")
+		}
 	} else {
 		if err := s.validateCondition(rule.Conditions); err != nil {
 			response.Valid = false
@@ -355,6 +572,22 @@ func (s *ruleService) validateCondition(condition *models.RuleCondition) error {
 			return fmt.Errorf("表达式条件必须指定表达式")
 		}
 		// 这里可以添加表达式语法验证
+	case "alarm":
+		if condition.Alarm == nil || condition.Alarm.Raise == nil {
+			return fmt.Errorf("报警条件必须指定raise阈值")
+		}
+	case "sequence":
+		if condition.Sequence == nil || len(condition.Sequence.Steps) == 0 {
+			return fmt.Errorf("序列条件至少需要1个步骤")
+		}
+		for i, step := range condition.Sequence.Steps {
+			if step.Condition == nil {
+				continue
+			}
+			if err := s.validateCondition(step.Condition); err != nil {
+				return fmt.Errorf("序列步骤 %d: %s", i+1, err.Error())
+			}
+		}
 	default:
 		return fmt.Errorf("不支持的条件类型: %s", condition.Type)
 	}
@@ -534,6 +767,170 @@ func (s *ruleService) GetRuleStats(id string) (*models.RuleStatsExtended, error)
 	return stats, nil
 }
 
+// GetRuleAlarms 获取规则报警条件的当前状态
+func (s *ruleService) GetRuleAlarms(id string) ([]models.RuleAlarmState, error) {
+	if s.alarms == nil {
+		return nil, fmt.Errorf("规则引擎未启用，无法查询报警状态")
+	}
+	statuses, err := s.alarms.GetAlarmStates(id)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]models.RuleAlarmState, 0, len(statuses))
+	for _, status := range statuses {
+		result = append(result, models.RuleAlarmState{
+			DeviceID:   status.DeviceID,
+			Key:        status.Key,
+			State:      status.State,
+			Value:      status.Value,
+			Since:      status.Since,
+			RaisedAt:   status.RaisedAt,
+			LastUpdate: status.LastUpdate,
+		})
+	}
+	return result, nil
+}
+
+// ResetRuleAlarm 人工复位锁存的报警，返回复位后的报警状态
+func (s *ruleService) ResetRuleAlarm(id string, req *models.RuleAlarmResetRequest) ([]models.RuleAlarmState, error) {
+	if s.alarms == nil {
+		return nil, fmt.Errorf("规则引擎未启用，无法复位报警")
+	}
+	if _, err := s.alarms.ResetAlarm(id, req.DeviceID, req.Key); err != nil {
+		return nil, err
+	}
+	return s.GetRuleAlarms(id)
+}
+
+// convertTemplateDefinition converts rules.RuleTemplate to models.RuleTemplateDefinition
+func convertTemplateDefinition(template *rules.RuleTemplate) models.RuleTemplateDefinition {
+	webTemplate := models.RuleTemplateDefinition{
+		ID:          template.ID,
+		Name:        template.Name,
+		Description: template.Description,
+		Rule:        template.Rule,
+		Version:     template.Version,
+		CreatedAt:   template.CreatedAt,
+		UpdatedAt:   template.UpdatedAt,
+	}
+	if len(template.Parameters) > 0 {
+		webTemplate.Parameters = make(map[string]*models.RuleTemplateParameter, len(template.Parameters))
+		for name, param := range template.Parameters {
+			if param == nil {
+				continue
+			}
+			webParam := models.RuleTemplateParameter(*param)
+			webTemplate.Parameters[name] = &webParam
+		}
+	}
+	for _, instance := range template.Instances {
+		if instance == nil {
+			continue
+		}
+		webInstance := models.RuleTemplateInstance(*instance)
+		webTemplate.Instances = append(webTemplate.Instances, &webInstance)
+	}
+	return webTemplate
+}
+
+// convertToManagerTemplate converts models.RuleTemplateDefinition to rules.RuleTemplate
+func convertToManagerTemplate(template *models.RuleTemplateDefinition) *rules.RuleTemplate {
+	managerTemplate := &rules.RuleTemplate{
+		ID:          template.ID,
+		Name:        template.Name,
+		Description: template.Description,
+		Rule:        template.Rule,
+	}
+	if len(template.Parameters) > 0 {
+		managerTemplate.Parameters = make(map[string]*rules.TemplateParameter, len(template.Parameters))
+		for name, param := range template.Parameters {
+			if param == nil {
+				managerTemplate.Parameters[name] = nil
+				continue
+			}
+			managerParam := rules.TemplateParameter(*param)
+			managerTemplate.Parameters[name] = &managerParam
+		}
+	}
+	for _, instance := range template.Instances {
+		if instance == nil {
+			managerTemplate.Instances = append(managerTemplate.Instances, nil)
+			continue
+		}
+		managerInstance := rules.TemplateInstance(*instance)
+		managerTemplate.Instances = append(managerTemplate.Instances, &managerInstance)
+	}
+	return managerTemplate
+}
+
+// ListTemplateDefinitions 获取参数化规则模板
+func (s *ruleService) ListTemplateDefinitions() ([]models.RuleTemplateDefinition, error) {
+	if s.templates == nil {
+		return nil, fmt.Errorf("规则引擎未启用，无法管理规则模板")
+	}
+	templates, err := s.templates.ListTemplates()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]models.RuleTemplateDefinition, 0, len(templates))
+	for _, template := range templates {
+		result = append(result, convertTemplateDefinition(template))
+	}
+	return result, nil
+}
+
+// GetTemplateDefinition 获取参数化规则模板
+func (s *ruleService) GetTemplateDefinition(id string) (*models.RuleTemplateDefinition, error) {
+	if s.templates == nil {
+		return nil, fmt.Errorf("规则引擎未启用，无法管理规则模板")
+	}
+	template, err := s.templates.GetTemplate(id)
+	if err != nil {
+		return nil, err
+	}
+	webTemplate := convertTemplateDefinition(template)
+	return &webTemplate, nil
+}
+
+// SaveTemplateDefinition 创建或更新参数化规则模板，模板的实例规则随之重新生成
+func (s *ruleService) SaveTemplateDefinition(template *models.RuleTemplateDefinition) (*models.RuleTemplateDefinition, error) {
+	if s.templates == nil {
+		return nil, fmt.Errorf("规则引擎未启用，无法管理规则模板")
+	}
+	if err := s.templates.SaveTemplate(convertToManagerTemplate(template)); err != nil {
+		return nil, err
+	}
+	return s.GetTemplateDefinition(template.ID)
+}
+
+// DeleteTemplateDefinition 删除参数化规则模板及其实例规则
+func (s *ruleService) DeleteTemplateDefinition(id string) error {
+	if s.templates == nil {
+		return fmt.Errorf("规则引擎未启用，无法管理规则模板")
+	}
+	return s.templates.DeleteTemplate(id)
+}
+
+// GetTemplateRules 获取模板展开后生效的规则
+func (s *ruleService) GetTemplateRules(id string) ([]models.Rule, error) {
+	if s.templates == nil {
+		return nil, fmt.Errorf("规则引擎未启用，无法管理规则模板")
+	}
+	expanded, err := s.templates.ExpandTemplate(id)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]models.Rule, 0, len(expanded))
+	for _, rule := range expanded {
+		// 优先返回管理器中的规则，带有实际的版本和时间
+		if saved, err := s.manager.GetRule(rule.ID); err == nil {
+			rule = saved
+		}
+		result = append(result, convertToWebRule(rule))
+	}
+	return result, nil
+}
+
 // GetRuleExecutionHistory 获取规则执行历史
 func (s *ruleService) GetRuleExecutionHistory(id string, req *models.RuleHistoryRequest) ([]models.RuleExecution, int, error) {
 	// 模拟执行历史数据
@@ -745,10 +1142,12 @@ func (s *ruleService) CreateRuleFromTemplate(templateID string, req *models.Rule
 		Enabled:     rule.Enabled,
 		Priority:    rule.Priority,
 		Conditions:  rule.Conditions,
+		Schedule:    rule.Schedule,
+		After:       rule.After,
 		Actions:     rule.Actions,
 	}
 
-	return s.CreateRule(createReq)
+	return s.CreateRule(createReq, models.RuleChange{Note: "从模板" + templateID + "创建"})
 }
 
 // convertToManagerCondition converts models.RuleCondition to rules.Condition
@@ -799,6 +1198,43 @@ func convertToManagerCondition(webCond *models.RuleCondition) (*rules.Condition,
 		managerCond.Not = converted
 	}
 	
+	// Convert alarm condition
+	if webCond.Alarm != nil {
+		managerCond.Alarm = &rules.AlarmCondition{
+			Field:     webCond.Alarm.Field,
+			Direction: webCond.Alarm.Direction,
+			Raise:     webCond.Alarm.Raise,
+			Clear:     webCond.Alarm.Clear,
+			OnDelay:   webCond.Alarm.OnDelay,
+			OffDelay:  webCond.Alarm.OffDelay,
+			Latch:     webCond.Alarm.Latch,
+		}
+	}
+	
+	// Convert sequence condition
+	if webCond.Sequence != nil {
+		managerCond.Sequence = &rules.SequenceCondition{
+			Within:      webCond.Sequence.Within,
+			PartitionBy: webCond.Sequence.PartitionBy,
+			MaxPartial:  webCond.Sequence.MaxPartial,
+			Steps:       make([]*rules.SequenceStep, len(webCond.Sequence.Steps)),
+		}
+		for i, step := range webCond.Sequence.Steps {
+			converted, err := convertToManagerCondition(step.Condition)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert sequence step %d: %w", i, err)
+			}
+			managerCond.Sequence.Steps[i] = &rules.SequenceStep{
+				Name:      step.Name,
+				DeviceID:  step.DeviceID,
+				Key:       step.Key,
+				Condition: converted,
+				Within:    step.Within,
+				Negate:    step.Negate,
+			}
+		}
+	}
+	
 	return managerCond, nil
 }
 
@@ -24,6 +24,7 @@ type Services struct {
 	AlertIntegration    *AlertIntegrationService
 	AdapterMonitoring   *AdapterMonitoringService
 	SystemAlert         *SystemAlertService
+	Data                DataService
 	store               models.UserStore
 	PluginManager       plugin.PluginManager
 	RuleManager         rules.RuleManager
@@ -162,6 +163,7 @@ func NewServices(config *ServiceConfig) (*Services, error) {
 		AlertIntegration:  alertIntegration,
 		AdapterMonitoring: adapterMonitoring,
 		SystemAlert:       systemAlert,
+		Data:              NewDataService(config.PluginManager),
 		store:             store,
 		PluginManager:     config.PluginManager,
 		RuleManager:       config.RuleManager,
@@ -326,23 +328,23 @@ func (e *emptyRuleService) GetRule(id string) (*models.Rule, error) {
 	return nil, fmt.Errorf("规则服务不可用")
 }
 
-func (e *emptyRuleService) CreateRule(rule *models.RuleCreateRequest) (*models.Rule, error) {
+func (e *emptyRuleService) CreateRule(rule *models.RuleCreateRequest, change models.RuleChange) (*models.Rule, error) {
 	return nil, fmt.Errorf("规则服务不可用")
 }
 
-func (e *emptyRuleService) UpdateRule(id string, rule *models.RuleUpdateRequest) (*models.Rule, error) {
+func (e *emptyRuleService) UpdateRule(id string, rule *models.RuleUpdateRequest, change models.RuleChange) (*models.Rule, error) {
 	return nil, fmt.Errorf("规则服务不可用")
 }
 
-func (e *emptyRuleService) DeleteRule(id string) error {
+func (e *emptyRuleService) DeleteRule(id string, change models.RuleChange) error {
 	return fmt.Errorf("规则服务不可用")
 }
 
-func (e *emptyRuleService) EnableRule(id string) error {
+func (e *emptyRuleService) EnableRule(id string, change models.RuleChange) error {
 	return fmt.Errorf("规则服务不可用")
 }
 
-func (e *emptyRuleService) DisableRule(id string) error {
+func (e *emptyRuleService) DisableRule(id string, change models.RuleChange) error {
 	return fmt.Errorf("规则服务不可用")
 }
 
@@ -369,3 +371,51 @@ func (e *emptyRuleService) GetRuleTemplates() ([]models.RuleTemplate, error) {
 func (e *emptyRuleService) CreateRuleFromTemplate(templateID string, req *models.RuleFromTemplateRequest) (*models.Rule, error) {
 	return nil, fmt.Errorf("规则服务不可用")
 }
+
+func (e *emptyRuleService) GetRuleAlarms(id string) ([]models.RuleAlarmState, error) {
+	return nil, fmt.Errorf("规则服务不可用")
+}
+
+func (e *emptyRuleService) ResetRuleAlarm(id string, req *models.RuleAlarmResetRequest) ([]models.RuleAlarmState, error) {
+	return nil, fmt.Errorf("规则服务不可用")
+}
+
+func (e *emptyRuleService) ListRuleRevisions(id string) ([]models.RuleRevision, error) {
+	return nil, fmt.Errorf("规则服务不可用")
+}
+
+func (e *emptyRuleService) GetRuleRevision(id string, revision int) (*models.RuleRevision, error) {
+	return nil, fmt.Errorf("规则服务不可用")
+}
+
+func (e *emptyRuleService) DiffRuleRevisions(id string, from, to int) (*models.RuleRevisionDiff, error) {
+	return nil, fmt.Errorf("规则服务不可用")
+}
+
+func (e *emptyRuleService) RollbackRule(id string, revision int, change models.RuleChange) (*models.Rule, error) {
+	return nil, fmt.Errorf("规则服务不可用")
+}
+
+func (e *emptyRuleService) ExportRuleHistory() (*models.RuleHistoryExport, error) {
+	return nil, fmt.Errorf("规则服务不可用")
+}
+
+func (e *emptyRuleService) ListTemplateDefinitions() ([]models.RuleTemplateDefinition, error) {
+	return []models.RuleTemplateDefinition{}, nil
+}
+
+func (e *emptyRuleService) GetTemplateDefinition(id string) (*models.RuleTemplateDefinition, error) {
+	return nil, fmt.Errorf("规则服务不可用")
+}
+
+func (e *emptyRuleService) SaveTemplateDefinition(template *models.RuleTemplateDefinition) (*models.RuleTemplateDefinition, error) {
+	return nil, fmt.Errorf("规则服务不可用")
+}
+
+func (e *emptyRuleService) DeleteTemplateDefinition(id string) error {
+	return fmt.Errorf("规则服务不可用")
+}
+
+func (e *emptyRuleService) GetTemplateRules(id string) ([]models.Rule, error) {
+	return nil, fmt.Errorf("规则服务不可用")
+}